@@ -33,6 +33,11 @@ func ExecuteRPC(ctx *appcontext.AppContext, repo *repository.Repository, cmd sub
 		return 1, fmt.Errorf("subcommand is not an RPC")
 	}
 
+	if limited, ok := cmd.(subcommands.Limited); ok && limited.IsLimited() {
+		ctx.GetLogger().Info("resource limits requested, running without agent")
+		return 1, ErrRetryAgentless
+	}
+
 	client, err := NewClient(filepath.Join(ctx.CacheDir, "agent.sock"))
 	if err != nil {
 		ctx.GetLogger().Warn("failed to connect to agent, falling back to -no-agent")
@@ -62,6 +67,30 @@ func (c *Client) SendCommand(ctx *appcontext.AppContext, cmd subcommands.RPC, re
 		return 1, err
 	}
 
+	// forward pause requests, e.g. from signals, to the agent, and cancel
+	// the command if interrupted
+	pauseChan, stopPause := ctx.PauseNotify()
+	defer stopPause()
+	go func() {
+		for {
+			packet := Packet{Type: "cancel"}
+			select {
+			case paused, ok := <-pauseChan:
+				if !ok {
+					return
+				}
+				packet.Type = "resume"
+				if paused {
+					packet.Type = "pause"
+				}
+			case <-ctx.GetContext().Done():
+			}
+			if err := encoder.Encode(&packet); err != nil || packet.Type == "cancel" {
+				return
+			}
+		}
+	}()
+
 	var response Packet
 	for {
 		if err := decoder.Decode(&response); err != nil {
@@ -84,19 +84,32 @@ func (view APIView) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // TokenAuthMiddleware is a middleware that checks for the token in the request. If the token is empty, the middleware is a no-op.
+// Tokens of the namespace and path policies are also accepted, confining the request to their namespace
+// and restricting it to their path prefixes.
 func TokenAuthMiddleware(token string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if token != "" {
+			if token != "" || len(lnamespaces) != 0 || len(lpaths) != 0 {
 				key := r.Header.Get("Authorization")
 				if key == "" {
 					handleError(w, r, authError("missing Authorization header"))
 					return
 				}
 
-				if strings.Compare(key, "Bearer "+token) != 0 {
-					handleError(w, r, authError("invalid token"))
-					return
+				if token == "" || strings.Compare(key, "Bearer "+token) != 0 {
+					bearer, ok := strings.CutPrefix(key, "Bearer ")
+					namespace, inNamespace := lnamespaces[bearer]
+					prefixes, inPaths := lpaths[bearer]
+					if !ok || (!inNamespace && !inPaths) {
+						handleError(w, r, authError("invalid token"))
+						return
+					}
+					if inNamespace {
+						r = withNamespace(r, namespace)
+					}
+					if inPaths {
+						r = withPaths(r, prefixes)
+					}
 				}
 			}
 
@@ -122,20 +135,27 @@ func SetupRoutes(server *http.ServeMux, repo *repository.Repository, token strin
 		}
 	}))
 
-	server.Handle("GET /api/storage/configuration", authToken(JSONAPIView(storageConfiguration)))
-	server.Handle("GET /api/storage/states", authToken(JSONAPIView(storageStates)))
-	server.Handle("GET /api/storage/state/{state}", authToken(JSONAPIView(storageState)))
-	server.Handle("GET /api/storage/packfiles", authToken(JSONAPIView(storagePackfiles)))
-	server.Handle("GET /api/storage/packfile/{packfile}", authToken(JSONAPIView(storagePackfile)))
+	server.Handle("GET /api/storage/configuration", authToken(unconfined(JSONAPIView(storageConfiguration))))
+	server.Handle("GET /api/storage/states", authToken(unconfined(JSONAPIView(storageStates))))
+	server.Handle("GET /api/storage/state/{state}", authToken(unconfined(JSONAPIView(storageState))))
+	server.Handle("GET /api/storage/packfiles", authToken(unconfined(JSONAPIView(storagePackfiles))))
+	server.Handle("GET /api/storage/packfile/{packfile}", authToken(unconfined(JSONAPIView(storagePackfile))))
 
 	server.Handle("GET /api/repository/configuration", authToken(JSONAPIView(repositoryConfiguration)))
 	server.Handle("GET /api/repository/snapshots", authToken(JSONAPIView(repositorySnapshots)))
 	server.Handle("GET /api/repository/locate-pathname", authToken(JSONAPIView(repositoryLocatePathname)))
 	server.Handle("GET /api/repository/importer-types", authToken(JSONAPIView(repositoryImporterTypes)))
-	server.Handle("GET /api/repository/states", authToken(JSONAPIView(repositoryStates)))
-	server.Handle("GET /api/repository/state/{state}", authToken(JSONAPIView(repositoryState)))
+	server.Handle("GET /api/repository/freshness", authToken(JSONAPIView(repositoryFreshness)))
+	server.Handle("GET /api/repository/states", authToken(unconfined(JSONAPIView(repositoryStates))))
+	server.Handle("GET /api/repository/state/{state}", authToken(unconfined(JSONAPIView(repositoryState))))
+
+	// deleting a snapshot deletes all of its paths, whatever the namespace
+	server.Handle("GET /api/snapshots", authToken(unconfined(JSONAPIView(repositoryDeleteSnapshots))))
+	server.Handle("POST /api/snapshots", authToken(unconfined(JSONAPIView(repositoryDeleteSnapshots))))
 
 	server.Handle("GET /api/snapshot/{snapshot}", authToken(JSONAPIView(snapshotHeader)))
+	server.Handle("GET /api/snapshot/entropy/{snapshot}", authToken(JSONAPIView(snapshotEntropy)))
+	server.Handle("GET /api/snapshot/summary/{snapshot_path...}", authToken(JSONAPIView(snapshotSummary)))
 	server.Handle("GET /api/snapshot/reader/{snapshot_path...}", urlSigner.VerifyMiddleware(APIView(snapshotReader)))
 	server.Handle("POST /api/snapshot/reader-sign-url/{snapshot_path...}", authToken(JSONAPIView(urlSigner.Sign)))
 
@@ -146,4 +166,9 @@ func SetupRoutes(server *http.ServeMux, repo *repository.Repository, token strin
 
 	server.Handle("POST /api/snapshot/vfs/downloader/{snapshot_path...}", authToken(JSONAPIView(snapshotVFSDownloader)))
 	server.Handle("GET /api/snapshot/vfs/downloader-sign-url/{id}", JSONAPIView(snapshotVFSDownloaderSigned))
+
+	// restore grants are credentials of their own, redeemed without a token
+	server.Handle("POST /api/grant/{snapshot_path...}", authToken(JSONAPIView(grantMint)))
+	server.Handle("GET /api/grant", JSONAPIView(grantInfo))
+	server.Handle("GET /api/grant/archive", APIView(grantArchive))
 }
@@ -11,6 +11,9 @@ var (
 	ErrMissingField     = errors.New("Missing field")
 	ErrInvalidID        = errors.New("Invalid ID")
 	ErrInvalidSortKey   = errors.New("Invalid sort key")
+	ErrInvalidDuration  = errors.New("Invalid duration")
+	ErrNoFilter         = errors.New("No filter specified")
+	ErrConfirmMethod    = errors.New("Confirmation requires a POST request")
 )
 
 type ParamErrorType string
@@ -58,3 +61,19 @@ func authError(reason string) *ApiError {
 		Message:  reason,
 	}
 }
+
+func conflictError(reason string) *ApiError {
+	return &ApiError{
+		HttpCode: http.StatusConflict,
+		ErrCode:  "conflict",
+		Message:  reason,
+	}
+}
+
+func forbiddenError(reason string) *ApiError {
+	return &ApiError{
+		HttpCode: http.StatusForbidden,
+		ErrCode:  "forbidden",
+		Message:  reason,
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/grant"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+// DEFAULT_GRANT_VALIDITY is the validity of the grants minted through the
+// API when none is requested.
+const DEFAULT_GRANT_VALIDITY = 24 * time.Hour
+
+type GrantItem struct {
+	Token      string    `json:"token,omitempty"`
+	SnapshotID string    `json:"snapshot_id"`
+	Path       string    `json:"path"`
+	Expires    time.Time `json:"expires"`
+}
+
+func grantItem(token string, g *grant.Grant) GrantItem {
+	return GrantItem{
+		Token:      token,
+		SnapshotID: hex.EncodeToString(g.SnapshotID[:]),
+		Path:       g.Path,
+		Expires:    g.Expires,
+	}
+}
+
+// grantMint signs a grant to a snapshot subtree, to be redeemed by users
+// holding no API token.
+func grantMint(w http.ResponseWriter, r *http.Request) error {
+	snapshotID, path, err := SnapshotPathParam(r, lrepository, "snapshot_path")
+	if err != nil {
+		return err
+	}
+
+	validity, _, err := QueryParamToDuration(r, "validity")
+	if err != nil {
+		return err
+	}
+	if validity == 0 {
+		validity = DEFAULT_GRANT_VALIDITY
+	}
+
+	// the grant bypasses the token, check the namespace and path beforehand
+	if !pathAllowed(r, path) {
+		return pathNotFound(path)
+	}
+	snap, err := loadSnapshot(r, snapshotID)
+	if err != nil {
+		return err
+	}
+	snap.Close()
+
+	token, g, err := grant.Mint(lrepository, snapshotID, path, validity)
+	if errors.Is(err, grant.ErrNoSecret) {
+		return forbiddenError(err.Error())
+	} else if err != nil {
+		return parameterError("validity", InvalidArgument, err)
+	}
+	return json.NewEncoder(w).Encode(Item[GrantItem]{grantItem(token, g)})
+}
+
+// redeemGrant verifies the grant passed as the ?grant query parameter.
+func redeemGrant(r *http.Request) (*grant.Grant, error) {
+	token := r.URL.Query().Get("grant")
+	if token == "" {
+		return nil, authError("missing grant")
+	}
+	g, err := grant.Verify(lrepository, token)
+	if err != nil {
+		return nil, authError(err.Error())
+	}
+	return g, nil
+}
+
+func grantInfo(w http.ResponseWriter, r *http.Request) error {
+	g, err := redeemGrant(r)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(Item[GrantItem]{grantItem("", g)})
+}
+
+// grantArchive streams the subtree of a grant as an archive.
+func grantArchive(w http.ResponseWriter, r *http.Request) error {
+	g, err := redeemGrant(r)
+	if err != nil {
+		return err
+	}
+
+	format := r.URL.Query().Get("format")
+	var mime string
+	var ext string
+	switch format {
+	case snapshot.ArchiveTar:
+		mime = "application/x-tar"
+		ext = ".tar"
+	case snapshot.ArchiveTarball:
+		mime = "application/x-gzip"
+		ext = ".tar.gz"
+	case snapshot.ArchiveZip:
+		mime = "application/zip"
+		ext = ".zip"
+	default:
+		return &ApiError{
+			HttpCode: 400,
+			ErrCode:  "unknown-archive-format",
+			Message:  "Unknown Archive Format",
+		}
+	}
+
+	snap, err := snapshot.Load(lrepository, g.SnapshotID)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	name := fmt.Sprintf("snapshot-%x-%s%s", g.SnapshotID[:4], filepath.Base(g.Path), ext)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	w.Header().Set("Content-Type", mime)
+
+	return snap.Archive(w, format, []string{g.Path}, r.URL.Query().Get("rebase") == "true")
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/grant"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantRedeem(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x42}, 32)
+
+	config := ptesting.NewConfiguration()
+	serializedConfig, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetMACHasher(hashing.DEFAULT_HASHING_ALGORITHM, secret)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serializedConfig))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	lstore, err := storage.Create(map[string]string{"location": "/test/location"}, wrappedConfig)
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	cache := caching.NewManager(t.TempDir())
+	defer cache.Close()
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+	ctx.SetSecret(secret)
+	repo, err := repository.New(ctx, lstore, wrappedConfig)
+	require.NoError(t, err)
+
+	token := "test-token"
+	mux := http.NewServeMux()
+	SetupRoutes(mux, repo, token)
+
+	snapshotID := objects.MAC{0x01, 0x02}
+	granted, _, err := grant.Mint(repo, snapshotID, "/home/alice", time.Hour)
+	require.NoError(t, err)
+
+	redeem := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// the grant stands for the API token
+	w := redeem("/api/grant?grant=" + granted)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res Item[GrantItem]
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	require.Equal(t, "/home/alice", res.Item.Path)
+	require.Empty(t, res.Item.Token)
+
+	require.Equal(t, http.StatusUnauthorized, redeem("/api/grant").Code)
+	require.Equal(t, http.StatusUnauthorized, redeem("/api/grant?grant="+token).Code)
+	require.Equal(t, http.StatusUnauthorized, redeem("/api/grant/archive?format=tar&grant="+granted[:len(granted)-2]).Code)
+	require.Equal(t, http.StatusBadRequest, redeem("/api/grant/archive?format=rar&grant="+granted).Code)
+
+	// minting requires the API token
+	req, err := http.NewRequest("POST", "/api/grant/0102", nil)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
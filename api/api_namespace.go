@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+)
+
+// NamespacePolicy maps API tokens to the snapshot namespace their holders
+// are confined to, letting a single repository be served to several users
+// or departments.
+type NamespacePolicy map[string]string
+
+var lnamespaces NamespacePolicy
+
+type namespaceKey struct{}
+
+// SetNamespacePolicy installs the tokens confined to a namespace, in
+// addition to the token given to SetupRoutes which has unrestricted access.
+func SetNamespacePolicy(policy NamespacePolicy) {
+	lnamespaces = policy
+}
+
+func withNamespace(r *http.Request, namespace string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), namespaceKey{}, namespace))
+}
+
+// callerNamespace returns the namespace the caller is confined to, if any.
+func callerNamespace(r *http.Request) (string, bool) {
+	namespace, ok := r.Context().Value(namespaceKey{}).(string)
+	return namespace, ok
+}
+
+// visible reports whether the snapshot may be disclosed to the caller.
+func visible(r *http.Request, hdr *header.Header) bool {
+	namespace, confined := callerNamespace(r)
+	return !confined || hdr.Namespace == namespace
+}
+
+// loadSnapshot loads a snapshot on behalf of the caller, snapshots outside
+// of its namespace are reported as not found so as not to leak their
+// existence.
+func loadSnapshot(r *http.Request, snapshotID objects.MAC) (*snapshot.Snapshot, error) {
+	snap, err := snapshot.Load(lrepository, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible(r, snap.Header) {
+		snap.Close()
+		return nil, snapshot.ErrNotFound
+	}
+	return snap, nil
+}
+
+// unconfined restricts an endpoint exposing raw repository data, which
+// cannot be filtered by namespace or path, to unrestricted callers.
+func unconfined(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, confined := callerNamespace(r); confined {
+			handleError(w, r, forbiddenError("not allowed from a namespace"))
+			return
+		}
+		if _, restricted := callerPaths(r); restricted {
+			handleError(w, r, forbiddenError("not allowed with path restrictions"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceMiddleware(t *testing.T) {
+	SetNamespacePolicy(NamespacePolicy{"accounting-token": "accounting"})
+	defer SetNamespacePolicy(nil)
+
+	var namespace string
+	var confined bool
+	handler := TokenAuthMiddleware("admin-token")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace, confined = callerNamespace(r)
+	}))
+
+	serve := func(h http.Handler, key string) int {
+		req := httptest.NewRequest("GET", "/api/repository/snapshots", nil)
+		if key != "" {
+			req.Header.Set("Authorization", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(handler, "Bearer admin-token"))
+	require.False(t, confined)
+
+	require.Equal(t, http.StatusOK, serve(handler, "Bearer accounting-token"))
+	require.True(t, confined)
+	require.Equal(t, "accounting", namespace)
+
+	require.Equal(t, http.StatusUnauthorized, serve(handler, "Bearer other-token"))
+	require.Equal(t, http.StatusUnauthorized, serve(handler, "accounting-token"))
+	require.Equal(t, http.StatusUnauthorized, serve(handler, ""))
+
+	raw := TokenAuthMiddleware("admin-token")(unconfined(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	require.Equal(t, http.StatusOK, serve(raw, "Bearer admin-token"))
+	require.Equal(t, http.StatusForbidden, serve(raw, "Bearer accounting-token"))
+}
+
+func TestNamespaceVisible(t *testing.T) {
+	shared := &header.Header{}
+	accounting := &header.Header{Namespace: "accounting"}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	require.True(t, visible(req, shared))
+	require.True(t, visible(req, accounting))
+
+	req = withNamespace(req, "accounting")
+	require.False(t, visible(req, shared))
+	require.True(t, visible(req, accounting))
+
+	req = withNamespace(req, "legal")
+	require.False(t, visible(req, accounting))
+}
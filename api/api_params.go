@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/objects"
@@ -78,6 +79,20 @@ func QueryParamToInt64(r *http.Request, param string) (int64, bool, error) {
 	return n, true, nil
 }
 
+func QueryParamToFloat64(r *http.Request, param string) (float64, bool, error) {
+	str := r.URL.Query().Get(param)
+	if str == "" {
+		return 0, false, nil
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, true, parameterError(param, BadNumber, err)
+	}
+
+	return n, true, nil
+}
+
 func QueryParamToString(r *http.Request, param string) (string, bool, error) {
 	str := r.URL.Query().Get(param)
 	if str == "" {
@@ -87,6 +102,32 @@ func QueryParamToString(r *http.Request, param string) (string, bool, error) {
 	return str, true, nil
 }
 
+func QueryParamToDuration(r *http.Request, param string) (time.Duration, bool, error) {
+	str := r.URL.Query().Get(param)
+	if str == "" {
+		return 0, false, nil
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil || d <= 0 {
+		return 0, true, parameterError(param, InvalidArgument, ErrInvalidDuration)
+	}
+	return d, true, nil
+}
+
+func QueryParamToTime(r *http.Request, param string) (time.Time, bool, error) {
+	str := r.URL.Query().Get(param)
+	if str == "" {
+		return time.Time{}, false, nil
+	}
+
+	t, err := utils.ParseTimeFlag(str)
+	if err != nil {
+		return time.Time{}, true, parameterError(param, InvalidArgument, err)
+	}
+	return t, true, nil
+}
+
 func QueryParamToSortKeys(r *http.Request, param, def string) ([]string, error) {
 	str := r.URL.Query().Get(param)
 	if str == "" {
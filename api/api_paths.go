@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PathPolicy maps API tokens to the path prefixes their holders may
+// browse and restore, in all the snapshots they can see, letting users
+// serve themselves from backups shared with others.
+type PathPolicy map[string][]string
+
+var lpaths PathPolicy
+
+type pathsKey struct{}
+
+// SetPathPolicy installs the tokens restricted to path prefixes.  A token
+// may also be confined to a namespace by SetNamespacePolicy, in which case
+// both restrictions apply.
+func SetPathPolicy(policy PathPolicy) {
+	lpaths = make(PathPolicy, len(policy))
+	for token, prefixes := range policy {
+		for _, prefix := range prefixes {
+			lpaths[token] = append(lpaths[token], path.Clean("/"+prefix))
+		}
+	}
+}
+
+func withPaths(r *http.Request, prefixes []string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), pathsKey{}, prefixes))
+}
+
+// callerPaths returns the path prefixes the caller is restricted to, if any.
+func callerPaths(r *http.Request) ([]string, bool) {
+	prefixes, ok := r.Context().Value(pathsKey{}).([]string)
+	return prefixes, ok
+}
+
+// within reports whether pathname is prefix or lies below it.
+func within(prefix, pathname string) bool {
+	return prefix == "/" || pathname == prefix || strings.HasPrefix(pathname, prefix+"/")
+}
+
+// pathAllowed reports whether the caller may access pathname and all that
+// is below it.
+func pathAllowed(r *http.Request, pathname string) bool {
+	prefixes, restricted := callerPaths(r)
+	if !restricted {
+		return true
+	}
+
+	pathname = path.Clean("/" + pathname)
+	for _, prefix := range prefixes {
+		if within(prefix, pathname) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathTraversable reports whether pathname may be listed to the caller,
+// either because it is allowed or because it leads to an allowed prefix.
+func pathTraversable(r *http.Request, pathname string) bool {
+	prefixes, restricted := callerPaths(r)
+	if !restricted {
+		return true
+	}
+
+	pathname = path.Clean("/" + pathname)
+	for _, prefix := range prefixes {
+		if within(prefix, pathname) || within(pathname, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathNotFound is returned for the paths the caller is not allowed to
+// access so as not to leak their existence.
+func pathNotFound(pathname string) *ApiError {
+	return &ApiError{
+		HttpCode: http.StatusNotFound,
+		ErrCode:  "not-found",
+		Message:  pathname + ": file does not exist",
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathMiddleware(t *testing.T) {
+	SetNamespacePolicy(NamespacePolicy{"alice-token": "corporate"})
+	SetPathPolicy(PathPolicy{"alice-token": {"/home/alice/"}, "bob-token": {"/home/bob"}})
+	defer SetNamespacePolicy(nil)
+	defer SetPathPolicy(nil)
+
+	var prefixes []string
+	var restricted, confined bool
+	handler := TokenAuthMiddleware("admin-token")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefixes, restricted = callerPaths(r)
+		_, confined = callerNamespace(r)
+	}))
+
+	serve := func(h http.Handler, key string) int {
+		req := httptest.NewRequest("GET", "/api/snapshot/vfs/children/abcd:/home", nil)
+		req.Header.Set("Authorization", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(handler, "Bearer admin-token"))
+	require.False(t, restricted)
+
+	require.Equal(t, http.StatusOK, serve(handler, "Bearer bob-token"))
+	require.True(t, restricted)
+	require.False(t, confined)
+	require.Equal(t, []string{"/home/bob"}, prefixes)
+
+	// both policies apply to a token found in both
+	require.Equal(t, http.StatusOK, serve(handler, "Bearer alice-token"))
+	require.True(t, restricted)
+	require.True(t, confined)
+	require.Equal(t, []string{"/home/alice"}, prefixes)
+
+	require.Equal(t, http.StatusUnauthorized, serve(handler, "Bearer eve-token"))
+
+	raw := TokenAuthMiddleware("admin-token")(unconfined(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	require.Equal(t, http.StatusOK, serve(raw, "Bearer admin-token"))
+	require.Equal(t, http.StatusForbidden, serve(raw, "Bearer bob-token"))
+}
+
+func TestPathAllowed(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	require.True(t, pathAllowed(req, "/etc/passwd"))
+	require.True(t, pathTraversable(req, "/etc"))
+
+	req = withPaths(req, []string{"/home/alice", "/srv/shared"})
+	for _, pathname := range []string{"/home/alice", "/home/alice/", "/home/alice/notes.txt", "home/alice/docs", "/srv/shared/x"} {
+		require.True(t, pathAllowed(req, pathname), pathname)
+		require.True(t, pathTraversable(req, pathname), pathname)
+	}
+
+	// directories leading to the prefixes are traversable only
+	for _, pathname := range []string{"", "/", "/home", "/srv"} {
+		require.False(t, pathAllowed(req, pathname), pathname)
+		require.True(t, pathTraversable(req, pathname), pathname)
+	}
+
+	for _, pathname := range []string{"/etc", "/home/bob", "/home/alice2", "/home/alice/../bob"} {
+		require.False(t, pathAllowed(req, pathname), pathname)
+		require.False(t, pathTraversable(req, pathname), pathname)
+	}
+
+	req = withPaths(req, []string{"/"})
+	require.True(t, pathAllowed(req, "/etc"))
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/header"
@@ -52,6 +54,10 @@ func repositorySnapshots(w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return err
 		}
+		if !visible(r, snap.Header) {
+			snap.Close()
+			continue
+		}
 
 		if importerType != "" && strings.ToLower(snap.Header.GetSource(0).Importer.Type) != strings.ToLower(importerType) {
 			snap.Close()
@@ -87,6 +93,112 @@ func repositorySnapshots(w http.ResponseWriter, r *http.Request) error {
 	return json.NewEncoder(w).Encode(items)
 }
 
+// BulkDeletion lists the snapshots selected for deletion along with the
+// token confirming it, or the snapshots deleted once confirmed.
+type BulkDeletion struct {
+	Total   int             `json:"total"`
+	Items   []header.Header `json:"items"`
+	Token   string          `json:"token,omitempty"`
+	Deleted bool            `json:"deleted"`
+}
+
+// repositoryDeleteSnapshots previews the deletion of the snapshots matching
+// the filters, and only deletes them when POSTed again with the token of
+// the preview, provided the selection did not change in between.
+func repositoryDeleteSnapshots(w http.ResponseWriter, r *http.Request) error {
+	locateOptions := utils.NewDefaultLocateOptions()
+	locateOptions.SortOrder = utils.LocateSortOrderAscending
+
+	filtered := false
+	for param, value := range map[string]*string{
+		"name":        &locateOptions.Name,
+		"category":    &locateOptions.Category,
+		"environment": &locateOptions.Environment,
+		"perimeter":   &locateOptions.Perimeter,
+		"job":         &locateOptions.Job,
+		"tag":         &locateOptions.Tag,
+	} {
+		str, ok, err := QueryParamToString(r, param)
+		if err != nil {
+			return err
+		}
+		*value = str
+		filtered = filtered || ok
+	}
+
+	for param, value := range map[string]*time.Time{
+		"before": &locateOptions.Before,
+		"since":  &locateOptions.Since,
+	} {
+		t, ok, err := QueryParamToTime(r, param)
+		if err != nil {
+			return err
+		}
+		*value = t
+		filtered = filtered || ok
+	}
+
+	if !filtered {
+		return parameterError("filter", MissingArgument, ErrNoFilter)
+	}
+
+	confirm, confirming, err := QueryParamToString(r, "confirm")
+	if err != nil {
+		return err
+	}
+	if confirming && r.Method != http.MethodPost {
+		return parameterError("confirm", InvalidArgument, ErrConfirmMethod)
+	}
+
+	if err := lrepository.RebuildState(); err != nil {
+		return err
+	}
+
+	snapshotIDs, err := utils.LocateSnapshotIDs(lrepository, locateOptions)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]objects.MAC, 0, len(snapshotIDs))
+	headers := make([]header.Header, 0, len(snapshotIDs))
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(lrepository, snapshotID)
+		if err != nil {
+			return err
+		}
+		if visible(r, snap.Header) {
+			selected = append(selected, snapshotID)
+			headers = append(headers, *snap.Header)
+		}
+		snap.Close()
+	}
+
+	token := utils.ConfirmationToken(selected)
+	if !confirming {
+		return json.NewEncoder(w).Encode(BulkDeletion{
+			Total: len(headers),
+			Items: headers,
+			Token: token,
+		})
+	}
+
+	if confirm != token {
+		return conflictError("the selection changed since the preview, nothing was deleted")
+	}
+
+	for _, snapshotID := range selected {
+		if err := lrepository.DeleteSnapshot(snapshotID); err != nil {
+			return err
+		}
+	}
+
+	return json.NewEncoder(w).Encode(BulkDeletion{
+		Total:   len(headers),
+		Items:   headers,
+		Deleted: true,
+	})
+}
+
 func repositoryStates(w http.ResponseWriter, r *http.Request) error {
 	states, err := lrepository.GetStates()
 	if err != nil {
@@ -135,6 +247,10 @@ func repositoryImporterTypes(w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return err
 		}
+		if !visible(r, snap.Header) {
+			snap.Close()
+			continue
+		}
 		importerTypesMap[strings.ToLower(snap.Header.GetSource(0).Importer.Type)] = struct{}{}
 	}
 
@@ -185,6 +301,9 @@ func repositoryLocatePathname(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	if !pathAllowed(r, resource) {
+		return pathNotFound(resource)
+	}
 
 	sortKeys, err := QueryParamToSortKeys(r, "sort", "Timestamp")
 	if err != nil {
@@ -205,6 +324,10 @@ func repositoryLocatePathname(w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return err
 		}
+		if !visible(r, snap.Header) {
+			snap.Close()
+			continue
+		}
 
 		if importerType != "" && strings.ToLower(snap.Header.GetSource(0).Importer.Type) != strings.ToLower(importerType) {
 			snap.Close()
@@ -261,3 +384,67 @@ func repositoryLocatePathname(w http.ResponseWriter, r *http.Request) error {
 
 	return json.NewEncoder(w).Encode(items)
 }
+
+// repositoryFreshness reports, for every job found in the repository, the
+// most recent snapshot it produced.  When an expected frequency is given,
+// jobs whose latest snapshot is older than that are flagged as stale.
+func repositoryFreshness(w http.ResponseWriter, r *http.Request) error {
+	expect, _, err := QueryParamToDuration(r, "expect")
+	if err != nil {
+		return err
+	}
+
+	lrepository.RebuildState()
+
+	snapshotIDs, err := lrepository.GetSnapshots()
+	if err != nil {
+		return err
+	}
+
+	type Entry struct {
+		Job        string      `json:"job"`
+		SnapshotID objects.MAC `json:"snapshot_id"`
+		Timestamp  time.Time   `json:"timestamp"`
+		Age        float64     `json:"age"`
+		Stale      bool        `json:"stale"`
+	}
+
+	latest := make(map[string]Entry)
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(lrepository, snapshotID)
+		if err != nil {
+			return err
+		}
+		if !visible(r, snap.Header) {
+			snap.Close()
+			continue
+		}
+
+		entry, ok := latest[snap.Header.Job]
+		if !ok || snap.Header.Timestamp.After(entry.Timestamp) {
+			latest[snap.Header.Job] = Entry{
+				Job:        snap.Header.Job,
+				SnapshotID: snapshotID,
+				Timestamp:  snap.Header.Timestamp,
+			}
+		}
+		snap.Close()
+	}
+
+	now := time.Now()
+	items := Items[Entry]{
+		Total: len(latest),
+		Items: make([]Entry, 0, len(latest)),
+	}
+	for _, entry := range latest {
+		age := now.Sub(entry.Timestamp)
+		entry.Age = age.Seconds()
+		entry.Stale = expect != 0 && age > expect
+		items.Items = append(items.Items, entry)
+	}
+	sort.Slice(items.Items, func(i, j int) bool {
+		return items.Items[i].Job < items.Items[j].Job
+	})
+
+	return json.NewEncoder(w).Encode(items)
+}
@@ -2,12 +2,14 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -16,7 +18,10 @@ import (
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	fsimporter "github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/PlakarKorp/plakar/storage/backends/database"
 	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/PlakarKorp/plakar/versioning"
 	"github.com/stretchr/testify/require"
@@ -655,3 +660,193 @@ func Test_RepositoryStateErrors(t *testing.T) {
 		})
 	}
 }
+
+func Test_RepositoryFreshnessErrors(t *testing.T) {
+	config := ptesting.NewConfiguration()
+
+	serializedConfig, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serializedConfig))
+	require.NoError(t, err)
+
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	lstore, err := storage.Create(map[string]string{"location": "/test/location"}, wrappedConfig)
+	require.NoError(t, err, "creating storage")
+
+	ctx := appcontext.NewAppContext()
+	cache := caching.NewManager("/tmp/test_plakar")
+	defer cache.Close()
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+	repo, err := repository.New(ctx, lstore, wrappedConfig)
+	require.NoError(t, err, "creating repository")
+
+	var noToken string
+	mux := http.NewServeMux()
+	SetupRoutes(mux, repo, noToken)
+
+	for _, expect := range []string{"abc", "-1h", "0s"} {
+		req, err := http.NewRequest("GET", "/api/repository/freshness?expect="+url.QueryEscape(expect), nil)
+		require.NoError(t, err, "creating request")
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code, "expected status code 400 for %q", expect)
+	}
+}
+
+func Test_RepositoryDeleteSnapshotsErrors(t *testing.T) {
+	config := ptesting.NewConfiguration()
+
+	serializedConfig, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serializedConfig))
+	require.NoError(t, err)
+
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	lstore, err := storage.Create(map[string]string{"location": "/test/location"}, wrappedConfig)
+	require.NoError(t, err, "creating storage")
+
+	ctx := appcontext.NewAppContext()
+	cache := caching.NewManager("/tmp/test_plakar")
+	defer cache.Close()
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+	repo, err := repository.New(ctx, lstore, wrappedConfig)
+	require.NoError(t, err, "creating repository")
+
+	var noToken string
+	mux := http.NewServeMux()
+	SetupRoutes(mux, repo, noToken)
+
+	for _, method := range []string{"GET", "POST"} {
+		for _, params := range []string{"", "before=abc", "since=abc&name=foo"} {
+			req, err := http.NewRequest(method, "/api/snapshots?"+params, nil)
+			require.NoError(t, err, "creating request")
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			require.Equal(t, http.StatusBadRequest, w.Code, "expected status code 400 for %s %q", method, params)
+		}
+	}
+
+	// deletions are only confirmed by POST
+	req, err := http.NewRequest("GET", "/api/snapshots?name=foo&confirm=abc", nil)
+	require.NoError(t, err, "creating request")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_RepositoryDeleteSnapshots(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpBackupDir := filepath.Join(tmpDir, "backup")
+	require.NoError(t, os.MkdirAll(tmpBackupDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, "dummy.txt"), []byte("hello"), 0644))
+
+	config := storage.NewConfiguration()
+	config.Encryption = nil
+	serializedConfig, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serializedConfig))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	lstore, err := database.NewStore(map[string]string{"location": "sqlite://" + filepath.Join(tmpDir, "repo.db")})
+	require.NoError(t, err)
+	require.NoError(t, lstore.Create(wrappedConfig))
+
+	ctx := appcontext.NewAppContext()
+	cache := caching.NewManager(filepath.Join(tmpDir, "cache"))
+	defer cache.Close()
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+	repo, err := repository.New(ctx, lstore, wrappedConfig)
+	require.NoError(t, err, "creating repository")
+
+	backup := func(name string) {
+		snap, err := snapshot.New(repo)
+		require.NoError(t, err)
+		defer snap.Close()
+
+		imp, err := fsimporter.NewFSImporter(map[string]string{"location": tmpBackupDir})
+		require.NoError(t, err)
+		require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: name, MaxConcurrency: 1}))
+	}
+	backup("alpha")
+	backup("alpha")
+	backup("beta")
+
+	token := "test-token"
+	mux := http.NewServeMux()
+	SetupRoutes(mux, repo, token)
+
+	call := func(method string, params string) (*httptest.ResponseRecorder, BulkDeletion) {
+		req, err := http.NewRequest(method, "/api/snapshots?"+params, nil)
+		require.NoError(t, err, "creating request")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		var res BulkDeletion
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return w, res
+	}
+
+	// previews don't delete anything, whatever the method
+	w, preview := call("GET", "name=alpha")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 2, preview.Total)
+	require.NotEmpty(t, preview.Token)
+	require.False(t, preview.Deleted)
+
+	w, again := call("POST", "name=alpha")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, preview.Token, again.Token)
+	require.False(t, again.Deleted)
+
+	// a token for another selection is refused
+	w, beta := call("GET", "name=beta")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, beta.Total)
+	require.NotEqual(t, preview.Token, beta.Token)
+
+	w, _ = call("POST", "name=alpha&confirm="+url.QueryEscape(beta.Token))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	// as is a stale one, once the selection changed
+	backup("alpha")
+	w, _ = call("POST", "name=alpha&confirm="+url.QueryEscape(preview.Token))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w, preview = call("GET", "name=alpha")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 3, preview.Total)
+
+	w, deleted := call("POST", "name=alpha&confirm="+url.QueryEscape(preview.Token))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, deleted.Deleted)
+	require.Equal(t, 3, deleted.Total)
+
+	w, preview = call("GET", "name=alpha")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 0, preview.Total)
+
+	w, beta = call("GET", "name=beta")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, beta.Total)
+}
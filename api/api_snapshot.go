@@ -41,7 +41,7 @@ func snapshotHeader(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	snap, err := snapshot.Load(lrepository, snapshotID32)
+	snap, err := loadSnapshot(r, snapshotID32)
 	if err != nil {
 		return err
 	}
@@ -49,11 +49,67 @@ func snapshotHeader(w http.ResponseWriter, r *http.Request) error {
 	return json.NewEncoder(w).Encode(Item[*header.Header]{Item: snap.Header})
 }
 
+func snapshotEntropy(w http.ResponseWriter, r *http.Request) error {
+	snapshotID32, err := PathParamToID(r, "snapshot")
+	if err != nil {
+		return err
+	}
+
+	opts := snapshot.NewDefaultEntropyOptions()
+	if threshold, ok, err := QueryParamToFloat64(r, "threshold"); err != nil {
+		return err
+	} else if ok {
+		opts.Threshold = threshold
+	}
+	if delta, ok, err := QueryParamToFloat64(r, "delta"); err != nil {
+		return err
+	} else if ok {
+		opts.DeltaThreshold = delta
+	}
+
+	snap, err := loadSnapshot(r, snapshotID32)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	prev, err := snap.Previous()
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		defer prev.Close()
+	}
+
+	report, err := snap.Entropy(prev, opts)
+	if err != nil {
+		return err
+	}
+
+	if _, restricted := callerPaths(r); restricted {
+		allowed := report[:0]
+		for _, entry := range report {
+			if pathAllowed(r, entry.Path) {
+				allowed = append(allowed, entry)
+			}
+		}
+		report = allowed
+	}
+
+	return json.NewEncoder(w).Encode(Items[snapshot.EntropyEntry]{
+		Total: len(report),
+		Items: report,
+	})
+}
+
 func snapshotReader(w http.ResponseWriter, r *http.Request) error {
 	snapshotID32, path, err := SnapshotPathParam(r, lrepository, "snapshot_path")
 	if err != nil {
 		return err
 	}
+	if !pathAllowed(r, path) {
+		return pathNotFound(path)
+	}
 
 	do_highlight := false
 	do_download := false
@@ -68,7 +124,7 @@ func snapshotReader(w http.ResponseWriter, r *http.Request) error {
 		do_highlight = true
 	}
 
-	snap, err := snapshot.Load(lrepository, snapshotID32)
+	snap, err := loadSnapshot(r, snapshotID32)
 	if err != nil {
 		return err
 	}
@@ -164,6 +220,17 @@ func (signer SnapshotReaderURLSigner) Sign(w http.ResponseWriter, r *http.Reques
 	}
 	snapshotId := fmt.Sprintf("%0x", snapshotID32[:])
 
+	// the signed URL bypasses the token, check the namespace and path
+	// beforehand
+	if !pathAllowed(r, path) {
+		return pathNotFound(path)
+	}
+	snap, err := loadSnapshot(r, snapshotID32)
+	if err != nil {
+		return err
+	}
+	snap.Close()
+
 	now := time.Now()
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, SnapshotSignedURLClaims{
 		SnapshotID: snapshotId,
@@ -248,8 +315,11 @@ func snapshotVFSBrowse(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	if !pathTraversable(r, path) {
+		return pathNotFound(path)
+	}
 
-	snap, err := snapshot.Load(lrepository, snapshotID32)
+	snap, err := loadSnapshot(r, snapshotID32)
 	if err != nil {
 		return err
 	}
@@ -267,14 +337,60 @@ func snapshotVFSBrowse(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	// directories leading to the allowed paths are listed, but what they
+	// hold besides is not disclosed
+	if !pathAllowed(r, path) {
+		entry.Summary = nil
+	}
+
 	return json.NewEncoder(w).Encode(Item[*vfs.Entry]{Item: entry})
 }
 
+// snapshotSummary returns the summary computed at backup time for a
+// directory: counts, sizes, errors and averages, both for the directory
+// itself and for everything below it.
+func snapshotSummary(w http.ResponseWriter, r *http.Request) error {
+	snapshotID32, path, err := SnapshotPathParam(r, lrepository, "snapshot_path")
+	if err != nil {
+		return err
+	}
+	if !pathAllowed(r, path) {
+		return pathNotFound(path)
+	}
+
+	snap, err := loadSnapshot(r, snapshotID32)
+	if err != nil {
+		return err
+	}
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	entry, err := fs.GetEntry(path)
+	if err != nil {
+		return err
+	}
+
+	if !entry.IsDir() || entry.Summary == nil {
+		return parameterError("snapshot_path", InvalidArgument, errors.New("not a directory"))
+	}
+
+	return json.NewEncoder(w).Encode(Item[*vfs.Summary]{Item: entry.Summary})
+}
+
 func snapshotVFSChildren(w http.ResponseWriter, r *http.Request) error {
 	snapshotID32, path, err := SnapshotPathParam(r, lrepository, "snapshot_path")
 	if err != nil {
 		return err
 	}
+	if !pathTraversable(r, path) {
+		return pathNotFound(path)
+	}
 
 	offset, _, err := QueryParamToInt64(r, "offset")
 	if err != nil {
@@ -296,7 +412,7 @@ func snapshotVFSChildren(w http.ResponseWriter, r *http.Request) error {
 	}
 	_ = sortKeys
 
-	snap, err := snapshot.Load(lrepository, snapshotID32)
+	snap, err := loadSnapshot(r, snapshotID32)
 	if err != nil {
 		return err
 	}
@@ -332,21 +448,38 @@ func snapshotVFSChildren(w http.ResponseWriter, r *http.Request) error {
 		limit = int64(fsinfo.Summary.Directory.Children)
 	}
 
+	// with path restrictions, the children are filtered and counted as
+	// they are listed
+	_, restricted := callerPaths(r)
+
 	var i int64
 	for child := range iter {
 		if child == nil {
 			break
 		}
+		if !pathTraversable(r, child.Path()) {
+			continue
+		}
+		if !pathAllowed(r, child.Path()) {
+			child.Summary = nil
+		}
 		if i < offset {
 			i++
 			continue
 		}
 		if i >= limit+offset {
-			break
+			if !restricted {
+				break
+			}
+			i++
+			continue
 		}
 		items.Items = append(items.Items, child)
 		i++
 	}
+	if restricted {
+		items.Total = int(i)
+	}
 	return json.NewEncoder(w).Encode(items)
 }
 
@@ -355,6 +488,9 @@ func snapshotVFSSearch(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	if !pathTraversable(r, path) {
+		return pathNotFound(path)
+	}
 
 	var offset, limit int
 	if str := r.URL.Query().Get("offset"); str != "" {
@@ -372,7 +508,7 @@ func snapshotVFSSearch(w http.ResponseWriter, r *http.Request) error {
 		limit = int(o)
 	}
 
-	snap, err := snapshot.Load(lrepository, snapshotID32)
+	snap, err := loadSnapshot(r, snapshotID32)
 	if err != nil {
 		return err
 	}
@@ -394,6 +530,14 @@ func snapshotVFSSearch(w http.ResponseWriter, r *http.Request) error {
 		Limit: limit,
 	}
 
+	// results outside of the allowed paths are filtered out below, so the
+	// pagination can't be left to the search
+	_, restricted := callerPaths(r)
+	if restricted {
+		searchOpts.Offset = 0
+		searchOpts.Limit = 0
+	}
+
 	items := ItemsPage[*vfs.Entry]{
 		Items: []*vfs.Entry{},
 	}
@@ -403,11 +547,25 @@ func snapshotVFSSearch(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	skipped := 0
 	for entry, err := range it {
 		if err != nil {
 			return err
 		}
 
+		if restricted {
+			if !pathAllowed(r, entry.Path()) {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if limit != 0 && len(items.Items) == limit {
+				break
+			}
+		}
+
 		items.Items = append(items.Items, entry)
 	}
 
@@ -424,6 +582,9 @@ func snapshotVFSErrors(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	if !pathTraversable(r, path) {
+		return pathNotFound(path)
+	}
 
 	sortKeysStr := r.URL.Query().Get("sort")
 	if sortKeysStr == "" {
@@ -443,7 +604,7 @@ func snapshotVFSErrors(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	snap, err := snapshot.Load(lrepository, snapshotID32)
+	snap, err := loadSnapshot(r, snapshotID32)
 	if err != nil {
 		return err
 	}
@@ -467,6 +628,9 @@ func snapshotVFSErrors(w http.ResponseWriter, r *http.Request) error {
 		Items: []*vfs.ErrorItem{},
 	}
 	for errorEntry := range errorList {
+		if !pathAllowed(r, errorEntry.Name) {
+			continue
+		}
 		if i < offset {
 			i++
 			continue
@@ -502,9 +666,21 @@ func snapshotVFSDownloader(w http.ResponseWriter, r *http.Request) error {
 		return parameterError("BODY", InvalidArgument, err)
 	}
 
-	if _, err = snapshot.Load(lrepository, snapshotID32); err != nil {
-		return nil
+	// the download link bypasses the token, check the paths beforehand
+	if _, restricted := callerPaths(r); restricted && len(query.Items) == 0 {
+		return forbiddenError("the items to download must be given with path restrictions")
+	}
+	for _, item := range query.Items {
+		if !pathAllowed(r, item.Pathname) {
+			return pathNotFound(item.Pathname)
+		}
+	}
+
+	snap, err := loadSnapshot(r, snapshotID32)
+	if err != nil {
+		return err
 	}
+	snap.Close()
 
 	for {
 		id := uuid.New().String()
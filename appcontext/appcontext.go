@@ -19,6 +19,7 @@ type AppContext struct {
 	logger  *logging.Logger  `msgpack:"-"`
 	context context.Context  `msgpack:"-"`
 	secret  []byte           `msgpack:"-"`
+	pause   *pauseGate       `msgpack:"-"`
 	Config  *config.Config   `msgpack:"-"`
 
 	Stdout io.Writer `msgpack:"-"`
@@ -53,6 +54,7 @@ func NewAppContext() *AppContext {
 		Stdout:  os.Stdout,
 		Stderr:  os.Stderr,
 		context: context.Background(),
+		pause:   newPauseGate(nil),
 	}
 }
 
@@ -63,6 +65,7 @@ func NewAppContextFrom(template *AppContext) *AppContext {
 	ctx.SetCache(template.GetCache())
 	ctx.SetLogger(template.GetLogger())
 	ctx.events = events
+	ctx.pause = newPauseGate(template.pause)
 	return ctx
 }
 
@@ -1,7 +1,9 @@
 package appcontext
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/caching"
 	"github.com/PlakarKorp/plakar/encryption/keypair"
@@ -203,3 +205,59 @@ func TestAppContextCloseEvents(t *testing.T) {
 		// events is closed
 	}
 }
+
+func TestPauseResume(t *testing.T) {
+	ctx := NewAppContext()
+	require.False(t, ctx.IsPaused())
+	require.NoError(t, ctx.WaitIfPaused())
+
+	notify, stop := ctx.PauseNotify()
+	defer stop()
+
+	ctx.Pause()
+	require.True(t, ctx.IsPaused())
+	require.True(t, <-notify)
+
+	done := make(chan error)
+	go func() {
+		done <- ctx.WaitIfPaused()
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("WaitIfPaused returned while paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	ctx.Resume()
+	require.NoError(t, <-done)
+	require.False(t, ctx.IsPaused())
+	require.False(t, <-notify)
+}
+
+func TestPauseInherited(t *testing.T) {
+	parent := NewAppContext()
+	child := NewAppContextFrom(parent)
+
+	parent.Pause()
+	require.True(t, child.IsPaused())
+
+	child.Resume()
+	require.True(t, child.IsPaused())
+
+	parent.Resume()
+	require.False(t, child.IsPaused())
+
+	child.Pause()
+	require.False(t, parent.IsPaused())
+}
+
+func TestPauseCancelled(t *testing.T) {
+	ctx := NewAppContext()
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx.SetContext(cancelCtx)
+
+	ctx.Pause()
+	cancel()
+	require.ErrorIs(t, ctx.WaitIfPaused(), context.Canceled)
+}
@@ -0,0 +1,132 @@
+package appcontext
+
+import (
+	"sync"
+)
+
+// pauseGate lets long-running operations be held and released from the
+// outside.  Gates are chained so that pausing a context also holds the
+// contexts derived from it.
+type pauseGate struct {
+	mu       sync.Mutex
+	parent   *pauseGate
+	paused   bool
+	resumed  chan struct{}
+	watchers map[chan bool]struct{}
+}
+
+func newPauseGate(parent *pauseGate) *pauseGate {
+	return &pauseGate{
+		parent:   parent,
+		watchers: make(map[chan bool]struct{}),
+	}
+}
+
+func (g *pauseGate) set(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused == paused {
+		return
+	}
+	g.paused = paused
+	if paused {
+		g.resumed = make(chan struct{})
+	} else {
+		close(g.resumed)
+	}
+
+	// watchers only care about the latest state, drop any stale one
+	for ch := range g.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- paused
+	}
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks until the gate is resumed or done is closed.  It returns
+// whether it had to wait, and whether done was closed meanwhile.
+func (g *pauseGate) wait(done <-chan struct{}) (bool, bool) {
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return false, false
+	}
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return true, false
+	case <-done:
+		return true, true
+	}
+}
+
+// Pause asks the operations running under this context, and the contexts
+// derived from it, to hold until Resume is called.
+func (c *AppContext) Pause() {
+	c.pause.set(true)
+}
+
+// Resume releases the operations held by Pause.
+func (c *AppContext) Resume() {
+	c.pause.set(false)
+}
+
+// IsPaused returns true if this context, or one it derives from, is paused.
+func (c *AppContext) IsPaused() bool {
+	for g := c.pause; g != nil; g = g.parent {
+		if g.isPaused() {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitIfPaused blocks while the context is paused.  It returns the context
+// error if the context is cancelled while waiting.
+func (c *AppContext) WaitIfPaused() error {
+	done := c.GetContext().Done()
+	for {
+		waited := false
+		for g := c.pause; g != nil; g = g.parent {
+			w, cancelled := g.wait(done)
+			if cancelled {
+				return c.GetContext().Err()
+			}
+			waited = waited || w
+		}
+		if !waited {
+			return nil
+		}
+	}
+}
+
+// PauseNotify returns a channel receiving the pause state of this context
+// every time it changes, and a function to stop the notifications.
+func (c *AppContext) PauseNotify() (<-chan bool, func()) {
+	ch := make(chan bool, 1)
+
+	c.pause.mu.Lock()
+	c.pause.watchers[ch] = struct{}{}
+	c.pause.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.pause.mu.Lock()
+			delete(c.pause.watchers, ch)
+			c.pause.mu.Unlock()
+			close(ch)
+		})
+	}
+}
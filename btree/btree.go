@@ -116,6 +116,29 @@ func (n *Node[K, P, V]) isleaf() bool {
 	return len(n.Pointers) == 0
 }
 
+// IsLeaf returns true if the node holds values rather than pointers.
+func (n *Node[K, P, V]) IsLeaf() bool {
+	return n.isleaf()
+}
+
+// Child returns the pointer to the child of an intermediate node where key
+// is to be found.
+func (n *Node[K, P, V]) Child(key K, cmp func(K, K) int) P {
+	idx, found := slices.BinarySearchFunc(n.Keys, key, cmp)
+	if found {
+		idx++
+	}
+	if idx < len(n.Keys) {
+		return n.Pointers[idx]
+	}
+	return n.Pointers[len(n.Keys)]
+}
+
+// Lookup returns the value associated with key in a leaf node.
+func (n *Node[K, P, V]) Lookup(key K, cmp func(K, K) int) (V, bool) {
+	return n.find(key, cmp)
+}
+
 func (b *BTree[K, P, V]) findleaf(key K) (node *Node[K, P, V], path []P, err error) {
 	ptr := b.Root
 
@@ -130,15 +153,7 @@ func (b *BTree[K, P, V]) findleaf(key K) (node *Node[K, P, V], path []P, err err
 			return
 		}
 
-		idx, found := slices.BinarySearchFunc(node.Keys, key, b.compare)
-		if found {
-			idx++
-		}
-		if idx < len(node.Keys) {
-			ptr = node.Pointers[idx]
-		} else {
-			ptr = node.Pointers[len(node.Keys)]
-		}
+		ptr = node.Child(key, b.compare)
 	}
 }
 
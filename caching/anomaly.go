@@ -0,0 +1,78 @@
+package caching
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// AnomalyCache keeps what the agent learnt about the backups of each
+// source, their baseline and whether their retention was paused, so that
+// a restart neither forgets an anomaly nor rebuilds the baselines.
+type AnomalyCache struct {
+	manager *Manager
+	db      *leveldb.DB
+}
+
+func newAnomalyCache(cacheManager *Manager) (*AnomalyCache, error) {
+	cacheDir := filepath.Join(cacheManager.cacheDir, "anomaly")
+
+	db, err := leveldb.OpenFile(cacheDir, nil)
+	if err != nil {
+		if errors.Is(err, syscall.EAGAIN) {
+			return nil, ErrInUse
+		}
+		return nil, err
+	}
+
+	return &AnomalyCache{
+		manager: cacheManager,
+		db:      db,
+	}, nil
+}
+
+func (c *AnomalyCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *AnomalyCache) put(prefix, source string, data []byte) error {
+	return c.db.Put([]byte(fmt.Sprintf("%s:%s", prefix, source)), data, nil)
+}
+
+func (c *AnomalyCache) get(prefix, source string) ([]byte, error) {
+	data, err := c.db.Get([]byte(fmt.Sprintf("%s:%s", prefix, source)), nil)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *AnomalyCache) has(prefix, source string) (bool, error) {
+	return c.db.Has([]byte(fmt.Sprintf("%s:%s", prefix, source)), nil)
+}
+
+func (c *AnomalyCache) PutBaseline(source string, data []byte) error {
+	return c.put("__baseline__", source, data)
+}
+
+func (c *AnomalyCache) GetBaseline(source string) ([]byte, error) {
+	return c.get("__baseline__", source)
+}
+
+func (c *AnomalyCache) PutPaused(source string) error {
+	return c.put("__paused__", source, nil)
+}
+
+func (c *AnomalyCache) HasPaused(source string) (bool, error) {
+	return c.has("__paused__", source)
+}
+
+func (c *AnomalyCache) DelPaused(source string) error {
+	return c.db.Delete([]byte(fmt.Sprintf("%s:%s", "__paused__", source)), nil)
+}
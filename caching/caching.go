@@ -22,6 +22,12 @@ type Manager struct {
 
 	maintenanceCache      map[uuid.UUID]*MaintenanceCache
 	maintenanceCacheMutex sync.Mutex
+
+	nodeCache      map[uuid.UUID]*NodeCache
+	nodeCacheMutex sync.Mutex
+
+	anomalyCache      *AnomalyCache
+	anomalyCacheMutex sync.Mutex
 }
 
 func NewManager(cacheDir string) *Manager {
@@ -31,6 +37,7 @@ func NewManager(cacheDir string) *Manager {
 		repositoryCache:  make(map[uuid.UUID]*_RepositoryCache),
 		vfsCache:         make(map[string]*_VFSCache),
 		maintenanceCache: make(map[uuid.UUID]*MaintenanceCache),
+		nodeCache:        make(map[uuid.UUID]*NodeCache),
 	}
 }
 
@@ -46,6 +53,20 @@ func (m *Manager) Close() error {
 		cache.Close()
 	}
 
+	m.nodeCacheMutex.Lock()
+	defer m.nodeCacheMutex.Unlock()
+
+	for _, cache := range m.nodeCache {
+		cache.Close()
+	}
+
+	m.anomalyCacheMutex.Lock()
+	defer m.anomalyCacheMutex.Unlock()
+
+	if m.anomalyCache != nil {
+		m.anomalyCache.Close()
+	}
+
 	// we may rework the interface later to allow for error handling
 	// at this point closing is best effort
 	return nil
@@ -101,7 +122,44 @@ func (m *Manager) Maintenance(repositoryID uuid.UUID) (*MaintenanceCache, error)
 	}
 }
 
+func (m *Manager) Nodes(repositoryID uuid.UUID) (*NodeCache, error) {
+	m.nodeCacheMutex.Lock()
+	defer m.nodeCacheMutex.Unlock()
+
+	if cache, ok := m.nodeCache[repositoryID]; ok {
+		return cache, nil
+	}
+
+	if cache, err := newNodeCache(m, repositoryID); err != nil {
+		return nil, err
+	} else {
+		m.nodeCache[repositoryID] = cache
+		return cache, nil
+	}
+}
+
+func (m *Manager) Anomaly() (*AnomalyCache, error) {
+	m.anomalyCacheMutex.Lock()
+	defer m.anomalyCacheMutex.Unlock()
+
+	if m.anomalyCache != nil {
+		return m.anomalyCache, nil
+	}
+
+	if cache, err := newAnomalyCache(m); err != nil {
+		return nil, err
+	} else {
+		m.anomalyCache = cache
+		return cache, nil
+	}
+}
+
 // XXX - beware that caller has responsibility to call Close() on the returned cache
 func (m *Manager) Scan(snapshotID objects.MAC) (*ScanCache, error) {
 	return newScanCache(m, snapshotID)
 }
+
+// XXX - beware that caller has responsibility to call Close() on the returned cache
+func (m *Manager) Sync(srcRepositoryID, dstRepositoryID uuid.UUID) (*SyncCache, error) {
+	return newSyncCache(m, srcRepositoryID, dstRepositoryID)
+}
@@ -88,6 +88,26 @@ func (c *MaintenanceCache) HasPackfile(packfileMAC objects.MAC) bool {
 	return false
 }
 
+// GetSnapshots returns the snapshots referencing a packfile.
+func (c *MaintenanceCache) GetSnapshots(packfileMAC objects.MAC) iter.Seq[objects.MAC] {
+	return func(yield func(objects.MAC) bool) {
+		keyPrefix := fmt.Sprintf("__packfile__:%x:", packfileMAC)
+		iter := c.db.NewIterator(util.BytesPrefix([]byte(keyPrefix)), nil)
+		defer iter.Release()
+
+		for iter.Next() {
+			mac, err := hex.DecodeString(string(iter.Key()[len(keyPrefix):]))
+			if err != nil || len(mac) != len(objects.MAC{}) {
+				continue
+			}
+
+			if !yield(objects.MAC(mac)) {
+				return
+			}
+		}
+	}
+}
+
 func (c *MaintenanceCache) GetPackfiles(snapshotID objects.MAC) iter.Seq[objects.MAC] {
 	return func(yield func(objects.MAC) bool) {
 		iter := c.db.NewIterator(nil, nil)
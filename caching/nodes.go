@@ -0,0 +1,57 @@
+package caching
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/google/uuid"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// NodeCache keeps the VFS blobs read from a repository, btree nodes and
+// entries, so that browsing its snapshots again does not fetch them.  They
+// are immutable and keyed by MAC, shared by all snapshots of a repository.
+type NodeCache struct {
+	manager *Manager
+	db      *leveldb.DB
+}
+
+func newNodeCache(cacheManager *Manager, repositoryID uuid.UUID) (*NodeCache, error) {
+	cacheDir := filepath.Join(cacheManager.cacheDir, "nodes", repositoryID.String())
+
+	db, err := leveldb.OpenFile(cacheDir, nil)
+	if err != nil {
+		if errors.Is(err, syscall.EAGAIN) {
+			return nil, ErrInUse
+		}
+		return nil, err
+	}
+
+	return &NodeCache{
+		manager: cacheManager,
+		db:      db,
+	}, nil
+}
+
+func (c *NodeCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *NodeCache) PutBlob(Type resources.Type, mac objects.MAC, data []byte) error {
+	return c.db.Put([]byte(fmt.Sprintf("%s:%x", Type, mac)), data, nil)
+}
+
+func (c *NodeCache) GetBlob(Type resources.Type, mac objects.MAC) ([]byte, error) {
+	data, err := c.db.Get([]byte(fmt.Sprintf("%s:%x", Type, mac)), nil)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
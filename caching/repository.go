@@ -123,7 +123,8 @@ func (c *_RepositoryCache) GetStates() (map[objects.MAC][]byte, error) {
 			fmt.Printf("Error decoding state ID: %v\n", err)
 			return nil, err
 		}
-		ret[stateID] = iter.Value()
+		// the iterator reuses its buffers
+		ret[stateID] = bytes.Clone(iter.Value())
 	}
 
 	return ret, nil
@@ -209,10 +210,35 @@ func (c *_RepositoryCache) GetPackfiles() iter.Seq2[objects.MAC, []byte] {
 	return c.getObjects("__packfile__:")
 }
 
+func (c *_RepositoryCache) PutPackfileIndex(packfile objects.MAC, data []byte) error {
+	return c.put("__packfile_index__", fmt.Sprintf("%x", packfile), data)
+}
+
+func (c *_RepositoryCache) GetPackfileIndex(packfile objects.MAC) ([]byte, error) {
+	return c.get("__packfile_index__", fmt.Sprintf("%x", packfile))
+}
+
+func (c *_RepositoryCache) DelPackfileIndex(packfile objects.MAC) error {
+	return c.delete("__packfile_index__", fmt.Sprintf("%x", packfile))
+}
+
 func (c *_RepositoryCache) PutConfiguration(key string, data []byte) error {
 	return c.put("__configuration__", key, data)
 }
 
+func (c *_RepositoryCache) PutSketch(feature uint64, chunkMAC objects.MAC) error {
+	return c.put("__sketch__", fmt.Sprintf("%016x", feature), chunkMAC[:])
+}
+
+// GetSketch returns a chunk whose sketch holds the given super-feature.
+func (c *_RepositoryCache) GetSketch(feature uint64) (objects.MAC, bool, error) {
+	data, err := c.get("__sketch__", fmt.Sprintf("%016x", feature))
+	if err != nil || len(data) != len(objects.MAC{}) {
+		return objects.MAC{}, false, err
+	}
+	return objects.MAC(data), true, nil
+}
+
 func (c *_RepositoryCache) GetConfiguration(key string) ([]byte, error) {
 	return c.get("__configuration__", key)
 }
@@ -0,0 +1,107 @@
+package caching
+
+import (
+	"encoding/hex"
+	"fmt"
+	"iter"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/google/uuid"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// SyncCache journals the progress of a synchronization between two
+// repositories so that an interrupted transfer can resume without
+// re-sending packfiles or re-reading the chunks of objects that already
+// made it to the destination.
+type SyncCache struct {
+	manager *Manager
+	db      *leveldb.DB
+}
+
+func newSyncCache(cacheManager *Manager, srcRepositoryID, dstRepositoryID uuid.UUID) (*SyncCache, error) {
+	cacheDir := filepath.Join(cacheManager.cacheDir, "sync", fmt.Sprintf("%s-%s", srcRepositoryID, dstRepositoryID))
+
+	db, err := leveldb.OpenFile(cacheDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyncCache{
+		manager: cacheManager,
+		db:      db,
+	}, nil
+}
+
+func (c *SyncCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *SyncCache) put(prefix string, snapshotID objects.MAC, key objects.MAC, data []byte) error {
+	return c.db.Put([]byte(fmt.Sprintf("%s:%x:%x", prefix, snapshotID, key)), data, nil)
+}
+
+func (c *SyncCache) get(prefix string, snapshotID objects.MAC, key objects.MAC) ([]byte, error) {
+	data, err := c.db.Get([]byte(fmt.Sprintf("%s:%x:%x", prefix, snapshotID, key)), nil)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *SyncCache) PutPackfile(snapshotID, packfileMAC objects.MAC, data []byte) error {
+	return c.put("__packfile__", snapshotID, packfileMAC, data)
+}
+
+func (c *SyncCache) GetPackfiles(snapshotID objects.MAC) iter.Seq2[objects.MAC, []byte] {
+	return func(yield func(objects.MAC, []byte) bool) {
+		keyPrefix := fmt.Sprintf("__packfile__:%x:", snapshotID)
+		iter := c.db.NewIterator(util.BytesPrefix([]byte(keyPrefix)), nil)
+		defer iter.Release()
+
+		for iter.Next() {
+			hex_mac, err := hex.DecodeString(string(iter.Key()[len(keyPrefix):]))
+			if err != nil || len(hex_mac) != len(objects.MAC{}) {
+				continue
+			}
+			mac := objects.MAC(hex_mac)
+
+			data := make([]byte, len(iter.Value()))
+			copy(data, iter.Value())
+			if !yield(mac, data) {
+				return
+			}
+		}
+	}
+}
+
+func (c *SyncCache) PutObject(snapshotID, srcObjectMAC objects.MAC, data []byte) error {
+	return c.put("__object__", snapshotID, srcObjectMAC, data)
+}
+
+func (c *SyncCache) GetObject(snapshotID, srcObjectMAC objects.MAC) ([]byte, error) {
+	return c.get("__object__", snapshotID, srcObjectMAC)
+}
+
+// DeleteSnapshot discards everything journaled for a snapshot, it is
+// meant to be called once the snapshot has been committed.
+func (c *SyncCache) DeleteSnapshot(snapshotID objects.MAC) error {
+	batch := new(leveldb.Batch)
+	for _, prefix := range []string{"__packfile__", "__object__"} {
+		keyPrefix := fmt.Sprintf("%s:%x:", prefix, snapshotID)
+		iter := c.db.NewIterator(util.BytesPrefix([]byte(keyPrefix)), nil)
+		for iter.Next() {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	return c.db.Write(batch, nil)
+}
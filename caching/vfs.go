@@ -3,8 +3,10 @@ package caching
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type _VFSCache struct {
@@ -45,6 +47,36 @@ func (c *_VFSCache) get(prefix, pathname string) ([]byte, error) {
 	return data, nil
 }
 
+// ResetPath discards the entries cached for pathname and everything below.
+func (c *_VFSCache) ResetPath(pathname string) error {
+	below := strings.TrimSuffix(pathname, "/") + "/"
+
+	batch := new(leveldb.Batch)
+	for _, prefix := range []string{"__directory__", "__filename__", "__file_summary__"} {
+		iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix+":"+pathname)), nil)
+		for iter.Next() {
+			key := string(iter.Key())
+			if key == prefix+":"+pathname || strings.HasPrefix(key, prefix+":"+below) {
+				batch.Delete([]byte(key))
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	return c.db.Write(batch, nil)
+}
+
+func (c *_VFSCache) PutVolume(pathname string, volume string) error {
+	return c.put("__volume__", pathname, []byte(volume))
+}
+
+func (c *_VFSCache) GetVolume(pathname string) (string, error) {
+	data, err := c.get("__volume__", pathname)
+	return string(data), err
+}
+
 func (c *_VFSCache) PutDirectory(pathname string, data []byte) error {
 	return c.put("__directory__", pathname, data)
 }
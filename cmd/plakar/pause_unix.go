@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+)
+
+// handlePauseSignals pauses the operations running under ctx on SIGTSTP
+// and resumes them on SIGCONT.
+func handlePauseSignals(ctx *appcontext.AppContext) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTSTP, syscall.SIGCONT)
+	go func() {
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGTSTP:
+				ctx.GetLogger().Info("pausing, send SIGCONT to resume (kill -CONT %d)", os.Getpid())
+				ctx.Pause()
+			case syscall.SIGCONT:
+				if ctx.IsPaused() {
+					ctx.GetLogger().Info("resuming")
+					ctx.Resume()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"github.com/PlakarKorp/plakar/appcontext"
+)
+
+func handlePauseSignals(ctx *appcontext.AppContext) {
+}
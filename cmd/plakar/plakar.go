@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"os/user"
@@ -17,13 +18,15 @@ import (
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/caching"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/config"
 	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/identity"
 	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/privsep"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/storage"
-	"github.com/PlakarKorp/plakar/versioning"
 	"github.com/denisbrodbeck/machineid"
 	"github.com/google/uuid"
 
@@ -31,15 +34,26 @@ import (
 	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
 	_ "github.com/PlakarKorp/plakar/storage/backends/http"
 	_ "github.com/PlakarKorp/plakar/storage/backends/null"
+	_ "github.com/PlakarKorp/plakar/storage/backends/rclone"
 	_ "github.com/PlakarKorp/plakar/storage/backends/s3"
 	_ "github.com/PlakarKorp/plakar/storage/backends/sftp"
 
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/dav"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/foreign"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/ftp"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/http"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/kv"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/ldap"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/mongodb"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/postgres"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/redis"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/s3"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/sftp"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/stdin"
 
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/ftp"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/s3"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/sftp"
 
@@ -106,6 +120,7 @@ func entryPoint() int {
 	var opt_quiet bool
 	var opt_keyfile string
 	var opt_agentless bool
+	var opt_privsep string
 
 	flag.StringVar(&opt_configfile, "config", opt_configDefault, "configuration file")
 	flag.IntVar(&opt_cpuCount, "cpu", opt_cpuDefault, "limit the number of usable cores")
@@ -118,6 +133,7 @@ func entryPoint() int {
 	flag.BoolVar(&opt_quiet, "quiet", false, "no output except errors")
 	flag.StringVar(&opt_keyfile, "keyfile", "", "use passphrase from key file when prompted")
 	flag.BoolVar(&opt_agentless, "no-agent", false, "run without agent")
+	flag.StringVar(&opt_privsep, "privsep", "", "run as user, with filesystem reads performed by a privileged helper")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [OPTIONS] [at REPOSITORY] COMMAND [COMMAND_OPTIONS]...\n", flag.CommandLine.Name())
@@ -229,6 +245,17 @@ func entryPoint() int {
 	ctx.ProcessID = os.Getpid()
 	ctx.MaxConcurrency = ctx.NumCPU*8 + 1
 
+	// snapshots are signed once the identity enrolled with a server
+	if id, err := identity.Load(configDir); err == nil {
+		if id.Enrolled() {
+			ctx.Identity = id.Identifier
+			ctx.Keypair = id.KeyPair
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "%s: could not load identity: %s\n", flag.CommandLine.Name(), err)
+		return 1
+	}
+
 	if flag.NArg() == 0 {
 		fmt.Fprintf(os.Stderr, "%s: a subcommand must be provided\n", filepath.Base(flag.CommandLine.Name()))
 		for _, k := range subcommands.List() {
@@ -274,11 +301,32 @@ func entryPoint() int {
 		}
 	}
 
+	// the privileged process only serves filesystem reads to the same
+	// command run unprivileged, which sees the helper socket in its env.
+	// The importer is set up from the command line seen by the privileged
+	// process, never from what the unprivileged one asks for.
+	if opt_privsep != "" && !privsep.IsWorker() {
+		if command != "backup" {
+			fmt.Fprintf(os.Stderr, "%s: privilege separation is only supported for backups\n", flag.CommandLine.Name())
+			return 1
+		}
+		importerConfig, err := backup.ImporterConfig(ctx, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		status, err := privsep.Monitor(opt_privsep, importerConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+		}
+		return status
+	}
+
 	storeConfig := map[string]string{"location": repositoryPath}
 	if strings.HasPrefix(repositoryPath, "@") {
-		remote, ok := ctx.Config.GetRepository(repositoryPath[1:])
-		if !ok {
-			fmt.Fprintf(os.Stderr, "%s: could not resolve repository: %s\n", flag.CommandLine.Name(), repositoryPath)
+		remote, err := ctx.Config.GetRepository(repositoryPath[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: could not resolve repository: %s: %s\n", flag.CommandLine.Name(), repositoryPath, err)
 			return 1
 		}
 		if _, ok := remote["location"]; !ok {
@@ -312,12 +360,20 @@ func entryPoint() int {
 	}
 
 	// these commands need to be ran before the repository is opened
-	if command == "agent" || command == "config" || command == "version" || command == "help" {
+	if command == "agent" || command == "config" || command == "version" || command == "help" || command == "jobs" || command == "schedule" || command == "enroll" ||
+		(command == "attest" && len(args) > 0 && args[0] == "verify") ||
+		(command == "export-evidence" && len(args) > 0 && args[0] == "verify") {
 		cmd, err := subcommands.Parse(ctx, nil, command, args)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
 			return 1
 		}
+		release, err := applyLimits(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		defer release()
 		retval, err := cmd.Execute(ctx, nil)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
@@ -345,9 +401,9 @@ func entryPoint() int {
 		return 1
 	}
 
-	if repoConfig.Version != versioning.FromString(storage.VERSION) {
-		fmt.Fprintf(os.Stderr, "%s: incompatible repository version: %s != %s\n",
-			flag.CommandLine.Name(), repoConfig.Version, storage.VERSION)
+	if err := storage.CheckVersion(repoConfig.Version); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s, this release supports up to %s\n",
+			flag.CommandLine.Name(), err, storage.VERSION)
 		return 1
 	}
 
@@ -432,6 +488,18 @@ func entryPoint() int {
 		return 1
 	}
 
+	if command == "backup" {
+		handlePauseSignals(ctx)
+		utils.HandleShutdownSignals(ctx, nil)
+	}
+
+	release, err := applyLimits(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+		return 1
+	}
+	defer release()
+
 	var status int
 	if opt_agentless {
 		status, err = cmd.Execute(ctx, repo)
@@ -502,3 +570,23 @@ func entryPoint() int {
 
 	return status
 }
+
+// applyLimits applies the resource limits requested for a subcommand to the
+// process, returning the release to defer so that they are undone, and the
+// cgroup created for them removed, before exiting.
+func applyLimits(cmd subcommands.Subcommand) (func(), error) {
+	limited, ok := cmd.(subcommands.Limited)
+	if !ok {
+		return func() {}, nil
+	}
+
+	cleanup, err := limited.ApplyLimits()
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := cleanup(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: could not release resource limits: %s\n", flag.CommandLine.Name(), err)
+		}
+	}, nil
+}
@@ -3,26 +3,44 @@ package main
 import (
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/agent"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/archive"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/attest"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cat"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/check"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clients"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clone"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/config"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/convert"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/create"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diag"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diff"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/digest"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/du"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/enroll"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/evidence"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exec"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/grant"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/header"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/help"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/info"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/jobs"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/locate"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ls"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/maintenance"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/materialize"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/merge"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/mount"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/passwd"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/report"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restore"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/rm"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/schedule"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/search"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/serve"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/server"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/state"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/sync"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ui"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/version"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/watch"
 )
@@ -25,34 +25,54 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/PlakarKorp/plakar/agent"
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/archive"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/attest"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cat"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/check"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clients"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clone"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diag"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diff"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/digest"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/du"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/evidence"
 	cmd_exec "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exec"
+	cmd_grant "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/grant"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/header"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/info"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/jobs"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/locate"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ls"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/maintenance"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/materialize"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/merge"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/mount"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/passwd"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/report"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restore"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/rm"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/schedule"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/search"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/serve"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/server"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/state"
 	cmd_sync "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/sync"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ui"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/watch"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/identity"
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/scheduler"
@@ -93,9 +113,14 @@ func daemonize(argv []string) error {
 func parse_cmd_agent(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
 	var opt_foreground bool
 	var opt_stop bool
+	var opt_pause bool
+	var opt_resume bool
 	//var opt_prometheus string
 	var opt_tasks string
 	var opt_logfile string
+	var opt_limits utils.Limits
+	var opt_profile string
+	var opt_profileInterval time.Duration
 
 	flags := flag.NewFlagSet("agent", flag.ExitOnError)
 	flags.Usage = func() {
@@ -109,8 +134,35 @@ func parse_cmd_agent(ctx *appcontext.AppContext, repo *repository.Repository, ar
 	flags.BoolVar(&opt_foreground, "foreground", false, "run in foreground")
 	flags.StringVar(&opt_logfile, "log", "", "log file")
 	flags.BoolVar(&opt_stop, "stop", false, "stop the agent")
+	flags.BoolVar(&opt_pause, "pause", false, "pause the backups running in the agent")
+	flags.BoolVar(&opt_resume, "resume", false, "resume the backups paused in the agent")
+	flags.StringVar(&opt_profile, "profile", "", "URL of the server to follow the profile of, once enrolled")
+	flags.DurationVar(&opt_profileInterval, "profile-interval", 5*time.Minute, "interval between profile updates")
+	opt_limits.InstallFlags(flags)
 	flags.Parse(args)
 
+	if err := opt_limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opt_pause && opt_resume {
+		return nil, fmt.Errorf("-pause and -resume are mutually exclusive")
+	}
+
+	if opt_pause || opt_resume {
+		client, err := agent.NewClient(filepath.Join(ctx.CacheDir, "agent.sock"))
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		retval, err := client.SendCommand(ctx, &AgentPause{Resume: opt_resume}, nil)
+		if err != nil {
+			return nil, err
+		}
+		os.Exit(retval)
+	}
+
 	if opt_stop {
 		client, err := agent.NewClient(filepath.Join(ctx.CacheDir, "agent.sock"))
 		if err != nil {
@@ -125,6 +177,36 @@ func parse_cmd_agent(ctx *appcontext.AppContext, repo *repository.Repository, ar
 		os.Exit(retval)
 	}
 
+	var profile *scheduler.ProfileOptions
+	if opt_profile != "" {
+		u, err := url.Parse(opt_profile)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid server URL: %s", opt_profile)
+		}
+		if opt_profileInterval <= 0 {
+			return nil, fmt.Errorf("-profile-interval must be positive")
+		}
+
+		configDir, err := utils.GetConfigDir("plakar")
+		if err != nil {
+			return nil, err
+		}
+		id, err := identity.Load(configDir)
+		if err != nil {
+			return nil, fmt.Errorf("could not load identity, see plakar enroll: %w", err)
+		}
+		if !id.Enrolled() {
+			return nil, fmt.Errorf("identity %s is not enrolled, see plakar enroll", id.Identifier)
+		}
+
+		profile = &scheduler.ProfileOptions{
+			URL:       opt_profile,
+			Interval:  opt_profileInterval,
+			Identity:  id,
+			CacheFile: filepath.Join(ctx.CacheDir, "profile.json"),
+		}
+	}
+
 	var schedConfig *scheduler.Configuration
 	if opt_tasks != "" {
 		tmp, err := scheduler.ParseConfigFile(opt_tasks)
@@ -151,6 +233,8 @@ func parse_cmd_agent(ctx *appcontext.AppContext, repo *repository.Repository, ar
 		//prometheus:  opt_prometheus,
 		socketPath:  filepath.Join(ctx.CacheDir, "agent.sock"),
 		schedConfig: schedConfig,
+		limits:      opt_limits,
+		profile:     profile,
 	}, nil
 }
 
@@ -163,6 +247,25 @@ func (cmd *AgentStop) Execute(ctx *appcontext.AppContext, repo *repository.Repos
 	return 1, nil
 }
 
+// AgentPause holds, or releases, the backups run by the agent, be they
+// scheduled or requested by clients.
+type AgentPause struct {
+	Resume bool
+}
+
+func (cmd *AgentPause) Name() string {
+	return "agent-pause"
+}
+
+func (cmd *AgentPause) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if cmd.Resume {
+		ctx.GetLogger().Info("agent resumed")
+	} else {
+		ctx.GetLogger().Info("agent paused")
+	}
+	return 0, nil
+}
+
 type Agent struct {
 	prometheus string
 	socketPath string
@@ -170,6 +273,9 @@ type Agent struct {
 	listener net.Listener
 
 	schedConfig *scheduler.Configuration
+	scheduler   *scheduler.Scheduler
+	limits      utils.Limits
+	profile     *scheduler.ProfileOptions
 }
 
 func (cmd *Agent) checkSocket() bool {
@@ -199,16 +305,39 @@ func isDisconnectError(err error) bool {
 	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
+func (cmd *Agent) IsLimited() bool {
+	return cmd.limits.IsSet()
+}
+
+// ApplyLimits applies the limits to the agent and thus to every command it
+// runs, including scheduled backups.
+func (cmd *Agent) ApplyLimits() (func() error, error) {
+	return cmd.limits.Apply()
+}
+
 func (cmd *Agent) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
-	if cmd.schedConfig != nil {
-		go func() {
-			scheduler.NewScheduler(ctx, cmd.schedConfig).Run()
-		}()
+	// the scheduler runs even without a tasks file, for the schedules
+	// of the configuration.
+	schedConfig := cmd.schedConfig
+	if schedConfig == nil {
+		schedConfig = scheduler.DefaultConfiguration()
 	}
+	// the first SIGINT or SIGTERM stops accepting commands and cancels
+	// the ones running, as well as scheduled jobs, which then stop cleanly
+	utils.HandleShutdownSignals(ctx, func() { cmd.Close() })
+
+	cmd.scheduler = scheduler.NewScheduler(ctx, schedConfig)
+	if cmd.profile != nil {
+		if err := cmd.scheduler.FollowProfile(*cmd.profile); err != nil {
+			return 1, err
+		}
+	}
+	go cmd.scheduler.Run()
 
 	if err := cmd.ListenAndServe(ctx); err != nil {
 		return 1, err
 	}
+	cmd.scheduler.Wait()
 	log.Println("Server gracefully stopped")
 	return 0, nil
 }
@@ -254,10 +383,13 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 
 	var wg sync.WaitGroup
 
+	sched := cmd.scheduler
 	for {
 		conn, err := cmd.listener.Accept()
 		if err != nil {
 			if opErr, ok := err.(*net.OpError); ok && opErr.Err.Error() == "use of closed network connection" {
+				// let the commands running stop cleanly
+				wg.Wait()
 				return nil
 			}
 			return fmt.Errorf("failed to accept connection: %w", err)
@@ -275,8 +407,9 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 			encoder := msgpack.NewEncoder(_conn)
 			decoder := msgpack.NewDecoder(_conn)
 
-			// Create a context tied to the connection
-			cancelCtx, cancel := context.WithCancel(context.Background())
+			// Create a context tied to the connection, and to the agent
+			// which cancels it when shutting down
+			cancelCtx, cancel := context.WithCancel(ctx.GetContext())
 			defer cancel()
 
 			clientContext := appcontext.NewAppContextFrom(ctx)
@@ -341,10 +474,23 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				return
 			}
 
-			// Attempt another decode to detect client disconnection during processing
+			// Keep decoding to detect client disconnection during processing,
+			// and to receive the control packets sent by the client.
 			go func() {
-				var tmp interface{}
-				read(&tmp)
+				for {
+					var packet agent.Packet
+					if _, err := read(&packet); err != nil {
+						return
+					}
+					switch packet.Type {
+					case "pause":
+						clientContext.Pause()
+					case "resume":
+						clientContext.Resume()
+					case "cancel":
+						cancel()
+					}
+				}
 			}()
 
 			var subcommand subcommands.RPC
@@ -361,6 +507,54 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &AgentStop{}
 				os.Exit(0)
+			case (&AgentPause{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand AgentPause
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				if cmd.Subcommand.Resume {
+					ctx.Resume()
+				} else {
+					ctx.Pause()
+				}
+				subcommand = &cmd.Subcommand
+			case (&jobs.Jobs{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand jobs.Jobs
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				cmd.Subcommand.Scheduler = sched
+				subcommand = &cmd.Subcommand
+			case (&schedule.ScheduleList{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand schedule.ScheduleList
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				cmd.Subcommand.Scheduler = sched
+				subcommand = &cmd.Subcommand
+			case (&schedule.ScheduleResumeRetention{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand schedule.ScheduleResumeRetention
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				cmd.Subcommand.Scheduler = sched
+				subcommand = &cmd.Subcommand
 			case (&cat.Cat{}).Name():
 				var cmd struct {
 					Name       string
@@ -397,6 +591,30 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&cmd_grant.Grant{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand cmd_grant.Grant
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&header.HeaderImport{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand header.HeaderImport
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&info.InfoRepository{}).Name():
 				var cmd struct {
 					Name       string
@@ -433,6 +651,18 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&info.InfoEntropy{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand info.InfoEntropy
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&diag.DiagContentType{}).Name():
 				var cmd struct {
 					Name       string
@@ -577,6 +807,30 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&attest.Attest{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand attest.Attest
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&passwd.Passwd{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand passwd.Passwd
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&digest.Digest{}).Name():
 				var cmd struct {
 					Name       string
@@ -589,6 +843,18 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&du.Du{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand du.Du
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&locate.Locate{}).Name():
 				var cmd struct {
 					Name       string
@@ -625,6 +891,54 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&materialize.Materialize{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand materialize.Materialize
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&merge.Merge{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand merge.Merge
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&state.State{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand state.State
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&clients.Clients{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand clients.Clients
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&clone.Clone{}).Name():
 				var cmd struct {
 					Name       string
@@ -673,6 +987,18 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&evidence.ExportEvidence{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand evidence.ExportEvidence
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&mount.Mount{}).Name():
 				var cmd struct {
 					Name       string
@@ -685,6 +1011,66 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.RepositoryLocation
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&search.Search{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand search.Search
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&serve.Serve{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand serve.Serve
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&report.ReportLargest{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand report.ReportLargest
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&report.ReportDuplicates{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand report.ReportDuplicates
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&report.ReportGrowth{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand report.ReportGrowth
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&restore.Restore{}).Name():
 				var cmd struct {
 					Name       string
@@ -721,6 +1107,18 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				subcommand = &cmd.Subcommand
 				repositoryLocation = cmd.Subcommand.SourceRepositoryLocation
 				repositorySecret = cmd.Subcommand.SourceRepositorySecret
+			case (&watch.Watch{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand watch.Watch
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositoryLocation = cmd.Subcommand.RepositoryLocation
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&ui.Ui{}).Name():
 				var cmd struct {
 					Name       string
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package attest
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/google/uuid"
+)
+
+func init() {
+	subcommands.Register("attest", parse_cmd_attest)
+}
+
+func parse_cmd_attest(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	if len(args) > 0 && args[0] == "verify" {
+		return parse_cmd_attest_verify(ctx, args[1:])
+	}
+
+	var opt_output string
+
+	flags := flag.NewFlagSet("attest", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT:PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s verify PROOF [FILE]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opt_output, "output", "", "write the proof to this file instead of stdout")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("invalid parameter. usage: attest [OPTIONS] snapshot:path")
+	}
+
+	if opt_output != "" && !filepath.IsAbs(opt_output) {
+		opt_output = filepath.Join(ctx.CWD, opt_output)
+	}
+
+	return &Attest{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		SnapshotPath:       flags.Arg(0),
+		Output:             opt_output,
+	}, nil
+}
+
+type Attest struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotPath string
+	Output       string
+}
+
+func (cmd *Attest) Name() string {
+	return "attest"
+}
+
+func (cmd *Attest) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath)
+	if err != nil {
+		return 1, fmt.Errorf("attest: could not open snapshot: %s", cmd.SnapshotPath)
+	}
+	defer snap.Close()
+
+	att, err := snap.Attest(pathname)
+	if err != nil {
+		return 1, fmt.Errorf("attest: %s: %w", pathname, err)
+	}
+
+	serialized, err := json.MarshalIndent(att, "", "  ")
+	if err != nil {
+		return 1, err
+	}
+	serialized = append(serialized, '\n')
+
+	if snap.Header.Identity.Identifier == uuid.Nil {
+		ctx.GetLogger().Warn("attest: snapshot %x is not signed", snap.Header.GetIndexShortID())
+	}
+
+	if cmd.Output == "" {
+		if _, err := ctx.Stdout.Write(serialized); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	if err := os.WriteFile(cmd.Output, serialized, 0644); err != nil {
+		return 1, fmt.Errorf("attest: %w", err)
+	}
+	ctx.GetLogger().Info("attest: proof for %x:%s written to %s", snap.Header.GetIndexShortID(), pathname, cmd.Output)
+	return 0, nil
+}
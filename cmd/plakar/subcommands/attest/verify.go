@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package attest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func parse_cmd_attest_verify(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("attest verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s PROOF [FILE]\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		return nil, fmt.Errorf("invalid parameter. usage: attest verify proof [file]")
+	}
+
+	cmd := &AttestVerify{
+		Proof: flags.Arg(0),
+		File:  flags.Arg(1),
+	}
+	if !filepath.IsAbs(cmd.Proof) {
+		cmd.Proof = filepath.Join(ctx.CWD, cmd.Proof)
+	}
+	if cmd.File != "" && !filepath.IsAbs(cmd.File) {
+		cmd.File = filepath.Join(ctx.CWD, cmd.File)
+	}
+	return cmd, nil
+}
+
+// AttestVerify checks a proof offline, it is executed before any repository
+// is opened.
+type AttestVerify struct {
+	Proof string
+	File  string
+}
+
+func (cmd *AttestVerify) Name() string {
+	return "attest_verify"
+}
+
+func (cmd *AttestVerify) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	data, err := os.ReadFile(cmd.Proof)
+	if err != nil {
+		return 1, err
+	}
+
+	var att snapshot.Attestation
+	if err := json.Unmarshal(data, &att); err != nil {
+		return 1, fmt.Errorf("attest: %s: invalid proof: %w", cmd.Proof, err)
+	}
+
+	var secret []byte
+	if att.Repository.Encryption != nil {
+		secret, err = deriveSecret(ctx, att.Repository.Encryption)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	var content io.Reader
+	if cmd.File != "" {
+		fp, err := os.Open(cmd.File)
+		if err != nil {
+			return 1, err
+		}
+		defer fp.Close()
+		content = fp
+	}
+
+	result, err := att.Verify(secret, content)
+	if err != nil {
+		return 1, fmt.Errorf("attest: verification failed: %w", err)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "SnapshotID: %x\n", result.SnapshotID)
+	fmt.Fprintf(ctx.Stdout, "Timestamp: %s\n", result.Timestamp)
+	fmt.Fprintf(ctx.Stdout, "Path: %s\n", result.Path)
+	fmt.Fprintf(ctx.Stdout, "Size: %d\n", result.Size)
+	fmt.Fprintf(ctx.Stdout, "Chunks: %d\n", result.Chunks)
+	fmt.Fprintf(ctx.Stdout, "ContentMAC: %x\n", result.ContentMAC)
+	if result.Signed {
+		fmt.Fprintln(ctx.Stdout, "Identity:")
+		fmt.Fprintf(ctx.Stdout, " - Identifier: %s\n", result.Identity)
+		fmt.Fprintf(ctx.Stdout, " - PublicKey: %s\n", base64.RawStdEncoding.EncodeToString(result.PublicKey))
+	}
+	if result.Receipt != nil {
+		fmt.Fprintln(ctx.Stdout, "Proof of existence:")
+		fmt.Fprintf(ctx.Stdout, " - Time: %s\n", result.Receipt.Time.UTC().Format(time.RFC3339))
+		fmt.Fprintf(ctx.Stdout, " - Authority: %s\n", result.Receipt.Signer.Subject)
+		fmt.Fprintf(ctx.Stdout, " - SerialNumber: %s\n", result.Receipt.SerialNumber)
+		fmt.Fprintf(ctx.Stdout, " - Trusted: %t\n", result.Receipt.Trusted)
+	}
+
+	if !result.Signed {
+		ctx.GetLogger().Warn("attest: snapshot is not signed, the proof only holds for whoever knows the repository key")
+	}
+	if result.ContentChecked {
+		ctx.GetLogger().Info("attest: %s matches %s", cmd.File, result.Path)
+	} else {
+		ctx.GetLogger().Info("attest: proof is valid")
+	}
+	return 0, nil
+}
+
+func deriveSecret(ctx *appcontext.AppContext, config *encryption.Configuration) ([]byte, error) {
+	if ctx.KeyFromFile != "" {
+		key, err := encryption.DeriveKey(config.KDFParams, []byte(ctx.KeyFromFile))
+		if err == nil && encryption.VerifyCanary(config, key) {
+			return key, nil
+		}
+		return nil, fmt.Errorf("could not derive secret")
+	}
+
+	envPassphrase := os.Getenv("PLAKAR_PASSPHRASE")
+	for attempts := 0; attempts < 3; attempts++ {
+		var passphrase []byte
+		if envPassphrase == "" {
+			var err error
+			passphrase, err = utils.GetPassphrase("repository")
+			if err != nil {
+				break
+			}
+		} else {
+			passphrase = []byte(envPassphrase)
+		}
+
+		key, err := encryption.DeriveKey(config.KDFParams, passphrase)
+		if err == nil && encryption.VerifyCanary(config, key) {
+			return key, nil
+		}
+		if envPassphrase != "" {
+			break
+		}
+	}
+	return nil, fmt.Errorf("could not derive secret")
+}
@@ -18,17 +18,24 @@ package backup
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/privsep"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/importer/sysstate"
 	"github.com/dustin/go-humanize"
 	"github.com/gobwas/glob"
 )
@@ -37,77 +44,170 @@ func init() {
 	subcommands.Register("backup", parse_cmd_backup)
 }
 
-type excludeFlags []string
+// ExcludeFlags collects the patterns of a repeatable -exclude flag.
+type ExcludeFlags []string
 
-func (e *excludeFlags) String() string {
+func (e *ExcludeFlags) String() string {
 	return strings.Join(*e, ",")
 }
 
-func (e *excludeFlags) Set(value string) error {
+func (e *ExcludeFlags) Set(value string) error {
 	*e = append(*e, value)
 	return nil
 }
 
+// LoadExcludes returns the -exclude patterns followed by those of the
+// -excludes file, one per line, failing on the first invalid one.
+func LoadExcludes(patterns []string, excludesFile string) ([]string, error) {
+	excludes := []string{}
+	for _, item := range patterns {
+		if _, err := glob.Compile(item); err != nil {
+			return nil, fmt.Errorf("failed to compile exclude pattern: %s", item)
+		}
+		excludes = append(excludes, item)
+	}
+
+	if excludesFile != "" {
+		fp, err := os.Open(excludesFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open excludes file: %w", err)
+		}
+		defer fp.Close()
+
+		scanner := bufio.NewScanner(fp)
+		for scanner.Scan() {
+			line := scanner.Text()
+			_, err := glob.Compile(line)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile exclude pattern: %s", line)
+			}
+			excludes = append(excludes, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return excludes, nil
+}
+
 func parse_cmd_backup(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
 	var opt_tags string
 	var opt_excludes string
-	var opt_exclude excludeFlags
+	var opt_exclude ExcludeFlags
+	var opt_replicate ReplicaFlags
 	var opt_concurrency uint64
 	var opt_quiet bool
 	var opt_silent bool
 	var opt_check bool
+	var opt_estimate bool
+	var opt_suggestexcludes bool
+	var opt_nocache bool
+	var opt_strictcache bool
+	var opt_delta bool
+	var opt_wholefile string
+	var opt_metadataonly bool
+	var opt_mbox bool
+	var opt_textindex bool
+	var opt_maxerrors uint64
+	var opt_timestamp string
+	var opt_namespace string
+	var opt_followsymlinks string
+	var opt_sqlite string
+	var opt_contenttype string
+	var opt_systemstate string
+	var opt_limits utils.Limits
 	// var opt_stdio bool
 
-	excludes := []string{}
-
 	flags := flag.NewFlagSet("backup", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] path\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] s3://path\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] -\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
 		flags.PrintDefaults()
 	}
 
 	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel tasks")
-	flags.StringVar(&opt_tags, "tag", "", "tag to assign to this snapshot")
+	flags.StringVar(&opt_tags, "tag", "", "comma-separated list of tags to assign to this snapshot, either names or key=value pairs")
 	flags.StringVar(&opt_excludes, "excludes", "", "path to a file containing newline-separated regex patterns, treated as -exclude")
 	flags.Var(&opt_exclude, "exclude", "glob pattern to exclude files, can be specified multiple times to add several exclusion patterns")
 	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
 	flags.BoolVar(&opt_silent, "silent", false, "suppress ALL output")
 	flags.BoolVar(&opt_check, "check", false, "check the snapshot after creating it")
+	flags.BoolVar(&opt_estimate, "estimate", false, "report what the backup would upload without creating a snapshot")
+	flags.BoolVar(&opt_suggestexcludes, "suggest-excludes", false, "suggest exclude rules for the data not worth backing up once the snapshot is created")
+	flags.BoolVar(&opt_nocache, "no-cache", false, "do not trust the VFS cache, rescan all files")
+	flags.BoolVar(&opt_strictcache, "strict-cache", false, "also compare change time when validating VFS cache entries")
+	flags.BoolVar(&opt_delta, "delta", false, "store chunks similar to previously stored ones as deltas against them")
+	flags.StringVar(&opt_wholefile, "whole-file", "", "do not chunk files smaller than this size, deduplicating them as a whole")
+	flags.BoolVar(&opt_metadataonly, "metadata-only", false, "record the filesystem tree and metadata without storing file content")
+	flags.BoolVar(&opt_mbox, "mbox", false, "split mbox files on message boundaries so that appended messages do not change previous chunks")
+	flags.BoolVar(&opt_textindex, "text-index", false, "build a full-text index of the text files for plakar search")
+	flags.Uint64Var(&opt_maxerrors, "max-errors", 0, "maximum number of errors recorded in the snapshot, 0 for no limit")
+	flags.StringVar(&opt_timestamp, "timestamp", "", "URL of an RFC3161 timestamping authority to prove the snapshot existence date")
+	flags.StringVar(&opt_namespace, "namespace", "", "namespace the snapshot belongs to, restricting who may browse it through the API")
+	flags.StringVar(&opt_followsymlinks, "follow-symlinks", "", "when to follow symbolic links: never, commanded (the backup root only) or always")
+	flags.StringVar(&opt_sqlite, "sqlite", "", "how to store SQLite databases: raw, check (report those in use) or backup (store consistent copies)")
+	flags.StringVar(&opt_contenttype, "content-type", "", "content type of the data read from the standard input")
+	flags.StringVar(&opt_systemstate, "system-state", "", "comma-separated list of system state modules to capture alongside the files (dpkg, rpm, brew, choco, crontab, systemd) or all")
+	flags.Var(&opt_replicate, "replicate", "clone of the repository the snapshot is replicated to once committed, can be specified multiple times")
+	opt_limits.InstallFlags(flags)
 	//flags.BoolVar(&opt_stdio, "stdio", false, "output one line per file to stdout instead of the default interactive output")
 	flags.Parse(args)
 
-	for _, item := range opt_exclude {
-		if _, err := glob.Compile(item); err != nil {
-			return nil, fmt.Errorf("failed to compile exclude pattern: %s", item)
+	if err := opt_limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch opt_followsymlinks {
+	case "", "never", "commanded", "always":
+	default:
+		return nil, fmt.Errorf("invalid -follow-symlinks value: %s", opt_followsymlinks)
+	}
+
+	switch opt_sqlite {
+	case "", "raw", "check", "backup":
+	default:
+		return nil, fmt.Errorf("invalid -sqlite value: %s", opt_sqlite)
+	}
+
+	if opt_systemstate != "" {
+		if _, err := sysstate.ParseModules(opt_systemstate); err != nil {
+			return nil, err
 		}
-		excludes = append(excludes, item)
 	}
 
-	if opt_excludes != "" {
-		fp, err := os.Open(opt_excludes)
+	var wholeFileThreshold uint32
+	if opt_wholefile != "" {
+		size, err := humanize.ParseBytes(opt_wholefile)
 		if err != nil {
-			return nil, fmt.Errorf("unable to open excludes file: %w", err)
+			return nil, fmt.Errorf("invalid -whole-file size: %w", err)
 		}
-		defer fp.Close()
-
-		scanner := bufio.NewScanner(fp)
-		for scanner.Scan() {
-			line := scanner.Text()
-			_, err := glob.Compile(line)
-			if err != nil {
-				return nil, fmt.Errorf("failed to compile exclude pattern: %s", line)
+		if repo != nil {
+			if maxSize := repo.Configuration().Chunking.MaxSize; size > uint64(maxSize) {
+				return nil, fmt.Errorf("-whole-file size can't exceed the maximum chunk size (%s)", humanize.IBytes(uint64(maxSize)))
 			}
-			excludes = append(excludes, line)
-		}
-		if err := scanner.Err(); err != nil {
-			ctx.GetLogger().Error("%s", err)
-			return nil, err
 		}
+		wholeFileThreshold = uint32(size)
+	}
+
+	if opt_estimate && (opt_check || opt_timestamp != "" || len(opt_replicate) != 0 || opt_suggestexcludes) {
+		return nil, fmt.Errorf("-estimate cannot be combined with -check, -timestamp, -replicate or -suggest-excludes")
+	}
+
+	excludes, err := LoadExcludes(opt_exclude, opt_excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	// repo is nil when only the importer configuration is needed, see
+	// ImporterConfig
+	var repositoryLocation string
+	if repo != nil {
+		repositoryLocation = repo.Location()
 	}
 	return &Backup{
-		RepositoryLocation: repo.Location(),
+		RepositoryLocation: repositoryLocation,
 		RepositorySecret:   ctx.GetSecret(),
 		Concurrency:        opt_concurrency,
 		Tags:               opt_tags,
@@ -115,9 +215,90 @@ func parse_cmd_backup(ctx *appcontext.AppContext, repo *repository.Repository, a
 		Quiet:              opt_quiet,
 		Path:               flags.Arg(0),
 		OptCheck:           opt_check,
+		Estimate:           opt_estimate,
+		SuggestExcludes:    opt_suggestexcludes,
+		NoCache:            opt_nocache,
+		StrictCache:        opt_strictcache,
+		DeltaCompression:   opt_delta,
+		WholeFileThreshold: wholeFileThreshold,
+		MetadataOnly:       opt_metadataonly,
+		MailboxChunking:    opt_mbox,
+		TextIndex:          opt_textindex,
+		MaxErrors:          opt_maxerrors,
+		Timestamp:          opt_timestamp,
+		Namespace:          opt_namespace,
+		FollowSymlinks:     opt_followsymlinks,
+		SQLite:             opt_sqlite,
+		ContentType:        opt_contenttype,
+		SystemState:        opt_systemstate,
+		Replicate:          opt_replicate,
+		Limits:             opt_limits,
 	}, nil
 }
 
+// scanDir returns the location the backup reads from.
+func (cmd *Backup) scanDir(ctx *appcontext.AppContext) string {
+	if cmd.Path != "" {
+		return cmd.Path
+	}
+	return ctx.CWD
+}
+
+// importerConfig returns the configuration of the importer the backup reads
+// from, resolving the remotes of the configuration.
+func (cmd *Backup) importerConfig(ctx *appcontext.AppContext) (map[string]string, error) {
+	scanDir := cmd.scanDir(ctx)
+
+	importerConfig := map[string]string{
+		"location": scanDir,
+	}
+	if strings.HasPrefix(scanDir, "@") {
+		remote, err := ctx.Config.GetRemote(scanDir[1:])
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve importer: %s: %w", scanDir, err)
+		}
+		if _, ok := remote["location"]; !ok {
+			return nil, fmt.Errorf("could not resolve importer location: %s", scanDir)
+		}
+		importerConfig = make(map[string]string, len(remote)+1)
+		for key, value := range remote {
+			importerConfig[key] = value
+		}
+	}
+	if cmd.FollowSymlinks != "" {
+		importerConfig["follow_symlinks"] = cmd.FollowSymlinks
+	}
+	if cmd.SQLite != "" {
+		importerConfig["sqlite"] = cmd.SQLite
+	}
+	if cmd.ContentType != "" {
+		importerConfig["content_type"] = cmd.ContentType
+	}
+	return importerConfig, nil
+}
+
+// ImporterConfig returns the configuration of the importer of the backup
+// described by args, without opening the repository.  The privileged helper
+// of privilege-separated backups creates its importer from it rather than
+// from what the unprivileged process asks for.
+func ImporterConfig(ctx *appcontext.AppContext, args []string) (map[string]string, error) {
+	subcommand, err := parse_cmd_backup(ctx, nil, args)
+	if err != nil {
+		return nil, err
+	}
+	cmd := subcommand.(*Backup)
+
+	importerConfig, err := cmd.importerConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	location := importerConfig["location"]
+	if !strings.Contains(location, "://") && !filepath.IsAbs(location) {
+		importerConfig["location"] = filepath.Join(ctx.CWD, location)
+	}
+	return importerConfig, nil
+}
+
 type Backup struct {
 	RepositoryLocation string
 	RepositorySecret   []byte
@@ -130,12 +311,49 @@ type Backup struct {
 	Quiet       bool
 	Path        string
 	OptCheck    bool
+	Estimate    bool
+	NoCache     bool
+	StrictCache bool
+	MaxErrors   uint64
+	Timestamp   string
+	Namespace   string
+	Limits      utils.Limits
+
+	FollowSymlinks string
+	SQLite         string
+	ContentType    string
+
+	// SystemState lists the system state modules whose output is stored
+	// below sysstate.DIRECTORY in the snapshot.
+	SystemState string
+
+	// SuggestExcludes logs the exclude rules which would have left out
+	// data usually not worth backing up.
+	SuggestExcludes bool
+
+	// Replicate lists the clones of the repository the snapshot is copied
+	// to in the background once committed.
+	Replicate []string
+
+	DeltaCompression   bool
+	WholeFileThreshold uint32
+	MetadataOnly       bool
+	MailboxChunking    bool
+	TextIndex          bool
 }
 
 func (cmd *Backup) Name() string {
 	return "backup"
 }
 
+func (cmd *Backup) IsLimited() bool {
+	return cmd.Limits.IsSet()
+}
+
+func (cmd *Backup) ApplyLimits() (func() error, error) {
+	return cmd.Limits.Apply()
+}
+
 func (cmd *Backup) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
 	snap, err := snapshot.New(repo)
 	if err != nil {
@@ -147,12 +365,14 @@ func (cmd *Backup) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 	if cmd.Job != "" {
 		snap.Header.Job = cmd.Job
 	}
+	snap.Header.Namespace = cmd.Namespace
+	snap.TimestampAuthority = cmd.Timestamp
 
-	var tags []string
-	if cmd.Tags == "" {
-		tags = []string{}
-	} else {
-		tags = []string{cmd.Tags}
+	tags := []string{}
+	for _, tag := range strings.Split(cmd.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
 	}
 
 	excludes := []glob.Glob{}
@@ -169,52 +389,84 @@ func (cmd *Backup) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		Name:           "default",
 		Tags:           tags,
 		Excludes:       excludes,
-	}
+		NoCache:        cmd.NoCache,
+		StrictCache:    cmd.StrictCache,
 
-	scanDir := ctx.CWD
-	if cmd.Path != "" {
-		scanDir = cmd.Path
+		DeltaCompression:   cmd.DeltaCompression,
+		WholeFileThreshold: cmd.WholeFileThreshold,
+		MetadataOnly:       cmd.MetadataOnly,
+		MailboxChunking:    cmd.MailboxChunking,
+		MaxErrors:          cmd.MaxErrors,
+		TextIndex:          cmd.TextIndex,
 	}
 
-	importerConfig := map[string]string{
-		"location": scanDir,
+	scanDir := cmd.scanDir(ctx)
+	importerConfig, err := cmd.importerConfig(ctx)
+	if err != nil {
+		return 1, err
 	}
-	if strings.HasPrefix(scanDir, "@") {
-		remote, ok := ctx.Config.GetRemote(scanDir[1:])
-		if !ok {
-			return 1, fmt.Errorf("could not resolve importer: %s", scanDir)
-		}
-		if _, ok := remote["location"]; !ok {
-			return 1, fmt.Errorf("could not resolve importer location: %s", scanDir)
-		} else {
-			importerConfig = remote
-		}
+
+	newImporter := importer.NewImporter
+	if privsep.IsWorker() {
+		newImporter = privsep.NewImporter
 	}
 
-	imp, err := importer.NewImporter(importerConfig)
+	imp, err := newImporter(importerConfig)
 	if err != nil {
 		if !filepath.IsAbs(scanDir) {
 			scanDir = filepath.Join(ctx.CWD, scanDir)
 		}
-		imp, err = importer.NewImporter(map[string]string{"location": "fs://" + scanDir})
+		importerConfig = map[string]string{"location": "fs://" + scanDir}
+		if cmd.FollowSymlinks != "" {
+			importerConfig["follow_symlinks"] = cmd.FollowSymlinks
+		}
+		if cmd.SQLite != "" {
+			importerConfig["sqlite"] = cmd.SQLite
+		}
+		imp, err = newImporter(importerConfig)
 		if err != nil {
 			return 1, fmt.Errorf("failed to create an importer for %s: %s", scanDir, err)
 		}
 	}
 	defer imp.Close()
 
-	if cmd.Silent {
-		if err := snap.Backup(imp, opts); err != nil {
-			return 1, fmt.Errorf("failed to create snapshot: %w", err)
+	if cmd.SystemState != "" {
+		modules, err := sysstate.ParseModules(cmd.SystemState)
+		if err != nil {
+			return 1, err
+		}
+		imp = sysstate.NewImporter(imp, modules)
+	}
+
+	if cmd.Estimate {
+		return cmd.estimate(ctx, snap, imp, opts)
+	}
+
+	if len(cmd.Replicate) != 0 {
+		replicas, closeReplicas, err := openReplicas(ctx, repo, cmd.Replicate)
+		if err != nil {
+			return 1, err
 		}
+		unregister := repo.OnCommit(repository.Replicate(replicas, replicationRetries, replicationBackoff))
+		defer func() {
+			unregister()
+			repo.WaitHooks()
+			closeReplicas()
+		}()
+	}
+
+	if cmd.Silent {
+		err = snap.Backup(imp, opts)
 	} else {
 		ep := startEventsProcessor(ctx, imp.Root(), true, cmd.Quiet)
-		if err := snap.Backup(imp, opts); err != nil {
-			ep.Close()
-			return 1, fmt.Errorf("failed to create snapshot: %w", err)
-		}
+		err = snap.Backup(imp, opts)
 		ep.Close()
 	}
+	if errors.Is(err, context.Canceled) {
+		return 1, fmt.Errorf("backup interrupted, nothing was committed")
+	} else if err != nil {
+		return 1, fmt.Errorf("failed to create snapshot: %w", err)
+	}
 
 	if cmd.OptCheck {
 		repo.RebuildState()
@@ -239,11 +491,80 @@ func (cmd *Backup) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		}
 	}
 
+	source := snap.Header.GetSource(0)
 	ctx.GetLogger().Info("%s: created %s snapshot %x of size %s in %s",
 		cmd.Name(),
 		"unsigned",
 		snap.Header.GetIndexShortID(),
-		humanize.Bytes(snap.Header.GetSource(0).Summary.Directory.Size+snap.Header.GetSource(0).Summary.Below.Size),
+		humanize.Bytes(source.Summary.Directory.Size+source.Summary.Below.Size),
 		snap.Header.Duration)
+
+	if nErrors := source.Summary.Directory.Errors + source.Summary.Below.Errors; nErrors != 0 {
+		if source.VFS.ErrorsOverflow != 0 {
+			ctx.GetLogger().Warn("%s: %d errors, %d of which were not recorded (-max-errors %d)",
+				cmd.Name(), nErrors, source.VFS.ErrorsOverflow, cmd.MaxErrors)
+		} else {
+			ctx.GetLogger().Warn("%s: %d errors", cmd.Name(), nErrors)
+		}
+	}
+
+	if cmd.SuggestExcludes {
+		if err := cmd.suggestExcludes(ctx, repo, snap.Header.Identifier, imp.Root()); err != nil {
+			ctx.GetLogger().Warn("%s: could not suggest excludes: %s", cmd.Name(), err)
+		}
+	}
+	return 0, nil
+}
+
+// suggestExcludes logs the exclude rules snapshot.SuggestExcludes finds
+// for the snapshot just created, and how to add them to the job.
+func (cmd *Backup) suggestExcludes(ctx *appcontext.AppContext, repo *repository.Repository, snapshotID objects.MAC, root string) error {
+	if err := repo.RebuildState(); err != nil {
+		return err
+	}
+
+	snap, err := snapshot.Load(repo, snapshotID)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	suggestions, err := snap.SuggestExcludes(root, snapshot.DefaultSuggestMinSize)
+	if err != nil {
+		return err
+	}
+	if len(suggestions) == 0 {
+		return nil
+	}
+
+	for _, s := range suggestions {
+		ctx.GetLogger().Info("%s: excluding %s would save %s (%s)", cmd.Name(), s.Pattern, humanize.IBytes(s.Size), s.Reason)
+	}
+	if cmd.Job != "" {
+		ctx.GetLogger().Info("%s: add them to the job with: plakar report -apply %s excludes %x", cmd.Name(), cmd.Job, snapshotID[:4])
+	} else {
+		ctx.GetLogger().Info("%s: review them with: plakar report excludes %x", cmd.Name(), snapshotID[:4])
+	}
+	return nil
+}
+
+// estimate reports what the backup would read and upload, as computed by
+// snapshot.Estimate, without creating the snapshot.
+func (cmd *Backup) estimate(ctx *appcontext.AppContext, snap *snapshot.Snapshot, imp importer.Importer, opts *snapshot.BackupOptions) (int, error) {
+	est, err := snap.Estimate(imp, opts)
+	if err != nil {
+		return 1, fmt.Errorf("failed to estimate backup: %w", err)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "%s: estimate for %s, no snapshot was created\n", cmd.Name(), imp.Root())
+	fmt.Fprintf(ctx.Stdout, "  scanned:   %d files in %d directories, %s\n", est.Files, est.Directories, humanize.Bytes(est.Size))
+	fmt.Fprintf(ctx.Stdout, "  cached:    %d files, %s\n", est.CachedFiles, humanize.Bytes(est.CachedSize))
+	fmt.Fprintf(ctx.Stdout, "  read:      %d files, %s\n", est.ReadFiles, humanize.Bytes(est.ReadSize))
+	fmt.Fprintf(ctx.Stdout, "  chunks:    %d, %d of which are not in the repository\n", est.Chunks, est.NewChunks)
+	fmt.Fprintf(ctx.Stdout, "  upload:    %s before compression\n", humanize.Bytes(est.NewSize))
+	fmt.Fprintf(ctx.Stdout, "  duration:  %s to scan and read\n", est.Duration.Round(time.Millisecond))
+	if est.Errors != 0 {
+		ctx.GetLogger().Warn("%s: %d files could not be estimated", cmd.Name(), est.Errors)
+	}
 	return 0, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	"github.com/PlakarKorp/plakar/storage"
 	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
@@ -169,3 +171,119 @@ func TestExecuteCmdCreateDefaultWithExcludes(t *testing.T) {
 	lastline := lines[len(lines)-1]
 	require.Contains(t, lastline, "created unsigned snapshot")
 }
+
+func TestExecuteCmdBackupReplicate(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.HomeDir = repo.Location()
+
+	// an empty clone shares the configuration of the repository
+	_, wrappedConfig, err := storage.Open(map[string]string{"location": repo.Location()})
+	require.NoError(t, err)
+	replicaDir := filepath.Join(t.TempDir(), "replica")
+	_, err = storage.Create(map[string]string{"location": replicaDir}, wrappedConfig)
+	require.NoError(t, err)
+
+	subcommand, err := parse_cmd_backup(ctx, repo, []string{"-replicate", replicaDir, tmpBackupDir})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "replicated snapshot")
+
+	require.NoError(t, repo.RebuildState())
+	snapshotIDs, err := repo.GetSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshotIDs, 1)
+
+	store, serializedConfig, err := storage.Open(map[string]string{"location": replicaDir})
+	require.NoError(t, err)
+	replica, err := repository.New(ctx, store, serializedConfig)
+	require.NoError(t, err)
+	replicated, err := replica.GetSnapshots()
+	require.NoError(t, err)
+	require.Equal(t, snapshotIDs, replicated)
+
+	snap, err := snapshot.Load(replica, replicated[0])
+	require.NoError(t, err)
+	snap.Close()
+
+	// only clones can be replicated to
+	other, _ := generateFixtures(t, bufOut, bufErr)
+	subcommand, err = parse_cmd_backup(ctx, repo, []string{"-replicate", other.Location(), tmpBackupDir})
+	require.NoError(t, err)
+	_, err = subcommand.Execute(ctx, repo)
+	require.ErrorContains(t, err, "is not a clone")
+}
+
+func TestExecuteCmdBackupEstimate(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.HomeDir = repo.Location()
+	ctx.Stdout = bufOut
+
+	field := func(name string) string {
+		for _, line := range strings.Split(bufOut.String(), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), name+":") {
+				return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), name+":"))
+			}
+		}
+		return ""
+	}
+
+	estimate := func() {
+		bufOut.Reset()
+		subcommand, err := parse_cmd_backup(ctx, repo, []string{"-estimate", tmpBackupDir})
+		require.NoError(t, err)
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+	}
+
+	// everything is to be uploaded to an empty repository...
+	estimate()
+	require.True(t, strings.HasPrefix(field("scanned"), "4 files in "))
+	require.True(t, strings.HasSuffix(field("scanned"), " directories, 49 B"))
+	require.Equal(t, "0 files, 0 B", field("cached"))
+	require.Equal(t, "4, 4 of which are not in the repository", field("chunks"))
+	require.Equal(t, "49 B before compression", field("upload"))
+
+	// ...and no snapshot was created
+	require.NoError(t, repo.RebuildState())
+	snapshotIDs, err := repo.GetSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshotIDs, 0)
+
+	subcommand, err := parse_cmd_backup(ctx, repo, []string{tmpBackupDir})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.NoError(t, repo.RebuildState())
+
+	// nothing is left to upload once backed up
+	estimate()
+	require.Equal(t, "4 files, 49 B", field("cached"))
+	require.Equal(t, "0 files, 0 B", field("read"))
+	require.Equal(t, "0 B before compression", field("upload"))
+
+	// a new file is read, and only its content counted
+	require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, "subdir", "new.txt"), []byte("hello new, hello foo"), 0644))
+	estimate()
+	require.Equal(t, "1 files, 20 B", field("read"))
+	require.Equal(t, "1, 1 of which are not in the repository", field("chunks"))
+	require.Equal(t, "20 B before compression", field("upload"))
+
+	_, err = parse_cmd_backup(ctx, repo, []string{"-estimate", "-check", tmpBackupDir})
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+const (
+	replicationRetries = 5
+	replicationBackoff = 30 * time.Second
+)
+
+// ReplicaFlags collects the repositories of a repeatable -replicate flag.
+type ReplicaFlags []string
+
+func (r *ReplicaFlags) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *ReplicaFlags) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// ConfiguredReplicas returns the replicas listed, comma-separated, by the
+// replicate option of a repository configuration.
+func ConfiguredReplicas(storeConfig map[string]string) []string {
+	replicas := []string{}
+	for _, replica := range strings.Split(storeConfig["replicate"], ",") {
+		if replica = strings.TrimSpace(replica); replica != "" {
+			replicas = append(replicas, replica)
+		}
+	}
+	return replicas
+}
+
+// openReplicas opens the clones of the repository a snapshot is to be
+// replicated to, given as locations or @name references.  They share the
+// configuration, and thus the secret, of the repository.
+func openReplicas(ctx *appcontext.AppContext, repo *repository.Repository, locations []string) ([]*repository.Repository, func(), error) {
+	replicas := make([]*repository.Repository, 0, len(locations))
+	stores := make([]storage.Store, 0, len(locations))
+	closeAll := func() {
+		for _, replica := range replicas {
+			replica.Close()
+		}
+		for _, store := range stores {
+			store.Close()
+		}
+	}
+
+	for _, location := range locations {
+		storeConfig := map[string]string{"location": location}
+		if strings.HasPrefix(location, "@") {
+			remote, err := ctx.Config.GetRepository(location[1:])
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("could not resolve replica: %s: %w", location, err)
+			}
+			if _, ok := remote["location"]; !ok {
+				closeAll()
+				return nil, nil, fmt.Errorf("could not resolve replica location: %s", location)
+			}
+			storeConfig = remote
+		}
+
+		store, serializedConfig, err := storage.Open(storeConfig)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("could not open replica %s: %w", location, err)
+		}
+		stores = append(stores, store)
+
+		replica, err := repository.NewNoRebuild(ctx, store, serializedConfig)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("could not open replica %s: %w", location, err)
+		}
+		if replica.Configuration().RepositoryID != repo.Configuration().RepositoryID {
+			closeAll()
+			return nil, nil, fmt.Errorf("replica %s is not a clone of %s, see plakar clone", location, repo.Location())
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas, closeAll, nil
+}
@@ -39,6 +39,8 @@ func init() {
 func parse_cmd_cat(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
 	var opt_nodecompress bool
 	var opt_highlight bool
+	var opt_offset int64
+	var opt_length int64
 
 	flags := flag.NewFlagSet("cat", flag.ExitOnError)
 	flags.Usage = func() {
@@ -49,17 +51,27 @@ func parse_cmd_cat(ctx *appcontext.AppContext, repo *repository.Repository, args
 
 	flags.BoolVar(&opt_nodecompress, "no-decompress", false, "do not try to decompress output")
 	flags.BoolVar(&opt_highlight, "highlight", false, "highlight output")
+	flags.Int64Var(&opt_offset, "offset", 0, "skip this many bytes at the start of each file")
+	flags.Int64Var(&opt_length, "length", -1, "output at most this many bytes of each file, -1 for all")
 	flags.Parse(args)
 
 	if flags.NArg() == 0 {
 		return nil, fmt.Errorf("at least one parameter is required")
 	}
+	if opt_offset < 0 {
+		return nil, fmt.Errorf("invalid -offset: %d", opt_offset)
+	}
+	if opt_length < -1 {
+		return nil, fmt.Errorf("invalid -length: %d", opt_length)
+	}
 
 	return &Cat{
 		RepositoryLocation: repo.Location(),
 		RepositorySecret:   ctx.GetSecret(),
 		NoDecompress:       opt_nodecompress,
 		Highlight:          opt_highlight,
+		Offset:             opt_offset,
+		Length:             opt_length,
 		Paths:              flags.Args(),
 	}, nil
 }
@@ -71,6 +83,11 @@ type Cat struct {
 	NoDecompress bool
 	Highlight    bool
 	Paths        []string
+
+	// Offset and Length select a range of each file, Length being -1
+	// for the rest of the file.
+	Offset int64
+	Length int64
 }
 
 func (cmd *Cat) Name() string {
@@ -120,6 +137,7 @@ func (cmd *Cat) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 
 		file := entry.Open(fs, pathname)
 		var rd io.ReadCloser = file
+		decompressed := false
 
 		if !cmd.NoDecompress {
 			if entry.ResolvedObject.ContentType == "application/gzip" && !cmd.NoDecompress {
@@ -132,7 +150,32 @@ func (cmd *Cat) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 					continue
 				}
 				rd = gzRd
+				decompressed = true
+			}
+		}
+
+		// the raw content is seeked to, skipping chunks, while a
+		// decompressed one has to be read through
+		var input io.Reader = rd
+		if cmd.Offset != 0 {
+			if !decompressed {
+				_, err = file.(io.Seeker).Seek(cmd.Offset, io.SeekStart)
+			} else {
+				_, err = io.CopyN(io.Discard, rd, cmd.Offset)
+				if err == io.EOF {
+					err = nil
+				}
 			}
+			if err != nil {
+				ctx.GetLogger().Error("cat: %s: %s", pathname, err)
+				errors++
+				file.Close()
+				snap.Close()
+				continue
+			}
+		}
+		if cmd.Length != -1 {
+			input = io.LimitReader(input, cmd.Length)
 		}
 
 		if cmd.Highlight {
@@ -146,7 +189,7 @@ func (cmd *Cat) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 			formatter := formatters.Get("terminal")
 			style := styles.Get("dracula")
 
-			reader := bufio.NewReader(rd)
+			reader := bufio.NewReader(input)
 			buffer := make([]byte, 4096) // Fixed-size buffer for chunked reading
 			for {
 				n, err := reader.Read(buffer) // Read up to the size of the buffer
@@ -182,7 +225,7 @@ func (cmd *Cat) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 				}
 			}
 		} else {
-			_, err = io.Copy(ctx.Stdout, rd)
+			_, err = io.Copy(ctx.Stdout, input)
 		}
 		file.Close()
 		if err != nil {
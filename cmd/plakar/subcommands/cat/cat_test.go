@@ -303,3 +303,53 @@ func TestExecuteCmdCatHighlight(t *testing.T) {
 	output := bufOut.String()
 	require.Equal(t, "\x1b[1m\x1b[37mhello dummy\x1b[0m", output)
 }
+
+func TestExecuteCmdCatRange(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	// the range applies to each file, the results being concatenated
+	args := []string{"-offset", "6", "-length", "3", tmpBackupDir + "/subdir/dummy.txt", tmpBackupDir + "/subdir/foo.txt"}
+	subcommand, err := parse_cmd_cat(ctx, repo, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Equal(t, "dumfoo", bufOut.String())
+
+	// reading past the end of a file outputs nothing
+	bufOut.Reset()
+	args = []string{"-offset", "100", tmpBackupDir + "/subdir/dummy.txt"}
+	subcommand, err = parse_cmd_cat(ctx, repo, args)
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Equal(t, "", bufOut.String())
+
+	_, err = parse_cmd_cat(ctx, repo, []string{"-offset", "-1", tmpBackupDir + "/subdir/dummy.txt"})
+	require.Error(t, err)
+	_, err = parse_cmd_cat(ctx, repo, []string{"-length", "-2", tmpBackupDir + "/subdir/dummy.txt"})
+	require.Error(t, err)
+}
@@ -17,14 +17,17 @@
 package check
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/google/uuid"
 )
@@ -49,6 +52,7 @@ func parse_cmd_check(ctx *appcontext.AppContext, repo *repository.Repository, ar
 	var opt_noVerify bool
 	var opt_quiet bool
 	var opt_silent bool
+	var opt_json bool
 
 	flags := flag.NewFlagSet("check", flag.ExitOnError)
 	flags.Usage = func() {
@@ -71,6 +75,7 @@ func parse_cmd_check(ctx *appcontext.AppContext, repo *repository.Repository, ar
 	flags.BoolVar(&opt_fastCheck, "fast", false, "enable fast checking (no digest verification)")
 	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
 	flags.BoolVar(&opt_quiet, "silent", false, "suppress ALL output")
+	flags.BoolVar(&opt_json, "json", false, "output one JSON record per failure")
 	flags.Parse(args)
 
 	var err error
@@ -118,6 +123,7 @@ func parse_cmd_check(ctx *appcontext.AppContext, repo *repository.Repository, ar
 		Quiet:       opt_quiet,
 		Snapshots:   flags.Args(),
 		Silent:      opt_silent,
+		JSON:        opt_json,
 	}, nil
 }
 
@@ -142,6 +148,7 @@ type Check struct {
 	Quiet       bool
 	Snapshots   []string
 	Silent      bool
+	JSON        bool
 }
 
 func (cmd *Check) Name() string {
@@ -149,8 +156,8 @@ func (cmd *Check) Name() string {
 }
 
 func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
-	if !cmd.Silent {
-		go eventsProcessorStdio(ctx, cmd.Quiet)
+	if !cmd.Silent && !cmd.JSON {
+		eventsProcessorStdio(ctx, cmd.Quiet)
 	}
 
 	var snapshots []string
@@ -212,6 +219,19 @@ func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 		FastCheck:      cmd.FastCheck,
 	}
 
+	var mu sync.Mutex
+	encoder := json.NewEncoder(ctx.Stdout)
+	report := func(failure *snapshot.CheckFailure) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(failure); err != nil {
+			ctx.GetLogger().Warn("%s", err)
+		}
+	}
+	if cmd.JSON {
+		opts.Failure = report
+	}
+
 	failures := false
 	for _, arg := range snapshots {
 		snap, pathname, err := utils.OpenSnapshotByPath(repo, arg)
@@ -225,6 +245,15 @@ func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 			} else if !ok {
 				ctx.GetLogger().Info("snapshot %x signature verification failed", snap.Header.Identifier)
 				failures = true
+				if cmd.JSON {
+					report(&snapshot.CheckFailure{
+						Snapshot: fmt.Sprintf("%x", snap.Header.Identifier),
+						Path:     pathname,
+						Type:     resources.RT_SIGNATURE.String(),
+						MAC:      fmt.Sprintf("%x", snap.Header.Identifier),
+						Reason:   "invalid signature",
+					})
+				}
 			} else {
 				ctx.GetLogger().Info("snapshot %x signature verification succeeded", snap.Header.Identifier)
 			}
@@ -232,11 +261,12 @@ func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 
 		if ok, err := snap.Check(pathname, opts); err != nil {
 			ctx.GetLogger().Warn("%s", err)
+			failures = true
 		} else if !ok {
 			failures = true
 		}
 
-		if !failures {
+		if !failures && !cmd.JSON {
 			ctx.GetLogger().Info("%s: verification of %x:%s completed successfully",
 				cmd.Name(),
 				snap.Header.GetIndexShortID(),
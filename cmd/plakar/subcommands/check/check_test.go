@@ -191,3 +191,29 @@ func TestExecuteCmdCheckSpecificSnapshot(t *testing.T) {
 	lastline := lines[len(lines)-1]
 	require.Contains(t, lastline, fmt.Sprintf("info: check: verification of %s:%s completed successfully", hex.EncodeToString(snap.Header.GetIndexShortID()[:]), snap.Header.GetSource(0).Importer.Directory))
 }
+
+func TestExecuteCmdCheckJSON(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	subcommand, err := parse_cmd_check(ctx, repo, []string{"-json"})
+	require.NoError(t, err)
+	require.True(t, subcommand.(*Check).JSON)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// a healthy repository has no failure to report
+	require.Empty(t, bufOut.String())
+}
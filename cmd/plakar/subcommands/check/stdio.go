@@ -13,8 +13,11 @@ var (
 
 func eventsProcessorStdio(ctx *appcontext.AppContext, quiet bool) chan struct{} {
 	done := make(chan struct{})
+
+	// listen before returning so that no event of the check is missed
+	listener := ctx.Events().Listen()
 	go func() {
-		for event := range ctx.Events().Listen() {
+		for event := range listener {
 			switch event := event.(type) {
 			case events.DirectoryMissing:
 				ctx.GetLogger().Warn("%x: %s %s: missing directory", event.SnapshotID[:4], crossMark, event.Pathname)
@@ -0,0 +1,239 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package clients
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/identity"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/scheduler"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/google/uuid"
+)
+
+func init() {
+	subcommands.Register("clients", parse_cmd_clients)
+}
+
+func parse_cmd_clients(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_clients string
+
+	flags := flag.NewFlagSet("clients", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] approve CLIENT\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] reject CLIENT\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] profile CLIENT|default FILE\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opt_clients, "clients", "", "directory holding the enrollment requests, defaults to the configuration directory")
+	flags.Parse(args)
+
+	if opt_clients == "" {
+		clientsDir, err := utils.GetClientsDir()
+		if err != nil {
+			return nil, err
+		}
+		opt_clients = clientsDir
+	}
+
+	var action, client string
+	var profile []byte
+	switch flags.NArg() {
+	case 0:
+	case 2:
+		action, client = flags.Arg(0), flags.Arg(1)
+		if action != "approve" && action != "reject" {
+			return nil, fmt.Errorf("unknown action: %s", action)
+		}
+	case 3:
+		action, client = flags.Arg(0), flags.Arg(1)
+		if action != "profile" {
+			return nil, fmt.Errorf("unknown action: %s", action)
+		}
+		data, err := os.ReadFile(flags.Arg(2))
+		if err != nil {
+			return nil, err
+		}
+		schedules, err := config.ParseSchedules(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", flags.Arg(2), err)
+		}
+		for name, schedule := range schedules {
+			if _, err := scheduler.ParseCron(schedule.Cron); err != nil {
+				return nil, fmt.Errorf("%s: schedule %s: %w", flags.Arg(2), name, err)
+			}
+		}
+		profile = data
+	default:
+		flags.Usage()
+		return nil, fmt.Errorf("invalid arguments")
+	}
+
+	return &Clients{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		ClientsDir:         opt_clients,
+		Action:             action,
+		Client:             client,
+		Profile:            profile,
+	}, nil
+}
+
+type Clients struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	ClientsDir string
+	Action     string
+	Client     string
+	Profile    []byte
+}
+
+func (cmd *Clients) Name() string {
+	return "clients"
+}
+
+func (cmd *Clients) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	registry, err := identity.OpenRegistry(cmd.ClientsDir)
+	if err != nil {
+		return 1, err
+	}
+
+	if cmd.Action == "profile" {
+		identifier := uuid.Nil
+		name := "all clients"
+		if cmd.Client != "default" {
+			client, err := registry.Lookup(cmd.Client)
+			if err != nil {
+				return 1, err
+			}
+			identifier, name = client.Request.Identifier, client.Request.Name
+		}
+
+		profile, err := registry.SetProfile(identifier, cmd.Profile)
+		if err != nil {
+			return 1, err
+		}
+		ctx.GetLogger().Info("clients: profile %d set for %s", profile.Serial, name)
+		return 0, nil
+	}
+
+	if cmd.Action != "" {
+		client, err := registry.Lookup(cmd.Client)
+		if err != nil {
+			return 1, err
+		}
+
+		if cmd.Action == "approve" {
+			_, err = registry.Approve(client.Request.Identifier)
+		} else {
+			_, err = registry.Reject(client.Request.Identifier)
+		}
+		if err != nil {
+			return 1, err
+		}
+		ctx.GetLogger().Info("clients: %s %s (%s)", cmd.Action, client.Request.Identifier, client.Request.Name)
+		return 0, nil
+	}
+
+	clients, err := registry.List()
+	if err != nil {
+		return 1, err
+	}
+
+	signed, err := signedSnapshots(repo)
+	if err != nil {
+		return 1, err
+	}
+
+	for _, client := range clients {
+		count := signed[client.Request.Identifier]
+		if count != nil && !bytes.Equal(count.publicKey, client.Request.PublicKey) {
+			// snapshots signed under this identifier with another key
+			count = nil
+		}
+		snapshots := 0
+		if count != nil {
+			snapshots = count.snapshots
+		}
+		delete(signed, client.Request.Identifier)
+
+		fmt.Fprintf(ctx.Stdout, "%s %s %8s %s %s %d snapshots\n",
+			client.Submitted.UTC().Format(time.RFC3339),
+			client.Request.Identifier,
+			client.Status,
+			client.Request.Name,
+			client.Request.Hostname,
+			snapshots)
+	}
+
+	for identifier, count := range signed {
+		fmt.Fprintf(ctx.Stdout, "%20s %s %8s %d snapshots\n", "-", identifier, "unknown", count.snapshots)
+	}
+	return 0, nil
+}
+
+type signedCount struct {
+	publicKey []byte
+	snapshots int
+}
+
+// signedSnapshots counts the snapshots of the repository carrying a valid
+// signature, per identity.
+func signedSnapshots(repo *repository.Repository) (map[uuid.UUID]*signedCount, error) {
+	snapshotIDs, err := utils.LocateSnapshotIDs(repo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[uuid.UUID]*signedCount)
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		id := snap.Header.Identity
+		if id.Identifier == uuid.Nil {
+			snap.Close()
+			continue
+		}
+
+		verified, err := snap.Verify()
+		snap.Close()
+		if err != nil || !verified {
+			continue
+		}
+		if count, ok := ret[id.Identifier]; ok {
+			count.snapshots++
+		} else {
+			ret[id.Identifier] = &signedCount{publicKey: id.PublicKey, snapshots: 1}
+		}
+	}
+	return ret, nil
+}
@@ -101,9 +101,9 @@ func (cmd *Clone) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 
 	storeConfig := map[string]string{"location": cmd.Dest}
 	if strings.HasPrefix(cmd.Dest, "@") {
-		remote, ok := ctx.Config.GetRepository(cmd.Dest[1:])
-		if !ok {
-			return 1, fmt.Errorf("could not resolve repository: %s", cmd.Dest)
+		remote, err := ctx.Config.GetRepository(cmd.Dest[1:])
+		if err != nil {
+			return 1, fmt.Errorf("could not resolve repository: %s: %w", cmd.Dest, err)
 		}
 		if _, ok := remote["location"]; !ok {
 			return 1, fmt.Errorf("could not resolve repository location: %s", cmd.Dest)
@@ -19,10 +19,14 @@ package version
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/repository"
+	"golang.org/x/term"
 )
 
 func init() {
@@ -70,7 +74,7 @@ func (cmd *Config) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 
 func cmd_remote(ctx *appcontext.AppContext, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: plakar config remote [create | set | unset | validate]")
+		return fmt.Errorf("usage: plakar config remote [create | set | set-secret | unset | validate]")
 	}
 
 	switch args[0] {
@@ -96,6 +100,23 @@ func cmd_remote(ctx *appcontext.AppContext, args []string) error {
 		ctx.Config.Remotes[name][option] = value
 		return ctx.Config.Save()
 
+	case "set-secret":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: plakar config remote set-secret name option")
+		}
+		name, option := args[1], args[2]
+		if !ctx.Config.HasRemote(name) {
+			return fmt.Errorf("remote %q does not exists", name)
+		}
+		value, err := readSecret(option)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Config.Seal("remotes", name, option, value); err != nil {
+			return err
+		}
+		return ctx.Config.Save()
+
 	case "unset":
 		if len(args) != 3 {
 			return fmt.Errorf("usage: plakar config remote unset name option")
@@ -114,13 +135,13 @@ func cmd_remote(ctx *appcontext.AppContext, args []string) error {
 		return fmt.Errorf("validation not implemented")
 
 	default:
-		return fmt.Errorf("usage: plakar config remote [create | set | validate]")
+		return fmt.Errorf("usage: plakar config remote [create | set | set-secret | unset | validate]")
 	}
 }
 
 func cmd_repository(ctx *appcontext.AppContext, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: plakar config repository [create | default | set | unset | validate]")
+		return fmt.Errorf("usage: plakar config repository [create | default | set | set-secret | unset | validate]")
 	}
 
 	switch args[0] {
@@ -157,6 +178,23 @@ func cmd_repository(ctx *appcontext.AppContext, args []string) error {
 		ctx.Config.Repositories[name][option] = value
 		return ctx.Config.Save()
 
+	case "set-secret":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: plakar config repository set-secret name option")
+		}
+		name, option := args[1], args[2]
+		if !ctx.Config.HasRepository(name) {
+			return fmt.Errorf("repository %q does not exists", name)
+		}
+		value, err := readSecret(option)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Config.Seal("repositories", name, option, value); err != nil {
+			return err
+		}
+		return ctx.Config.Save()
+
 	case "unset":
 		if len(args) != 3 {
 			return fmt.Errorf("usage: plakar config repository unset name option")
@@ -175,6 +213,28 @@ func cmd_repository(ctx *appcontext.AppContext, args []string) error {
 		return fmt.Errorf("validation not implemented")
 
 	default:
-		return fmt.Errorf("usage: plakar config repository [create | default | set | unset | validate]")
+		return fmt.Errorf("usage: plakar config repository [create | default | set | set-secret | unset | validate]")
+	}
+}
+
+// readSecret reads the value of a secret option from the terminal without
+// echoing it, or from the standard input if it is not a terminal, so that
+// it shows neither in the process list nor in the shell history.
+func readSecret(option string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "%s: ", option)
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintf(os.Stderr, "\n")
+		if err != nil {
+			return "", err
+		}
+		return string(value), nil
+	}
+
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimRight(string(value), "\r\n"), nil
 }
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package convert
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/foreign"
+)
+
+func init() {
+	subcommands.Register("convert", parse_cmd_convert)
+}
+
+func parse_cmd_convert(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_concurrency uint64
+	var opt_binary string
+	var opt_tags string
+	var opt_dryrun bool
+
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] restic://REPOSITORY | borg://REPOSITORY | @REMOTE [SNAPSHOT...]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel tasks")
+	flags.StringVar(&opt_binary, "binary", "", "path to the restic or borg binary")
+	flags.StringVar(&opt_tags, "tag", "", "comma-separated list of tags to add to the converted snapshots")
+	flags.BoolVar(&opt_dryrun, "n", false, "list the snapshots to convert without converting them")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("a restic or borg repository is required")
+	}
+
+	location := flags.Arg(0)
+	config := map[string]string{"location": location}
+	if strings.HasPrefix(location, "@") {
+		remote, err := ctx.Config.GetRemote(location[1:])
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve importer: %s: %w", location, err)
+		}
+		if _, ok := remote["location"]; !ok {
+			return nil, fmt.Errorf("could not resolve importer location: %s", location)
+		}
+		config = make(map[string]string, len(remote))
+		for key, value := range remote {
+			config[key] = value
+		}
+	}
+	if opt_binary != "" {
+		config["binary"] = opt_binary
+	}
+
+	return &Convert{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Config:             config,
+		Concurrency:        opt_concurrency,
+		Tags:               opt_tags,
+		DryRun:             opt_dryrun,
+		Snapshots:          flags.Args()[1:],
+	}, nil
+}
+
+type Convert struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Config      map[string]string
+	Concurrency uint64
+	Tags        string
+	DryRun      bool
+	Snapshots   []string
+}
+
+func (cmd *Convert) Name() string {
+	return "convert"
+}
+
+// converted returns the identifiers of the foreign snapshots that were
+// already converted, as recorded in the tags of the snapshots.
+func converted(repo *repository.Repository, tag string) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for snapshotID := range repo.ListSnapshots() {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			continue
+		}
+		if id, found := snap.Header.TagValue(tag); found {
+			ids[id] = struct{}{}
+		}
+		snap.Close()
+	}
+	return ids
+}
+
+func (cmd *Convert) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snapshots, err := foreign.List(cmd.Config)
+	if err != nil {
+		return 1, fmt.Errorf("convert: %w", err)
+	}
+
+	if len(cmd.Snapshots) != 0 {
+		selected := make([]foreign.Snapshot, 0, len(cmd.Snapshots))
+		for _, id := range cmd.Snapshots {
+			found := false
+			for _, s := range snapshots {
+				if s.ID == id || (len(id) >= 4 && strings.HasPrefix(s.ID, id)) {
+					selected = append(selected, s)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return 1, fmt.Errorf("convert: snapshot %s not found", id)
+			}
+		}
+		snapshots = selected
+	}
+
+	scheme, _, _ := strings.Cut(cmd.Config["location"], "://")
+	done := converted(repo, scheme+".id")
+
+	tags := []string{}
+	for _, tag := range strings.Split(cmd.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	var failures int
+	for _, s := range snapshots {
+		if _, ok := done[s.ID]; ok {
+			ctx.GetLogger().Info("%s: %s snapshot %s already converted", cmd.Name(), scheme, s.ID)
+			continue
+		}
+		if cmd.DryRun {
+			fmt.Fprintf(ctx.Stdout, "%s %s %s\n", s.Time.UTC().Format("2006-01-02T15:04:05Z"), s.ID, s.Name)
+			continue
+		}
+
+		snapshotID, err := cmd.convert(repo, s, tags)
+		if err != nil {
+			ctx.GetLogger().Error("%s: %s snapshot %s: %s", cmd.Name(), scheme, s.ID, err)
+			failures++
+			continue
+		}
+		ctx.GetLogger().Info("%s: converted %s snapshot %s into %x", cmd.Name(), scheme, s.ID, snapshotID[:4])
+
+		// later snapshots share most of their data with this one,
+		// the state must know of it for them to be deduplicated.
+		if err := repo.RebuildState(); err != nil {
+			return 1, fmt.Errorf("convert: %w", err)
+		}
+	}
+
+	if failures != 0 {
+		return 1, fmt.Errorf("convert: %d snapshots failed to convert", failures)
+	}
+	return 0, nil
+}
+
+func (cmd *Convert) convert(repo *repository.Repository, s foreign.Snapshot, tags []string) ([32]byte, error) {
+	config := make(map[string]string, len(cmd.Config)+1)
+	for key, value := range cmd.Config {
+		config[key] = value
+	}
+	config["snapshot"] = s.ID
+
+	imp, err := foreign.NewForeignImporter(config)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer imp.Close()
+
+	snap, err := snapshot.New(repo)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer snap.Close()
+
+	name := s.Name
+	if name == "" {
+		name = s.ID
+	}
+	err = snap.Backup(imp, &snapshot.BackupOptions{
+		MaxConcurrency: cmd.Concurrency,
+		Name:           name,
+		Tags:           tags,
+	})
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return snap.Header.Identifier, nil
+}
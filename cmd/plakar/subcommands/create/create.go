@@ -23,18 +23,16 @@ import (
 	"hash"
 	"io"
 	"os"
-	"strings"
+	"slices"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
-	"github.com/PlakarKorp/plakar/compression"
 	"github.com/PlakarKorp/plakar/encryption"
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/storage"
-	"github.com/PlakarKorp/plakar/versioning"
 )
 
 func init() {
@@ -42,7 +40,6 @@ func init() {
 }
 
 func parse_cmd_create(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
-	var opt_hashing string
 	var opt_noencryption bool
 	var opt_nocompression bool
 	var opt_allowweak bool
@@ -56,7 +53,17 @@ func parse_cmd_create(ctx *appcontext.AppContext, repo *repository.Repository, a
 	}
 
 	flags.BoolVar(&opt_allowweak, "weak-passphrase", false, "allow weak passphrase to protect the repository")
-	flags.StringVar(&opt_hashing, "hashing", hashing.DEFAULT_HASHING_ALGORITHM, "hashing algorithm to use for digests")
+	flags.String("preset", "", "preset of settings to start from: "+presetNames())
+	flags.String("chunking", "FASTCDC", "content-defined chunking algorithm: FASTCDC or ULTRACDC")
+	flags.String("chunk-min", "64KiB", "minimum size of chunks")
+	flags.String("chunk-avg", "1MiB", "average size of chunks")
+	flags.String("chunk-max", "4MiB", "maximum size of chunks")
+	flags.String("compression", "LZ4", "compression algorithm: LZ4, GZIP or none")
+	flags.String("hashing", hashing.DEFAULT_HASHING_ALGORITHM, "hashing algorithm to use for digests")
+	flags.String("encryption", "AES256-GCM-SIV", "encryption algorithm: AES256-GCM-SIV or none")
+	flags.String("kdf", encryption.DEFAULT_KDF, "key derivation function: ARGON2ID, SCRYPT or PBKDF2")
+	flags.String("packfile-size", "20MiB", "maximum size of packfiles")
+	flags.String("retention", "", "default retention of scheduled backups, e.g. 720h")
 	flags.BoolVar(&opt_noencryption, "no-encryption", false, "disable transparent encryption")
 	flags.BoolVar(&opt_nocompression, "no-compression", false, "disable transparent compression")
 	flags.Parse(args)
@@ -65,40 +72,46 @@ func parse_cmd_create(ctx *appcontext.AppContext, repo *repository.Repository, a
 		return nil, fmt.Errorf("%s: too many parameters", flag.CommandLine.Name())
 	}
 
-	if hashing.GetHasher(strings.ToUpper(opt_hashing)) == nil {
-		return nil, fmt.Errorf("%s: unknown hashing algorithm", flag.CommandLine.Name())
+	// only the flags given override the preset and configuration file
+	explicit := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		if slices.Contains(options, f.Name) {
+			explicit[f.Name] = f.Value.String()
+		}
+	})
+	if opt_noencryption {
+		explicit["encryption"] = "none"
+	}
+	if opt_nocompression {
+		explicit["compression"] = "none"
+	}
+
+	opts, err := resolveOptions(repo.StoreConfig(), explicit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", flags.Name(), err)
+	}
+	if err := applyOptions(storage.NewConfiguration(), opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", flags.Name(), err)
 	}
 
 	return &Create{
-		AllowWeak:     opt_allowweak,
-		Hashing:       opt_hashing,
-		NoEncryption:  opt_noencryption,
-		NoCompression: opt_nocompression,
-		Location:      repo.Location(),
+		AllowWeak: opt_allowweak,
+		Options:   opts,
+		Location:  repo.Location(),
 	}, nil
 }
 
 type Create struct {
-	AllowWeak     bool
-	Hashing       string
-	NoEncryption  bool
-	NoCompression bool
-	Location      string
+	AllowWeak bool
+	Options   map[string]string
+	Location  string
 }
 
 func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
 	storageConfiguration := storage.NewConfiguration()
-	if cmd.NoCompression {
-		storageConfiguration.Compression = nil
-	} else {
-		storageConfiguration.Compression = compression.NewDefaultConfiguration()
-	}
-
-	hashingConfiguration, err := hashing.LookupDefaultConfiguration(strings.ToUpper(cmd.Hashing))
-	if err != nil {
+	if err := applyOptions(storageConfiguration, cmd.Options); err != nil {
 		return 1, err
 	}
-	storageConfiguration.Hashing = *hashingConfiguration
 
 	minEntropBits := 80.
 	if cmd.AllowWeak {
@@ -106,9 +119,7 @@ func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 	}
 
 	var hasher hash.Hash
-	if !cmd.NoEncryption {
-		storageConfiguration.Encryption = encryption.NewDefaultConfiguration()
-
+	if storageConfiguration.Encryption != nil {
 		var passphrase []byte
 
 		envPassphrase := os.Getenv("PLAKAR_PASSPHRASE")
@@ -146,7 +157,6 @@ func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		storageConfiguration.Encryption.Canary = canary
 		hasher = hashing.GetMACHasher(storage.DEFAULT_HASHING_ALGORITHM, key)
 	} else {
-		storageConfiguration.Encryption = nil
 		hasher = hashing.GetHasher(storage.DEFAULT_HASHING_ALGORITHM)
 	}
 
@@ -155,7 +165,7 @@ func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		return 1, err
 	}
 
-	rd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serializedConfig))
+	rd, err := storage.Serialize(hasher, resources.RT_CONFIG, storageConfiguration.FormatVersion(), bytes.NewReader(serializedConfig))
 	if err != nil {
 		return 1, err
 	}
@@ -5,9 +5,11 @@ import (
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
 	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
 	"github.com/creack/pty"
 	"github.com/stretchr/testify/require"
@@ -219,3 +221,66 @@ func TestExecuteCmdCreateDefaultWithEnvPassphrase(t *testing.T) {
 	_, err = os.Stat(fmt.Sprintf("%s/repo/CONFIG", tmpRepoDirRoot))
 	require.NoError(t, err)
 }
+
+func TestExecuteCmdCreatePreset(t *testing.T) {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	ctx := appcontext.NewAppContext()
+	defer ctx.Close()
+
+	// the configuration file picks the preset and overrides one of its
+	// settings, a flag overrides another one
+	repo, err := repository.Inexistent(ctx, map[string]string{
+		"location":  tmpRepoDirRoot + "/repo",
+		"preset":    "s3-archive",
+		"retention": "48h",
+	})
+	require.NoError(t, err)
+	ctx.HomeDir = tmpRepoDirRoot
+	args := []string{"--no-encryption", "--chunk-max", "32MiB"}
+
+	subcommand, err := parse_cmd_create(ctx, repo, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	data, err := os.ReadFile(fmt.Sprintf("%s/repo/CONFIG", tmpRepoDirRoot))
+	require.NoError(t, err)
+	config, err := storage.NewConfigurationFromWrappedBytes(data)
+	require.NoError(t, err)
+
+	require.Equal(t, uint32(256<<10), config.Chunking.MinSize)
+	require.Equal(t, uint32(4<<20), config.Chunking.NormalSize)
+	require.Equal(t, uint32(32<<20), config.Chunking.MaxSize)
+	require.Equal(t, "GZIP", config.Compression.Algorithm)
+	require.Equal(t, uint64(128<<20), config.Packfile.MaxSize)
+	require.Equal(t, 48*time.Hour, config.Retention)
+	require.Nil(t, config.Encryption)
+}
+
+func TestParseCmdCreateInvalidOptions(t *testing.T) {
+	ctx := appcontext.NewAppContext()
+	defer ctx.Close()
+
+	repo, err := repository.Inexistent(ctx, map[string]string{"location": t.TempDir() + "/repo"})
+	require.NoError(t, err)
+
+	for _, args := range [][]string{
+		{"--preset", "mainframe"},
+		{"--chunking", "RABIN"},
+		{"--chunk-min", "8MiB"},
+		{"--compression", "BROTLI"},
+		{"--encryption", "CHACHA20"},
+		{"--kdf", "MD5"},
+		{"--packfile-size", "1MiB"},
+		{"--retention", "forever"},
+	} {
+		_, err := parse_cmd_create(ctx, repo, args)
+		require.Error(t, err, args)
+	}
+}
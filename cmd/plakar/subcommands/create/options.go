@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package create
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/dustin/go-humanize"
+)
+
+// options are the settings of a new repository, which can be given as
+// flags or as keys of the repository in the configuration file.
+var options = []string{
+	"preset",
+	"chunking", "chunk-min", "chunk-avg", "chunk-max",
+	"compression", "hashing", "encryption", "kdf",
+	"packfile-size", "retention",
+}
+
+// presets are sets of options suited to common setups, overridden by
+// the options given explicitly.
+var presets = map[string]map[string]string{
+	// small chunks and packfiles for frequent backups over slow links
+	"laptop": {
+		"chunk-min":     "64KiB",
+		"chunk-avg":     "1MiB",
+		"chunk-max":     "4MiB",
+		"compression":   "LZ4",
+		"packfile-size": "20MiB",
+		"retention":     "720h",
+	},
+	// cheap compression for weak CPUs, larger packfiles on local disks
+	"nas": {
+		"chunk-min":     "128KiB",
+		"chunk-avg":     "2MiB",
+		"chunk-max":     "8MiB",
+		"compression":   "LZ4",
+		"packfile-size": "64MiB",
+		"retention":     "2160h",
+	},
+	// few large objects, as requests are billed, and a better ratio
+	"s3-archive": {
+		"chunk-min":     "256KiB",
+		"chunk-avg":     "4MiB",
+		"chunk-max":     "16MiB",
+		"compression":   "GZIP",
+		"packfile-size": "128MiB",
+		"retention":     "8760h",
+	},
+}
+
+func presetNames() string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// resolveOptions merges the preset, then the options of the configuration
+// file, then the flags, each overriding the previous ones.
+func resolveOptions(config map[string]string, flags map[string]string) (map[string]string, error) {
+	explicit := make(map[string]string)
+	for _, name := range options {
+		if value, ok := config[name]; ok {
+			explicit[name] = value
+		}
+	}
+	for name, value := range flags {
+		explicit[name] = value
+	}
+
+	resolved := make(map[string]string)
+	if name, ok := explicit["preset"]; ok {
+		preset, ok := presets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q, expected one of %s", name, presetNames())
+		}
+		for key, value := range preset {
+			resolved[key] = value
+		}
+	}
+	for key, value := range explicit {
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+func parseSize(name, value string) (uint64, error) {
+	size, err := humanize.ParseBytes(value)
+	if err != nil || size == 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return size, nil
+}
+
+// applyOptions writes the resolved options into configuration, the
+// encryption being set up unless disabled.
+func applyOptions(configuration *storage.Configuration, opts map[string]string) error {
+	if value, ok := opts["chunking"]; ok {
+		algorithm := strings.ToUpper(value)
+		if algorithm != "FASTCDC" && algorithm != "ULTRACDC" {
+			return fmt.Errorf("unknown chunking algorithm: %s", value)
+		}
+		configuration.Chunking.Algorithm = algorithm
+	}
+	for name, field := range map[string]*uint32{
+		"chunk-min": &configuration.Chunking.MinSize,
+		"chunk-avg": &configuration.Chunking.NormalSize,
+		"chunk-max": &configuration.Chunking.MaxSize,
+	} {
+		if value, ok := opts[name]; ok {
+			size, err := parseSize(name, value)
+			if err != nil {
+				return err
+			}
+			if size > 1<<30 {
+				return fmt.Errorf("invalid %s: %s is too large", name, value)
+			}
+			*field = uint32(size)
+		}
+	}
+	chunking := configuration.Chunking
+	if chunking.MinSize > chunking.NormalSize || chunking.NormalSize > chunking.MaxSize {
+		return fmt.Errorf("chunk sizes must satisfy chunk-min <= chunk-avg <= chunk-max")
+	}
+
+	if value, ok := opts["packfile-size"]; ok {
+		size, err := parseSize("packfile-size", value)
+		if err != nil {
+			return err
+		}
+		configuration.Packfile.MaxSize = size
+	}
+	if configuration.Packfile.MaxSize < uint64(chunking.MaxSize) {
+		return fmt.Errorf("packfile-size must be at least chunk-max")
+	}
+
+	if value, ok := opts["hashing"]; ok {
+		hashingConfiguration, err := hashing.LookupDefaultConfiguration(strings.ToUpper(value))
+		if err != nil {
+			return err
+		}
+		configuration.Hashing = *hashingConfiguration
+	}
+
+	if value, ok := opts["compression"]; ok {
+		if strings.EqualFold(value, "none") {
+			configuration.Compression = nil
+		} else {
+			compressionConfiguration, err := compression.LookupDefaultConfiguration(strings.ToUpper(value))
+			if err != nil {
+				return fmt.Errorf("unknown compression algorithm: %s", value)
+			}
+			configuration.Compression = compressionConfiguration
+		}
+	}
+
+	if value, ok := opts["encryption"]; ok {
+		if strings.EqualFold(value, "none") {
+			configuration.Encryption = nil
+		} else if configuration.Encryption != nil {
+			if strings.ToUpper(value) != configuration.Encryption.DataAlgorithm {
+				return fmt.Errorf("unsupported encryption algorithm: %s", value)
+			}
+		}
+	}
+	if value, ok := opts["kdf"]; ok && configuration.Encryption != nil {
+		kdfParams, err := encryption.NewDefaultKDFParams(strings.ToUpper(value))
+		if err != nil {
+			return err
+		}
+		configuration.Encryption.KDFParams = *kdfParams
+	}
+
+	if value, ok := opts["retention"]; ok {
+		retention, err := time.ParseDuration(value)
+		if err != nil || retention < 0 {
+			return fmt.Errorf("invalid retention: %s", value)
+		}
+		configuration.Retention = retention
+	}
+	return nil
+}
@@ -46,17 +46,17 @@ func (cmd *DiagPackfile) Execute(ctx *appcontext.AppContext, repo *repository.Re
 			var byteArray [32]byte
 			copy(byteArray[:], b)
 
-			p, err := repo.GetPackfile(byteArray)
+			footer, index, err := repo.GetPackfileIndex(byteArray)
 			if err != nil {
 				return 1, err
 			}
 
-			fmt.Fprintf(ctx.Stdout, "Version: %s\n", p.Footer.Version)
-			fmt.Fprintf(ctx.Stdout, "Timestamp: %s\n", time.Unix(0, p.Footer.Timestamp))
-			fmt.Fprintf(ctx.Stdout, "Index MAC: %x\n", p.Footer.IndexMAC)
+			fmt.Fprintf(ctx.Stdout, "Version: %s\n", footer.Version)
+			fmt.Fprintf(ctx.Stdout, "Timestamp: %s\n", time.Unix(0, footer.Timestamp))
+			fmt.Fprintf(ctx.Stdout, "Index MAC: %x\n", footer.IndexMAC)
 			fmt.Fprintln(ctx.Stdout)
 
-			for i, entry := range p.Index {
+			for i, entry := range index {
 				fmt.Fprintf(ctx.Stdout, "blob[%d]: %x %d %d %x %s\n", i, entry.MAC, entry.Offset, entry.Length, entry.Flags, entry.Type)
 			}
 		}
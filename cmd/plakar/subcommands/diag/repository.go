@@ -24,6 +24,9 @@ func (cmd *DiagRepository) Execute(ctx *appcontext.AppContext, repo *repository.
 	fmt.Fprintln(ctx.Stdout, "Version:", repo.Configuration().Version)
 	fmt.Fprintln(ctx.Stdout, "Timestamp:", repo.Configuration().Timestamp)
 	fmt.Fprintln(ctx.Stdout, "RepositoryID:", repo.Configuration().RepositoryID)
+	if repo.Configuration().Retention != 0 {
+		fmt.Fprintln(ctx.Stdout, "Retention:", repo.Configuration().Retention)
+	}
 
 	fmt.Fprintln(ctx.Stdout, "Packfile:")
 	fmt.Fprintf(ctx.Stdout, " - MaxSize: %s (%d bytes)\n",
@@ -60,6 +60,9 @@ func (cmd *DiagSnapshot) Execute(ctx *appcontext.AppContext, repo *repository.Re
 	fmt.Fprintf(ctx.Stdout, " - Type: %s\n", header.GetSource(0).Importer.Type)
 	fmt.Fprintf(ctx.Stdout, " - Origin: %s\n", header.GetSource(0).Importer.Origin)
 	fmt.Fprintf(ctx.Stdout, " - Directory: %s\n", header.GetSource(0).Importer.Directory)
+	if header.GetSource(0).Importer.File != "" {
+		fmt.Fprintf(ctx.Stdout, " - File: %s\n", header.GetSource(0).Importer.File)
+	}
 
 	fmt.Fprintln(ctx.Stdout, "Context:")
 	fmt.Fprintf(ctx.Stdout, " - MachineID: %s\n", header.GetContext("MachineID"))
@@ -79,6 +79,7 @@ func (cmd *DiagState) Execute(ctx *appcontext.AppContext, repo *repository.Repos
 			fmt.Fprintf(ctx.Stdout, "Version: %d.%d.%d\n", st.Metadata.Version/100, (st.Metadata.Version/10)%10, st.Metadata.Version%10)
 			fmt.Fprintf(ctx.Stdout, "Creation: %s\n", st.Metadata.Timestamp)
 			fmt.Fprintf(ctx.Stdout, "State serial: %s\n", st.Metadata.Serial)
+			fmt.Fprintf(ctx.Stdout, "Sequence: %d\n", st.Metadata.Sequence)
 
 			printBlobs := func(name string, Type resources.Type) {
 				for snapshot, err := range st.ListObjectsOfType(Type) {
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package diff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+// archiveFile is a regular file found in a reference archive.
+type archiveFile struct {
+	size int64
+	mac  objects.MAC
+}
+
+func archiveFileMAC(repo *repository.Repository, rd io.Reader) (objects.MAC, error) {
+	var mac objects.MAC
+
+	hasher := repo.GetMACHasher()
+	if _, err := io.Copy(hasher, rd); err != nil {
+		return mac, err
+	}
+	copy(mac[:], hasher.Sum(nil))
+	return mac, nil
+}
+
+// readArchive returns the regular files of a tar, gzipped tar or zip
+// archive keyed by their pathname below root, along with the MAC of their
+// content as computed by the repository, so that they can be compared to
+// the objects of a snapshot.
+func readArchive(repo *repository.Repository, filename string, root string) (map[string]archiveFile, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	rd := bufio.NewReader(fp)
+	magic, err := rd.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return readZip(repo, fp, root)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return readTar(repo, gz, root)
+	default:
+		return readTar(repo, rd, root)
+	}
+}
+
+func readTar(repo *repository.Repository, rd io.Reader, root string) (map[string]archiveFile, error) {
+	files := make(map[string]archiveFile)
+
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		mac, err := archiveFileMAC(repo, tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		files[path.Join(root, path.Clean("/"+hdr.Name))] = archiveFile{hdr.Size, mac}
+	}
+
+	return files, nil
+}
+
+func readZip(repo *repository.Repository, fp *os.File, root string) (map[string]archiveFile, error) {
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(fp, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]archiveFile)
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rd, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		mac, err := archiveFileMAC(repo, rd)
+		rd.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		files[path.Join(root, path.Clean("/"+f.Name))] = archiveFile{int64(f.UncompressedSize64), mac}
+	}
+
+	return files, nil
+}
+
+// diff_against compares the regular files below pathname in a snapshot to
+// the ones of a reference archive, by path, size and content MAC, and
+// returns the number of differences found.
+func diff_against(ctx *appcontext.AppContext, repo *repository.Repository, snap *snapshot.Snapshot, pathname string, archive string) (int, error) {
+	files, err := readArchive(repo, archive, pathname)
+	if err != nil {
+		return 0, fmt.Errorf("could not read archive %s: %w", archive, err)
+	}
+
+	pvfs, err := snap.Filesystem()
+	if err != nil {
+		return 0, err
+	}
+
+	compared := 0
+	differences := 0
+	for entry, err := range pvfs.Files(pathname) {
+		if err != nil {
+			return 0, err
+		}
+		if !entry.Stat().Mode().IsRegular() {
+			continue
+		}
+
+		filename := entry.Path()
+		reference, ok := files[filename]
+		if !ok {
+			fmt.Fprintf(ctx.Stdout, "only in snapshot: %s\n", filename)
+			differences++
+			continue
+		}
+		delete(files, filename)
+		compared++
+
+		if entry.Size() != reference.size {
+			fmt.Fprintf(ctx.Stdout, "size differs: %s (snapshot %d, archive %d)\n", filename, entry.Size(), reference.size)
+			differences++
+		} else if entry.ResolvedObject != nil && entry.ResolvedObject.ContentMAC != reference.mac {
+			fmt.Fprintf(ctx.Stdout, "content differs: %s\n", filename)
+			differences++
+		}
+	}
+
+	remaining := make([]string, 0, len(files))
+	for filename := range files {
+		remaining = append(remaining, filename)
+	}
+	slices.Sort(remaining)
+	for _, filename := range remaining {
+		fmt.Fprintf(ctx.Stdout, "only in archive: %s\n", filename)
+		differences++
+	}
+
+	fmt.Fprintf(ctx.Stderr, "diff: %d files compared, %d differences\n", compared, differences)
+	return differences, nil
+}
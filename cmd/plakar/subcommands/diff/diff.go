@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"strings"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
@@ -29,7 +30,6 @@ import (
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/alecthomas/chroma/quick"
-	"github.com/pmezard/go-difflib/difflib"
 )
 
 func init() {
@@ -38,16 +38,31 @@ func init() {
 
 func parse_cmd_diff(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
 	var opt_highlight bool
+	var opt_against string
 	flags := flag.NewFlagSet("diff", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT:PATH SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s -against ARCHIVE SNAPSHOT[:PATH]\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
 		flags.PrintDefaults()
 	}
 
 	flags.BoolVar(&opt_highlight, "highlight", false, "highlight output")
+	flags.StringVar(&opt_against, "against", "", "compare the snapshot to a tar, tar.gz or zip archive")
 	flags.Parse(args)
 
+	if opt_against != "" {
+		if flags.NArg() != 1 {
+			return nil, fmt.Errorf("-against needs a single snapshot to compare")
+		}
+		return &Diff{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			SnapshotPath1:      flags.Arg(0),
+			Against:            opt_against,
+		}, nil
+	}
+
 	if flags.NArg() != 2 {
 		return nil, fmt.Errorf("needs two snapshot ID and/or snapshot files to diff")
 	}
@@ -68,6 +83,7 @@ type Diff struct {
 	Highlight     bool
 	SnapshotPath1 string
 	SnapshotPath2 string
+	Against       string
 }
 
 func (cmd *Diff) Name() string {
@@ -75,143 +91,159 @@ func (cmd *Diff) Name() string {
 }
 
 func (cmd *Diff) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	repo.EnableNodeCache()
+
 	snap1, pathname1, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath1)
 	if err != nil {
 		return 1, fmt.Errorf("diff: could not open snapshot: %s", cmd.SnapshotPath1)
 	}
 	defer snap1.Close()
 
+	if cmd.Against != "" {
+		// archives hold paths relative to the directory they were made
+		// from, which defaults to the one the snapshot was taken of
+		if pathname1 == "" {
+			pathname1 = snap1.Header.GetSource(0).Importer.Directory
+		}
+		differences, err := diff_against(ctx, repo, snap1, pathname1, cmd.Against)
+		if err != nil {
+			return 1, fmt.Errorf("diff: %w", err)
+		}
+		if differences != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
 	snap2, pathname2, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath2)
 	if err != nil {
 		return 1, fmt.Errorf("diff: could not open snapshot: %s", cmd.SnapshotPath2)
 	}
 	defer snap2.Close()
 
-	var diff string
-	if pathname1 == "" && pathname2 == "" {
-		diff, err = diff_filesystems(ctx, snap1, snap2)
+	// the diff is streamed unless it needs to be highlighted whole
+	out := ctx.Stdout
+	var highlighted strings.Builder
+	if cmd.Highlight {
+		out = &highlighted
+	}
+
+	// snapshots opened without a path default to their root, so tell from
+	// the arguments whether a path was given
+	_, given1 := utils.ParseSnapshotPath(cmd.SnapshotPath1)
+	_, given2 := utils.ParseSnapshotPath(cmd.SnapshotPath2)
+
+	if given1 == "" && given2 == "" {
+		err = diff_filesystems(ctx, out, snap1, snap2)
 		if err != nil {
 			return 1, fmt.Errorf("diff: could not diff snapshots: %w", err)
 		}
 	} else {
-		if pathname1 == "" {
+		if given1 == "" {
 			pathname1 = pathname2
 		}
-		if pathname2 == "" {
+		if given2 == "" {
 			pathname2 = pathname1
 		}
-		diff, err = diff_pathnames(ctx, snap1, pathname1, snap2, pathname2)
+		err = diff_pathnames(ctx, out, snap1, pathname1, snap2, pathname2)
 		if err != nil {
 			return 1, fmt.Errorf("diff: could not diff pathnames: %w", err)
 		}
 	}
 
 	if cmd.Highlight {
-		err = quick.Highlight(ctx.Stdout, diff, "diff", "terminal", "dracula")
+		err = quick.Highlight(ctx.Stdout, highlighted.String(), "diff", "terminal", "dracula")
 		if err != nil {
 			return 1, fmt.Errorf("diff: could not highlight diff: %w", err)
 		}
-	} else {
-		fmt.Fprintf(ctx.Stdout, "%s", diff)
 	}
 	return 0, nil
 }
 
-func diff_filesystems(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot) (string, error) {
+func diff_filesystems(ctx *appcontext.AppContext, w io.Writer, snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot) error {
 	vfs1, err := snap1.Filesystem()
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	vfs2, err := snap2.Filesystem()
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	var f1, f2 *vfs.Entry
 	if f1, err = vfs1.GetEntry("/"); err != nil {
-		return "", err
+		return err
 	}
 	if f2, err = vfs2.GetEntry("/"); err != nil {
-		return "", err
+		return err
 	}
 
-	return diff_directories(ctx, f1, f2)
+	return diff_directories(ctx, w, f1, f2)
 }
 
-func diff_pathnames(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.Snapshot, pathname2 string) (string, error) {
+func diff_pathnames(ctx *appcontext.AppContext, w io.Writer, snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.Snapshot, pathname2 string) error {
 	vfs1, err := snap1.Filesystem()
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	vfs2, err := snap2.Filesystem()
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	var f1, f2 *vfs.Entry
 	if f1, err = vfs1.GetEntry(pathname1); err != nil {
-		return "", err
+		return err
 	}
 	if f2, err = vfs2.GetEntry(pathname2); err != nil {
-		return "", err
+		return err
 	}
 
 	if f1.Stat().IsDir() && f2.Stat().IsDir() {
-		return diff_directories(ctx, f1, f2)
+		return diff_directories(ctx, w, f1, f2)
 	}
 
 	if f1.Stat().IsDir() || f2.Stat().IsDir() {
-		return "", fmt.Errorf("can't diff different file types")
+		return fmt.Errorf("can't diff different file types")
 	}
 
-	return diff_files(ctx, snap1, f1, snap2, f2)
+	return diff_files(ctx, w, snap1, f1, snap2, f2)
 }
 
-func diff_directories(ctx *appcontext.AppContext, dirEntry1 *vfs.Entry, dirEntry2 *vfs.Entry) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+func diff_directories(ctx *appcontext.AppContext, w io.Writer, dirEntry1 *vfs.Entry, dirEntry2 *vfs.Entry) error {
+	return fmt.Errorf("not implemented yet")
 }
 
-func diff_files(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, fileEntry1 *vfs.Entry, snap2 *snapshot.Snapshot, fileEntry2 *vfs.Entry) (string, error) {
-	if fileEntry1.Object == fileEntry2.Object {
-		fmt.Fprintf(ctx.Stderr, "%s:%s and %s:%s are identical\n",
-			fmt.Sprintf("%x", snap1.Header.GetIndexShortID()), path.Join(fileEntry1.ParentPath, fileEntry1.Stat().Name()),
-			fmt.Sprintf("%x", snap2.Header.GetIndexShortID()), path.Join(fileEntry2.ParentPath, fileEntry2.Stat().Name()))
-		return "", nil
+// openFile returns a reader on the content of a file of the snapshot, or
+// on nothing if it has none, as is the case of metadata-only backups.
+func openFile(snap *snapshot.Snapshot, filename string) io.ReadCloser {
+	rd, err := snap.NewReader(filename)
+	if err != nil {
+		return io.NopCloser(strings.NewReader(""))
 	}
+	return rd
+}
 
+// diff_files writes the unified diff of two files, whose content is read
+// from the snapshots as the diff goes rather than restored first.
+func diff_files(ctx *appcontext.AppContext, w io.Writer, snap1 *snapshot.Snapshot, fileEntry1 *vfs.Entry, snap2 *snapshot.Snapshot, fileEntry2 *vfs.Entry) error {
 	filename1 := path.Join(fileEntry1.ParentPath, fileEntry1.Stat().Name())
 	filename2 := path.Join(fileEntry2.ParentPath, fileEntry2.Stat().Name())
+	label1 := fmt.Sprintf("%x", snap1.Header.GetIndexShortID()) + ":" + filename1
+	label2 := fmt.Sprintf("%x", snap2.Header.GetIndexShortID()) + ":" + filename2
 
-	buf1 := make([]byte, 0)
-	rd1, err := snap1.NewReader(filename1)
-	if err == nil {
-		buf1, err = io.ReadAll(rd1)
-		if err != nil {
-			return "", err
-		}
+	if fileEntry1.Object == fileEntry2.Object {
+		fmt.Fprintf(ctx.Stderr, "%s and %s are identical\n", label1, label2)
+		return nil
 	}
 
-	buf2 := make([]byte, 0)
-	rd2, err := snap2.NewReader(filename2)
-	if err == nil {
-		buf2, err = io.ReadAll(rd2)
-		if err != nil {
-			return "", err
-		}
-	}
+	rd1 := openFile(snap1, filename1)
+	defer rd1.Close()
 
-	diff := difflib.UnifiedDiff{
-		A:        difflib.SplitLines(string(buf1)),
-		B:        difflib.SplitLines(string(buf2)),
-		FromFile: fmt.Sprintf("%x", snap1.Header.GetIndexShortID()) + ":" + filename1,
-		ToFile:   fmt.Sprintf("%x", snap2.Header.GetIndexShortID()) + ":" + filename2,
-		Context:  3,
-	}
-	text, err := difflib.GetUnifiedDiffString(diff)
-	if err != nil {
-		return "", err
-	}
-	return text, nil
+	rd2 := openFile(snap2, filename2)
+	defer rd2.Close()
+
+	return writeUnifiedDiff(w, rd1, rd2, label1, label2)
 }
@@ -0,0 +1,230 @@
+package diff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+var backupFiles = map[string]string{
+	"subdir/dummy.txt":   "hello dummy",
+	"subdir/foo.txt":     "hello foo",
+	"another_subdir/bar": "hello bar",
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	// init temporary directories
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDir)
+		os.RemoveAll(tmpCacheDir)
+		os.RemoveAll(tmpBackupDir)
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	// create temporary files to backup
+	for name, content := range backupFiles {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(tmpBackupDir, name)), 0755)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(tmpBackupDir, name), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+
+	// create a storage
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NotNil(t, r)
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	err = r.Create(wrappedConfig)
+	require.NoError(t, err)
+
+	// open the storage to load the configuration
+	r, serializedConfig, err := storage.Open(map[string]string{"location": tmpRepoDir})
+	require.NoError(t, err)
+
+	// create a repository
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	cache := caching.NewManager(tmpCacheDir)
+	ctx.SetCache(cache)
+
+	logger := logging.NewLogger(bufOut, bufErr)
+	logger.EnableInfo()
+	ctx.SetLogger(logger)
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	return snap
+}
+
+func writeTarball(t *testing.T, files map[string]string) string {
+	filename := filepath.Join(t.TempDir(), "reference.tar.gz")
+	fp, err := os.Create(filename)
+	require.NoError(t, err)
+	defer fp.Close()
+
+	gz := gzip.NewWriter(fp)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return filename
+}
+
+func writeZip(t *testing.T, files map[string]string) string {
+	filename := filepath.Join(t.TempDir(), "reference.zip")
+	fp, err := os.Create(filename)
+	require.NoError(t, err)
+	defer fp.Close()
+
+	zw := zip.NewWriter(fp)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return filename
+}
+
+func TestExecuteCmdDiffAgainst(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	snapshotID := hex.EncodeToString(snap.Header.GetIndexShortID())
+
+	diff := func(archive string, snapshotPath string) int {
+		bufOut.Reset()
+		bufErr.Reset()
+
+		subcommand, err := parse_cmd_diff(ctx, repo, []string{"-against", archive, snapshotPath})
+		require.NoError(t, err)
+		require.Equal(t, "diff", subcommand.(*Diff).Name())
+
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		return status
+	}
+
+	// identical archives
+	require.Equal(t, 0, diff(writeTarball(t, backupFiles), snapshotID))
+	require.Empty(t, bufOut.String())
+	require.Contains(t, bufErr.String(), "3 files compared, 0 differences")
+
+	require.Equal(t, 0, diff(writeZip(t, backupFiles), snapshotID))
+	require.Empty(t, bufOut.String())
+
+	// diverging archive
+	root := snap.Header.GetSource(0).Importer.Directory
+	require.Equal(t, 1, diff(writeTarball(t, map[string]string{
+		"subdir/dummy.txt": "hello dummy",
+		"subdir/foo.txt":   "hello FOO",
+		"subdir/new.txt":   "hello new",
+	}), snapshotID))
+	require.Equal(t, fmt.Sprintf("only in snapshot: %s/another_subdir/bar\n", root)+
+		fmt.Sprintf("content differs: %s/subdir/foo.txt\n", root)+
+		fmt.Sprintf("only in archive: %s/subdir/new.txt\n", root), bufOut.String())
+
+	// the archive can be compared to a subdirectory
+	require.Equal(t, 1, diff(writeZip(t, map[string]string{"dummy.txt": "hello", "foo.txt": "hello foo"}), snapshotID+":"+root+"/subdir"))
+	require.Equal(t, fmt.Sprintf("size differs: %s/subdir/dummy.txt (snapshot 11, archive 5)\n", root), bufOut.String())
+
+	_, err := parse_cmd_diff(ctx, repo, []string{"-against", "reference.tar", snapshotID, snapshotID})
+	require.Error(t, err)
+}
+
+func TestExecuteCmdDiffFiles(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	snapshotID := hex.EncodeToString(snap.Header.GetIndexShortID())
+	root := snap.Header.GetSource(0).Importer.Directory
+
+	subcommand, err := parse_cmd_diff(ctx, repo, []string{snapshotID + ":" + root + "/subdir/dummy.txt", snapshotID + ":" + root + "/subdir/foo.txt"})
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Equal(t, fmt.Sprintf("--- %s:%s/subdir/dummy.txt\n", snapshotID, root)+
+		fmt.Sprintf("+++ %s:%s/subdir/foo.txt\n", snapshotID, root)+
+		"@@ -1 +1 @@\n"+
+		"-hello dummy\n\\ No newline at end of file\n"+
+		"+hello foo\n\\ No newline at end of file\n", bufOut.String())
+
+	// the path of the second snapshot defaults to that of the first
+	subcommand, err = parse_cmd_diff(ctx, repo, []string{snapshotID + ":" + root + "/subdir/foo.txt", snapshotID})
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	bufErr.Reset()
+	_, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Empty(t, bufOut.String())
+	require.Contains(t, bufErr.String(), "are identical")
+}
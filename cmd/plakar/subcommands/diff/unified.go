@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// binarySniffSize is how much of a file is looked at for a NUL byte to
+// tell binary files apart, as diff(1) and git do.
+const binarySniffSize = 8000
+
+func isBinary(rd *bufio.Reader) bool {
+	data, _ := rd.Peek(binarySniffSize)
+	return bytes.IndexByte(data, 0) != -1
+}
+
+func appendLine(lines []string, line string) []string {
+	if line == "" {
+		return lines
+	}
+	return append(lines, line)
+}
+
+// readLines appends the lines left in rd to lines.
+func readLines(rd *bufio.Reader, lines []string) ([]string, error) {
+	for {
+		line, err := rd.ReadString('\n')
+		lines = appendLine(lines, line)
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// formatRange formats a range of lines of a hunk header, first being the
+// index of its first line and count its number of lines.
+func formatRange(first, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", first)
+	case 1:
+		return fmt.Sprintf("%d", first+1)
+	default:
+		return fmt.Sprintf("%d,%d", first+1, count)
+	}
+}
+
+func writeLine(w *bufio.Writer, prefix string, line string) {
+	w.WriteString(prefix)
+	w.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// writeUnifiedDiff streams the unified diff of the content of rd1 and rd2
+// to w.  The lines both start with are compared as they are read and only
+// the last ones are kept for context, so that a file appended to, such as
+// a log, is not held in memory whole, the remainders going through the
+// difflib matcher.  Nothing is written if both contents are the same.
+func writeUnifiedDiff(w io.Writer, rd1, rd2 io.Reader, from, to string) error {
+	br1 := bufio.NewReaderSize(rd1, 64*1024)
+	br2 := bufio.NewReaderSize(rd2, 64*1024)
+
+	if isBinary(br1) || isBinary(br2) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", from, to)
+		return err
+	}
+
+	var leading []string
+	var line1, line2 string
+	skipped := 0
+	for {
+		var err1, err2 error
+		line1, err1 = br1.ReadString('\n')
+		if err1 != nil && err1 != io.EOF {
+			return err1
+		}
+		line2, err2 = br2.ReadString('\n')
+		if err2 != nil && err2 != io.EOF {
+			return err2
+		}
+
+		if line1 != line2 {
+			break
+		}
+		// a line without a newline can only be the last of both files
+		if err1 == io.EOF {
+			return nil
+		}
+
+		leading = append(leading, line1)
+		if len(leading) > diffContext {
+			leading = leading[1:]
+			skipped++
+		}
+	}
+
+	// the files diverge at line1 and line2, either of which is empty if
+	// its file ended
+	a, err := readLines(br1, appendLine(slices.Clone(leading), line1))
+	if err != nil {
+		return err
+	}
+	b, err := readLines(br2, appendLine(slices.Clone(leading), line2))
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "--- %s\n+++ %s\n", from, to)
+	for _, group := range difflib.NewMatcher(a, b).GetGroupedOpCodes(diffContext) {
+		first, last := group[0], group[len(group)-1]
+		fmt.Fprintf(bw, "@@ -%s +%s @@\n",
+			formatRange(skipped+first.I1, last.I2-first.I1),
+			formatRange(skipped+first.J1, last.J2-first.J1))
+
+		for _, op := range group {
+			if op.Tag == 'e' {
+				for _, line := range a[op.I1:op.I2] {
+					writeLine(bw, " ", line)
+				}
+				continue
+			}
+			if op.Tag == 'r' || op.Tag == 'd' {
+				for _, line := range a[op.I1:op.I2] {
+					writeLine(bw, "-", line)
+				}
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				for _, line := range b[op.J1:op.J2] {
+					writeLine(bw, "+", line)
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
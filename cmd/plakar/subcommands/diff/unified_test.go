@@ -0,0 +1,58 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func numberedLines(from, to int) string {
+	var sb strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	return sb.String()
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	diff := func(a, b string) string {
+		var buf bytes.Buffer
+		require.NoError(t, writeUnifiedDiff(&buf, strings.NewReader(a), strings.NewReader(b), "a", "b"))
+		return buf.String()
+	}
+
+	require.Empty(t, diff("", ""))
+	require.Empty(t, diff(numberedLines(1, 10), numberedLines(1, 10)))
+	require.Empty(t, diff("no newline", "no newline"))
+
+	// the lines skipped while streaming are accounted for in the hunks
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -98,3 +98,4 @@\n"+
+		" line 98\n line 99\n line 100\n+line 101\n",
+		diff(numberedLines(1, 100), numberedLines(1, 101)))
+
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -47,7 +47,7 @@\n"+
+		" line 47\n line 48\n line 49\n-line 50\n+line fifty\n line 51\n line 52\n line 53\n",
+		diff(numberedLines(1, 100), numberedLines(1, 49)+"line fifty\n"+numberedLines(51, 100)))
+
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -1,2 +1 @@\n"+
+		"-line 0\n line 1\n",
+		diff("line 0\nline 1\n", "line 1\n"))
+
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -0,0 +1 @@\n"+
+		"+line 1\n",
+		diff("", "line 1\n"))
+
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -1 +1 @@\n"+
+		"-line 1\n\\ No newline at end of file\n+line 1\n",
+		diff("line 1", "line 1\n"))
+
+	require.Equal(t, "Binary files a and b differ\n", diff("line 1\n", "\x00\x01"))
+}
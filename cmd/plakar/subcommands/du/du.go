@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package du
+
+import (
+	"flag"
+	"fmt"
+	"path"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("du", parse_cmd_du)
+}
+
+func parse_cmd_du(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_human bool
+	var opt_summarize bool
+	var opt_depth int
+
+	flags := flag.NewFlagSet("du", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT[:PATH]...\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(&opt_human, "h", false, "display sizes in human-readable format")
+	flags.BoolVar(&opt_summarize, "s", false, "only display a total for each argument")
+	flags.IntVar(&opt_depth, "d", -1, "only display directories up to `depth` levels below each argument")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		ctx.GetLogger().Error("%s: at least one parameter is required", flags.Name())
+		return nil, fmt.Errorf("at least one parameter is required")
+	}
+
+	if opt_summarize {
+		if opt_depth > 0 {
+			return nil, fmt.Errorf("-s and -d are mutually exclusive")
+		}
+		opt_depth = 0
+	}
+
+	return &Du{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Human:              opt_human,
+		Depth:              opt_depth,
+		Targets:            flags.Args(),
+	}, nil
+}
+
+type Du struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Human   bool
+	Depth   int
+	Targets []string
+}
+
+func (cmd *Du) Name() string {
+	return "du"
+}
+
+func (cmd *Du) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	errors := 0
+	for _, snapshotPath := range cmd.Targets {
+		snap, pathname, err := utils.OpenSnapshotByPath(repo, snapshotPath)
+		if err != nil {
+			ctx.GetLogger().Error("du: %s: %s", snapshotPath, err)
+			errors++
+			continue
+		}
+
+		fs, err := snap.Filesystem()
+		if err != nil {
+			ctx.GetLogger().Error("du: %s: %s", snapshotPath, err)
+			snap.Close()
+			errors++
+			continue
+		}
+
+		if pathname == "" {
+			pathname = "/"
+		}
+		if err := cmd.displayUsage(ctx, fs, pathname, 0); err != nil {
+			ctx.GetLogger().Error("du: %s: %s", snapshotPath, err)
+			errors++
+		}
+		snap.Close()
+	}
+
+	if errors != 0 {
+		return 1, fmt.Errorf("failed to compute disk usage for %d targets", errors)
+	}
+	return 0, nil
+}
+
+// displayUsage prints, deepest first as du(1) does, the usage of pathname
+// and of the directories below it.  It only relies on the summaries
+// computed at backup time and never reads file contents.
+func (cmd *Du) displayUsage(ctx *appcontext.AppContext, fs *vfs.Filesystem, pathname string, depth int) error {
+	entry, err := fs.GetEntry(pathname)
+	if err != nil {
+		return err
+	}
+
+	if !entry.IsDir() || entry.Summary == nil {
+		cmd.display(ctx, uint64(entry.Size()), pathname)
+		return nil
+	}
+
+	if cmd.Depth < 0 || depth < cmd.Depth {
+		iter, err := entry.Getdents(fs)
+		if err != nil {
+			return err
+		}
+		for child, err := range iter {
+			if err != nil {
+				return err
+			}
+			if !child.IsDir() {
+				continue
+			}
+			if err := cmd.displayUsage(ctx, fs, path.Join(pathname, child.Stat().Name()), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	cmd.display(ctx, entry.Summary.Directory.Size+entry.Summary.Below.Size, pathname)
+	return nil
+}
+
+func (cmd *Du) display(ctx *appcontext.AppContext, size uint64, pathname string) {
+	if cmd.Human {
+		fmt.Fprintf(ctx.Stdout, "%s\t%s\n", humanize.Bytes(size), pathname)
+	} else {
+		fmt.Fprintf(ctx.Stdout, "%d\t%s\n", size, pathname)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package enroll
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/identity"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func init() {
+	subcommands.Register("enroll", parse_cmd_enroll)
+}
+
+func parse_cmd_enroll(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_name string
+	var opt_issuer string
+
+	flags := flag.NewFlagSet("enroll", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] -issuer FINGERPRINT URL\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opt_name, "name", ctx.Hostname, "name of the identity, shown to the administrator")
+	flags.StringVar(&opt_issuer, "issuer", "", "fingerprint of the server issuer key, as logged by the server")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || opt_issuer == "" {
+		return nil, fmt.Errorf("usage: %s [OPTIONS] -issuer FINGERPRINT URL", flags.Name())
+	}
+
+	u, err := url.Parse(flags.Arg(0))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL: %s", flags.Arg(0))
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("refusing to enroll over %s, the server URL must be https", u.Scheme)
+	}
+
+	return &Enroll{
+		URL:          flags.Arg(0),
+		IdentityName: opt_name,
+		Issuer:       opt_issuer,
+	}, nil
+}
+
+type Enroll struct {
+	URL          string
+	IdentityName string
+	Issuer       string
+}
+
+func (cmd *Enroll) Name() string {
+	return "enroll"
+}
+
+func (cmd *Enroll) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	configDir, err := utils.GetConfigDir("plakar")
+	if err != nil {
+		return 1, err
+	}
+
+	id, err := identity.Load(configDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		if id, err = identity.New(cmd.IdentityName); err != nil {
+			return 1, err
+		}
+		if err := id.Save(configDir); err != nil {
+			return 1, err
+		}
+		fmt.Fprintf(ctx.Stdout, "generated identity %s\n", id.Identifier)
+	} else if err != nil {
+		return 1, fmt.Errorf("could not load identity: %w", err)
+	}
+
+	if id.Enrolled() {
+		fmt.Fprintf(ctx.Stdout, "identity %s is already enrolled\n", id.Identifier)
+		return 0, nil
+	}
+
+	client, err := submit(cmd.URL, id.Request(ctx.Hostname))
+	if err != nil {
+		return 1, err
+	}
+
+	switch client.Status {
+	case identity.StatusApproved:
+		if client.Certificate == nil {
+			return 1, fmt.Errorf("server approved %s without a certificate", id.Identifier)
+		}
+		if err := id.SetCertificate(client.Certificate, cmd.Issuer); err != nil {
+			return 1, err
+		}
+		if err := id.Save(configDir); err != nil {
+			return 1, err
+		}
+		fmt.Fprintf(ctx.Stdout, "identity %s enrolled, snapshots are now signed with it\n", id.Identifier)
+		return 0, nil
+
+	case identity.StatusRejected:
+		return 1, fmt.Errorf("enrollment of %s was rejected", id.Identifier)
+
+	default:
+		fmt.Fprintf(ctx.Stdout, "enrollment of %s is pending approval, run this command again once approved\n", id.Identifier)
+		return 0, nil
+	}
+}
+
+func submit(serverURL string, req *identity.Request) (*identity.Client, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(strings.TrimSuffix(serverURL, "/")+"/enroll", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("enrollment refused by server: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var res identity.Client
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/google/uuid"
+)
+
+const MANIFEST_VERSION = "1.0.0"
+
+const (
+	FILES_DIRECTORY  = "files"
+	PROOFS_DIRECTORY = "proofs"
+	MANIFEST         = "manifest.json"
+	SIGNATURE        = "manifest.sig"
+	CHECKSUMS        = "SHA256SUMS"
+)
+
+func init() {
+	subcommands.Register("export-evidence", parse_cmd_export_evidence)
+}
+
+func parse_cmd_export_evidence(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	if len(args) > 0 && args[0] == "verify" {
+		return parse_cmd_export_evidence_verify(ctx, args[1:])
+	}
+
+	var opt_output string
+
+	flags := flag.NewFlagSet("export-evidence", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT:PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s verify DIRECTORY\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opt_output, "output", "", "directory to create the package in")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("invalid parameter. usage: export-evidence [OPTIONS] snapshot:path")
+	}
+	if opt_output == "" {
+		return nil, fmt.Errorf("an output directory must be provided with -output")
+	}
+	if !filepath.IsAbs(opt_output) {
+		opt_output = filepath.Join(ctx.CWD, opt_output)
+	}
+
+	return &ExportEvidence{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		SnapshotPath:       flags.Arg(0),
+		Output:             opt_output,
+	}, nil
+}
+
+type ExportEvidence struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotPath string
+	Output       string
+}
+
+func (cmd *ExportEvidence) Name() string {
+	return "export-evidence"
+}
+
+// ManifestSnapshot identifies the snapshot the files were exported from.
+type ManifestSnapshot struct {
+	ID           objects.MAC `json:"id"`
+	RepositoryID uuid.UUID   `json:"repository_id"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Name         string      `json:"name,omitempty"`
+	Hostname     string      `json:"hostname,omitempty"`
+	Username     string      `json:"username,omitempty"`
+	// Identity which signed the snapshot at backup time, if any.
+	Identity uuid.UUID `json:"identity,omitempty"`
+	Signed   bool      `json:"signed"`
+	// Whether a timestamping authority vouched for the date of the
+	// snapshot, its receipt being part of the proofs.
+	Timestamped bool `json:"timestamped"`
+}
+
+// ManifestSigner identifies who produced the package, the public key
+// verifying the signature of the manifest.
+type ManifestSigner struct {
+	Identity  uuid.UUID `json:"identity"`
+	PublicKey []byte    `json:"public_key"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Username  string    `json:"username,omitempty"`
+}
+
+type ManifestFile struct {
+	Path       string      `json:"path"`
+	Size       int64       `json:"size"`
+	ModTime    time.Time   `json:"mtime"`
+	ContentMAC objects.MAC `json:"content_mac"`
+	SHA256     string      `json:"sha256"`
+	// Attestation of the file, relative to the package, as produced by
+	// plakar attest.
+	Proof string `json:"proof,omitempty"`
+}
+
+// Manifest describes the content of an evidence package, the chain of
+// custody going from the snapshot to the files through the signer.
+type Manifest struct {
+	Version  string           `json:"version"`
+	Created  time.Time        `json:"created"`
+	Path     string           `json:"path"`
+	Snapshot ManifestSnapshot `json:"snapshot"`
+	Signer   ManifestSigner   `json:"signer"`
+	Files    []ManifestFile   `json:"files"`
+}
+
+// exportFile writes the content of entry under the output directory,
+// checking it against the MAC recorded at backup time.
+func (cmd *ExportEvidence) exportFile(snap *snapshot.Snapshot, repo *repository.Repository, entry *vfs.Entry) (*ManifestFile, error) {
+	pathname := entry.Path()
+	file := &ManifestFile{
+		Path:    pathname,
+		Size:    entry.Size(),
+		ModTime: entry.Stat().ModTime().UTC(),
+	}
+
+	dest := filepath.Join(cmd.Output, FILES_DIRECTORY, filepath.FromSlash(pathname))
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return nil, err
+	}
+
+	rd, err := snap.NewReader(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	fp, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	sha := sha256.New()
+	mac := repo.GetMACHasher()
+	if _, err := io.Copy(io.MultiWriter(fp, sha, mac), rd); err != nil {
+		return nil, err
+	}
+	if err := fp.Close(); err != nil {
+		return nil, err
+	}
+	file.SHA256 = hex.EncodeToString(sha.Sum(nil))
+
+	// empty files have no object, hence nothing to attest
+	if entry.ResolvedObject == nil {
+		return file, nil
+	}
+	file.ContentMAC = entry.ResolvedObject.ContentMAC
+	if objects.MAC(mac.Sum(nil)) != file.ContentMAC {
+		return nil, fmt.Errorf("content does not match its MAC")
+	}
+
+	att, err := snap.Attest(pathname)
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := json.MarshalIndent(att, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	file.Proof = path.Join(PROOFS_DIRECTORY, pathname+".json")
+	proof := filepath.Join(cmd.Output, filepath.FromSlash(file.Proof))
+	if err := os.MkdirAll(filepath.Dir(proof), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(proof, append(serialized, '\n'), 0600); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (cmd *ExportEvidence) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if ctx.Keypair == nil {
+		return 1, fmt.Errorf("export-evidence: no identity to sign the manifest with, see plakar enroll")
+	}
+
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath)
+	if err != nil {
+		return 1, fmt.Errorf("export-evidence: could not open snapshot: %s", cmd.SnapshotPath)
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return 1, fmt.Errorf("export-evidence: %w", err)
+	}
+	root, err := fs.GetEntry(pathname)
+	if err != nil {
+		return 1, fmt.Errorf("export-evidence: %s: %w", pathname, err)
+	}
+
+	// never mix the package with existing files
+	if err := os.Mkdir(cmd.Output, 0700); err != nil {
+		return 1, fmt.Errorf("export-evidence: %w", err)
+	}
+
+	manifest := &Manifest{
+		Version: MANIFEST_VERSION,
+		Created: time.Now().UTC(),
+		Path:    pathname,
+		Snapshot: ManifestSnapshot{
+			ID:           snap.Header.Identifier,
+			RepositoryID: repo.Configuration().RepositoryID,
+			Timestamp:    snap.Header.Timestamp.UTC(),
+			Name:         snap.Header.Name,
+			Hostname:     snap.Header.GetContext("Hostname"),
+			Username:     snap.Header.GetContext("Username"),
+			Identity:     snap.Header.Identity.Identifier,
+			Signed:       snap.Header.Identity.Identifier != uuid.Nil,
+			Timestamped:  snap.HasTimestamp(),
+		},
+		Signer: ManifestSigner{
+			Identity:  ctx.Identity,
+			PublicKey: ctx.Keypair.PublicKey,
+			Hostname:  ctx.Hostname,
+			Username:  ctx.Username,
+		},
+		Files: []ManifestFile{},
+	}
+
+	export := func(entry *vfs.Entry) error {
+		file, err := cmd.exportFile(snap, repo, entry)
+		if err != nil {
+			return fmt.Errorf("export-evidence: %s: %w", entry.Path(), err)
+		}
+		manifest.Files = append(manifest.Files, *file)
+		return nil
+	}
+
+	if root.IsDir() {
+		for entry, err := range fs.Files(pathname) {
+			if err != nil {
+				return 1, fmt.Errorf("export-evidence: %w", err)
+			}
+			if !entry.Stat().Mode().IsRegular() {
+				continue
+			}
+			if err := export(entry); err != nil {
+				return 1, err
+			}
+		}
+	} else if root.Stat().Mode().IsRegular() {
+		if err := export(root); err != nil {
+			return 1, err
+		}
+	} else {
+		return 1, fmt.Errorf("export-evidence: %s: not a regular file nor a directory", pathname)
+	}
+
+	var sums strings.Builder
+	for _, file := range manifest.Files {
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, path.Join(FILES_DIRECTORY, file.Path))
+	}
+	if err := os.WriteFile(filepath.Join(cmd.Output, CHECKSUMS), []byte(sums.String()), 0600); err != nil {
+		return 1, fmt.Errorf("export-evidence: %w", err)
+	}
+
+	serialized, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 1, err
+	}
+	serialized = append(serialized, '\n')
+	if err := os.WriteFile(filepath.Join(cmd.Output, MANIFEST), serialized, 0600); err != nil {
+		return 1, fmt.Errorf("export-evidence: %w", err)
+	}
+
+	// the signature covers the manifest as written, byte for byte
+	signature := base64.StdEncoding.EncodeToString(ctx.Keypair.Sign(serialized)) + "\n"
+	if err := os.WriteFile(filepath.Join(cmd.Output, SIGNATURE), []byte(signature), 0600); err != nil {
+		return 1, fmt.Errorf("export-evidence: %w", err)
+	}
+
+	if !manifest.Snapshot.Signed {
+		ctx.GetLogger().Warn("export-evidence: snapshot %x is not signed", snap.Header.GetIndexShortID())
+	}
+	ctx.GetLogger().Info("export-evidence: %d files of %x:%s exported to %s",
+		len(manifest.Files), snap.Header.GetIndexShortID(), pathname, cmd.Output)
+	return 0, nil
+}
@@ -0,0 +1,198 @@
+package evidence
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	// init temporary directories
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDir)
+		os.RemoveAll(tmpCacheDir)
+		os.RemoveAll(tmpBackupDir)
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	// create temporary files to backup
+	err = os.MkdirAll(tmpBackupDir+"/subdir", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll(tmpBackupDir+"/another_subdir", 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/dummy.txt", []byte("hello dummy"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/foo.txt", []byte("hello foo"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/another_subdir/bar.txt", []byte("hello bar"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/empty", nil, 0644)
+	require.NoError(t, err)
+
+	// create a storage
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NotNil(t, r)
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	err = r.Create(wrappedConfig)
+	require.NoError(t, err)
+
+	// open the storage to load the configuration
+	r, serializedConfig, err := storage.Open(map[string]string{"location": tmpRepoDir})
+	require.NoError(t, err)
+
+	// create a repository
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	cache := caching.NewManager(tmpCacheDir)
+	ctx.SetCache(cache)
+
+	// Create a new logger
+	logger := logging.NewLogger(bufOut, bufErr)
+	logger.EnableInfo()
+	ctx.SetLogger(logger)
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	err = snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+	require.NoError(t, err)
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	return snap
+}
+
+func TestExecuteCmdExportEvidence(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.CWD = t.TempDir()
+
+	kp, err := keypair.Generate()
+	require.NoError(t, err)
+	ctx.Identity = uuid.New()
+	ctx.Keypair = kp
+
+	subdir := snap.Header.GetSource(0).Importer.Directory + "/subdir"
+	args := []string{"-output", "evidence", fmt.Sprintf("%s:%s", hex.EncodeToString(snap.Header.GetIndexShortID()), subdir)}
+
+	subcommand, err := parse_cmd_export_evidence(ctx, snap.Repository(), args)
+	require.NoError(t, err)
+	require.Equal(t, "export-evidence", subcommand.(*ExportEvidence).Name())
+
+	status, err := subcommand.Execute(ctx, snap.Repository())
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output := filepath.Join(ctx.CWD, "evidence")
+	data, err := os.ReadFile(filepath.Join(output, MANIFEST))
+	require.NoError(t, err)
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, snap.Header.Identifier, manifest.Snapshot.ID)
+	require.Equal(t, ctx.Identity, manifest.Signer.Identity)
+	require.Len(t, manifest.Files, 3)
+
+	content, err := os.ReadFile(filepath.Join(output, FILES_DIRECTORY, subdir, "dummy.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello dummy", string(content))
+	for _, file := range manifest.Files {
+		require.FileExists(t, filepath.Join(output, file.Proof))
+	}
+
+	// exporting again into the same directory is refused
+	status, err = subcommand.Execute(ctx, snap.Repository())
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+
+	verify, err := parse_cmd_export_evidence(ctx, nil, []string{"verify", "evidence"})
+	require.NoError(t, err)
+	status, err = verify.Execute(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// tampering with a file is detected
+	err = os.WriteFile(filepath.Join(output, FILES_DIRECTORY, subdir, "dummy.txt"), []byte("tampered"), 0600)
+	require.NoError(t, err)
+	status, err = verify.Execute(ctx, nil)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+
+	// as is tampering with the manifest
+	manifest.Path = "/elsewhere"
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(output, MANIFEST), data, 0600))
+	_, _, err = verify.(*ExportEvidenceVerify).verify()
+	require.ErrorContains(t, err, "invalid manifest signature")
+}
+
+func TestExecuteCmdExportEvidenceWithoutIdentity(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.CWD = t.TempDir()
+
+	args := []string{"-output", "evidence", hex.EncodeToString(snap.Header.GetIndexShortID())}
+	subcommand, err := parse_cmd_export_evidence(ctx, snap.Repository(), args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, snap.Repository())
+	require.ErrorContains(t, err, "no identity")
+	require.Equal(t, 1, status)
+	require.NoDirExists(t, filepath.Join(ctx.CWD, "evidence"))
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package evidence
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func parse_cmd_export_evidence_verify(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("export-evidence verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s DIRECTORY\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("invalid parameter. usage: export-evidence verify directory")
+	}
+
+	cmd := &ExportEvidenceVerify{
+		Directory: flags.Arg(0),
+	}
+	if !filepath.IsAbs(cmd.Directory) {
+		cmd.Directory = filepath.Join(ctx.CWD, cmd.Directory)
+	}
+	return cmd, nil
+}
+
+// ExportEvidenceVerify checks an evidence package offline, it is executed
+// before any repository is opened.
+type ExportEvidenceVerify struct {
+	Directory string
+}
+
+func (cmd *ExportEvidenceVerify) Name() string {
+	return "export-evidence_verify"
+}
+
+func sha256File(filename string) (string, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// verify checks the signature of the manifest, then the files of the
+// package against it, returning the problems found.
+func (cmd *ExportEvidenceVerify) verify() (*Manifest, []string, error) {
+	serialized, err := os.ReadFile(filepath.Join(cmd.Directory, MANIFEST))
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := os.ReadFile(filepath.Join(cmd.Directory, SIGNATURE))
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(serialized, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version != MANIFEST_VERSION {
+		return nil, nil, fmt.Errorf("unsupported manifest version %q", manifest.Version)
+	}
+	if len(manifest.Signer.PublicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(manifest.Signer.PublicKey, serialized, signature) {
+		return nil, nil, fmt.Errorf("invalid manifest signature")
+	}
+
+	var problems []string
+	listed := make(map[string]struct{})
+	for _, file := range manifest.Files {
+		pathname := path.Clean("/" + file.Path)
+		listed[pathname] = struct{}{}
+
+		sum, err := sha256File(filepath.Join(cmd.Directory, FILES_DIRECTORY, filepath.FromSlash(pathname)))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", pathname, err))
+		} else if sum != file.SHA256 {
+			problems = append(problems, fmt.Sprintf("%s: content was modified", pathname))
+		}
+
+		if file.Proof != "" {
+			proof := path.Clean("/" + file.Proof)
+			if _, err := os.Stat(filepath.Join(cmd.Directory, filepath.FromSlash(proof))); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: proof: %s", pathname, err))
+			}
+		}
+	}
+
+	// files added to the package are not covered by the manifest
+	root := filepath.Join(cmd.Directory, FILES_DIRECTORY)
+	err = filepath.WalkDir(root, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filename)
+		if err != nil {
+			return err
+		}
+		pathname := "/" + filepath.ToSlash(rel)
+		if _, ok := listed[pathname]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: not part of the manifest", pathname))
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	return &manifest, problems, nil
+}
+
+func (cmd *ExportEvidenceVerify) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	manifest, problems, err := cmd.verify()
+	if err != nil {
+		return 1, fmt.Errorf("export-evidence: verification failed: %w", err)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "SnapshotID: %x\n", manifest.Snapshot.ID)
+	fmt.Fprintf(ctx.Stdout, "Timestamp: %s\n", manifest.Snapshot.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(ctx.Stdout, "Path: %s\n", manifest.Path)
+	fmt.Fprintf(ctx.Stdout, "Created: %s\n", manifest.Created.Format(time.RFC3339))
+	fmt.Fprintln(ctx.Stdout, "Signer:")
+	fmt.Fprintf(ctx.Stdout, " - Identifier: %s\n", manifest.Signer.Identity)
+	fmt.Fprintf(ctx.Stdout, " - PublicKey: %s\n", base64.RawStdEncoding.EncodeToString(manifest.Signer.PublicKey))
+	fmt.Fprintf(ctx.Stdout, "Files: %d\n", len(manifest.Files))
+
+	for _, problem := range problems {
+		ctx.GetLogger().Warn("export-evidence: %s", problem)
+	}
+	if len(problems) != 0 {
+		return 1, fmt.Errorf("export-evidence: verification failed: %d problems found", len(problems))
+	}
+	if !manifest.Snapshot.Signed {
+		ctx.GetLogger().Warn("export-evidence: snapshot is not signed, the proofs only hold for whoever knows the repository key")
+	}
+	ctx.GetLogger().Info("export-evidence: package is valid")
+	return 0, nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package grant
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/grant"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func init() {
+	subcommands.Register("grant", parse_cmd_grant)
+}
+
+func parse_cmd_grant(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_validity time.Duration
+
+	flags := flag.NewFlagSet("grant", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.DurationVar(&opt_validity, "validity", 24*time.Hour, "duration after which the grant expires")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("usage: grant [-validity duration] snapshot[:path]")
+	}
+	if opt_validity <= 0 || opt_validity > grant.MaxValidity {
+		return nil, fmt.Errorf("-validity must be positive and at most %s", grant.MaxValidity)
+	}
+	if ctx.GetSecret() == nil {
+		return nil, grant.ErrNoSecret
+	}
+
+	return &Grant{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Snapshot:           flags.Arg(0),
+		Validity:           opt_validity,
+	}, nil
+}
+
+type Grant struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Snapshot string
+	Validity time.Duration
+}
+
+func (cmd *Grant) Name() string {
+	return "grant"
+}
+
+func (cmd *Grant) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.Snapshot)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return 1, err
+	}
+	if _, err := fs.GetEntry(pathname); err != nil {
+		return 1, fmt.Errorf("%s: %w", pathname, err)
+	}
+
+	token, g, err := grant.Mint(repo, snap.Header.Identifier, pathname, cmd.Validity)
+	if err != nil {
+		return 1, err
+	}
+
+	ctx.GetLogger().Info("grant: %x:%s until %s", g.SnapshotID[:4], g.Path, g.Expires.Format(time.RFC3339))
+	fmt.Fprintln(ctx.Stdout, token)
+	return 0, nil
+}
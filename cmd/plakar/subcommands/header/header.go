@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package header
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("header", parse_cmd_header)
+}
+
+func parse_cmd_header(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("header", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import [FILE...]\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 || flags.Arg(0) != "import" {
+		return nil, fmt.Errorf("usage: header import [file...]")
+	}
+
+	// Headers are read here, as the command may be executed by the agent
+	// which has no access to our standard input.
+	var exports []*snapshot.HeaderExport
+	read := func(rd io.Reader, name string) error {
+		decoder := json.NewDecoder(rd)
+		for {
+			var export snapshot.HeaderExport
+			if err := decoder.Decode(&export); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			exports = append(exports, &export)
+		}
+	}
+
+	if flags.NArg() == 1 {
+		if err := read(os.Stdin, "stdin"); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range flags.Args()[1:] {
+		fp, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		err = read(fp, name)
+		fp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(exports) == 0 {
+		return nil, fmt.Errorf("no header to import")
+	}
+
+	return &HeaderImport{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Headers:            exports,
+	}, nil
+}
+
+type HeaderImport struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Headers []*snapshot.HeaderExport
+}
+
+func (cmd *HeaderImport) Name() string {
+	return "header_import"
+}
+
+func (cmd *HeaderImport) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	errors := 0
+	for _, export := range cmd.Headers {
+		snapshotID, err := snapshot.ImportHeader(repo, export)
+		if err != nil {
+			if export.Header != nil {
+				ctx.GetLogger().Error("header: %x: %s", export.Header.GetIndexShortID(), err)
+			} else {
+				ctx.GetLogger().Error("header: %s", err)
+			}
+			errors++
+			continue
+		}
+
+		fmt.Fprintf(ctx.Stdout, "header: imported snapshot %x\n", snapshotID[:4])
+	}
+
+	if errors != 0 {
+		return 1, fmt.Errorf("failed to import %d headers", errors)
+	}
+	return 0, nil
+}
@@ -0,0 +1,59 @@
+package info
+
+import (
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+type InfoEntropy struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotID     string
+	Threshold      float64
+	DeltaThreshold float64
+}
+
+func (cmd *InfoEntropy) Name() string {
+	return "info_entropy"
+}
+
+func (cmd *InfoEntropy) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, _, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotID)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	prev, err := snap.Previous()
+	if err != nil {
+		return 1, err
+	}
+	if prev != nil {
+		defer prev.Close()
+	}
+
+	report, err := snap.Entropy(prev, &snapshot.EntropyOptions{
+		Threshold:      cmd.Threshold,
+		DeltaThreshold: cmd.DeltaThreshold,
+	})
+	if err != nil {
+		return 1, err
+	}
+
+	if prev != nil {
+		fmt.Fprintf(ctx.Stdout, "Previous: %x\n", prev.Header.GetIndexShortID())
+	}
+	for _, entry := range report {
+		if entry.HasPrevious {
+			fmt.Fprintf(ctx.Stdout, "%.4f %+.4f %d/%d %s\n", entry.AvgEntropy, entry.Delta, entry.HiEntropy, entry.Files, entry.Path)
+		} else {
+			fmt.Fprintf(ctx.Stdout, "%.4f %7s %d/%d %s\n", entry.AvgEntropy, "new", entry.HiEntropy, entry.Files, entry.Path)
+		}
+	}
+	return 0, nil
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
 )
 
 func init() {
@@ -38,12 +39,38 @@ func parse_cmd_info(ctx *appcontext.AppContext, repo *repository.Repository, arg
 		}, nil
 	}
 
+	if args[0] == "entropy" {
+		return parse_cmd_info_entropy(ctx, repo, args[1:])
+	}
+
+	var opt_verifySignature bool
+	var opt_clients string
+	var opt_format string
+	var opt_full bool
+
 	flags := flag.NewFlagSet("info", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s [SNAPSHOT]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] [SNAPSHOT]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s entropy [OPTIONS] SNAPSHOT\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
 	}
+	flags.BoolVar(&opt_verifySignature, "verify-signature", false, "verify the signature of the snapshot and describe its signer")
+	flags.StringVar(&opt_clients, "clients", "", "directory holding the enrollment requests, defaults to the configuration directory")
+	flags.StringVar(&opt_format, "format", "text", "output format of the snapshot header: text or json")
+	flags.BoolVar(&opt_full, "full", false, "include the signature and timestamp of the snapshot in the json output")
 	flags.Parse(args)
 
+	if opt_format != "text" && opt_format != "json" {
+		return nil, fmt.Errorf("unsupported format: %s", opt_format)
+	}
+	if opt_full && opt_format != "json" {
+		return nil, fmt.Errorf("-full requires -format json")
+	}
+	if opt_verifySignature && opt_format != "text" {
+		return nil, fmt.Errorf("-verify-signature can't be used with -format json")
+	}
+
 	if len(flags.Args()) > 1 {
 		return nil, fmt.Errorf("invalid parameter. usage: info [snapshot]")
 	}
@@ -60,9 +87,50 @@ func parse_cmd_info(ctx *appcontext.AppContext, repo *repository.Repository, arg
 		}, nil
 	}
 
+	if opt_verifySignature && opt_clients == "" {
+		clientsDir, err := utils.GetClientsDir()
+		if err != nil {
+			return nil, err
+		}
+		opt_clients = clientsDir
+	}
+
 	return &InfoSnapshot{
 		RepositoryLocation: repo.Location(),
 		RepositorySecret:   ctx.GetSecret(),
 		SnapshotID:         flags.Args()[0],
+		VerifySignature:    opt_verifySignature,
+		ClientsDir:         opt_clients,
+		Format:             opt_format,
+		Full:               opt_full,
+	}, nil
+}
+
+func parse_cmd_info_entropy(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	defaults := snapshot.NewDefaultEntropyOptions()
+
+	var opt_threshold float64
+	var opt_delta float64
+
+	flags := flag.NewFlagSet("info entropy", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.Float64Var(&opt_threshold, "threshold", defaults.Threshold, "report directories with an average entropy above this value")
+	flags.Float64Var(&opt_delta, "delta", defaults.DeltaThreshold, "report directories whose average entropy changed by more than this value since the previous snapshot")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("invalid parameter. usage: info entropy [OPTIONS] snapshot")
+	}
+
+	return &InfoEntropy{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		SnapshotID:         flags.Arg(0),
+		Threshold:          opt_threshold,
+		DeltaThreshold:     opt_delta,
 	}, nil
 }
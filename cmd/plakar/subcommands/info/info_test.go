@@ -3,6 +3,7 @@ package info
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -10,7 +11,9 @@ import (
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/encryption/keypair"
 	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/identity"
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
@@ -20,6 +23,7 @@ import (
 	"github.com/PlakarKorp/plakar/storage"
 	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
 	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,6 +32,11 @@ func init() {
 }
 
 func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return generateSignedSnapshot(t, bufOut, bufErr, nil)
+}
+
+// generateSignedSnapshot signs the snapshot with keyPair, unless nil.
+func generateSignedSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer, keyPair *keypair.KeyPair) *snapshot.Snapshot {
 	// init temporary directories
 	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
 	require.NoError(t, err)
@@ -84,6 +93,10 @@ func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer)
 	ctx.Stderr = bufErr
 	cache := caching.NewManager(tmpCacheDir)
 	ctx.SetCache(cache)
+	if keyPair != nil {
+		ctx.Identity = uuid.New()
+		ctx.Keypair = keyPair
+	}
 
 	// Create a new logger
 	logger := logging.NewLogger(bufOut, bufErr)
@@ -249,6 +262,119 @@ func TestExecuteCmdInfoSnapshot(t *testing.T) {
 	require.Contains(t, output, "Files: 4")
 	require.Contains(t, output, fmt.Sprintf("Directory: %s", snap.Header.GetSource(0).Importer.Directory))
 	require.Contains(t, output, fmt.Sprintf("SnapshotID: %s", hex.EncodeToString(indexId[:])))
+	require.Contains(t, output, "FileKind:")
+	require.Contains(t, output, " - text: 4 (100.00%)")
+	require.Contains(t, output, "ScannedSize: 49 B (49 bytes)")
+	require.Contains(t, output, "CacheMisses: 4")
+}
+
+func TestExecuteCmdInfoSnapshotVerifySignature(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	keyPair, err := keypair.Generate()
+	require.NoError(t, err)
+	snap := generateSignedSnapshot(t, bufOut, bufErr, keyPair)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	clientsDir := t.TempDir()
+	args := []string{"-verify-signature", "-clients", clientsDir, hex.EncodeToString(indexId[:])}
+
+	// signed by this host
+	subcommand, err := parse_cmd_info(ctx, repo, args)
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output := bufOut.String()
+	require.Contains(t, output, "Signature:\n - Signed: true\n")
+	require.Contains(t, output, fmt.Sprintf(" - Signer: %s\n", ctx.Identity))
+	require.Contains(t, output, fmt.Sprintf(" - Fingerprint: %s\n", identity.Fingerprint(keyPair.PublicKey)))
+	require.Contains(t, output, " - Valid: true\n")
+	require.Contains(t, output, " - Trust: self\n")
+
+	// seen from another host, the signer is unknown until enrolled
+	signer := ctx.Identity
+	ctx.Identity = uuid.Nil
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.ErrorContains(t, err, "signer is not trusted: unknown")
+	require.Equal(t, 1, status)
+	require.Contains(t, bufOut.String(), " - Valid: true\n")
+
+	registry, err := identity.OpenRegistry(clientsDir)
+	require.NoError(t, err)
+	id := &identity.Identity{Identifier: signer, Name: "laptop", KeyPair: keyPair}
+	_, err = registry.Submit(id.Request("laptop.example.org"))
+	require.NoError(t, err)
+	_, err = registry.Approve(signer)
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), " - Name: laptop\n")
+	require.Contains(t, bufOut.String(), " - Trust: approved\n")
+}
+
+func TestExecuteCmdInfoSnapshotVerifySignatureUnsigned(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+
+	subcommand, err := parse_cmd_info(ctx, repo, []string{"-verify-signature", "-clients", t.TempDir(), hex.EncodeToString(indexId[:])})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.ErrorContains(t, err, "not signed")
+	require.Equal(t, 1, status)
+	require.Contains(t, bufOut.String(), "Signature:\n - Signed: false\n")
+}
+
+func TestExecuteCmdInfoSnapshotJSON(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+
+	_, err := parse_cmd_info(ctx, repo, []string{"-full", hex.EncodeToString(indexId[:])})
+	require.ErrorContains(t, err, "-full requires -format json")
+
+	subcommand, err := parse_cmd_info(ctx, repo, []string{"-format", "json", "-full", hex.EncodeToString(indexId[:])})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var export snapshot.HeaderExport
+	require.NoError(t, json.Unmarshal(bufOut.Bytes(), &export))
+	require.Equal(t, snap.Header.Identifier, export.Header.Identifier)
+	require.Equal(t, snap.Header.GetSource(0).VFS.Root, export.Header.GetSource(0).VFS.Root)
+	require.Nil(t, export.Signature)
 }
 
 func TestExecuteCmdInfoSnapshotPath(t *testing.T) {
@@ -301,3 +427,35 @@ func TestExecuteCmdInfoSnapshotPath(t *testing.T) {
 	require.Contains(t, output, "[FileEntry]")
 	require.Contains(t, output, "Name: dummy.txt")
 }
+
+func TestExecuteCmdInfoEntropy(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"entropy", "-threshold", "0", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_info(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	// 3.1245     new 0/2 /tmp/tmp_to_backup3285582724/subdir
+
+	output := bufOut.String()
+	require.Contains(t, output, "new")
+	require.Contains(t, output, "subdir")
+}
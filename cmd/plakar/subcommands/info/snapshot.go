@@ -1,15 +1,22 @@
 package info
 
 import (
+	"crypto/ed25519"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/identity"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/dustin/go-humanize"
 	"github.com/google/uuid"
 )
@@ -19,6 +26,17 @@ type InfoSnapshot struct {
 	RepositorySecret   []byte
 
 	SnapshotID string
+
+	// VerifySignature checks the signature of the snapshot, the signer
+	// being looked up in the enrollment requests kept in ClientsDir.
+	VerifySignature bool
+	ClientsDir      string
+
+	// Format is either text or json, the latter printing the header as
+	// read by plakar header import, with its signature and timestamp
+	// token if Full is set.
+	Format string
+	Full   bool
 }
 
 func (cmd *InfoSnapshot) Name() string {
@@ -32,6 +50,17 @@ func (cmd *InfoSnapshot) Execute(ctx *appcontext.AppContext, repo *repository.Re
 	}
 	defer snap.Close()
 
+	if cmd.Format == "json" {
+		export, err := snap.ExportHeader(cmd.Full)
+		if err != nil {
+			return 1, err
+		}
+		if err := json.NewEncoder(ctx.Stdout).Encode(export); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
 	header := snap.Header
 
 	indexID := header.GetIndexID()
@@ -47,6 +76,12 @@ func (cmd *InfoSnapshot) Execute(ctx *appcontext.AppContext, repo *repository.Re
 	if len(header.Tags) > 0 {
 		fmt.Fprintf(ctx.Stdout, "Tags: %s\n", strings.Join(header.Tags, ", "))
 	}
+	if header.MetadataOnly {
+		fmt.Fprintln(ctx.Stdout, "MetadataOnly: true")
+	}
+	if header.Synthetic != (objects.MAC{}) {
+		fmt.Fprintf(ctx.Stdout, "Synthetic: %x\n", header.Synthetic)
+	}
 
 	if header.Identity.Identifier != uuid.Nil {
 		fmt.Fprintln(ctx.Stdout, "Identity:")
@@ -54,12 +89,42 @@ func (cmd *InfoSnapshot) Execute(ctx *appcontext.AppContext, repo *repository.Re
 		fmt.Fprintf(ctx.Stdout, " - PublicKey: %s\n", base64.RawStdEncoding.EncodeToString(header.Identity.PublicKey))
 	}
 
+	var signatureErr error
+	if cmd.VerifySignature {
+		signatureErr = cmd.printSignature(ctx, snap)
+	}
+
+	if snap.HasTimestamp() {
+		fmt.Fprintln(ctx.Stdout, "Proof of existence:")
+		if receipt, err := snap.VerifyTimestamp(); err != nil {
+			fmt.Fprintf(ctx.Stdout, " - Error: %s\n", err)
+		} else {
+			fmt.Fprintf(ctx.Stdout, " - Time: %s\n", receipt.Time.UTC().Format(time.RFC3339))
+			fmt.Fprintf(ctx.Stdout, " - Authority: %s\n", receipt.Signer.Subject)
+			fmt.Fprintf(ctx.Stdout, " - SerialNumber: %s\n", receipt.SerialNumber)
+			fmt.Fprintf(ctx.Stdout, " - Trusted: %t\n", receipt.Trusted)
+		}
+	}
+
 	fmt.Fprintf(ctx.Stdout, "VFS: %x\n", header.GetSource(0).VFS)
 
 	fmt.Fprintln(ctx.Stdout, "Importer:")
 	fmt.Fprintf(ctx.Stdout, " - Type: %s\n", header.GetSource(0).Importer.Type)
 	fmt.Fprintf(ctx.Stdout, " - Origin: %s\n", header.GetSource(0).Importer.Origin)
 	fmt.Fprintf(ctx.Stdout, " - Directory: %s\n", header.GetSource(0).Importer.Directory)
+	if header.GetSource(0).Importer.File != "" {
+		fmt.Fprintf(ctx.Stdout, " - File: %s\n", header.GetSource(0).Importer.File)
+	}
+
+	stats := header.GetSource(0).Stats
+	fmt.Fprintln(ctx.Stdout, "Stats:")
+	fmt.Fprintf(ctx.Stdout, " - ScannedSize: %s (%d bytes)\n", humanize.Bytes(stats.ScannedSize), stats.ScannedSize)
+	fmt.Fprintf(ctx.Stdout, " - TransferredSize: %s (%d bytes)\n", humanize.Bytes(stats.TransferredSize), stats.TransferredSize)
+	if seconds := header.Duration.Seconds(); seconds > 0 {
+		fmt.Fprintf(ctx.Stdout, " - Throughput: %s/s\n", humanize.Bytes(uint64(float64(stats.ScannedSize)/seconds)))
+	}
+	fmt.Fprintf(ctx.Stdout, " - CacheHits: %d\n", stats.CacheHits)
+	fmt.Fprintf(ctx.Stdout, " - CacheMisses: %d\n", stats.CacheMisses)
 
 	fmt.Fprintln(ctx.Stdout, "Context:")
 	fmt.Fprintf(ctx.Stdout, " - MachineID: %s\n", header.GetContext("MachineID"))
@@ -103,5 +168,97 @@ func (cmd *InfoSnapshot) Execute(ctx *appcontext.AppContext, repo *repository.Re
 	fmt.Fprintf(ctx.Stdout, " - MIMEOther: %d\n", header.GetSource(0).Summary.Directory.MIMEOther+header.GetSource(0).Summary.Below.MIMEOther)
 
 	fmt.Fprintf(ctx.Stdout, " - Errors: %d\n", header.GetSource(0).Summary.Directory.Errors+header.GetSource(0).Summary.Below.Errors)
+	if overflow := header.GetSource(0).VFS.ErrorsOverflow; overflow != 0 {
+		fmt.Fprintf(ctx.Stdout, " - ErrorsOverflow: %d\n", overflow)
+	}
+
+	fileTypes := header.GetSource(0).FileTypes
+	if fileTypes.Files != 0 {
+		fmt.Fprintf(ctx.Stdout, "FileKind:\n")
+		printPercents(ctx, fileTypes.Kind, fileTypes.PercentKind)
+		fmt.Fprintf(ctx.Stdout, "FileType:\n")
+		printPercents(ctx, fileTypes.Type, fileTypes.PercentType)
+		fmt.Fprintf(ctx.Stdout, "FileExtension:\n")
+		printPercents(ctx, fileTypes.Extension, fileTypes.PercentExtension)
+	}
+
+	if signatureErr != nil {
+		return 1, signatureErr
+	}
 	return 0, nil
 }
+
+// signerTrust tells whether the signer of a snapshot is this host, or a
+// client whose enrollment this host handled, and the name it goes by.
+func (cmd *InfoSnapshot) signerTrust(ctx *appcontext.AppContext, identifier uuid.UUID, publicKey ed25519.PublicKey) (string, string) {
+	if identifier == ctx.Identity && ctx.Keypair != nil {
+		if publicKey.Equal(ctx.Keypair.PublicKey) {
+			return "self", ctx.Hostname
+		}
+		return "mismatch", ""
+	}
+
+	client, err := identity.ReadClient(cmd.ClientsDir, identifier)
+	if errors.Is(err, identity.ErrClientNotFound) {
+		return "unknown", ""
+	} else if err != nil {
+		return "error: " + err.Error(), ""
+	}
+	if !publicKey.Equal(ed25519.PublicKey(client.Request.PublicKey)) {
+		return "mismatch", client.Request.Name
+	}
+	return string(client.Status), client.Request.Name
+}
+
+// printSignature describes the signer of the snapshot and checks its
+// signature, an error being returned unless it is valid and made by a
+// trusted signer.
+func (cmd *InfoSnapshot) printSignature(ctx *appcontext.AppContext, snap *snapshot.Snapshot) error {
+	signer := snap.Header.Identity
+	fmt.Fprintln(ctx.Stdout, "Signature:")
+	if signer.Identifier == uuid.Nil {
+		fmt.Fprintln(ctx.Stdout, " - Signed: false")
+		return fmt.Errorf("snapshot is not signed")
+	}
+
+	trust, name := cmd.signerTrust(ctx, signer.Identifier, signer.PublicKey)
+	fmt.Fprintln(ctx.Stdout, " - Signed: true")
+	fmt.Fprintf(ctx.Stdout, " - Signer: %s\n", signer.Identifier)
+	if name != "" {
+		fmt.Fprintf(ctx.Stdout, " - Name: %s\n", name)
+	}
+	fmt.Fprintf(ctx.Stdout, " - Fingerprint: %s\n", identity.Fingerprint(signer.PublicKey))
+
+	valid, err := snap.Verify()
+	if err != nil {
+		fmt.Fprintf(ctx.Stdout, " - Error: %s\n", err)
+	} else {
+		fmt.Fprintf(ctx.Stdout, " - Valid: %t\n", valid)
+	}
+	fmt.Fprintf(ctx.Stdout, " - Trust: %s\n", trust)
+
+	if err != nil {
+		return fmt.Errorf("could not verify signature: %w", err)
+	} else if !valid {
+		return fmt.Errorf("invalid signature")
+	} else if trust != "self" && trust != string(identity.StatusApproved) {
+		return fmt.Errorf("signer is not trusted: %s", trust)
+	}
+	return nil
+}
+
+func printPercents(ctx *appcontext.AppContext, counts map[string]uint64, percents map[string]float64) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		fmt.Fprintf(ctx.Stdout, " - %s: %d (%.2f%%)\n", key, counts[key], percents[key])
+	}
+}
@@ -76,6 +76,7 @@ func (cmd *InfoState) Execute(ctx *appcontext.AppContext, repo *repository.Repos
 			fmt.Fprintf(ctx.Stdout, "Version: %s\n", st.Metadata.Version)
 			fmt.Fprintf(ctx.Stdout, "Creation: %s\n", st.Metadata.Timestamp)
 			fmt.Fprintf(ctx.Stdout, "State serial: %s\n", st.Metadata.Serial)
+			fmt.Fprintf(ctx.Stdout, "Sequence: %d\n", st.Metadata.Sequence)
 
 			printBlobs := func(name string, Type resources.Type) {
 				for snapshot, err := range st.ListObjectsOfType(Type) {
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package jobs
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/agent"
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/scheduler"
+)
+
+func init() {
+	subcommands.Register("jobs", parse_cmd_jobs)
+}
+
+func parse_cmd_jobs(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	// the queue only exists within the agent, always ask it
+	client, err := agent.NewClient(filepath.Join(ctx.CacheDir, "agent.sock"))
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the agent: %w", err)
+	}
+	defer client.Close()
+
+	retval, err := client.SendCommand(ctx, &Jobs{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	os.Exit(retval)
+	return nil, nil
+}
+
+// Jobs lists the scheduled tasks running or queued in the agent, along
+// with the backups that missed their expected frequency.
+type Jobs struct {
+	// Scheduler is set by the agent before executing the command.
+	Scheduler *scheduler.Scheduler `msgpack:"-"`
+}
+
+func (cmd *Jobs) Name() string {
+	return "jobs"
+}
+
+func (cmd *Jobs) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if cmd.Scheduler == nil {
+		fmt.Fprintf(ctx.Stdout, "no tasks scheduled in the agent\n")
+		return 0, nil
+	}
+
+	now := time.Now()
+	for _, job := range cmd.Scheduler.Jobs() {
+		state := "queued"
+		since := job.Queued
+		if job.Running() {
+			state = "running"
+			since = job.Started
+		}
+
+		name := job.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(ctx.Stdout, "%-8s %-12s %-20s %s %s\n", state, job.Task, name,
+			now.Sub(since).Truncate(time.Second), job.Repository)
+	}
+
+	for _, job := range cmd.Scheduler.Overdue() {
+		last := "never"
+		if !job.LastBackup.IsZero() {
+			last = now.Sub(job.LastBackup).Truncate(time.Second).String()
+		}
+		fmt.Fprintf(ctx.Stdout, "%-8s %-12s %-20s %s %s (expected every %s)\n", "overdue", "backup", job.Name,
+			last, job.Repository, job.Expect)
+	}
+	return 0, nil
+}
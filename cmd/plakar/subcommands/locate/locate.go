@@ -20,6 +20,8 @@ import (
 	"flag"
 	"fmt"
 	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -45,6 +47,7 @@ func parse_cmd_locate(ctx *appcontext.AppContext, repo *repository.Repository, a
 	var opt_before string
 	var opt_since string
 	var opt_latest bool
+	var opt_last bool
 
 	flags := flag.NewFlagSet("locate", flag.ExitOnError)
 	flags.Usage = func() {
@@ -63,6 +66,7 @@ func parse_cmd_locate(ctx *appcontext.AppContext, repo *repository.Repository, a
 	flags.StringVar(&opt_since, "since", "", "filter by date")
 	flags.BoolVar(&opt_latest, "latest", false, "use latest snapshot")
 	flags.StringVar(&opt_snapshot, "snapshot", "", "snapshot to locate in")
+	flags.BoolVar(&opt_last, "last", false, "only report the last snapshot each matching path exists in")
 	flags.Parse(args)
 
 	var err error
@@ -104,6 +108,8 @@ func parse_cmd_locate(ctx *appcontext.AppContext, repo *repository.Repository, a
 		OptJob:         opt_job,
 		OptTag:         opt_tag,
 
+		OptLast: opt_last,
+
 		Snapshot: opt_snapshot,
 		Patterns: flags.Args(),
 	}, nil
@@ -124,6 +130,8 @@ type Locate struct {
 	OptJob         string
 	OptTag         string
 
+	OptLast bool
+
 	Snapshot string
 	Patterns []string
 }
@@ -133,6 +141,8 @@ func (cmd *Locate) Name() string {
 }
 
 func (cmd *Locate) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	repo.EnableNodeCache()
+
 	var snapshots []objects.MAC
 	if len(cmd.Snapshot) == 0 {
 		locateOptions := utils.NewDefaultLocateOptions()
@@ -160,6 +170,15 @@ func (cmd *Locate) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		snapshots = append(snapshots, snapshotIDs...)
 	}
 
+	// snapshots are walked from the oldest, so that the last match of
+	// a pathname is the most recent snapshot holding it
+	type match struct {
+		pathname  string
+		snapshot  objects.MAC
+		timestamp time.Time
+	}
+	last := make(map[string]match)
+
 	for _, snapshotID := range snapshots {
 		snap, err := snapshot.Load(repo, snapshotID)
 		if err != nil {
@@ -177,25 +196,59 @@ func (cmd *Locate) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 				return 1, fmt.Errorf("locate: could not get pathname: %w", err)
 			}
 
-			for _, pattern := range cmd.Patterns {
-				matched := false
-				if path.Base(pathname) == pattern {
-					matched = true
-				}
-				if !matched {
-					matched, err := path.Match(pattern, path.Base(pathname))
-					if err != nil {
-						snap.Close()
-						return 1, fmt.Errorf("locate: could not match pattern: %w", err)
-					}
-					if !matched {
-						continue
-					}
-				}
-				fmt.Fprintf(ctx.Stdout, "%x:%s\n", snap.Header.Identifier[0:4], pathname)
+			matched, err := cmd.match(pathname)
+			if err != nil {
+				snap.Close()
+				return 1, fmt.Errorf("locate: could not match pattern: %w", err)
+			}
+			if !matched {
+				continue
 			}
+
+			if cmd.OptLast {
+				last[pathname] = match{pathname, snap.Header.Identifier, snap.Header.Timestamp}
+				continue
+			}
+			fmt.Fprintf(ctx.Stdout, "%s %x:%s\n", snap.Header.Timestamp.UTC().Format(time.RFC3339),
+				snap.Header.Identifier[0:4], pathname)
 		}
 		snap.Close()
 	}
+
+	if cmd.OptLast {
+		matches := make([]match, 0, len(last))
+		for _, m := range last {
+			matches = append(matches, m)
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].pathname < matches[j].pathname
+		})
+		for _, m := range matches {
+			fmt.Fprintf(ctx.Stdout, "%s %x:%s\n", m.timestamp.UTC().Format(time.RFC3339), m.snapshot[0:4], m.pathname)
+		}
+	}
 	return 0, nil
 }
+
+// match reports whether pathname matches any of the patterns, compared to
+// the full pathname for the patterns holding a slash and to its base name
+// otherwise.
+func (cmd *Locate) match(pathname string) (bool, error) {
+	for _, pattern := range cmd.Patterns {
+		name := path.Base(pathname)
+		if strings.Contains(pattern, "/") {
+			name = pathname
+		}
+		if name == pattern {
+			return true, nil
+		}
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
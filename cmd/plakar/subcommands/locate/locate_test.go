@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/caching"
@@ -169,3 +170,37 @@ func TestExecuteCmdLocateWithSnapshotId(t *testing.T) {
 	lines := strings.Split(strings.Trim(output, "\n"), "\n")
 	require.Equal(t, 1, len(lines))
 }
+
+func TestExecuteCmdLocateLast(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = snap.Repository().Location()
+	args := []string{"-last", snap.Header.GetSource(0).Importer.Directory + "/subdir/dummy.*"}
+
+	subcommand, err := parse_cmd_locate(ctx, snap.Repository(), args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, snap.Repository())
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	// 2026-10-16T12:00:00Z d92a4c73:/tmp/tmp_to_backup1424943315/subdir/dummy.txt
+
+	output := bufOut.String()
+	lines := strings.Split(strings.Trim(output, "\n"), "\n")
+	require.Equal(t, 1, len(lines))
+
+	prefix := fmt.Sprintf("%s %x:", snap.Header.Timestamp.UTC().Format(time.RFC3339), snap.Header.Identifier[0:4])
+	require.True(t, strings.HasPrefix(lines[0], prefix), lines[0])
+	require.True(t, strings.HasSuffix(lines[0], "/subdir/dummy.txt"), lines[0])
+}
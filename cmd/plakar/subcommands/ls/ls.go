@@ -22,6 +22,9 @@ import (
 	"fmt"
 	"io/fs"
 	"os/user"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -30,6 +33,7 @@ import (
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/header"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/dustin/go-humanize"
 )
@@ -50,6 +54,11 @@ func parse_cmd_ls(ctx *appcontext.AppContext, repo *repository.Repository, args
 	var opt_latest bool
 	var opt_uuid bool
 	var opt_recursive bool
+	var opt_columns string
+	var opt_sort string
+	var opt_reverse bool
+	var opt_limit int
+	var opt_offset int
 
 	flags := flag.NewFlagSet("ls", flag.ExitOnError)
 	flags.Usage = func() {
@@ -69,13 +78,36 @@ func parse_cmd_ls(ctx *appcontext.AppContext, repo *repository.Repository, args
 	flags.BoolVar(&opt_latest, "latest", false, "use latest snapshot")
 	flags.BoolVar(&opt_uuid, "uuid", false, "display uuid instead of short ID")
 	flags.BoolVar(&opt_recursive, "recursive", false, "recursive listing")
+	flags.StringVar(&opt_columns, "o", "", "comma-separated list of columns to display ("+strings.Join(columnNames(), ",")+")")
+	flags.StringVar(&opt_sort, "sort", "", "comma-separated list of header fields to sort snapshots by, prefixed with - for descending order")
+	flags.BoolVar(&opt_reverse, "reverse", false, "reverse the order of the snapshots")
+	flags.IntVar(&opt_limit, "limit", 0, "maximum number of snapshots to list, 0 for no limit")
+	flags.IntVar(&opt_offset, "offset", 0, "number of snapshots to skip")
 	flags.Parse(args)
 
 	if flags.NArg() > 1 {
 		return nil, fmt.Errorf("too many arguments")
 	}
 
-	var err error
+	if opt_limit < 0 || opt_offset < 0 {
+		return nil, fmt.Errorf("-limit and -offset must be positive")
+	}
+
+	var columns []string
+	if opt_columns != "" {
+		for _, column := range strings.Split(opt_columns, ",") {
+			column = strings.ToLower(strings.TrimSpace(column))
+			if _, ok := lsColumns[column]; !ok {
+				return nil, fmt.Errorf("unknown column: %s", column)
+			}
+			columns = append(columns, column)
+		}
+	}
+
+	sortKeys, err := header.ParseSortKeys(opt_sort)
+	if err != nil {
+		return nil, err
+	}
 
 	var beforeDate time.Time
 	if opt_before != "" {
@@ -111,6 +143,12 @@ func parse_cmd_ls(ctx *appcontext.AppContext, repo *repository.Repository, args
 		Recursive:   opt_recursive,
 		DisplayUUID: opt_uuid,
 		Path:        flags.Arg(0),
+
+		Columns:  columns,
+		SortKeys: sortKeys,
+		Reverse:  opt_reverse,
+		Limit:    opt_limit,
+		Offset:   opt_offset,
 	}, nil
 }
 
@@ -132,6 +170,12 @@ type Ls struct {
 	Recursive   bool
 	DisplayUUID bool
 	Path        string
+
+	Columns  []string
+	SortKeys []string
+	Reverse  bool
+	Limit    int
+	Offset   int
 }
 
 func (cmd *Ls) Name() string {
@@ -139,6 +183,8 @@ func (cmd *Ls) Name() string {
 }
 
 func (cmd *Ls) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	repo.EnableNodeCache()
+
 	if cmd.Path == "" {
 		if err := cmd.list_snapshots(ctx, repo); err != nil {
 			return 1, err
@@ -173,34 +219,142 @@ func (cmd *Ls) list_snapshots(ctx *appcontext.AppContext, repo *repository.Repos
 		return fmt.Errorf("ls: could not fetch snapshots list: %w", err)
 	}
 
+	headers := make([]header.Header, 0, len(snapshotIDs))
 	for _, snapshotID := range snapshotIDs {
 		snap, err := snapshot.Load(repo, snapshotID)
 		if err != nil {
 			return fmt.Errorf("ls: could not fetch snapshot: %w", err)
 		}
+		headers = append(headers, *snap.Header)
+		snap.Close()
+	}
+
+	if len(cmd.SortKeys) != 0 {
+		if err := header.SortHeaders(headers, cmd.SortKeys); err != nil {
+			return fmt.Errorf("ls: %w", err)
+		}
+	}
+	if cmd.Reverse {
+		slices.Reverse(headers)
+	}
 
+	headers = headers[min(cmd.Offset, len(headers)):]
+	if cmd.Limit != 0 && cmd.Limit < len(headers) {
+		headers = headers[:cmd.Limit]
+	}
+
+	if len(cmd.Columns) != 0 {
+		cmd.display_columns(ctx, headers)
+		return nil
+	}
+
+	for _, hdr := range headers {
 		if !cmd.DisplayUUID {
 			fmt.Fprintf(ctx.Stdout, "%s %10s%10s%10s %s\n",
-				snap.Header.Timestamp.UTC().Format(time.RFC3339),
-				hex.EncodeToString(snap.Header.GetIndexShortID()),
-				humanize.Bytes(snap.Header.GetSource(0).Summary.Directory.Size+snap.Header.GetSource(0).Summary.Below.Size),
-				snap.Header.Duration.Round(time.Second),
-				snap.Header.GetSource(0).Importer.Directory)
+				hdr.Timestamp.UTC().Format(time.RFC3339),
+				hex.EncodeToString(hdr.GetIndexShortID()),
+				humanize.Bytes(hdr.GetSource(0).Summary.Directory.Size+hdr.GetSource(0).Summary.Below.Size),
+				hdr.Duration.Round(time.Second),
+				hdr.GetSource(0).Importer.Root())
 		} else {
-			indexID := snap.Header.GetIndexID()
+			indexID := hdr.GetIndexID()
 			fmt.Fprintf(ctx.Stdout, "%s %3s%10s%10s %s\n",
-				snap.Header.Timestamp.UTC().Format(time.RFC3339),
+				hdr.Timestamp.UTC().Format(time.RFC3339),
 				hex.EncodeToString(indexID[:]),
-				humanize.Bytes(snap.Header.GetSource(0).Summary.Directory.Size+snap.Header.GetSource(0).Summary.Below.Size),
-				snap.Header.Duration.Round(time.Second),
-				snap.Header.GetSource(0).Importer.Directory)
+				humanize.Bytes(hdr.GetSource(0).Summary.Directory.Size+hdr.GetSource(0).Summary.Below.Size),
+				hdr.Duration.Round(time.Second),
+				hdr.GetSource(0).Importer.Root())
 		}
-
-		snap.Close()
 	}
 	return nil
 }
 
+var lsColumns = map[string]func(cmd *Ls, hdr *header.Header) string{
+	"date": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Timestamp.UTC().Format(time.RFC3339)
+	},
+	"id": func(cmd *Ls, hdr *header.Header) string {
+		if cmd.DisplayUUID {
+			indexID := hdr.GetIndexID()
+			return hex.EncodeToString(indexID[:])
+		}
+		return hex.EncodeToString(hdr.GetIndexShortID())
+	},
+	"size": func(cmd *Ls, hdr *header.Header) string {
+		return humanize.Bytes(hdr.GetSource(0).Summary.Directory.Size + hdr.GetSource(0).Summary.Below.Size)
+	},
+	"duration": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Duration.Round(time.Second).String()
+	},
+	"scanned": func(cmd *Ls, hdr *header.Header) string {
+		return humanize.Bytes(hdr.GetSource(0).Stats.ScannedSize)
+	},
+	"transferred": func(cmd *Ls, hdr *header.Header) string {
+		return humanize.Bytes(hdr.GetSource(0).Stats.TransferredSize)
+	},
+	"path": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.GetSource(0).Importer.Root()
+	},
+	"importer": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.GetSource(0).Importer.Type
+	},
+	"name": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Name
+	},
+	"category": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Category
+	},
+	"environment": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Environment
+	},
+	"perimeter": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Perimeter
+	},
+	"job": func(cmd *Ls, hdr *header.Header) string {
+		return hdr.Job
+	},
+	"tags": func(cmd *Ls, hdr *header.Header) string {
+		return strings.Join(hdr.Tags, ",")
+	},
+}
+
+func columnNames() []string {
+	names := make([]string, 0, len(lsColumns))
+	for name := range lsColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// display_columns prints the selected columns, aligned on the widest
+// value of each but the last one.
+func (cmd *Ls) display_columns(ctx *appcontext.AppContext, headers []header.Header) {
+	rows := make([][]string, 0, len(headers))
+	widths := make([]int, len(cmd.Columns))
+	for i := range headers {
+		row := make([]string, len(cmd.Columns))
+		for j, column := range cmd.Columns {
+			row[j] = lsColumns[column](cmd, &headers[i])
+			if row[j] == "" {
+				row[j] = "-"
+			}
+			widths[j] = max(widths[j], len(row[j]))
+		}
+		rows = append(rows, row)
+	}
+
+	for _, row := range rows {
+		for j, value := range row {
+			if j == len(row)-1 {
+				fmt.Fprintf(ctx.Stdout, "%s\n", value)
+			} else {
+				fmt.Fprintf(ctx.Stdout, "%-*s ", widths[j], value)
+			}
+		}
+	}
+}
+
 func (cmd *Ls) list_snapshot(ctx *appcontext.AppContext, repo *repository.Repository, snapshotPath string, recursive bool) error {
 	snap, pathname, err := utils.OpenSnapshotByPath(repo, snapshotPath)
 	if err != nil {
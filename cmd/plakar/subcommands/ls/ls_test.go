@@ -226,3 +226,48 @@ func TestExecuteCmdLsFilterUuid(t *testing.T) {
 	require.Equal(t, hex.EncodeToString(indexId[:]), fields[1])
 	require.Equal(t, snap.Header.GetSource(0).Importer.Directory, fields[len(fields)-1])
 }
+
+func TestExecuteCmdLsColumns(t *testing.T) {
+	// Create a pipe to capture stdout
+	old := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	args := []string{"-o", "id,name,path", "-sort", "-Timestamp", "-limit", "1"}
+
+	subcommand, err := parse_cmd_ls(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// Close the write end of the pipe and restore stdout
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	output := buf.String()
+	lines := strings.Split(strings.Trim(output, "\n"), "\n")
+	require.Equal(t, 1, len(lines))
+	fields := strings.Fields(lines[0])
+	require.Equal(t, 3, len(fields))
+	require.Equal(t, hex.EncodeToString(snap.Header.GetIndexShortID()), fields[0])
+	require.Equal(t, snap.Header.GetSource(0).Importer.Directory, fields[2])
+
+	_, err = parse_cmd_ls(ctx, repo, []string{"-o", "id,colour"})
+	require.Error(t, err)
+
+	_, err = parse_cmd_ls(ctx, repo, []string{"-sort", "Unknown"})
+	require.Error(t, err)
+}
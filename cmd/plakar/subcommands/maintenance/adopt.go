@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maintenance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+// quarantine copies a resource, as found in storage, into the quarantine
+// directory so that it can be examined or pushed back by hand.
+func (cmd *Maintenance) quarantine(kind string, mac objects.MAC, rd io.Reader) (string, error) {
+	if err := os.MkdirAll(cmd.QuarantineDir, 0700); err != nil {
+		return "", err
+	}
+
+	pathname := filepath.Join(cmd.QuarantineDir, fmt.Sprintf("%s-%x", kind, mac))
+	fp, err := os.OpenFile(pathname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(fp, rd); err != nil {
+		fp.Close()
+		os.Remove(pathname)
+		return "", err
+	}
+
+	return pathname, fp.Close()
+}
+
+// adoptStates merges the states found in storage that are not part of the
+// aggregate, such as the ones pushed by a client that crashed once done.
+// States that can't be decoded are quarantined and removed from storage
+// since no client could rebuild the repository with them.
+func (cmd *Maintenance) adoptStates(ctx *appcontext.AppContext) (int, int, error) {
+	stateIDs, err := cmd.repository.GetStates()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	adopted, quarantined := 0, 0
+	for _, stateID := range stateIDs {
+		if has, err := cmd.repository.HasState(stateID); err != nil {
+			return adopted, quarantined, err
+		} else if has {
+			continue
+		}
+
+		err := cmd.repository.InsertState(stateID)
+		if err == nil {
+			adopted++
+			continue
+		}
+
+		fmt.Fprintf(ctx.Stderr, "maintenance: state %x is unreadable: %s\n", stateID[:4], err)
+
+		rd, err := cmd.repository.Store().GetState(stateID)
+		if err != nil {
+			return adopted, quarantined, err
+		}
+		pathname, err := cmd.quarantine("state", stateID, rd)
+		if err != nil {
+			return adopted, quarantined, err
+		}
+		if err := cmd.repository.DeleteState(stateID); err != nil {
+			return adopted, quarantined, err
+		}
+
+		fmt.Fprintf(ctx.Stdout, "maintenance: quarantined state %x to %s\n", stateID[:4], pathname)
+		quarantined++
+	}
+
+	return adopted, quarantined, nil
+}
+
+// adoption registers packfiles found in storage, along with the blobs
+// listed in their index, in a delta state.
+type adoption struct {
+	id         objects.MAC
+	sc         *caching.ScanCache
+	deltaState *state.LocalState
+
+	packfiles   int
+	quarantined int
+	blobs       int
+	snapshots   int
+}
+
+func (cmd *Maintenance) newAdoption() (*adoption, error) {
+	var id objects.MAC
+	if n, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	} else if n != len(id) {
+		return nil, io.ErrShortWrite
+	}
+
+	sc, err := cmd.repository.AppContext().GetCache().Scan(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &adoption{
+		id:         id,
+		sc:         sc,
+		deltaState: cmd.repository.NewStateDelta(sc),
+	}, nil
+}
+
+func (a *adoption) Close() error {
+	return a.sc.Close()
+}
+
+// adoptPackfile registers a packfile and its blobs.  A packfile whose index
+// can't be read is quarantined and coloured for deletion instead, as it
+// would be by a regular maintenance run.
+func (cmd *Maintenance) adoptPackfile(ctx *appcontext.AppContext, a *adoption, packfileMAC objects.MAC) error {
+	_, index, err := cmd.repository.GetPackfileIndex(packfileMAC)
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr, "maintenance: packfile %x is unreadable: %s\n", packfileMAC[:4], err)
+
+		rd, err := cmd.repository.Store().GetPackfile(packfileMAC)
+		if err != nil {
+			return err
+		}
+		pathname, err := cmd.quarantine("packfile", packfileMAC, rd)
+		if err != nil {
+			return err
+		}
+		if err := a.deltaState.DeleteResource(resources.RT_PACKFILE, packfileMAC); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(ctx.Stdout, "maintenance: quarantined packfile %x to %s\n", packfileMAC[:4], pathname)
+		a.quarantined++
+		return nil
+	}
+
+	for _, blob := range index {
+		delta := state.DeltaEntry{
+			Type:    blob.Type,
+			Version: blob.Version,
+			Blob:    blob.MAC,
+			Location: state.Location{
+				Packfile: packfileMAC,
+				Offset:   blob.Offset,
+				Length:   blob.Length,
+			},
+		}
+		if err := a.deltaState.PutDelta(delta); err != nil {
+			return err
+		}
+		if blob.Type == resources.RT_SNAPSHOT {
+			a.snapshots++
+		}
+		a.blobs++
+	}
+
+	if err := a.deltaState.PutPackfile(a.id, packfileMAC); err != nil {
+		return err
+	}
+	a.packfiles++
+	return nil
+}
+
+// commitAdoption pushes the delta state recording the adoption, if
+// anything was adopted or quarantined.
+func (cmd *Maintenance) commitAdoption(a *adoption) error {
+	if a.packfiles == 0 && a.quarantined == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := a.deltaState.SerializeToStream(buf); err != nil {
+		return err
+	}
+	return cmd.repository.PutState(a.id, buf)
+}
+
+// adoptPass registers the packfiles found in storage that no state
+// references, as left by a backup that crashed before pushing its state,
+// so that the snapshots and blobs they hold are reachable again.
+func (cmd *Maintenance) adoptPass(ctx *appcontext.AppContext) error {
+	adoptedStates, quarantinedStates, err := cmd.adoptStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[objects.MAC]struct{})
+	for packfileMAC := range cmd.repository.ListPackfiles() {
+		known[packfileMAC] = struct{}{}
+	}
+
+	repoPackfiles, err := cmd.repository.GetPackfiles()
+	if err != nil {
+		return err
+	}
+
+	a, err := cmd.newAdoption()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	for _, packfileMAC := range repoPackfiles {
+		if _, ok := known[packfileMAC]; ok {
+			continue
+		}
+		if err := cmd.adoptPackfile(ctx, a, packfileMAC); err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.commitAdoption(a); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.Stdout, "maintenance: adopted %d states and %d packfiles (%d blobs, %d snapshots)\n", adoptedStates, a.packfiles, a.blobs, a.snapshots)
+	if quarantinedStates != 0 || a.quarantined != 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: quarantined %d states and %d packfiles in %s\n", quarantinedStates, a.quarantined, cmd.QuarantineDir)
+	}
+	return nil
+}
+
+// rebuildStatePass reconstructs the state of the repository from the
+// indexes of all the packfiles found in storage, for when the states were
+// lost or damaged while the packfiles survived.  The states left in
+// storage are kept: the rebuilt state is merged with them.
+func (cmd *Maintenance) rebuildStatePass(ctx *appcontext.AppContext) error {
+	repoPackfiles, err := cmd.repository.GetPackfiles()
+	if err != nil {
+		return err
+	}
+
+	a, err := cmd.newAdoption()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	for _, packfileMAC := range repoPackfiles {
+		if err := cmd.adoptPackfile(ctx, a, packfileMAC); err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.commitAdoption(a); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.Stdout, "maintenance: rebuilt state from %d packfiles (%d blobs, %d snapshots)\n", a.packfiles, a.blobs, a.snapshots)
+	if a.quarantined != 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: quarantined %d packfiles in %s\n", a.quarantined, cmd.QuarantineDir)
+	}
+	return nil
+}
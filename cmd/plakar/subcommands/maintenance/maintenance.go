@@ -22,6 +22,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -31,6 +33,7 @@ import (
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
@@ -38,23 +41,104 @@ func init() {
 }
 
 func parse_cmd_maintenance(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_compact bool
+	var opt_repack bool
+	var opt_upgrade bool
+	var opt_adopt bool
+	var opt_rebuild bool
+	var opt_quarantine string
+	var opt_dryrun bool
+	var opt_utilization int
+	var opt_rate string
+	var opt_maxsize string
+
 	flags := flag.NewFlagSet("maintenance", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
 	}
+	flags.BoolVar(&opt_compact, "compact", false, "only compact the repository states")
+	flags.BoolVar(&opt_repack, "repack", false, "only coalesce small packfiles into larger ones")
+	flags.BoolVar(&opt_upgrade, "upgrade-packfiles", false, "only rewrite packfiles using an older format")
+	flags.BoolVar(&opt_adopt, "adopt", false, "only register the packfiles and states no state references")
+	flags.BoolVar(&opt_rebuild, "rebuild-state", false, "only rebuild the repository state from the packfiles")
+	flags.BoolVar(&opt_dryrun, "dry-run", false, "report the space maintenance would reclaim without modifying the repository")
+	flags.IntVar(&opt_utilization, "utilization", defaultUtilization, "percentage of reachable data below which a packfile is rewritten")
+	flags.StringVar(&opt_rate, "rate", "", "limit the transfers of packfiles being rewritten to this many bytes per second")
+	flags.StringVar(&opt_maxsize, "max-size", "", "stop rewriting packfiles once this many bytes were read, leaving the rest to a later run")
+	flags.StringVar(&opt_quarantine, "quarantine", "", "directory where unreadable packfiles and states are copied by -adopt and -rebuild-state")
 	flags.Parse(args)
 
+	exclusive := 0
+	for _, opt := range []bool{opt_compact, opt_repack, opt_upgrade, opt_adopt, opt_rebuild} {
+		if opt {
+			exclusive++
+		}
+	}
+	if exclusive > 1 {
+		return nil, fmt.Errorf("-compact, -repack, -upgrade-packfiles, -adopt and -rebuild-state are mutually exclusive")
+	}
+	if opt_dryrun && exclusive != 0 {
+		return nil, fmt.Errorf("-dry-run cannot be combined with -compact, -repack, -upgrade-packfiles, -adopt or -rebuild-state")
+	}
+	if opt_quarantine != "" && !opt_adopt && !opt_rebuild {
+		return nil, fmt.Errorf("-quarantine requires -adopt or -rebuild-state")
+	}
+	if opt_utilization < 1 || opt_utilization > 100 {
+		return nil, fmt.Errorf("invalid utilization: %d, must be between 1 and 100", opt_utilization)
+	}
+
+	var rate, maxSize uint64
+	if opt_rate != "" {
+		var err error
+		if rate, err = humanize.ParseBytes(strings.TrimSuffix(opt_rate, "/s")); err != nil || rate == 0 {
+			return nil, fmt.Errorf("invalid rate: %s", opt_rate)
+		}
+	}
+	if opt_maxsize != "" {
+		var err error
+		if maxSize, err = humanize.ParseBytes(opt_maxsize); err != nil || maxSize == 0 {
+			return nil, fmt.Errorf("invalid size: %s", opt_maxsize)
+		}
+	}
+
+	if opt_quarantine == "" {
+		opt_quarantine = filepath.Join(ctx.CacheDir, "quarantine", repo.Configuration().RepositoryID.String())
+	}
+
 	return &Maintenance{
 		RepositoryLocation: repo.Location(),
 		RepositorySecret:   ctx.GetSecret(),
+		Compact:            opt_compact,
+		Repack:             opt_repack,
+		UpgradePackfiles:   opt_upgrade,
+		Adopt:              opt_adopt,
+		RebuildState:       opt_rebuild,
+		QuarantineDir:      opt_quarantine,
+		DryRun:             opt_dryrun,
+		Utilization:        opt_utilization,
+		Rate:               rate,
+		MaxSize:            maxSize,
 	}, nil
 }
 
 type Maintenance struct {
 	RepositoryLocation string
 	RepositorySecret   []byte
+	Compact            bool
+	Repack             bool
+	UpgradePackfiles   bool
+	Adopt              bool
+	RebuildState       bool
+	QuarantineDir      string
+	DryRun             bool
+	Utilization        int
+	Rate               uint64
+	MaxSize            uint64
 
 	repository    *repository.Repository
+	budget        *rewriteBudget
 	maintenanceID objects.MAC
 	cutoff        time.Time
 }
@@ -65,60 +149,12 @@ func (cmd *Maintenance) Name() string {
 
 // Builds the local cache of snapshot -> packfiles
 func (cmd *Maintenance) updateCache(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
-	for snapshotID := range cmd.repository.ListSnapshots() {
-		snapshot, err := snapshot.Load(cmd.repository, snapshotID)
-		if err != nil {
-			return err
-		}
-
-		ok, err := cache.HasSnapshot(snapshotID)
-		if err != nil {
-			return err
-		}
-
-		if ok {
-			continue
-		}
-
-		iter, err := snapshot.ListPackfiles()
-		if err != nil {
-			return err
-		}
-
-		for packfile, err := range iter {
-			if err != nil {
-				return err
-			}
-
-			if err := cache.PutPackfile(snapshotID, packfile); err != nil {
-				return err
-			}
-		}
-
-		cache.PutSnapshot(snapshotID, nil)
-		snapshot.Close()
-	}
-
-	// While ListSnapshots doesn't return deleted snapshots, we still need to
-	// go over them to remove previously added one to our local cache.
-	for snapshotID := range cmd.repository.ListDeletedSnapShots() {
-		ok, err := cache.HasSnapshot(snapshotID)
-		if err != nil {
-			return err
-		}
-
-		if !ok {
-			continue
-		}
-
-		cache.DeleletePackfiles(snapshotID)
-		cache.DeleteSnapshot(snapshotID)
-	}
-
-	return nil
+	return snapshot.CachePackfiles(cmd.repository, cache)
 }
 
-func (cmd *Maintenance) colourPass(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
+// unusedPackfiles returns the packfiles no snapshot uses which are not
+// coloured for deletion yet, along with the size of the orphaned ones.
+func (cmd *Maintenance) unusedPackfiles(cache *caching.MaintenanceCache) (map[objects.MAC]struct{}, map[objects.MAC]uint64, error) {
 	var packfiles map[objects.MAC]struct{} = make(map[objects.MAC]struct{})
 	for packfileMAC := range cmd.repository.ListPackfiles() {
 		packfiles[packfileMAC] = struct{}{}
@@ -128,10 +164,10 @@ func (cmd *Maintenance) colourPass(ctx *appcontext.AppContext, cache *caching.Ma
 	// identify orphaned packfiles (eg. from an aborted backup)
 	repoPackfiles, err := cmd.repository.GetPackfiles()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	orphanedPackfiles := 0
+	orphaned := make(map[objects.MAC]uint64)
 	for _, packfileMAC := range repoPackfiles {
 		_, ok := packfiles[packfileMAC]
 		if ok {
@@ -142,7 +178,7 @@ func (cmd *Maintenance) colourPass(ctx *appcontext.AppContext, cache *caching.Ma
 		// packfile once again
 		has, err := cmd.repository.HasDeletedPackfile(packfileMAC)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		if has {
@@ -152,20 +188,47 @@ func (cmd *Maintenance) colourPass(ctx *appcontext.AppContext, cache *caching.Ma
 		// The packfile is not available through state, so it's orphaned, but
 		// we must take some care as it might be from an in progress backup. In
 		// order to avoid deleting those we rely on the grace period. Sadly
-		// this means we have to load the packfile from the repository,
+		// this means we have to load the packfile footer from the repository,
 		// hopefuly those are rare enough that it's not a problem in practice.
-		packfile, err := cmd.repository.GetPackfile(packfileMAC)
+		footer, index, err := cmd.repository.GetPackfileIndex(packfileMAC)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
-		packfileDate := time.Unix(0, packfile.Footer.Timestamp)
+		packfileDate := time.Unix(0, footer.Timestamp)
 		if packfileDate.Before(cmd.cutoff) {
-			orphanedPackfiles++
+			for _, blob := range index {
+				orphaned[packfileMAC] += uint64(blob.Length)
+			}
 			packfiles[packfileMAC] = struct{}{}
 		}
 	}
 
+	unused := make(map[objects.MAC]struct{})
+	for packfile := range packfiles {
+		if cache.HasPackfile(packfile) {
+			continue
+		}
+
+		has, err := cmd.repository.HasDeletedPackfile(packfile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !has {
+			unused[packfile] = struct{}{}
+		}
+	}
+
+	return unused, orphaned, nil
+}
+
+func (cmd *Maintenance) colourPass(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
+	unused, orphaned, err := cmd.unusedPackfiles(cache)
+	if err != nil {
+		return err
+	}
+
 	sc, err := cmd.repository.AppContext().GetCache().Scan(cmd.maintenanceID)
 	if err != nil {
 		return err
@@ -177,26 +240,13 @@ func (cmd *Maintenance) colourPass(ctx *appcontext.AppContext, cache *caching.Ma
 	// excluding those resources alltogether.
 	deltaState := cmd.repository.NewStateDelta(sc)
 
-	coloredPackfiles := 0
-	for packfile := range packfiles {
-		if cache.HasPackfile(packfile) {
-			continue
-		}
-
-		has, err := cmd.repository.HasDeletedPackfile(packfile)
-		if err != nil {
+	for packfile := range unused {
+		if err := deltaState.DeleteResource(resources.RT_PACKFILE, packfile); err != nil {
 			return err
 		}
-
-		if !has {
-			coloredPackfiles++
-			if err := deltaState.DeleteResource(resources.RT_PACKFILE, packfile); err != nil {
-				return err
-			}
-		}
 	}
 
-	fmt.Fprintf(ctx.Stdout, "maintenance: Coloured %d packfiles (%d orphaned) for deletion\n", coloredPackfiles, orphanedPackfiles)
+	fmt.Fprintf(ctx.Stdout, "maintenance: Coloured %d packfiles (%d orphaned) for deletion\n", len(unused), len(orphaned))
 
 	buf := &bytes.Buffer{}
 	if err := deltaState.SerializeToStream(buf); err != nil {
@@ -283,9 +333,15 @@ func (cmd *Maintenance) Execute(ctx *appcontext.AppContext, repo *repository.Rep
 	// 5. remaining packfiles should be marked as deleted in the state
 	// 6. remove the packfile in repository once it's flagged as deleted AND all snapshots have been `snapshot.Check`-ed
 	// 7. rebuild a new aggregate state with a new serial without the deleted packfiles
+	// 8. rewrite the packfiles holding enough blobs no snapshot reaches anymore
 
 	cmd.repository = repo
 
+	if cmd.Utilization == 0 {
+		cmd.Utilization = defaultUtilization
+	}
+	cmd.budget = newRewriteBudget(cmd.Rate, cmd.MaxSize)
+
 	// This need to be configurable per repo, but we don't have a mechanism yet (comes in a PR soon!)
 	cmd.cutoff = time.Now().AddDate(0, 0, -30)
 
@@ -300,11 +356,35 @@ func (cmd *Maintenance) Execute(ctx *appcontext.AppContext, repo *repository.Rep
 		return 1, io.ErrShortWrite
 	}
 
-	done, err := cmd.Lock()
-	if err != nil {
-		return 1, err
+	// A dry run only reads the repository and doesn't need to keep backups
+	// away.
+	if !cmd.DryRun {
+		done, err := cmd.Lock()
+		if err != nil {
+			return 1, err
+		}
+		defer cmd.Unlock(done)
+	}
+
+	if cmd.Compact {
+		return cmd.compactStates(ctx)
+	}
+
+	if cmd.Adopt {
+		if err := cmd.adoptPass(ctx); err != nil {
+			fmt.Fprintf(ctx.Stderr, "maintenance: Adopt pass failed %s\n", err)
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	if cmd.RebuildState {
+		if err := cmd.rebuildStatePass(ctx); err != nil {
+			fmt.Fprintf(ctx.Stderr, "maintenance: Rebuild state pass failed %s\n", err)
+			return 1, err
+		}
+		return 0, nil
 	}
-	defer cmd.Unlock(done)
 
 	cache, err := repo.AppContext().GetCache().Maintenance(repo.Configuration().RepositoryID)
 	if err != nil {
@@ -317,6 +397,30 @@ func (cmd *Maintenance) Execute(ctx *appcontext.AppContext, repo *repository.Rep
 		return 1, err
 	}
 
+	if cmd.DryRun {
+		if err := cmd.dryRun(ctx, cache); err != nil {
+			fmt.Fprintf(ctx.Stderr, "maintenance: Dry run failed %s\n", err)
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	if cmd.Repack {
+		if err := cmd.repackPass(ctx, cache); err != nil {
+			fmt.Fprintf(ctx.Stderr, "maintenance: Repack pass failed %s\n", err)
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	if cmd.UpgradePackfiles {
+		if err := cmd.upgradePass(ctx, cache); err != nil {
+			fmt.Fprintf(ctx.Stderr, "maintenance: Upgrade pass failed %s\n", err)
+			return 1, err
+		}
+		return 0, nil
+	}
+
 	if err := cmd.colourPass(ctx, cache); err != nil {
 		fmt.Fprintf(ctx.Stderr, "maintenance: Colouring pass failed %s\n", err)
 		return 1, err
@@ -327,90 +431,29 @@ func (cmd *Maintenance) Execute(ctx *appcontext.AppContext, repo *repository.Rep
 		return 1, err
 	}
 
-	return 0, nil
-}
-
-func (cmd *Maintenance) Lock() (chan bool, error) {
-	lock := repository.NewExclusiveLock(cmd.repository.AppContext().Hostname)
-
-	buffer := &bytes.Buffer{}
-	err := lock.SerializeToStream(buffer)
-	if err != nil {
-		return nil, err
+	if err := cmd.reclaimPass(ctx, cache); err != nil {
+		fmt.Fprintf(ctx.Stderr, "maintenance: Reclaim pass failed %s\n", err)
+		return 1, err
 	}
 
-	err = cmd.repository.PutLock(cmd.maintenanceID, buffer)
-	if err != nil {
-		return nil, err
-	}
+	return 0, nil
+}
 
-	// We installed the lock, now let's see if there is a conflicting exclusive lock or not.
-	locksID, err := cmd.repository.GetLocks()
+// compactStates folds the delta states accumulated by backups into a single
+// state with a fresh serial and removes the superseded ones from storage.
+func (cmd *Maintenance) compactStates(ctx *appcontext.AppContext) (int, error) {
+	stateID, superseded, err := cmd.repository.CompactStates()
 	if err != nil {
-		// We still need to delete it, and we need to do so manually.
-		cmd.repository.DeleteLock(cmd.maintenanceID)
-		return nil, err
-	}
-
-	for _, lockID := range locksID {
-		if lockID == cmd.maintenanceID {
-			continue
-		}
-
-		version, rd, err := cmd.repository.GetLock(lockID)
-		if err != nil {
-			cmd.repository.DeleteLock(cmd.maintenanceID)
-			return nil, err
-		}
-
-		lock, err := repository.NewLockFromStream(version, rd)
-		if err != nil {
-			cmd.repository.DeleteLock(cmd.maintenanceID)
-			return nil, err
-		}
-
-		/* Kick out stale locks */
-		if lock.IsStale() {
-			err := cmd.repository.DeleteLock(lockID)
-			if err != nil {
-				cmd.repository.DeleteLock(cmd.maintenanceID)
-				return nil, err
-			}
-		}
-
-		// There is a lock in place, we need to abort.
-		err = cmd.repository.DeleteLock(cmd.maintenanceID)
-		if err != nil {
-			return nil, err
-		}
-
-		return nil, fmt.Errorf("Can't take exclusive lock, repository is already locked")
+		fmt.Fprintf(ctx.Stderr, "maintenance: Failed to compact states %s\n", err)
+		return 1, err
 	}
 
-	// The following bit is a "ping" mechanism, Lock() is a bit badly named at this point,
-	// we are just refreshing the existing lock so that the watchdog doesn't removes us.
-	lockDone := make(chan bool)
-	go func() {
-		for {
-			select {
-			case <-lockDone:
-				cmd.repository.DeleteLock(cmd.maintenanceID)
-				return
-			case <-time.After(repository.LOCK_REFRESH_RATE):
-				lock := repository.NewExclusiveLock(cmd.repository.AppContext().Hostname)
-
-				buffer := &bytes.Buffer{}
-
-				// We ignore errors here on purpose, it's tough to handle them
-				// correctly, and if they happen we will be ripped by the
-				// watchdog anyway.
-				lock.SerializeToStream(buffer)
-				cmd.repository.PutLock(cmd.maintenanceID, buffer)
-			}
-		}
-	}()
+	fmt.Fprintf(ctx.Stdout, "maintenance: compacted %d states into %x\n", len(superseded), stateID[:4])
+	return 0, nil
+}
 
-	return lockDone, nil
+func (cmd *Maintenance) Lock() (chan bool, error) {
+	return cmd.repository.ExclusiveLock(cmd.maintenanceID)
 }
 
 func (cmd *Maintenance) Unlock(ping chan bool) {
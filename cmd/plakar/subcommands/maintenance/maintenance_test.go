@@ -0,0 +1,182 @@
+package maintenance
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepository holds a few small snapshots, each with a file of its own,
+// so that it is made of many small packfiles and delta states.
+type testRepository struct {
+	repoDir   string
+	backupDir string
+	snapshots map[objects.MAC]string
+}
+
+func generateRepository(t *testing.T, nSnapshots int) *testRepository {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+		os.RemoveAll(tmpBackupDir)
+	})
+
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	require.NoError(t, r.Create(wrappedConfig))
+
+	tr := &testRepository{
+		repoDir:   tmpRepoDir,
+		backupDir: tmpBackupDir,
+		snapshots: make(map[objects.MAC]string),
+	}
+
+	repo := tr.open(t, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	for i := 0; i < nSnapshots; i++ {
+		pathname := filepath.Join(tmpBackupDir, fmt.Sprintf("file%d.txt", i))
+		require.NoError(t, os.WriteFile(pathname, []byte(fmt.Sprintf("content of snapshot %d", i)), 0644))
+
+		snap, err := snapshot.New(repo)
+		require.NoError(t, err)
+		imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+		require.NoError(t, err)
+		require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+		tr.snapshots[snap.Header.Identifier] = pathname
+		snap.Close()
+	}
+	return tr
+}
+
+// open returns the repository as seen by a new client.
+func (tr *testRepository) open(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *repository.Repository {
+	r, serializedConfig, err := storage.Open(map[string]string{"location": tr.repoDir})
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	cache := caching.NewManager(t.TempDir())
+	t.Cleanup(func() { cache.Close() })
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(bufOut, bufErr))
+
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+	return repo
+}
+
+// requireRestorable checks that every snapshot is still listed and that the
+// file it was the last to back up reads back as written.
+func (tr *testRepository) requireRestorable(t *testing.T, repo *repository.Repository) {
+	snapshots, err := repo.GetSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, len(tr.snapshots))
+
+	for snapshotID, pathname := range tr.snapshots {
+		snap, err := snapshot.Load(repo, snapshotID)
+		require.NoError(t, err)
+
+		fsc, err := snap.Filesystem()
+		require.NoError(t, err)
+		fp, err := fsc.Open(pathname)
+		require.NoError(t, err)
+		data, err := io.ReadAll(fp)
+		fp.Close()
+		require.NoError(t, err)
+
+		expected, err := os.ReadFile(pathname)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(data))
+		snap.Close()
+	}
+}
+
+func execute(t *testing.T, repo *repository.Repository, args []string) {
+	ctx := repo.AppContext()
+	subcommand, err := parse_cmd_maintenance(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+}
+
+func TestExecuteCmdMaintenanceCompact(t *testing.T) {
+	tr := generateRepository(t, 4)
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo := tr.open(t, bufOut, bufErr)
+	states, err := repo.GetStates()
+	require.NoError(t, err)
+	require.Len(t, states, len(tr.snapshots))
+
+	execute(t, repo, []string{"-compact"})
+	require.Contains(t, bufOut.String(), fmt.Sprintf("maintenance: compacted %d states", len(states)))
+
+	// a new client only finds the compacted state, under a fresh serial
+	repo = tr.open(t, bufOut, bufErr)
+	states, err = repo.GetStates()
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	tr.requireRestorable(t, repo)
+}
+
+func TestExecuteCmdMaintenanceRepack(t *testing.T) {
+	tr := generateRepository(t, 4)
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo := tr.open(t, bufOut, bufErr)
+	before, err := repo.GetPackfiles()
+	require.NoError(t, err)
+
+	execute(t, repo, []string{"-repack"})
+
+	// the small packfiles are only coloured for deletion, drop them right
+	// away to make sure the snapshots no longer need them
+	repo = tr.open(t, bufOut, bufErr)
+	retired := 0
+	for packfileMAC := range repo.ListDeletedPackfiles() {
+		require.NoError(t, repo.DeletePackfile(packfileMAC))
+		retired++
+	}
+	require.NotZero(t, retired)
+
+	after, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.Less(t, len(after), len(before))
+
+	tr.requireRestorable(t, tr.open(t, bufOut, bufErr))
+}
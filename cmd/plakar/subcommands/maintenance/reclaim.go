@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maintenance
+
+import (
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+// Packfiles in which reachable blobs take less than this percentage of the
+// size are rewritten with their reachable blobs only, unless overridden
+// with -utilization.
+const defaultUtilization = 75
+
+// packfileUsage splits the blobs the state locates in a packfile between
+// the ones reachable from a snapshot and the others.
+type packfileUsage struct {
+	live     []state.DeltaEntry
+	liveSize uint64
+	deadSize uint64
+}
+
+func (u *packfileUsage) size() uint64 {
+	return u.liveSize + u.deadSize
+}
+
+// reachableBlobs walks all the snapshots and returns the blobs they rely
+// on, as well as the packfiles of materialized snapshots which must be
+// kept whole.
+func (cmd *Maintenance) reachableBlobs() (map[blobKey]struct{}, map[objects.MAC]struct{}, error) {
+	reachable := make(map[blobKey]struct{})
+	pinned := make(map[objects.MAC]struct{})
+
+	for snapshotID := range cmd.repository.ListSnapshots() {
+		snap, err := snapshot.Load(cmd.repository, snapshotID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = markSnapshot(snap, reachable, pinned)
+		snap.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("snapshot %x: %w", snapshotID[:4], err)
+		}
+	}
+
+	return reachable, pinned, nil
+}
+
+func markSnapshot(snap *snapshot.Snapshot, reachable map[blobKey]struct{}, pinned map[objects.MAC]struct{}) error {
+	if snap.Header.Synthetic != (objects.MAC{}) {
+		iter, err := snap.ListPackfiles()
+		if err != nil {
+			return err
+		}
+		for packfileMAC, err := range iter {
+			if err != nil {
+				return err
+			}
+			pinned[packfileMAC] = struct{}{}
+		}
+	}
+
+	blobs, err := snap.ListBlobs()
+	if err != nil {
+		return err
+	}
+	for blob, err := range blobs {
+		if err != nil {
+			return err
+		}
+		reachable[blobKey{blob.Type, blob.MAC}] = struct{}{}
+	}
+
+	return nil
+}
+
+// packfilesUsage accounts for the reachable and unreachable blobs of every
+// packfile known to the state.
+func (cmd *Maintenance) packfilesUsage(reachable map[blobKey]struct{}) (map[objects.MAC]*packfileUsage, error) {
+	usage := make(map[objects.MAC]*packfileUsage)
+	for de, err := range cmd.repository.ListBlobs() {
+		if err != nil {
+			return nil, err
+		}
+
+		u, ok := usage[de.Location.Packfile]
+		if !ok {
+			u = &packfileUsage{}
+			usage[de.Location.Packfile] = u
+		}
+
+		if _, ok := reachable[blobKey{de.Type, de.Blob}]; ok {
+			u.live = append(u.live, de)
+			u.liveSize += uint64(de.Location.Length)
+		} else {
+			u.deadSize += uint64(de.Location.Length)
+		}
+	}
+
+	return usage, nil
+}
+
+// partiallyDead returns the packfiles worth rewriting: the ones still
+// holding reachable blobs but below the utilization threshold.  Packfiles
+// holding no reachable blob at all are left to the colouring pass.
+func (cmd *Maintenance) partiallyDead(usage map[objects.MAC]*packfileUsage, pinned map[objects.MAC]struct{}) (map[objects.MAC]*packfileUsage, error) {
+	candidates := make(map[objects.MAC]*packfileUsage)
+	for packfileMAC, u := range usage {
+		if u.liveSize == 0 || u.liveSize*100 >= u.size()*uint64(cmd.Utilization) {
+			continue
+		}
+
+		if _, ok := pinned[packfileMAC]; ok {
+			continue
+		}
+
+		has, err := cmd.repository.HasDeletedPackfile(packfileMAC)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			candidates[packfileMAC] = u
+		}
+	}
+
+	return candidates, nil
+}
+
+// reclaimPass rewrites the packfiles in which blobs became unreachable as
+// the snapshots relying on them were deleted.  The originals are coloured
+// for deletion and removed by a later sweep pass like with -repack.
+func (cmd *Maintenance) reclaimPass(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
+	reachable, pinned, err := cmd.reachableBlobs()
+	if err != nil {
+		return err
+	}
+
+	usage, err := cmd.packfilesUsage(reachable)
+	if err != nil {
+		return err
+	}
+
+	candidates, err := cmd.partiallyDead(usage, pinned)
+	if err != nil {
+		return err
+	}
+
+	if len(candidates) == 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: no packfile to reclaim space from\n")
+		return nil
+	}
+
+	stats, err := cmd.rewriteCandidates(cache, candidates)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.Stdout, "maintenance: rewrote %d partially unreachable packfiles into %d packfiles, reclaiming %s\n",
+		stats.rewritten, stats.written, humanize.Bytes(stats.reclaimed))
+	if stats.deferred != 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: %d packfiles left to rewrite by a later run\n", stats.deferred)
+	}
+	return nil
+}
+
+// dryRun reports what the colouring, sweep and reclaim passes would do
+// and the space they would save, without modifying the repository.
+func (cmd *Maintenance) dryRun(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
+	reachable, pinned, err := cmd.reachableBlobs()
+	if err != nil {
+		return err
+	}
+
+	usage, err := cmd.packfilesUsage(reachable)
+	if err != nil {
+		return err
+	}
+
+	unused, orphaned, err := cmd.unusedPackfiles(cache)
+	if err != nil {
+		return err
+	}
+
+	var colouredSize uint64
+	for packfileMAC := range unused {
+		if size, ok := orphaned[packfileMAC]; ok {
+			colouredSize += size
+		} else if u, ok := usage[packfileMAC]; ok {
+			colouredSize += u.size()
+		}
+	}
+
+	swept := 0
+	var sweptSize uint64
+	for packfileMAC, deletionTime := range cmd.repository.ListDeletedPackfiles() {
+		if deletionTime.After(cmd.cutoff) || cache.HasPackfile(packfileMAC) {
+			continue
+		}
+		swept++
+		if u, ok := usage[packfileMAC]; ok {
+			sweptSize += u.size()
+		}
+	}
+
+	candidates, err := cmd.partiallyDead(usage, pinned)
+	if err != nil {
+		return err
+	}
+
+	var reclaimedSize uint64
+	for packfileMAC, u := range candidates {
+		// packfiles coloured by this run are not rewritten
+		if _, ok := unused[packfileMAC]; ok {
+			delete(candidates, packfileMAC)
+			continue
+		}
+		reclaimedSize += u.deadSize
+	}
+
+	fmt.Fprintf(ctx.Stdout, "maintenance: dry run, the repository is left untouched\n")
+	fmt.Fprintf(ctx.Stdout, "maintenance: %d packfiles (%d orphaned) would be coloured for deletion, holding %s\n",
+		len(unused), len(orphaned), humanize.Bytes(colouredSize))
+	fmt.Fprintf(ctx.Stdout, "maintenance: %d coloured packfiles past the grace period would be removed, holding %s\n",
+		swept, humanize.Bytes(sweptSize))
+	fmt.Fprintf(ctx.Stdout, "maintenance: %d partially unreachable packfiles would be rewritten, reclaiming %s\n",
+		len(candidates), humanize.Bytes(reclaimedSize))
+	fmt.Fprintf(ctx.Stdout, "maintenance: expected savings: %s\n", humanize.Bytes(colouredSize+sweptSize+reclaimedSize))
+	return nil
+}
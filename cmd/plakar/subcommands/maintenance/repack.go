@@ -0,0 +1,368 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maintenance
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/dustin/go-humanize"
+)
+
+// Packfiles holding less than a quarter of the configured maximum size are
+// considered for repacking.
+const repackThresholdDivisor = 4
+
+type blobKey struct {
+	Type resources.Type
+	MAC  objects.MAC
+}
+
+// livePackfiles returns the live blobs of the packfiles that are not
+// coloured for deletion and that keep is true for, grouped by packfile.
+func (cmd *Maintenance) livePackfiles(keep func(packfileMAC objects.MAC, size uint64) bool) (map[objects.MAC][]state.DeltaEntry, error) {
+	sizes := make(map[objects.MAC]uint64)
+	for de, err := range cmd.repository.ListBlobs() {
+		if err != nil {
+			return nil, err
+		}
+		sizes[de.Location.Packfile] += uint64(de.Location.Length)
+	}
+
+	live := make(map[objects.MAC][]state.DeltaEntry)
+	for packfileMAC, size := range sizes {
+		if !keep(packfileMAC, size) {
+			continue
+		}
+
+		has, err := cmd.repository.HasDeletedPackfile(packfileMAC)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			live[packfileMAC] = nil
+		}
+	}
+
+	for de, err := range cmd.repository.ListBlobs() {
+		if err != nil {
+			return nil, err
+		}
+		if entries, ok := live[de.Location.Packfile]; ok {
+			live[de.Location.Packfile] = append(entries, de)
+		}
+	}
+
+	return live, nil
+}
+
+// smallPackfiles returns the packfiles below the repack threshold which
+// still hold reachable blobs.
+func (cmd *Maintenance) smallPackfiles(usage map[objects.MAC]*packfileUsage, pinned map[objects.MAC]struct{}) (map[objects.MAC]*packfileUsage, error) {
+	threshold := cmd.repository.Configuration().Packfile.MaxSize / repackThresholdDivisor
+
+	small := make(map[objects.MAC]*packfileUsage)
+	for packfileMAC, u := range usage {
+		if u.liveSize == 0 || u.size() >= threshold {
+			continue
+		}
+
+		if _, ok := pinned[packfileMAC]; ok {
+			continue
+		}
+
+		has, err := cmd.repository.HasDeletedPackfile(packfileMAC)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			small[packfileMAC] = u
+		}
+	}
+
+	return small, nil
+}
+
+// packfileRewriter copies blobs, still encoded, from existing packfiles into
+// new ones of the configured size.  The new locations are recorded in a
+// delta state and the original packfiles are coloured for deletion so that
+// the sweep pass of a later run removes them once past the grace period.
+type packfileRewriter struct {
+	repository *repository.Repository
+	id         objects.MAC
+	sc         *caching.ScanCache
+	deltaState *state.LocalState
+	budget     *rewriteBudget
+
+	pending *packfile.PackFile
+	written int
+	copied  map[blobKey]struct{}
+	retired []objects.MAC
+}
+
+func (cmd *Maintenance) newPackfileRewriter() (*packfileRewriter, error) {
+	var id objects.MAC
+	if n, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	} else if n != len(id) {
+		return nil, io.ErrShortWrite
+	}
+
+	sc, err := cmd.repository.AppContext().GetCache().Scan(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packfileRewriter{
+		repository: cmd.repository,
+		id:         id,
+		sc:         sc,
+		deltaState: cmd.repository.NewStateDelta(sc),
+		budget:     cmd.budget,
+		pending:    packfile.New(cmd.repository.GetMACHasher()),
+		copied:     make(map[blobKey]struct{}),
+	}, nil
+}
+
+func (w *packfileRewriter) Close() error {
+	return w.sc.Close()
+}
+
+func (w *packfileRewriter) flush() error {
+	if w.pending.Footer.Count == 0 {
+		return nil
+	}
+
+	size := w.pending.Size()
+	mac, err := w.repository.WritePackfile(w.pending)
+	if err != nil {
+		return err
+	}
+	w.budget.written(uint64(size))
+
+	for _, blob := range w.pending.Index {
+		delta := state.DeltaEntry{
+			Type:    blob.Type,
+			Version: blob.Version,
+			Blob:    blob.MAC,
+			Location: state.Location{
+				Packfile: mac,
+				Offset:   blob.Offset,
+				Length:   blob.Length,
+			},
+		}
+		if err := w.deltaState.PutDelta(delta); err != nil {
+			return err
+		}
+	}
+
+	if err := w.deltaState.PutPackfile(w.id, mac); err != nil {
+		return err
+	}
+
+	w.written++
+	w.pending = packfile.New(w.repository.GetMACHasher())
+	return nil
+}
+
+// fetch reads a packfile to rewrite, accounting for it in the budget.
+func (w *packfileRewriter) fetch(packfileMAC objects.MAC) (*packfile.PackFile, error) {
+	p, err := w.repository.GetPackfile(packfileMAC)
+	if err != nil {
+		return nil, err
+	}
+	w.budget.fetched(uint64(len(p.Blobs)))
+	return p, nil
+}
+
+// rewrite copies the given live blobs of a packfile and retires it.
+func (w *packfileRewriter) rewrite(packfileMAC objects.MAC, p *packfile.PackFile, entries []state.DeltaEntry) error {
+	flags := make(map[blobKey]uint32, len(p.Index))
+	for _, blob := range p.Index {
+		flags[blobKey{blob.Type, blob.MAC}] = blob.Flags
+	}
+
+	for _, de := range entries {
+		key := blobKey{de.Type, de.Blob}
+		if _, ok := w.copied[key]; ok {
+			continue
+		}
+
+		end := de.Location.Offset + uint64(de.Location.Length)
+		if end > uint64(len(p.Blobs)) {
+			return fmt.Errorf("blob %x out of bounds of packfile %x", de.Blob, packfileMAC)
+		}
+
+		w.pending.AddBlob(de.Type, de.Version, de.Blob, p.Blobs[de.Location.Offset:end], flags[key])
+		w.copied[key] = struct{}{}
+
+		if w.pending.Size() > uint32(w.repository.Configuration().Packfile.MaxSize) {
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.retired = append(w.retired, packfileMAC)
+	return nil
+}
+
+// commit writes the pending packfile and the delta state recording the
+// rewrite.
+func (w *packfileRewriter) commit(cache *caching.MaintenanceCache) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	for _, packfileMAC := range w.retired {
+		if err := w.deltaState.DeleteResource(resources.RT_PACKFILE, packfileMAC); err != nil {
+			return err
+		}
+
+		// Snapshots resolved to the retired packfile must be resolved
+		// again, or the sweep pass would consider it still in use.
+		for snapshotID := range cache.GetSnapshots(packfileMAC) {
+			cache.DeleletePackfiles(snapshotID)
+			cache.DeleteSnapshot(snapshotID)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := w.deltaState.SerializeToStream(buf); err != nil {
+		return err
+	}
+
+	return w.repository.PutState(w.id, buf)
+}
+
+// rewriteStats sums up the work of a pass rewriting packfiles.
+type rewriteStats struct {
+	rewritten int
+	written   int
+	blobs     int
+	reclaimed uint64
+	deferred  int
+}
+
+// rewriteCandidates rewrites the reachable blobs of the candidate packfiles
+// into new ones, recorded along with the retirement of the candidates by a
+// single delta state, so that the repository never sees a partial rewrite.
+// The least utilized packfiles go first so that a run cut short by the
+// budget reclaims as much as it can, the candidates left over are rewritten
+// by a later run.
+func (cmd *Maintenance) rewriteCandidates(cache *caching.MaintenanceCache, candidates map[objects.MAC]*packfileUsage) (*rewriteStats, error) {
+	order := slices.SortedFunc(maps.Keys(candidates), func(a, b objects.MAC) int {
+		ua, ub := candidates[a], candidates[b]
+		return cmp.Compare(ua.liveSize*ub.size(), ub.liveSize*ua.size())
+	})
+
+	w, err := cmd.newPackfileRewriter()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	stats := &rewriteStats{}
+	for i, packfileMAC := range order {
+		u := candidates[packfileMAC]
+		if !w.budget.allows(u.size()) {
+			stats.deferred = len(order) - i
+			break
+		}
+
+		p, err := w.fetch(packfileMAC)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := w.rewrite(packfileMAC, p, u.live); err != nil {
+			return nil, err
+		}
+		stats.rewritten++
+		stats.reclaimed += u.deadSize
+	}
+
+	if err := w.commit(cache); err != nil {
+		return nil, err
+	}
+
+	stats.written = w.written
+	stats.blobs = len(w.copied)
+	return stats, nil
+}
+
+// repackPass rewrites the packfiles below the utilization threshold, as
+// for the reclaim pass, and coalesces the small packfiles left by tiny
+// backups into packfiles of the configured size.
+func (cmd *Maintenance) repackPass(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
+	reachable, pinned, err := cmd.reachableBlobs()
+	if err != nil {
+		return err
+	}
+
+	usage, err := cmd.packfilesUsage(reachable)
+	if err != nil {
+		return err
+	}
+
+	candidates, err := cmd.partiallyDead(usage, pinned)
+	if err != nil {
+		return err
+	}
+
+	small, err := cmd.smallPackfiles(usage, pinned)
+	if err != nil {
+		return err
+	}
+
+	// a small packfile alone has nothing to be coalesced with
+	for packfileMAC := range candidates {
+		delete(small, packfileMAC)
+	}
+	if len(small) > 1 || len(candidates) != 0 {
+		maps.Copy(candidates, small)
+	}
+
+	if len(candidates) == 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: nothing to repack\n")
+		return nil
+	}
+
+	stats, err := cmd.rewriteCandidates(cache, candidates)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.Stdout, "maintenance: repacked %d blobs from %d packfiles into %d packfiles, reclaiming %s\n",
+		stats.blobs, stats.rewritten, stats.written, humanize.Bytes(stats.reclaimed))
+	if stats.deferred != 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: %d packfiles left to repack by a later run\n", stats.deferred)
+	}
+	return nil
+}
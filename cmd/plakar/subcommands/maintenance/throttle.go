@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maintenance
+
+import (
+	"time"
+)
+
+// rewriteBudget paces and bounds the transfers of the passes rewriting
+// packfiles, which may otherwise saturate the link to a cloud backend or
+// run up its egress charges.
+type rewriteBudget struct {
+	rate    uint64 // bytes per second, 0 for unlimited
+	maxSize uint64 // bytes read per run, 0 for unlimited
+
+	start       time.Time
+	transferred uint64
+	read        uint64
+}
+
+func newRewriteBudget(rate uint64, maxSize uint64) *rewriteBudget {
+	return &rewriteBudget{
+		rate:    rate,
+		maxSize: maxSize,
+		start:   time.Now(),
+	}
+}
+
+// allows reports whether a packfile of the given size may still be read
+// during this run.  The first one always is, so that a run makes progress
+// whatever the limit.
+func (b *rewriteBudget) allows(size uint64) bool {
+	if b.maxSize == 0 || b.read == 0 {
+		return true
+	}
+	return b.read+size <= b.maxSize
+}
+
+// fetched accounts for n bytes read from the repository.
+func (b *rewriteBudget) fetched(n uint64) {
+	b.read += n
+	b.pace(n)
+}
+
+// written accounts for n bytes written to the repository.
+func (b *rewriteBudget) written(n uint64) {
+	b.pace(n)
+}
+
+// pace sleeps as long as needed to keep the average transfer rate of the
+// run below the limit.
+func (b *rewriteBudget) pace(n uint64) {
+	b.transferred += n
+	if b.rate == 0 {
+		return
+	}
+
+	expected := time.Duration(float64(b.transferred) / float64(b.rate) * float64(time.Second))
+	if elapsed := time.Since(b.start); elapsed < expected {
+		time.Sleep(expected - elapsed)
+	}
+}
@@ -0,0 +1,37 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteBudgetMaxSize(t *testing.T) {
+	b := newRewriteBudget(0, 100)
+
+	// the first packfile is always allowed so that a run makes progress
+	require.True(t, b.allows(150))
+	b.fetched(150)
+	require.False(t, b.allows(1))
+
+	b = newRewriteBudget(0, 100)
+	require.True(t, b.allows(60))
+	b.fetched(60)
+	b.written(60)
+	require.True(t, b.allows(40))
+	require.False(t, b.allows(41))
+
+	b = newRewriteBudget(0, 0)
+	b.fetched(1 << 40)
+	require.True(t, b.allows(1<<40))
+}
+
+func TestRewriteBudgetRate(t *testing.T) {
+	b := newRewriteBudget(1000, 0)
+
+	t0 := time.Now()
+	b.fetched(100)
+	b.written(100)
+	require.GreaterOrEqual(t, time.Since(t0), 200*time.Millisecond)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maintenance
+
+import (
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/versioning"
+)
+
+// outdatedPackfile returns true if a packfile was written with an older
+// format version or with other features than the current ones.
+func (cmd *Maintenance) outdatedPackfile(footer packfile.PackFileFooter) bool {
+	if footer.Version != versioning.GetCurrentVersion(resources.RT_PACKFILE) {
+		return true
+	}
+	return footer.Flags != cmd.repository.PackfileFeatures()
+}
+
+// upgradePass rewrites the packfiles written with an older format so that
+// they carry the current version and feature bits.  The blobs themselves
+// are copied as is.
+func (cmd *Maintenance) upgradePass(ctx *appcontext.AppContext, cache *caching.MaintenanceCache) error {
+	live, err := cmd.livePackfiles(func(objects.MAC, uint64) bool {
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	w, err := cmd.newPackfileRewriter()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	deferred := 0
+	for packfileMAC, entries := range live {
+		footer, _, err := cmd.repository.GetPackfileIndex(packfileMAC)
+		if err != nil {
+			return err
+		}
+		if !cmd.outdatedPackfile(footer) {
+			continue
+		}
+
+		var size uint64
+		for _, de := range entries {
+			size += uint64(de.Location.Length)
+		}
+		if !w.budget.allows(size) {
+			deferred++
+			continue
+		}
+
+		p, err := w.fetch(packfileMAC)
+		if err != nil {
+			return err
+		}
+
+		if err := w.rewrite(packfileMAC, p, entries); err != nil {
+			return err
+		}
+	}
+
+	if len(w.retired) == 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: all packfiles are up to date\n")
+		return nil
+	}
+
+	if err := w.commit(cache); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.Stdout, "maintenance: upgraded %d packfiles into %d packfiles\n", len(w.retired), w.written)
+	if deferred != 0 {
+		fmt.Fprintf(ctx.Stdout, "maintenance: %d packfiles left to upgrade by a later run\n", deferred)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package materialize
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("materialize", parse_cmd_materialize)
+}
+
+func parse_cmd_materialize(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("materialize", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s SNAPSHOT...\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return nil, fmt.Errorf("at least one parameter is required")
+	}
+
+	return &Materialize{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Snapshots:          flags.Args(),
+	}, nil
+}
+
+type Materialize struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Snapshots []string
+}
+
+func (cmd *Materialize) Name() string {
+	return "materialize"
+}
+
+func (cmd *Materialize) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	errors := 0
+	for _, prefix := range cmd.Snapshots {
+		snapshotID, err := utils.LocateSnapshotByPrefix(repo, prefix)
+		if err != nil {
+			ctx.GetLogger().Error("materialize: %s: %s", prefix, err)
+			errors++
+			continue
+		}
+
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			ctx.GetLogger().Error("materialize: %x: %s", snapshotID[:4], err)
+			errors++
+			continue
+		}
+
+		syntheticID, err := snap.Materialize()
+		snap.Close()
+		if err != nil {
+			ctx.GetLogger().Error("materialize: %x: %s", snapshotID[:4], err)
+			errors++
+			continue
+		}
+
+		fmt.Fprintf(ctx.Stdout, "materialize: created snapshot %x from %x\n", syntheticID[:4], snapshotID[:4])
+	}
+
+	if errors != 0 {
+		return 1, fmt.Errorf("failed to materialize %d snapshots", errors)
+	}
+	return 0, nil
+}
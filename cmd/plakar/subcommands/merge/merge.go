@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package merge
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("merge", parse_cmd_merge)
+}
+
+func parse_cmd_merge(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_union bool
+	var opt_sequence bool
+	var opt_name string
+	var opt_tags string
+
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s -union | -sequence [OPTIONS] SNAPSHOT SNAPSHOT...\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.BoolVar(&opt_union, "union", false, "merge the trees, keeping the most recent entry on collisions")
+	flags.BoolVar(&opt_sequence, "sequence", false, "replay the snapshots in order, applying their deletions")
+	flags.StringVar(&opt_name, "o", "", "name of the merged snapshot")
+	flags.StringVar(&opt_tags, "tag", "", "comma-separated list of tags to assign to the merged snapshot")
+	flags.Parse(args)
+
+	if opt_union == opt_sequence {
+		return nil, fmt.Errorf("exactly one merge mode is required: -union or -sequence")
+	}
+	if flags.NArg() < 2 {
+		return nil, fmt.Errorf("at least two snapshots are required")
+	}
+
+	return &Merge{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		SnapshotName:       opt_name,
+		Tags:               opt_tags,
+		Sequence:           opt_sequence,
+		Snapshots:          flags.Args(),
+	}, nil
+}
+
+type Merge struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotName string
+	Tags         string
+	Sequence     bool
+	Snapshots    []string
+}
+
+func (cmd *Merge) Name() string {
+	return "merge"
+}
+
+func (cmd *Merge) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snapshots := make([]*snapshot.Snapshot, 0, len(cmd.Snapshots))
+	defer func() {
+		for _, snap := range snapshots {
+			snap.Close()
+		}
+	}()
+
+	for _, prefix := range cmd.Snapshots {
+		snapshotID, err := utils.LocateSnapshotByPrefix(repo, prefix)
+		if err != nil {
+			return 1, fmt.Errorf("merge: %s: %w", prefix, err)
+		}
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return 1, fmt.Errorf("merge: %x: %w", snapshotID[:4], err)
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	tags := []string{}
+	for _, tag := range strings.Split(cmd.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	mergedID, err := snapshot.Merge(repo, snapshots, &snapshot.MergeOptions{
+		Name:     cmd.SnapshotName,
+		Tags:     tags,
+		Sequence: cmd.Sequence,
+	})
+	if err != nil {
+		return 1, fmt.Errorf("merge: %w", err)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "merge: created snapshot %x\n", mergedID[:4])
+	return 0, nil
+}
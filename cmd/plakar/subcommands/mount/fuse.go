@@ -23,6 +23,8 @@ import (
 	"fmt"
 
 	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/plakarfs"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/anacrolix/fuse"
@@ -30,6 +32,8 @@ import (
 )
 
 func (cmd *Mount) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	repo.EnableNodeCache()
+
 	c, err := fuse.Mount(
 		cmd.Mountpoint,
 		fuse.FSName("plakar"),
@@ -42,7 +46,19 @@ func (cmd *Mount) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 	defer c.Close()
 	ctx.GetLogger().Info("mounted repository %s at %s", repo.Location(), cmd.Mountpoint)
 
-	err = fs.Serve(c, plakarfs.NewFS(repo, cmd.Mountpoint))
+	locate := func() ([]objects.MAC, error) {
+		locateOptions := utils.NewDefaultLocateOptions()
+		locateOptions.MaxConcurrency = ctx.MaxConcurrency
+		locateOptions.Name = cmd.OptName
+		locateOptions.Category = cmd.OptCategory
+		locateOptions.Environment = cmd.OptEnvironment
+		locateOptions.Perimeter = cmd.OptPerimeter
+		locateOptions.Job = cmd.OptJob
+		locateOptions.Tag = cmd.OptTag
+		return utils.LocateSnapshotIDs(repo, locateOptions)
+	}
+
+	err = fs.Serve(c, plakarfs.NewFS(repo, cmd.Mountpoint, locate))
 	if err != nil {
 		return 1, err
 	}
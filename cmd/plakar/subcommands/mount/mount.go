@@ -30,10 +30,25 @@ func init() {
 }
 
 func parse_cmd_mount(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_name string
+	var opt_category string
+	var opt_environment string
+	var opt_perimeter string
+	var opt_job string
+	var opt_tag string
+
 	flags := flag.NewFlagSet("mount", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
 	}
+	flags.StringVar(&opt_name, "name", "", "filter by name")
+	flags.StringVar(&opt_category, "category", "", "filter by category")
+	flags.StringVar(&opt_environment, "environment", "", "filter by environment")
+	flags.StringVar(&opt_perimeter, "perimeter", "", "filter by perimeter")
+	flags.StringVar(&opt_job, "job", "", "filter by job")
+	flags.StringVar(&opt_tag, "tag", "", "filter by tag")
 	flags.Parse(args)
 
 	if flags.NArg() != 1 {
@@ -44,6 +59,13 @@ func parse_cmd_mount(ctx *appcontext.AppContext, repo *repository.Repository, ar
 		RepositoryLocation: repo.Location(),
 		RepositorySecret:   ctx.GetSecret(),
 		Mountpoint:         flags.Arg(0),
+
+		OptName:        opt_name,
+		OptCategory:    opt_category,
+		OptEnvironment: opt_environment,
+		OptPerimeter:   opt_perimeter,
+		OptJob:         opt_job,
+		OptTag:         opt_tag,
 	}, nil
 }
 
@@ -52,6 +74,13 @@ type Mount struct {
 	RepositorySecret   []byte
 
 	Mountpoint string
+
+	OptName        string
+	OptCategory    string
+	OptEnvironment string
+	OptPerimeter   string
+	OptJob         string
+	OptTag         string
 }
 
 func (cmd *Mount) Name() string {
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package passwd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+func init() {
+	subcommands.Register("passwd", parse_cmd_passwd)
+}
+
+func parse_cmd_passwd(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_allowweak bool
+
+	flags := flag.NewFlagSet("passwd", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.BoolVar(&opt_allowweak, "weak-passphrase", false, "allow weak passphrase to protect the repository")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("too many parameters")
+	}
+
+	if repo.Configuration().Encryption == nil {
+		return nil, fmt.Errorf("repository is not encrypted")
+	}
+
+	minEntropyBits := 80.
+	if opt_allowweak {
+		minEntropyBits = 0.
+	}
+
+	var passphrase []byte
+	if envPassphrase := os.Getenv("PLAKAR_NEW_PASSPHRASE"); envPassphrase != "" {
+		passphrase = []byte(envPassphrase)
+	} else {
+		for attempt := 0; attempt < 3; attempt++ {
+			tmp, err := utils.GetPassphraseConfirm("new repository", minEntropyBits)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			passphrase = tmp
+			break
+		}
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("can't encrypt the repository with an empty passphrase")
+	}
+
+	return &Passwd{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		NewPassphrase:      passphrase,
+	}, nil
+}
+
+type Passwd struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	NewPassphrase []byte
+}
+
+func (cmd *Passwd) Name() string {
+	return "passwd"
+}
+
+func (cmd *Passwd) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	config := repo.Configuration()
+	if config.Encryption == nil {
+		return 1, fmt.Errorf("repository is not encrypted")
+	}
+
+	secret := ctx.GetSecret()
+	if !encryption.VerifyCanary(config.Encryption, secret) {
+		return 1, fmt.Errorf("could not verify the current repository key")
+	}
+
+	// the master key is kept as is, only the way it is derived from the
+	// passphrase changes: data does not need to be re-encrypted.
+	kdfParams, err := encryption.RewrapKey(config.Encryption.KDFParams, secret, cmd.NewPassphrase)
+	if err != nil {
+		return 1, err
+	}
+	encryptionConfig := *config.Encryption
+	encryptionConfig.KDFParams = *kdfParams
+	config.Encryption = &encryptionConfig
+
+	serializedConfig, err := config.ToBytes()
+	if err != nil {
+		return 1, err
+	}
+
+	hasher := hashing.GetMACHasher(storage.DEFAULT_HASHING_ALGORITHM, secret)
+	rd, err := storage.Serialize(hasher, resources.RT_CONFIG, config.FormatVersion(), bytes.NewReader(serializedConfig))
+	if err != nil {
+		return 1, err
+	}
+	wrappedConfig, err := io.ReadAll(rd)
+	if err != nil {
+		return 1, err
+	}
+
+	if err := repo.Store().PutConfig(wrappedConfig); err != nil {
+		return 1, err
+	}
+
+	ctx.GetLogger().Info("%s: repository passphrase changed", cmd.Name())
+	return 0, nil
+}
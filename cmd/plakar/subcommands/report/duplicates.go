@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/dustin/go-humanize"
+)
+
+type ReportDuplicates struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotPath string
+	Limit        int
+}
+
+func (cmd *ReportDuplicates) Name() string {
+	return "report_duplicates"
+}
+
+type duplicateSet struct {
+	object objects.MAC
+	size   int64
+	paths  []string
+}
+
+// wasted returns the space that would be used by the copies if they were
+// not deduplicated by the repository.
+func (d *duplicateSet) wasted() uint64 {
+	return uint64(d.size) * uint64(len(d.paths)-1)
+}
+
+func (cmd *ReportDuplicates) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not open snapshot: %w", err)
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return 1, fmt.Errorf("report: could not get filesystem: %w", err)
+	}
+
+	sets := make(map[objects.MAC]*duplicateSet)
+	for entry, err := range fs.Files(pathname) {
+		if err != nil {
+			return 1, fmt.Errorf("report: could not get entry: %w", err)
+		}
+		if !entry.FileInfo.Mode().IsRegular() || !entry.HasObject() || entry.Size() == 0 {
+			continue
+		}
+
+		set, exists := sets[entry.Object]
+		if !exists {
+			set = &duplicateSet{object: entry.Object, size: entry.Size()}
+			sets[entry.Object] = set
+		}
+		set.paths = append(set.paths, entry.Path())
+	}
+
+	duplicates := make([]*duplicateSet, 0)
+	for _, set := range sets {
+		if len(set.paths) > 1 {
+			sort.Strings(set.paths)
+			duplicates = append(duplicates, set)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].wasted() != duplicates[j].wasted() {
+			return duplicates[i].wasted() > duplicates[j].wasted()
+		}
+		return duplicates[i].paths[0] < duplicates[j].paths[0]
+	})
+	if cmd.Limit != 0 && len(duplicates) > cmd.Limit {
+		duplicates = duplicates[:cmd.Limit]
+	}
+
+	for _, set := range duplicates {
+		fmt.Fprintf(ctx.Stdout, "%x: %d copies of %s (%s redundant)\n", set.object[:4],
+			len(set.paths), humanize.Bytes(uint64(set.size)), humanize.Bytes(set.wasted()))
+		for _, path := range set.paths {
+			fmt.Fprintf(ctx.Stdout, "  %x:%s\n", snap.Header.GetIndexShortID(), path)
+		}
+	}
+	return 0, nil
+}
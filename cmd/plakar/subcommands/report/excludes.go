@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/dustin/go-humanize"
+)
+
+type ReportExcludes struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotPath string
+	MinSize      uint64
+	Apply        string
+
+	// stdin answers the confirmation prompt of Apply
+	stdin io.Reader
+}
+
+func (cmd *ReportExcludes) Name() string {
+	return "report_excludes"
+}
+
+func (cmd *ReportExcludes) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if cmd.Apply != "" && !ctx.Config.HasSchedule(cmd.Apply) {
+		return 1, fmt.Errorf("report: schedule %q does not exist", cmd.Apply)
+	}
+
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not open snapshot: %w", err)
+	}
+	defer snap.Close()
+
+	suggestions, err := snap.SuggestExcludes(pathname, cmd.MinSize)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not analyze snapshot: %w", err)
+	}
+	if len(suggestions) == 0 {
+		fmt.Fprintf(ctx.Stdout, "no exclude to suggest\n")
+		return 0, nil
+	}
+
+	var total uint64
+	for _, s := range suggestions {
+		fmt.Fprintf(ctx.Stdout, "%10s %s (%d paths, %s)\n", humanize.IBytes(s.Size), s.Pattern, s.Paths, s.Reason)
+		total += s.Size
+	}
+	fmt.Fprintf(ctx.Stdout, "excluding them would save %s per full backup\n", humanize.IBytes(total))
+
+	if cmd.Apply == "" {
+		return 0, nil
+	}
+
+	schedule, _ := ctx.Config.GetSchedule(cmd.Apply)
+	var added []string
+	for _, s := range suggestions {
+		if !slices.Contains(schedule.Excludes, s.Pattern) && !slices.Contains(added, s.Pattern) {
+			added = append(added, s.Pattern)
+		}
+	}
+	if len(added) == 0 {
+		fmt.Fprintf(ctx.Stdout, "schedule %s already excludes them\n", cmd.Apply)
+		return 0, nil
+	}
+
+	fmt.Fprintf(ctx.Stdout, "add %d patterns to the excludes of schedule %s? [y/N] ", len(added), cmd.Apply)
+	answer, err := bufio.NewReader(cmd.stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 1, fmt.Errorf("report: could not read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+	default:
+		fmt.Fprintf(ctx.Stdout, "schedule %s left unchanged\n", cmd.Apply)
+		return 0, nil
+	}
+
+	schedule.Excludes = append(slices.Clone(schedule.Excludes), added...)
+	ctx.Config.Schedules[cmd.Apply] = schedule
+	if err := ctx.Config.Save(); err != nil {
+		return 1, fmt.Errorf("report: could not save configuration: %w", err)
+	}
+	fmt.Fprintf(ctx.Stdout, "schedule %s now excludes %d patterns\n", cmd.Apply, len(schedule.Excludes))
+	return 0, nil
+}
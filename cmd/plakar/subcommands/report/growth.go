@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/dustin/go-humanize"
+)
+
+type ReportGrowth struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotPath1 string
+	SnapshotPath2 string
+	Limit         int
+}
+
+func (cmd *ReportGrowth) Name() string {
+	return "report_growth"
+}
+
+type directoryGrowth struct {
+	path   string
+	before uint64
+	after  uint64
+}
+
+func (d directoryGrowth) delta() int64 {
+	return int64(d.after) - int64(d.before)
+}
+
+func (d directoryGrowth) magnitude() uint64 {
+	if d.after > d.before {
+		return d.after - d.before
+	}
+	return d.before - d.after
+}
+
+// directorySizes returns the cumulative size of every directory below the
+// given snapshot path, as recorded in the summaries computed at backup time.
+func directorySizes(repo *repository.Repository, snapshotPath string) (map[string]uint64, string, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, snapshotPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("report: could not open snapshot: %w", err)
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return nil, "", fmt.Errorf("report: could not get filesystem: %w", err)
+	}
+
+	sizes := make(map[string]uint64)
+	for entry, err := range fs.Files(pathname) {
+		if err != nil {
+			return nil, "", fmt.Errorf("report: could not get entry: %w", err)
+		}
+		if !entry.IsDir() || entry.Summary == nil {
+			continue
+		}
+		sizes[entry.Path()] = directorySize(entry.Summary)
+	}
+	return sizes, fmt.Sprintf("%x", snap.Header.GetIndexShortID()), nil
+}
+
+func directorySize(summary *vfs.Summary) uint64 {
+	return summary.Directory.Size + summary.Below.Size
+}
+
+func (cmd *ReportGrowth) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	before, _, err := directorySizes(repo, cmd.SnapshotPath1)
+	if err != nil {
+		return 1, err
+	}
+
+	after, shortID, err := directorySizes(repo, cmd.SnapshotPath2)
+	if err != nil {
+		return 1, err
+	}
+
+	// directories that only exist on one side grew from, or shrank to,
+	// nothing.
+	changes := make([]directoryGrowth, 0)
+	for path, size := range after {
+		if size != before[path] {
+			changes = append(changes, directoryGrowth{path: path, before: before[path], after: size})
+		}
+	}
+	for path, size := range before {
+		if _, exists := after[path]; !exists && size != 0 {
+			changes = append(changes, directoryGrowth{path: path, before: size})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].magnitude() != changes[j].magnitude() {
+			return changes[i].magnitude() > changes[j].magnitude()
+		}
+		return changes[i].path < changes[j].path
+	})
+	if cmd.Limit != 0 && len(changes) > cmd.Limit {
+		changes = changes[:cmd.Limit]
+	}
+
+	for _, change := range changes {
+		sign := "+"
+		if change.delta() < 0 {
+			sign = "-"
+		}
+		fmt.Fprintf(ctx.Stdout, "%11s %10s -> %-10s %s:%s\n", sign+humanize.Bytes(change.magnitude()),
+			humanize.Bytes(change.before), humanize.Bytes(change.after), shortID, change.path)
+	}
+	return 0, nil
+}
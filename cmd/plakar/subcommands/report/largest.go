@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/dustin/go-humanize"
+)
+
+type ReportLargest struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	SnapshotPath string
+	Limit        int
+}
+
+func (cmd *ReportLargest) Name() string {
+	return "report_largest"
+}
+
+type largestFile struct {
+	path string
+	size int64
+}
+
+func (cmd *ReportLargest) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotPath)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not open snapshot: %w", err)
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return 1, fmt.Errorf("report: could not get filesystem: %w", err)
+	}
+
+	// keep the list sorted by decreasing size and bounded to the limit,
+	// so that memory usage does not grow with the number of files.
+	largest := make([]largestFile, 0)
+	for entry, err := range fs.Files(pathname) {
+		if err != nil {
+			return 1, fmt.Errorf("report: could not get entry: %w", err)
+		}
+		if !entry.FileInfo.Mode().IsRegular() {
+			continue
+		}
+
+		size := entry.Size()
+		if cmd.Limit != 0 && len(largest) == cmd.Limit && size <= largest[len(largest)-1].size {
+			continue
+		}
+
+		idx := sort.Search(len(largest), func(i int) bool {
+			return largest[i].size < size
+		})
+		largest = append(largest, largestFile{})
+		copy(largest[idx+1:], largest[idx:])
+		largest[idx] = largestFile{path: entry.Path(), size: size}
+
+		if cmd.Limit != 0 && len(largest) > cmd.Limit {
+			largest = largest[:cmd.Limit]
+		}
+	}
+
+	for _, file := range largest {
+		fmt.Fprintf(ctx.Stdout, "%10s %x:%s\n", humanize.Bytes(uint64(file.size)), snap.Header.GetIndexShortID(), file.path)
+	}
+	return 0, nil
+}
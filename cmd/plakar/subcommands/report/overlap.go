@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package report
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/dustin/go-humanize"
+)
+
+type ReportOverlap struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Peer string
+}
+
+func (cmd *ReportOverlap) Name() string {
+	return "report_overlap"
+}
+
+// chunkSet holds the chunks of a repository with their size in storage.
+type chunkSet struct {
+	chunks map[objects.MAC]uint64
+	size   uint64
+}
+
+func (s *chunkSet) count() int {
+	return len(s.chunks)
+}
+
+// listChunks gathers the chunks known to the state of a repository, so
+// that no data is read.
+func listChunks(repo *repository.Repository) (*chunkSet, error) {
+	set := &chunkSet{chunks: make(map[objects.MAC]uint64)}
+	for de, err := range repo.ListBlobs() {
+		if err != nil {
+			return nil, err
+		}
+		if de.Type != resources.RT_CHUNK {
+			continue
+		}
+		if _, ok := set.chunks[de.Blob]; ok {
+			continue
+		}
+		set.chunks[de.Blob] = uint64(de.Location.Length)
+		set.size += uint64(de.Location.Length)
+	}
+	return set, nil
+}
+
+// difference returns the chunks of s that other doesn't hold.
+func (s *chunkSet) difference(other *chunkSet) *chunkSet {
+	set := &chunkSet{chunks: make(map[objects.MAC]uint64)}
+	for mac, size := range s.chunks {
+		if _, ok := other.chunks[mac]; !ok {
+			set.chunks[mac] = size
+			set.size += size
+		}
+	}
+	return set
+}
+
+// openPeer opens the repository to compare with, given as a location or an
+// @name reference.  Chunk MACs are keyed per repository, so it must be a
+// clone sharing the configuration, and thus the secret, of repo.  As the
+// state cache is keyed by repository ID, the peer gets its own temporary
+// cache rather than having its state merged into that of repo.
+func openPeer(ctx *appcontext.AppContext, repo *repository.Repository, location string) (*repository.Repository, func(), error) {
+	storeConfig := map[string]string{"location": location}
+	if strings.HasPrefix(location, "@") {
+		remote, err := ctx.Config.GetRepository(location[1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not resolve repository: %s: %w", location, err)
+		}
+		if _, ok := remote["location"]; !ok {
+			return nil, nil, fmt.Errorf("could not resolve repository location: %s", location)
+		}
+		storeConfig = remote
+	}
+
+	store, serializedConfig, err := storage.Open(storeConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open repository %s: %w", location, err)
+	}
+
+	cacheDir, err := os.MkdirTemp("", "plakar-overlap-")
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	cache := caching.NewManager(cacheDir)
+
+	peerCtx := appcontext.NewAppContextFrom(ctx)
+	peerCtx.SetCache(cache)
+	peer, err := repository.NewNoRebuild(peerCtx, store, serializedConfig)
+	if err != nil {
+		cache.Close()
+		os.RemoveAll(cacheDir)
+		store.Close()
+		return nil, nil, fmt.Errorf("could not open repository %s: %w", location, err)
+	}
+	closePeer := func() {
+		peer.Close()
+		cache.Close()
+		os.RemoveAll(cacheDir)
+		store.Close()
+	}
+
+	if peer.Configuration().RepositoryID != repo.Configuration().RepositoryID {
+		closePeer()
+		return nil, nil, fmt.Errorf("%s is not a clone of %s, chunks of unrelated repositories can't be compared", location, repo.Location())
+	}
+
+	if err := peer.RebuildState(); err != nil {
+		closePeer()
+		return nil, nil, fmt.Errorf("could not load the state of %s: %w", location, err)
+	}
+	return peer, closePeer, nil
+}
+
+func percentOf(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+func (cmd *ReportOverlap) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	peer, closePeer, err := openPeer(ctx, repo, cmd.Peer)
+	if err != nil {
+		return 1, fmt.Errorf("report: %w", err)
+	}
+	defer closePeer()
+
+	local, err := listChunks(repo)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not list chunks of %s: %w", repo.Location(), err)
+	}
+	remote, err := listChunks(peer)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not list chunks of %s: %w", peer.Location(), err)
+	}
+
+	onlyLocal := local.difference(remote)
+	onlyRemote := remote.difference(local)
+	shared := local.count() - onlyLocal.count()
+
+	fmt.Fprintf(ctx.Stdout, "%-12s %12s %10s\n", "", "chunks", "size")
+	fmt.Fprintf(ctx.Stdout, "%-12s %12d %10s\n", "here", local.count(), humanize.Bytes(local.size))
+	fmt.Fprintf(ctx.Stdout, "%-12s %12d %10s\n", "peer", remote.count(), humanize.Bytes(remote.size))
+	fmt.Fprintf(ctx.Stdout, "%-12s %12d %10s\n", "shared", shared, humanize.Bytes(local.size-onlyLocal.size))
+	fmt.Fprintf(ctx.Stdout, "%-12s %12d %10s\n", "only here", onlyLocal.count(), humanize.Bytes(onlyLocal.size))
+	fmt.Fprintf(ctx.Stdout, "%-12s %12d %10s\n", "only peer", onlyRemote.count(), humanize.Bytes(onlyRemote.size))
+	fmt.Fprintf(ctx.Stdout, "\n%.1f%% of the chunks here and %.1f%% of the chunks of the peer are shared\n",
+		percentOf(shared, local.count()), percentOf(shared, remote.count()))
+	fmt.Fprintf(ctx.Stdout, "syncing to the peer would move %s, syncing from it %s\n",
+		humanize.Bytes(onlyLocal.size), humanize.Bytes(onlyRemote.size))
+
+	return 0, nil
+}
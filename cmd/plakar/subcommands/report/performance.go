@@ -0,0 +1,120 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+const performanceBarWidth = 30
+
+type ReportPerformance struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Metric string
+	Limit  int
+}
+
+func (cmd *ReportPerformance) Name() string {
+	return "report_performance"
+}
+
+type performanceRun struct {
+	shortID   string
+	timestamp time.Time
+	profile   *snapshot.Profile
+}
+
+func (run *performanceRun) value(metric string) float64 {
+	switch metric {
+	case "throughput":
+		return run.profile.Throughput()
+	case "hits":
+		return run.profile.HitRatio()
+	default:
+		return run.profile.Duration().Seconds()
+	}
+}
+
+func (cmd *ReportPerformance) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	opts := utils.NewDefaultLocateOptions()
+	opts.MaxConcurrency = ctx.MaxConcurrency
+	opts.SortOrder = utils.LocateSortOrderAscending
+
+	snapshotIDs, err := utils.LocateSnapshotIDs(repo, opts)
+	if err != nil {
+		return 1, fmt.Errorf("report: could not locate snapshots: %w", err)
+	}
+
+	// runs are compared per source, as a slowdown only shows when the
+	// same data is backed up again.
+	sources := make(map[string][]*performanceRun)
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return 1, fmt.Errorf("report: could not load snapshot %x: %w", snapshotID[:4], err)
+		}
+		if !snap.HasProfile() {
+			snap.Close()
+			continue
+		}
+		profile, err := snap.GetProfile()
+		if err != nil {
+			snap.Close()
+			return 1, fmt.Errorf("report: could not read the profile of snapshot %x: %w", snapshotID[:4], err)
+		}
+
+		source := snap.Header.GetSource(0).Importer
+		key := source.Type + "://" + source.Origin + source.Directory
+		sources[key] = append(sources[key], &performanceRun{
+			shortID:   fmt.Sprintf("%x", snap.Header.GetIndexShortID()),
+			timestamp: snap.Header.Timestamp,
+			profile:   profile,
+		})
+		snap.Close()
+	}
+
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		runs := sources[key]
+		if cmd.Limit != 0 && len(runs) > cmd.Limit {
+			runs = runs[len(runs)-cmd.Limit:]
+		}
+
+		var highest float64
+		for _, run := range runs {
+			highest = max(highest, run.value(cmd.Metric))
+		}
+
+		if i != 0 {
+			fmt.Fprintln(ctx.Stdout)
+		}
+		fmt.Fprintf(ctx.Stdout, "%s\n", key)
+		for _, run := range runs {
+			width := 0
+			if highest > 0 {
+				width = int(run.value(cmd.Metric) / highest * performanceBarWidth)
+			}
+			fmt.Fprintf(ctx.Stdout, "  %s %s %10s %10s/s %4.0f%% hits %s\n",
+				run.timestamp.UTC().Format(time.DateTime), run.shortID,
+				run.profile.Duration().Round(time.Millisecond),
+				humanize.Bytes(uint64(run.profile.Throughput())),
+				run.profile.HitRatio()*100,
+				strings.Repeat("#", width))
+		}
+	}
+	return 0, nil
+}
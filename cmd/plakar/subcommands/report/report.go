@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package report
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("report", parse_cmd_report)
+}
+
+func parse_cmd_report(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_limit int
+	var opt_metric string
+	var opt_minsize string
+	var opt_apply string
+
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] largest SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] duplicates SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] excludes SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] growth SNAPSHOT[:PATH] SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] performance\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s overlap REPOSITORY\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.IntVar(&opt_limit, "n", 10, "maximum number of entries to report, 0 for no limit")
+	flags.StringVar(&opt_metric, "metric", "duration", "metric graphed by the performance report: duration, throughput or hits")
+	flags.StringVar(&opt_minsize, "min-size", humanize.IBytes(snapshot.DefaultSuggestMinSize), "minimum savings of an exclude rule suggested by the excludes report")
+	flags.StringVar(&opt_apply, "apply", "", "add the excludes suggested to this schedule, upon confirmation")
+	flags.Parse(args)
+
+	nargs := 2
+	switch flags.Arg(0) {
+	case "growth":
+		nargs = 3
+	case "performance":
+		nargs = 1
+	}
+	if flags.NArg() != nargs {
+		flags.Usage()
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if opt_limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d", opt_limit)
+	}
+	switch opt_metric {
+	case "duration", "throughput", "hits":
+	default:
+		return nil, fmt.Errorf("invalid metric: %s", opt_metric)
+	}
+	minSize, err := humanize.ParseBytes(opt_minsize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum size: %s", opt_minsize)
+	}
+	if opt_apply != "" && flags.Arg(0) != "excludes" {
+		return nil, fmt.Errorf("-apply only applies to the excludes report")
+	}
+
+	switch flags.Arg(0) {
+	case "largest":
+		return &ReportLargest{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			SnapshotPath:       flags.Arg(1),
+			Limit:              opt_limit,
+		}, nil
+	case "duplicates":
+		return &ReportDuplicates{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			SnapshotPath:       flags.Arg(1),
+			Limit:              opt_limit,
+		}, nil
+	case "excludes":
+		return &ReportExcludes{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			SnapshotPath:       flags.Arg(1),
+			MinSize:            minSize,
+			Apply:              opt_apply,
+			stdin:              os.Stdin,
+		}, nil
+	case "growth":
+		return &ReportGrowth{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			SnapshotPath1:      flags.Arg(1),
+			SnapshotPath2:      flags.Arg(2),
+			Limit:              opt_limit,
+		}, nil
+	case "performance":
+		return &ReportPerformance{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			Metric:             opt_metric,
+			Limit:              opt_limit,
+		}, nil
+	case "overlap":
+		return &ReportOverlap{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			Peer:               flags.Arg(1),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown report: %s", flags.Arg(0))
+	}
+}
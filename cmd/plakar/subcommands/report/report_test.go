@@ -0,0 +1,456 @@
+package report
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return generateSnapshotWith(t, bufOut, bufErr, nil)
+}
+
+// generateSnapshotWith backs up the test files along with extra ones,
+// given by their path relative to the backup directory.
+func generateSnapshotWith(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer, extra map[string]string) *snapshot.Snapshot {
+	// init temporary directories
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDir)
+		os.RemoveAll(tmpCacheDir)
+		os.RemoveAll(tmpBackupDir)
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	// create temporary files to backup
+	err = os.MkdirAll(tmpBackupDir+"/subdir", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll(tmpBackupDir+"/another_subdir", 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/dummy.txt", []byte("hello dummy"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/another_subdir/dummy_copy.txt", []byte("hello dummy"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/foo.txt", []byte("hello foo"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/another_subdir/big", []byte(strings.Repeat("hello big\n", 100)), 0644)
+	require.NoError(t, err)
+	for name, content := range extra {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpBackupDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, name), []byte(content), 0644))
+	}
+
+	// create a storage
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NotNil(t, r)
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	err = r.Create(wrappedConfig)
+	require.NoError(t, err)
+
+	// open the storage to load the configuration
+	r, serializedConfig, err := storage.Open(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+
+	// create a repository
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	cache := caching.NewManager(tmpCacheDir)
+	ctx.SetCache(cache)
+
+	logger := logging.NewLogger(bufOut, bufErr)
+	logger.EnableInfo()
+	ctx.SetLogger(logger)
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	return snap
+}
+
+func TestExecuteCmdReportLargest(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-n", "2", "largest", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_report(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	//     1.0 kB 2a3b4c5d:/tmp/tmp_to_backup2199484096/another_subdir/big
+	//       11 B 2a3b4c5d:/tmp/tmp_to_backup2199484096/another_subdir/dummy_copy.txt
+
+	lines := strings.Split(strings.TrimSpace(bufOut.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], "1.0 kB")
+	require.True(t, strings.HasSuffix(lines[0], "/another_subdir/big"))
+	require.Contains(t, lines[1], "11 B")
+}
+
+func TestExecuteCmdReportDuplicates(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"duplicates", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_report(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	// 1f2e3d4c: 2 copies of 11 B (11 B redundant)
+	//   2a3b4c5d:/tmp/tmp_to_backup2199484096/another_subdir/dummy_copy.txt
+	//   2a3b4c5d:/tmp/tmp_to_backup2199484096/subdir/dummy.txt
+
+	output := bufOut.String()
+	require.Contains(t, output, "2 copies of 11 B (11 B redundant)")
+	require.Contains(t, output, "/another_subdir/dummy_copy.txt")
+	require.Contains(t, output, "/subdir/dummy.txt")
+	require.NotContains(t, output, "foo.txt")
+}
+
+func TestExecuteCmdReportGrowth(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	snapshotID := snap.Header.GetIndexID()
+	indexId := hex.EncodeToString(snapshotID[:])
+	root := snap.Header.GetSource(0).Importer.Directory
+
+	// comparing a snapshot against itself reports nothing
+	subcommand, err := parse_cmd_report(ctx, repo, []string{"growth", indexId, indexId})
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Empty(t, strings.TrimSpace(bufOut.String()))
+
+	// comparing two disjoint subtrees, one grows from nothing and the
+	// other shrinks to nothing.
+	args := []string{"growth", indexId + ":" + root + "/subdir", indexId + ":" + root + "/another_subdir"}
+	subcommand, err = parse_cmd_report(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	//     +1.0 kB        0 B -> 1.0 kB     2a3b4c5d:/tmp/tmp_to_backup2199484096/another_subdir
+	//       -20 B       20 B -> 0 B        2a3b4c5d:/tmp/tmp_to_backup2199484096/subdir
+
+	lines := strings.Split(strings.TrimSpace(bufOut.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], "+1.0 kB")
+	require.True(t, strings.HasSuffix(lines[0], "/another_subdir"))
+	require.Contains(t, lines[1], "-20 B")
+	require.True(t, strings.HasSuffix(lines[1], "/subdir"))
+}
+
+func TestExecuteCmdReportPerformance(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	subcommand, err := parse_cmd_report(ctx, repo, []string{"-metric", "hits", "performance"})
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	// fs:///tmp/tmp_to_backup2199484096
+	//   2025-03-10 10:00:00 2a3b4c5d       12ms     1.2 MB/s    0% hits
+
+	lines := strings.Split(strings.TrimSpace(bufOut.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasSuffix(lines[0], snap.Header.GetSource(0).Importer.Directory))
+	require.Contains(t, lines[1], fmt.Sprintf("%x", snap.Header.GetIndexShortID()))
+	require.Contains(t, lines[1], "hits")
+
+	_, err = parse_cmd_report(ctx, repo, []string{"-metric", "latency", "performance"})
+	require.Error(t, err)
+}
+
+func TestExecuteCmdReportOverlap(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+
+	// an empty clone of the repository
+	cloneDir := t.TempDir() + "/clone"
+	config := repo.Configuration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	clone, err := bfs.NewStore(map[string]string{"location": "fs://" + cloneDir})
+	require.NoError(t, err)
+	require.NoError(t, clone.Create(wrappedConfig))
+
+	run := func(peer string) []string {
+		subcommand, err := parse_cmd_report(ctx, repo, []string{"overlap", peer})
+		require.NoError(t, err)
+
+		bufOut.Reset()
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+		return strings.Split(bufOut.String(), "\n")
+	}
+
+	var chunks int
+	for de, err := range repo.ListBlobs() {
+		require.NoError(t, err)
+		if de.Type == resources.RT_CHUNK {
+			chunks++
+		}
+	}
+	require.NotZero(t, chunks)
+
+	// nothing is shared with the empty clone...
+	lines := run("fs://" + cloneDir)
+	require.Equal(t, []string{"here", fmt.Sprint(chunks)}, strings.Fields(lines[1])[:2])
+	require.Equal(t, []string{"shared", "0"}, strings.Fields(lines[3])[:2])
+	require.Equal(t, []string{"only", "here", fmt.Sprint(chunks)}, strings.Fields(lines[4])[:3])
+
+	// ...and everything with the repository itself
+	lines = run(repo.Location())
+	require.Equal(t, []string{"shared", fmt.Sprint(chunks)}, strings.Fields(lines[3])[:2])
+	require.Equal(t, []string{"only", "here", "0"}, strings.Fields(lines[4])[:3])
+	require.Equal(t, []string{"only", "peer", "0"}, strings.Fields(lines[5])[:3])
+
+	// the state of the repository is left alone by the comparisons
+	lines = run("fs://" + cloneDir)
+	require.Equal(t, []string{"shared", "0"}, strings.Fields(lines[3])[:2])
+
+	// unrelated repositories can't be compared
+	otherDir := t.TempDir() + "/other"
+	other, err := bfs.NewStore(map[string]string{"location": "fs://" + otherDir})
+	require.NoError(t, err)
+	otherConfig := storage.NewConfiguration()
+	serialized, err = otherConfig.ToBytes()
+	require.NoError(t, err)
+	wrappedConfigRd, err = storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err = io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	require.NoError(t, other.Create(wrappedConfig))
+
+	subcommand, err := parse_cmd_report(ctx, repo, []string{"overlap", "fs://" + otherDir})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+}
+
+func TestExecuteCmdReportExcludes(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshotWith(t, bufOut, bufErr, map[string]string{
+		"project/node_modules/left-pad/index.js": strings.Repeat("module.exports = 1;\n", 50),
+		"project/node_modules/left-pad/README":   "left-pad",
+		"holidays/beach.mp4":                     strings.Repeat("not really a video\n", 20),
+		"project/main.js":                        "require('left-pad')",
+	})
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	ctx.HomeDir = repo.Location()
+
+	cfg, err := config.LoadOrCreate(filepath.Join(t.TempDir(), "plakar.yml"))
+	require.NoError(t, err)
+	cfg.Schedules["home"] = config.ScheduleConfig{Cron: "@daily", Path: "/home", Excludes: []string{"*.mp4"}}
+	ctx.Config = cfg
+
+	indexId := snap.Header.GetIndexID()
+	snapshotPath := hex.EncodeToString(indexId[:])
+
+	subcommand, err := parse_cmd_report(ctx, repo, []string{"-min-size", "100B", "excludes", snapshotPath})
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	lines := strings.Split(strings.TrimSpace(bufOut.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], "{*/node_modules,*/node_modules/*} (1 paths")
+	require.Contains(t, lines[1], "*.mp4 (1 paths, videos)")
+	require.True(t, strings.HasPrefix(lines[2], "excluding them would save "))
+
+	// a higher threshold leaves out the smaller savings
+	subcommand, err = parse_cmd_report(ctx, repo, []string{"-min-size", "500B", "excludes", snapshotPath})
+	require.NoError(t, err)
+	bufOut.Reset()
+	_, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(bufOut.String()), "\n"), 2)
+
+	_, err = parse_cmd_report(ctx, repo, []string{"-apply", "home", "largest", snapshotPath})
+	require.Error(t, err)
+
+	apply := func(answer string) {
+		subcommand, err := parse_cmd_report(ctx, repo, []string{"-min-size", "100B", "-apply", "home", "excludes", snapshotPath})
+		require.NoError(t, err)
+		subcommand.(*ReportExcludes).stdin = strings.NewReader(answer)
+		bufOut.Reset()
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+	}
+
+	apply("n\n")
+	require.Contains(t, bufOut.String(), "schedule home left unchanged")
+	require.Equal(t, []string{"*.mp4"}, cfg.Schedules["home"].Excludes)
+
+	apply("y\n")
+	require.Contains(t, bufOut.String(), "add 1 patterns to the excludes of schedule home?")
+	require.Equal(t, []string{"*.mp4", "{*/node_modules,*/node_modules/*}"}, cfg.Schedules["home"].Excludes)
+
+	saved, err := cfg.Reload()
+	require.NoError(t, err)
+	require.Equal(t, cfg.Schedules["home"].Excludes, saved.Schedules["home"].Excludes)
+
+	subcommand, err = parse_cmd_report(ctx, repo, []string{"-apply", "missing", "excludes", snapshotPath})
+	require.NoError(t, err)
+	_, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+}
+
+func TestParseCmdReportGrowthArgs(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	_, err := parse_cmd_report(snap.AppContext(), snap.Repository(), []string{"growth", "abcd"})
+	require.Error(t, err)
+}
+
+func TestParseCmdReportUnknown(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	_, err := parse_cmd_report(snap.AppContext(), snap.Repository(), []string{"smallest", "abcd"})
+	require.Error(t, err)
+}
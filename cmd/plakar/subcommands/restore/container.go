@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package restore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+)
+
+const (
+	// containerHelperImage copies the restored data into a volume.
+	containerHelperImage = "busybox"
+
+	// containerLabel marks the volumes and containers created by
+	// -to-container with the snapshot they were restored from.
+	containerLabel = "org.plakar.snapshot"
+
+	defaultContainerPath = "/data"
+)
+
+// docker runs the docker command line with args and returns its output,
+// tests replace it to record the commands.
+var docker = func(ctx context.Context, args ...string) (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", fmt.Errorf("docker not found: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("docker %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("docker %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// createVolume creates a new volume, refusing to reuse an existing one as
+// it may hold data of its own.
+func createVolume(ctx context.Context, name, source string) error {
+	if _, err := docker(ctx, "volume", "inspect", name); err == nil {
+		return fmt.Errorf("docker volume %s already exists", name)
+	}
+	_, err := docker(ctx, "volume", "create", "--label", containerLabel+"="+source, name)
+	return err
+}
+
+// fillVolume copies the content of the directory staging into volume.
+func fillVolume(ctx context.Context, volume, staging string) error {
+	_, err := docker(ctx, "run", "--rm",
+		"--mount", "type=bind,source="+staging+",target=/plakar-restore,readonly",
+		"--mount", "type=volume,source="+volume+",target=/data",
+		containerHelperImage, "cp", "-a", "/plakar-restore/.", "/data/")
+	return err
+}
+
+// toContainer exposes the data restored to target, a directory, in Docker:
+// copied into a new volume if one is named, bind mounted otherwise, then
+// starts the image requested, if any, with the data at the container path.
+func (cmd *Restore) toContainer(ctx *appcontext.AppContext, target, source string) error {
+	dockerCtx := ctx.GetContext()
+
+	mount := "type=bind,source=" + target
+	if cmd.ContainerVolume != "" {
+		if err := createVolume(dockerCtx, cmd.ContainerVolume, source); err != nil {
+			return err
+		}
+		if err := fillVolume(dockerCtx, cmd.ContainerVolume, target); err != nil {
+			if _, rmErr := docker(dockerCtx, "volume", "rm", cmd.ContainerVolume); rmErr != nil {
+				ctx.GetLogger().Warn("%s: could not remove docker volume %s: %s", cmd.Name(), cmd.ContainerVolume, rmErr)
+			}
+			return err
+		}
+		ctx.GetLogger().Info("%s: %s restored to docker volume %s", cmd.Name(), source, cmd.ContainerVolume)
+		mount = "type=volume,source=" + cmd.ContainerVolume
+	}
+
+	if cmd.ContainerImage == "" {
+		return nil
+	}
+
+	containerPath := cmd.ContainerPath
+	if containerPath == "" {
+		containerPath = defaultContainerPath
+	}
+	containerID, err := docker(dockerCtx, "run", "--detach",
+		"--label", containerLabel+"="+source,
+		"--mount", mount+",target="+containerPath,
+		cmd.ContainerImage)
+	if err != nil {
+		return err
+	}
+	ctx.GetLogger().Info("%s: started container %.12s from %s with %s at %s",
+		cmd.Name(), containerID, cmd.ContainerImage, source, containerPath)
+	fmt.Fprintln(ctx.Stdout, containerID)
+	return nil
+}
@@ -0,0 +1,158 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker records the docker commands run, failing those starting with
+// one of the prefixes given, and checks the data to copy into volumes.
+func fakeDocker(t *testing.T, failing ...string) *[]string {
+	var commands []string
+	saved := docker
+	t.Cleanup(func() { docker = saved })
+
+	docker = func(ctx context.Context, args ...string) (string, error) {
+		command := strings.Join(args, " ")
+		commands = append(commands, command)
+		for _, prefix := range failing {
+			if strings.HasPrefix(command, prefix) {
+				return "", errors.New("failed")
+			}
+		}
+		if args[0] == "run" && args[len(args)-1] == "/data/" {
+			// the staging directory is still there while copied
+			staging := strings.TrimPrefix(strings.Split(args[3], ",")[1], "source=")
+			data, err := os.ReadFile(filepath.Join(staging, "subdir", "dummy.txt"))
+			require.NoError(t, err)
+			require.Equal(t, "hello dummy", string(data))
+		}
+		if args[0] == "run" && args[1] == "--detach" {
+			return "0123456789abcdef0123456789abcdef", nil
+		}
+		return "", nil
+	}
+	return &commands
+}
+
+func TestExecuteCmdRestoreToContainerVolume(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	ctx.HomeDir = repo.Location()
+	ctx.CWD = t.TempDir()
+
+	// the volume is checked for first, then created
+	commands := fakeDocker(t, "volume inspect")
+
+	args := []string{"-to-container", "-container-volume", "appdata", "-container-image", "postgres:16", "-container-path", "/var/lib/postgresql/data"}
+	subcommand, err := parse_cmd_restore(ctx, repo, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	require.Len(t, *commands, 4)
+	require.Equal(t, "volume inspect appdata", (*commands)[0])
+	require.Equal(t, fmt.Sprintf("volume create --label %s=%x: appdata", containerLabel, snap.Header.Identifier), (*commands)[1])
+	require.True(t, strings.HasPrefix((*commands)[2], "run --rm --mount type=bind,source="))
+	require.True(t, strings.HasSuffix((*commands)[2], "--mount type=volume,source=appdata,target=/data busybox cp -a /plakar-restore/. /data/"))
+	require.True(t, strings.HasSuffix((*commands)[3], "--mount type=volume,source=appdata,target=/var/lib/postgresql/data postgres:16"))
+	require.Contains(t, bufOut.String(), "0123456789abcdef0123456789abcdef")
+
+	// nothing is left behind in the working directory
+	entries, err := os.ReadDir(ctx.CWD)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestExecuteCmdRestoreToContainerExistingVolume(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	ctx.HomeDir = repo.Location()
+
+	commands := fakeDocker(t)
+
+	subcommand, err := parse_cmd_restore(ctx, repo, []string{"-to-container", "-container-volume", "appdata"})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Equal(t, []string{"volume inspect appdata"}, *commands)
+}
+
+func TestExecuteCmdRestoreToContainerBind(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	ctx.HomeDir = repo.Location()
+	ctx.CWD = t.TempDir()
+
+	commands := fakeDocker(t)
+
+	subcommand, err := parse_cmd_restore(ctx, repo, []string{"-to-container", "-to", "restored", "-container-image", "nginx"})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	target := filepath.Join(ctx.CWD, "restored")
+	require.Len(t, *commands, 1)
+	require.True(t, strings.HasSuffix((*commands)[0], "--mount type=bind,source="+target+",target=/data nginx"))
+
+	data, err := os.ReadFile(filepath.Join(target, "subdir", "dummy.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello dummy", string(data))
+}
+
+func TestParseCmdRestoreToContainer(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+
+	for _, args := range [][]string{
+		{"-to-container"},
+		{"-container-image", "nginx"},
+		{"-to-container", "-to", "/tmp/x", "-container-volume", "appdata"},
+		{"-to-container", "-to", "sftp://host/x", "-container-image", "nginx"},
+		{"-to-container", "-container-image", "nginx", "-container-path", "data"},
+	} {
+		_, err := parse_cmd_restore(ctx, repo, args)
+		require.Error(t, err, args)
+	}
+}
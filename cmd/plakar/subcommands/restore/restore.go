@@ -17,14 +17,19 @@
 package restore
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/grant"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
@@ -46,6 +51,20 @@ func parse_cmd_restore(ctx *appcontext.AppContext, repo *repository.Repository,
 	var opt_concurrency uint64
 	var opt_quiet bool
 	var opt_silent bool
+	var opt_browsefirst bool
+	var opt_verify bool
+	var opt_compat string
+	var opt_mangle bool
+	var opt_sidecar bool
+	var opt_delta bool
+	var opt_besteffort bool
+	var opt_truncate bool
+	var opt_grant string
+	var opt_tocontainer bool
+	var opt_containervolume string
+	var opt_containerimage string
+	var opt_containerpath string
+	var opt_limits utils.Limits
 
 	flags := flag.NewFlagSet("restore", flag.ExitOnError)
 	flags.Usage = func() {
@@ -65,9 +84,59 @@ func parse_cmd_restore(ctx *appcontext.AppContext, repo *repository.Repository,
 	flags.StringVar(&pullPath, "to", "", "base directory where pull will restore")
 	flags.BoolVar(&opt_quiet, "quiet", false, "do not print progress")
 	flags.BoolVar(&opt_silent, "silent", false, "do not print ANY progress")
+	flags.BoolVar(&opt_browsefirst, "browse-first", false, "restore the directory structure before file contents")
+	flags.BoolVar(&opt_verify, "verify", false, "read restored files back and compare them against the snapshot")
+	flags.StringVar(&opt_compat, "compat", "", "check paths against the limits of a target ("+strings.Join(snapshot.PathCompatNames(), ", ")+") before restoring")
+	flags.BoolVar(&opt_mangle, "mangle", false, "rename paths incompatible with the -compat target instead of aborting")
+	flags.BoolVar(&opt_delta, "delta", false, "only restore files that are missing or differ at the destination")
+	flags.BoolVar(&opt_sidecar, "metadata-sidecar", false, "write ownership, modes and extended attributes of restored files to a "+snapshot.METADATA_SIDECAR+" file")
+	flags.BoolVar(&opt_besteffort, "best-effort", false, "restore what can be read from a damaged repository, filling unreadable chunks with zeroes")
+	flags.BoolVar(&opt_truncate, "truncate", false, "with -best-effort, stop files at their first unreadable chunk instead")
+	flags.StringVar(&opt_grant, "grant", "", "restore the snapshot subtree of a grant minted with plakar grant")
+	flags.BoolVar(&opt_tocontainer, "to-container", false, "expose the restored data in Docker, in a new volume or as a bind mount")
+	flags.StringVar(&opt_containervolume, "container-volume", "", "with -to-container, name of the new docker volume the data is restored to")
+	flags.StringVar(&opt_containerimage, "container-image", "", "with -to-container, image to start with the restored data mounted")
+	flags.StringVar(&opt_containerpath, "container-path", defaultContainerPath, "with -to-container, path of the restored data in the container")
+	opt_limits.InstallFlags(flags)
 	flags.Parse(args)
 
-	if flags.NArg() != 0 {
+	if opt_compat != "" {
+		if _, err := snapshot.GetPathCompat(opt_compat); err != nil {
+			return nil, err
+		}
+	} else if opt_mangle {
+		return nil, fmt.Errorf("-mangle requires -compat")
+	}
+
+	if opt_delta && opt_browsefirst {
+		return nil, fmt.Errorf("-delta and -browse-first are mutually exclusive")
+	}
+
+	var bestEffort string
+	if opt_besteffort {
+		bestEffort = snapshot.BEST_EFFORT_ZERO
+		if opt_truncate {
+			bestEffort = snapshot.BEST_EFFORT_TRUNCATE
+		}
+	} else if opt_truncate {
+		return nil, fmt.Errorf("-truncate requires -best-effort")
+	}
+
+	if err := opt_limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	snapshots := flags.Args()
+	if opt_grant != "" {
+		if flags.NArg() != 0 {
+			return nil, fmt.Errorf("-grant and snapshot arguments are mutually exclusive")
+		}
+		g, err := grant.Verify(repo, opt_grant)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = []string{fmt.Sprintf("%x:%s", g.SnapshotID, g.Path)}
+	} else if flags.NArg() != 0 {
 		if opt_name != "" || opt_category != "" || opt_environment != "" || opt_perimeter != "" || opt_job != "" || opt_tag != "" {
 			ctx.GetLogger().Warn("snapshot specified, filters will be ignored")
 		}
@@ -75,8 +144,28 @@ func parse_cmd_restore(ctx *appcontext.AppContext, repo *repository.Repository,
 		return nil, fmt.Errorf("multiple restore paths specified, please specify only one")
 	}
 
+	if opt_tocontainer {
+		if opt_containervolume == "" && opt_containerimage == "" {
+			return nil, fmt.Errorf("-to-container requires -container-volume or -container-image")
+		}
+		if opt_containervolume != "" && pullPath != "" {
+			return nil, fmt.Errorf("-to and -container-volume are mutually exclusive")
+		}
+		if strings.HasPrefix(pullPath, "@") || strings.Contains(pullPath, "://") {
+			return nil, fmt.Errorf("-to-container requires a local directory")
+		}
+		if !path.IsAbs(opt_containerpath) {
+			return nil, fmt.Errorf("-container-path must be absolute: %s", opt_containerpath)
+		}
+	} else if opt_containervolume != "" || opt_containerimage != "" || opt_containerpath != defaultContainerPath {
+		return nil, fmt.Errorf("-container-volume, -container-image and -container-path require -to-container")
+	}
+
 	if pullPath == "" {
 		pullPath = fmt.Sprintf("%s/plakar-%s", ctx.CWD, time.Now().Format(time.RFC3339))
+	} else if opt_tocontainer && !filepath.IsAbs(pullPath) {
+		// docker needs the absolute path to bind mount it
+		pullPath = filepath.Join(ctx.CWD, pullPath)
 	}
 
 	return &Restore{
@@ -94,7 +183,20 @@ func parse_cmd_restore(ctx *appcontext.AppContext, repo *repository.Repository,
 		Concurrency: opt_concurrency,
 		Quiet:       opt_quiet,
 		Silent:      opt_silent,
-		Snapshots:   flags.Args(),
+		BrowseFirst: opt_browsefirst,
+		Verify:      opt_verify,
+		Compat:      opt_compat,
+		Mangle:      opt_mangle,
+		Sidecar:     opt_sidecar,
+		Delta:       opt_delta,
+		BestEffort:  bestEffort,
+		Snapshots:   snapshots,
+		Limits:      opt_limits,
+
+		ToContainer:     opt_tocontainer,
+		ContainerVolume: opt_containervolume,
+		ContainerImage:  opt_containerimage,
+		ContainerPath:   opt_containerpath,
 	}, nil
 }
 
@@ -114,13 +216,37 @@ type Restore struct {
 	Concurrency uint64
 	Quiet       bool
 	Silent      bool
+	BrowseFirst bool
+	Compat      string
+	Mangle      bool
+	Sidecar     bool
+	Delta       bool
+	Verify      bool
+	BestEffort  string
 	Snapshots   []string
+	Limits      utils.Limits
+
+	// ToContainer exposes the restored data in Docker: copied into the
+	// new ContainerVolume if set, bind mounted from Target otherwise, and
+	// mounted at ContainerPath in a container of ContainerImage if set.
+	ToContainer     bool
+	ContainerVolume string
+	ContainerImage  string
+	ContainerPath   string
 }
 
 func (cmd *Restore) Name() string {
 	return "restore"
 }
 
+func (cmd *Restore) IsLimited() bool {
+	return cmd.Limits.IsSet()
+}
+
+func (cmd *Restore) ApplyLimits() (func() error, error) {
+	return cmd.Limits.Apply()
+}
+
 func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
 	if !cmd.Silent {
 		go eventsProcessorStdio(ctx, cmd.Quiet)
@@ -179,13 +305,24 @@ func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 		return 1, fmt.Errorf("multiple snapshots found, please specify one")
 	}
 
+	target := cmd.Target
+	if cmd.ToContainer && cmd.ContainerVolume != "" {
+		// restored first, then copied into the volume
+		staging, err := os.MkdirTemp("", "plakar-restore-")
+		if err != nil {
+			return 1, err
+		}
+		defer os.RemoveAll(staging)
+		target = staging
+	}
+
 	exporterConfig := map[string]string{
-		"location": cmd.Target,
+		"location": target,
 	}
 	if strings.HasPrefix(cmd.Target, "@") {
-		remote, ok := ctx.Config.GetRemote(cmd.Target[1:])
-		if !ok {
-			return 1, fmt.Errorf("could not resolve exporter: %s", cmd.Target)
+		remote, err := ctx.Config.GetRemote(cmd.Target[1:])
+		if err != nil {
+			return 1, fmt.Errorf("could not resolve exporter: %s: %w", cmd.Target, err)
 		}
 		if _, ok := remote["location"]; !ok {
 			return 1, fmt.Errorf("could not resolve exporter location: %s", cmd.Target)
@@ -204,8 +341,21 @@ func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 
 	opts := &snapshot.RestoreOptions{
 		MaxConcurrency: cmd.Concurrency,
+		BrowseFirst:    cmd.BrowseFirst,
+		Verify:         cmd.Verify,
+		Mangle:         cmd.Mangle,
+		Delta:          cmd.Delta,
+		BestEffort:     cmd.BestEffort,
+
+		MetadataSidecar: cmd.Sidecar,
+	}
+	if cmd.Compat != "" {
+		if opts.PathCompat, err = snapshot.GetPathCompat(cmd.Compat); err != nil {
+			return 1, err
+		}
 	}
 
+	var incomplete error
 	for _, snapPath := range snapshots {
 		snap, pathname, err := utils.OpenSnapshotByPath(repo, snapPath)
 		if err != nil {
@@ -215,15 +365,30 @@ func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 
 		err = snap.Restore(exporterInstance, exporterInstance.Root(), pathname, opts)
 
-		if err != nil {
+		if errors.Is(err, snapshot.ErrIncompleteRestore) {
+			ctx.GetLogger().Warn("%s: %x:%s: %s", cmd.Name(), snap.Header.GetIndexShortID(), pathname, err)
+			incomplete = err
+			snap.Close()
+			continue
+		} else if err != nil {
 			return 1, err
 		}
 		ctx.GetLogger().Info("%s: restoration of %x:%s at %s completed successfully",
 			cmd.Name(),
 			snap.Header.GetIndexShortID(),
 			pathname,
-			cmd.Target)
+			target)
 		snap.Close()
 	}
+
+	if incomplete != nil {
+		return 1, incomplete
+	}
+
+	if cmd.ToContainer {
+		if err := cmd.toContainer(ctx, target, snapshots[0]); err != nil {
+			return 1, err
+		}
+	}
 	return 0, nil
 }
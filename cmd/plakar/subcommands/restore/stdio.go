@@ -22,6 +22,9 @@ func eventsProcessorStdio(ctx *appcontext.AppContext, quiet bool) chan struct{}
 			case events.FileError:
 				ctx.GetLogger().Warn("%x: KO %s %s: %s", event.SnapshotID[:4], crossMark, event.Pathname, event.Message)
 
+			case events.FileCorrupted:
+				ctx.GetLogger().Warn("%x: KO %s %s: written data does not match snapshot", event.SnapshotID[:4], crossMark, event.Pathname)
+
 			case events.DirectoryOK:
 				if !quiet {
 					ctx.GetLogger().Info("%x: OK %s %s", event.SnapshotID[:4], checkMark, event.Pathname)
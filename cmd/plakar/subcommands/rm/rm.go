@@ -17,8 +17,11 @@
 package rm
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -27,6 +30,7 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
 )
 
 func init() {
@@ -43,6 +47,8 @@ func parse_cmd_rm(ctx *appcontext.AppContext, repo *repository.Repository, args
 	var opt_before string
 	var opt_since string
 	var opt_latest bool
+	var opt_preview bool
+	var opt_confirm string
 
 	flags := flag.NewFlagSet("rm", flag.ExitOnError)
 	flags.Usage = func() {
@@ -60,8 +66,14 @@ func parse_cmd_rm(ctx *appcontext.AppContext, repo *repository.Repository, args
 	flags.StringVar(&opt_before, "before", "", "filter by date")
 	flags.StringVar(&opt_since, "since", "", "filter by date")
 	flags.BoolVar(&opt_latest, "latest", false, "use latest snapshot")
+	flags.BoolVar(&opt_preview, "preview", false, "list the snapshots to remove and a token to confirm their removal")
+	flags.StringVar(&opt_confirm, "confirm", "", "only remove the snapshots if they are still those of the preview with this token")
 	flags.Parse(args)
 
+	if opt_preview && opt_confirm != "" {
+		return nil, fmt.Errorf("-preview and -confirm are mutually exclusive")
+	}
+
 	var err error
 
 	var beforeDate time.Time
@@ -105,6 +117,9 @@ func parse_cmd_rm(ctx *appcontext.AppContext, repo *repository.Repository, args
 		OptJob:         opt_job,
 		OptTag:         opt_tag,
 
+		OptPreview: opt_preview,
+		OptConfirm: opt_confirm,
+
 		Snapshots: flags.Args(),
 	}, nil
 }
@@ -124,6 +139,9 @@ type Rm struct {
 	OptJob         string
 	OptTag         string
 
+	OptPreview bool
+	OptConfirm string
+
 	Snapshots []string
 }
 
@@ -164,6 +182,44 @@ func (cmd *Rm) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 		}
 	}
 
+	if cmd.OptPreview {
+		for _, snapshotID := range snapshots {
+			snap, err := snapshot.Load(repo, snapshotID)
+			if err != nil {
+				return 1, err
+			}
+			fmt.Fprintf(ctx.Stdout, "%s %10s %s\n",
+				snap.Header.Timestamp.UTC().Format(time.RFC3339),
+				hex.EncodeToString(snap.Header.GetIndexShortID()),
+				snap.Header.GetSource(0).Importer.Root())
+			snap.Close()
+		}
+		fmt.Fprintf(ctx.Stdout, "%d snapshots to remove, confirm with: -confirm %s\n",
+			len(snapshots), utils.ConfirmationToken(snapshots))
+		return 0, nil
+	}
+
+	if cmd.OptConfirm != "" && cmd.OptConfirm != utils.ConfirmationToken(snapshots) {
+		return 1, fmt.Errorf("the snapshots to remove changed since the preview, not removing anything")
+	}
+
+	// packfiles only the removed snapshots rely on are coloured for
+	// deletion once they are removed, so that a maintenance run reclaims
+	// them without first having to tell they became unused.  Like any
+	// colouring, this requires the maintenance lock so that no backup
+	// starts relying on them meanwhile, and is otherwise left to the
+	// next maintenance run.
+	var unreferenced []objects.MAC
+	if done, err := cmd.lock(repo); err != nil {
+		ctx.GetLogger().Warn("%s: unreferenced packfiles left to maintenance: %s", cmd.Name(), err)
+	} else {
+		defer close(done)
+		unreferenced, err = cmd.unreferencedPackfiles(repo, snapshots)
+		if err != nil {
+			ctx.GetLogger().Warn("%s: could not count the references to packfiles: %s", cmd.Name(), err)
+		}
+	}
+
 	errors := 0
 	wg := sync.WaitGroup{}
 	for _, snap := range snapshots {
@@ -186,5 +242,41 @@ func (cmd *Rm) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 		return 1, fmt.Errorf("failed to remove %d snapshots", errors)
 	}
 
+	if len(unreferenced) != 0 {
+		if err := repo.MarkPackfilesDeleted(unreferenced); err != nil {
+			return 1, fmt.Errorf("failed to mark unreferenced packfiles for deletion: %w", err)
+		}
+		ctx.GetLogger().Info("%s: %d packfiles no longer referenced marked for deletion",
+			cmd.Name(), len(unreferenced))
+	}
+
 	return 0, nil
 }
+
+// lock takes the exclusive lock maintenance runs under.
+func (cmd *Rm) lock(repo *repository.Repository) (chan bool, error) {
+	var lockID objects.MAC
+	if n, err := rand.Read(lockID[:]); err != nil {
+		return nil, err
+	} else if n != len(lockID) {
+		return nil, io.ErrShortWrite
+	}
+	return repo.ExclusiveLock(lockID)
+}
+
+// unreferencedPackfiles returns the packfiles which no snapshot relies on
+// besides the ones being removed, using the maintenance cache to count
+// references so that only the snapshots created since its last update
+// are resolved.
+func (cmd *Rm) unreferencedPackfiles(repo *repository.Repository, snapshots []objects.MAC) ([]objects.MAC, error) {
+	cache, err := repo.AppContext().GetCache().Maintenance(repo.Configuration().RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := snapshot.CachePackfiles(repo, cache); err != nil {
+		return nil, err
+	}
+
+	return snapshot.UnreferencedPackfiles(cache, snapshots), nil
+}
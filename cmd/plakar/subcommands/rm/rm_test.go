@@ -10,8 +10,10 @@ import (
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
@@ -162,3 +164,130 @@ func TestExecuteCmdRmWithSnapshot(t *testing.T) {
 	output := bufOut.String()
 	require.Contains(t, output, fmt.Sprintf("info: rm: removal of %s completed successfully", hex.EncodeToString(snap.Header.GetIndexShortID())))
 }
+
+func TestExecuteCmdRmPreviewConfirm(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	_, err := parse_cmd_rm(ctx, repo, []string{"-preview", "-confirm", "abc", "-latest"})
+	require.Error(t, err)
+
+	subcommand, err := parse_cmd_rm(ctx, repo, []string{"-preview", "-name", "test_backup"})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	token := utils.ConfirmationToken([]objects.MAC{snap.Header.Identifier})
+	output := bufOut.String()
+	require.Contains(t, output, hex.EncodeToString(snap.Header.GetIndexShortID()))
+	require.Contains(t, output, fmt.Sprintf("1 snapshots to remove, confirm with: -confirm %s", token))
+	require.NotContains(t, output, "completed successfully")
+
+	subcommand, err = parse_cmd_rm(ctx, repo, []string{"-confirm", "0000000000000000", "-name", "test_backup"})
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+
+	subcommand, err = parse_cmd_rm(ctx, repo, []string{"-confirm", token, "-name", "test_backup"})
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), fmt.Sprintf("info: rm: removal of %s completed successfully", hex.EncodeToString(snap.Header.GetIndexShortID())))
+}
+
+func TestExecuteCmdRmMarksUnreferencedPackfiles(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	iter, err := snap.ListPackfiles()
+	require.NoError(t, err)
+	packfiles := make(map[objects.MAC]struct{})
+	for packfileMAC, err := range iter {
+		require.NoError(t, err)
+		packfiles[packfileMAC] = struct{}{}
+	}
+	require.NotEmpty(t, packfiles)
+
+	subcommand, err := parse_cmd_rm(ctx, repo, []string{hex.EncodeToString(snap.Header.GetIndexShortID())})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), fmt.Sprintf("info: rm: %d packfiles no longer referenced marked for deletion", len(packfiles)))
+
+	// the packfiles of the only snapshot are now candidates for the sweep
+	require.NoError(t, repo.RebuildState())
+	for packfileMAC := range packfiles {
+		has, err := repo.HasDeletedPackfile(packfileMAC)
+		require.NoError(t, err)
+		require.True(t, has)
+	}
+}
+
+func TestExecuteCmdRmLockedLeavesPackfiles(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	// another process holds the repository, e.g. a backup in progress
+	buffer := &bytes.Buffer{}
+	require.NoError(t, repository.NewSharedLock(ctx.Hostname).SerializeToStream(buffer))
+	require.NoError(t, repo.PutLock(objects.MAC{1}, buffer))
+	defer repo.DeleteLock(objects.MAC{1})
+
+	subcommand, err := parse_cmd_rm(ctx, repo, []string{hex.EncodeToString(snap.Header.GetIndexShortID())})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), fmt.Sprintf("info: rm: removal of %s completed successfully", hex.EncodeToString(snap.Header.GetIndexShortID())))
+	require.Contains(t, bufErr.String(), "rm: unreferenced packfiles left to maintenance")
+
+	// colouring is left to maintenance
+	iter, err := snap.ListPackfiles()
+	require.NoError(t, err)
+	require.NoError(t, repo.RebuildState())
+	for packfileMAC, err := range iter {
+		require.NoError(t, err)
+		has, err := repo.HasDeletedPackfile(packfileMAC)
+		require.NoError(t, err)
+		require.False(t, has)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package schedule
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/agent"
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/scheduler"
+	"github.com/PlakarKorp/plakar/snapshot/importer/sysstate"
+)
+
+func init() {
+	subcommands.Register("schedule", parse_cmd_schedule)
+}
+
+func parse_cmd_schedule(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: plakar schedule [add | rm | list | resume-retention]")
+	}
+
+	switch args[0] {
+	case "add":
+		return parse_cmd_schedule_add(ctx, args[1:])
+	case "rm":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: plakar schedule rm name")
+		}
+		return &ScheduleRm{Name: args[1]}, nil
+	case "list":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("usage: plakar schedule list")
+		}
+		return parse_cmd_schedule_list(ctx)
+	case "resume-retention":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: plakar schedule resume-retention source")
+		}
+		return parse_cmd_schedule_resume_retention(ctx, args[1])
+	default:
+		return nil, fmt.Errorf("usage: plakar schedule [add | rm | list | resume-retention]")
+	}
+}
+
+func parse_cmd_schedule_add(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_name string
+	var opt_repository string
+	var opt_exclude backup.ExcludeFlags
+	var opt_systemstate string
+
+	flags := flag.NewFlagSet("schedule add", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] CRON PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opt_name, "name", "", "name of the schedule, defaults to the base name of PATH")
+	flags.StringVar(&opt_repository, "repository", "", "repository to back up to, defaults to the default repository")
+	flags.Var(&opt_exclude, "exclude", "glob pattern to exclude files, can be specified multiple times to add several exclusion patterns")
+	flags.StringVar(&opt_systemstate, "system-state", "", "comma-separated list of system state modules to capture alongside the files, or all")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return nil, fmt.Errorf("expected a cron specification and a path")
+	}
+	spec, path := flags.Arg(0), flags.Arg(1)
+
+	if _, err := scheduler.ParseCron(spec); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(path, "@") && !strings.Contains(path, "://") && !filepath.IsAbs(path) {
+		path = filepath.Join(ctx.CWD, path)
+	}
+
+	if opt_name == "" {
+		opt_name = filepath.Base(strings.TrimPrefix(path, "@"))
+	}
+	if opt_name == "" || opt_name == "/" || opt_name == "." {
+		return nil, fmt.Errorf("could not derive a name from %s, use -name", path)
+	}
+
+	excludes, err := backup.LoadExcludes(opt_exclude, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if opt_systemstate != "" {
+		if _, err := sysstate.ParseModules(opt_systemstate); err != nil {
+			return nil, err
+		}
+	}
+
+	if opt_repository != "" && !strings.HasPrefix(opt_repository, "@") && !strings.Contains(opt_repository, "://") && !filepath.IsAbs(opt_repository) {
+		opt_repository = filepath.Join(ctx.CWD, opt_repository)
+	}
+
+	return &ScheduleAdd{
+		Name: opt_name,
+		Schedule: config.ScheduleConfig{
+			Cron:        spec,
+			Path:        path,
+			Repository:  opt_repository,
+			Excludes:    excludes,
+			SystemState: opt_systemstate,
+		},
+	}, nil
+}
+
+func parse_cmd_schedule_list(ctx *appcontext.AppContext) (subcommands.Subcommand, error) {
+	cmd := &ScheduleList{Schedules: ctx.Config.Schedules}
+
+	// the status of the runs only exists within the agent, ask it if it
+	// is running.
+	client, err := agent.NewClient(filepath.Join(ctx.CacheDir, "agent.sock"))
+	if err != nil {
+		return cmd, nil
+	}
+	defer client.Close()
+
+	retval, err := client.SendCommand(ctx, cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+	os.Exit(retval)
+	return nil, nil
+}
+
+func parse_cmd_schedule_resume_retention(ctx *appcontext.AppContext, source string) (subcommands.Subcommand, error) {
+	// paused retentions are tracked by the agent, which holds its cache
+	client, err := agent.NewClient(filepath.Join(ctx.CacheDir, "agent.sock"))
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the agent: %w", err)
+	}
+	defer client.Close()
+
+	retval, err := client.SendCommand(ctx, &ScheduleResumeRetention{Source: source}, nil)
+	if err != nil {
+		return nil, err
+	}
+	os.Exit(retval)
+	return nil, nil
+}
+
+// ScheduleAdd records a backup to be run by the agent in the configuration.
+type ScheduleAdd struct {
+	Name     string
+	Schedule config.ScheduleConfig
+}
+
+func (cmd *ScheduleAdd) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if ctx.Config.HasSchedule(cmd.Name) {
+		return 1, fmt.Errorf("schedule %q already exists", cmd.Name)
+	}
+	ctx.Config.Schedules[cmd.Name] = cmd.Schedule
+	if err := ctx.Config.Save(); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+type ScheduleRm struct {
+	Name string
+}
+
+func (cmd *ScheduleRm) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if !ctx.Config.HasSchedule(cmd.Name) {
+		return 1, fmt.Errorf("schedule %q does not exist", cmd.Name)
+	}
+	delete(ctx.Config.Schedules, cmd.Name)
+	if err := ctx.Config.Save(); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// ScheduleList lists the schedules of the configuration, along with the
+// status of their latest run when executed by the agent.
+type ScheduleList struct {
+	Schedules map[string]config.ScheduleConfig
+
+	// Scheduler is set by the agent before executing the command.
+	Scheduler *scheduler.Scheduler `msgpack:"-"`
+}
+
+func (cmd *ScheduleList) Name() string {
+	return "schedule-list"
+}
+
+func (cmd *ScheduleList) status(name string) string {
+	if cmd.Scheduler == nil {
+		return "agent not running"
+	}
+
+	status, ok := cmd.Scheduler.ScheduleStatus(name)
+	switch {
+	case !ok:
+		return "never ran"
+	case status.Running():
+		return fmt.Sprintf("running since %s", status.Started.UTC().Format(time.RFC3339))
+	case status.Error != "":
+		return fmt.Sprintf("failed at %s: %s", status.Finished.UTC().Format(time.RFC3339), status.Error)
+	default:
+		return fmt.Sprintf("ok at %s, snapshot %x", status.Finished.UTC().Format(time.RFC3339), status.SnapshotID[:4])
+	}
+}
+
+func (cmd *ScheduleList) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	names := make([]string, 0, len(cmd.Schedules))
+	for name := range cmd.Schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		schedule := cmd.Schedules[name]
+
+		repository := schedule.Repository
+		if repository == "" {
+			repository = "default"
+		}
+
+		next := "never"
+		if cron, err := scheduler.ParseCron(schedule.Cron); err != nil {
+			next = "invalid"
+		} else if t := cron.Next(now); !t.IsZero() {
+			next = t.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(ctx.Stdout, "%-16s %-16s %s -> %s (next: %s, last: %s)\n", name, schedule.Cron,
+			schedule.Path, repository, next, cmd.status(name))
+	}
+	return 0, nil
+}
+
+// ScheduleResumeRetention resumes the retention of a source paused by the
+// agent following an anomaly, once it was acknowledged.
+type ScheduleResumeRetention struct {
+	Source string
+
+	// Scheduler is set by the agent before executing the command.
+	Scheduler *scheduler.Scheduler `msgpack:"-"`
+}
+
+func (cmd *ScheduleResumeRetention) Name() string {
+	return "schedule-resume-retention"
+}
+
+func (cmd *ScheduleResumeRetention) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if cmd.Scheduler == nil {
+		return 1, fmt.Errorf("no tasks scheduled in the agent")
+	}
+
+	paused, err := cmd.Scheduler.ResumeRetention(cmd.Source)
+	if err != nil {
+		return 1, err
+	}
+	if !paused {
+		return 1, fmt.Errorf("retention of %s is not paused", cmd.Source)
+	}
+	ctx.GetLogger().Info("retention of %s resumed", cmd.Source)
+	return 0, nil
+}
@@ -0,0 +1,172 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer, textIndex bool) *snapshot.Snapshot {
+	// init temporary directories
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDir)
+		os.RemoveAll(tmpCacheDir)
+		os.RemoveAll(tmpBackupDir)
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	// create temporary files to backup
+	err = os.MkdirAll(tmpBackupDir+"/subdir", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll(tmpBackupDir+"/another_subdir", 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/dummy.txt", []byte("hello dummy"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/foo.txt", []byte("hello foo"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/another_subdir/bar.txt", []byte("hello bar"), 0644)
+	require.NoError(t, err)
+
+	// create a storage
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NotNil(t, r)
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	err = r.Create(wrappedConfig)
+	require.NoError(t, err)
+
+	// open the storage to load the configuration
+	r, serializedConfig, err := storage.Open(map[string]string{"location": tmpRepoDir})
+	require.NoError(t, err)
+
+	// create a repository
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	cache := caching.NewManager(tmpCacheDir)
+	ctx.SetCache(cache)
+
+	// Create a new logger
+	logger := logging.NewLogger(bufOut, bufErr)
+	logger.EnableInfo()
+	ctx.SetLogger(logger)
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	err = snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1, TextIndex: textIndex})
+	require.NoError(t, err)
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	return snap
+}
+
+func TestExecuteCmdSearch(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr, true)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = snap.Repository().Location()
+	args := []string{"HELLO"}
+
+	subcommand, err := parse_cmd_search(ctx, snap.Repository(), args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+	require.Equal(t, "search", subcommand.(*Search).Name())
+
+	status, err := subcommand.Execute(ctx, snap.Repository())
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	// d92a4c73:/tmp/tmp_to_backup1424943315/subdir/dummy.txt
+
+	output := bufOut.String()
+	lines := strings.Split(strings.Trim(output, "\n"), "\n")
+	require.Equal(t, 3, len(lines))
+
+	bufOut.Reset()
+	subcommand, err = parse_cmd_search(ctx, snap.Repository(), []string{"-snapshot", fmt.Sprintf("%x", snap.Header.GetIndexShortID()), "hello", "foo"})
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, snap.Repository())
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output = bufOut.String()
+	lines = strings.Split(strings.Trim(output, "\n"), "\n")
+	require.Equal(t, 1, len(lines))
+	require.True(t, strings.HasSuffix(lines[0], "/subdir/foo.txt"))
+	require.True(t, strings.HasPrefix(lines[0], fmt.Sprintf("%x:", snap.Header.GetIndexShortID())))
+}
+
+func TestExecuteCmdSearchNoIndex(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr, false)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.HomeDir = snap.Repository().Location()
+
+	subcommand, err := parse_cmd_search(ctx, snap.Repository(), []string{"hello"})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, snap.Repository())
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+
+	_, err = parse_cmd_search(ctx, snap.Repository(), []string{"?!"})
+	require.Error(t, err)
+}
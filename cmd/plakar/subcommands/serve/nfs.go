@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package serve
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/plakarnfs"
+	"github.com/PlakarKorp/plakar/repository"
+	nfs "github.com/willscott/go-nfs"
+	nfshelper "github.com/willscott/go-nfs/helpers"
+)
+
+// nfsHandleCacheSize is the number of file handles the server remembers,
+// clients getting a stale handle error for the ones it forgot.
+const nfsHandleCacheSize = 1 << 16
+
+// serveNFS exports the snapshots over NFSv3, read-only and without
+// authentication, until the command is cancelled.
+func (cmd *Serve) serveNFS(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	repo.EnableNodeCache()
+
+	listener, err := net.Listen("tcp", cmd.Listen)
+	if err != nil {
+		return 1, fmt.Errorf("serve: %w", err)
+	}
+	defer listener.Close()
+
+	filesystem := plakarnfs.NewFS(repo, cmd.locate(ctx, repo))
+	defer filesystem.Close()
+
+	// closing the listener stops the server, e.g. when the client of the
+	// agent disconnects
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.GetContext().Done():
+			listener.Close()
+		case <-stopped:
+		}
+	}()
+
+	handler := nfshelper.NewCachingHandler(nfshelper.NewNullAuthHandler(filesystem), nfsHandleCacheSize)
+	ctx.GetLogger().Info("serving repository %s over NFSv3 at %s", repo.Location(), listener.Addr())
+	if err := nfs.Serve(listener, handler); err != nil && ctx.GetContext().Err() == nil {
+		return 1, fmt.Errorf("serve: %w", err)
+	}
+	return 0, nil
+}
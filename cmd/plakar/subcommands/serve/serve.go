@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package serve
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func init() {
+	subcommands.Register("serve", parse_cmd_serve)
+}
+
+func parse_cmd_serve(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_listen string
+	var opt_name string
+	var opt_category string
+	var opt_environment string
+	var opt_perimeter string
+	var opt_job string
+	var opt_tag string
+
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] nfs\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opt_listen, "listen", "localhost:2049", "address to listen on")
+	flags.StringVar(&opt_name, "name", "", "filter by name")
+	flags.StringVar(&opt_category, "category", "", "filter by category")
+	flags.StringVar(&opt_environment, "environment", "", "filter by environment")
+	flags.StringVar(&opt_perimeter, "perimeter", "", "filter by perimeter")
+	flags.StringVar(&opt_job, "job", "", "filter by job")
+	flags.StringVar(&opt_tag, "tag", "", "filter by tag")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("need a protocol to serve")
+	}
+	switch flags.Arg(0) {
+	case "nfs":
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", flags.Arg(0))
+	}
+
+	return &Serve{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Protocol:           flags.Arg(0),
+		Listen:             opt_listen,
+
+		OptName:        opt_name,
+		OptCategory:    opt_category,
+		OptEnvironment: opt_environment,
+		OptPerimeter:   opt_perimeter,
+		OptJob:         opt_job,
+		OptTag:         opt_tag,
+	}, nil
+}
+
+type Serve struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Protocol string
+	Listen   string
+
+	OptName        string
+	OptCategory    string
+	OptEnvironment string
+	OptPerimeter   string
+	OptJob         string
+	OptTag         string
+}
+
+func (cmd *Serve) Name() string {
+	return "serve"
+}
+
+// locate returns the snapshots matching the filters, which are the ones
+// served.
+func (cmd *Serve) locate(ctx *appcontext.AppContext, repo *repository.Repository) func() ([]objects.MAC, error) {
+	return func() ([]objects.MAC, error) {
+		locateOptions := utils.NewDefaultLocateOptions()
+		locateOptions.MaxConcurrency = ctx.MaxConcurrency
+		locateOptions.Name = cmd.OptName
+		locateOptions.Category = cmd.OptCategory
+		locateOptions.Environment = cmd.OptEnvironment
+		locateOptions.Perimeter = cmd.OptPerimeter
+		locateOptions.Job = cmd.OptJob
+		locateOptions.Tag = cmd.OptTag
+		return utils.LocateSnapshotIDs(repo, locateOptions)
+	}
+}
+
+func (cmd *Serve) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	switch cmd.Protocol {
+	case "nfs":
+		return cmd.serveNFS(ctx, repo)
+	default:
+		return 1, fmt.Errorf("unsupported protocol: %s", cmd.Protocol)
+	}
+}
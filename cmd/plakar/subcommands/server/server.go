@@ -19,20 +19,47 @@ package server
 import (
 	"flag"
 	"fmt"
+	"net/url"
+	"os"
+	"strings"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/identity"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/server/httpd"
+	"github.com/PlakarKorp/plakar/server/webhook"
 )
 
 func init() {
 	subcommands.Register("server", parse_cmd_server)
 }
 
+type webhookFlags []string
+
+func (w *webhookFlags) String() string {
+	return strings.Join(*w, ",")
+}
+
+func (w *webhookFlags) Set(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL: %s", value)
+	}
+	*w = append(*w, value)
+	return nil
+}
+
 func parse_cmd_server(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
 	var opt_listen string
 	var opt_allowdelete bool
+	var opt_allowconfig bool
+	var opt_webhooks webhookFlags
+	var opt_unsigned bool
+	var opt_verify bool
+	var opt_enroll bool
+	var opt_clients string
 
 	flags := flag.NewFlagSet("server", flag.ExitOnError)
 	flags.Usage = func() {
@@ -43,8 +70,33 @@ func parse_cmd_server(ctx *appcontext.AppContext, repo *repository.Repository, a
 
 	flags.StringVar(&opt_listen, "listen", "127.0.0.1:9876", "address to listen on")
 	flags.BoolVar(&opt_allowdelete, "allow-delete", false, "disable delete operations")
+	flags.BoolVar(&opt_allowconfig, "allow-config", false, "allow clients to overwrite the repository configuration, as done by passwd")
+	flags.Var(&opt_webhooks, "webhook", "URL to notify of repository events, can be specified multiple times")
+	flags.BoolVar(&opt_unsigned, "unsigned-webhooks", false, "send webhook payloads unsigned if PLAKAR_WEBHOOK_SECRET is not set")
+	flags.BoolVar(&opt_verify, "verify", false, "check new snapshots and notify webhooks of failures")
+	flags.BoolVar(&opt_enroll, "enroll", false, "accept enrollment requests from clients")
+	flags.StringVar(&opt_clients, "clients", "", "directory holding the enrollment requests, defaults to the configuration directory")
 	flags.Parse(args)
 
+	if opt_enroll && opt_clients == "" {
+		clientsDir, err := utils.GetClientsDir()
+		if err != nil {
+			return nil, err
+		}
+		opt_clients = clientsDir
+	} else if !opt_enroll {
+		opt_clients = ""
+	}
+
+	if opt_verify && len(opt_webhooks) == 0 {
+		return nil, fmt.Errorf("-verify requires at least one -webhook")
+	}
+
+	webhookSecret := []byte(os.Getenv("PLAKAR_WEBHOOK_SECRET"))
+	if len(opt_webhooks) != 0 && len(webhookSecret) == 0 && !opt_unsigned {
+		return nil, fmt.Errorf("-webhook requires PLAKAR_WEBHOOK_SECRET to sign the payloads, or -unsigned-webhooks to send them unsigned")
+	}
+
 	noDelete := true
 	if opt_allowdelete {
 		noDelete = false
@@ -53,8 +105,16 @@ func parse_cmd_server(ctx *appcontext.AppContext, repo *repository.Repository, a
 		RepositoryLocation: repo.Location(),
 		RepositorySecret:   ctx.GetSecret(),
 
-		ListenAddr: opt_listen,
-		NoDelete:   noDelete,
+		ListenAddr:  opt_listen,
+		NoDelete:    noDelete,
+		AllowConfig: opt_allowconfig,
+
+		Webhooks:         opt_webhooks,
+		WebhookSecret:    webhookSecret,
+		UnsignedWebhooks: opt_unsigned,
+		Verify:           opt_verify,
+
+		ClientsDir: opt_clients,
 	}, nil
 }
 
@@ -62,8 +122,16 @@ type Server struct {
 	RepositoryLocation string
 	RepositorySecret   []byte
 
-	ListenAddr string
-	NoDelete   bool
+	ListenAddr  string
+	NoDelete    bool
+	AllowConfig bool
+
+	Webhooks         []string
+	WebhookSecret    []byte
+	UnsignedWebhooks bool
+	Verify           bool
+
+	ClientsDir string
 }
 
 func (cmd *Server) Name() string {
@@ -71,6 +139,29 @@ func (cmd *Server) Name() string {
 }
 
 func (cmd *Server) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
-	httpd.Server(repo, cmd.ListenAddr, cmd.NoDelete)
+	var notifier *webhook.Notifier
+	if len(cmd.Webhooks) != 0 {
+		opts := webhook.NewDefaultOptions()
+		opts.URLs = cmd.Webhooks
+		opts.Secret = cmd.WebhookSecret
+		opts.AllowUnsigned = cmd.UnsignedWebhooks
+		if err := opts.Validate(); err != nil {
+			return 1, err
+		}
+		notifier = webhook.NewNotifier(ctx.GetLogger(), opts)
+	}
+
+	var registry *identity.Registry
+	if cmd.ClientsDir != "" {
+		var err error
+		if registry, err = identity.OpenRegistry(cmd.ClientsDir); err != nil {
+			return 1, err
+		}
+		ctx.GetLogger().Info("server: enrolling clients with issuer %s", identity.Fingerprint(registry.Issuer()))
+	}
+
+	if err := httpd.Server(repo, cmd.ListenAddr, cmd.NoDelete, cmd.AllowConfig, notifier, cmd.Verify, registry); err != nil {
+		return 1, err
+	}
 	return 0, nil
 }
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package state
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/google/uuid"
+)
+
+func init() {
+	subcommands.Register("state", parse_cmd_state)
+}
+
+func parse_cmd_state(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("state", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s reconcile\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	var reconcile bool
+	switch flags.Arg(0) {
+	case "":
+	case "reconcile":
+		reconcile = true
+	default:
+		return nil, fmt.Errorf("unknown action: %s", flags.Arg(0))
+	}
+	if flags.NArg() > 1 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	return &State{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Reconcile:          reconcile,
+	}, nil
+}
+
+type State struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Reconcile bool
+}
+
+func (cmd *State) Name() string {
+	return "state"
+}
+
+func (cmd *State) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	serials, err := repo.Serials()
+	if err != nil {
+		return 1, err
+	}
+
+	if !cmd.Reconcile {
+		current := repo.Serial()
+		for _, serial := range sortedSerials(serials) {
+			marker := " "
+			if serial == current {
+				marker = "*"
+			}
+			fmt.Fprintf(ctx.Stdout, "%s %s %d states\n", marker, serial, len(serials[serial]))
+		}
+		if len(serials) > 1 {
+			fmt.Fprintf(ctx.Stdout, "%d diverging serials, run %s reconcile to merge them\n", len(serials), cmd.Name())
+		}
+
+		skews, err := repo.ClockSkews()
+		if err != nil {
+			return 1, err
+		}
+		for _, skew := range skews {
+			fmt.Fprintf(ctx.Stdout, "state %x (sequence %d) dated %s is skewed by %s\n",
+				skew.StateID[:4], skew.Sequence, skew.Timestamp.UTC().Format(time.RFC3339), skew.Skew.Round(time.Second))
+		}
+		return 0, nil
+	}
+
+	if len(serials) <= 1 {
+		fmt.Fprintf(ctx.Stdout, "state: nothing to reconcile\n")
+		return 0, nil
+	}
+
+	var lockID objects.MAC
+	if n, err := rand.Read(lockID[:]); err != nil {
+		return 1, err
+	} else if n != len(lockID) {
+		return 1, io.ErrShortWrite
+	}
+
+	done, err := repo.ExclusiveLock(lockID)
+	if err != nil {
+		return 1, err
+	}
+	defer close(done)
+
+	stateID, superseded, err := repo.CompactStates()
+	if err != nil {
+		return 1, fmt.Errorf("failed to reconcile states: %w", err)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "state: reconciled %d serials from %d states into %x (serial %s)\n",
+		len(serials), len(superseded), stateID[:4], repo.Serial())
+	return 0, nil
+}
+
+func sortedSerials(serials map[uuid.UUID][]objects.MAC) []uuid.UUID {
+	ret := make([]uuid.UUID, 0, len(serials))
+	for serial := range serials {
+		ret = append(ret, serial)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].String() < ret[j].String()
+	})
+	return ret
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepository is a repository shared by clients, each with a cache of
+// its own.
+type testRepository struct {
+	repoDir   string
+	backupDir string
+}
+
+func generateRepository(t *testing.T) *testRepository {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+		os.RemoveAll(tmpBackupDir)
+	})
+	err = os.WriteFile(tmpBackupDir+"/dummy.txt", []byte("hello dummy"), 0644)
+	require.NoError(t, err)
+
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	require.NoError(t, r.Create(wrappedConfig))
+
+	return &testRepository{repoDir: tmpRepoDir, backupDir: tmpBackupDir}
+}
+
+// open returns the repository as seen by a new client.
+func (tr *testRepository) open(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *repository.Repository {
+	r, serializedConfig, err := storage.Open(map[string]string{"location": tr.repoDir})
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	cache := caching.NewManager(t.TempDir())
+	t.Cleanup(func() { cache.Close() })
+	ctx.SetCache(cache)
+	logger := logging.NewLogger(bufOut, bufErr)
+	ctx.SetLogger(logger)
+
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+	return repo
+}
+
+func (tr *testRepository) backup(t *testing.T, repo *repository.Repository) {
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tr.backupDir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+}
+
+func execute(t *testing.T, repo *repository.Repository, args []string) {
+	ctx := repo.AppContext()
+	subcommand, err := parse_cmd_state(ctx, repo, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+}
+
+func TestExecuteCmdStateReconcile(t *testing.T) {
+	tr := generateRepository(t)
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	// two clients start from the same view of the repository
+	first := tr.open(t, bufOut, bufErr)
+	second := tr.open(t, bufOut, bufErr)
+	require.Equal(t, first.Serial(), second.Serial())
+
+	// the first compacts the states under a new serial, while the second
+	// still writes from the previous one
+	tr.backup(t, first)
+	_, _, err := first.CompactStates()
+	require.NoError(t, err)
+	tr.backup(t, second)
+
+	repo := tr.open(t, bufOut, bufErr)
+	serials, err := repo.Serials()
+	require.NoError(t, err)
+	require.Len(t, serials, 2)
+	snapshots, err := repo.GetSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+
+	bufOut.Reset()
+	execute(t, repo, []string{})
+	require.Contains(t, bufOut.String(), fmt.Sprintf("* %s", repo.Serial()))
+	require.Contains(t, bufOut.String(), "2 diverging serials")
+
+	bufOut.Reset()
+	execute(t, repo, []string{"reconcile"})
+	require.Contains(t, bufOut.String(), "state: reconciled 2 serials")
+
+	// every client now agrees on a single serial, and no snapshot was lost
+	repo = tr.open(t, bufOut, bufErr)
+	serials, err = repo.Serials()
+	require.NoError(t, err)
+	require.Len(t, serials, 1)
+	snapshots, err = repo.GetSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+
+	bufOut.Reset()
+	execute(t, repo, []string{"reconcile"})
+	require.Equal(t, "state: nothing to reconcile\n", bufOut.String())
+}
+
+func TestParseCmdState(t *testing.T) {
+	tr := generateRepository(t)
+	repo := tr.open(t, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+
+	_, err := parse_cmd_state(repo.AppContext(), repo, []string{"merge"})
+	require.Error(t, err)
+
+	_, err = parse_cmd_state(repo.AppContext(), repo, []string{"reconcile", "now"})
+	require.Error(t, err)
+}
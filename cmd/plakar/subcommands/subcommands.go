@@ -44,6 +44,16 @@ type RPC interface {
 	Name() string
 }
 
+// Limited is implemented by subcommands which may apply resource limits to
+// the process running them.  Such subcommands are never run by the agent
+// when limits are requested, as they would apply to the agent itself.
+// ApplyLimits is called before the subcommand is executed, and the cleanup
+// it returns once it is done.
+type Limited interface {
+	IsLimited() bool
+	ApplyLimits() (func() error, error)
+}
+
 type encodedRPC struct {
 	Name       string
 	Subcommand RPC
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sync
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+// mirror copies the packfiles, then the states, found in the storage of
+// src and missing from the one of dst, as is.  This requires dst to be a
+// clone of src, sharing its configuration and secret, and carries the
+// snapshot headers along since they are stored in packfiles.
+func mirror(ctx *appcontext.AppContext, src, dst *repository.Repository) (int, int, error) {
+	if src.Configuration().RepositoryID != dst.Configuration().RepositoryID {
+		return 0, 0, fmt.Errorf("%s is not a clone of %s, see plakar clone", dst.Location(), src.Location())
+	}
+
+	missing := func(srcMACs, dstMACs []objects.MAC) []objects.MAC {
+		known := make(map[objects.MAC]struct{}, len(dstMACs))
+		for _, mac := range dstMACs {
+			known[mac] = struct{}{}
+		}
+		ret := make([]objects.MAC, 0)
+		for _, mac := range srcMACs {
+			if _, ok := known[mac]; !ok {
+				ret = append(ret, mac)
+			}
+		}
+		return ret
+	}
+
+	srcPackfiles, err := src.GetPackfiles()
+	if err != nil {
+		return 0, 0, err
+	}
+	dstPackfiles, err := dst.GetPackfiles()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// states are only copied once all the packfiles made it, so that the
+	// replica never references packfiles it doesn't hold.
+	packfiles, failures := 0, 0
+	for _, mac := range missing(srcPackfiles, dstPackfiles) {
+		data, err := src.ReadVerified(resources.RT_PACKFILE, mac)
+		if err == nil {
+			err = dst.Store().PutPackfile(mac, bytes.NewReader(data))
+		}
+		if err != nil {
+			ctx.GetLogger().Error("could not mirror packfile %x to %s: %s", mac[:4], dst.Location(), err)
+			failures++
+			continue
+		}
+		packfiles++
+	}
+	if failures != 0 {
+		return packfiles, 0, fmt.Errorf("%d packfiles could not be mirrored, states left alone", failures)
+	}
+
+	srcStates, err := src.GetStates()
+	if err != nil {
+		return packfiles, 0, err
+	}
+	dstStates, err := dst.GetStates()
+	if err != nil {
+		return packfiles, 0, err
+	}
+
+	states := 0
+	for _, mac := range missing(srcStates, dstStates) {
+		data, err := src.ReadVerified(resources.RT_STATE, mac)
+		if err != nil {
+			return packfiles, states, err
+		}
+		if err := dst.Store().PutState(mac, bytes.NewReader(data)); err != nil {
+			return packfiles, states, err
+		}
+		states++
+	}
+
+	return packfiles, states, nil
+}
@@ -41,8 +41,12 @@ func parse_cmd_sync(ctx *appcontext.AppContext, repo *repository.Repository, arg
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage: %s [SNAPSHOT] to REPOSITORY\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s [SNAPSHOT] from REPOSITORY\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s -mirror to|from|with REPOSITORY\n", flags.Name())
 		flags.PrintDefaults()
 	}
+
+	var opt_mirror bool
+	flags.BoolVar(&opt_mirror, "mirror", false, "copy missing packfiles and states as is, to or from a clone")
 	flags.Parse(args)
 
 	syncSnapshotID := ""
@@ -67,11 +71,15 @@ func parse_cmd_sync(ctx *appcontext.AppContext, repo *repository.Repository, arg
 		return nil, fmt.Errorf("invalid direction, must be to, from or with")
 	}
 
+	if opt_mirror && syncSnapshotID != "" {
+		return nil, fmt.Errorf("-mirror copies whole repositories and can't select snapshots")
+	}
+
 	storeConfig := map[string]string{"location": peerRepositoryPath}
 	if strings.HasPrefix(peerRepositoryPath, "@") {
-		remote, ok := ctx.Config.GetRepository(peerRepositoryPath[1:])
-		if !ok {
-			return nil, fmt.Errorf("could not resolve peer repository: %s", peerRepositoryPath)
+		remote, err := ctx.Config.GetRepository(peerRepositoryPath[1:])
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve peer repository: %s: %w", peerRepositoryPath, err)
 		}
 		if _, ok := remote["location"]; !ok {
 			return nil, fmt.Errorf("could not resolve peer repository location: %s", peerRepositoryPath)
@@ -136,6 +144,7 @@ func parse_cmd_sync(ctx *appcontext.AppContext, repo *repository.Repository, arg
 		PeerRepositorySecret:     peerSecret,
 		Direction:                direction,
 		SnapshotPrefix:           syncSnapshotID,
+		Mirror:                   opt_mirror,
 	}, nil
 }
 
@@ -149,6 +158,7 @@ type Sync struct {
 	Direction string
 
 	SnapshotPrefix string
+	Mirror         bool
 }
 
 func (cmd *Sync) Name() string {
@@ -159,9 +169,9 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 
 	storeConfig := map[string]string{"location": cmd.PeerRepositoryLocation}
 	if strings.HasPrefix(cmd.PeerRepositoryLocation, "@") {
-		remote, ok := ctx.Config.GetRepository(cmd.PeerRepositoryLocation[1:])
-		if !ok {
-			return 1, fmt.Errorf("could not resolve repository: %s", cmd.PeerRepositoryLocation)
+		remote, err := ctx.Config.GetRepository(cmd.PeerRepositoryLocation[1:])
+		if err != nil {
+			return 1, fmt.Errorf("could not resolve repository: %s: %w", cmd.PeerRepositoryLocation, err)
 		}
 		if _, ok := remote["location"]; !ok {
 			return 1, fmt.Errorf("could not resolve repository location: %s", cmd.PeerRepositoryLocation)
@@ -198,6 +208,10 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 		return 1, fmt.Errorf("could not synchronize %s: invalid direction, must be to, from or with", peerStore.Location())
 	}
 
+	if cmd.Mirror {
+		return cmd.mirror(ctx, srcRepository, dstRepository)
+	}
+
 	srcSnapshots, err := srcRepository.GetSnapshots()
 	if err != nil {
 		return 1, fmt.Errorf("could not get list of snapshots from source repository %s: %s", srcRepository.Location(), err)
@@ -235,7 +249,7 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 	}
 
 	for _, snapshotID := range srcSyncList {
-		err := synchronize(srcRepository, dstRepository, snapshotID)
+		err := synchronize(ctx, srcRepository, dstRepository, snapshotID)
 		if err != nil {
 			ctx.GetLogger().Error("failed to synchronize snapshot %x from source repository %s: %s",
 				snapshotID[:4], srcRepository.Location(), err)
@@ -256,7 +270,7 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 		}
 
 		for _, snapshotID := range dstSyncList {
-			err := synchronize(dstRepository, srcRepository, snapshotID)
+			err := synchronize(ctx, dstRepository, srcRepository, snapshotID)
 			if err != nil {
 				ctx.GetLogger().Error("failed to synchronize snapshot %x from peer repository %s: %s",
 					snapshotID[:4], dstRepository.Location(), err)
@@ -284,7 +298,26 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 	return 0, nil
 }
 
-func synchronize(srcRepository, dstRepository *repository.Repository, snapshotID objects.MAC) error {
+func (cmd *Sync) mirror(ctx *appcontext.AppContext, srcRepository, dstRepository *repository.Repository) (int, error) {
+	packfiles, states, err := mirror(ctx, srcRepository, dstRepository)
+	if err != nil {
+		return 1, fmt.Errorf("could not mirror %s to %s: %w", srcRepository.Location(), dstRepository.Location(), err)
+	}
+	ctx.GetLogger().Info("%s: mirroring from %s to %s completed: %d packfiles and %d states copied",
+		cmd.Name(), srcRepository.Location(), dstRepository.Location(), packfiles, states)
+
+	if cmd.Direction == "with" {
+		packfiles, states, err := mirror(ctx, dstRepository, srcRepository)
+		if err != nil {
+			return 1, fmt.Errorf("could not mirror %s to %s: %w", dstRepository.Location(), srcRepository.Location(), err)
+		}
+		ctx.GetLogger().Info("%s: mirroring from %s to %s completed: %d packfiles and %d states copied",
+			cmd.Name(), dstRepository.Location(), srcRepository.Location(), packfiles, states)
+	}
+	return 0, nil
+}
+
+func synchronize(ctx *appcontext.AppContext, srcRepository, dstRepository *repository.Repository, snapshotID objects.MAC) error {
 	srcSnapshot, err := snapshot.Load(srcRepository, snapshotID)
 	if err != nil {
 		return err
@@ -300,9 +333,29 @@ func synchronize(srcRepository, dstRepository *repository.Repository, snapshotID
 	// overwrite the header, we want to keep the original snapshot info
 	dstSnapshot.Header = srcSnapshot.Header
 
-	if err := srcSnapshot.Synchronize(dstSnapshot); err != nil {
+	// the journal lets an interrupted transfer resume where it stopped,
+	// failing to open it only costs us that ability.
+	journal, err := ctx.GetCache().Sync(srcRepository.Configuration().RepositoryID,
+		dstRepository.Configuration().RepositoryID)
+	if err != nil {
+		ctx.GetLogger().Warn("could not open synchronization journal: %s", err)
+		journal = nil
+	} else {
+		defer journal.Close()
+	}
+
+	if err := srcSnapshot.Synchronize(dstSnapshot, journal); err != nil {
+		return err
+	}
+
+	if err := dstSnapshot.Commit(); err != nil {
 		return err
 	}
 
-	return dstSnapshot.Commit()
+	if journal != nil {
+		if err := journal.DeleteSnapshot(snapshotID); err != nil {
+			ctx.GetLogger().Warn("could not clear synchronization journal: %s", err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	tmpRepoDir := filepath.Join(t.TempDir(), "repo")
+	tmpCacheDir := t.TempDir()
+	tmpBackupDir := t.TempDir()
+
+	err := os.MkdirAll(tmpBackupDir+"/subdir", 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/dummy.txt", []byte("hello dummy"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/foo.txt", []byte("hello foo"), 0644)
+	require.NoError(t, err)
+
+	// create a storage
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	config.Encryption = nil
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	require.NoError(t, r.Create(wrappedConfig))
+
+	// open the storage to load the configuration
+	r, serializedConfig, err := storage.Open(map[string]string{"location": tmpRepoDir})
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+	ctx.SetCache(caching.NewManager(tmpCacheDir))
+	logger := logging.NewLogger(bufOut, bufErr)
+	logger.EnableInfo()
+	ctx.SetLogger(logger)
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err, "creating repository")
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+
+	require.NoError(t, snap.Repository().RebuildState())
+	return snap
+}
+
+// openPeer opens the repository at location, as seen by a new process
+// with its own cache.
+func openPeer(t *testing.T, ctx *appcontext.AppContext, location string) *repository.Repository {
+	store, serializedConfig, err := storage.Open(map[string]string{"location": location})
+	require.NoError(t, err)
+	peerCtx := appcontext.NewAppContextFrom(ctx)
+	peerCtx.SetCache(caching.NewManager(t.TempDir()))
+	peer, err := repository.New(peerCtx, store, serializedConfig)
+	require.NoError(t, err)
+	return peer
+}
+
+func TestExecuteCmdSyncMirror(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+
+	// an empty clone shares the configuration of the repository
+	_, wrappedConfig, err := storage.Open(map[string]string{"location": repo.Location()})
+	require.NoError(t, err)
+	replicaDir := filepath.Join(t.TempDir(), "replica")
+	_, err = storage.Create(map[string]string{"location": replicaDir}, wrappedConfig)
+	require.NoError(t, err)
+
+	_, err = parse_cmd_sync(ctx, repo, []string{"-mirror", "abcd", "to", replicaDir})
+	require.ErrorContains(t, err, "can't select snapshots")
+
+	subcommand, err := parse_cmd_sync(ctx, repo, []string{"-mirror", "to", replicaDir})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	replica := openPeer(t, ctx, replicaDir)
+	snapshotIDs, err := replica.GetSnapshots()
+	require.NoError(t, err)
+	require.Equal(t, []objects.MAC{snap.Header.Identifier}, snapshotIDs)
+
+	mirrored, err := snapshot.Load(replica, snap.Header.Identifier)
+	require.NoError(t, err)
+	mirrored.Close()
+
+	// a second run has nothing left to copy
+	packfiles, states, err := mirror(ctx, repo, replica)
+	require.NoError(t, err)
+	require.Equal(t, 0, packfiles)
+	require.Equal(t, 0, states)
+
+	// damage isn't propagated
+	bogus := objects.MAC{0xde, 0xad}
+	rd, err := storage.Serialize(repo.GetMACHasher(), resources.RT_PACKFILE, versioning.GetCurrentVersion(resources.RT_PACKFILE), bytes.NewReader([]byte("bogus")))
+	require.NoError(t, err)
+	require.NoError(t, repo.Store().PutPackfile(bogus, rd))
+
+	_, _, err = mirror(ctx, repo, replica)
+	require.ErrorContains(t, err, "1 packfiles could not be mirrored")
+	require.Contains(t, bufErr.String(), fmt.Sprintf("%x", bogus[:4]))
+	_, err = replica.Store().GetPackfile(bogus)
+	require.Error(t, err)
+
+	// only clones can be mirrored to
+	other := generateSnapshot(t, bufOut, bufErr)
+	defer other.Close()
+	_, _, err = mirror(ctx, repo, other.Repository())
+	require.ErrorContains(t, err, "is not a clone")
+}
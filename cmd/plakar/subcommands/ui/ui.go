@@ -20,10 +20,13 @@
 package ui
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/PlakarKorp/plakar/api"
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/repository"
@@ -40,6 +43,8 @@ func parse_cmd_ui(ctx *appcontext.AppContext, repo *repository.Repository, args
 	var opt_cors bool
 	var opt_noauth bool
 	var opt_nospawn bool
+	var opt_namespaces string
+	var opt_paths string
 
 	flags := flag.NewFlagSet("ui", flag.ExitOnError)
 	flags.Usage = func() {
@@ -52,8 +57,32 @@ func parse_cmd_ui(ctx *appcontext.AppContext, repo *repository.Repository, args
 	flags.BoolVar(&opt_cors, "cors", false, "enable CORS")
 	flags.BoolVar(&opt_noauth, "no-auth", false, "don't use authentication")
 	flags.BoolVar(&opt_nospawn, "no-spawn", false, "don't spawn browser")
+	flags.StringVar(&opt_namespaces, "namespaces", "", "path to a file of \"token namespace\" lines confining API tokens to a namespace")
+	flags.StringVar(&opt_paths, "paths", "", "path to a file of \"token prefix ...\" lines restricting API tokens to path prefixes")
 	flags.Parse(args)
 
+	var namespaces api.NamespacePolicy
+	if opt_namespaces != "" {
+		if opt_noauth {
+			return nil, fmt.Errorf("-namespaces requires authentication")
+		}
+		var err error
+		if namespaces, err = loadNamespaces(opt_namespaces); err != nil {
+			return nil, err
+		}
+	}
+
+	var paths api.PathPolicy
+	if opt_paths != "" {
+		if opt_noauth {
+			return nil, fmt.Errorf("-paths requires authentication")
+		}
+		var err error
+		if paths, err = loadPaths(opt_paths); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Ui{
 		RepositoryLocation: repo.Location(),
 		RepositorySecret:   ctx.GetSecret(),
@@ -61,9 +90,79 @@ func parse_cmd_ui(ctx *appcontext.AppContext, repo *repository.Repository, args
 		Cors:               opt_cors,
 		NoAuth:             opt_noauth,
 		NoSpawn:            opt_nospawn,
+		Namespaces:         namespaces,
+		Paths:              paths,
 	}, nil
 }
 
+// loadNamespaces reads a namespace policy, one "token namespace" pair per
+// line, empty lines and lines starting with # being ignored.
+func loadNamespaces(filename string) (api.NamespacePolicy, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open namespaces file: %w", err)
+	}
+	defer fp.Close()
+
+	policy := make(api.NamespacePolicy)
+	scanner := bufio.NewScanner(fp)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"token namespace\"", filename, lineno)
+		}
+		if _, exists := policy[fields[0]]; exists {
+			return nil, fmt.Errorf("%s:%d: duplicate token", filename, lineno)
+		}
+		policy[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// loadPaths reads a path policy, one token followed by the absolute path
+// prefixes it may access per line, empty lines and lines starting with #
+// being ignored.
+func loadPaths(filename string) (api.PathPolicy, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open paths file: %w", err)
+	}
+	defer fp.Close()
+
+	policy := make(api.PathPolicy)
+	scanner := bufio.NewScanner(fp)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"token prefix ...\"", filename, lineno)
+		}
+		if _, exists := policy[fields[0]]; exists {
+			return nil, fmt.Errorf("%s:%d: duplicate token", filename, lineno)
+		}
+		for _, prefix := range fields[1:] {
+			if !strings.HasPrefix(prefix, "/") {
+				return nil, fmt.Errorf("%s:%d: %s: prefix must be absolute", filename, lineno, prefix)
+			}
+		}
+		policy[fields[0]] = fields[1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
 type Ui struct {
 	RepositoryLocation string
 	RepositorySecret   []byte
@@ -72,6 +171,9 @@ type Ui struct {
 	Cors    bool
 	NoAuth  bool
 	NoSpawn bool
+
+	Namespaces api.NamespacePolicy
+	Paths      api.PathPolicy
 }
 
 func (cmd *Ui) Name() string {
@@ -83,6 +185,9 @@ func (cmd *Ui) Execute(ctx *appcontext.AppContext, repo *repository.Repository)
 		NoSpawn: cmd.NoSpawn,
 		Cors:    cmd.Cors,
 		Token:   "",
+
+		Namespaces: cmd.Namespaces,
+		Paths:      cmd.Paths,
 	}
 
 	if !cmd.NoAuth {
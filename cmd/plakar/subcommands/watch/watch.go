@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package watch
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gobwas/glob"
+)
+
+func init() {
+	subcommands.Register("watch", parse_cmd_watch)
+}
+
+func parse_cmd_watch(ctx *appcontext.AppContext, repo *repository.Repository, args []string) (subcommands.Subcommand, error) {
+	var opt_tags string
+	var opt_excludes string
+	var opt_exclude backup.ExcludeFlags
+	var opt_concurrency uint64
+	var opt_quiet bool
+	var opt_debounce time.Duration
+	var opt_mininterval time.Duration
+
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] path\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel tasks")
+	flags.StringVar(&opt_tags, "tag", "", "comma-separated list of tags to assign to the snapshots, either names or key=value pairs")
+	flags.StringVar(&opt_excludes, "excludes", "", "path to a file containing newline-separated glob patterns, treated as -exclude")
+	flags.Var(&opt_exclude, "exclude", "glob pattern to exclude files, can be specified multiple times to add several exclusion patterns")
+	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
+	flags.DurationVar(&opt_debounce, "debounce", 10*time.Second, "time without changes after which a snapshot is taken")
+	flags.DurationVar(&opt_mininterval, "min-interval", time.Minute, "minimum time between two snapshots")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return nil, fmt.Errorf("expected a single path to watch")
+	}
+	if opt_debounce <= 0 {
+		return nil, fmt.Errorf("invalid -debounce value: %s", opt_debounce)
+	}
+	if opt_mininterval < 0 {
+		return nil, fmt.Errorf("invalid -min-interval value: %s", opt_mininterval)
+	}
+
+	path := flags.Arg(0)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ctx.CWD, path)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", path)
+	}
+
+	excludes, err := backup.LoadExcludes(opt_exclude, opt_excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watch{
+		RepositoryLocation: repo.Location(),
+		RepositorySecret:   ctx.GetSecret(),
+		Backup: backup.Backup{
+			RepositoryLocation: repo.Location(),
+			RepositorySecret:   ctx.GetSecret(),
+			Concurrency:        opt_concurrency,
+			Tags:               opt_tags,
+			Excludes:           excludes,
+			Quiet:              opt_quiet,
+			Path:               path,
+		},
+		Debounce:    opt_debounce,
+		MinInterval: opt_mininterval,
+	}, nil
+}
+
+// Watch monitors a directory tree and takes a snapshot of it once changes
+// settle, that is when no change happened for Debounce, no sooner than
+// MinInterval after the previous snapshot.
+type Watch struct {
+	RepositoryLocation string
+	RepositorySecret   []byte
+
+	Backup      backup.Backup
+	Debounce    time.Duration
+	MinInterval time.Duration
+}
+
+func (cmd *Watch) Name() string {
+	return "watch"
+}
+
+func excluded(excludes []glob.Glob, pathname string) bool {
+	for _, exclude := range excludes {
+		if exclude.Match(pathname) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTree watches root and the directories below it, except the excluded
+// ones.
+func addTree(watcher *fsnotify.Watcher, root string, excludes []glob.Glob) error {
+	return filepath.WalkDir(root, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory may have vanished since it was reported
+			if pathname != root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if pathname != root && excluded(excludes, pathname) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(pathname)
+	})
+}
+
+// delay returns how long to wait before taking a snapshot after a change.
+func (cmd *Watch) delay(lastBackup time.Time) time.Duration {
+	delay := cmd.Debounce
+	if wait := time.Until(lastBackup.Add(cmd.MinInterval)); wait > delay {
+		delay = wait
+	}
+	return delay
+}
+
+func (cmd *Watch) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	excludes := []glob.Glob{}
+	for _, item := range cmd.Backup.Excludes {
+		g, err := glob.Compile(item)
+		if err != nil {
+			return 1, fmt.Errorf("failed to compile exclude pattern: %s", item)
+		}
+		excludes = append(excludes, g)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return 1, err
+	}
+	defer watcher.Close()
+
+	root := cmd.Backup.Path
+	if err := addTree(watcher, root, excludes); err != nil {
+		return 1, fmt.Errorf("failed to watch %s: %w", root, err)
+	}
+	ctx.GetLogger().Info("%s: watching %s", cmd.Name(), root)
+
+	timer := time.NewTimer(cmd.Debounce)
+	timer.Stop()
+
+	var lastBackup time.Time
+	pending := false
+	for {
+		select {
+		case <-ctx.GetContext().Done():
+			return 0, nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return 0, nil
+			}
+			if excluded(excludes, event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Lstat(event.Name); err == nil && fi.IsDir() {
+					if err := addTree(watcher, event.Name, excludes); err != nil {
+						ctx.GetLogger().Warn("%s: failed to watch %s: %s", cmd.Name(), event.Name, err)
+					}
+				}
+			}
+			pending = true
+			timer.Reset(cmd.delay(lastBackup))
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return 0, nil
+			}
+			ctx.GetLogger().Warn("%s: %s", cmd.Name(), err)
+			// changes were lost, the next snapshot catches up with them
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				pending = true
+				timer.Reset(cmd.delay(lastBackup))
+			}
+
+		case <-timer.C:
+			if !pending {
+				continue
+			}
+			if wait := time.Until(lastBackup.Add(cmd.MinInterval)); wait > 0 {
+				timer.Reset(wait)
+				continue
+			}
+			pending = false
+			lastBackup = time.Now()
+
+			retval, err := cmd.Backup.Execute(ctx, repo)
+			if err != nil || retval != 0 {
+				ctx.GetLogger().Error("%s: failed to create snapshot: %v", cmd.Name(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchDelay(t *testing.T) {
+	cmd := &Watch{Debounce: 10 * time.Second, MinInterval: time.Minute}
+
+	// no previous snapshot, only the debounce applies
+	require.Equal(t, 10*time.Second, cmd.delay(time.Time{}))
+
+	// a recent snapshot postpones the next one to the minimum interval
+	delay := cmd.delay(time.Now().Add(-30 * time.Second))
+	require.Greater(t, delay, 20*time.Second)
+	require.LessOrEqual(t, delay, 30*time.Second)
+
+	require.Equal(t, 10*time.Second, cmd.delay(time.Now().Add(-2*time.Minute)))
+}
+
+func TestWatchAddTree(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "cache/c", "d"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "file"), []byte("data"), 0644))
+
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	excludes := []glob.Glob{glob.MustCompile(filepath.Join(root, "cache"))}
+	require.NoError(t, addTree(watcher, root, excludes))
+
+	watched := watcher.WatchList()
+	sort.Strings(watched)
+	require.Equal(t, []string{
+		root,
+		filepath.Join(root, "a"),
+		filepath.Join(root, "a", "b"),
+		filepath.Join(root, "d"),
+	}, watched)
+}
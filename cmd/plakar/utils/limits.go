@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits describes the resource limits a process applies to itself so
+// that it does not degrade the host it runs on.  They apply to the whole
+// process and are never lifted.
+type Limits struct {
+	Nice   int
+	IONice string
+	CPUMax string
+	IOMax  string
+}
+
+func (l *Limits) InstallFlags(flags *flag.FlagSet) {
+	flags.IntVar(&l.Nice, "nice", 0, "increase the niceness of the process by this value (1 to 19)")
+	flags.StringVar(&l.IONice, "ionice", "", "I/O scheduling class of the process: idle, best-effort[:level] or realtime[:level]")
+	flags.StringVar(&l.CPUMax, "cpu-max", "", "CPU quota of the process in a cgroup v2, either as a percentage of a CPU (e.g. 50%) or as a raw cpu.max value")
+	flags.StringVar(&l.IOMax, "io-max", "", "I/O limits of the process in a cgroup v2, as a raw io.max value (e.g. \"8:0 rbps=1048576 wbps=1048576\")")
+}
+
+func (l *Limits) IsSet() bool {
+	return l.Nice != 0 || l.IONice != "" || l.CPUMax != "" || l.IOMax != ""
+}
+
+// Validate checks the limits without applying them.
+func (l *Limits) Validate() error {
+	if l.Nice < 0 || l.Nice > 19 {
+		return fmt.Errorf("invalid nice value %d, must be between 0 and 19", l.Nice)
+	}
+	if l.IONice != "" {
+		if _, _, err := parseIONice(l.IONice); err != nil {
+			return err
+		}
+	}
+	if l.CPUMax != "" {
+		if _, err := parseCPUMax(l.CPUMax); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	ioprioClassRealtime   = 1
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+)
+
+// parseIONice parses class[:level] and returns the I/O scheduling class
+// and level.
+func parseIONice(value string) (int, int, error) {
+	name, levelStr, hasLevel := strings.Cut(value, ":")
+
+	var class int
+	switch name {
+	case "idle":
+		if hasLevel {
+			return 0, 0, fmt.Errorf("invalid ionice value %q: the idle class has no level", value)
+		}
+		return ioprioClassIdle, 0, nil
+	case "best-effort":
+		class = ioprioClassBestEffort
+	case "realtime":
+		class = ioprioClassRealtime
+	default:
+		return 0, 0, fmt.Errorf("invalid ionice class %q", name)
+	}
+
+	level := 4
+	if hasLevel {
+		n, err := strconv.Atoi(levelStr)
+		if err != nil || n < 0 || n > 7 {
+			return 0, 0, fmt.Errorf("invalid ionice level %q, must be between 0 and 7", levelStr)
+		}
+		level = n
+	}
+	return class, level, nil
+}
+
+const cpuMaxPeriod = 100000
+
+// parseCPUMax converts a percentage of a CPU to a cpu.max value, raw
+// cpu.max values are returned as is.
+func parseCPUMax(value string) (string, error) {
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		n, err := strconv.ParseFloat(percent, 64)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("invalid cpu-max percentage %q", value)
+		}
+		return fmt.Sprintf("%d %d", int64(n*cpuMaxPeriod/100), cpuMaxPeriod), nil
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) < 1 || len(fields) > 2 {
+		return "", fmt.Errorf("invalid cpu-max value %q", value)
+	}
+	if fields[0] != "max" {
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid cpu-max value %q", value)
+		}
+	}
+	if len(fields) == 2 {
+		if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid cpu-max value %q", value)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,197 @@
+//go:build linux
+// +build linux
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const ioprioWhoProcess = 1
+
+// Apply applies the limits to the current process, returning the cleanup
+// to run before it exits.
+func (l *Limits) Apply() (func() error, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	// on Linux, the nice value and I/O priority are per-thread attributes
+	// which new threads inherit from the thread creating them, so they
+	// have to be set on every thread of the process.
+	if l.Nice != 0 || l.IONice != "" {
+		tids, err := threadIDs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tid := range tids {
+			if l.Nice != 0 {
+				current, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+				if err != nil {
+					return nil, fmt.Errorf("could not get priority: %w", err)
+				}
+				// the raw syscall returns 20 - nice
+				nice := 20 - current + l.Nice
+				if nice > 19 {
+					nice = 19
+				}
+				if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+					return nil, fmt.Errorf("could not set nice value: %w", err)
+				}
+			}
+
+			if l.IONice != "" {
+				class, level, _ := parseIONice(l.IONice)
+				ioprio := uintptr(class<<13 | level)
+				if _, _, errno := syscall.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprio); errno != 0 {
+					return nil, fmt.Errorf("could not set I/O priority: %w", errno)
+				}
+			}
+		}
+	}
+
+	if l.CPUMax != "" || l.IOMax != "" {
+		cleanup, err := l.applyCgroup()
+		if err != nil {
+			return nil, fmt.Errorf("could not apply cgroup limits: %w", err)
+		}
+		return cleanup, nil
+	}
+	return func() error { return nil }, nil
+}
+
+func threadIDs() ([]int, error) {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// currentCgroup returns the path of the cgroup v2 the process belongs to.
+func currentCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join("/sys/fs/cgroup", path), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("cgroup v2 hierarchy not found")
+}
+
+// applyCgroup moves the process to a child of its current cgroup, which must
+// be delegated to the user running plakar, and sets the limits on it.  The
+// cleanup returned moves the process back and removes the child.
+func (l *Limits) applyCgroup() (func() error, error) {
+	parent, err := currentCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	child := filepath.Join(parent, fmt.Sprintf("plakar-%d", os.Getpid()))
+	if err := os.Mkdir(child, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	// a cgroup can only distribute resources to its children once it has
+	// no process of its own, so move first and enable controllers next.
+	if err := os.WriteFile(filepath.Join(child, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		os.Remove(child)
+		return nil, err
+	}
+
+	wanted := []string{}
+	if l.CPUMax != "" {
+		wanted = append(wanted, "cpu")
+	}
+	if l.IOMax != "" {
+		wanted = append(wanted, "io")
+	}
+
+	// only the controllers not yet enabled are, and disabled again by the
+	// cleanup, so that those other children rely on are left alone.
+	subtreeControl := filepath.Join(parent, "cgroup.subtree_control")
+	data, err := os.ReadFile(subtreeControl)
+	if err != nil {
+		os.WriteFile(filepath.Join(parent, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0)
+		os.Remove(child)
+		return nil, err
+	}
+	enabled := strings.Fields(string(data))
+	missing := []string{}
+	for _, controller := range wanted {
+		if !slices.Contains(enabled, controller) {
+			missing = append(missing, controller)
+		}
+	}
+
+	cleanup := func() error {
+		if len(missing) != 0 {
+			disable := make([]string, len(missing))
+			for i, controller := range missing {
+				disable[i] = "-" + controller
+			}
+			if err := os.WriteFile(subtreeControl, []byte(strings.Join(disable, " ")), 0); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(parent, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+			return err
+		}
+		return os.Remove(child)
+	}
+
+	if len(missing) != 0 {
+		enable := make([]string, len(missing))
+		for i, controller := range missing {
+			enable[i] = "+" + controller
+		}
+		if err := os.WriteFile(subtreeControl, []byte(strings.Join(enable, " ")), 0); err != nil {
+			missing = nil
+			cleanup()
+			return nil, err
+		}
+	}
+
+	if l.CPUMax != "" {
+		cpuMax, _ := parseCPUMax(l.CPUMax)
+		if err := os.WriteFile(filepath.Join(child, "cpu.max"), []byte(cpuMax), 0); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	if l.IOMax != "" {
+		if err := os.WriteFile(filepath.Join(child, "io.max"), []byte(l.IOMax), 0); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	return cleanup, nil
+}
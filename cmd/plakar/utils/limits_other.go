@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (l *Limits) Apply() (func() error, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	if l.IsSet() {
+		return nil, fmt.Errorf("resource limits are not supported on %s", runtime.GOOS)
+	}
+	return func() error { return nil }, nil
+}
@@ -17,6 +17,8 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"path"
@@ -28,6 +30,7 @@ import (
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/header"
 )
 
 type locateSortOrder int
@@ -89,6 +92,11 @@ func LocateSnapshotIDs(repo *repository.Repository, opts *LocateOptions) ([]obje
 		opts = NewDefaultLocateOptions()
 	}
 
+	tagFilter, err := header.ParseTagFilter(opts.Tag)
+	if err != nil {
+		return nil, err
+	}
+
 	wg := sync.WaitGroup{}
 	maxConcurrency := make(chan struct{}, opts.MaxConcurrency)
 	for snapshotID := range repo.ListSnapshots() {
@@ -142,10 +150,8 @@ func LocateSnapshotIDs(repo *repository.Repository, opts *LocateOptions) ([]obje
 				}
 			}
 
-			if opts.Tag != "" {
-				if !snap.Header.HasTag(opts.Tag) {
-					return
-				}
+			if !tagFilter.Match(snap.Header) {
+				return
 			}
 
 			if !opts.Before.IsZero() {
@@ -196,6 +202,22 @@ func LocateSnapshotIDs(repo *repository.Repository, opts *LocateOptions) ([]obje
 	return resultSet, nil
 }
 
+// ConfirmationToken identifies a selection of snapshots, so that deleting
+// them can be confirmed by presenting the token of a preview: it no longer
+// matches once snapshots are added to or removed from the selection.
+func ConfirmationToken(snapshotIDs []objects.MAC) string {
+	sorted := append([]objects.MAC(nil), snapshotIDs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+
+	hasher := sha256.New()
+	for _, snapshotID := range sorted {
+		hasher.Write(snapshotID[:])
+	}
+	return hex.EncodeToString(hasher.Sum(nil))[:16]
+}
+
 func ParseSnapshotPath(snapshotPath string) (string, string) {
 	if strings.HasPrefix(snapshotPath, "/") {
 		return "", snapshotPath
@@ -244,7 +266,9 @@ func OpenSnapshotByPath(repo *repository.Repository, snapshotPath string) (*snap
 	}
 
 	var snapRoot string
-	if strings.HasPrefix(pathname, "/") {
+	if pathname == "" {
+		snapRoot = snap.Header.GetSource(0).Importer.Root()
+	} else if strings.HasPrefix(pathname, "/") {
 		snapRoot = pathname
 	} else {
 		snapRoot = path.Clean(path.Join(snap.Header.GetSource(0).Importer.Directory, pathname))
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package utils
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+)
+
+// HandleShutdownSignals cancels the operations running under ctx on the
+// first SIGINT or SIGTERM, letting them stop cleanly, then calls stopped
+// if not nil.  A second signal exits immediately.
+func HandleShutdownSignals(ctx *appcontext.AppContext, stopped func()) {
+	cancelCtx, cancel := context.WithCancel(ctx.GetContext())
+	ctx.SetContext(cancelCtx)
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		ctx.GetLogger().Warn("received %s, stopping cleanly, send it again to exit immediately", sig)
+		cancel()
+		if stopped != nil {
+			stopped()
+		}
+
+		<-sigChan
+		os.Exit(1)
+	}()
+}
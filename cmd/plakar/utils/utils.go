@@ -255,6 +255,16 @@ func GetConfigDir(appName string) (string, error) {
 	return configDir, nil
 }
 
+// GetClientsDir returns the directory where a server keeps the enrollment
+// requests of its clients.
+func GetClientsDir() (string, error) {
+	configDir, err := GetConfigDir("plakar")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "clients"), nil
+}
+
 var VERSION = "v1.0.0"
 
 func GetVersion() string {
@@ -1,54 +1,118 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	pathname          string
+	Include           []string                    `yaml:"include,omitempty"`
 	DefaultRepository string                      `yaml:"default-repo"`
 	Repositories      map[string]RepositoryConfig `yaml:"repositories"`
 	Remotes           map[string]RemoteConfig     `yaml:"remotes"`
+	Schedules         map[string]ScheduleConfig   `yaml:"schedules,omitempty"`
+
+	// masterKey seals the values set with Seal.  The maps above hold the
+	// values as stored, encrypted values and keychain references only
+	// being resolved by GetRepository and GetRemote.
+	masterKey []byte
+
+	// inherited records what comes from the included files, so that it is
+	// not copied into this file when saving.
+	inherited          map[string]string
+	inheritedSchedules map[string]ScheduleConfig
 }
 
 type RepositoryConfig map[string]string
 type RemoteConfig map[string]string
 
+// ScheduleConfig is a backup run by the agent at the times matching Cron,
+// a crontab(5) style specification.  Path is a directory or an @remote,
+// Repository an @repository or location, the default repository if empty.
+// Excludes are glob patterns of the paths left out of the backup, and
+// SystemState the system state modules captured alongside the files.
+type ScheduleConfig struct {
+	Cron        string   `yaml:"cron"`
+	Path        string   `yaml:"path"`
+	Repository  string   `yaml:"repository,omitempty"`
+	Excludes    []string `yaml:"excludes,omitempty"`
+	SystemState string   `yaml:"system_state,omitempty"`
+}
+
+// Equal reports whether two schedules are the same.
+func (s ScheduleConfig) Equal(other ScheduleConfig) bool {
+	return s.Cron == other.Cron && s.Path == other.Path &&
+		s.Repository == other.Repository && slices.Equal(s.Excludes, other.Excludes) &&
+		s.SystemState == other.SystemState
+}
+
 func LoadOrCreate(configFile string) (*Config, error) {
-	f, err := os.Open(configFile)
+	config, err := decodeFile(configFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			cfg := &Config{
-				pathname:     configFile,
-				Repositories: make(map[string]RepositoryConfig),
-				Remotes:      make(map[string]RemoteConfig),
+				pathname:           configFile,
+				Repositories:       make(map[string]RepositoryConfig),
+				Remotes:            make(map[string]RemoteConfig),
+				Schedules:          make(map[string]ScheduleConfig),
+				inherited:          make(map[string]string),
+				inheritedSchedules: make(map[string]ScheduleConfig),
 			}
 			return cfg, cfg.Save()
 		}
-		return nil, fmt.Errorf("error reading config file: %T", err)
-	}
-	defer f.Close()
-	var config Config
-	if err := yaml.NewDecoder(f).Decode(&config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		if _, ok := err.(*os.PathError); ok {
+			return nil, fmt.Errorf("error reading config file: %T", err)
+		}
+		return nil, err
 	}
-	config.pathname = configFile
-	if config.Repositories == nil {
-		config.Repositories = make(map[string]RepositoryConfig)
+
+	pathname, err := filepath.Abs(configFile)
+	if err != nil {
+		return nil, err
 	}
-	if config.Remotes == nil {
-		config.Remotes = make(map[string]RemoteConfig)
+	base, err := loadIncludes(config, map[string]struct{}{pathname: {}})
+	if err != nil {
+		return nil, err
 	}
-	return &config, nil
+	config.inherited = make(map[string]string)
+	config.inheritedSchedules = make(map[string]ScheduleConfig)
+	config.inherit(base)
+	return config, nil
 }
 
+// Reload reads the configuration file again, to catch up with the changes
+// made by other processes.
+func (c *Config) Reload() (*Config, error) {
+	return LoadOrCreate(c.pathname)
+}
+
+// Render writes the configuration as stored: values are written in their
+// original form, encrypted, keychain references or environment variables,
+// and the ones inherited from the included files are left out.
 func (c *Config) Render(w io.Writer) error {
-	return yaml.NewEncoder(w).Encode(c)
+	stored := *c
+	stored.Repositories = stripInherited(c, "repositories", c.Repositories)
+	stored.Remotes = stripInherited(c, "remotes", c.Remotes)
+
+	if inherited, ok := c.inherited[inheritedKey("default-repo")]; ok && inherited == c.DefaultRepository {
+		stored.DefaultRepository = ""
+	}
+
+	stored.Schedules = make(map[string]ScheduleConfig, len(c.Schedules))
+	for name, schedule := range c.Schedules {
+		if inherited, ok := c.inheritedSchedules[name]; ok && inherited.Equal(schedule) {
+			continue
+		}
+		stored.Schedules[name] = schedule
+	}
+	return yaml.NewEncoder(w).Encode(&stored)
 }
 
 func (c *Config) Save() error {
@@ -72,9 +136,10 @@ func (c *Config) HasRepository(name string) bool {
 	return ok
 }
 
-func (c *Config) GetRepository(name string) (map[string]string, bool) {
-	kv, ok := c.Repositories[name]
-	return kv, ok
+// GetRepository returns the options of a repository, resolved to their
+// clear text.
+func (c *Config) GetRepository(name string) (map[string]string, error) {
+	return resolveEntry(c, "repositories", name, c.Repositories)
 }
 
 func (c *Config) HasRemote(name string) bool {
@@ -82,7 +147,37 @@ func (c *Config) HasRemote(name string) bool {
 	return ok
 }
 
-func (c *Config) GetRemote(name string) (map[string]string, bool) {
-	kv, ok := c.Remotes[name]
-	return kv, ok
+// GetRemote returns the options of a remote, resolved to their clear
+// text.
+func (c *Config) GetRemote(name string) (map[string]string, error) {
+	return resolveEntry(c, "remotes", name, c.Remotes)
+}
+
+func (c *Config) HasSchedule(name string) bool {
+	_, ok := c.Schedules[name]
+	return ok
+}
+
+func (c *Config) GetSchedule(name string) (ScheduleConfig, bool) {
+	sc, ok := c.Schedules[name]
+	return sc, ok
+}
+
+// ParseSchedules reads the schedules of a document laid out like the
+// configuration file, such as the profiles distributed by a server to its
+// clients.  Anything but schedules is refused.
+func ParseSchedules(data []byte) (map[string]ScheduleConfig, error) {
+	var document struct {
+		Schedules map[string]ScheduleConfig `yaml:"schedules"`
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&document); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if document.Schedules == nil {
+		document.Schedules = make(map[string]ScheduleConfig)
+	}
+	return document.Schedules, nil
 }
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolate replaces the ${NAME} references of value with the content
+// of the environment variable NAME, or with default for ${NAME:-default}
+// when NAME is unset or empty.  $${ stands for a literal ${.
+func interpolate(value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(value, "${")
+		if i < 0 {
+			sb.WriteString(value)
+			return sb.String(), nil
+		}
+		if i > 0 && value[i-1] == '$' {
+			sb.WriteString(value[:i-1])
+			sb.WriteString("${")
+			value = value[i+2:]
+			continue
+		}
+		sb.WriteString(value[:i])
+
+		end := strings.IndexByte(value[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", value)
+		}
+		reference := value[i+2 : i+end]
+		value = value[i+end+1:]
+
+		name, fallback, hasFallback := strings.Cut(reference, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable reference")
+		}
+		if v := os.Getenv(name); v != "" {
+			sb.WriteString(v)
+		} else if hasFallback {
+			sb.WriteString(fallback)
+		} else if v, ok := os.LookupEnv(name); ok {
+			sb.WriteString(v)
+		} else {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+	}
+}
+
+// decodeFile reads a configuration file as stored, without resolving its
+// values nor its includes.
+func decodeFile(pathname string) (*Config, error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config Config
+	if err := yaml.NewDecoder(f).Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", pathname, err)
+	}
+	config.pathname = pathname
+	if config.Repositories == nil {
+		config.Repositories = make(map[string]RepositoryConfig)
+	}
+	if config.Remotes == nil {
+		config.Remotes = make(map[string]RemoteConfig)
+	}
+	if config.Schedules == nil {
+		config.Schedules = make(map[string]ScheduleConfig)
+	}
+	return &config, nil
+}
+
+// overlay sets the entries of src on top of the ones of dst, option by
+// option for repositories and remotes.
+func overlay(dst, src *Config) {
+	if src.DefaultRepository != "" {
+		dst.DefaultRepository = src.DefaultRepository
+	}
+	for name, kv := range src.Repositories {
+		if dst.Repositories[name] == nil {
+			dst.Repositories[name] = make(RepositoryConfig)
+		}
+		for option, value := range kv {
+			dst.Repositories[name][option] = value
+		}
+	}
+	for name, kv := range src.Remotes {
+		if dst.Remotes[name] == nil {
+			dst.Remotes[name] = make(RemoteConfig)
+		}
+		for option, value := range kv {
+			dst.Remotes[name][option] = value
+		}
+	}
+	for name, schedule := range src.Schedules {
+		dst.Schedules[name] = schedule
+	}
+}
+
+// loadIncludes returns the configuration layered by the files included
+// from config, in order, each included file overriding the previous ones
+// and the files it includes itself.  Relative paths are relative to the
+// directory of the including file.
+func loadIncludes(config *Config, seen map[string]struct{}) (*Config, error) {
+	base := &Config{
+		Repositories: make(map[string]RepositoryConfig),
+		Remotes:      make(map[string]RemoteConfig),
+		Schedules:    make(map[string]ScheduleConfig),
+	}
+
+	for _, include := range config.Include {
+		pathname, err := interpolate(include)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", include, err)
+		}
+		if !filepath.IsAbs(pathname) {
+			pathname = filepath.Join(filepath.Dir(config.pathname), pathname)
+		}
+		pathname, err = filepath.Abs(pathname)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[pathname]; ok {
+			return nil, fmt.Errorf("include loop on %s", pathname)
+		}
+		seen[pathname] = struct{}{}
+
+		included, err := decodeFile(pathname)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", include, err)
+		}
+		layer, err := loadIncludes(included, seen)
+		if err != nil {
+			return nil, err
+		}
+		delete(seen, pathname)
+
+		overlay(layer, included)
+		overlay(base, layer)
+	}
+
+	return base, nil
+}
+
+// inherit completes config with the entries of base it does not define,
+// remembering them so that they are not written back to the file.
+func (c *Config) inherit(base *Config) {
+	if c.DefaultRepository == "" && base.DefaultRepository != "" {
+		c.DefaultRepository = base.DefaultRepository
+		c.inherited[inheritedKey("default-repo")] = base.DefaultRepository
+	}
+
+	for name, kv := range base.Repositories {
+		if c.Repositories[name] == nil {
+			c.Repositories[name] = make(RepositoryConfig)
+			c.inherited[inheritedKey("repositories", name)] = ""
+		}
+		for option, value := range kv {
+			if _, ok := c.Repositories[name][option]; !ok {
+				c.Repositories[name][option] = value
+				c.inherited[inheritedKey("repositories", name, option)] = value
+			}
+		}
+	}
+
+	for name, kv := range base.Remotes {
+		if c.Remotes[name] == nil {
+			c.Remotes[name] = make(RemoteConfig)
+			c.inherited[inheritedKey("remotes", name)] = ""
+		}
+		for option, value := range kv {
+			if _, ok := c.Remotes[name][option]; !ok {
+				c.Remotes[name][option] = value
+				c.inherited[inheritedKey("remotes", name, option)] = value
+			}
+		}
+	}
+
+	for name, schedule := range base.Schedules {
+		if _, ok := c.Schedules[name]; !ok {
+			c.Schedules[name] = schedule
+			c.inheritedSchedules[name] = schedule
+		}
+	}
+}
+
+func inheritedKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// stripInherited returns a copy of the entries of a section, as stored,
+// without the options inherited from an included file and left untouched,
+// nor the entries that only exist through an included file.
+func stripInherited[T ~map[string]string](c *Config, section string, entries map[string]T) map[string]T {
+	ret := make(map[string]T, len(entries))
+	for name, kv := range entries {
+		local := make(T, len(kv))
+		for option, value := range kv {
+			if inherited, ok := c.inherited[inheritedKey(section, name, option)]; ok && inherited == value {
+				continue
+			}
+			local[option] = value
+		}
+		if _, ok := c.inherited[inheritedKey(section, name)]; ok && len(local) == 0 {
+			continue
+		}
+		ret[name] = local
+	}
+	return ret
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("PLAKAR_TEST_HOST", "backup.example.org")
+	t.Setenv("PLAKAR_TEST_EMPTY", "")
+
+	for value, expected := range map[string]string{
+		"sftp://${PLAKAR_TEST_HOST}/plakar":  "sftp://backup.example.org/plakar",
+		"${PLAKAR_TEST_UNSET:-/var/backups}": "/var/backups",
+		"${PLAKAR_TEST_EMPTY:-default}":      "default",
+		"${PLAKAR_TEST_EMPTY}":               "",
+		"pa$$word $${HOME}":                  "pa$$word ${HOME}",
+		"no variable":                        "no variable",
+	} {
+		interpolated, err := interpolate(value)
+		require.NoError(t, err, value)
+		require.Equal(t, expected, interpolated, value)
+	}
+
+	_, err := interpolate("${PLAKAR_TEST_UNSET}")
+	require.ErrorContains(t, err, "PLAKAR_TEST_UNSET is not set")
+	_, err = interpolate("${PLAKAR_TEST_HOST")
+	require.ErrorContains(t, err, "unterminated")
+}
+
+func TestIncludes(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PLAKAR_TEST_SITE", "site")
+
+	site := `default-repo: nas
+repositories:
+    nas:
+        location: sftp://nas/plakar
+        passphrase: site-wide
+    offsite:
+        location: s3://bucket
+schedules:
+    nightly:
+        cron: 0 3 * * *
+        path: /home
+`
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "site"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "defaults.yml"), []byte(site), 0600))
+
+	host := `include:
+    - ${PLAKAR_TEST_SITE}/defaults.yml
+repositories:
+    nas:
+        passphrase: ${PLAKAR_TEST_PASSPHRASE:-per-host}
+`
+	configFile := filepath.Join(dir, "plakar.yml")
+	require.NoError(t, os.WriteFile(configFile, []byte(host), 0600))
+
+	cfg, err := LoadOrCreate(configFile)
+	require.NoError(t, err)
+	require.Equal(t, "nas", cfg.DefaultRepository)
+	nas, err := cfg.GetRepository("nas")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"location": "sftp://nas/plakar", "passphrase": "per-host"}, nas)
+	require.Equal(t, RepositoryConfig{"location": "s3://bucket"}, cfg.Repositories["offsite"])
+	require.True(t, cfg.HasSchedule("nightly"))
+
+	// saving leaves the layering and the variables alone
+	require.NoError(t, cfg.Save())
+	saved, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.Contains(t, string(saved), "${PLAKAR_TEST_SITE}/defaults.yml")
+	require.Contains(t, string(saved), "${PLAKAR_TEST_PASSPHRASE:-per-host}")
+	require.NotContains(t, string(saved), "sftp://nas/plakar")
+	require.NotContains(t, string(saved), "offsite")
+	require.NotContains(t, string(saved), "nightly")
+	require.NotContains(t, string(saved), "default-repo: nas")
+
+	// while overriding an inherited value stores it locally
+	cfg.Repositories["offsite"]["location"] = "s3://other-bucket"
+	require.NoError(t, cfg.Save())
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	require.Equal(t, "s3://other-bucket", cfg.Repositories["offsite"]["location"])
+	require.Equal(t, "sftp://nas/plakar", cfg.Repositories["nas"]["location"])
+
+	// as does adding excludes to an inherited schedule
+	nightly := cfg.Schedules["nightly"]
+	nightly.Excludes = []string{"*.iso"}
+	cfg.Schedules["nightly"] = nightly
+	require.NoError(t, cfg.Save())
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"*.iso"}, cfg.Schedules["nightly"].Excludes)
+
+	// include loops are detected
+	loop := strings.Replace(site, "default-repo: nas", "include: [../plakar.yml]", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "defaults.yml"), []byte(loop), 0600))
+	_, err = LoadOrCreate(configFile)
+	require.ErrorContains(t, err, "include loop")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "site", "defaults.yml")))
+	_, err = LoadOrCreate(configFile)
+	require.ErrorContains(t, err, "defaults.yml")
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const (
+	// SEALED_PREFIX marks a value encrypted with the master key.
+	SEALED_PREFIX = "enc:"
+
+	// KEYCHAIN_PREFIX marks a value looked up in the keychain of the
+	// operating system, as service/account.
+	KEYCHAIN_PREFIX = "keychain:"
+
+	// MASTER_KEY_ENV holds the master key, base64 encoded, overriding the
+	// key file stored next to the configuration file.
+	MASTER_KEY_ENV = "PLAKAR_CONFIG_KEY"
+)
+
+var (
+	ErrNoMasterKey = errors.New("no master key to decrypt the configuration")
+	ErrNotFound    = errors.New("not found")
+)
+
+// keychainLookup returns the secret stored in the keychain of the
+// operating system for an account of a service.
+var keychainLookup = func(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", cmd.Args[0], msg)
+		}
+		return "", fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// masterKeyFile returns the path of the key file used for the
+// configuration file at configFile.
+func masterKeyFile(configFile string) string {
+	return configFile + ".key"
+}
+
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid master key: expected 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// loadMasterKey returns the master key from the environment or the key
+// file, or ErrNoMasterKey if there is none.
+func loadMasterKey(configFile string) ([]byte, error) {
+	if encoded, ok := os.LookupEnv(MASTER_KEY_ENV); ok {
+		return decodeMasterKey(encoded)
+	}
+
+	data, err := os.ReadFile(masterKeyFile(configFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoMasterKey
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeMasterKey(string(data))
+}
+
+// createMasterKey returns the master key, generating the key file if
+// there is none.
+func createMasterKey(configFile string) ([]byte, error) {
+	key, err := loadMasterKey(configFile)
+	if !errors.Is(err, ErrNoMasterKey) {
+		return key, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	fp, err := os.OpenFile(masterKeyFile(configFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fp.WriteString(encoded); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return key, fp.Close()
+}
+
+func seal(key []byte, plaintext string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return SEALED_PREFIX + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func unseal(key []byte, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SEALED_PREFIX))
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("truncated value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("wrong master key or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+// resolve returns the clear text of a configuration value, once its
+// environment variables are expanded.  The master key is loaded as needed
+// rather than kept, so that resolving is safe from concurrent goroutines.
+func (c *Config) resolve(value string) (string, error) {
+	value, err := interpolate(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(value, SEALED_PREFIX):
+		key := c.masterKey
+		if key == nil {
+			if key, err = loadMasterKey(c.pathname); err != nil {
+				return "", err
+			}
+		}
+		return unseal(key, value)
+
+	case strings.HasPrefix(value, KEYCHAIN_PREFIX):
+		service, account, ok := strings.Cut(strings.TrimPrefix(value, KEYCHAIN_PREFIX), "/")
+		if !ok || service == "" || account == "" {
+			return "", fmt.Errorf("keychain reference must be service/account")
+		}
+		return keychainLookup(service, account)
+	}
+
+	return value, nil
+}
+
+// resolveEntry returns a copy of an entry of a section with its encrypted
+// values, keychain references and environment variables replaced by their
+// clear text.  Entries are only resolved when used, so that a missing key
+// or keychain only affects the repositories and remotes which need them.
+func resolveEntry[T ~map[string]string](c *Config, section, name string, entries map[string]T) (map[string]string, error) {
+	kv, ok := entries[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	ret := make(map[string]string, len(kv))
+	for option, value := range kv {
+		clear, err := c.resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s: %w", section, name, option, err)
+		}
+		ret[option] = clear
+	}
+	return ret, nil
+}
+
+// Seal sets option to value for an entry of a section, "repositories" or
+// "remotes", the value being stored encrypted with the master key, which
+// is generated if needed.
+func (c *Config) Seal(section, name, option, value string) error {
+	var entries map[string]string
+	switch section {
+	case "repositories":
+		entries = c.Repositories[name]
+	case "remotes":
+		entries = c.Remotes[name]
+	default:
+		return fmt.Errorf("unknown section %q", section)
+	}
+	if entries == nil {
+		return fmt.Errorf("%s %q does not exist", section, name)
+	}
+
+	if c.masterKey == nil {
+		key, err := createMasterKey(c.pathname)
+		if err != nil {
+			return err
+		}
+		c.masterKey = key
+	}
+
+	stored, err := seal(c.masterKey, value)
+	if err != nil {
+		return err
+	}
+
+	entries[option] = stored
+	return nil
+}
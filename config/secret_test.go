@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealedValues(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "plakar.yml")
+
+	cfg, err := LoadOrCreate(configFile)
+	require.NoError(t, err)
+	cfg.Repositories["s3"] = RepositoryConfig{"location": "s3://bucket"}
+	require.NoError(t, cfg.Seal("repositories", "s3", "secret_access_key", "s3cr3t"))
+	require.NoError(t, cfg.Save())
+
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "s3cr3t")
+	require.Contains(t, string(data), SEALED_PREFIX)
+
+	info, err := os.Stat(masterKeyFile(configFile))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	repo, err := cfg.GetRepository("s3")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", repo["secret_access_key"])
+
+	// saving again keeps the value sealed, unless it was changed
+	require.NoError(t, cfg.Save())
+	saved, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(saved))
+
+	cfg.Repositories["s3"]["secret_access_key"] = "changed"
+	require.NoError(t, cfg.Save())
+	saved, err = os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.Contains(t, string(saved), "changed")
+
+	// without the key the configuration loads, but the repository
+	// can't be used
+	require.NoError(t, os.WriteFile(configFile, data, 0600))
+	key, err := os.ReadFile(masterKeyFile(configFile))
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(masterKeyFile(configFile)))
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	_, err = cfg.GetRepository("s3")
+	require.ErrorIs(t, err, ErrNoMasterKey)
+
+	t.Setenv(MASTER_KEY_ENV, strings.TrimSpace(string(key)))
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	repo, err = cfg.GetRepository("s3")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", repo["secret_access_key"])
+
+	t.Setenv(MASTER_KEY_ENV, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	_, err = cfg.GetRepository("s3")
+	require.ErrorContains(t, err, "wrong master key")
+
+	_, err = cfg.GetRepository("unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestKeychainValues(t *testing.T) {
+	lookup := keychainLookup
+	t.Cleanup(func() { keychainLookup = lookup })
+	lookups := 0
+	keychainLookup = func(service, account string) (string, error) {
+		lookups++
+		if service == "plakar" && account == "ftp" {
+			return "hunter2", nil
+		}
+		return "", fmt.Errorf("not found")
+	}
+
+	configFile := filepath.Join(t.TempDir(), "plakar.yml")
+	stored := "remotes:\n    ftp:\n        location: ftp://host\n        password: keychain:plakar/ftp\n    local:\n        location: fs:///backups\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(stored), 0600))
+
+	// the keychain is only queried once the remote is used
+	cfg, err := LoadOrCreate(configFile)
+	require.NoError(t, err)
+	require.Zero(t, lookups)
+	remote, err := cfg.GetRemote("local")
+	require.NoError(t, err)
+	require.Equal(t, "fs:///backups", remote["location"])
+	require.Zero(t, lookups)
+
+	remote, err = cfg.GetRemote("ftp")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", remote["password"])
+	require.Equal(t, 1, lookups)
+	require.Equal(t, "keychain:plakar/ftp", cfg.Remotes["ftp"]["password"])
+
+	var rendered strings.Builder
+	require.NoError(t, cfg.Render(&rendered))
+	require.Contains(t, rendered.String(), "keychain:plakar/ftp")
+	require.NotContains(t, rendered.String(), "hunter2")
+
+	require.NoError(t, os.WriteFile(configFile, []byte(strings.Replace(stored, "plakar/ftp", "plakar/sftp", 1)), 0600))
+	cfg, err = LoadOrCreate(configFile)
+	require.NoError(t, err)
+	_, err = cfg.GetRemote("ftp")
+	require.ErrorContains(t, err, "not found")
+	_, err = cfg.GetRemote("local")
+	require.NoError(t, err)
+}
@@ -1,6 +1,7 @@
 package encryption
 
 import (
+	"bytes"
 	"crypto/rand"
 	"io"
 	"strings"
@@ -214,3 +215,40 @@ func TestCompressEncryptThenDecryptDecompressStream(t *testing.T) {
 		t.Errorf("Final data does not match original. Got: %q, want: %q", string(finalData), originalData)
 	}
 }
+
+func TestRewrapKey(t *testing.T) {
+	config := NewDefaultConfiguration()
+	config.KDFParams.KDF = "PBKDF2"
+	config.KDFParams.Argon2idParams = nil
+	config.KDFParams.Pbkdf2Params = &PBKDF2Params{SaltSize: 16, Iterations: 1000, KeyLen: 32, Hashing: "SHA256"}
+
+	key, err := DeriveKey(config.KDFParams, []byte("old passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to derive key from passphrase: %v", err)
+	}
+	config.Canary, err = DeriveCanary(config, key)
+	if err != nil {
+		t.Fatalf("Failed to derive canary: %v", err)
+	}
+
+	params, err := RewrapKey(config.KDFParams, key, []byte("new passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to rewrap key: %v", err)
+	}
+	config.KDFParams = *params
+
+	if _, err := DeriveKey(config.KDFParams, []byte("old passphrase")); err == nil {
+		t.Errorf("Expected old passphrase to be rejected")
+	}
+
+	newKey, err := DeriveKey(config.KDFParams, []byte("new passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to derive key from new passphrase: %v", err)
+	}
+	if !bytes.Equal(key, newKey) {
+		t.Errorf("Expected master key to be preserved")
+	}
+	if !VerifyCanary(config, newKey) {
+		t.Errorf("Expected canary to verify with the master key")
+	}
+}
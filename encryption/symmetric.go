@@ -37,6 +37,10 @@ type KDFParams struct {
 	Argon2idParams *Argon2idParams `msgpack:"argon2id,omitempty"`
 	ScryptParams   *ScryptParams   `msgpack:"scrypt,omitempty"`
 	Pbkdf2Params   *PBKDF2Params   `msgpack:"pbkdf2,omitempty"`
+
+	// set once the passphrase has been changed, the master key is then
+	// wrapped with the key derived from the passphrase
+	WrappedKey []byte `msgpack:"wrapped_key,omitempty"`
 }
 
 func NewDefaultKDFParams(KDF string) (*KDFParams, error) {
@@ -133,6 +137,45 @@ func Salt() (salt []byte, err error) {
 
 // DeriveKey generates a secret from a passphrase using configured KDF parameters
 func DeriveKey(params KDFParams, passphrase []byte) ([]byte, error) {
+	key, err := deriveKey(params, passphrase)
+	if err != nil || params.WrappedKey == nil {
+		return key, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aeskw.Unwrap(block, params.WrappedKey)
+}
+
+// RewrapKey returns KDF parameters with a fresh salt under which passphrase
+// derives the master key, so the passphrase can be changed without having
+// to re-encrypt the repository.
+func RewrapKey(params KDFParams, key []byte, passphrase []byte) (*KDFParams, error) {
+	salt := make([]byte, len(params.Salt))
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params.Salt = salt
+	params.WrappedKey = nil
+
+	kek, err := deriveKey(params, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	params.WrappedKey, err = aeskw.Wrap(block, key)
+	if err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+func deriveKey(params KDFParams, passphrase []byte) ([]byte, error) {
 	switch params.KDF {
 	case "ARGON2ID":
 		return argon2.IDKey(passphrase, params.Salt[:], params.Argon2idParams.Time, params.Argon2idParams.Memory, params.Argon2idParams.Threads, params.Argon2idParams.KeyLen), nil
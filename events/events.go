@@ -94,6 +94,15 @@ func Serialize(event Event) ([]byte, error) {
 	case DoneImporter:
 		serialized.Type = "DoneImporter"
 		serialized.Data, err = msgpack.Marshal(e)
+	case Delta:
+		serialized.Type = "Delta"
+		serialized.Data, err = msgpack.Marshal(e)
+	case Anomaly:
+		serialized.Type = "Anomaly"
+		serialized.Data, err = msgpack.Marshal(e)
+	case Replication:
+		serialized.Type = "Replication"
+		serialized.Data, err = msgpack.Marshal(e)
 	default:
 		return nil, fmt.Errorf("unknown event type")
 	}
@@ -265,6 +274,24 @@ func Deserialize(data []byte) (Event, error) {
 			return nil, err
 		}
 		return e, nil
+	case "Delta":
+		var e Delta
+		if err := msgpack.Unmarshal(serialized.Data, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case "Anomaly":
+		var e Anomaly
+		if err := msgpack.Unmarshal(serialized.Data, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case "Replication":
+		var e Replication
+		if err := msgpack.Unmarshal(serialized.Data, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
 	default:
 		return nil, fmt.Errorf("unknown event type")
 	}
@@ -583,3 +610,48 @@ type DoneImporter struct {
 func DoneImporterEvent() DoneImporter {
 	return DoneImporter{Timestamp: time.Now()}
 }
+
+/**/
+type Delta struct {
+	Timestamp time.Time
+
+	SnapshotID     [32]byte
+	Files          uint64
+	ChangedFiles   uint64
+	ChangedSize    uint64
+	HiEntropyFiles uint64
+}
+
+func DeltaEvent(snapshotID [32]byte) Delta {
+	return Delta{Timestamp: time.Now(), SnapshotID: snapshotID}
+}
+
+/**/
+type Anomaly struct {
+	Timestamp time.Time
+
+	SnapshotID [32]byte
+	Source     string
+	Message    string
+}
+
+func AnomalyEvent(snapshotID [32]byte, source string, message string) Anomaly {
+	return Anomaly{Timestamp: time.Now(), SnapshotID: snapshotID, Source: source, Message: message}
+}
+
+/**/
+type Replication struct {
+	Timestamp time.Time
+
+	SnapshotID [32]byte
+	Replica    string
+	Attempt    int
+	Copied     uint64
+	Total      uint64
+	Done       bool
+	Error      string
+}
+
+func ReplicationEvent(snapshotID [32]byte, replica string) Replication {
+	return Replication{Timestamp: time.Now(), SnapshotID: snapshotID, Replica: replica}
+}
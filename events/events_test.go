@@ -344,3 +344,49 @@ func TestChunkCorruptedEvent(t *testing.T) {
 		t.Errorf("ChunkCorruptedEvent MAC length is not 32")
 	}
 }
+
+func TestAnomalyEvent(t *testing.T) {
+	snapshotId := [32]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
+	anomaly := AnomalyEvent(snapshotId, "system", "Test anomaly message")
+	if anomaly.Timestamp.IsZero() {
+		t.Errorf("AnomalyEvent().Timestamp returned a zero timestamp")
+	}
+	if anomaly.Source != "system" {
+		t.Errorf("AnomalyEvent source mismatch: %s", anomaly.Source)
+	}
+
+	serialized, err := Serialize(anomaly)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	evt, err := Deserialize(serialized)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if _, ok := evt.(Anomaly); !ok {
+		t.Errorf("Deserialize returned %T, expected Anomaly", evt)
+	}
+}
+
+func TestReplicationEvent(t *testing.T) {
+	snapshotId := [32]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
+	replication := ReplicationEvent(snapshotId, "/var/backups/replica")
+	if replication.Timestamp.IsZero() {
+		t.Errorf("ReplicationEvent().Timestamp returned a zero timestamp")
+	}
+	replication.Copied, replication.Total = 1, 2
+
+	serialized, err := Serialize(replication)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	evt, err := Deserialize(serialized)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if e, ok := evt.(Replication); !ok {
+		t.Errorf("Deserialize returned %T, expected Replication", evt)
+	} else if e.Replica != "/var/backups/replica" || e.Copied != 1 || e.Total != 2 {
+		t.Errorf("Deserialize returned %+v", e)
+	}
+}
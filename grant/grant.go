@@ -0,0 +1,124 @@
+// Package grant mints and verifies restore grants: signed, time-limited
+// tokens giving whoever holds them access to a snapshot, or to a subtree of
+// it, so that restores can be delegated without handing out the repository.
+package grant
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MaxValidity bounds the lifetime of a grant.
+const MaxValidity = 30 * 24 * time.Hour
+
+const issuer = "plakar-grant"
+
+var (
+	ErrNoSecret = errors.New("restore grants require an encrypted repository")
+	ErrExpired  = errors.New("grant expired")
+	ErrInvalid  = errors.New("invalid grant")
+)
+
+// Grant is the access a token gives to a snapshot subtree.
+type Grant struct {
+	SnapshotID objects.MAC
+	Path       string
+	Expires    time.Time
+}
+
+type claims struct {
+	SnapshotID string `json:"snapshot_id"`
+	Path       string `json:"path"`
+	jwt.RegisteredClaims
+}
+
+// key derives the signing key of the grants of a repository from its
+// secret, so that they can't be forged by whoever may read it.
+func key(repo *repository.Repository) ([]byte, error) {
+	if repo.AppContext().GetSecret() == nil {
+		return nil, ErrNoSecret
+	}
+	mac := repo.ComputeMAC([]byte(issuer))
+	return mac[:], nil
+}
+
+// Mint signs a grant to the pathname subtree of a snapshot valid for ttl.
+func Mint(repo *repository.Repository, snapshotID objects.MAC, pathname string, ttl time.Duration) (string, *Grant, error) {
+	if ttl <= 0 || ttl > MaxValidity {
+		return "", nil, fmt.Errorf("grant validity must be positive and at most %s", MaxValidity)
+	}
+
+	signingKey, err := key(repo)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	g := &Grant{
+		SnapshotID: snapshotID,
+		Path:       path.Clean("/" + pathname),
+		Expires:    now.Add(ttl).Truncate(time.Second),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		SnapshotID: hex.EncodeToString(snapshotID[:]),
+		Path:       g.Path,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{repo.Configuration().RepositoryID.String()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(g.Expires),
+		},
+	})
+
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, g, nil
+}
+
+// Verify checks a token was minted for the repository and hasn't expired.
+func Verify(repo *repository.Repository, token string) (*Grant, error) {
+	signingKey, err := key(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var c claims
+	_, err = jwt.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) {
+		return signingKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(repo.Configuration().RepositoryID.String()),
+		jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpired
+	} else if err != nil {
+		return nil, ErrInvalid
+	}
+
+	snapshotID, err := hex.DecodeString(c.SnapshotID)
+	if err != nil || len(snapshotID) != len(objects.MAC{}) {
+		return nil, ErrInvalid
+	}
+	return &Grant{
+		SnapshotID: objects.MAC(snapshotID),
+		Path:       c.Path,
+		Expires:    c.ExpiresAt.Time,
+	}, nil
+}
+
+// Covers reports whether pathname lies within the subtree of the grant.
+func (g *Grant) Covers(pathname string) bool {
+	pathname = path.Clean("/" + pathname)
+	return g.Path == "/" || pathname == g.Path || strings.HasPrefix(pathname, g.Path+"/")
+}
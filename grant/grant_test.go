@@ -0,0 +1,99 @@
+package grant
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func newRepository(t *testing.T, secret []byte) *repository.Repository {
+	config := ptesting.NewConfiguration()
+	serializedConfig, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	if secret != nil {
+		hasher = hashing.GetMACHasher(hashing.DEFAULT_HASHING_ALGORITHM, secret)
+	}
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serializedConfig))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	store, err := storage.Create(map[string]string{"location": "/test/location"}, wrappedConfig)
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	cache := caching.NewManager(t.TempDir())
+	t.Cleanup(func() { cache.Close() })
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+	ctx.SetSecret(secret)
+
+	repo, err := repository.New(ctx, store, wrappedConfig)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestGrant(t *testing.T) {
+	repo := newRepository(t, bytes.Repeat([]byte{0x42}, 32))
+	snapshotID := objects.MAC{0x01, 0x02}
+
+	_, _, err := Mint(repo, snapshotID, "/home/alice", 0)
+	require.Error(t, err)
+	_, _, err = Mint(repo, snapshotID, "/home/alice", MaxValidity+time.Hour)
+	require.Error(t, err)
+
+	token, minted, err := Mint(repo, snapshotID, "home/alice/", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, "/home/alice", minted.Path)
+
+	g, err := Verify(repo, token)
+	require.NoError(t, err)
+	require.Equal(t, snapshotID, g.SnapshotID)
+	require.Equal(t, "/home/alice", g.Path)
+	require.WithinDuration(t, time.Now().Add(time.Hour), g.Expires, time.Minute)
+
+	require.True(t, g.Covers("/home/alice"))
+	require.True(t, g.Covers("/home/alice/notes.txt"))
+	require.True(t, g.Covers("/home/alice/../alice/notes.txt"))
+	require.False(t, g.Covers("/home/alicia"))
+	require.False(t, g.Covers("/home/alice/../bob"))
+	require.False(t, g.Covers("/"))
+
+	// tampered tokens and tokens of another repository are refused
+	parts := strings.Split(token, ".")
+	parts[1] = strings.Replace(parts[1], parts[1][:4], "AAAA", 1)
+	_, err = Verify(repo, strings.Join(parts, "."))
+	require.ErrorIs(t, err, ErrInvalid)
+
+	other := newRepository(t, bytes.Repeat([]byte{0x43}, 32))
+	_, err = Verify(other, token)
+	require.ErrorIs(t, err, ErrInvalid)
+
+	// as are expired ones
+	token, _, err = Mint(repo, snapshotID, "/", time.Second)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+	_, err = Verify(repo, token)
+	require.ErrorIs(t, err, ErrExpired)
+
+	// grants can't be signed without a secret
+	_, _, err = Mint(newRepository(t, nil), snapshotID, "/", time.Hour)
+	require.ErrorIs(t, err, ErrNoSecret)
+}
@@ -0,0 +1,190 @@
+// Package identity implements the enrollment of clients: a client generates
+// a keypair and submits a signed request to a server, an administrator
+// approves it and the server issues a certificate binding the client
+// identifier to its public key.  Snapshots are then signed with the
+// client keypair.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrInvalidCertificate = errors.New("certificate does not match identity")
+	ErrIssuerMismatch     = errors.New("certificate issuer does not match the expected fingerprint")
+)
+
+// Identity is the local identity of a client, kept in its configuration
+// directory.
+type Identity struct {
+	Identifier uuid.UUID
+	Name       string
+	KeyPair    *keypair.KeyPair
+	// Certificate is nil until the enrollment is approved.
+	Certificate *Certificate
+	// Issuer is the public key of the server which approved the
+	// enrollment, pinned by its fingerprint when the certificate was
+	// accepted, which profiles are then verified against.
+	Issuer []byte
+}
+
+func New(name string) (*Identity, error) {
+	kp, err := keypair.Generate()
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Identifier: uuid.New(),
+		Name:       name,
+		KeyPair:    kp,
+	}, nil
+}
+
+func identityPath(dir string) string {
+	return filepath.Join(dir, "identity")
+}
+
+// Load reads the identity stored in dir, the returned error satisfies
+// errors.Is(err, fs.ErrNotExist) if there is none.
+func Load(dir string) (*Identity, error) {
+	data, err := os.ReadFile(identityPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var id Identity
+	if err := msgpack.Unmarshal(data, &id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (id *Identity) Save(dir string) error {
+	data, err := msgpack.Marshal(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp := identityPath(dir) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, identityPath(dir))
+}
+
+// Fingerprint returns a short digest of a public key to compare keys by,
+// formatted like those of OpenSSH.
+func Fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Enrolled reports whether the identity was approved.  Identities whose
+// certificate was accepted before issuers were pinned must enroll again.
+func (id *Identity) Enrolled() bool {
+	return id.Certificate != nil && len(id.Issuer) == ed25519.PublicKeySize
+}
+
+// Request builds the enrollment request of the identity, signed with its
+// private key to prove possession.
+func (id *Identity) Request(hostname string) *Request {
+	req := &Request{
+		Identifier: id.Identifier,
+		Name:       id.Name,
+		Hostname:   hostname,
+		PublicKey:  id.KeyPair.PublicKey,
+		Timestamp:  time.Now(),
+	}
+	req.Signature = id.KeyPair.Sign(req.payload())
+	return req
+}
+
+// SetCertificate records the certificate issued for the identity, provided
+// it was issued by the key of the given fingerprint, which is pinned as the
+// issuer of the identity.
+func (id *Identity) SetCertificate(cert *Certificate, issuer string) error {
+	if cert.Identifier != id.Identifier || !ed25519.PublicKey(cert.PublicKey).Equal(id.KeyPair.PublicKey) {
+		return ErrInvalidCertificate
+	}
+	if Fingerprint(cert.Issuer) != issuer {
+		return ErrIssuerMismatch
+	}
+	if err := cert.Verify(); err != nil {
+		return err
+	}
+	id.Certificate = cert
+	id.Issuer = cert.Issuer
+	return nil
+}
+
+// Request is submitted by a client to enroll, in the fashion of a CSR.
+type Request struct {
+	Identifier uuid.UUID `json:"identifier"`
+	Name       string    `json:"name"`
+	Hostname   string    `json:"hostname"`
+	PublicKey  []byte    `json:"public_key"`
+	Timestamp  time.Time `json:"timestamp"`
+	Signature  []byte    `json:"signature"`
+}
+
+func (req *Request) payload() []byte {
+	unsigned := *req
+	unsigned.Signature = nil
+	data, _ := json.Marshal(&unsigned)
+	return data
+}
+
+func (req *Request) Verify() error {
+	if len(req.PublicKey) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(req.PublicKey, req.payload(), req.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Certificate binds a client identifier to its public key, signed by the
+// server which approved the enrollment.
+type Certificate struct {
+	Identifier uuid.UUID `json:"identifier"`
+	Name       string    `json:"name"`
+	PublicKey  []byte    `json:"public_key"`
+	Issuer     []byte    `json:"issuer"`
+	Issued     time.Time `json:"issued"`
+	Signature  []byte    `json:"signature"`
+}
+
+func (cert *Certificate) payload() []byte {
+	unsigned := *cert
+	unsigned.Signature = nil
+	data, _ := json.Marshal(&unsigned)
+	return data
+}
+
+// Verify checks the certificate against the public key of its issuer.
+func (cert *Certificate) Verify() error {
+	if len(cert.Issuer) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(cert.Issuer, cert.payload(), cert.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
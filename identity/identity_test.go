@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentitySaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Load(dir)
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	id, err := New("laptop")
+	require.NoError(t, err)
+	require.False(t, id.Enrolled())
+	require.NoError(t, id.Save(dir))
+
+	loaded, err := Load(dir)
+	require.NoError(t, err)
+	require.Equal(t, id.Identifier, loaded.Identifier)
+	require.Equal(t, id.Name, loaded.Name)
+	require.Equal(t, id.KeyPair.PrivateKey, loaded.KeyPair.PrivateKey)
+}
+
+func TestRequestVerify(t *testing.T) {
+	id, err := New("laptop")
+	require.NoError(t, err)
+
+	req := id.Request("host.example.com")
+	require.NoError(t, req.Verify())
+
+	req.Name = "impostor"
+	require.ErrorIs(t, req.Verify(), ErrInvalidSignature)
+}
+
+func TestEnrollment(t *testing.T) {
+	registry, err := OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+
+	id, err := New("laptop")
+	require.NoError(t, err)
+
+	client, err := registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, client.Status)
+	require.Nil(t, client.Certificate)
+
+	// polling returns the pending request
+	client, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, client.Status)
+
+	// another key can't take over the identifier
+	other, err := New("laptop")
+	require.NoError(t, err)
+	other.Identifier = id.Identifier
+	_, err = registry.Submit(other.Request("host"))
+	require.ErrorIs(t, err, ErrIdentifierInUse)
+
+	found, err := registry.Lookup(id.Identifier.String()[:8])
+	require.NoError(t, err)
+	require.Equal(t, id.Identifier, found.Request.Identifier)
+
+	_, err = registry.Approve(id.Identifier)
+	require.NoError(t, err)
+
+	client, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, client.Status)
+	require.NotNil(t, client.Certificate)
+	require.Equal(t, []byte(registry.Issuer()), client.Certificate.Issuer)
+
+	issuer := Fingerprint(registry.Issuer())
+	require.ErrorIs(t, other.SetCertificate(client.Certificate, issuer), ErrInvalidCertificate)
+
+	// a certificate from another issuer is refused, even if valid
+	impostor, err := OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+	require.ErrorIs(t, id.SetCertificate(client.Certificate, Fingerprint(impostor.Issuer())), ErrIssuerMismatch)
+	require.False(t, id.Enrolled())
+
+	require.NoError(t, id.SetCertificate(client.Certificate, issuer))
+	require.True(t, id.Enrolled())
+	require.Equal(t, client.Certificate.Issuer, id.Issuer)
+
+	client.Certificate.Name = "tampered"
+	require.ErrorIs(t, client.Certificate.Verify(), ErrInvalidSignature)
+
+	client, err = registry.Reject(id.Identifier)
+	require.NoError(t, err)
+	require.Equal(t, StatusRejected, client.Status)
+	require.Nil(t, client.Certificate)
+
+	clients, err := registry.List()
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+
+	// the issuer key persists across openings
+	reopened, err := OpenRegistry(registry.dir)
+	require.NoError(t, err)
+	require.Equal(t, registry.Issuer(), reopened.Issuer())
+}
+
+func TestEnrollmentPendingLimit(t *testing.T) {
+	registry, err := OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+
+	ids := make([]*Identity, MaxPending)
+	for i := range ids {
+		ids[i], err = New("laptop")
+		require.NoError(t, err)
+		_, err = registry.Submit(ids[i].Request("host"))
+		require.NoError(t, err)
+	}
+
+	id, err := New("laptop")
+	require.NoError(t, err)
+	_, err = registry.Submit(id.Request("host"))
+	require.ErrorIs(t, err, ErrTooManyPending)
+
+	// known clients can still poll
+	_, err = registry.Submit(ids[0].Request("host"))
+	require.NoError(t, err)
+
+	_, err = registry.Reject(ids[0].Identifier)
+	require.NoError(t, err)
+	_, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+}
+
+func TestReadClient(t *testing.T) {
+	dir := t.TempDir()
+
+	id, err := New("laptop")
+	require.NoError(t, err)
+
+	// reading does not create the registry
+	_, err = ReadClient(dir, id.Identifier)
+	require.ErrorIs(t, err, ErrClientNotFound)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	registry, err := OpenRegistry(dir)
+	require.NoError(t, err)
+	_, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+
+	client, err := ReadClient(dir, id.Identifier)
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, client.Status)
+	require.Equal(t, Fingerprint(id.KeyPair.PublicKey), Fingerprint(client.Request.PublicKey))
+	require.True(t, strings.HasPrefix(Fingerprint(client.Request.PublicKey), "SHA256:"))
+}
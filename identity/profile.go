@@ -0,0 +1,201 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProfileRequestValidity bounds the clock skew tolerated between a client
+// requesting its profile and the server.
+const ProfileRequestValidity = 5 * time.Minute
+
+var (
+	ErrNoProfile    = errors.New("no profile for client")
+	ErrNotApproved  = errors.New("client is not approved")
+	ErrStaleRequest = errors.New("request timestamp out of range")
+)
+
+// Profile is a configuration document distributed by a server to its
+// enrolled clients, signed with the key certificates are issued with.  The
+// profile of Identifier uuid.Nil applies to the clients without one of
+// their own.  Serial grows with each update, across all the profiles of
+// the server, so that clients can refuse to go back to an older one.
+type Profile struct {
+	Identifier uuid.UUID `json:"identifier"`
+	Serial     uint64    `json:"serial"`
+	Issued     time.Time `json:"issued"`
+	Document   []byte    `json:"document"`
+	Issuer     []byte    `json:"issuer"`
+	Signature  []byte    `json:"signature"`
+}
+
+func (p *Profile) payload() []byte {
+	unsigned := *p
+	unsigned.Signature = nil
+	data, _ := json.Marshal(&unsigned)
+	return data
+}
+
+// Verify checks the profile was signed by issuer for the client identified
+// by identifier.
+func (p *Profile) Verify(issuer ed25519.PublicKey, identifier uuid.UUID) error {
+	if !issuer.Equal(ed25519.PublicKey(p.Issuer)) {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(issuer, p.payload(), p.Signature) {
+		return ErrInvalidSignature
+	}
+	if p.Identifier != uuid.Nil && p.Identifier != identifier {
+		return fmt.Errorf("profile is for client %s", p.Identifier)
+	}
+	return nil
+}
+
+// ProfileRequest is sent by a client to fetch its profile, signed with
+// its private key to authenticate.
+type ProfileRequest struct {
+	Identifier uuid.UUID `json:"identifier"`
+	Timestamp  time.Time `json:"timestamp"`
+	Signature  []byte    `json:"signature"`
+}
+
+func (req *ProfileRequest) payload() []byte {
+	unsigned := *req
+	unsigned.Signature = nil
+	data, _ := json.Marshal(&unsigned)
+	return data
+}
+
+// ProfileRequest builds the request for the profile of the identity.
+func (id *Identity) ProfileRequest() *ProfileRequest {
+	req := &ProfileRequest{
+		Identifier: id.Identifier,
+		Timestamp:  time.Now(),
+	}
+	req.Signature = id.KeyPair.Sign(req.payload())
+	return req
+}
+
+func (r *Registry) profilePath(identifier uuid.UUID) string {
+	if identifier == uuid.Nil {
+		return filepath.Join(r.dir, "default.profile")
+	}
+	return filepath.Join(r.dir, identifier.String()+".profile")
+}
+
+func (r *Registry) loadProfile(identifier uuid.UUID) (*Profile, error) {
+	data, err := os.ReadFile(r.profilePath(identifier))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoProfile
+	} else if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// lastSerial returns the highest serial of the profiles of the registry.
+func (r *Registry) lastSerial() (uint64, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var serial uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".profile")
+		if !ok {
+			continue
+		}
+		identifier := uuid.Nil
+		if name != "default" {
+			if identifier, err = uuid.Parse(name); err != nil {
+				continue
+			}
+		}
+		profile, err := r.loadProfile(identifier)
+		if err != nil {
+			return 0, err
+		}
+		serial = max(serial, profile.Serial)
+	}
+	return serial, nil
+}
+
+// SetProfile signs and records document as the profile of a client, or
+// of all clients if identifier is uuid.Nil.
+func (r *Registry) SetProfile(identifier uuid.UUID, document []byte) (*Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if identifier != uuid.Nil {
+		if _, err := r.load(identifier); err != nil {
+			return nil, err
+		}
+	}
+
+	serial, err := r.lastSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{
+		Identifier: identifier,
+		Serial:     serial + 1,
+		Issued:     time.Now(),
+		Document:   document,
+		Issuer:     r.issuer.PublicKey,
+	}
+	profile.Signature = r.issuer.Sign(profile.payload())
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := r.profilePath(identifier)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+	return profile, os.Rename(tmp, path)
+}
+
+// Profile authenticates the request of a client and returns its profile,
+// or the default one if it has none.
+func (r *Registry) Profile(req *ProfileRequest) (*Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, err := r.load(req.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(client.Request.PublicKey, req.payload(), req.Signature) {
+		return nil, ErrInvalidSignature
+	}
+	if client.Status != StatusApproved {
+		return nil, ErrNotApproved
+	}
+	if skew := time.Since(req.Timestamp); skew > ProfileRequestValidity || skew < -ProfileRequestValidity {
+		return nil, ErrStaleRequest
+	}
+
+	profile, err := r.loadProfile(req.Identifier)
+	if errors.Is(err, ErrNoProfile) {
+		profile, err = r.loadProfile(uuid.Nil)
+	}
+	return profile, err
+}
@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	registry, err := OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+
+	id, err := New("laptop")
+	require.NoError(t, err)
+	_, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+
+	// only approved clients get a profile
+	_, err = registry.Profile(id.ProfileRequest())
+	require.ErrorIs(t, err, ErrNotApproved)
+	_, err = registry.Approve(id.Identifier)
+	require.NoError(t, err)
+	_, err = registry.Profile(id.ProfileRequest())
+	require.ErrorIs(t, err, ErrNoProfile)
+
+	_, err = registry.SetProfile(uuid.New(), []byte("schedules: {}\n"))
+	require.ErrorIs(t, err, ErrClientNotFound)
+
+	// clients without a profile of their own get the default one
+	defaults, err := registry.SetProfile(uuid.Nil, []byte("default"))
+	require.NoError(t, err)
+	profile, err := registry.Profile(id.ProfileRequest())
+	require.NoError(t, err)
+	require.Equal(t, []byte("default"), profile.Document)
+	require.NoError(t, profile.Verify(registry.Issuer(), id.Identifier))
+
+	own, err := registry.SetProfile(id.Identifier, []byte("own"))
+	require.NoError(t, err)
+	require.Greater(t, own.Serial, defaults.Serial)
+	profile, err = registry.Profile(id.ProfileRequest())
+	require.NoError(t, err)
+	require.Equal(t, []byte("own"), profile.Document)
+	require.NoError(t, profile.Verify(registry.Issuer(), id.Identifier))
+
+	// a profile is bound to its client and issuer
+	require.Error(t, profile.Verify(registry.Issuer(), uuid.New()))
+	other, err := OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+	require.ErrorIs(t, profile.Verify(other.Issuer(), id.Identifier), ErrInvalidSignature)
+	profile.Document = []byte("tampered")
+	require.ErrorIs(t, profile.Verify(registry.Issuer(), id.Identifier), ErrInvalidSignature)
+
+	// requests are authenticated and fresh
+	impostor, err := New("laptop")
+	require.NoError(t, err)
+	impostor.Identifier = id.Identifier
+	_, err = registry.Profile(impostor.ProfileRequest())
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	req := id.ProfileRequest()
+	req.Timestamp = req.Timestamp.Add(-time.Hour)
+	req.Signature = id.KeyPair.Sign(req.payload())
+	_, err = registry.Profile(req)
+	require.ErrorIs(t, err, ErrStaleRequest)
+}
@@ -0,0 +1,285 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrClientNotFound  = errors.New("client not found")
+	ErrIdentifierInUse = errors.New("identifier already enrolled with another key")
+	ErrTooManyPending  = errors.New("too many enrollment requests pending approval")
+)
+
+// MaxPending is the number of requests left pending approval past which
+// the registry refuses new ones, as anyone reaching the server can submit.
+const MaxPending = 64
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+)
+
+// Client is an enrollment request as tracked by the server.
+type Client struct {
+	Request     Request      `json:"request"`
+	Status      Status       `json:"status"`
+	Submitted   time.Time    `json:"submitted"`
+	Certificate *Certificate `json:"certificate,omitempty"`
+}
+
+// Registry keeps the enrollment requests received by a server, one file
+// per client, along with the keypair certificates are issued with.
+type Registry struct {
+	dir    string
+	issuer *keypair.KeyPair
+	mu     sync.Mutex
+}
+
+func OpenRegistry(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	issuerPath := filepath.Join(dir, "issuer")
+	var issuer *keypair.KeyPair
+	data, err := os.ReadFile(issuerPath)
+	if err == nil {
+		issuer, err = keypair.FromBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not load issuer key: %w", err)
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		if issuer, err = keypair.Generate(); err != nil {
+			return nil, err
+		}
+		if data, err = issuer.ToBytes(); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(issuerPath, data, 0600); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	return &Registry{dir: dir, issuer: issuer}, nil
+}
+
+// Issuer returns the public key certificates can be verified with.
+func (r *Registry) Issuer() ed25519.PublicKey {
+	return r.issuer.PublicKey
+}
+
+func (r *Registry) clientPath(identifier uuid.UUID) string {
+	return filepath.Join(r.dir, identifier.String()+".json")
+}
+
+func (r *Registry) load(identifier uuid.UUID) (*Client, error) {
+	data, err := os.ReadFile(r.clientPath(identifier))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrClientNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var client Client
+	if err := json.Unmarshal(data, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *Registry) store(client *Client) error {
+	data, err := json.MarshalIndent(client, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := r.clientPath(client.Request.Identifier)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Submit records an enrollment request.  Submitting again the request of
+// a known client returns its current state, which lets clients poll for
+// the approval.
+func (r *Registry) Submit(req *Request) (*Client, error) {
+	if err := req.Verify(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, err := r.load(req.Identifier)
+	if err == nil {
+		if !ed25519.PublicKey(client.Request.PublicKey).Equal(ed25519.PublicKey(req.PublicKey)) {
+			return nil, ErrIdentifierInUse
+		}
+		return client, nil
+	} else if err != ErrClientNotFound {
+		return nil, err
+	}
+
+	clients, err := r.list()
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, client := range clients {
+		if client.Status == StatusPending {
+			pending++
+		}
+	}
+	if pending >= MaxPending {
+		return nil, ErrTooManyPending
+	}
+
+	client = &Client{
+		Request:   *req,
+		Status:    StatusPending,
+		Submitted: time.Now(),
+	}
+	if err := r.store(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// ReadClient returns a client as recorded in the registry stored in dir,
+// without opening it, so that hosts which never served enrollments can
+// look clients up.
+func ReadClient(dir string, identifier uuid.UUID) (*Client, error) {
+	r := &Registry{dir: dir}
+	return r.load(identifier)
+}
+
+func (r *Registry) Get(identifier uuid.UUID) (*Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.load(identifier)
+}
+
+// Lookup resolves a client from a prefix of its identifier.
+func (r *Registry) Lookup(prefix string) (*Client, error) {
+	clients, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Client
+	for _, client := range clients {
+		if strings.HasPrefix(client.Request.Identifier.String(), prefix) {
+			if found != nil {
+				return nil, fmt.Errorf("ambiguous client identifier prefix: %s", prefix)
+			}
+			found = client
+		}
+	}
+	if found == nil {
+		return nil, ErrClientNotFound
+	}
+	return found, nil
+}
+
+// List returns the known clients, oldest request first.
+func (r *Registry) List() ([]*Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.list()
+}
+
+func (r *Registry) list() ([]*Client, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := []*Client{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		identifier, err := uuid.Parse(name)
+		if err != nil {
+			continue
+		}
+		client, err := r.load(identifier)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Submitted.Before(clients[j].Submitted)
+	})
+	return clients, nil
+}
+
+// Approve issues the certificate of a client.
+func (r *Registry) Approve(identifier uuid.UUID) (*Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, err := r.load(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &Certificate{
+		Identifier: client.Request.Identifier,
+		Name:       client.Request.Name,
+		PublicKey:  client.Request.PublicKey,
+		Issuer:     r.issuer.PublicKey,
+		Issued:     time.Now(),
+	}
+	cert.Signature = r.issuer.Sign(cert.payload())
+
+	client.Status = StatusApproved
+	client.Certificate = cert
+	if err := r.store(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Reject denies the enrollment of a client, revoking its certificate if it
+// was approved.
+func (r *Registry) Reject(identifier uuid.UUID) (*Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, err := r.load(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Status = StatusRejected
+	client.Certificate = nil
+	if err := r.store(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
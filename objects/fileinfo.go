@@ -25,6 +25,9 @@ type FileInfo struct {
 	Lusername  string      `json:"username" msgpack:"username"`   // local addition
 	Lgroupname string      `json:"groupname" msgpack:"groupname"` // local addition
 
+	// Not available on all platforms, zero if unknown.
+	LchangeTime time.Time `json:"change_time" msgpack:"change_time,omitempty"`
+
 	// Just in case we need something special to handle special
 	// OSes.
 	Flags uint32 `json:"flags" msgpack:"flags"`
@@ -53,6 +56,10 @@ func (f FileInfo) ModTime() time.Time {
 	return f.LmodTime
 }
 
+func (f FileInfo) ChangeTime() time.Time {
+	return f.LchangeTime
+}
+
 func (f FileInfo) Dev() uint64 {
 	return f.Ldev
 }
@@ -119,6 +126,12 @@ func (fileinfo *FileInfo) Equal(fi *FileInfo) bool {
 		fileinfo.Lnlink == fi.Lnlink
 }
 
+// EqualStrict also compares the change time, which catches in-place edits
+// that preserve the size and restore the modification time.
+func (fileinfo *FileInfo) EqualStrict(fi *FileInfo) bool {
+	return fileinfo.Equal(fi) && fileinfo.LchangeTime.Equal(fi.LchangeTime)
+}
+
 func (fileinfo *FileInfo) Type() string {
 	switch mode := fileinfo.Mode(); {
 	case mode.IsRegular():
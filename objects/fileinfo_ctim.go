@@ -0,0 +1,12 @@
+//go:build linux || openbsd || dragonfly || solaris
+
+package objects
+
+import (
+	"syscall"
+	"time"
+)
+
+func changeTime(st *syscall.Stat_t) time.Time {
+	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+}
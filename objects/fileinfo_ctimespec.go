@@ -0,0 +1,12 @@
+//go:build darwin || freebsd || netbsd
+
+package objects
+
+import (
+	"syscall"
+	"time"
+)
+
+func changeTime(st *syscall.Stat_t) time.Time {
+	return time.Unix(int64(st.Ctimespec.Sec), int64(st.Ctimespec.Nsec))
+}
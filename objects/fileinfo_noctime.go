@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !openbsd && !dragonfly && !solaris && !darwin && !freebsd && !netbsd
+
+package objects
+
+import (
+	"syscall"
+	"time"
+)
+
+func changeTime(st *syscall.Stat_t) time.Time {
+	return time.Time{}
+}
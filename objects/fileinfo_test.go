@@ -230,3 +230,23 @@ func TestFileInfoFromStat(t *testing.T) {
 		t.Errorf("expected Groupname %v, got %v", groupname, fileInfo.Lgroupname)
 	}
 }
+
+func TestFileInfoEqualStrict(t *testing.T) {
+	modTime := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	a := NewFileInfo("file", 100, 0644, modTime, 1, 2, 1000, 1000, 1)
+	a.LchangeTime = modTime
+	b := a
+
+	if !a.EqualStrict(&b) {
+		t.Errorf("expected identical file infos to be equal")
+	}
+
+	// content rewritten in place, modification time restored
+	b.LchangeTime = modTime.Add(time.Hour)
+	if !a.Equal(&b) {
+		t.Errorf("expected Equal to ignore the change time")
+	}
+	if a.EqualStrict(&b) {
+		t.Errorf("expected EqualStrict to detect the change time")
+	}
+}
@@ -6,6 +6,7 @@ package objects
 import (
 	"io/fs"
 	"syscall"
+	"time"
 )
 
 func FileInfoFromStat(stat fs.FileInfo) FileInfo {
@@ -14,6 +15,7 @@ func FileInfoFromStat(stat fs.FileInfo) FileInfo {
 	Luid := uint64(0)
 	Lgid := uint64(0)
 	Lnlink := uint16(0)
+	LchangeTime := time.Time{}
 
 	if _, ok := stat.Sys().(*syscall.Stat_t); ok {
 		Ldev = uint64(stat.Sys().(*syscall.Stat_t).Dev)
@@ -21,6 +23,7 @@ func FileInfoFromStat(stat fs.FileInfo) FileInfo {
 		Luid = uint64(stat.Sys().(*syscall.Stat_t).Uid)
 		Lgid = uint64(stat.Sys().(*syscall.Stat_t).Gid)
 		Lnlink = uint16(stat.Sys().(*syscall.Stat_t).Nlink)
+		LchangeTime = changeTime(stat.Sys().(*syscall.Stat_t))
 	}
 
 	return FileInfo{
@@ -33,6 +36,8 @@ func FileInfoFromStat(stat fs.FileInfo) FileInfo {
 		Luid:     Luid,
 		Lgid:     Lgid,
 		Lnlink:   Lnlink,
+
+		LchangeTime: LchangeTime,
 	}
 }
 
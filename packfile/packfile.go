@@ -2,10 +2,13 @@ package packfile
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"slices"
 	"time"
 
 	"github.com/PlakarKorp/plakar/objects"
@@ -13,12 +16,59 @@ import (
 	"github.com/PlakarKorp/plakar/versioning"
 )
 
-const VERSION = "1.0.0"
+const VERSION = "1.1.0"
 
 func init() {
 	versioning.Register(resources.RT_PACKFILE, versioning.FromString(VERSION))
 }
 
+// Feature bits recorded in the footer flags since version 1.1.0, packfiles
+// of earlier versions have no flags set.  Readers refuse packfiles using a
+// feature they do not know about, so the format can evolve without older
+// clients misreading newer packfiles.
+const (
+	FEATURE_COMPRESSION_MASK uint32 = 0x0f
+	FEATURE_COMPRESSION_LZ4  uint32 = 0x01
+	FEATURE_COMPRESSION_GZIP uint32 = 0x02
+
+	// the index is sorted by type and MAC, allowing binary searches
+	FEATURE_SORTED_INDEX uint32 = 1 << 4
+
+	FEATURES_KNOWN = FEATURE_COMPRESSION_MASK | FEATURE_SORTED_INDEX
+)
+
+var (
+	ErrUnsupportedVersion  = errors.New("unsupported packfile version")
+	ErrUnsupportedFeatures = errors.New("unsupported packfile features")
+)
+
+// CompressionFeature returns the feature bits describing the compression
+// algorithm used for the blobs of a packfile.
+func CompressionFeature(algorithm string) uint32 {
+	switch algorithm {
+	case "LZ4":
+		return FEATURE_COMPRESSION_LZ4
+	case "GZIP":
+		return FEATURE_COMPRESSION_GZIP
+	default:
+		return 0
+	}
+}
+
+func checkFooter(footer PackFileFooter) error {
+	if footer.Version.Major() > versioning.FromString(VERSION).Major() {
+		return fmt.Errorf("%w: %s", ErrUnsupportedVersion, footer.Version)
+	}
+	if unknown := footer.Flags &^ FEATURES_KNOWN; unknown != 0 {
+		return fmt.Errorf("%w: %#x", ErrUnsupportedFeatures, unknown)
+	}
+	return nil
+}
+
+func (footer PackFileFooter) HasFeature(feature uint32) bool {
+	return footer.Flags&feature == feature
+}
+
 type Blob struct {
 	Type    resources.Type
 	Version versioning.Version
@@ -80,7 +130,7 @@ func NewFooterFromBytes(version versioning.Version, serialized []byte) (PackFile
 	if err := binary.Read(reader, binary.LittleEndian, &footer.Flags); err != nil {
 		return footer, err
 	}
-	return footer, nil
+	return footer, checkFooter(footer)
 }
 
 func NewIndexFromBytes(version versioning.Version, serialized []byte) ([]Blob, error) {
@@ -163,6 +213,10 @@ func NewFromBytes(hasher hash.Hash, version versioning.Version, serialized []byt
 		return nil, err
 	}
 
+	if err := checkFooter(footer); err != nil {
+		return nil, err
+	}
+
 	_, err = reader.Seek(0, io.SeekStart)
 	if err != nil {
 		return nil, err
@@ -444,6 +498,47 @@ func (p *PackFile) AddBlob(resourceType resources.Type, version versioning.Versi
 	p.Footer.IndexOffset = uint64(len(p.Blobs))
 }
 
+// SetFeatures records the features of the packfile, sorting its index if
+// required.  It must be called once all blobs were added.
+func (p *PackFile) SetFeatures(features uint32) {
+	if features&FEATURE_SORTED_INDEX != 0 {
+		slices.SortFunc(p.Index, compareBlobs)
+	}
+	p.Footer.Flags = features
+}
+
+func compareBlobs(a, b Blob) int {
+	if a.Type != b.Type {
+		return cmp.Compare(a.Type, b.Type)
+	}
+	return bytes.Compare(a.MAC[:], b.MAC[:])
+}
+
+// LookupBlob returns the index record of a blob, using a binary search when
+// the index is sorted.
+func (p *PackFile) LookupBlob(Type resources.Type, mac objects.MAC) (Blob, bool) {
+	return LookupIndex(p.Footer, p.Index, Type, mac)
+}
+
+// LookupIndex returns the record of a blob in the index of a packfile read
+// on its own, using a binary search when the footer says it is sorted.
+func LookupIndex(footer PackFileFooter, index []Blob, Type resources.Type, mac objects.MAC) (Blob, bool) {
+	if footer.HasFeature(FEATURE_SORTED_INDEX) {
+		idx, found := slices.BinarySearchFunc(index, Blob{Type: Type, MAC: mac}, compareBlobs)
+		if !found {
+			return Blob{}, false
+		}
+		return index[idx], true
+	}
+
+	for _, blob := range index {
+		if blob.Type == Type && blob.MAC == mac {
+			return blob, true
+		}
+	}
+	return Blob{}, false
+}
+
 func (p *PackFile) GetBlob(mac objects.MAC) ([]byte, bool) {
 	for _, blob := range p.Index {
 		if blob.MAC == mac {
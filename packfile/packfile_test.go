@@ -202,3 +202,58 @@ func TestDefaultConfiguration(t *testing.T) {
 	require.Equal(t, c.AvgSize, uint64(0))
 	require.Equal(t, c.MaxSize, uint64(20971520))
 }
+
+func TestPackFileFeatures(t *testing.T) {
+	hasher := hmac.New(sha256.New, []byte("testkey"))
+	p := New(hasher)
+
+	chunk1 := []byte("This is chunk number 1")
+	chunk2 := []byte("This is chunk number 2")
+	mac1 := objects.MAC{1}
+	mac2 := objects.MAC{2}
+
+	// added out of order, the index gets sorted
+	p.AddBlob(resources.RT_CHUNK, versioning.GetCurrentVersion(resources.RT_CHUNK), mac2, chunk2, 0)
+	p.AddBlob(resources.RT_CHUNK, versioning.GetCurrentVersion(resources.RT_CHUNK), mac1, chunk1, 0)
+	p.AddBlob(resources.RT_OBJECT, versioning.GetCurrentVersion(resources.RT_OBJECT), mac1, chunk1, 0)
+	p.SetFeatures(FEATURE_SORTED_INDEX | CompressionFeature("LZ4"))
+
+	require.Equal(t, resources.RT_OBJECT, p.Index[0].Type)
+	require.Equal(t, mac1, p.Index[1].MAC)
+	require.Equal(t, mac2, p.Index[2].MAC)
+
+	serialized, err := p.Serialize()
+	require.NoError(t, err)
+
+	p2, err := NewFromBytes(hasher, versioning.GetCurrentVersion(resources.RT_PACKFILE), serialized)
+	require.NoError(t, err)
+	require.True(t, p2.Footer.HasFeature(FEATURE_SORTED_INDEX))
+	require.Equal(t, FEATURE_COMPRESSION_LZ4, p2.Footer.Flags&FEATURE_COMPRESSION_MASK)
+
+	blob, exists := p2.LookupBlob(resources.RT_CHUNK, mac2)
+	require.True(t, exists)
+	require.Equal(t, chunk2, p2.Blobs[blob.Offset:blob.Offset+uint64(blob.Length)])
+
+	_, exists = p2.LookupBlob(resources.RT_OBJECT, mac2)
+	require.False(t, exists)
+
+	// features unknown to this version are refused
+	p.SetFeatures(1 << 31)
+	serialized, err = p.Serialize()
+	require.NoError(t, err)
+
+	_, err = NewFromBytes(hasher, versioning.GetCurrentVersion(resources.RT_PACKFILE), serialized)
+	require.ErrorIs(t, err, ErrUnsupportedFeatures)
+
+	footer, err := p.SerializeFooter()
+	require.NoError(t, err)
+	_, err = NewFooterFromBytes(versioning.NewVersion(1, 0, 0), footer)
+	require.ErrorIs(t, err, ErrUnsupportedFeatures)
+
+	// as are newer major versions
+	p.SetFeatures(0)
+	footer, err = p.SerializeFooter()
+	require.NoError(t, err)
+	_, err = NewFooterFromBytes(versioning.NewVersion(2, 0, 0), footer)
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+}
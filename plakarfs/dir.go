@@ -24,6 +24,22 @@ type Dir struct {
 	repo     *repository.Repository
 	snap     *snapshot.Snapshot
 	vfs      *vfs.Filesystem
+
+	// set on the root of the filesystem only
+	fs *FS
+
+	// set on the root directory of a snapshot only
+	snapshotID objects.MAC
+	isSnapshot bool
+}
+
+func newSnapshotDir(repo *repository.Repository, snapshotID objects.MAC, name string) *Dir {
+	return &Dir{
+		name:       name,
+		repo:       repo,
+		snapshotID: snapshotID,
+		isSnapshot: true,
+	}
 }
 
 func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
@@ -33,26 +49,21 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
 		a.Mode = os.ModeDir | 0o700
 		a.Uid = uint32(os.Geteuid())
 		a.Gid = uint32(os.Getgid())
-	} else if d.parent.name == "/" {
-		snapshotID, err := hex.DecodeString(d.name)
-		if err != nil {
-			return err
-		}
-		if len(snapshotID) != 32 {
-			return fmt.Errorf("invalid snapshot id length %d", len(snapshotID))
-		}
-		snap, err := snapshot.Load(d.repo, objects.MAC(snapshotID))
-		if err != nil {
-			return err
+	} else if d.isSnapshot {
+		if d.snap == nil {
+			snap, err := snapshot.Load(d.repo, d.snapshotID)
+			if err != nil {
+				return err
+			}
+			snapfs, err := snap.Filesystem()
+			if err != nil {
+				snap.Close()
+				return err
+			}
+			d.snap = snap
+			d.vfs = snapfs
 		}
-		snapfs, err := snap.Filesystem()
-		if err != nil {
-			return err
-		}
-
-		d.snap = snap
-		d.repo = d.parent.repo
-		d.vfs = snapfs
+		snap := d.snap
 		d.fullpath = "/"
 
 		a.Inode = rand.Uint64()
@@ -93,9 +104,20 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
 }
 
 func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
-	if d.name == "/" {
-		return &Dir{parent: d, name: name, repo: d.repo}, nil
-	} else if d.parent.name == "/" {
+	if d.fs != nil {
+		switch name {
+		case byDateDir:
+			return &timelineDir{fs: d.fs, byDate: true}, nil
+		case bySnapshotDir:
+			return &timelineDir{fs: d.fs, byDate: false}, nil
+		}
+
+		snapshotID, err := hex.DecodeString(name)
+		if err != nil || len(snapshotID) != 32 {
+			return nil, syscall.ENOENT
+		}
+		return newSnapshotDir(d.repo, objects.MAC(snapshotID), name), nil
+	} else if d.isSnapshot {
 		return &Dir{parent: d, name: name}, nil
 	} else {
 		cleanpath := filepath.Clean(d.fullpath + "/" + name)
@@ -120,7 +142,10 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		if err != nil {
 			return nil, err
 		}
-		dirDirs := make([]fuse.Dirent, 0)
+		dirDirs := []fuse.Dirent{
+			{Name: byDateDir, Type: fuse.DT_Dir},
+			{Name: bySnapshotDir, Type: fuse.DT_Dir},
+		}
 		for idx, snapshotID := range snapshotIDs {
 			dirDirs = append(dirDirs, fuse.Dirent{
 				Inode: uint64(idx),
@@ -1,21 +1,33 @@
 package plakarfs
 
 import (
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/anacrolix/fuse/fs"
 )
 
+// Locator returns the identifiers of the snapshots exposed in the
+// timeline hierarchies.
+type Locator func() ([]objects.MAC, error)
+
 type FS struct {
-	repo *repository.Repository
+	repo   *repository.Repository
+	locate Locator
 }
 
-func NewFS(repo *repository.Repository, mountpoint string) *FS {
+// NewFS returns a filesystem exposing the snapshots of repo.  If locate is
+// nil, the by-date and by-snapshot hierarchies cover all snapshots.
+func NewFS(repo *repository.Repository, mountpoint string, locate Locator) *FS {
+	if locate == nil {
+		locate = repo.GetSnapshots
+	}
 	fs := &FS{
-		repo: repo,
+		repo:   repo,
+		locate: locate,
 	}
 	return fs
 }
 
 func (f *FS) Root() (fs.Node, error) {
-	return &Dir{name: "/", repo: f.repo}, nil
+	return &Dir{name: "/", repo: f.repo, fs: f}, nil
 }
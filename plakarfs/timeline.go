@@ -0,0 +1,121 @@
+package plakarfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/anacrolix/fuse"
+	"github.com/anacrolix/fuse/fs"
+)
+
+const (
+	byDateDir     = "by-date"
+	bySnapshotDir = "by-snapshot"
+
+	dateLayout = "2006-01-02"
+)
+
+// timelineDir exposes the located snapshots either by identifier, or by
+// day, in which case each day resolves to the latest snapshot taken that
+// day.
+type timelineDir struct {
+	fs     *FS
+	byDate bool
+}
+
+type timelineEntry struct {
+	snapshotID objects.MAC
+	timestamp  time.Time
+}
+
+func (t *timelineDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0o500
+	a.Uid = uint32(os.Geteuid())
+	a.Gid = uint32(os.Getgid())
+	return nil
+}
+
+// entries returns the located snapshots, oldest first.
+func (t *timelineDir) entries() ([]timelineEntry, error) {
+	if err := t.fs.repo.RebuildState(); err != nil {
+		return nil, err
+	}
+
+	snapshotIDs, err := t.fs.locate()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]timelineEntry, 0, len(snapshotIDs))
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(t.fs.repo, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, timelineEntry{
+			snapshotID: snapshotID,
+			timestamp:  snap.Header.Timestamp,
+		})
+		snap.Close()
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].timestamp.Before(entries[j].timestamp)
+	})
+	return entries, nil
+}
+
+func (t *timelineDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := t.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	dirDirs := make([]fuse.Dirent, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name := fmt.Sprintf("%x", entry.snapshotID)
+		if t.byDate {
+			name = entry.timestamp.Local().Format(dateLayout)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		dirDirs = append(dirDirs, fuse.Dirent{
+			Name: name,
+			Type: fuse.DT_Dir,
+		})
+	}
+	return dirDirs, nil
+}
+
+func (t *timelineDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	entries, err := t.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	// entries are sorted oldest first, the last match wins
+	var found *timelineEntry
+	for i := range entries {
+		if t.byDate {
+			if entries[i].timestamp.Local().Format(dateLayout) == name {
+				found = &entries[i]
+			}
+		} else if fmt.Sprintf("%x", entries[i].snapshotID) == name {
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		return nil, syscall.ENOENT
+	}
+	return newSnapshotDir(t.fs.repo, found.snapshotID, name), nil
+}
@@ -0,0 +1,71 @@
+package plakarnfs
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// file is a read-only billy file over the content of a snapshot file.
+type file struct {
+	name string
+	fp   fs.File
+
+	// rd is shared by Read and ReadAt, the latter seeking first
+	mu sync.Mutex
+	rd io.ReadSeeker
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rd.Read(p)
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.rd.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(f.rd, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rd.Seek(offset, whence)
+}
+
+func (f *file) Close() error {
+	return f.fp.Close()
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	return 0, billy.ErrReadOnly
+}
+
+func (f *file) Truncate(size int64) error {
+	return billy.ErrReadOnly
+}
+
+func (f *file) Lock() error {
+	return nil
+}
+
+func (f *file) Unlock() error {
+	return nil
+}
@@ -0,0 +1,297 @@
+package plakarnfs
+
+import (
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+)
+
+// Locator returns the identifiers of the snapshots exposed at the root of
+// the filesystem.
+type Locator func() ([]objects.MAC, error)
+
+// FS exposes the snapshots of a repository as a read-only billy filesystem
+// for an NFS server to export: its root holds a directory per snapshot,
+// named after the snapshot identifier, holding the tree it was taken of.
+type FS struct {
+	repo   *repository.Repository
+	locate Locator
+
+	mu        sync.Mutex
+	snapshots map[objects.MAC]*snapshot.Snapshot
+	vfs       map[objects.MAC]*vfs.Filesystem
+}
+
+// NewFS returns a filesystem exposing the snapshots of repo.  If locate is
+// nil, all snapshots are exposed.
+func NewFS(repo *repository.Repository, locate Locator) *FS {
+	if locate == nil {
+		locate = repo.GetSnapshots
+	}
+	return &FS{
+		repo:      repo,
+		locate:    locate,
+		snapshots: make(map[objects.MAC]*snapshot.Snapshot),
+		vfs:       make(map[objects.MAC]*vfs.Filesystem),
+	}
+}
+
+// Close releases the snapshots loaded.
+func (f *FS) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, snap := range f.snapshots {
+		snap.Close()
+	}
+	f.snapshots = make(map[objects.MAC]*snapshot.Snapshot)
+	f.vfs = make(map[objects.MAC]*vfs.Filesystem)
+	return nil
+}
+
+// split returns the snapshot a pathname lies in, if any, and the pathname
+// within that snapshot.
+func split(filename string) (string, string) {
+	filename = path.Clean("/" + filename)
+	if filename == "/" {
+		return "", "/"
+	}
+	name, rest, _ := strings.Cut(filename[1:], "/")
+	return name, "/" + rest
+}
+
+// snapshot loads the snapshot named, which must be one of those located.
+func (f *FS) snapshot(name string) (*snapshot.Snapshot, *vfs.Filesystem, error) {
+	id, err := hex.DecodeString(name)
+	if err != nil || len(id) != len(objects.MAC{}) {
+		return nil, nil, os.ErrNotExist
+	}
+	snapshotID := objects.MAC(id)
+
+	f.mu.Lock()
+	snap, loaded := f.snapshots[snapshotID]
+	snapfs := f.vfs[snapshotID]
+	f.mu.Unlock()
+	if loaded {
+		return snap, snapfs, nil
+	}
+
+	located, err := f.locate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(located, snapshotID) {
+		return nil, nil, os.ErrNotExist
+	}
+	return f.load(snapshotID)
+}
+
+// load returns the snapshot and its filesystem, loading them once.
+func (f *FS) load(snapshotID objects.MAC) (*snapshot.Snapshot, *vfs.Filesystem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if snap, ok := f.snapshots[snapshotID]; ok {
+		return snap, f.vfs[snapshotID], nil
+	}
+
+	snap, err := snapshot.Load(f.repo, snapshotID)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapfs, err := snap.Filesystem()
+	if err != nil {
+		snap.Close()
+		return nil, nil, err
+	}
+	f.snapshots[snapshotID] = snap
+	f.vfs[snapshotID] = snapfs
+	return snap, snapfs, nil
+}
+
+// entry returns the entry for a pathname within a snapshot, named after the
+// snapshot for its root directory.
+func (f *FS) entry(filename string) (os.FileInfo, *vfs.Filesystem, string, error) {
+	name, pathname := split(filename)
+	if name == "" {
+		return &dirInfo{name: "/"}, nil, "", nil
+	}
+
+	snap, snapfs, err := f.snapshot(name)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if pathname == "/" {
+		return &dirInfo{name: name, modTime: snap.Header.Timestamp}, snapfs, pathname, nil
+	}
+
+	entry, err := snapfs.GetEntry(pathname)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return entry.FileInfo, snapfs, pathname, nil
+}
+
+func (f *FS) Open(filename string) (billy.File, error) {
+	return f.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (f *FS) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) != 0 {
+		return nil, billy.ErrReadOnly
+	}
+
+	info, snapfs, pathname, err := f.entry(filename)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() || !info.Mode().IsRegular() {
+		return nil, fs.ErrInvalid
+	}
+
+	fp, err := snapfs.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	rd, ok := fp.(io.ReadSeeker)
+	if !ok {
+		fp.Close()
+		return nil, fs.ErrInvalid
+	}
+	return &file{name: filename, fp: fp, rd: rd}, nil
+}
+
+func (f *FS) Stat(filename string) (os.FileInfo, error) {
+	// symlinks are not followed, their target may lie out of the snapshot
+	return f.Lstat(filename)
+}
+
+func (f *FS) Lstat(filename string) (os.FileInfo, error) {
+	info, _, _, err := f.entry(filename)
+	return info, err
+}
+
+func (f *FS) Readlink(link string) (string, error) {
+	name, pathname := split(link)
+	if name == "" || pathname == "/" {
+		return "", fs.ErrInvalid
+	}
+
+	_, snapfs, err := f.snapshot(name)
+	if err != nil {
+		return "", err
+	}
+	entry, err := snapfs.GetEntry(pathname)
+	if err != nil {
+		return "", err
+	}
+	if entry.Stat().Mode()&os.ModeSymlink == 0 {
+		return "", fs.ErrInvalid
+	}
+	return entry.SymlinkTarget, nil
+}
+
+func (f *FS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	name, pathname := split(dirname)
+	if name == "" {
+		located, err := f.locate()
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]os.FileInfo, 0, len(located))
+		for _, snapshotID := range located {
+			snap, _, err := f.load(snapshotID)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, &dirInfo{name: hex.EncodeToString(snapshotID[:]), modTime: snap.Header.Timestamp})
+		}
+		return infos, nil
+	}
+
+	_, snapfs, err := f.snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	children, err := snapfs.Children(pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0)
+	for entry, err := range children {
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, entry.FileInfo)
+	}
+	return infos, nil
+}
+
+func (f *FS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (f *FS) Chroot(pathname string) (billy.Filesystem, error) {
+	return chroot.New(f, pathname), nil
+}
+
+func (f *FS) Root() string {
+	return "/"
+}
+
+// Capabilities tells the NFS server to refuse all modifications.
+func (f *FS) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.SeekCapability
+}
+
+func (f *FS) Create(filename string) (billy.File, error) {
+	return nil, billy.ErrReadOnly
+}
+
+func (f *FS) Rename(oldpath, newpath string) error {
+	return billy.ErrReadOnly
+}
+
+func (f *FS) Remove(filename string) error {
+	return billy.ErrReadOnly
+}
+
+func (f *FS) TempFile(dir, prefix string) (billy.File, error) {
+	return nil, billy.ErrReadOnly
+}
+
+func (f *FS) MkdirAll(filename string, perm os.FileMode) error {
+	return billy.ErrReadOnly
+}
+
+func (f *FS) Symlink(target, link string) error {
+	return billy.ErrReadOnly
+}
+
+// dirInfo describes the directories which are not part of a snapshot: the
+// root of the filesystem and the directories named after the snapshots.
+type dirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (d *dirInfo) Name() string       { return d.name }
+func (d *dirInfo) Size() int64        { return 0 }
+func (d *dirInfo) Mode() os.FileMode  { return os.ModeDir | 0o555 }
+func (d *dirInfo) ModTime() time.Time { return d.modTime }
+func (d *dirInfo) IsDir() bool        { return true }
+func (d *dirInfo) Sys() any           { return nil }
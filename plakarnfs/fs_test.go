@@ -0,0 +1,175 @@
+package plakarnfs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/go-git/go-billy/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// generateSnapshot backs up a small tree and returns the snapshot and the
+// directory it was taken of.
+func generateSnapshot(t *testing.T) (*snapshot.Snapshot, string) {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	tmpBackupDir, err := os.MkdirTemp("", "tmp_to_backup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+		os.RemoveAll(tmpCacheDir)
+		os.RemoveAll(tmpBackupDir)
+	})
+
+	require.NoError(t, os.MkdirAll(tmpBackupDir+"/subdir", 0755))
+	require.NoError(t, os.WriteFile(tmpBackupDir+"/subdir/foo.txt", []byte("hello foo"), 0644))
+	require.NoError(t, os.WriteFile(tmpBackupDir+"/bar.txt", []byte("hello bar"), 0644))
+	require.NoError(t, os.Symlink("subdir/foo.txt", tmpBackupDir+"/link"))
+
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+	config := storage.NewConfiguration()
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	require.NoError(t, r.Create(wrappedConfig))
+
+	r, serializedConfig, err := storage.Open(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	cache := caching.NewManager(tmpCacheDir)
+	t.Cleanup(func() { cache.Close() })
+	ctx.SetCache(cache)
+	ctx.SetLogger(logging.NewLogger(io.Discard, io.Discard))
+	repo, err := repository.New(ctx, r, serializedConfig)
+	require.NoError(t, err)
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	imp, err := fs.NewFSImporter(map[string]string{"location": "fs://" + tmpBackupDir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	t.Cleanup(func() { snap.Close() })
+
+	return snap, tmpBackupDir
+}
+
+func TestFS(t *testing.T) {
+	snap, dir := generateSnapshot(t)
+	snapshotID := snap.Header.Identifier
+	name := hex.EncodeToString(snapshotID[:])
+
+	nfs := NewFS(snap.Repository(), nil)
+	defer nfs.Close()
+
+	// the root holds a directory per snapshot
+	infos, err := nfs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, name, infos[0].Name())
+	require.True(t, infos[0].IsDir())
+
+	info, err := nfs.Stat("/" + name + dir + "/subdir/foo.txt")
+	require.NoError(t, err)
+	require.Equal(t, "foo.txt", info.Name())
+	require.Equal(t, int64(len("hello foo")), info.Size())
+
+	infos, err = nfs.ReadDir("/" + name + dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	require.ElementsMatch(t, []string{"bar.txt", "link", "subdir"}, names)
+
+	fp, err := nfs.Open(nfs.Join("/", name, dir, "bar.txt"))
+	require.NoError(t, err)
+	data, err := io.ReadAll(fp)
+	require.NoError(t, err)
+	require.Equal(t, "hello bar", string(data))
+
+	buf := make([]byte, 3)
+	n, err := fp.ReadAt(buf, 6)
+	require.NoError(t, err)
+	require.Equal(t, "bar", string(buf[:n]))
+	_, err = fp.Write([]byte("x"))
+	require.ErrorIs(t, err, billy.ErrReadOnly)
+	require.NoError(t, fp.Close())
+
+	// symlinks are exposed as such, not followed
+	info, err = nfs.Stat("/" + name + dir + "/link")
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeSymlink)
+	target, err := nfs.Readlink("/" + name + dir + "/link")
+	require.NoError(t, err)
+	require.Equal(t, "subdir/foo.txt", target)
+
+	_, err = nfs.Open("/" + name + dir + "/subdir")
+	require.Error(t, err)
+}
+
+func TestFSReadOnly(t *testing.T) {
+	snap, dir := generateSnapshot(t)
+	snapshotID := snap.Header.Identifier
+	name := hex.EncodeToString(snapshotID[:])
+
+	nfs := NewFS(snap.Repository(), nil)
+	defer nfs.Close()
+
+	require.Equal(t, billy.ReadCapability|billy.SeekCapability, nfs.Capabilities())
+
+	_, err := nfs.OpenFile("/"+name+dir+"/bar.txt", os.O_RDWR, 0)
+	require.ErrorIs(t, err, billy.ErrReadOnly)
+	_, err = nfs.Create("/" + name + dir + "/new.txt")
+	require.ErrorIs(t, err, billy.ErrReadOnly)
+	require.ErrorIs(t, nfs.Remove("/"+name+dir+"/bar.txt"), billy.ErrReadOnly)
+	require.ErrorIs(t, nfs.Rename("/"+name+dir+"/bar.txt", "/"+name+dir+"/baz.txt"), billy.ErrReadOnly)
+	require.ErrorIs(t, nfs.MkdirAll("/"+name+dir+"/new", 0755), billy.ErrReadOnly)
+}
+
+func TestFSLocator(t *testing.T) {
+	snap, _ := generateSnapshot(t)
+	snapshotID := snap.Header.Identifier
+	name := hex.EncodeToString(snapshotID[:])
+
+	// only the snapshots located are exposed
+	nfs := NewFS(snap.Repository(), func() ([]objects.MAC, error) {
+		return nil, nil
+	})
+	defer nfs.Close()
+
+	infos, err := nfs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, infos, 0)
+
+	_, err = nfs.Stat("/" + name)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = nfs.Stat("/not-a-snapshot")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
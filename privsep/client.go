@@ -0,0 +1,233 @@
+package privsep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Client sends requests to a helper.  Requests may be issued concurrently,
+// responses are matched to them by identifier.
+type Client struct {
+	conn io.ReadWriteCloser
+
+	muEnc sync.Mutex
+	enc   *msgpack.Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *response
+	err     error
+}
+
+func NewClient(conn io.ReadWriteCloser) *Client {
+	c := &Client{
+		conn:    conn,
+		enc:     msgpack.NewEncoder(conn),
+		pending: make(map[uint64]chan *response),
+	}
+	go c.dispatch()
+	return c
+}
+
+func (c *Client) dispatch() {
+	decoder := msgpack.NewDecoder(c.conn)
+	for {
+		var res response
+		if err := decoder.Decode(&res); err != nil {
+			c.mu.Lock()
+			c.err = fmt.Errorf("lost connection to the privsep helper: %w", err)
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[res.ID]
+		delete(c.pending, res.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- &res
+		}
+	}
+}
+
+func (c *Client) call(req *request) (*response, error) {
+	ch := make(chan *response, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	req.ID = c.nextID
+	c.pending[req.ID] = ch
+	c.mu.Unlock()
+
+	c.muEnc.Lock()
+	err := c.enc.Encode(req)
+	c.muEnc.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	res, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+	if res.Err != "" {
+		return nil, fmt.Errorf("%s", res.Err)
+	}
+	return res, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// NewImporter creates the importer described by config in the helper and
+// returns a proxy to it.
+func (c *Client) NewImporter(config map[string]string) (importer.Importer, error) {
+	res, err := c.call(&request{Op: opImporter, Config: config})
+	if err != nil {
+		return nil, err
+	}
+	return &Importer{
+		client: c,
+		origin: res.Origin,
+		typ:    res.Type,
+		root:   res.Root,
+		volume: res.Volume,
+	}, nil
+}
+
+// Importer forwards every filesystem access to the helper.
+type Importer struct {
+	client *Client
+	origin string
+	typ    string
+	root   string
+	volume string
+}
+
+func (p *Importer) Origin() string {
+	return p.origin
+}
+
+func (p *Importer) Type() string {
+	return p.typ
+}
+
+func (p *Importer) Root() string {
+	return p.root
+}
+
+func (p *Importer) VolumeID() (string, error) {
+	return p.volume, nil
+}
+
+func (p *Importer) Scan() (<-chan *importer.ScanResult, error) {
+	if _, err := p.client.call(&request{Op: opScan}); err != nil {
+		return nil, err
+	}
+
+	results := make(chan *importer.ScanResult, scanBatchSize)
+	go func() {
+		defer close(results)
+		for {
+			res, err := p.client.call(&request{Op: opNext, Size: scanBatchSize})
+			if err != nil {
+				results <- importer.NewScanError(p.root, err)
+				return
+			}
+			for _, result := range res.Results {
+				results <- result.toScanResult()
+			}
+			if res.EOF {
+				return
+			}
+		}
+	}()
+	return results, nil
+}
+
+func (p *Importer) NewReader(pathname string) (io.ReadCloser, error) {
+	res, err := p.client.call(&request{Op: opOpen, Pathname: pathname})
+	if err != nil {
+		return nil, err
+	}
+	return &reader{client: p.client, handle: res.Handle}, nil
+}
+
+func (p *Importer) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	res, err := p.client.call(&request{Op: opXattr, Pathname: pathname, Attribute: attribute})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(res.Data)), nil
+}
+
+func (p *Importer) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	res, err := p.client.call(&request{Op: opXattrs, Pathname: pathname})
+	if err != nil {
+		return nil, err
+	}
+	return res.Xattrs, nil
+}
+
+// Close closes the connection to the helper, which exits once it is done
+// with the pending requests.
+func (p *Importer) Close() error {
+	return p.client.Close()
+}
+
+type reader struct {
+	client *Client
+	handle uint64
+	eof    bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	size := len(p)
+	if size > maxReadSize {
+		size = maxReadSize
+	}
+	res, err := r.client.call(&request{Op: opRead, Handle: r.handle, Size: size})
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, res.Data)
+	if res.EOF {
+		r.eof = true
+		if n == 0 {
+			return 0, io.EOF
+		}
+	}
+	return n, nil
+}
+
+func (r *reader) Close() error {
+	_, err := r.client.call(&request{Op: opClose, Handle: r.handle})
+	return err
+}
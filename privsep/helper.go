@@ -0,0 +1,258 @@
+package privsep
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type helper struct {
+	muEnc sync.Mutex
+	enc   *msgpack.Encoder
+
+	// configuration of the importer, decided by the privileged process
+	config map[string]string
+
+	mu         sync.Mutex
+	imp        importer.Importer
+	scan       <-chan *importer.ScanResult
+	handles    map[uint64]io.ReadCloser
+	nextHandle uint64
+}
+
+// Serve answers the requests of an unprivileged client until conn is
+// closed.  A single filesystem importer, created from config whatever the
+// client asks for, can be created per connection and no file outside of
+// its root can be accessed.
+func Serve(conn io.ReadWriter, config map[string]string) error {
+	h := &helper{
+		enc:     msgpack.NewEncoder(conn),
+		config:  config,
+		handles: make(map[uint64]io.ReadCloser),
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		h.close()
+	}()
+
+	decoder := msgpack.NewDecoder(conn)
+	for {
+		var req request
+		if err := decoder.Decode(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res := &response{}
+			if err := h.handle(&req, res); err != nil {
+				res = &response{Err: err.Error()}
+			}
+			res.ID = req.ID
+
+			h.muEnc.Lock()
+			defer h.muEnc.Unlock()
+			h.enc.Encode(res)
+		}()
+	}
+}
+
+func (h *helper) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for handle, rd := range h.handles {
+		rd.Close()
+		delete(h.handles, handle)
+	}
+	if h.imp != nil {
+		h.imp.Close()
+	}
+}
+
+func (h *helper) importer() (importer.Importer, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.imp == nil {
+		return nil, fmt.Errorf("no importer")
+	}
+	return h.imp, nil
+}
+
+func (h *helper) handle(req *request, res *response) error {
+	if req.Op == opImporter {
+		return h.newImporter(req, res)
+	}
+
+	imp, err := h.importer()
+	if err != nil {
+		return err
+	}
+
+	switch req.Op {
+	case opScan:
+		scan, err := imp.Scan()
+		if err != nil {
+			return err
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.scan != nil {
+			return fmt.Errorf("scan already started")
+		}
+		h.scan = scan
+		return nil
+
+	case opNext:
+		h.mu.Lock()
+		scan := h.scan
+		h.mu.Unlock()
+		if scan == nil {
+			return fmt.Errorf("scan not started")
+		}
+
+		size := req.Size
+		if size <= 0 || size > scanBatchSize {
+			size = scanBatchSize
+		}
+
+		// wait for the first result, then return whatever is ready
+		result, ok := <-scan
+		if !ok {
+			res.EOF = true
+			return nil
+		}
+		res.Results = append(res.Results, fromScanResult(result))
+		for len(res.Results) < size {
+			select {
+			case result, ok := <-scan:
+				if !ok {
+					res.EOF = true
+					return nil
+				}
+				res.Results = append(res.Results, fromScanResult(result))
+			default:
+				return nil
+			}
+		}
+		return nil
+
+	case opOpen:
+		// files are opened by the helper itself, so that no symbolic
+		// link leads out of the root
+		fp, err := openBeneath(imp.Root(), req.Pathname)
+		if err != nil {
+			return err
+		}
+		info, err := fp.Stat()
+		if err != nil {
+			fp.Close()
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			fp.Close()
+			return fmt.Errorf("%s: not a regular file", req.Pathname)
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.nextHandle++
+		h.handles[h.nextHandle] = fp
+		res.Handle = h.nextHandle
+		return nil
+
+	case opRead:
+		h.mu.Lock()
+		rd, ok := h.handles[req.Handle]
+		h.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("invalid handle")
+		}
+
+		size := req.Size
+		if size <= 0 || size > maxReadSize {
+			size = maxReadSize
+		}
+		buf := make([]byte, size)
+		n, err := io.ReadFull(rd, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			res.EOF = true
+		} else if err != nil {
+			return err
+		}
+		res.Data = buf[:n]
+		return nil
+
+	case opClose:
+		h.mu.Lock()
+		rd, ok := h.handles[req.Handle]
+		delete(h.handles, req.Handle)
+		h.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("invalid handle")
+		}
+		return rd.Close()
+
+	case opXattr:
+		if err := checkBeneath(imp.Root(), req.Pathname); err != nil {
+			return err
+		}
+		rd, err := imp.NewExtendedAttributeReader(req.Pathname, req.Attribute)
+		if err != nil {
+			return err
+		}
+		defer rd.Close()
+		res.Data, err = io.ReadAll(rd)
+		return err
+
+	case opXattrs:
+		if err := checkBeneath(imp.Root(), req.Pathname); err != nil {
+			return err
+		}
+		res.Xattrs, err = imp.GetExtendedAttributes(req.Pathname)
+		return err
+
+	default:
+		return fmt.Errorf("unknown request %q", req.Op)
+	}
+}
+
+func (h *helper) newImporter(req *request, res *response) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.imp != nil {
+		return fmt.Errorf("importer already created")
+	}
+
+	// the root is never taken from the unprivileged client
+	imp, err := importer.NewImporter(h.config)
+	if err != nil {
+		return err
+	}
+	if imp.Type() != "fs" {
+		imp.Close()
+		return fmt.Errorf("privilege separation is only supported for filesystem backups")
+	}
+	h.imp = imp
+
+	res.Origin = imp.Origin()
+	res.Type = imp.Type()
+	res.Root = imp.Root()
+	if vi, ok := imp.(importer.VolumeIdentifier); ok {
+		if volume, err := vi.VolumeID(); err == nil {
+			res.Volume = volume
+		}
+	}
+	return nil
+}
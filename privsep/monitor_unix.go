@@ -0,0 +1,120 @@
+//go:build !windows
+// +build !windows
+
+package privsep
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// Monitor runs plakar again as username, with the same arguments, and
+// serves its filesystem reads, from the importer described by config, while
+// it runs.  It must be called as root, and returns the exit status of the
+// unprivileged process.
+func Monitor(username string, config map[string]string) (int, error) {
+	if os.Geteuid() != 0 {
+		return 1, fmt.Errorf("privilege separation requires running as root")
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return 1, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 1, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return 1, err
+	}
+	if uid == 0 {
+		return 1, fmt.Errorf("refusing to run unprivileged process as root")
+	}
+
+	groups := []uint32{}
+	if groupIDs, err := u.GroupIds(); err == nil {
+		for _, groupID := range groupIDs {
+			if g, err := strconv.ParseUint(groupID, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return 1, err
+	}
+	syscall.CloseOnExec(fds[0])
+	parent := os.NewFile(uintptr(fds[0]), "privsep")
+	child := os.NewFile(uintptr(fds[1]), "privsep-worker")
+
+	conn, err := net.FileConn(parent)
+	parent.Close()
+	if err != nil {
+		child.Close()
+		return 1, err
+	}
+	defer conn.Close()
+
+	binary, err := os.Executable()
+	if err != nil {
+		child.Close()
+		return 1, err
+	}
+
+	cmd := exec.Command(binary, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{child}
+	cmd.Env = append(os.Environ(),
+		"HOME="+u.HomeDir,
+		"USER="+u.Username,
+		"LOGNAME="+u.Username,
+		"PLAKAR_AGENTLESS=1",
+		envFD+"=3",
+	)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    uint32(uid),
+			Gid:    uint32(gid),
+			Groups: groups,
+		},
+	}
+
+	// ^C reaches both processes, let the unprivileged one handle it
+	signal.Ignore(os.Interrupt)
+
+	if err := cmd.Start(); err != nil {
+		child.Close()
+		return 1, err
+	}
+	child.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(conn, config)
+	}()
+
+	err = cmd.Wait()
+	conn.Close()
+	<-done
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package privsep
+
+import "fmt"
+
+func Monitor(username string, config map[string]string) (int, error) {
+	return 1, fmt.Errorf("privilege separation is not supported on windows")
+}
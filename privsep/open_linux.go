@@ -0,0 +1,39 @@
+package privsep
+
+import (
+	"errors"
+	"os"
+	"path"
+
+	"golang.org/x/sys/unix"
+)
+
+// openBeneath opens pathname, which must lie below root even once its
+// symbolic links are resolved.  The last component is never followed.
+func openBeneath(root string, pathname string) (*os.File, error) {
+	if path.Clean(pathname) == root {
+		return os.Open(root)
+	}
+	rel, err := relative(root, pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	rootfd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer unix.Close(rootfd)
+
+	fd, err := unix.Openat2(rootfd, rel, &unix.OpenHow{
+		Flags:   openFlags,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if errors.Is(err, unix.ENOSYS) {
+		// kernels older than 5.6
+		return walkBeneath(root, rel)
+	} else if err != nil {
+		return nil, &os.PathError{Op: "open", Path: pathname, Err: err}
+	}
+	return os.NewFile(uintptr(fd), pathname), nil
+}
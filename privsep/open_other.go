@@ -0,0 +1,22 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package privsep
+
+import (
+	"os"
+	"path"
+)
+
+// openBeneath opens pathname, which must lie below root and not go through
+// a symbolic link.
+func openBeneath(root string, pathname string) (*os.File, error) {
+	if path.Clean(pathname) == root {
+		return os.Open(root)
+	}
+	rel, err := relative(root, pathname)
+	if err != nil {
+		return nil, err
+	}
+	return walkBeneath(root, rel)
+}
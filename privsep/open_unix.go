@@ -0,0 +1,85 @@
+//go:build !windows
+// +build !windows
+
+package privsep
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// openFlags open the last component of a path without following it, nor
+// blocking on FIFOs and devices.
+const openFlags = unix.O_RDONLY | unix.O_NOFOLLOW | unix.O_NONBLOCK | unix.O_CLOEXEC
+
+// walkBeneath opens rel below root one component at a time, refusing
+// symbolic links anywhere along the way.
+func walkBeneath(root string, rel string) (*os.File, error) {
+	dirfd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+
+	components := strings.Split(rel, "/")
+	for i, component := range components {
+		if component == ".." {
+			unix.Close(dirfd)
+			return nil, fmt.Errorf("%s: not within %s", rel, root)
+		}
+
+		flags := openFlags
+		if i != len(components)-1 {
+			flags |= unix.O_DIRECTORY
+		}
+		fd, err := unix.Openat(dirfd, component, flags, 0)
+		unix.Close(dirfd)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: path.Join(root, rel), Err: err}
+		}
+		dirfd = fd
+	}
+	return os.NewFile(uintptr(dirfd), path.Join(root, rel)), nil
+}
+
+// relative returns pathname relative to root, which it must be within.
+func relative(root string, pathname string) (string, error) {
+	cleaned := path.Clean(pathname)
+	if root == "/" {
+		if cleaned == "/" {
+			return "", fmt.Errorf("%s: is the root", pathname)
+		}
+		return strings.TrimPrefix(cleaned, "/"), nil
+	}
+	if !strings.HasPrefix(cleaned, root+"/") {
+		return "", fmt.Errorf("%s: not within %s", pathname, root)
+	}
+	return strings.TrimPrefix(cleaned, root+"/"), nil
+}
+
+// checkBeneath makes sure pathname lies below root once resolved, and is not
+// itself a symbolic link, for the requests which can't be served from a
+// file descriptor.
+func checkBeneath(root string, pathname string) error {
+	if path.Clean(pathname) == root {
+		return nil
+	}
+
+	parent, err := openBeneath(root, path.Dir(pathname))
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+
+	var st unix.Stat_t
+	if err := unix.Fstatat(int(parent.Fd()), path.Base(pathname), &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "stat", Path: pathname, Err: err}
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+		return fmt.Errorf("%s: is a symbolic link", pathname)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package privsep
+
+import (
+	"fmt"
+	"os"
+)
+
+func openBeneath(root string, pathname string) (*os.File, error) {
+	return nil, fmt.Errorf("privilege separation is not supported on windows")
+}
+
+func checkBeneath(root string, pathname string) error {
+	return fmt.Errorf("privilege separation is not supported on windows")
+}
@@ -0,0 +1,118 @@
+// Package privsep implements a privilege-separated mode for backups: a
+// small helper running as root performs the filesystem reads, while the
+// rest of plakar (chunking, encryption, network I/O) runs unprivileged and
+// talks to the helper over a socketpair.
+package privsep
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// envFD holds the file descriptor of the socket connected to the helper in
+// the unprivileged process.
+const envFD = "PLAKAR_PRIVSEP_FD"
+
+const (
+	opImporter = "importer"
+	opScan     = "scan"
+	opNext     = "next"
+	opOpen     = "open"
+	opRead     = "read"
+	opClose    = "close"
+	opXattr    = "xattr"
+	opXattrs   = "xattrs"
+)
+
+const (
+	scanBatchSize = 256
+	maxReadSize   = 1024 * 1024
+)
+
+type request struct {
+	ID        uint64
+	Op        string
+	Config    map[string]string
+	Pathname  string
+	Attribute string
+	Handle    uint64
+	Size      int
+}
+
+type scanResult struct {
+	Record   *importer.ScanRecord
+	Pathname string
+	Err      string
+}
+
+type response struct {
+	ID     uint64
+	Err    string
+	Origin string
+	Type   string
+	Root   string
+	Volume string
+
+	Results []scanResult
+	Handle  uint64
+	Data    []byte
+	EOF     bool
+	Xattrs  []importer.ExtendedAttributes
+}
+
+func fromScanResult(result *importer.ScanResult) scanResult {
+	if result.Error != nil {
+		return scanResult{Pathname: result.Error.Pathname, Err: result.Error.Err.Error()}
+	}
+	return scanResult{Record: result.Record}
+}
+
+func (r scanResult) toScanResult() *importer.ScanResult {
+	if r.Record == nil {
+		return importer.NewScanError(r.Pathname, fmt.Errorf("%s", r.Err))
+	}
+	return &importer.ScanResult{Record: r.Record}
+}
+
+// IsWorker returns true if the process is the unprivileged side of a
+// privilege-separated run.
+func IsWorker() bool {
+	_, ok := os.LookupEnv(envFD)
+	return ok
+}
+
+var (
+	workerOnce   sync.Once
+	workerClient *Client
+	workerErr    error
+)
+
+// NewImporter creates, in the helper, the importer described by config and
+// returns a proxy to it.  It must only be called when IsWorker is true.
+func NewImporter(config map[string]string) (importer.Importer, error) {
+	workerOnce.Do(func() {
+		fd, err := strconv.Atoi(os.Getenv(envFD))
+		if err != nil {
+			workerErr = fmt.Errorf("invalid %s: %w", envFD, err)
+			return
+		}
+
+		f := os.NewFile(uintptr(fd), "privsep")
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			workerErr = fmt.Errorf("could not connect to the privsep helper: %w", err)
+			return
+		}
+		workerClient = NewClient(conn)
+	})
+	if workerErr != nil {
+		return nil, workerErr
+	}
+	return workerClient.NewImporter(config)
+}
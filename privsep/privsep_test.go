@@ -0,0 +1,133 @@
+package privsep
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, root string) (*Client, chan error) {
+	helperConn, clientConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(helperConn, map[string]string{"location": root})
+		helperConn.Close()
+	}()
+	return NewClient(clientConn), done
+}
+
+func TestPrivsepImporter(t *testing.T) {
+	tmpImportDir, err := os.MkdirTemp("/tmp", "tmp_import*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpImportDir)
+	})
+
+	err = os.WriteFile(filepath.Join(tmpImportDir, "dummy.txt"), []byte("test importer privsep"), 0644)
+	require.NoError(t, err)
+
+	client, done := serve(t, tmpImportDir)
+	imp, err := client.NewImporter(map[string]string{"location": tmpImportDir})
+	require.NoError(t, err)
+	require.Equal(t, "fs", imp.Type())
+	require.Equal(t, tmpImportDir, imp.Root())
+
+	_, err = client.NewImporter(map[string]string{"location": tmpImportDir})
+	require.Error(t, err)
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	found := false
+	for result := range scanChan {
+		require.Nil(t, result.Error)
+		if result.Record.Pathname == filepath.Join(tmpImportDir, "dummy.txt") {
+			found = true
+			require.Equal(t, int64(21), result.Record.FileInfo.Size())
+		}
+	}
+	require.True(t, found)
+
+	rd, err := imp.NewReader(filepath.Join(tmpImportDir, "dummy.txt"))
+	require.NoError(t, err)
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "test importer privsep", string(data))
+	require.NoError(t, rd.Close())
+
+	_, err = imp.NewReader("/etc/passwd")
+	require.Error(t, err)
+
+	_, err = imp.NewReader(filepath.Join(tmpImportDir, "../../etc/passwd"))
+	require.Error(t, err)
+
+	require.NoError(t, imp.Close())
+	require.NoError(t, <-done)
+}
+
+func TestPrivsepImporterRoot(t *testing.T) {
+	tmpImportDir, err := os.MkdirTemp("/tmp", "tmp_import*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpImportDir)
+	})
+
+	client, done := serve(t, tmpImportDir)
+
+	// the root asked for by the client is ignored
+	imp, err := client.NewImporter(map[string]string{"location": "/etc"})
+	require.NoError(t, err)
+	require.Equal(t, tmpImportDir, imp.Root())
+
+	_, err = imp.NewReader("/etc/passwd")
+	require.Error(t, err)
+
+	require.NoError(t, imp.Close())
+	require.NoError(t, <-done)
+}
+
+func TestPrivsepImporterSymlink(t *testing.T) {
+	tmpImportDir, err := os.MkdirTemp("/tmp", "tmp_import*")
+	require.NoError(t, err)
+	tmpOutsideDir, err := os.MkdirTemp("/tmp", "tmp_outside*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpImportDir)
+		os.RemoveAll(tmpOutsideDir)
+	})
+
+	secret := filepath.Join(tmpOutsideDir, "secret.txt")
+	err = os.WriteFile(secret, []byte("not to be read"), 0644)
+	require.NoError(t, err)
+
+	err = os.Symlink(secret, filepath.Join(tmpImportDir, "link.txt"))
+	require.NoError(t, err)
+	err = os.Symlink(tmpOutsideDir, filepath.Join(tmpImportDir, "linkdir"))
+	require.NoError(t, err)
+	err = os.Symlink("../"+filepath.Base(tmpOutsideDir)+"/secret.txt", filepath.Join(tmpImportDir, "relative.txt"))
+	require.NoError(t, err)
+
+	client, done := serve(t, tmpImportDir)
+	imp, err := client.NewImporter(map[string]string{"location": tmpImportDir})
+	require.NoError(t, err)
+
+	_, err = imp.NewReader(filepath.Join(tmpImportDir, "link.txt"))
+	require.Error(t, err)
+
+	_, err = imp.NewReader(filepath.Join(tmpImportDir, "relative.txt"))
+	require.Error(t, err)
+
+	_, err = imp.NewReader(filepath.Join(tmpImportDir, "linkdir", "secret.txt"))
+	require.Error(t, err)
+
+	_, err = imp.GetExtendedAttributes(filepath.Join(tmpImportDir, "linkdir", "secret.txt"))
+	require.Error(t, err)
+
+	require.NoError(t, imp.Close())
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"slices"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+// Commit describes a snapshot committed to the repository: the state
+// pushed for it and the packfiles that state references.
+type Commit struct {
+	SnapshotID objects.MAC
+	StateID    objects.MAC
+	Packfiles  []objects.MAC
+}
+
+// CommitHook is run in the background once a snapshot is committed.
+type CommitHook func(r *Repository, commit Commit)
+
+// OnCommit registers a hook to run after every successful commit, until
+// the function returned is called.
+func (r *Repository) OnCommit(hook CommitHook) func() {
+	r.hooksMutex.Lock()
+	defer r.hooksMutex.Unlock()
+
+	registered := &hook
+	r.hooks = append(r.hooks, registered)
+	return func() {
+		r.hooksMutex.Lock()
+		defer r.hooksMutex.Unlock()
+
+		r.hooks = slices.DeleteFunc(r.hooks, func(h *CommitHook) bool {
+			return h == registered
+		})
+	}
+}
+
+// Committed runs the commit hooks for a snapshot which was just committed,
+// without waiting for them to complete.
+func (r *Repository) Committed(commit Commit) {
+	r.hooksMutex.Lock()
+	hooks := slices.Clone(r.hooks)
+	r.hooksMutex.Unlock()
+
+	for _, hook := range hooks {
+		r.hooksWg.Add(1)
+		go func() {
+			defer r.hooksWg.Done()
+			(*hook)(r, commit)
+		}()
+	}
+}
+
+// WaitHooks waits for the commit hooks running to complete.
+func (r *Repository) WaitHooks() {
+	r.hooksWg.Wait()
+}
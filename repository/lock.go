@@ -22,13 +22,21 @@ type Lock struct {
 	Timestamp time.Time          `msgpack:"timestamp"`
 	Hostname  string             `msgpack:"hostname"`
 	Exclusive bool               `msgpack:"exclusive"`
+
+	// Epoch is the time the holder started working under the lock, it is
+	// kept across refreshes.  A shared lock is the lease of a backup:
+	// maintenance kicks it out once stale, so a backup must not commit if
+	// its lease could have expired since its epoch.
+	Epoch time.Time `msgpack:"epoch"`
 }
 
 func newLock(hostname string, exclusive bool) *Lock {
+	now := time.Now()
 	return &Lock{
-		Timestamp: time.Now(),
+		Timestamp: now,
 		Hostname:  hostname,
 		Exclusive: exclusive,
+		Epoch:     now,
 	}
 }
 
@@ -0,0 +1,110 @@
+package repository_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func generateRemoteRepository(t *testing.T, encrypted bool) (*repository.Repository, *countingStore, string) {
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpCacheDir)
+	})
+
+	config := storage.NewConfiguration()
+	if !encrypted {
+		config.Encryption = nil
+	}
+	repo, store, _ := generateRepositoryWith(t, config, tmpCacheDir)
+	store.location = "s3://bucket/repo"
+	return repo, store, tmpCacheDir
+}
+
+// registerPackfile records the blobs of a packfile in a new state, as a
+// backup would, so that they can be read back.
+func registerPackfile(t *testing.T, repo *repository.Repository, mac objects.MAC) {
+	var stateID objects.MAC
+	_, err := rand.Read(stateID[:])
+	require.NoError(t, err)
+
+	sc, err := repo.AppContext().GetCache().Scan(stateID)
+	require.NoError(t, err)
+	defer sc.Close()
+	deltaState := repo.NewStateDelta(sc)
+
+	_, index, err := repo.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	for _, blob := range index {
+		require.NoError(t, deltaState.PutDelta(state.DeltaEntry{
+			Type:    blob.Type,
+			Version: blob.Version,
+			Blob:    blob.MAC,
+			Location: state.Location{
+				Packfile: mac,
+				Offset:   blob.Offset,
+				Length:   blob.Length,
+			},
+		}))
+	}
+	require.NoError(t, deltaState.PutPackfile(stateID, mac))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, deltaState.SerializeToStream(buf))
+	require.NoError(t, repo.PutState(stateID, buf))
+	require.NoError(t, repo.RebuildState())
+}
+
+// readTwice reads a blob twice through the node cache and returns how many
+// times it was fetched from the store.
+func readTwice(t *testing.T, repo *repository.Repository, store *countingStore) int {
+	mac, macs := writePackfile(t, repo)
+	registerPackfile(t, repo, mac)
+	store.blobFetches = 0
+
+	for i := 0; i < 2; i++ {
+		rd, err := repo.GetCachedBlob(resources.RT_CHUNK, macs[0])
+		require.NoError(t, err)
+		data, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		require.Equal(t, "blob number 0", string(data))
+	}
+	return store.blobFetches
+}
+
+func TestNodeCache(t *testing.T) {
+	repo, store, _ := generateRemoteRepository(t, false)
+	repo.EnableNodeCache()
+	require.Equal(t, 1, readTwice(t, repo, store))
+}
+
+func TestNodeCacheEncrypted(t *testing.T) {
+	// the VFS of an encrypted repository is not kept in clear on disk
+	repo, store, _ := generateRemoteRepository(t, true)
+	repo.EnableNodeCache()
+	require.Equal(t, 2, readTwice(t, repo, store))
+}
+
+func TestNodeCacheInUse(t *testing.T) {
+	repo, store, tmpCacheDir := generateRemoteRepository(t, false)
+
+	// another process holds the cache, browsing goes on without it
+	other := caching.NewManager(tmpCacheDir)
+	defer other.Close()
+	_, err := other.Nodes(repo.Configuration().RepositoryID)
+	require.NoError(t, err)
+
+	repo.EnableNodeCache()
+	require.Equal(t, 2, readTwice(t, repo, store))
+}
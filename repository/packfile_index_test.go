@@ -0,0 +1,194 @@
+package repository_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore records the packfiles fetched whole and the blobs fetched
+// alone, and may pretend to live elsewhere.
+type countingStore struct {
+	*bfs.Store
+	fetches     int
+	blobFetches int
+	location    string
+}
+
+func (s *countingStore) GetPackfile(mac objects.MAC) (io.Reader, error) {
+	s.fetches++
+	return s.Store.GetPackfile(mac)
+}
+
+func (s *countingStore) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
+	s.blobFetches++
+	return s.Store.GetPackfileBlob(mac, offset, length)
+}
+
+func (s *countingStore) Location() string {
+	if s.location != "" {
+		return s.location
+	}
+	return s.Store.Location()
+}
+
+func generateRepository(t *testing.T) (*repository.Repository, *countingStore, string) {
+	tmpCacheDir, err := os.MkdirTemp("", "tmp_cache")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpCacheDir)
+	})
+	return generateRepositoryWith(t, storage.NewConfiguration(), tmpCacheDir)
+}
+
+func generateRepositoryWith(t *testing.T, config *storage.Configuration, tmpCacheDir string) (*repository.Repository, *countingStore, string) {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	tmpRepoDir := fmt.Sprintf("%s/repo", tmpRepoDirRoot)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+
+	r, err := bfs.NewStore(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+	require.NoError(t, r.Create(wrappedConfig))
+
+	st, serializedConfig, err := storage.Open(map[string]string{"location": "fs://" + tmpRepoDir})
+	require.NoError(t, err)
+	store := &countingStore{Store: st.(*bfs.Store)}
+
+	ctx := appcontext.NewAppContext()
+	ctx.SetCache(caching.NewManager(tmpCacheDir))
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+
+	repo, err := repository.New(ctx, store, serializedConfig)
+	require.NoError(t, err)
+	return repo, store, tmpRepoDir
+}
+
+func writePackfile(t *testing.T, repo *repository.Repository) (objects.MAC, []objects.MAC) {
+	p := packfile.New(repo.GetMACHasher())
+
+	var macs []objects.MAC
+	for i := 0; i < 16; i++ {
+		data := []byte(fmt.Sprintf("blob number %d", i))
+		encoded, err := repo.EncodeBuffer(data)
+		require.NoError(t, err)
+		mac := repo.ComputeMAC(data)
+		p.AddBlob(resources.RT_CHUNK, versioning.GetCurrentVersion(resources.RT_CHUNK), mac, encoded, 0)
+		macs = append(macs, mac)
+	}
+
+	mac, err := repo.WritePackfile(p)
+	require.NoError(t, err)
+	return mac, macs
+}
+
+func dropCachedIndex(t *testing.T, repo *repository.Repository, mac objects.MAC) {
+	cache, err := repo.AppContext().GetCache().Repository(repo.Configuration().RepositoryID)
+	require.NoError(t, err)
+	require.NoError(t, cache.DelPackfileIndex(mac))
+}
+
+func TestGetPackfileIndexHit(t *testing.T) {
+	repo, store, tmpRepoDir := generateRepository(t)
+	mac, macs := writePackfile(t, repo)
+
+	// the index is served from the cache, even with the packfile gone
+	path := filepath.Join(tmpRepoDir, "packfiles", fmt.Sprintf("%02x", mac[0]), fmt.Sprintf("%064x", mac))
+	require.NoError(t, os.Remove(path))
+
+	footer, index, err := repo.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	require.Equal(t, uint32(len(macs)), footer.Count)
+	require.Len(t, index, len(macs))
+	for _, blobMAC := range macs {
+		_, found := packfile.LookupIndex(footer, index, resources.RT_CHUNK, blobMAC)
+		require.True(t, found)
+	}
+	require.Equal(t, 0, store.fetches)
+}
+
+func TestGetPackfileIndexMiss(t *testing.T) {
+	repo, store, _ := generateRepository(t)
+	mac, macs := writePackfile(t, repo)
+	dropCachedIndex(t, repo, mac)
+
+	// the footer and index are read alone, not the whole packfile
+	footer, index, err := repo.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	require.Equal(t, uint32(len(macs)), footer.Count)
+	require.Len(t, index, len(macs))
+	require.Equal(t, 0, store.fetches)
+
+	p, err := repo.GetPackfile(mac)
+	require.NoError(t, err)
+	require.Equal(t, p.Footer, footer)
+	require.Equal(t, p.Index, index)
+	store.fetches = 0
+
+	// and memoized
+	_, _, err = repo.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	require.Equal(t, 0, store.fetches)
+}
+
+func TestGetPackfileIndexInvalidation(t *testing.T) {
+	repo, _, _ := generateRepository(t)
+	mac, _ := writePackfile(t, repo)
+
+	cache, err := repo.AppContext().GetCache().Repository(repo.Configuration().RepositoryID)
+	require.NoError(t, err)
+	data, err := cache.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	require.NotNil(t, data)
+
+	require.NoError(t, repo.DeletePackfile(mac))
+	data, err = cache.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	require.Nil(t, data)
+
+	_, _, err = repo.GetPackfileIndex(mac)
+	require.Error(t, err)
+}
+
+func TestGetPackfileIndexCorrupted(t *testing.T) {
+	repo, _, _ := generateRepository(t)
+	mac, macs := writePackfile(t, repo)
+
+	// a cached entry which doesn't match the MAC of the footer is ignored
+	cache, err := repo.AppContext().GetCache().Repository(repo.Configuration().RepositoryID)
+	require.NoError(t, err)
+	data, err := cache.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, cache.PutPackfileIndex(mac, data))
+
+	_, index, err := repo.GetPackfileIndex(mac)
+	require.NoError(t, err)
+	require.Len(t, index, len(macs))
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// ReadVerified reads a packfile or a state as found in the storage and
+// checks its MAC before it is copied elsewhere, since a replica is only
+// worth something if it doesn't propagate damage.
+func (r *Repository) ReadVerified(Type resources.Type, mac objects.MAC) ([]byte, error) {
+	var rd io.Reader
+	var err error
+	switch Type {
+	case resources.RT_PACKFILE:
+		rd, err = r.store.GetPackfile(mac)
+	case resources.RT_STATE:
+		rd, err = r.store.GetState(mac)
+	default:
+		return nil, fmt.Errorf("can't replicate resources of type %s", Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	// the storage MAC covers the whole resource as stored...
+	_, payloadRd, err := storage.Deserialize(r.GetMACHasher(), Type, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := io.ReadAll(payloadRd)
+	if err != nil {
+		return nil, fmt.Errorf("%s %x: %w", Type, mac[:4], err)
+	}
+
+	// ...and a packfile is further named after the MAC of its content.
+	if Type == resources.RT_PACKFILE && r.ComputeMAC(payload) != mac {
+		return nil, fmt.Errorf("%s %x: MAC mismatch", Type, mac[:4])
+	}
+	return data, nil
+}
+
+// Replicate returns a commit hook copying the packfiles of each commit,
+// then its state, to replicas which must be clones of the repository.
+// Failed transfers are retried up to retries times, waiting backoff
+// before the first retry and twice as long before each following one.
+func Replicate(replicas []*Repository, retries int, backoff time.Duration) CommitHook {
+	return func(r *Repository, commit Commit) {
+		var wg sync.WaitGroup
+		for _, replica := range replicas {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.replicate(replica, commit, retries, backoff)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func (r *Repository) replicate(replica *Repository, commit Commit, retries int, backoff time.Duration) {
+	evt := events.ReplicationEvent(commit.SnapshotID, replica.Location())
+	evt.Total = uint64(len(commit.Packfiles)) + 1
+
+	if replica.Configuration().RepositoryID != r.Configuration().RepositoryID {
+		evt.Error = fmt.Sprintf("%s is not a clone of %s", replica.Location(), r.Location())
+		r.appContext.Events().Send(evt)
+		r.Logger().Error("replication of snapshot %x failed: %s", commit.SnapshotID[:4], evt.Error)
+		return
+	}
+
+	// packfiles copied by a failed attempt are not copied again, and the
+	// state only once all of them made it, so that the replica never
+	// references packfiles it doesn't hold.
+	copied := make(map[objects.MAC]struct{}, len(commit.Packfiles))
+	attempt := func() error {
+		for _, mac := range commit.Packfiles {
+			if _, ok := copied[mac]; ok {
+				continue
+			}
+			data, err := r.ReadVerified(resources.RT_PACKFILE, mac)
+			if err != nil {
+				return err
+			}
+			if err := replica.store.PutPackfile(mac, bytes.NewReader(data)); err != nil {
+				return fmt.Errorf("packfile %x: %w", mac[:4], err)
+			}
+			copied[mac] = struct{}{}
+			evt.Copied++
+			evt.Timestamp = time.Now()
+			r.appContext.Events().Send(evt)
+		}
+
+		data, err := r.ReadVerified(resources.RT_STATE, commit.StateID)
+		if err != nil {
+			return err
+		}
+		if err := replica.store.PutState(commit.StateID, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("state %x: %w", commit.StateID[:4], err)
+		}
+		evt.Copied++
+		return nil
+	}
+
+	delay := backoff
+	for evt.Attempt = 1; ; evt.Attempt++ {
+		err := attempt()
+		evt.Timestamp = time.Now()
+		if err == nil {
+			evt.Done = true
+			evt.Error = ""
+			r.appContext.Events().Send(evt)
+			r.Logger().Info("replicated snapshot %x to %s", commit.SnapshotID[:4], replica.Location())
+			return
+		}
+
+		evt.Error = err.Error()
+		r.appContext.Events().Send(evt)
+		if evt.Attempt > retries {
+			r.Logger().Error("replication of snapshot %x to %s failed: %s", commit.SnapshotID[:4], replica.Location(), err)
+			return
+		}
+		r.Logger().Warn("replication of snapshot %x to %s failed, retrying in %s: %s", commit.SnapshotID[:4], replica.Location(), delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"iter"
 	"strings"
+	"sync"
 	"time"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
@@ -25,6 +26,7 @@ import (
 	"github.com/PlakarKorp/plakar/packfile"
 	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/similarity"
 	"github.com/PlakarKorp/plakar/storage"
 	"github.com/PlakarKorp/plakar/versioning"
 	"github.com/google/uuid"
@@ -40,7 +42,17 @@ type Repository struct {
 	state         *state.LocalState
 	configuration storage.Configuration
 
+	// nodeCache keeps the VFS blobs read, when enabled
+	nodeCache *caching.NodeCache
+
+	// storeConfig is the configuration of a repository yet to be created
+	storeConfig map[string]string
+
 	appContext *appcontext.AppContext
+
+	hooks      []*CommitHook
+	hooksMutex sync.Mutex
+	hooksWg    sync.WaitGroup
 }
 
 func Inexistent(ctx *appcontext.AppContext, storeConfig map[string]string) (*Repository, error) {
@@ -53,6 +65,7 @@ func Inexistent(ctx *appcontext.AppContext, storeConfig map[string]string) (*Rep
 	return &Repository{
 		store:         st,
 		configuration: *storage.NewConfiguration(),
+		storeConfig:   storeConfig,
 		appContext:    ctx,
 	}, nil
 }
@@ -74,6 +87,9 @@ func New(ctx *appcontext.AppContext, store storage.Store, config []byte) (*Repos
 	if err != nil {
 		return nil, err
 	}
+	if err := storage.CheckVersion(version); err != nil {
+		return nil, err
+	}
 
 	unwrappedConfig, err := io.ReadAll(unwrappedConfigRd)
 	if err != nil {
@@ -115,6 +131,9 @@ func NewNoRebuild(ctx *appcontext.AppContext, store storage.Store, config []byte
 	if err != nil {
 		return nil, err
 	}
+	if err := storage.CheckVersion(version); err != nil {
+		return nil, err
+	}
 
 	unwrappedConfig, err := io.ReadAll(unwrappedConfigRd)
 	if err != nil {
@@ -208,9 +227,43 @@ func (r *Repository) RebuildState() error {
 	// naturally with concurrent first backups.
 	r.state.UpdateSerialOr(r.configuration.RepositoryID)
 
+	// Only the states just merged are checked, so that a skew is
+	// reported once rather than on every run.
+	if len(missingStates) != 0 {
+		r.warnClockSkews(missingStates)
+	}
+
 	return nil
 }
 
+// warnClockSkews reports the states among stateIDs written by a client
+// whose clock was wrong.  They are still ordered correctly, but the
+// timestamps of the snapshots that client took are not to be trusted.
+func (r *Repository) warnClockSkews(stateIDs []objects.MAC) {
+	skews, err := r.ClockSkews()
+	if err != nil {
+		r.Logger().Warn("could not check states for clock skew: %s", err)
+		return
+	}
+
+	merged := make(map[objects.MAC]struct{}, len(stateIDs))
+	for _, stateID := range stateIDs {
+		merged[stateID] = struct{}{}
+	}
+	for _, skew := range skews {
+		if _, ok := merged[skew.StateID]; !ok {
+			continue
+		}
+		if skew.Skew > 0 {
+			r.Logger().Warn("state %x is dated %s in the future, the clock of this host or of the client which wrote it is wrong",
+				skew.StateID[:4], skew.Skew.Round(time.Second))
+		} else {
+			r.Logger().Warn("state %x is dated %s before the states it follows, the clock of the client which wrote it is late",
+				skew.StateID[:4], (-skew.Skew).Round(time.Second))
+		}
+	}
+}
+
 func (r *Repository) AppContext() *appcontext.AppContext {
 	return r.appContext
 }
@@ -224,6 +277,7 @@ func (r *Repository) Close() error {
 	defer func() {
 		r.Logger().Trace("repository", "Close(): %s", time.Since(t0))
 	}()
+	r.WaitHooks()
 	return nil
 }
 
@@ -353,6 +407,12 @@ func (r *Repository) Location() string {
 	return r.store.Location()
 }
 
+// StoreConfig returns the settings of the store a repository is to be
+// created in, as found in the configuration file.
+func (r *Repository) StoreConfig() map[string]string {
+	return r.storeConfig
+}
+
 func (r *Repository) Configuration() storage.Configuration {
 	return r.configuration
 }
@@ -410,6 +470,46 @@ func (r *Repository) DeleteSnapshot(snapshotID objects.MAC) error {
 	return nil
 }
 
+// MarkPackfilesDeleted colours packfiles for deletion.  The maintenance
+// sweep pass removes them once past the grace period, unless a snapshot
+// relies on them again by then.
+func (r *Repository) MarkPackfilesDeleted(packfiles []objects.MAC) error {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "MarkPackfilesDeleted(%d): %s", len(packfiles), time.Since(t0))
+	}()
+
+	var identifier objects.MAC
+	n, err := rand.Read(identifier[:])
+	if err != nil {
+		return err
+	}
+	if n != len(identifier) {
+		return io.ErrShortWrite
+	}
+
+	sc, err := r.AppContext().GetCache().Scan(identifier)
+	if err != nil {
+		return err
+	}
+	deltaState := r.state.Derive(sc)
+
+	for _, packfileMAC := range packfiles {
+		if err := deltaState.DeleteResource(resources.RT_PACKFILE, packfileMAC); err != nil {
+			return err
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	err = deltaState.SerializeToStream(buffer)
+	if err != nil {
+		return err
+	}
+
+	mac := r.ComputeMAC(buffer.Bytes())
+	return r.PutState(mac, buffer)
+}
+
 func (r *Repository) GetStates() ([]objects.MAC, error) {
 	t0 := time.Now()
 	defer func() {
@@ -442,6 +542,21 @@ func (r *Repository) GetState(mac objects.MAC) (versioning.Version, io.Reader, e
 	return version, rd, err
 }
 
+// HasState returns true if a state is merged in the aggregate state.
+func (r *Repository) HasState(mac objects.MAC) (bool, error) {
+	return r.state.HasState(mac)
+}
+
+// InsertState fetches a state from storage and merges it in the aggregate
+// state, without rebuilding the latter.
+func (r *Repository) InsertState(mac objects.MAC) error {
+	version, rd, err := r.GetState(mac)
+	if err != nil {
+		return err
+	}
+	return r.state.InsertState(version, mac, rd)
+}
+
 func (r *Repository) PutState(mac objects.MAC, rd io.Reader) error {
 	t0 := time.Now()
 	defer func() {
@@ -533,6 +648,8 @@ func (r *Repository) GetPackfile(mac objects.MAC) (*packfile.PackFile, error) {
 		return nil, fmt.Errorf("packfile: index MAC mismatch")
 	}
 
+	r.memoizePackfileIndex(mac, packfileVersion, footerbuf, indexbuf)
+
 	rawPackfile = append(rawPackfile, indexbuf...)
 	rawPackfile = append(rawPackfile, footerbuf...)
 
@@ -545,6 +662,184 @@ func (r *Repository) GetPackfile(mac objects.MAC) (*packfile.PackFile, error) {
 	return p, nil
 }
 
+// memoizePackfileIndex records the decoded footer and index of a packfile
+// in the local cache, failing to do so only costs a later fetch.
+func (r *Repository) memoizePackfileIndex(mac objects.MAC, version versioning.Version, footer, index []byte) {
+	cache, err := r.AppContext().GetCache().Repository(r.Configuration().RepositoryID)
+	if err != nil {
+		return
+	}
+
+	data := make([]byte, 8, 8+len(footer)+len(index))
+	binary.LittleEndian.PutUint32(data[0:], uint32(version))
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(footer)))
+	data = append(data, footer...)
+	data = append(data, index...)
+
+	if err := cache.PutPackfileIndex(mac, data); err != nil {
+		r.Logger().Warn("could not cache index of packfile %x: %s", mac, err)
+	}
+}
+
+func (r *Repository) lookupPackfileIndex(mac objects.MAC) (packfile.PackFileFooter, []packfile.Blob, bool) {
+	cache, err := r.AppContext().GetCache().Repository(r.Configuration().RepositoryID)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, false
+	}
+
+	data, err := cache.GetPackfileIndex(mac)
+	if err != nil || len(data) < 8 {
+		return packfile.PackFileFooter{}, nil, false
+	}
+
+	version := versioning.Version(binary.LittleEndian.Uint32(data[0:]))
+	footerLength := int(binary.LittleEndian.Uint32(data[4:]))
+	if len(data) < 8+footerLength {
+		return packfile.PackFileFooter{}, nil, false
+	}
+	footerbuf, indexbuf := data[8:8+footerLength], data[8+footerLength:]
+
+	footer, err := packfile.NewFooterFromBytes(version, footerbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, false
+	}
+
+	hasher := r.GetMACHasher()
+	hasher.Write(indexbuf)
+	if !bytes.Equal(hasher.Sum(nil), footer.IndexMAC[:]) {
+		return packfile.PackFileFooter{}, nil, false
+	}
+
+	index, err := packfile.NewIndexFromBytes(version, indexbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, false
+	}
+
+	return footer, index, true
+}
+
+// GetPackfileIndex returns the footer and index of a packfile.  They are
+// memoized in the local cache so that repeated checks, restores or
+// maintenance runs don't fetch and decode them again, and only they are
+// read on a miss if the store can tell the size of the packfile.
+func (r *Repository) GetPackfileIndex(mac objects.MAC) (packfile.PackFileFooter, []packfile.Blob, error) {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "GetPackfileIndex(%x): %s", mac, time.Since(t0))
+	}()
+
+	if footer, index, ok := r.lookupPackfileIndex(mac); ok {
+		return footer, index, nil
+	}
+
+	if sizer, ok := r.store.(storage.PackfileSizer); ok {
+		footer, index, err := r.readPackfileIndex(sizer, mac)
+		if err == nil {
+			return footer, index, nil
+		}
+		r.Logger().Trace("repository", "GetPackfileIndex(%x): ranged read failed: %s", mac, err)
+	}
+
+	p, err := r.GetPackfile(mac)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+	return p.Footer, p.Index, nil
+}
+
+func (r *Repository) readPackfileRange(mac objects.MAC, offset uint64, length uint64) ([]byte, error) {
+	rd, err := r.store.GetPackfileBlob(mac, offset, uint32(length))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != length {
+		return nil, fmt.Errorf("packfile: short read at offset %d", offset)
+	}
+	return data, nil
+}
+
+// readPackfileIndex reads the footer and index of a packfile alone, with
+// ranged reads from its end, rather than fetching the whole packfile.  The
+// index is authenticated by the MAC recorded in the footer.
+func (r *Repository) readPackfileIndex(sizer storage.PackfileSizer, mac objects.MAC) (packfile.PackFileFooter, []packfile.Blob, error) {
+	size, err := sizer.GetPackfileSize(mac)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+
+	headerSize := uint64(storage.STORAGE_HEADER_SIZE)
+	trailerSize := uint64(storage.STORAGE_FOOTER_SIZE) + 4
+	if size < headerSize+trailerSize {
+		return packfile.PackFileFooter{}, nil, fmt.Errorf("packfile: too short")
+	}
+
+	header, err := r.readPackfileRange(mac, 0, headerSize)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+	if !bytes.Equal(header[0:8], []byte("_PLAKAR_")) {
+		return packfile.PackFileFooter{}, nil, fmt.Errorf("packfile: invalid magic")
+	}
+	if resources.Type(binary.LittleEndian.Uint32(header[8:12])) != resources.RT_PACKFILE {
+		return packfile.PackFileFooter{}, nil, fmt.Errorf("packfile: invalid resource type")
+	}
+	version := versioning.Version(binary.LittleEndian.Uint32(header[12:16]))
+
+	footerEnd := size - trailerSize
+	trailer, err := r.readPackfileRange(mac, footerEnd, 4)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+	footerLength := uint64(binary.LittleEndian.Uint32(trailer))
+	if footerLength > footerEnd-headerSize {
+		return packfile.PackFileFooter{}, nil, fmt.Errorf("packfile: invalid footer length")
+	}
+
+	footerbuf, err := r.readPackfileRange(mac, footerEnd-footerLength, footerLength)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+	footerbuf, err = r.DecodeBuffer(footerbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+	footer, err := packfile.NewFooterFromBytes(version, footerbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+
+	indexStart := headerSize + footer.IndexOffset
+	if indexStart > footerEnd-footerLength {
+		return packfile.PackFileFooter{}, nil, fmt.Errorf("packfile: invalid index offset")
+	}
+	indexbuf, err := r.readPackfileRange(mac, indexStart, footerEnd-footerLength-indexStart)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+	indexbuf, err = r.DecodeBuffer(indexbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+
+	hasher := r.GetMACHasher()
+	hasher.Write(indexbuf)
+	if !bytes.Equal(hasher.Sum(nil), footer.IndexMAC[:]) {
+		return packfile.PackFileFooter{}, nil, fmt.Errorf("packfile: index MAC mismatch")
+	}
+
+	index, err := packfile.NewIndexFromBytes(version, indexbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, nil, err
+	}
+
+	r.memoizePackfileIndex(mac, version, footerbuf, indexbuf)
+	return footer, index, nil
+}
+
 func (r *Repository) GetPackfileBlob(loc state.Location) (io.ReadSeeker, error) {
 	t0 := time.Now()
 	defer func() {
@@ -582,6 +877,61 @@ func (r *Repository) PutPackfile(mac objects.MAC, rd io.Reader) error {
 	return r.store.PutPackfile(mac, rd)
 }
 
+// PackfileFeatures returns the feature bits of the packfiles written to
+// this repository.
+func (r *Repository) PackfileFeatures() uint32 {
+	features := packfile.FEATURE_SORTED_INDEX
+	if r.configuration.Compression != nil {
+		features |= packfile.CompressionFeature(r.configuration.Compression.Algorithm)
+	}
+	return features
+}
+
+// WritePackfile serializes a packfile whose blobs are already encoded,
+// encoding its index and footer, and stores it under its MAC.
+func (r *Repository) WritePackfile(p *packfile.PackFile) (objects.MAC, error) {
+	p.SetFeatures(r.PackfileFeatures())
+
+	serializedData, err := p.SerializeData()
+	if err != nil {
+		return objects.MAC{}, fmt.Errorf("could not serialize pack file data %s", err.Error())
+	}
+	serializedIndex, err := p.SerializeIndex()
+	if err != nil {
+		return objects.MAC{}, fmt.Errorf("could not serialize pack file index %s", err.Error())
+	}
+	serializedFooter, err := p.SerializeFooter()
+	if err != nil {
+		return objects.MAC{}, fmt.Errorf("could not serialize pack file footer %s", err.Error())
+	}
+
+	encryptedIndex, err := r.EncodeBuffer(serializedIndex)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+
+	encryptedFooter, err := r.EncodeBuffer(serializedFooter)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+
+	serializedPackfile := append(serializedData, encryptedIndex...)
+	serializedPackfile = append(serializedPackfile, encryptedFooter...)
+
+	/* it is necessary to track the footer _encrypted_ length */
+	encryptedFooterLength := make([]byte, 4)
+	binary.LittleEndian.PutUint32(encryptedFooterLength, uint32(len(encryptedFooter)))
+	serializedPackfile = append(serializedPackfile, encryptedFooterLength...)
+
+	mac := r.ComputeMAC(serializedPackfile)
+	if err := r.PutPackfile(mac, bytes.NewBuffer(serializedPackfile)); err != nil {
+		return objects.MAC{}, fmt.Errorf("Could not write pack file %s", err.Error())
+	}
+
+	r.memoizePackfileIndex(mac, versioning.GetCurrentVersion(resources.RT_PACKFILE), serializedFooter, serializedIndex)
+	return mac, nil
+}
+
 // Deletes a packfile from the store. Warning this is a true delete and is unrecoverable.
 func (r *Repository) DeletePackfile(mac objects.MAC) error {
 	t0 := time.Now()
@@ -589,6 +939,10 @@ func (r *Repository) DeletePackfile(mac objects.MAC) error {
 		r.Logger().Trace("repository", "DeletePackfile(%x): %s", mac, time.Since(t0))
 	}()
 
+	if cache, err := r.AppContext().GetCache().Repository(r.Configuration().RepositoryID); err == nil {
+		cache.DelPackfileIndex(mac)
+	}
+
 	return r.store.DeletePackfile(mac)
 }
 
@@ -683,6 +1037,9 @@ func (r *Repository) GetBlob(Type resources.Type, mac objects.MAC) (io.ReadSeeke
 	}
 
 	if !exists {
+		if Type == resources.RT_CHUNK {
+			return r.getChunkDelta(mac)
+		}
 		return nil, ErrPackfileNotFound
 	}
 
@@ -700,20 +1057,132 @@ func (r *Repository) GetBlob(Type resources.Type, mac objects.MAC) (io.ReadSeeke
 
 	rd, err := r.GetPackfileBlob(loc)
 	if err != nil {
-		return nil, err
+		// the location recorded in the state may be stale, the index of
+		// the packfile, usually found in the local cache, is authoritative
+		footer, index, ierr := r.GetPackfileIndex(loc.Packfile)
+		if ierr != nil {
+			return nil, err
+		}
+		blob, found := packfile.LookupIndex(footer, index, Type, mac)
+		if !found || (blob.Offset == loc.Offset && blob.Length == loc.Length) {
+			return nil, err
+		}
+		r.Logger().Warn("GetBlob(%s, %x): stale location in state, using the packfile index", Type, mac)
+		loc.Offset, loc.Length = blob.Offset, blob.Length
+		return r.GetPackfileBlob(loc)
 	}
 
 	return rd, nil
 }
 
+// EnableNodeCache keeps the btree nodes and entries of snapshots read from
+// a remote repository in a local cache, so that browsing them again does
+// not fetch them.  Local repositories have nothing to gain from it, and
+// encrypted ones would have their VFS stored in clear on the local disk.
+func (r *Repository) EnableNodeCache() {
+	location := r.Location()
+	if !strings.Contains(location, "://") || strings.HasPrefix(location, "fs://") || strings.HasPrefix(location, "sqlite://") {
+		return
+	}
+	if r.Configuration().Encryption != nil {
+		return
+	}
+
+	cache, err := r.AppContext().GetCache().Nodes(r.Configuration().RepositoryID)
+	if err != nil {
+		// another process, e.g. a mount, may be browsing the repository
+		if errors.Is(err, caching.ErrInUse) {
+			r.Logger().Info("node cache in use by another process, browsing without it")
+		} else {
+			r.Logger().Warn("could not open node cache: %s", err)
+		}
+		return
+	}
+	r.nodeCache = cache
+}
+
+// GetCachedBlob is GetBlob served from the node cache when enabled, only
+// meant for the immutable blobs of the VFS.
+func (r *Repository) GetCachedBlob(Type resources.Type, mac objects.MAC) (io.ReadSeeker, error) {
+	if r.nodeCache == nil {
+		return r.GetBlob(Type, mac)
+	}
+
+	data, err := r.nodeCache.GetBlob(Type, mac)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		return bytes.NewReader(data), nil
+	}
+
+	rd, err := r.GetBlob(Type, mac)
+	if err != nil {
+		return nil, err
+	}
+	data, err = io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.nodeCache.PutBlob(Type, mac, data); err != nil {
+		r.Logger().Warn("could not cache %s %x: %s", Type, mac, err)
+	}
+	return bytes.NewReader(data), nil
+}
+
 func (r *Repository) BlobExists(Type resources.Type, mac objects.MAC) bool {
 	t0 := time.Now()
 	defer func() {
 		r.Logger().Trace("repository", "BlobExists(%s, %x): %s", Type, mac, time.Since(t0))
 	}()
+	if Type == resources.RT_CHUNK && r.state.BlobExists(resources.RT_CHUNK_DELTA, mac) {
+		return true
+	}
 	return r.state.BlobExists(Type, mac)
 }
 
+// GetChunkDeltaBase returns the chunk a chunk delta was encoded against.
+func (r *Repository) GetChunkDeltaBase(mac objects.MAC) (objects.MAC, []byte, error) {
+	rd, err := r.GetBlob(resources.RT_CHUNK_DELTA, mac)
+	if err != nil {
+		return objects.MAC{}, nil, err
+	}
+
+	payload, err := io.ReadAll(rd)
+	if err != nil {
+		return objects.MAC{}, nil, err
+	}
+
+	if len(payload) < len(objects.MAC{}) {
+		return objects.MAC{}, nil, fmt.Errorf("chunk delta %x: %w", mac, similarity.ErrInvalidDelta)
+	}
+	return objects.MAC(payload[:len(objects.MAC{})]), payload[len(objects.MAC{}):], nil
+}
+
+// getChunkDelta rebuilds a chunk stored as a delta against a similar one.
+func (r *Repository) getChunkDelta(mac objects.MAC) (io.ReadSeeker, error) {
+	base, delta, err := r.GetChunkDeltaBase(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	rd, err := r.GetBlob(resources.RT_CHUNK, base)
+	if err != nil {
+		return nil, err
+	}
+
+	baseData, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := similarity.Patch(baseData, delta)
+	if err != nil {
+		return nil, fmt.Errorf("chunk delta %x: %w", mac, err)
+	}
+	return bytes.NewReader(data), nil
+}
+
 // Removes the provided blob from our state, making it unreachable
 func (r *Repository) RemoveBlob(Type resources.Type, mac, packfileMAC objects.MAC) error {
 	t0 := time.Now()
@@ -723,6 +1192,14 @@ func (r *Repository) RemoveBlob(Type resources.Type, mac, packfileMAC objects.MA
 	return r.state.DelDelta(Type, mac, packfileMAC)
 }
 
+func (r *Repository) ListBlobs() iter.Seq2[state.DeltaEntry, error] {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "ListBlobs(): %s", time.Since(t0))
+	}()
+	return r.state.ListDeltas()
+}
+
 func (r *Repository) ListOrphanBlobs() iter.Seq2[state.DeltaEntry, error] {
 	t0 := time.Now()
 	defer func() {
@@ -739,6 +1216,14 @@ func (r *Repository) ListSnapshots() iter.Seq[objects.MAC] {
 	return r.state.ListSnapshots()
 }
 
+func (r *Repository) ListSnapshotTimestamps() iter.Seq2[objects.MAC, time.Time] {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "ListSnapshotTimestamps(): %s", time.Since(t0))
+	}()
+	return r.state.ListSnapshotTimestamps()
+}
+
 func (r *Repository) ListPackfiles() iter.Seq[objects.MAC] {
 	t0 := time.Now()
 	defer func() {
@@ -747,9 +1232,26 @@ func (r *Repository) ListPackfiles() iter.Seq[objects.MAC] {
 	return r.state.ListPackfiles()
 }
 
+func (r *Repository) ListStatePackfiles(stateID objects.MAC) iter.Seq2[objects.MAC, error] {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "ListStatePackfiles(%x): %s", stateID, time.Since(t0))
+	}()
+	return r.state.ListStatePackfiles(stateID)
+}
+
 // Saves the full aggregated state to the repository, might be heavy handed use
 // with care.
 func (r *Repository) PutCurrentState() error {
+	_, err := r.putCurrentState()
+	return err
+}
+
+func (r *Repository) putCurrentState() (objects.MAC, error) {
+	newSerial := uuid.New()
+	r.state.Metadata.Serial = newSerial
+	id := r.ComputeMAC(newSerial[:])
+
 	pr, pw := io.Pipe()
 
 	/* By using a pipe and a goroutine we bound the max size in memory. */
@@ -760,17 +1262,161 @@ func (r *Repository) PutCurrentState() error {
 		}
 	}()
 
-	newSerial := uuid.New()
-	r.state.Metadata.Serial = newSerial
-	id := r.ComputeMAC(newSerial[:])
+	return id, r.PutState(id, pr)
+}
 
-	return r.PutState(id, pr)
+// Serial returns the serial of the aggregate state.
+func (r *Repository) Serial() uuid.UUID {
+	return r.state.Metadata.Serial
+}
+
+// ClockSkews returns the states merged in the aggregate which were written
+// by a client whose clock was wrong.
+func (r *Repository) ClockSkews() ([]state.ClockSkew, error) {
+	return r.state.ClockSkews(time.Now(), state.CLOCK_SKEW_TOLERANCE)
+}
+
+// Serials returns the states merged in the aggregate grouped by serial.
+func (r *Repository) Serials() (map[uuid.UUID][]objects.MAC, error) {
+	return r.state.Serials()
+}
+
+// CompactStates pushes the aggregate of the repository states as a single
+// state with a fresh serial, and prunes the states it supersedes.  Only the
+// states merged in the aggregate are pruned: a delta state pushed
+// concurrently is left in place and merged by the next rebuild.
+func (r *Repository) CompactStates() (objects.MAC, []objects.MAC, error) {
+	if err := r.RebuildState(); err != nil {
+		return objects.MAC{}, nil, err
+	}
+
+	remoteStates, err := r.GetStates()
+	if err != nil {
+		return objects.MAC{}, nil, err
+	}
+
+	superseded := make([]objects.MAC, 0, len(remoteStates))
+	for _, stateID := range remoteStates {
+		has, err := r.state.HasState(stateID)
+		if err != nil {
+			return objects.MAC{}, nil, err
+		}
+		if has {
+			superseded = append(superseded, stateID)
+		}
+	}
+
+	// The compacted state must be the most recent one so that clients
+	// rebuilding their aggregate adopt its serial.
+	r.state.Metadata.Timestamp = time.Now()
+	r.state.Metadata.Sequence++
+	id, err := r.putCurrentState()
+	if err != nil {
+		return objects.MAC{}, nil, err
+	}
+
+	for _, stateID := range superseded {
+		if stateID == id {
+			continue
+		}
+		if err := r.DeleteState(stateID); err != nil {
+			return id, nil, err
+		}
+	}
+
+	return id, superseded, nil
 }
 
 func (r *Repository) Logger() *logging.Logger {
 	return r.AppContext().GetLogger()
 }
 
+// ExclusiveLock installs an exclusive lock identified by lockID, failing if
+// the repository is already locked.  The lock is refreshed until the
+// returned channel is closed, at which point it is removed.
+func (r *Repository) ExclusiveLock(lockID objects.MAC) (chan bool, error) {
+	lock := NewExclusiveLock(r.AppContext().Hostname)
+
+	buffer := &bytes.Buffer{}
+	err := lock.SerializeToStream(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.PutLock(lockID, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	// We installed the lock, now let's see if there is a conflicting exclusive lock or not.
+	locksID, err := r.GetLocks()
+	if err != nil {
+		// We still need to delete it, and we need to do so manually.
+		r.DeleteLock(lockID)
+		return nil, err
+	}
+
+	for _, otherID := range locksID {
+		if otherID == lockID {
+			continue
+		}
+
+		version, rd, err := r.GetLock(otherID)
+		if err != nil {
+			r.DeleteLock(lockID)
+			return nil, err
+		}
+
+		lock, err := NewLockFromStream(version, rd)
+		if err != nil {
+			r.DeleteLock(lockID)
+			return nil, err
+		}
+
+		/* Kick out stale locks */
+		if lock.IsStale() {
+			err := r.DeleteLock(otherID)
+			if err != nil {
+				r.DeleteLock(lockID)
+				return nil, err
+			}
+		}
+
+		// There is a lock in place, we need to abort.
+		err = r.DeleteLock(lockID)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("Can't take exclusive lock, repository is already locked")
+	}
+
+	// The following bit is a "ping" mechanism, Lock() is a bit badly named at this point,
+	// we are just refreshing the existing lock so that the watchdog doesn't removes us.
+	lockDone := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-lockDone:
+				r.DeleteLock(lockID)
+				return
+			case <-time.After(LOCK_REFRESH_RATE):
+				lock := NewExclusiveLock(r.AppContext().Hostname)
+
+				buffer := &bytes.Buffer{}
+
+				// We ignore errors here on purpose, it's tough to handle them
+				// correctly, and if they happen we will be ripped by the
+				// watchdog anyway.
+				lock.SerializeToStream(buffer)
+				r.PutLock(lockID, buffer)
+			}
+		}
+	}()
+
+	return lockDone, nil
+}
+
 func (r *Repository) GetLocks() ([]objects.MAC, error) {
 	t0 := time.Now()
 	defer func() {
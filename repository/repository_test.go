@@ -0,0 +1,38 @@
+package repository_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUnsupportedVersion(t *testing.T) {
+	serialized, err := storage.NewConfiguration().ToBytes()
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+
+	for _, version := range []string{"1.2.0", "2.0.0"} {
+		hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+		wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.FromString(version), bytes.NewReader(serialized))
+		require.NoError(t, err)
+		wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+		require.NoError(t, err)
+
+		_, err = repository.New(ctx, nil, wrappedConfig)
+		require.ErrorIs(t, err, storage.ErrUnsupportedVersion)
+		_, err = repository.NewNoRebuild(ctx, nil, wrappedConfig)
+		require.ErrorIs(t, err, storage.ErrUnsupportedVersion)
+	}
+}
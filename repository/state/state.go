@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"slices"
 	"time"
 
 	"github.com/PlakarKorp/plakar/caching"
@@ -47,12 +48,47 @@ const (
 	ET_DELETED                 = 3
 	ET_PACKFILE                = 4
 	ET_CONFIGURATION           = 5
+	ET_SEQUENCE                = 6
 )
 
+// CLOCK_SKEW_TOLERANCE is how far apart the clocks of two clients may be
+// before the states they write are reported as skewed.
+const CLOCK_SKEW_TOLERANCE = 5 * time.Minute
+
+// Metadata describes a state.  Its sequence is a logical clock, one more
+// than the highest sequence the writer had merged, so that states are
+// ordered by causality rather than by the clocks of the clients.  States
+// written before sequences were introduced have a sequence of zero and
+// are ordered by timestamp.
 type Metadata struct {
 	Version   versioning.Version `msgpack:"version"`
 	Timestamp time.Time          `msgpack:"timestamp"`
 	Serial    uuid.UUID          `msgpack:"serial"`
+	Sequence  uint64             `msgpack:"sequence"`
+}
+
+// after reports whether mt was written after other, sequences taking
+// precedence over timestamps.  Ties are broken on the state ID so that
+// clients which merged the same states agree on the order.
+func (mt *Metadata) after(id objects.MAC, other *Metadata, otherID objects.MAC) bool {
+	if mt.Sequence != other.Sequence {
+		return mt.Sequence > other.Sequence
+	}
+	if !mt.Timestamp.Equal(other.Timestamp) {
+		return mt.Timestamp.After(other.Timestamp)
+	}
+	return bytes.Compare(id[:], otherID[:]) > 0
+}
+
+// ClockSkew reports a state whose timestamp contradicts its sequence, or
+// lies in the future, as the clock of its writer was likely wrong.
+type ClockSkew struct {
+	StateID   objects.MAC
+	Timestamp time.Time
+	Sequence  uint64
+	// Skew is how far behind its predecessor (negative) or ahead of
+	// the local clock (positive) the state is.
+	Skew time.Duration
 }
 
 type Location struct {
@@ -145,14 +181,16 @@ func FromStream(version versioning.Version, rd io.Reader, cache caching.StateCac
 func (ls *LocalState) Derive(cache caching.StateCache) *LocalState {
 	st := NewLocalState(cache)
 	st.Metadata.Serial = ls.Metadata.Serial
+	st.Metadata.Sequence = ls.Metadata.Sequence + 1
 
 	return st
 }
 
 // Finds the latest (current) serial in the aggregate state, and if none sets
-// it to the provided one.
+// it to the provided one.  The sequence of the aggregate is set to the
+// highest one merged, so that derived states come after all of them.
 func (ls *LocalState) UpdateSerialOr(serial uuid.UUID) error {
-	var latestID *objects.MAC = nil
+	var latestID objects.MAC
 	var latestMT *Metadata = nil
 
 	states, err := ls.cache.GetStates()
@@ -167,21 +205,98 @@ func (ls *LocalState) UpdateSerialOr(serial uuid.UUID) error {
 			return err
 		}
 
-		if latestID == nil || latestMT.Timestamp.Before(mt.Timestamp) {
-			latestID = &stateID
+		if latestMT == nil || mt.after(stateID, latestMT, latestID) {
+			latestID = stateID
 			latestMT = mt
 		}
 	}
 
 	if latestMT != nil {
 		ls.Metadata.Serial = latestMT.Serial
+		ls.Metadata.Sequence = latestMT.Sequence
 	} else {
 		ls.Metadata.Serial = serial
+		ls.Metadata.Sequence = 0
 	}
 
 	return nil
 }
 
+// ClockSkews returns the merged states whose timestamp is more than
+// tolerance ahead of now, or behind a state of a lower sequence, which
+// they could otherwise have shadowed or been shadowed by.
+func (ls *LocalState) ClockSkews(now time.Time, tolerance time.Duration) ([]ClockSkew, error) {
+	states, err := ls.cache.GetStates()
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		id objects.MAC
+		mt *Metadata
+	}
+	entries := make([]entry, 0)
+	for stateID, buf := range states {
+		mt, err := MetadataFromBytes(buf)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{id: stateID, mt: mt})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		if a.mt.after(a.id, b.mt, b.id) {
+			return 1
+		} else if b.mt.after(b.id, a.mt, a.id) {
+			return -1
+		}
+		return 0
+	})
+
+	skews := make([]ClockSkew, 0)
+	var latest time.Time
+	for i, e := range entries {
+		skew := ClockSkew{StateID: e.id, Timestamp: e.mt.Timestamp, Sequence: e.mt.Sequence}
+		if ahead := e.mt.Timestamp.Sub(now); ahead > tolerance {
+			skew.Skew = ahead
+			skews = append(skews, skew)
+		} else if behind := latest.Sub(e.mt.Timestamp); i != 0 && e.mt.Sequence != 0 && behind > tolerance {
+			skew.Skew = -behind
+			skews = append(skews, skew)
+		}
+		if e.mt.Timestamp.After(latest) {
+			latest = e.mt.Timestamp
+		}
+	}
+	return skews, nil
+}
+
+// Serials groups the merged states by the serial they were derived from.
+// More than one serial means that clients wrote concurrently from diverging
+// views of the repository.
+func (ls *LocalState) Serials() (map[uuid.UUID][]objects.MAC, error) {
+	states, err := ls.cache.GetStates()
+	if err != nil {
+		return nil, err
+	}
+
+	serials := make(map[uuid.UUID][]objects.MAC)
+	for stateID, buf := range states {
+		mt, err := MetadataFromBytes(buf)
+		if err != nil {
+			return nil, err
+		}
+		serials[mt.Serial] = append(serials[mt.Serial], stateID)
+	}
+
+	for _, stateIDs := range serials {
+		slices.SortFunc(stateIDs, func(a, b objects.MAC) int {
+			return bytes.Compare(a[:], b[:])
+		})
+	}
+
+	return serials, nil
+}
+
 /* Insert the state denotated by stateID and its associated delta entries read from rd */
 func (ls *LocalState) InsertState(version versioning.Version, stateID objects.MAC, rd io.Reader) error {
 	has, err := ls.HasState(stateID)
@@ -287,6 +402,18 @@ func (ls *LocalState) SerializeToStream(w io.Writer) error {
 		}
 	}
 
+	/* The sequence is an entry, not part of the metadata, so that older
+	 * versions skip it. */
+	if _, err := w.Write([]byte{byte(ET_SEQUENCE)}); err != nil {
+		return fmt.Errorf("failed to write sequence entry type: %w", err)
+	}
+	if err := writeUint32(8); err != nil {
+		return fmt.Errorf("failed to write sequence entry length: %w", err)
+	}
+	if err := writeUint64(ls.Metadata.Sequence); err != nil {
+		return fmt.Errorf("failed to write sequence: %w", err)
+	}
+
 	/* Finally we serialize the Metadata */
 	if _, err := w.Write([]byte{byte(ET_METADATA)}); err != nil {
 		return fmt.Errorf("failed to write metadata type %w", err)
@@ -502,6 +629,7 @@ func (ls *LocalState) deserializeFromStream(r io.Reader) error {
 	de_buf := make([]byte, DeltaEntrySerializedSize)
 	deleted_buf := make([]byte, DeletedEntrySerializedSize)
 	pe_buf := make([]byte, PackfileEntrySerializedSize)
+	ls.Metadata.Sequence = 0
 	for {
 		n, err := r.Read(et_buf)
 		if err != nil || n != len(et_buf) {
@@ -584,6 +712,16 @@ func (ls *LocalState) deserializeFromStream(r io.Reader) error {
 			if err != nil {
 				return fmt.Errorf("failed to insert/update configuration entry %w", err)
 			}
+		case ET_SEQUENCE:
+			if length != 8 {
+				return fmt.Errorf("failed to read sequence entry wrong length got(%d)/expected(%d)", length, 8)
+			}
+
+			sequence, err := readUint64()
+			if err != nil {
+				return fmt.Errorf("failed to read sequence %w", err)
+			}
+			ls.Metadata.Sequence = sequence
 		default:
 			// Our version doesn't know this entry type, just skip it.
 			io.CopyN(io.Discard, r, int64(length))
@@ -673,10 +811,24 @@ func (ls *LocalState) GetSubpartForBlob(Type resources.Type, blobMAC objects.MAC
 			return Location{}, false, err
 		}
 
-		if ok {
+		if !ok {
+			continue
+		}
+
+		// A repacked blob lives both in its original packfile, which is
+		// coloured for deletion, and in the new one: prefer the latter.
+		deleted, err := ls.cache.HasDeleted(resources.RT_PACKFILE, de.Location.Packfile)
+		if err != nil {
+			return Location{}, false, err
+		}
+
+		if !deleted {
 			delta = &de
 			break
 		}
+		if delta == nil {
+			delta = &de
+		}
 	}
 
 	if delta == nil {
@@ -710,10 +862,39 @@ func (ls *LocalState) ListPackfiles() iter.Seq[objects.MAC] {
 	}
 }
 
+// ListStatePackfiles returns the packfiles that were recorded by the given
+// state.
+func (ls *LocalState) ListStatePackfiles(stateID objects.MAC) iter.Seq2[objects.MAC, error] {
+	return func(yield func(objects.MAC, error) bool) {
+		for _, buf := range ls.cache.GetPackfiles() {
+			pe, err := PackfileEntryFromBytes(buf)
+			if err != nil {
+				if !yield(objects.MAC{}, err) {
+					return
+				}
+				continue
+			}
+
+			if pe.StateID != stateID {
+				continue
+			}
+
+			if !yield(pe.Packfile, nil) {
+				return
+			}
+		}
+	}
+}
+
 func (ls *LocalState) ListSnapshots() iter.Seq[objects.MAC] {
 	return func(yield func(objects.MAC) bool) {
+		// A repacked snapshot is found in two packfiles until the sweep.
+		seen := make(map[objects.MAC]struct{})
 		for _, buf := range ls.cache.GetDeltasByType(resources.RT_SNAPSHOT) {
 			de, _ := DeltaEntryFromBytes(buf)
+			if _, ok := seen[de.Blob]; ok {
+				continue
+			}
 
 			ok, err := ls.cache.HasPackfile(de.Location.Packfile)
 			if err != nil || !ok {
@@ -724,6 +905,7 @@ func (ls *LocalState) ListSnapshots() iter.Seq[objects.MAC] {
 				continue
 			}
 
+			seen[de.Blob] = struct{}{}
 			if !yield(de.Blob) {
 				return
 			}
@@ -731,6 +913,45 @@ func (ls *LocalState) ListSnapshots() iter.Seq[objects.MAC] {
 	}
 }
 
+// ListSnapshotTimestamps returns the snapshots along with the time the
+// packfile holding them was recorded.  A snapshot is always recorded after it
+// was started, so this is an upper bound of its header timestamp that can be
+// used to skip snapshots without loading them.
+func (ls *LocalState) ListSnapshotTimestamps() iter.Seq2[objects.MAC, time.Time] {
+	return func(yield func(objects.MAC, time.Time) bool) {
+		recorded := make(map[objects.MAC]time.Time)
+		for _, buf := range ls.cache.GetPackfiles() {
+			pe, err := PackfileEntryFromBytes(buf)
+			if err != nil {
+				continue
+			}
+			recorded[pe.Packfile] = pe.Timestamp
+		}
+
+		seen := make(map[objects.MAC]struct{})
+		for _, buf := range ls.cache.GetDeltasByType(resources.RT_SNAPSHOT) {
+			de, _ := DeltaEntryFromBytes(buf)
+			if _, ok := seen[de.Blob]; ok {
+				continue
+			}
+
+			timestamp, ok := recorded[de.Location.Packfile]
+			if !ok {
+				continue
+			}
+
+			if has, _ := ls.cache.HasDeleted(resources.RT_SNAPSHOT, de.Blob); has {
+				continue
+			}
+
+			seen[de.Blob] = struct{}{}
+			if !yield(de.Blob, timestamp) {
+				return
+			}
+		}
+	}
+}
+
 func (ls *LocalState) ListObjectsOfType(Type resources.Type) iter.Seq2[DeltaEntry, error] {
 	return func(yield func(DeltaEntry, error) bool) {
 		for _, buf := range ls.cache.GetDeltasByType(Type) {
@@ -759,6 +980,33 @@ func (ls *LocalState) ListObjectsOfType(Type resources.Type) iter.Seq2[DeltaEntr
 	}
 }
 
+// ListDeltas returns the delta entries whose packfile is part of the state.
+func (ls *LocalState) ListDeltas() iter.Seq2[DeltaEntry, error] {
+	return func(yield func(DeltaEntry, error) bool) {
+		for _, buf := range ls.cache.GetDeltas() {
+			de, err := DeltaEntryFromBytes(buf)
+			if err != nil {
+				if !yield(DeltaEntry{}, err) {
+					return
+				}
+				continue
+			}
+
+			ok, err := ls.cache.HasPackfile(de.Location.Packfile)
+			if err != nil {
+				if !yield(DeltaEntry{}, err) {
+					return
+				}
+				continue
+			}
+
+			if ok && !yield(de, nil) {
+				return
+			}
+		}
+	}
+}
+
 func (ls *LocalState) ListOrphanDeltas() iter.Seq2[DeltaEntry, error] {
 	return func(yield func(DeltaEntry, error) bool) {
 		for _, buf := range ls.cache.GetDeltas() {
@@ -822,13 +1070,17 @@ func (ls *LocalState) insertOrUpdateConfiguration(ce ConfigurationEntry) error {
 		return err
 	}
 
-	if err != nil && err == leveldb.ErrNotFound {
+	if err == nil && value != nil {
 		oldCe, err := ConfigurationEntryFromBytes(value)
 		if err != nil {
 			return err
 		}
 
-		if oldCe.CreatedAt.Before(ce.CreatedAt) {
+		// Entries are compared on their creation time then on their value,
+		// so that merging states yields the same configuration whatever
+		// the order they are merged in.
+		if ce.CreatedAt.After(oldCe.CreatedAt) ||
+			(ce.CreatedAt.Equal(oldCe.CreatedAt) && bytes.Compare(ce.Value, oldCe.Value) > 0) {
 			if err := ls.cache.PutConfiguration(ce.Key, ce.ToBytes()); err != nil {
 				return err
 			}
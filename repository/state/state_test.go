@@ -0,0 +1,156 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func newCache(t *testing.T, id byte) caching.StateCache {
+	manager := caching.NewManager(t.TempDir())
+	t.Cleanup(func() { manager.Close() })
+
+	cache, err := manager.Scan(objects.MAC{id})
+	require.NoError(t, err)
+	return cache
+}
+
+// newAggregate returns an empty aggregate state, backed by a repository
+// cache as only those keep track of the merged states.
+func newAggregate(t *testing.T) *LocalState {
+	manager := caching.NewManager(t.TempDir())
+	t.Cleanup(func() { manager.Close() })
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	return NewLocalState(cache)
+}
+
+// push serializes a state derived from the aggregate, dated at, and
+// merges it back as stateID.
+func push(t *testing.T, aggregate *LocalState, stateID byte, at time.Time) {
+	delta := aggregate.Derive(newCache(t, stateID))
+	delta.Metadata.Timestamp = at
+
+	var buf bytes.Buffer
+	require.NoError(t, delta.SerializeToStream(&buf))
+	require.NoError(t, aggregate.InsertState(delta.Metadata.Version, objects.MAC{stateID}, &buf))
+	require.NoError(t, aggregate.UpdateSerialOr(uuid.New()))
+}
+
+func TestStateSequence(t *testing.T) {
+	aggregate := newAggregate(t)
+	repositoryID := uuid.New()
+	require.NoError(t, aggregate.UpdateSerialOr(repositoryID))
+	require.Equal(t, repositoryID, aggregate.Metadata.Serial)
+	require.Equal(t, uint64(0), aggregate.Metadata.Sequence)
+
+	now := time.Now()
+	push(t, aggregate, 1, now)
+	require.Equal(t, uint64(1), aggregate.Metadata.Sequence)
+
+	// a client whose clock is an hour late still comes after
+	aggregate.Metadata.Serial = uuid.New()
+	serial := aggregate.Metadata.Serial
+	push(t, aggregate, 2, now.Add(-time.Hour))
+	require.Equal(t, uint64(2), aggregate.Metadata.Sequence)
+	require.Equal(t, serial, aggregate.Metadata.Serial)
+
+	skews, err := aggregate.ClockSkews(now, CLOCK_SKEW_TOLERANCE)
+	require.NoError(t, err)
+	require.Len(t, skews, 1)
+	require.Equal(t, objects.MAC{2}, skews[0].StateID)
+	require.Equal(t, -time.Hour, skews[0].Skew)
+
+	// as does a state dated in the future, which is reported as well
+	push(t, aggregate, 3, now.Add(time.Hour))
+	require.Equal(t, uint64(3), aggregate.Metadata.Sequence)
+	skews, err = aggregate.ClockSkews(now, CLOCK_SKEW_TOLERANCE)
+	require.NoError(t, err)
+	require.Len(t, skews, 2)
+	require.Equal(t, objects.MAC{3}, skews[1].StateID)
+	require.Equal(t, time.Hour, skews[1].Skew)
+}
+
+func TestStateSequenceLegacy(t *testing.T) {
+	aggregate := newAggregate(t)
+	require.NoError(t, aggregate.UpdateSerialOr(uuid.New()))
+
+	// states written before sequences were introduced are ordered by
+	// timestamp, and come before any state with a sequence
+	now := time.Now()
+	for i, at := range []time.Time{now, now.Add(-time.Hour)} {
+		mt := Metadata{Version: aggregate.Metadata.Version, Timestamp: at, Serial: uuid.New()}
+		data, err := mt.ToBytes()
+		require.NoError(t, err)
+		require.NoError(t, aggregate.cache.PutState(objects.MAC{byte(10 + i)}, data))
+	}
+	require.NoError(t, aggregate.UpdateSerialOr(uuid.New()))
+	latest, err := aggregate.cache.GetState(objects.MAC{10})
+	require.NoError(t, err)
+	mt, err := MetadataFromBytes(latest)
+	require.NoError(t, err)
+	require.Equal(t, mt.Serial, aggregate.Metadata.Serial)
+	require.Equal(t, uint64(0), aggregate.Metadata.Sequence)
+
+	skews, err := aggregate.ClockSkews(now, CLOCK_SKEW_TOLERANCE)
+	require.NoError(t, err)
+	require.Empty(t, skews)
+
+	push(t, aggregate, 1, now.Add(-2*time.Hour))
+	require.Equal(t, uint64(1), aggregate.Metadata.Sequence)
+}
+
+func TestSerials(t *testing.T) {
+	aggregate := newAggregate(t)
+	require.NoError(t, aggregate.UpdateSerialOr(uuid.New()))
+	first := aggregate.Metadata.Serial
+
+	now := time.Now()
+	push(t, aggregate, 1, now)
+	push(t, aggregate, 2, now.Add(time.Second))
+
+	serials, err := aggregate.Serials()
+	require.NoError(t, err)
+	require.Len(t, serials, 1)
+	require.Equal(t, []objects.MAC{{1}, {2}}, serials[first])
+
+	// a client which compacted the states writes from a new serial
+	aggregate.Metadata.Serial = uuid.New()
+	second := aggregate.Metadata.Serial
+	push(t, aggregate, 3, now.Add(2*time.Second))
+
+	serials, err = aggregate.Serials()
+	require.NoError(t, err)
+	require.Len(t, serials, 2)
+	require.Equal(t, []objects.MAC{{1}, {2}}, serials[first])
+	require.Equal(t, []objects.MAC{{3}}, serials[second])
+	require.Equal(t, second, aggregate.Metadata.Serial)
+}
+
+func TestUpdateSerialOrTie(t *testing.T) {
+	// clients merging the same states agree on the serial, whatever the
+	// order they merged them in
+	at := time.Now()
+	serials := []uuid.UUID{uuid.New(), uuid.New()}
+
+	var agreed []uuid.UUID
+	for _, order := range [][]int{{0, 1}, {1, 0}} {
+		aggregate := newAggregate(t)
+		for _, i := range order {
+			mt := Metadata{Version: aggregate.Metadata.Version, Timestamp: at, Serial: serials[i]}
+			data, err := mt.ToBytes()
+			require.NoError(t, err)
+			require.NoError(t, aggregate.cache.PutState(objects.MAC{byte(10 + i)}, data))
+		}
+		require.NoError(t, aggregate.UpdateSerialOr(uuid.New()))
+		agreed = append(agreed, aggregate.Metadata.Serial)
+	}
+	require.Equal(t, agreed[0], agreed[1])
+	require.Equal(t, serials[1], agreed[0])
+}
@@ -24,7 +24,7 @@ func NewRepositoryStore[K, V any](repo *Repository, blobtype resources.Type) *Re
 }
 
 func (rs *RepositoryStore[K, V]) Get(sum objects.MAC) (*btree.Node[K, objects.MAC, V], error) {
-	rd, err := rs.repo.GetBlob(rs.blobtype, sum)
+	rd, err := rs.repo.GetCachedBlob(rs.blobtype, sum)
 	if err != nil {
 		return nil, err
 	}
@@ -22,6 +22,10 @@ const (
 	RT_XATTR_ENTRY Type = 18
 	RT_BTREE_ROOT  Type = 19
 	RT_BTREE_NODE  Type = 20
+	RT_TIMESTAMP   Type = 21
+	RT_CHUNK_DELTA Type = 22
+	RT_PROFILE     Type = 23
+	RT_TEXT_INDEX  Type = 24
 )
 
 func Types() []Type {
@@ -45,6 +49,10 @@ func Types() []Type {
 		RT_XATTR_ENTRY,
 		RT_BTREE_ROOT,
 		RT_BTREE_NODE,
+		RT_TIMESTAMP,
+		RT_CHUNK_DELTA,
+		RT_PROFILE,
+		RT_TEXT_INDEX,
 	}
 }
 
@@ -88,6 +96,14 @@ func (r Type) String() string {
 		return "btree root"
 	case RT_BTREE_NODE:
 		return "btree node"
+	case RT_TIMESTAMP:
+		return "timestamp"
+	case RT_CHUNK_DELTA:
+		return "chunk delta"
+	case RT_PROFILE:
+		return "profile"
+	case RT_TEXT_INDEX:
+		return "text index"
 	default:
 		return "unknown"
 	}
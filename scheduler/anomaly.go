@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Baseline keeps a running average of what a normal backup run looks like
+// for a given source.  Anomalous runs are never folded into the baseline,
+// so that an ongoing attack does not become the new normal.
+type Baseline struct {
+	Runs           uint64  `msgpack:"runs"`
+	ChangedRatio   float64 `msgpack:"changed_ratio"`
+	ChangedSize    float64 `msgpack:"changed_size"`
+	HiEntropyRatio float64 `msgpack:"hi_entropy_ratio"`
+}
+
+// baselineWeight is the weight given to the latest run when updating the
+// moving averages of a baseline.
+const baselineWeight = 0.2
+
+func changedRatio(delta events.Delta) float64 {
+	if delta.Files == 0 {
+		return 0
+	}
+	return float64(delta.ChangedFiles) / float64(delta.Files)
+}
+
+func hiEntropyRatio(delta events.Delta) float64 {
+	if delta.ChangedFiles == 0 {
+		return 0
+	}
+	return float64(delta.HiEntropyFiles) / float64(delta.ChangedFiles)
+}
+
+// Check compares a backup run to the baseline and returns a description of
+// every deviation found.  No deviation is reported until the baseline was
+// built from at least config.MinRuns runs.
+func (b *Baseline) Check(config *AnomalyConfig, delta events.Delta) []string {
+	if b.Runs < config.MinRuns {
+		return nil
+	}
+
+	reasons := []string{}
+
+	changed := changedRatio(delta)
+	hiEntropy := hiEntropyRatio(delta)
+
+	if changed >= config.ChangedRatio && hiEntropy >= config.EntropyRatio {
+		reasons = append(reasons, fmt.Sprintf("%.0f%% of files rewritten, %.0f%% of them with high entropy",
+			changed*100, hiEntropy*100))
+	} else {
+		if changed >= config.ChangedRatio && changed > b.ChangedRatio*config.Factor {
+			reasons = append(reasons, fmt.Sprintf("%.0f%% of files changed (baseline: %.0f%%)",
+				changed*100, b.ChangedRatio*100))
+		}
+		if hiEntropy >= config.EntropyRatio && hiEntropy > b.HiEntropyRatio*config.Factor {
+			reasons = append(reasons, fmt.Sprintf("%.0f%% of changed files with high entropy (baseline: %.0f%%)",
+				hiEntropy*100, b.HiEntropyRatio*100))
+		}
+	}
+
+	if b.ChangedSize > 0 && float64(delta.ChangedSize) > b.ChangedSize*config.Factor {
+		reasons = append(reasons, fmt.Sprintf("%d bytes changed (baseline: %.0f bytes)",
+			delta.ChangedSize, b.ChangedSize))
+	}
+
+	return reasons
+}
+
+// Update folds a backup run into the baseline.
+func (b *Baseline) Update(delta events.Delta) {
+	if b.Runs == 0 {
+		b.ChangedRatio = changedRatio(delta)
+		b.ChangedSize = float64(delta.ChangedSize)
+		b.HiEntropyRatio = hiEntropyRatio(delta)
+	} else {
+		b.ChangedRatio += baselineWeight * (changedRatio(delta) - b.ChangedRatio)
+		b.ChangedSize += baselineWeight * (float64(delta.ChangedSize) - b.ChangedSize)
+		b.HiEntropyRatio += baselineWeight * (hiEntropyRatio(delta) - b.HiEntropyRatio)
+	}
+	b.Runs++
+}
+
+// anomalyDetector tracks the baselines of the sources backed up by the
+// agent.  With a cache, baselines and paused retentions outlive the agent,
+// otherwise they are only kept in memory.
+type anomalyDetector struct {
+	mu        sync.Mutex
+	cache     *caching.AnomalyCache
+	baselines map[string]*Baseline
+	paused    map[string]bool
+}
+
+func newAnomalyDetector(cache *caching.AnomalyCache) *anomalyDetector {
+	return &anomalyDetector{
+		cache:     cache,
+		baselines: make(map[string]*Baseline),
+		paused:    make(map[string]bool),
+	}
+}
+
+func (ad *anomalyDetector) baseline(source string) (*Baseline, error) {
+	if baseline, exists := ad.baselines[source]; exists {
+		return baseline, nil
+	}
+
+	baseline := &Baseline{}
+	if ad.cache != nil {
+		data, err := ad.cache.GetBaseline(source)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			if err := msgpack.Unmarshal(data, baseline); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ad.baselines[source] = baseline
+	return baseline, nil
+}
+
+// observe checks a backup run of source against its baseline, updating the
+// baseline if the run looks normal.  It returns the deviations found.
+func (ad *anomalyDetector) observe(source string, config *AnomalyConfig, delta events.Delta) ([]string, error) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	baseline, err := ad.baseline(source)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons := baseline.Check(config, delta)
+	if len(reasons) != 0 {
+		if config.PauseRetention {
+			ad.paused[source] = true
+			if ad.cache != nil {
+				if err := ad.cache.PutPaused(source); err != nil {
+					return reasons, err
+				}
+			}
+		}
+		return reasons, nil
+	}
+
+	baseline.Update(delta)
+	if ad.cache != nil {
+		data, err := msgpack.Marshal(baseline)
+		if err != nil {
+			return nil, err
+		}
+		if err := ad.cache.PutBaseline(source, data); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// retentionPaused returns true if retention was paused for source following
+// an anomaly.  It stays paused until resumed with ResumeRetention.
+func (ad *anomalyDetector) retentionPaused(source string) (bool, error) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	if ad.paused[source] {
+		return true, nil
+	}
+	if ad.cache == nil {
+		return false, nil
+	}
+
+	paused, err := ad.cache.HasPaused(source)
+	if err != nil {
+		return false, err
+	}
+	ad.paused[source] = paused
+	return paused, nil
+}
+
+// ResumeRetention resumes the retention of source once its anomaly was
+// acknowledged.  It returns false if the retention was not paused.
+func (s *Scheduler) ResumeRetention(source string) (bool, error) {
+	return s.anomalies.resumeRetention(source)
+}
+
+func (ad *anomalyDetector) resumeRetention(source string) (bool, error) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	paused := ad.paused[source]
+	delete(ad.paused, source)
+	if ad.cache == nil {
+		return paused, nil
+	}
+
+	if !paused {
+		var err error
+		if paused, err = ad.cache.HasPaused(source); err != nil {
+			return false, err
+		}
+	}
+	if err := ad.cache.DelPaused(source); err != nil {
+		return false, err
+	}
+	return paused, nil
+}
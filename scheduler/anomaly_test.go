@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/events"
+)
+
+func TestBaselineCheck(t *testing.T) {
+	config := &AnomalyConfig{}
+	config.setDefaults()
+
+	normal := events.Delta{Files: 1000, ChangedFiles: 20, ChangedSize: 1 << 20, HiEntropyFiles: 1}
+
+	baseline := &Baseline{}
+	for i := uint64(0); i < config.MinRuns; i++ {
+		if reasons := baseline.Check(config, normal); len(reasons) != 0 {
+			t.Fatalf("unexpected anomaly while building baseline: %v", reasons)
+		}
+		baseline.Update(normal)
+	}
+
+	if reasons := baseline.Check(config, normal); len(reasons) != 0 {
+		t.Errorf("unexpected anomaly on a normal run: %v", reasons)
+	}
+
+	ransomware := events.Delta{Files: 1000, ChangedFiles: 800, ChangedSize: 1 << 20, HiEntropyFiles: 780}
+	if reasons := baseline.Check(config, ransomware); len(reasons) == 0 {
+		t.Errorf("expected an anomaly when most files are rewritten with high entropy")
+	}
+
+	growth := events.Delta{Files: 1000, ChangedFiles: 20, ChangedSize: 100 << 20, HiEntropyFiles: 1}
+	if reasons := baseline.Check(config, growth); len(reasons) == 0 {
+		t.Errorf("expected an anomaly when changed size deviates from the baseline")
+	}
+}
+
+func TestAnomalyDetectorPauseRetention(t *testing.T) {
+	config := &AnomalyConfig{PauseRetention: true}
+	config.setDefaults()
+
+	detector := newAnomalyDetector(nil)
+	normal := events.Delta{Files: 100, ChangedFiles: 1, ChangedSize: 100}
+	for i := uint64(0); i < config.MinRuns; i++ {
+		if _, err := detector.observe("system:/etc", config, normal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if paused, _ := detector.retentionPaused("system:/etc"); paused {
+		t.Fatalf("retention should not be paused")
+	}
+
+	reasons, err := detector.observe("system:/etc", config, events.Delta{Files: 100, ChangedFiles: 90, ChangedSize: 100, HiEntropyFiles: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) == 0 {
+		t.Fatalf("expected an anomaly")
+	}
+	if paused, _ := detector.retentionPaused("system:/etc"); !paused {
+		t.Errorf("retention should be paused after an anomaly")
+	}
+	if paused, _ := detector.retentionPaused("other:/"); paused {
+		t.Errorf("retention should only be paused for the affected source")
+	}
+}
+
+func TestAnomalyDetectorCache(t *testing.T) {
+	config := &AnomalyConfig{PauseRetention: true}
+	config.setDefaults()
+
+	cacheDir := t.TempDir()
+	open := func() (*caching.Manager, *anomalyDetector) {
+		manager := caching.NewManager(cacheDir)
+		cache, err := manager.Anomaly()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return manager, newAnomalyDetector(cache)
+	}
+
+	manager, detector := open()
+	normal := events.Delta{Files: 100, ChangedFiles: 1, ChangedSize: 100}
+	for i := uint64(0); i < config.MinRuns; i++ {
+		if _, err := detector.observe("system:/etc", config, normal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manager.Close()
+
+	// the baseline survives a restart of the agent, so does an anomaly
+	manager, detector = open()
+	ransomware := events.Delta{Files: 100, ChangedFiles: 90, ChangedSize: 100, HiEntropyFiles: 90}
+	reasons, err := detector.observe("system:/etc", config, ransomware)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) == 0 {
+		t.Fatalf("expected an anomaly against the cached baseline")
+	}
+	manager.Close()
+
+	manager, detector = open()
+	if paused, err := detector.retentionPaused("system:/etc"); err != nil {
+		t.Fatal(err)
+	} else if !paused {
+		t.Errorf("retention should stay paused across restarts")
+	}
+	if paused, err := detector.retentionPaused("other:/"); err != nil {
+		t.Fatal(err)
+	} else if paused {
+		t.Errorf("retention should only be paused for the affected source")
+	}
+
+	// once acknowledged, retention resumes for good
+	if resumed, err := detector.resumeRetention("system:/etc"); err != nil {
+		t.Fatal(err)
+	} else if !resumed {
+		t.Errorf("retention should have been resumed")
+	}
+	if resumed, err := detector.resumeRetention("other:/"); err != nil {
+		t.Fatal(err)
+	} else if resumed {
+		t.Errorf("retention of a source that was not paused should not be resumed")
+	}
+	manager.Close()
+
+	manager, detector = open()
+	defer manager.Close()
+	if paused, err := detector.retentionPaused("system:/etc"); err != nil {
+		t.Fatal(err)
+	} else if paused {
+		t.Errorf("retention should stay resumed across restarts")
+	}
+}
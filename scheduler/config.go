@@ -25,6 +25,37 @@ type AgentConfig struct {
 	Alerting    *AlertingConfig
 	Maintenance []MaintenanceConfig `validate:"dive"`
 	Tasks       []Task              `mapstructure:"tasks" validate:"dive"`
+	Windows     []WindowConfig      `validate:"dive"`
+	// Maximum number of tasks running at once against a repository,
+	// defaults to 1.
+	MaxJobs int            `mapstructure:"max_jobs" validate:"gte=0"`
+	Digests []DigestConfig `validate:"dive"`
+}
+
+// DigestConfig has the agent periodically email a summary of the activity
+// of the repositories it manages.
+type DigestConfig struct {
+	// Name of the alerting email configuration the digest is sent with.
+	Email  string `validate:"required"`
+	Period string `validate:"required,oneof=daily weekly"`
+}
+
+// WindowConfig restricts when and how fast the agent may use a repository.
+// Windows are written "[DAYS ]HH:MM-HH:MM", e.g. "mon-fri 08:00-18:00", and
+// apply to all the tasks targeting the repository.
+type WindowConfig struct {
+	// Location of the repository the windows apply to.
+	Repository string `validate:"required"`
+	// No task starts during a blackout window.
+	Blackout []string
+	// Bandwidth profiles, the first one matching the current time wins.
+	Bandwidth []BandwidthConfig `validate:"dive"`
+}
+
+type BandwidthConfig struct {
+	Hours string `validate:"required"`
+	// Maximum transfer rate, e.g. "1MB" or "1MB/s".
+	Rate string `validate:"required"`
 }
 
 type AlertingConfig struct {
@@ -53,6 +84,7 @@ type Task struct {
 	Check   []CheckConfig   `validate:"dive"`
 	Restore []RestoreConfig `validate:"dive"`
 	Sync    []SyncConfig    `validate:"dive"`
+	Drill   []DrillConfig   `validate:"dive"`
 }
 
 type BackupConfig struct {
@@ -62,6 +94,44 @@ type BackupConfig struct {
 	Interval  string `validate:"required"`
 	Check     BackupConfigCheck
 	Retention string
+	Anomaly   *AnomalyConfig
+	// URL of an RFC3161 timestamping authority snapshots are submitted to.
+	Timestamp string
+	// Namespace the snapshots belong to.
+	Namespace string
+	// Clones of the repository snapshots are replicated to once committed.
+	Replicate []string
+	// Maximum age of the latest snapshot before the job is reported as
+	// overdue, e.g. "24h".
+	Expect string
+	Ping   *PingConfig
+}
+
+// PingConfig sets the healthchecks.io style URLs notified after each run
+// of a job.
+type PingConfig struct {
+	// URL receiving a POST after each successful run.
+	URL string `validate:"required,url"`
+	// URL receiving a POST after each failed run, defaults to URL/fail.
+	FailureURL string `mapstructure:"failure_url" validate:"omitempty,url"`
+	// Also POST to URL/start when a run begins.
+	Start bool
+}
+
+// AnomalyConfig enables the tracking of a per-source baseline and the
+// raising of an alert when a backup run deviates wildly from it.
+type AnomalyConfig struct {
+	// Number of runs required to build a baseline before alerting.
+	MinRuns uint64 `mapstructure:"min_runs"`
+	// Ratio of changed files, above which a run is suspicious.
+	ChangedRatio float64 `mapstructure:"changed_ratio" validate:"gte=0,lte=1"`
+	// Ratio of high-entropy files among changed files, above which a run
+	// is suspicious.
+	EntropyRatio float64 `mapstructure:"entropy_ratio" validate:"gte=0,lte=1"`
+	// How many times the baseline a value must be to be considered a deviation.
+	Factor float64 `validate:"gte=0"`
+	// Stop applying retention to the source once an anomaly was detected.
+	PauseRetention bool `mapstructure:"pause_retention"`
 }
 
 // CheckDecodeHook is a mapstructure decode hook to allow users to specify
@@ -96,12 +166,33 @@ type CheckConfig struct {
 	Before   string
 	Interval string `validate:"required"`
 	Latest   bool
+	Ping     *PingConfig
 }
 
 type RestoreConfig struct {
 	Path     string `validate:"required"`
 	Target   string `validate:"required"`
 	Interval string `validate:"required"`
+	Ping     *PingConfig
+}
+
+// DrillConfig periodically restores files of the latest snapshot of the
+// task into a scratch directory and verifies them, to prove the backups
+// can be restored.
+type DrillConfig struct {
+	Interval string `validate:"required"`
+	// Paths always restored, the files below them for directories.
+	Critical []string
+	// Number of files picked at random, defaults to 10 without critical
+	// paths.
+	Sample int `validate:"gte=0"`
+	// Directory the scratch directories are created in, defaults to the
+	// system temporary directory.
+	Scratch string
+	// Directory the reports of the drills are written to, defaults to
+	// the drills directory of the cache.
+	Reports string
+	Ping    *PingConfig
 }
 
 type SyncDirection string
@@ -140,12 +231,41 @@ type SyncConfig struct {
 	Peer      string        `validate:"required"`
 	Direction SyncDirection `validate:"required"`
 	Interval  string        `validate:"required"`
+	Ping      *PingConfig
 }
 
 type MaintenanceConfig struct {
 	Interval   string `validate:"required"`
 	Retention  string `validate:"required"`
 	Repository RepositoryConfig
+	Ping       *PingConfig
+}
+
+func (a *AnomalyConfig) setDefaults() {
+	if a.MinRuns == 0 {
+		a.MinRuns = 3
+	}
+	if a.ChangedRatio == 0 {
+		a.ChangedRatio = 0.5
+	}
+	if a.EntropyRatio == 0 {
+		a.EntropyRatio = 0.5
+	}
+	if a.Factor == 0 {
+		a.Factor = 4
+	}
+}
+
+func (a *AgentConfig) emailConfig(name string) *EmailConfig {
+	if a.Alerting == nil {
+		return nil
+	}
+	for i := range a.Alerting.Email {
+		if a.Alerting.Email[i].Name == name {
+			return &a.Alerting.Email[i]
+		}
+	}
+	return nil
 }
 
 func NewConfiguration() *Configuration {
@@ -183,8 +303,11 @@ func ParseConfigFile(filename string) (*Configuration, error) {
 		return nil, fmt.Errorf("decoding config: %w", err)
 	}
 
-	// Set default values for SyncConfig.Direction.
+	// Set default values for SyncConfig.Direction and AnomalyConfig.
 	for i := range config.Agent.Tasks {
+		if backup := config.Agent.Tasks[i].Backup; backup != nil && backup.Anomaly != nil {
+			backup.Anomaly.setDefaults()
+		}
 		for j := range config.Agent.Tasks[i].Sync {
 			if config.Agent.Tasks[i].Sync[j].Direction == "" {
 				config.Agent.Tasks[i].Sync[j].Direction = SyncDirectionTo
@@ -196,8 +319,8 @@ func ParseConfigFile(filename string) (*Configuration, error) {
 
 	validate.RegisterStructValidation(func(sl validator.StructLevel) {
 		obj := sl.Current().Interface().(Task)
-		if obj.Backup == nil && len(obj.Check) == 0 && len(obj.Restore) == 0 && len(obj.Sync) == 0 {
-			sl.ReportError(obj, "Task", "Task", "atleastone", "at least one of Backup, Check, Restore, or Sync must be set")
+		if obj.Backup == nil && len(obj.Check) == 0 && len(obj.Restore) == 0 && len(obj.Sync) == 0 && len(obj.Drill) == 0 {
+			sl.ReportError(obj, "Task", "Task", "atleastone", "at least one of Backup, Check, Restore, Sync, or Drill must be set")
 		}
 	}, Task{})
 
@@ -205,5 +328,22 @@ func ParseConfigFile(filename string) (*Configuration, error) {
 		return nil, fmt.Errorf("validating config: %w", err)
 	}
 
+	for _, digest := range config.Agent.Digests {
+		if config.Agent.emailConfig(digest.Email) == nil {
+			return nil, fmt.Errorf("validating config: digest refers to unknown email %q", digest.Email)
+		}
+	}
+
+	seen := make(map[string]struct{})
+	for _, window := range config.Agent.Windows {
+		if _, ok := seen[window.Repository]; ok {
+			return nil, fmt.Errorf("validating config: windows defined twice for repository %s", window.Repository)
+		}
+		seen[window.Repository] = struct{}{}
+		if _, err := newRepositoryWindows(window); err != nil {
+			return nil, fmt.Errorf("validating config: repository %s: %w", window.Repository, err)
+		}
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, spec := range []string{"0 2 * * *", "*/15 8-18 * * mon-fri", "0 0 1,15 jan-jun *", "@daily", "30 4 * * 7"} {
+		if _, err := ParseCron(spec); err != nil {
+			t.Errorf("%q: unexpected error: %s", spec, err)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	cron, err := ParseCron("*/15 8-18 * * mon-fri")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2026-10-16 is a friday
+	if !cron.Match(time.Date(2026, 10, 16, 8, 45, 0, 0, time.UTC)) {
+		t.Error("expected a match on friday 08:45")
+	}
+	if cron.Match(time.Date(2026, 10, 16, 8, 50, 0, 0, time.UTC)) {
+		t.Error("unexpected match on friday 08:50")
+	}
+	if cron.Match(time.Date(2026, 10, 17, 8, 45, 0, 0, time.UTC)) {
+		t.Error("unexpected match on saturday")
+	}
+
+	// restricted days of month and week match if either does
+	cron, err = ParseCron("0 0 1 * sun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cron.Match(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected a match on the first of the month")
+	}
+	if !cron.Match(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected a match on sunday")
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	cron, err := ParseCron("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	if next := cron.Next(now); !next.Equal(time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next run %s", next)
+	}
+
+	cron, err = ParseCron("@yearly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := cron.Next(now); !next.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next run %s", next)
+	}
+
+	cron, err = ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := cron.Next(now); !next.IsZero() {
+		t.Errorf("unexpected next run %s", next)
+	}
+}
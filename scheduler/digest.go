@@ -0,0 +1,315 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+// RepositoryDigest summarizes the activity of a repository over a digest
+// period.
+type RepositoryDigest struct {
+	Location string
+	// Snapshots created during the period.
+	Snapshots int
+	// Logical size of the snapshots held at the end and at the start of
+	// the period.
+	Size         uint64
+	PreviousSize uint64
+	// Snapshots the retention policies will delete during the next period.
+	Expiring int
+	// Error is set if the repository could not be inspected.
+	Error string
+}
+
+// Growth returns the size difference over the period, formatted for humans.
+func (r RepositoryDigest) Growth() string {
+	if r.Size >= r.PreviousSize {
+		return "+" + humanize.Bytes(r.Size-r.PreviousSize)
+	}
+	return "-" + humanize.Bytes(r.PreviousSize-r.Size)
+}
+
+// Digest is the periodic report emailed by the agent.
+type Digest struct {
+	Period       string
+	Since        time.Time
+	Until        time.Time
+	Repositories []RepositoryDigest
+	Failures     []JobFailure
+}
+
+func digestPeriod(period string) time.Duration {
+	if period == "weekly" {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+var digestFuncs = map[string]any{
+	"bytes": humanize.Bytes,
+	"date": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}
+
+const digestText = `Plakar {{.Period}} digest, {{date .Since}} to {{date .Until}}
+{{range .Repositories}}
+Repository {{.Location}}
+{{- if .Error}}
+  error: {{.Error}}
+{{- else}}
+  snapshots created: {{.Snapshots}}
+  size: {{bytes .Size}} ({{.Growth}})
+  expiring next period: {{.Expiring}}
+{{- end}}
+{{end}}
+{{- if .Failures}}
+Failed jobs:
+{{- range .Failures}}
+  {{date .Finished}} {{.Task}} {{.Name}} on {{.Repository}}: {{.Error}}
+{{- end}}
+{{else}}
+No failed jobs.
+{{end}}`
+
+const digestHTML = `<html><body>
+<h2>Plakar {{.Period}} digest</h2>
+<p>{{date .Since}} to {{date .Until}}</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Repository</th><th>Snapshots created</th><th>Size</th><th>Growth</th><th>Expiring next period</th></tr>
+{{- range .Repositories}}
+{{- if .Error}}
+<tr><td>{{.Location}}</td><td colspan="4">error: {{.Error}}</td></tr>
+{{- else}}
+<tr><td>{{.Location}}</td><td>{{.Snapshots}}</td><td>{{bytes .Size}}</td><td>{{.Growth}}</td><td>{{.Expiring}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+{{- if .Failures}}
+<h3>Failed jobs</h3>
+<ul>
+{{- range .Failures}}
+<li>{{date .Finished}} {{.Task}} {{.Name}} on {{.Repository}}: {{.Error}}</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>No failed jobs.</p>
+{{- end}}
+</body></html>
+`
+
+var (
+	digestTextTemplate = template.Must(template.New("digest").Funcs(digestFuncs).Parse(digestText))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Funcs(digestFuncs).Parse(digestHTML))
+)
+
+func (d *Digest) Text() (string, error) {
+	var buf bytes.Buffer
+	if err := digestTextTemplate.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (d *Digest) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := digestHTMLTemplate.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Message returns the digest as a multipart/alternative email.
+func (d *Digest) Message(from string, to []string) ([]byte, error) {
+	text, err := d.Text()
+	if err != nil {
+		return nil, err
+	}
+	html, err := d.HTML()
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: Plakar %s digest for %s\r\n", d.Period, d.Until.Format(time.DateOnly))
+	fmt.Fprintf(&msg, "Date: %s\r\n", d.Until.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func sendEmail(config *EmailConfig, msg []byte) error {
+	addr := net.JoinHostPort(config.Smtp.Host, fmt.Sprint(config.Smtp.Port))
+
+	var auth smtp.Auth
+	if config.Smtp.Username != "" {
+		auth = smtp.PlainAuth("", config.Smtp.Username, config.Smtp.Password, config.Smtp.Host)
+	}
+	return smtp.SendMail(addr, auth, config.Sender, config.Recipients, msg)
+}
+
+// inspectRepository fills the snapshot statistics of a repository digest.
+// retentions maps the backup jobs targeting the repository to their
+// retention.
+func inspectRepository(repo *repository.Repository, digest *RepositoryDigest, since, until time.Time, period time.Duration, retentions map[string]time.Duration) error {
+	snapshotIDs, err := utils.LocateSnapshotIDs(repo, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return err
+		}
+		header := snap.Header
+		snap.Close()
+
+		size := header.GetSource(0).Summary.Directory.Size + header.GetSource(0).Summary.Below.Size
+		digest.Size += size
+		if header.Timestamp.Before(since) {
+			digest.PreviousSize += size
+		} else if !header.Timestamp.After(until) {
+			digest.Snapshots++
+		}
+
+		if retention, ok := retentions[header.Job]; ok {
+			if header.Timestamp.Before(until.Add(period - retention)) {
+				digest.Expiring++
+			}
+		}
+	}
+	return nil
+}
+
+// buildDigest inspects every repository the agent manages.
+func (s *Scheduler) buildDigest(period string, until time.Time) *Digest {
+	duration := digestPeriod(period)
+	since := until.Add(-duration)
+
+	retentions := make(map[string]map[string]time.Duration)
+	addRepository := func(location string) {
+		if _, ok := retentions[location]; !ok {
+			retentions[location] = make(map[string]time.Duration)
+		}
+	}
+	for _, task := range s.config.Agent.Tasks {
+		location := task.Repository.Location
+		addRepository(location)
+		if task.Backup != nil && task.Backup.Retention != "" {
+			if retention, err := stringToDuration(task.Backup.Retention); err == nil {
+				retentions[location][task.Name] = retention
+			}
+		}
+	}
+	for _, maintenance := range s.config.Agent.Maintenance {
+		addRepository(maintenance.Repository.Location)
+	}
+
+	locations := make([]string, 0, len(retentions))
+	for location := range retentions {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+
+	digest := &Digest{
+		Period:   period,
+		Since:    since,
+		Until:    until,
+		Failures: s.Failures(since),
+	}
+	for _, location := range locations {
+		repoDigest := RepositoryDigest{Location: location}
+		if err := s.inspectLocation(location, &repoDigest, since, until, duration, retentions[location]); err != nil {
+			repoDigest.Error = err.Error()
+		}
+		digest.Repositories = append(digest.Repositories, repoDigest)
+	}
+	return digest
+}
+
+func (s *Scheduler) inspectLocation(location string, digest *RepositoryDigest, since, until time.Time, period time.Duration, retentions map[string]time.Duration) error {
+	store, config, err := s.openStore(location)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	newCtx := appcontext.NewAppContextFrom(s.ctx)
+	defer newCtx.Close()
+
+	repo, err := repository.New(newCtx, store, config)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	return inspectRepository(repo, digest, since, until, period, retentions)
+}
+
+func (s *Scheduler) digestTask(config DigestConfig) error {
+	emailConfig := s.config.Agent.emailConfig(config.Email)
+	if emailConfig == nil {
+		return fmt.Errorf("unknown email %q", config.Email)
+	}
+	period := digestPeriod(config.Period)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			time.Sleep(period)
+
+			digest := s.buildDigest(config.Period, time.Now())
+			msg, err := digest.Message(emailConfig.Sender, emailConfig.Recipients)
+			if err != nil {
+				s.ctx.GetLogger().Error("digest: %s", err)
+				continue
+			}
+			if err := sendEmail(emailConfig, msg); err != nil {
+				s.ctx.GetLogger().Error("digest: failed to send to %s: %s", emailConfig.Name, err)
+				continue
+			}
+			s.ctx.GetLogger().Info("digest: %s digest sent to %s", config.Period, emailConfig.Name)
+		}
+	}()
+
+	return nil
+}
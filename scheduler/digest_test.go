@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+)
+
+func testDigest() *Digest {
+	until := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	return &Digest{
+		Period: "daily",
+		Since:  until.Add(-24 * time.Hour),
+		Until:  until,
+		Repositories: []RepositoryDigest{
+			{Location: "/var/backups", Snapshots: 3, Size: 3000, PreviousSize: 1000, Expiring: 2},
+			{Location: "s3://bucket", Error: "connection refused"},
+		},
+		Failures: []JobFailure{
+			{
+				JobStatus: JobStatus{Task: "backup", Name: "<system>", Repository: "/var/backups"},
+				Error:     "permission denied",
+				Finished:  until.Add(-time.Hour),
+			},
+		},
+	}
+}
+
+func TestDigestGrowth(t *testing.T) {
+	if g := (RepositoryDigest{Size: 3000, PreviousSize: 1000}).Growth(); g != "+2.0 kB" {
+		t.Errorf("unexpected growth %q", g)
+	}
+	if g := (RepositoryDigest{Size: 1000, PreviousSize: 3000}).Growth(); g != "-2.0 kB" {
+		t.Errorf("unexpected growth %q", g)
+	}
+}
+
+func TestDigestText(t *testing.T) {
+	text, err := testDigest().Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Plakar daily digest",
+		"Repository /var/backups",
+		"snapshots created: 3",
+		"size: 3.0 kB (+2.0 kB)",
+		"expiring next period: 2",
+		"error: connection refused",
+		"backup <system> on /var/backups: permission denied",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text digest misses %q:\n%s", want, text)
+		}
+	}
+
+	d := testDigest()
+	d.Failures = nil
+	text, err = d.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "No failed jobs.") {
+		t.Errorf("text digest misses the absence of failures:\n%s", text)
+	}
+}
+
+func TestDigestHTML(t *testing.T) {
+	html, err := testDigest().HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<td>/var/backups</td><td>3</td>") {
+		t.Errorf("HTML digest misses the repository row:\n%s", html)
+	}
+	if !strings.Contains(html, "&lt;system&gt;") {
+		t.Errorf("HTML digest does not escape job names:\n%s", html)
+	}
+}
+
+func TestDigestMessage(t *testing.T) {
+	raw, err := testDigest().Message("plakar@example.com", []string{"a@example.com", "b@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := msg.Header.Get("To"); to != "a@example.com, b@example.com" {
+		t.Errorf("unexpected recipients %q", to)
+	}
+	if subject := msg.Header.Get("Subject"); subject != "Plakar daily digest for 2026-10-16" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q: %v", mediaType, err)
+	}
+
+	var types []string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("unexpected parts %v", types)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	s := &Scheduler{
+		ctx:    appcontext.NewAppContext(),
+		config: &Configuration{},
+		queues: make(map[string]*jobQueue),
+	}
+
+	before := time.Now()
+	s.runJob("backup", "ok", "/tmp/repo", nil, func(run *jobRun) {})
+	s.runJob("check", "ko", "/tmp/repo", nil, func(run *jobRun) {
+		run.fail(1, errors.New("boom"))
+	})
+
+	failures := s.Failures(before.Add(-time.Second))
+	if len(failures) != 1 || failures[0].Name != "ko" || failures[0].Error != "boom" {
+		t.Fatalf("unexpected failures %+v", failures)
+	}
+	if failures := s.Failures(time.Now().Add(time.Second)); len(failures) != 0 {
+		t.Errorf("unexpected failures %+v", failures)
+	}
+
+	for i := 0; i < maxFailures+10; i++ {
+		s.recordFailure(JobFailure{Finished: time.Now()})
+	}
+	if n := len(s.Failures(time.Time{})); n != maxFailures {
+		t.Errorf("expected the history to be bounded to %d, got %d", maxFailures, n)
+	}
+}
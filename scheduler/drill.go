@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+)
+
+// DrillReport is the record of a drill, written as JSON to the reports
+// directory of the task as a proof the backups can be restored.
+type DrillReport struct {
+	Job        string `json:"job"`
+	Repository string `json:"repository"`
+	snapshot.DrillReport
+}
+
+// drill restores files of the latest snapshot of job into a scratch
+// directory created in dir, removed once the files are verified.
+func drill(repo *repository.Repository, job string, dir string, config DrillConfig) (*snapshot.DrillReport, error) {
+	snapshotID, timestamp, err := latestBackup(repo, job)
+	if err != nil {
+		return nil, err
+	}
+	if timestamp.IsZero() {
+		return nil, fmt.Errorf("no snapshot to restore")
+	}
+
+	snap, err := snapshot.Load(repo, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+
+	scratch, err := os.MkdirTemp(dir, "plakar-drill-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	exp, err := exporter.NewExporter(map[string]string{"location": scratch})
+	if err != nil {
+		return nil, err
+	}
+	defer exp.Close()
+
+	return snap.Drill(exp, &snapshot.DrillOptions{
+		Critical: config.Critical,
+		Sample:   config.Sample,
+	})
+}
+
+func writeDrillReport(dir string, report *DrillReport) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.json", report.Started.UTC().Format("20060102T150405Z"), report.Job)
+	return os.WriteFile(filepath.Join(dir, name), data, 0600)
+}
+
+func (s *Scheduler) drillTask(taskset Task, task DrillConfig) error {
+	interval, err := stringToDuration(task.Interval)
+	if err != nil {
+		return err
+	}
+
+	reports := task.Reports
+	if reports == "" && s.ctx.CacheDir != "" {
+		reports = filepath.Join(s.ctx.CacheDir, "drills")
+	}
+	location := taskset.Repository.Location
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		firstRun := true
+		for {
+			if firstRun {
+				firstRun = false
+			} else {
+				time.Sleep(interval)
+			}
+
+			s.runJob("drill", taskset.Name, location, task.Ping, func(run *jobRun) {
+				s.waitWindow("drill", location)
+
+				store, config, err := s.openStore(location)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening storage: %s", err)
+					run.fail(1, err)
+					return
+				}
+				defer store.Close()
+
+				newCtx := appcontext.NewAppContextFrom(s.ctx)
+				defer newCtx.Close()
+
+				repo, err := repository.New(newCtx, store, config)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening repository: %s", err)
+					run.fail(1, err)
+					return
+				}
+				defer repo.Close()
+
+				result, err := drill(repo, taskset.Name, task.Scratch, task)
+				if err != nil {
+					s.ctx.GetLogger().Error("drill: %s: %s", taskset.Name, err)
+					run.fail(1, err)
+					return
+				}
+
+				report := &DrillReport{
+					Job:         taskset.Name,
+					Repository:  location,
+					DrillReport: *result,
+				}
+				run.stats = report
+
+				if reports != "" {
+					if err := writeDrillReport(reports, report); err != nil {
+						s.ctx.GetLogger().Warn("drill: %s: failed to write report: %s", taskset.Name, err)
+					}
+				}
+
+				if report.Failed != 0 {
+					msg := fmt.Sprintf("drill of job %s: %d of %d files could not be restored", taskset.Name, report.Failed, len(report.Files))
+					s.ctx.GetLogger().Warn("%s", msg)
+					s.ctx.Events().Send(events.WarningEvent(report.Snapshot, msg))
+					run.fail(1, errors.New(msg))
+					return
+				}
+				s.ctx.GetLogger().Info("drill: %s: %d files restored and verified from snapshot %x",
+					taskset.Name, report.Restored, report.Snapshot[:4])
+			})
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDrillReport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "drills")
+
+	report := &DrillReport{
+		Job:        "system",
+		Repository: "/var/backups",
+		DrillReport: snapshot.DrillReport{
+			Snapshot: objects.MAC{0x01, 0x02},
+			Started:  time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+			Restored: 1,
+			Failed:   1,
+			Files: []snapshot.DrillFile{
+				{Path: "/etc/hosts", Size: 42, OK: true},
+				{Path: "/etc/missing", Error: "not found in snapshot"},
+			},
+		},
+	}
+	require.NoError(t, writeDrillReport(dir, report))
+
+	data, err := os.ReadFile(filepath.Join(dir, "20261016T120000Z-system.json"))
+	require.NoError(t, err)
+
+	var decoded DrillReport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "system", decoded.Job)
+	require.Equal(t, report.Snapshot, decoded.Snapshot)
+	require.Equal(t, 1, decoded.Failed)
+	require.Len(t, decoded.Files, 2)
+	require.Equal(t, "not found in snapshot", decoded.Files[1].Error)
+}
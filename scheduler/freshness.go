@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+// OverdueJob is a backup task whose latest snapshot is older than what its
+// configuration expects.
+type OverdueJob struct {
+	Name       string
+	Path       string
+	Repository string
+	Expect     time.Duration
+	// LastBackup is zero if the job never produced a snapshot.
+	LastBackup time.Time
+}
+
+// freshnessInterval returns how often a job expected every expect is
+// checked.
+func freshnessInterval(expect time.Duration) time.Duration {
+	interval := expect / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	} else if interval > time.Hour {
+		interval = time.Hour
+	}
+	return interval
+}
+
+// latestBackup returns the identifier and date of the most recent snapshot
+// produced by job, or a zero time if there is none.
+func latestBackup(repo *repository.Repository, job string) (objects.MAC, time.Time, error) {
+	locateOptions := utils.NewDefaultLocateOptions()
+	locateOptions.Job = job
+	locateOptions.Latest = true
+
+	snapshotIDs, err := utils.LocateSnapshotIDs(repo, locateOptions)
+	if err != nil || len(snapshotIDs) == 0 {
+		return objects.MAC{}, time.Time{}, err
+	}
+
+	snap, err := snapshot.Load(repo, snapshotIDs[0])
+	if err != nil {
+		return objects.MAC{}, time.Time{}, err
+	}
+	defer snap.Close()
+
+	return snapshotIDs[0], snap.Header.Timestamp, nil
+}
+
+func (s *Scheduler) setOverdue(name string, overdue *OverdueJob) {
+	s.overdueMutex.Lock()
+	defer s.overdueMutex.Unlock()
+
+	if overdue == nil {
+		delete(s.overdue, name)
+	} else {
+		s.overdue[name] = *overdue
+	}
+}
+
+// Overdue returns the backup tasks which missed their expected frequency.
+func (s *Scheduler) Overdue() []OverdueJob {
+	s.overdueMutex.Lock()
+	defer s.overdueMutex.Unlock()
+
+	ret := make([]OverdueJob, 0, len(s.overdue))
+	for _, job := range s.overdue {
+		ret = append(ret, job)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func (s *Scheduler) freshnessTask(taskset Task, task BackupConfig) error {
+	expect, err := stringToDuration(task.Expect)
+	if err != nil {
+		return err
+	}
+
+	location := taskset.Repository.Location
+	started := time.Now()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		alerted := false
+		for {
+			time.Sleep(freshnessInterval(expect))
+
+			store, config, err := s.openStore(location)
+			if err != nil {
+				s.ctx.GetLogger().Error("freshness: error opening storage: %s", err)
+				continue
+			}
+
+			newCtx := appcontext.NewAppContextFrom(s.ctx)
+
+			repo, err := repository.New(newCtx, store, config)
+			if err != nil {
+				s.ctx.GetLogger().Error("freshness: error opening repository: %s", err)
+				newCtx.Close()
+				store.Close()
+				continue
+			}
+
+			snapshotID, last, err := latestBackup(repo, taskset.Name)
+
+			newCtx.Close()
+			repo.Close()
+			store.Close()
+
+			if err != nil {
+				s.ctx.GetLogger().Error("freshness: %s: %s", taskset.Name, err)
+				continue
+			}
+
+			now := time.Now()
+			reference := last
+			if reference.IsZero() {
+				// give a job which never ran a chance to do so
+				reference = started
+			}
+
+			if now.Sub(reference) <= expect {
+				if alerted {
+					s.ctx.GetLogger().Info("freshness: backup %s is up to date again", taskset.Name)
+				}
+				alerted = false
+				s.setOverdue(taskset.Name, nil)
+				continue
+			}
+
+			s.setOverdue(taskset.Name, &OverdueJob{
+				Name:       taskset.Name,
+				Path:       task.Path,
+				Repository: location,
+				Expect:     expect,
+				LastBackup: last,
+			})
+
+			if !alerted {
+				var message string
+				if last.IsZero() {
+					message = fmt.Sprintf("backup %s expected every %s never completed", taskset.Name, expect)
+				} else {
+					message = fmt.Sprintf("backup %s expected every %s last completed %s ago",
+						taskset.Name, expect, now.Sub(last).Truncate(time.Second))
+				}
+				s.ctx.GetLogger().Warn("freshness: %s", message)
+				s.ctx.Events().Send(events.WarningEvent(snapshotID, message))
+				alerted = true
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreshnessInterval(t *testing.T) {
+	tests := []struct {
+		expect time.Duration
+		want   time.Duration
+	}{
+		{time.Minute, time.Minute},
+		{time.Hour, 6 * time.Minute},
+		{24 * time.Hour, time.Hour},
+	}
+	for _, test := range tests {
+		if got := freshnessInterval(test.expect); got != test.want {
+			t.Errorf("freshnessInterval(%s): got %s, want %s", test.expect, got, test.want)
+		}
+	}
+}
+
+func TestOverdue(t *testing.T) {
+	s := &Scheduler{overdue: make(map[string]OverdueJob)}
+
+	s.setOverdue("b", &OverdueJob{Name: "b", Expect: time.Hour})
+	s.setOverdue("a", &OverdueJob{Name: "a", Expect: time.Hour})
+	if overdue := s.Overdue(); len(overdue) != 2 || overdue[0].Name != "a" || overdue[1].Name != "b" {
+		t.Fatalf("unexpected overdue jobs: %+v", overdue)
+	}
+
+	s.setOverdue("a", nil)
+	if overdue := s.Overdue(); len(overdue) != 1 || overdue[0].Name != "b" {
+		t.Fatalf("unexpected overdue jobs: %+v", overdue)
+	}
+}
@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStatus describes a scheduled task which is either running or waiting
+// for its turn on a repository.
+type JobStatus struct {
+	Task       string
+	Name       string
+	Repository string
+	Queued     time.Time
+	Started    time.Time
+}
+
+func (j JobStatus) Running() bool {
+	return !j.Started.IsZero()
+}
+
+type job struct {
+	status JobStatus
+	ready  chan struct{}
+}
+
+// jobQueue limits the number of tasks running against a repository, tasks
+// in excess wait for their turn in the order they were queued rather than
+// contending for the repository locks.
+type jobQueue struct {
+	mu      sync.Mutex
+	max     int
+	running []*job
+	waiting []*job
+}
+
+func (q *jobQueue) acquire(j *job) {
+	q.mu.Lock()
+	if len(q.running) < q.max && len(q.waiting) == 0 {
+		j.status.Started = time.Now()
+		q.running = append(q.running, j)
+		q.mu.Unlock()
+		return
+	}
+	q.waiting = append(q.waiting, j)
+	q.mu.Unlock()
+
+	<-j.ready
+}
+
+func (q *jobQueue) release(j *job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, running := range q.running {
+		if running == j {
+			q.running = append(q.running[:i], q.running[i+1:]...)
+			break
+		}
+	}
+
+	for len(q.running) < q.max && len(q.waiting) != 0 {
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		next.status.Started = time.Now()
+		q.running = append(q.running, next)
+		close(next.ready)
+	}
+}
+
+func (q *jobQueue) jobs() []JobStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ret := make([]JobStatus, 0, len(q.running)+len(q.waiting))
+	for _, j := range q.running {
+		ret = append(ret, j.status)
+	}
+	for _, j := range q.waiting {
+		ret = append(ret, j.status)
+	}
+	return ret
+}
+
+func (s *Scheduler) queue(location string) *jobQueue {
+	s.queuesMutex.Lock()
+	defer s.queuesMutex.Unlock()
+
+	q, ok := s.queues[location]
+	if !ok {
+		max := s.config.Agent.MaxJobs
+		if max <= 0 {
+			max = 1
+		}
+		q = &jobQueue{max: max}
+		s.queues[location] = q
+	}
+	return q
+}
+
+// JobFailure is a failed run of a job, kept for the digests.
+type JobFailure struct {
+	JobStatus
+	Error    string
+	Finished time.Time
+}
+
+// maxFailures bounds the failure history kept in memory.
+const maxFailures = 1000
+
+func (s *Scheduler) recordFailure(failure JobFailure) {
+	s.failuresMutex.Lock()
+	defer s.failuresMutex.Unlock()
+
+	s.failures = append(s.failures, failure)
+	if len(s.failures) > maxFailures {
+		s.failures = s.failures[len(s.failures)-maxFailures:]
+	}
+}
+
+// Failures returns the runs which failed since the given time.
+func (s *Scheduler) Failures(since time.Time) []JobFailure {
+	s.failuresMutex.Lock()
+	defer s.failuresMutex.Unlock()
+
+	ret := []JobFailure{}
+	for _, failure := range s.failures {
+		if failure.Finished.After(since) {
+			ret = append(ret, failure)
+		}
+	}
+	return ret
+}
+
+// jobRun collects the outcome of a job run, reported to its ping URLs.
+type jobRun struct {
+	err   error
+	stats interface{}
+}
+
+// fail records the first failure of a run, retval being the exit status
+// of the subcommand which failed.
+func (r *jobRun) fail(retval int, err error) {
+	if r.err != nil {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("exited with status %d", retval)
+	}
+	r.err = err
+}
+
+// runJob runs fn once the queue of the repository at location allows it,
+// and notifies the ping URLs of the job, if any.  No job starts once the
+// context of the scheduler is cancelled.
+func (s *Scheduler) runJob(task string, name string, location string, ping *PingConfig, fn func(*jobRun)) {
+	s.runningMutex.Lock()
+	if s.ctx.GetContext().Err() != nil {
+		s.runningMutex.Unlock()
+		return
+	}
+	s.running.Add(1)
+	s.runningMutex.Unlock()
+	defer s.running.Done()
+
+	j := &job{
+		status: JobStatus{
+			Task:       task,
+			Name:       name,
+			Repository: location,
+			Queued:     time.Now(),
+		},
+		ready: make(chan struct{}),
+	}
+
+	q := s.queue(location)
+	q.acquire(j)
+	defer q.release(j)
+
+	if ping != nil && ping.Start {
+		s.ping(ping, j.status, nil)
+	}
+
+	run := &jobRun{}
+	fn(run)
+
+	if run.err != nil {
+		s.recordFailure(JobFailure{
+			JobStatus: j.status,
+			Error:     run.err.Error(),
+			Finished:  time.Now(),
+		})
+	}
+
+	if ping != nil {
+		s.ping(ping, j.status, run)
+	}
+}
+
+// Jobs returns the running and queued tasks of every repository, running
+// tasks first.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.queuesMutex.Lock()
+	queues := make([]*jobQueue, 0, len(s.queues))
+	for _, q := range s.queues {
+		queues = append(queues, q)
+	}
+	s.queuesMutex.Unlock()
+
+	ret := []JobStatus{}
+	for _, q := range queues {
+		ret = append(ret, q.jobs()...)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Running() != ret[j].Running() {
+			return ret[i].Running()
+		}
+		if ret[i].Repository != ret[j].Repository {
+			return ret[i].Repository < ret[j].Repository
+		}
+		return ret[i].Queued.Before(ret[j].Queued)
+	})
+	return ret
+}
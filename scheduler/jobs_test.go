@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobQueue(t *testing.T) {
+	q := &jobQueue{max: 1}
+
+	first := &job{status: JobStatus{Task: "backup"}, ready: make(chan struct{})}
+	q.acquire(first)
+
+	var mu sync.Mutex
+	order := []string{}
+	var wg sync.WaitGroup
+	for _, task := range []string{"check", "sync"} {
+		j := &job{status: JobStatus{Task: task}, ready: make(chan struct{})}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.acquire(j)
+			mu.Lock()
+			order = append(order, j.status.Task)
+			mu.Unlock()
+			q.release(j)
+		}()
+		// make sure jobs are queued in order
+		for {
+			q.mu.Lock()
+			queued := len(q.waiting) != 0 && q.waiting[len(q.waiting)-1] == j
+			q.mu.Unlock()
+			if queued {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	jobs := q.jobs()
+	if len(jobs) != 3 || !jobs[0].Running() || jobs[1].Running() || jobs[2].Running() {
+		t.Fatalf("unexpected queue state: %+v", jobs)
+	}
+
+	q.release(first)
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "check" || order[1] != "sync" {
+		t.Errorf("unexpected execution order: %v", order)
+	}
+	if jobs := q.jobs(); len(jobs) != 0 {
+		t.Errorf("unexpected jobs left: %+v", jobs)
+	}
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pingTimeout bounds the time spent notifying a ping URL, a monitoring
+// service being down must not hold the job queue.
+const pingTimeout = 10 * time.Second
+
+// PingPayload is the JSON body POSTed to the ping URLs of a job.
+type PingPayload struct {
+	Task       string      `json:"task"`
+	Name       string      `json:"name"`
+	Repository string      `json:"repository"`
+	Status     string      `json:"status"`
+	Error      string      `json:"error,omitempty"`
+	Started    time.Time   `json:"started"`
+	Duration   float64     `json:"duration"`
+	Stats      interface{} `json:"stats,omitempty"`
+}
+
+func pingURLs(config *PingConfig) (start, success, failure string) {
+	base := strings.TrimSuffix(config.URL, "/")
+	failure = config.FailureURL
+	if failure == "" {
+		failure = base + "/fail"
+	}
+	return base + "/start", config.URL, failure
+}
+
+// ping notifies the URLs of a job, run is nil when the job starts.
+func (s *Scheduler) ping(config *PingConfig, status JobStatus, run *jobRun) {
+	start, success, failure := pingURLs(config)
+
+	payload := PingPayload{
+		Task:       status.Task,
+		Name:       status.Name,
+		Repository: status.Repository,
+		Started:    status.Started,
+	}
+
+	url := start
+	if run == nil {
+		payload.Status = "start"
+	} else {
+		payload.Duration = time.Since(status.Started).Seconds()
+		payload.Stats = run.stats
+		if run.err != nil {
+			url = failure
+			payload.Status = "failure"
+			payload.Error = run.err.Error()
+		} else {
+			url = success
+			payload.Status = "success"
+		}
+	}
+
+	if err := postPing(url, payload); err != nil {
+		s.ctx.GetLogger().Warn("%s: failed to ping %s: %s", status.Task, url, err)
+	}
+}
+
+func postPing(url string, payload PingPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: pingTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
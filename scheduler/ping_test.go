@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+)
+
+func TestPingURLs(t *testing.T) {
+	start, success, failure := pingURLs(&PingConfig{URL: "https://hc-ping.com/1234/"})
+	if start != "https://hc-ping.com/1234/start" || success != "https://hc-ping.com/1234/" || failure != "https://hc-ping.com/1234/fail" {
+		t.Errorf("unexpected URLs: %s %s %s", start, success, failure)
+	}
+
+	_, _, failure = pingURLs(&PingConfig{URL: "https://example.com/ok", FailureURL: "https://example.com/ko"})
+	if failure != "https://example.com/ko" {
+		t.Errorf("unexpected failure URL: %s", failure)
+	}
+}
+
+func TestRunJobPing(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]PingPayload{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload PingPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received[r.URL.Path] = payload
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	s := &Scheduler{
+		ctx:    appcontext.NewAppContext(),
+		config: &Configuration{},
+		queues: make(map[string]*jobQueue),
+	}
+	ping := &PingConfig{URL: server.URL + "/check", Start: true}
+
+	s.runJob("backup", "system", "/tmp/repo", ping, func(run *jobRun) {
+		run.stats = map[string]int{"files": 42}
+	})
+	s.runJob("backup", "system", "/tmp/repo", ping, func(run *jobRun) {
+		run.fail(1, errors.New("boom"))
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if p, ok := received["/check/start"]; !ok || p.Status != "start" {
+		t.Errorf("missing start ping: %+v", received)
+	}
+	if p, ok := received["/check"]; !ok || p.Status != "success" || p.Name != "system" || p.Stats == nil {
+		t.Errorf("unexpected success ping: %+v", p)
+	}
+	if p, ok := received["/check/fail"]; !ok || p.Status != "failure" || p.Error != "boom" {
+		t.Errorf("unexpected failure ping: %+v", p)
+	}
+}
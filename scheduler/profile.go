@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/identity"
+)
+
+// ProfileOptions has the agent follow the profile distributed by a server
+// to its enrolled clients, the schedules it holds running along the ones
+// of the local configuration.
+type ProfileOptions struct {
+	URL      string
+	Interval time.Duration
+	Identity *identity.Identity
+	// CacheFile keeps the latest profile, so that it applies even when
+	// the server can't be reached after a restart.
+	CacheFile string
+}
+
+type profileState struct {
+	serial    uint64
+	schedules map[string]config.ScheduleConfig
+}
+
+// profileRepository checks that a profile schedule backs up to the default
+// repository or to one named in the local configuration, so that the server
+// can't have backups sent to a location of its choosing.
+func profileRepository(cfg *config.Config, repository string) error {
+	if repository == "" {
+		return nil
+	}
+	name, ok := strings.CutPrefix(repository, "@")
+	if !ok {
+		return fmt.Errorf("repository %s is not a configured repository", repository)
+	}
+	if cfg == nil || !cfg.HasRepository(name) {
+		return fmt.Errorf("unknown repository: %s", repository)
+	}
+	return nil
+}
+
+// applyProfile verifies a profile and makes its schedules current, unless
+// it is older than the one in use.
+func (s *Scheduler) applyProfile(opts *ProfileOptions, profile *identity.Profile) (bool, error) {
+	if err := profile.Verify(opts.Identity.Issuer, opts.Identity.Identifier); err != nil {
+		return false, err
+	}
+
+	schedules, err := config.ParseSchedules(profile.Document)
+	if err != nil {
+		return false, fmt.Errorf("invalid profile: %w", err)
+	}
+	for name, schedule := range schedules {
+		if _, err := ParseCron(schedule.Cron); err != nil {
+			return false, fmt.Errorf("invalid profile: schedule %s: %w", name, err)
+		}
+		if err := profileRepository(s.ctx.Config, schedule.Repository); err != nil {
+			return false, fmt.Errorf("invalid profile: schedule %s: %w", name, err)
+		}
+	}
+
+	s.profileMutex.Lock()
+	defer s.profileMutex.Unlock()
+
+	if profile.Serial < s.profile.serial {
+		return false, fmt.Errorf("profile serial %d is older than %d", profile.Serial, s.profile.serial)
+	} else if profile.Serial == s.profile.serial {
+		return false, nil
+	}
+	s.profile = profileState{serial: profile.Serial, schedules: schedules}
+	return true, nil
+}
+
+// profileSchedules returns the schedules of the profile in use.
+func (s *Scheduler) profileSchedules() map[string]config.ScheduleConfig {
+	s.profileMutex.Lock()
+	defer s.profileMutex.Unlock()
+
+	return s.profile.schedules
+}
+
+func fetchProfile(serverURL string, req *identity.ProfileRequest) (*identity.Profile, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(strings.TrimSuffix(serverURL, "/")+"/profile", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("profile refused by server: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var profile identity.Profile
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (s *Scheduler) cacheProfile(opts *ProfileOptions, profile *identity.Profile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	tmp := opts.CacheFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, opts.CacheFile)
+}
+
+func (s *Scheduler) loadCachedProfile(opts *ProfileOptions) {
+	data, err := os.ReadFile(opts.CacheFile)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		s.ctx.GetLogger().Warn("profile: could not read cached profile: %s", err)
+		return
+	}
+
+	var profile identity.Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		s.ctx.GetLogger().Warn("profile: could not decode cached profile: %s", err)
+		return
+	}
+	if _, err := s.applyProfile(opts, &profile); err != nil {
+		s.ctx.GetLogger().Warn("profile: discarding cached profile: %s", err)
+	}
+}
+
+func (s *Scheduler) refreshProfile(opts *ProfileOptions) {
+	profile, err := fetchProfile(opts.URL, opts.Identity.ProfileRequest())
+	if err != nil {
+		s.ctx.GetLogger().Warn("profile: %s", err)
+		return
+	}
+
+	updated, err := s.applyProfile(opts, profile)
+	if err != nil {
+		s.ctx.GetLogger().Error("profile: refusing profile from %s: %s", opts.URL, err)
+		return
+	}
+	if !updated {
+		return
+	}
+
+	s.ctx.GetLogger().Info("profile: applied profile %d from %s", profile.Serial, opts.URL)
+	if opts.CacheFile != "" {
+		if err := s.cacheProfile(opts, profile); err != nil {
+			s.ctx.GetLogger().Warn("profile: could not cache profile: %s", err)
+		}
+	}
+}
+
+// FollowProfile polls the server for the profile of the identity, which
+// must be enrolled, every interval.
+func (s *Scheduler) FollowProfile(opts ProfileOptions) error {
+	if !opts.Identity.Enrolled() {
+		return fmt.Errorf("identity %s is not enrolled", opts.Identity.Identifier)
+	}
+
+	if opts.CacheFile != "" {
+		s.loadCachedProfile(&opts)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.refreshProfile(&opts)
+			time.Sleep(opts.Interval)
+		}
+	}()
+	return nil
+}
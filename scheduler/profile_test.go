@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfile(t *testing.T) {
+	registry, err := identity.OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+
+	id, err := identity.New("laptop")
+	require.NoError(t, err)
+	_, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+	client, err := registry.Approve(id.Identifier)
+	require.NoError(t, err)
+	require.NoError(t, id.SetCertificate(client.Certificate, identity.Fingerprint(registry.Issuer())))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req identity.ProfileRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		profile, err := registry.Profile(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(profile)
+	}))
+	defer server.Close()
+
+	cfg, err := config.LoadOrCreate(filepath.Join(t.TempDir(), "plakar.yml"))
+	require.NoError(t, err)
+	cfg.Repositories["backups"] = config.RepositoryConfig{"location": "/var/backups/plakar"}
+	ctx := appcontext.NewAppContext()
+	ctx.Config = cfg
+
+	s := &Scheduler{ctx: ctx}
+	opts := &ProfileOptions{URL: server.URL, Identity: id}
+
+	_, err = fetchProfile(server.URL, id.ProfileRequest())
+	require.ErrorContains(t, err, "no profile")
+
+	_, err = registry.SetProfile(id.Identifier, []byte("schedules:\n  home:\n    cron: '0 3 * * *'\n    path: /home\n"))
+	require.NoError(t, err)
+	old, err := fetchProfile(server.URL, id.ProfileRequest())
+	require.NoError(t, err)
+
+	updated, err := s.applyProfile(opts, old)
+	require.NoError(t, err)
+	require.True(t, updated)
+	require.Equal(t, "/home", s.profileSchedules()["home"].Path)
+
+	// applying the same profile again changes nothing
+	updated, err = s.applyProfile(opts, old)
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	_, err = registry.SetProfile(id.Identifier, []byte("schedules:\n  etc:\n    cron: '@daily'\n    path: /etc\n"))
+	require.NoError(t, err)
+	profile, err := fetchProfile(server.URL, id.ProfileRequest())
+	require.NoError(t, err)
+	updated, err = s.applyProfile(opts, profile)
+	require.NoError(t, err)
+	require.True(t, updated)
+	require.Len(t, s.profileSchedules(), 1)
+	require.Equal(t, "/etc", s.profileSchedules()["etc"].Path)
+
+	// rolling back to an older profile is refused
+	_, err = s.applyProfile(opts, old)
+	require.ErrorContains(t, err, "older")
+
+	// as are tampered and invalid profiles
+	profile.Document = []byte("schedules: {}\n")
+	_, err = s.applyProfile(opts, profile)
+	require.ErrorIs(t, err, identity.ErrInvalidSignature)
+
+	_, err = registry.SetProfile(id.Identifier, []byte("repositories: {}\n"))
+	require.NoError(t, err)
+	profile, err = fetchProfile(server.URL, id.ProfileRequest())
+	require.NoError(t, err)
+	_, err = s.applyProfile(opts, profile)
+	require.ErrorContains(t, err, "invalid profile")
+	require.Equal(t, "/etc", s.profileSchedules()["etc"].Path)
+
+	// schedules only back up to repositories of the local configuration
+	for _, repository := range []string{"/tmp/elsewhere", "sftp://attacker.example.com/repo", "@unknown"} {
+		_, err = registry.SetProfile(id.Identifier, []byte("schedules:\n  etc:\n    cron: '@daily'\n    path: /etc\n    repository: '"+repository+"'\n"))
+		require.NoError(t, err)
+		profile, err = fetchProfile(server.URL, id.ProfileRequest())
+		require.NoError(t, err)
+		_, err = s.applyProfile(opts, profile)
+		require.ErrorContains(t, err, "repository", repository)
+	}
+
+	_, err = registry.SetProfile(id.Identifier, []byte("schedules:\n  etc:\n    cron: '@daily'\n    path: /etc\n    repository: '@backups'\n"))
+	require.NoError(t, err)
+	profile, err = fetchProfile(server.URL, id.ProfileRequest())
+	require.NoError(t, err)
+	updated, err = s.applyProfile(opts, profile)
+	require.NoError(t, err)
+	require.True(t, updated)
+	require.Equal(t, "@backups", s.profileSchedules()["etc"].Repository)
+}
+
+func TestApplyProfileIssuer(t *testing.T) {
+	registry, err := identity.OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+	id, err := identity.New("laptop")
+	require.NoError(t, err)
+	_, err = registry.Submit(id.Request("host"))
+	require.NoError(t, err)
+	client, err := registry.Approve(id.Identifier)
+	require.NoError(t, err)
+	require.NoError(t, id.SetCertificate(client.Certificate, identity.Fingerprint(registry.Issuer())))
+
+	// a profile signed by another issuer is refused, even if the
+	// certificate in use names that issuer
+	other, err := identity.OpenRegistry(t.TempDir())
+	require.NoError(t, err)
+	_, err = other.Submit(id.Request("host"))
+	require.NoError(t, err)
+	forged, err := other.Approve(id.Identifier)
+	require.NoError(t, err)
+	id.Certificate = forged.Certificate
+	_, err = other.SetProfile(id.Identifier, []byte("schedules: {}\n"))
+	require.NoError(t, err)
+	profile, err := other.Profile(id.ProfileRequest())
+	require.NoError(t, err)
+
+	s := &Scheduler{ctx: appcontext.NewAppContext()}
+	_, err = s.applyProfile(&ProfileOptions{Identity: id}, profile)
+	require.ErrorIs(t, err, identity.ErrInvalidSignature)
+}
@@ -11,6 +11,29 @@ type Scheduler struct {
 	config *Configuration
 	ctx    *appcontext.AppContext
 	wg     sync.WaitGroup
+
+	// running counts the jobs in progress, none starting once the
+	// context is cancelled
+	running      sync.WaitGroup
+	runningMutex sync.Mutex
+
+	anomalies *anomalyDetector
+	windows   map[string]*repositoryWindows
+
+	queues      map[string]*jobQueue
+	queuesMutex sync.Mutex
+
+	overdue      map[string]OverdueJob
+	overdueMutex sync.Mutex
+
+	failures      []JobFailure
+	failuresMutex sync.Mutex
+
+	schedules      map[string]ScheduleStatus
+	schedulesMutex sync.Mutex
+
+	profile      profileState
+	profileMutex sync.Mutex
 }
 
 func stringToDuration(s string) (time.Duration, error) {
@@ -22,13 +45,46 @@ func stringToDuration(s string) (time.Duration, error) {
 }
 
 func NewScheduler(ctx *appcontext.AppContext, config *Configuration) *Scheduler {
+	windows := make(map[string]*repositoryWindows)
+	for _, windowCfg := range config.Agent.Windows {
+		rw, err := newRepositoryWindows(windowCfg)
+		if err != nil {
+			ctx.GetLogger().Error("Error configuring windows of repository %s: %s", windowCfg.Repository, err)
+			continue
+		}
+		windows[windowCfg.Repository] = rw
+	}
+
+	// baselines are rebuilt from scratch, and paused retentions forgotten,
+	// if the agent can't keep them in its cache
+	anomalyCache, err := ctx.GetCache().Anomaly()
+	if err != nil {
+		ctx.GetLogger().Warn("could not open anomaly cache: %s", err)
+		anomalyCache = nil
+	}
+
 	return &Scheduler{
-		ctx:    ctx,
-		config: config,
-		wg:     sync.WaitGroup{},
+		ctx:       ctx,
+		config:    config,
+		wg:        sync.WaitGroup{},
+		anomalies: newAnomalyDetector(anomalyCache),
+		windows:   windows,
+		queues:    make(map[string]*jobQueue),
+		overdue:   make(map[string]OverdueJob),
+		schedules: make(map[string]ScheduleStatus),
 	}
 }
 
+// Wait waits for the jobs in progress to complete once the context of the
+// scheduler is cancelled, e.g. on SIGTERM.
+func (s *Scheduler) Wait() {
+	// no job is added to running once the ones checking the context
+	// released the mutex
+	s.runningMutex.Lock()
+	s.runningMutex.Unlock()
+	s.running.Wait()
+}
+
 func (s *Scheduler) Run() {
 	for _, cleanupCfg := range s.config.Agent.Maintenance {
 		err := s.maintenanceTask(cleanupCfg)
@@ -43,6 +99,12 @@ func (s *Scheduler) Run() {
 			if err != nil {
 				s.ctx.GetLogger().Error("Error configuring backup task: %s", err)
 			}
+			if tasksetCfg.Backup.Expect != "" {
+				err := s.freshnessTask(tasksetCfg, *tasksetCfg.Backup)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error configuring freshness monitoring: %s", err)
+				}
+			}
 		}
 
 		for _, checkCfg := range tasksetCfg.Check {
@@ -65,6 +127,21 @@ func (s *Scheduler) Run() {
 				s.ctx.GetLogger().Error("Error configuring sync task: %s", err)
 			}
 		}
+
+		for _, drillCfg := range tasksetCfg.Drill {
+			err := s.drillTask(tasksetCfg, drillCfg)
+			if err != nil {
+				s.ctx.GetLogger().Error("Error configuring drill task: %s", err)
+			}
+		}
+	}
+	for _, digestCfg := range s.config.Agent.Digests {
+		err := s.digestTask(digestCfg)
+		if err != nil {
+			s.ctx.GetLogger().Error("Error configuring digest: %s", err)
+		}
 	}
+	s.schedulesTask()
+
 	<-make(chan struct{})
 }
@@ -0,0 +1,256 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// ScheduleStatus is the outcome of the latest run of a schedule from the
+// configuration.
+type ScheduleStatus struct {
+	Started    time.Time
+	Finished   time.Time
+	Error      string
+	SnapshotID [32]byte
+}
+
+func (s ScheduleStatus) Running() bool {
+	return !s.Started.IsZero() && s.Finished.IsZero()
+}
+
+// ScheduleStatus returns the status of the latest run of the schedule,
+// false if it didn't run since the agent started.
+func (s *Scheduler) ScheduleStatus(name string) (ScheduleStatus, bool) {
+	s.schedulesMutex.Lock()
+	defer s.schedulesMutex.Unlock()
+
+	status, ok := s.schedules[name]
+	return status, ok
+}
+
+// startSchedule marks the schedule as running, unless it still is.
+func (s *Scheduler) startSchedule(name string) bool {
+	s.schedulesMutex.Lock()
+	defer s.schedulesMutex.Unlock()
+
+	if s.schedules[name].Running() {
+		return false
+	}
+	s.schedules[name] = ScheduleStatus{Started: time.Now()}
+	return true
+}
+
+func (s *Scheduler) finishSchedule(name string, snapshotID [32]byte, err error) {
+	s.schedulesMutex.Lock()
+	defer s.schedulesMutex.Unlock()
+
+	status := s.schedules[name]
+	status.Finished = time.Now()
+	status.SnapshotID = snapshotID
+	if err != nil {
+		status.Error = err.Error()
+	}
+	s.schedules[name] = status
+}
+
+// scheduleStore returns the configuration of the store a schedule backs
+// up to, resolved the way the command line resolves repositories.
+func scheduleStore(cfg *config.Config, repository string, homeDir string) (map[string]string, error) {
+	if repository == "" {
+		if cfg.DefaultRepository != "" {
+			repository = "@" + cfg.DefaultRepository
+		} else {
+			repository = filepath.Join(homeDir, ".plakar")
+		}
+	}
+
+	if !strings.HasPrefix(repository, "@") {
+		return map[string]string{"location": repository}, nil
+	}
+
+	storeConfig, err := cfg.GetRepository(repository[1:])
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve repository: %s: %w", repository, err)
+	}
+	if _, ok := storeConfig["location"]; !ok {
+		return nil, fmt.Errorf("could not resolve repository location: %s", repository)
+	}
+	return storeConfig, nil
+}
+
+// scheduleSecret derives the key of an encrypted repository from the
+// passphrase of its configuration, or from $PLAKAR_PASSPHRASE, as there
+// is no one to prompt.
+func scheduleSecret(storeConfig map[string]string, serializedConfig []byte) ([]byte, error) {
+	repoConfig, err := storage.NewConfigurationFromWrappedBytes(serializedConfig)
+	if err != nil {
+		return nil, err
+	}
+	if repoConfig.Encryption == nil {
+		return nil, nil
+	}
+
+	passphrase, ok := storeConfig["passphrase"]
+	if !ok {
+		passphrase = os.Getenv("PLAKAR_PASSPHRASE")
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("no passphrase configured for encrypted repository %s", storeConfig["location"])
+	}
+
+	key, err := encryption.DeriveKey(repoConfig.Encryption.KDFParams, []byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	if !encryption.VerifyCanary(repoConfig.Encryption, key) {
+		return nil, fmt.Errorf("invalid passphrase")
+	}
+	return key, nil
+}
+
+func (s *Scheduler) runSchedule(cfg *config.Config, name string, schedule config.ScheduleConfig) {
+	var snapshotID [32]byte
+
+	storeConfig, err := scheduleStore(cfg, schedule.Repository, s.ctx.HomeDir)
+	if err != nil {
+		s.ctx.GetLogger().Error("schedule %s: %s", name, err)
+		s.finishSchedule(name, snapshotID, err)
+		return
+	}
+	location := storeConfig["location"]
+
+	var runErr error
+	s.runJob("schedule", name, location, nil, func(run *jobRun) {
+		defer func() { runErr = run.err }()
+
+		s.waitWindow("schedule", location)
+
+		store, serializedConfig, err := s.openStoreConfig(storeConfig)
+		if err != nil {
+			s.ctx.GetLogger().Error("schedule %s: error opening storage: %s", name, err)
+			run.fail(1, err)
+			return
+		}
+		defer store.Close()
+
+		secret, err := scheduleSecret(storeConfig, serializedConfig)
+		if err != nil {
+			s.ctx.GetLogger().Error("schedule %s: %s", name, err)
+			run.fail(1, err)
+			return
+		}
+
+		newCtx := appcontext.NewAppContextFrom(s.ctx)
+		defer newCtx.Close()
+		newCtx.Config = cfg
+		if secret != nil {
+			newCtx.SetSecret(secret)
+		}
+
+		repo, err := repository.New(newCtx, store, serializedConfig)
+		if err != nil {
+			s.ctx.GetLogger().Error("schedule %s: error opening repository: %s", name, err)
+			run.fail(1, err)
+			return
+		}
+		defer repo.Close()
+
+		backupSubcommand := &backup.Backup{}
+		backupSubcommand.RepositoryLocation = location
+		backupSubcommand.Job = name
+		backupSubcommand.Path = schedule.Path
+		backupSubcommand.Excludes = schedule.Excludes
+		backupSubcommand.SystemState = schedule.SystemState
+		backupSubcommand.Silent = true
+		backupSubcommand.Quiet = true
+		backupSubcommand.Replicate = backup.ConfiguredReplicas(storeConfig)
+
+		backupCtx := appcontext.NewAppContextFrom(newCtx)
+		deltaDone := make(chan struct{})
+		backupEvents := backupCtx.Events().Listen()
+		go func() {
+			defer close(deltaDone)
+			for event := range backupEvents {
+				if e, ok := event.(events.Delta); ok {
+					snapshotID = e.SnapshotID
+				}
+			}
+		}()
+
+		retval, err := backupSubcommand.Execute(backupCtx, repo)
+		backupCtx.Close()
+		<-deltaDone
+		if err != nil || retval != 0 {
+			s.ctx.GetLogger().Error("schedule %s: error creating backup: %s", name, err)
+			run.fail(retval, err)
+			return
+		}
+		s.ctx.GetLogger().Info("schedule %s: created snapshot %x", name, snapshotID[:4])
+	})
+
+	s.finishSchedule(name, snapshotID, runErr)
+}
+
+// schedulesTask runs the backups scheduled in the configuration, which is
+// read again every minute for the schedules added or removed while the
+// agent runs to be taken into account, and in the profile distributed by
+// the server, if followed.  Local schedules take precedence over the ones
+// of the profile named alike.
+func (s *Scheduler) schedulesTask() {
+	if s.ctx.Config == nil {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		cfg := s.ctx.Config
+		for {
+			now := time.Now()
+			minute := now.Truncate(time.Minute).Add(time.Minute)
+			time.Sleep(minute.Sub(now))
+
+			if reloaded, err := cfg.Reload(); err != nil {
+				s.ctx.GetLogger().Error("schedules: failed to reload configuration: %s", err)
+			} else {
+				cfg = reloaded
+			}
+
+			schedules := make(map[string]config.ScheduleConfig)
+			for name, schedule := range s.profileSchedules() {
+				schedules[name] = schedule
+			}
+			for name, schedule := range cfg.Schedules {
+				schedules[name] = schedule
+			}
+
+			for name, schedule := range schedules {
+				cron, err := ParseCron(schedule.Cron)
+				if err != nil {
+					s.ctx.GetLogger().Error("schedule %s: %s", name, err)
+					continue
+				}
+				if !cron.Match(minute) {
+					continue
+				}
+				if !s.startSchedule(name) {
+					s.ctx.GetLogger().Warn("schedule %s: previous run still in progress, skipping", name)
+					continue
+				}
+				go s.runSchedule(cfg, name, schedule)
+			}
+		}
+	}()
+}
@@ -11,8 +11,8 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restore"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/rm"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/sync"
+	"github.com/PlakarKorp/plakar/events"
 	"github.com/PlakarKorp/plakar/repository"
-	"github.com/PlakarKorp/plakar/storage"
 )
 
 func (s *Scheduler) backupTask(taskset Task, task BackupConfig) error {
@@ -42,6 +42,9 @@ func (s *Scheduler) backupTask(taskset Task, task BackupConfig) error {
 	if task.Check.Enabled {
 		backupSubcommand.OptCheck = true
 	}
+	backupSubcommand.Timestamp = task.Timestamp
+	backupSubcommand.Namespace = task.Namespace
+	backupSubcommand.Replicate = task.Replicate
 
 	rmSubcommand := &rm.Rm{}
 	rmSubcommand.RepositoryLocation = taskset.Repository.Location
@@ -62,44 +65,95 @@ func (s *Scheduler) backupTask(taskset Task, task BackupConfig) error {
 				time.Sleep(interval)
 			}
 
-			store, config, err := storage.Open(map[string]string{"location": backupSubcommand.RepositoryLocation})
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening storage: %s", err)
-				continue
-			}
+			s.runJob("backup", taskset.Name, backupSubcommand.RepositoryLocation, task.Ping, func(run *jobRun) {
+				s.waitWindow("backup", backupSubcommand.RepositoryLocation)
 
-			newCtx := appcontext.NewAppContextFrom(s.ctx)
+				store, config, err := s.openStore(backupSubcommand.RepositoryLocation)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening storage: %s", err)
+					run.fail(1, err)
+					return
+				}
 
-			repo, err := repository.New(newCtx, store, config)
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening repository: %s", err)
-				store.Close()
-				continue
-			}
+				newCtx := appcontext.NewAppContextFrom(s.ctx)
 
-			backupCtx := appcontext.NewAppContextFrom(newCtx)
-			retval, err := backupSubcommand.Execute(backupCtx, repo)
-			if err != nil || retval != 0 {
-				s.ctx.GetLogger().Error("Error creating backup: %s", err)
-				backupCtx.Close()
-				goto close
-			}
-			backupCtx.Close()
+				repo, err := repository.New(newCtx, store, config)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening repository: %s", err)
+					run.fail(1, err)
+					store.Close()
+					return
+				}
 
-			if task.Retention != "" {
-				rmCtx := appcontext.NewAppContextFrom(newCtx)
-				rmSubcommand.OptBefore = time.Now().Add(-retention)
-				retval, err = rmSubcommand.Execute(rmCtx, repo)
+				// jobs without a retention of their own use the one of
+				// the repository, if any
+				jobRetention := retention
+				if task.Retention == "" {
+					jobRetention = repo.Configuration().Retention
+				}
+
+				backupCtx := appcontext.NewAppContextFrom(newCtx)
+
+				var delta *events.Delta
+				deltaDone := make(chan struct{})
+				backupEvents := backupCtx.Events().Listen()
+				go func() {
+					defer close(deltaDone)
+					for event := range backupEvents {
+						if e, ok := event.(events.Delta); ok {
+							delta = &e
+						}
+					}
+				}()
+
+				retval, err := backupSubcommand.Execute(backupCtx, repo)
+				backupCtx.Close()
+				<-deltaDone
+				if delta != nil {
+					run.stats = delta
+				}
 				if err != nil || retval != 0 {
-					s.ctx.GetLogger().Error("Error removing obsolete backups: %s", err)
+					s.ctx.GetLogger().Error("Error creating backup: %s", err)
+					run.fail(retval, err)
+					goto close
+				}
+
+				if task.Anomaly != nil && delta != nil {
+					source := taskset.Name + ":" + task.Path
+					reasons, err := s.anomalies.observe(source, task.Anomaly, *delta)
+					if err != nil {
+						s.ctx.GetLogger().Warn("backup %s: could not record baseline: %s", source, err)
+					}
+					for _, reason := range reasons {
+						s.ctx.GetLogger().Warn("backup %s: anomaly detected in snapshot %x: %s", source, delta.SnapshotID[:4], reason)
+						s.ctx.Events().Send(events.AnomalyEvent(delta.SnapshotID, source, reason))
+					}
+					// retention is not applied unless known not to be paused
+					if paused, err := s.anomalies.retentionPaused(source); err != nil {
+						s.ctx.GetLogger().Warn("backup %s: retention skipped, could not check whether it is paused: %s", source, err)
+						goto close
+					} else if paused {
+						s.ctx.GetLogger().Warn("backup %s: retention paused following an anomaly, see plakar schedule resume-retention", source)
+						goto close
+					}
+				}
+
+				if jobRetention != 0 {
+					rmCtx := appcontext.NewAppContextFrom(newCtx)
+					rmSubcommand.OptBefore = time.Now().Add(-jobRetention)
+					retval, err = rmSubcommand.Execute(rmCtx, repo)
+					if err != nil || retval != 0 {
+						s.ctx.GetLogger().Error("Error removing obsolete backups: %s", err)
+						run.fail(retval, err)
+					}
+					rmCtx.Close()
 				}
-				rmCtx.Close()
-			}
 
-		close:
-			newCtx.Close()
-			repo.Close()
-			store.Close()
+			close:
+				newCtx.Close()
+				repo.Close()
+				store.Close()
+			})
 		}
 	}()
 
@@ -136,29 +190,36 @@ func (s *Scheduler) checkTask(taskset Task, task CheckConfig) error {
 				time.Sleep(interval)
 			}
 
-			store, config, err := storage.Open(map[string]string{"location": checkSubcommand.RepositoryLocation})
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening storage: %s", err)
-				continue
-			}
+			s.runJob("check", taskset.Name, checkSubcommand.RepositoryLocation, task.Ping, func(run *jobRun) {
+				s.waitWindow("check", checkSubcommand.RepositoryLocation)
 
-			newCtx := appcontext.NewAppContextFrom(s.ctx)
+				store, config, err := s.openStore(checkSubcommand.RepositoryLocation)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening storage: %s", err)
+					run.fail(1, err)
+					return
+				}
 
-			repo, err := repository.New(newCtx, store, config)
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening repository: %s", err)
-				store.Close()
-				continue
-			}
+				newCtx := appcontext.NewAppContextFrom(s.ctx)
 
-			retval, err := checkSubcommand.Execute(newCtx, repo)
-			if err != nil || retval != 0 {
-				s.ctx.GetLogger().Error("Error executing check: %s", err)
-			}
+				repo, err := repository.New(newCtx, store, config)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening repository: %s", err)
+					run.fail(1, err)
+					store.Close()
+					return
+				}
 
-			newCtx.Close()
-			repo.Close()
-			store.Close()
+				retval, err := checkSubcommand.Execute(newCtx, repo)
+				if err != nil || retval != 0 {
+					s.ctx.GetLogger().Error("Error executing check: %s", err)
+					run.fail(retval, err)
+				}
+
+				newCtx.Close()
+				repo.Close()
+				store.Close()
+			})
 		}
 	}()
 
@@ -195,29 +256,36 @@ func (s *Scheduler) restoreTask(taskset Task, task RestoreConfig) error {
 				time.Sleep(interval)
 			}
 
-			store, config, err := storage.Open(map[string]string{"location": restoreSubcommand.RepositoryLocation})
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening storage: %s", err)
-				continue
-			}
+			s.runJob("restore", taskset.Name, restoreSubcommand.RepositoryLocation, task.Ping, func(run *jobRun) {
+				s.waitWindow("restore", restoreSubcommand.RepositoryLocation)
 
-			newCtx := appcontext.NewAppContextFrom(s.ctx)
+				store, config, err := s.openStore(restoreSubcommand.RepositoryLocation)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening storage: %s", err)
+					run.fail(1, err)
+					return
+				}
 
-			repo, err := repository.New(newCtx, store, config)
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening repository: %s", err)
-				store.Close()
-				continue
-			}
+				newCtx := appcontext.NewAppContextFrom(s.ctx)
 
-			retval, err := restoreSubcommand.Execute(newCtx, repo)
-			if err != nil || retval != 0 {
-				s.ctx.GetLogger().Error("Error executing restore: %s", err)
-			}
+				repo, err := repository.New(newCtx, store, config)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening repository: %s", err)
+					run.fail(1, err)
+					store.Close()
+					return
+				}
+
+				retval, err := restoreSubcommand.Execute(newCtx, repo)
+				if err != nil || retval != 0 {
+					s.ctx.GetLogger().Error("Error executing restore: %s", err)
+					run.fail(retval, err)
+				}
 
-			newCtx.Close()
-			repo.Close()
-			store.Close()
+				newCtx.Close()
+				repo.Close()
+				store.Close()
+			})
 		}
 	}()
 
@@ -266,31 +334,39 @@ func (s *Scheduler) syncTask(taskset Task, task SyncConfig) error {
 				time.Sleep(interval)
 			}
 
-			store, config, err := storage.Open(map[string]string{"location": syncSubcommand.SourceRepositoryLocation})
-			if err != nil {
-				s.ctx.GetLogger().Error("sync: error opening storage: %s", err)
-				continue
-			}
+			s.runJob("sync", taskset.Name, syncSubcommand.SourceRepositoryLocation, task.Ping, func(run *jobRun) {
+				s.waitWindow("sync", syncSubcommand.SourceRepositoryLocation)
+				s.waitWindow("sync", syncSubcommand.PeerRepositoryLocation)
 
-			newCtx := appcontext.NewAppContextFrom(s.ctx)
+				store, config, err := s.openStore(syncSubcommand.SourceRepositoryLocation)
+				if err != nil {
+					s.ctx.GetLogger().Error("sync: error opening storage: %s", err)
+					run.fail(1, err)
+					return
+				}
 
-			repo, err := repository.New(newCtx, store, config)
-			if err != nil {
-				s.ctx.GetLogger().Error("sync: error opening repository: %s", err)
-				store.Close()
-				continue
-			}
+				newCtx := appcontext.NewAppContextFrom(s.ctx)
 
-			retval, err := syncSubcommand.Execute(newCtx, repo)
-			if err != nil || retval != 0 {
-				s.ctx.GetLogger().Error("sync: %s", err)
-			} else {
-				s.ctx.GetLogger().Info("sync: synchronization succeeded")
-			}
+				repo, err := repository.New(newCtx, store, config)
+				if err != nil {
+					s.ctx.GetLogger().Error("sync: error opening repository: %s", err)
+					run.fail(1, err)
+					store.Close()
+					return
+				}
+
+				retval, err := syncSubcommand.Execute(newCtx, repo)
+				if err != nil || retval != 0 {
+					s.ctx.GetLogger().Error("sync: %s", err)
+					run.fail(retval, err)
+				} else {
+					s.ctx.GetLogger().Info("sync: synchronization succeeded")
+				}
 
-			newCtx.Close()
-			repo.Close()
-			store.Close()
+				newCtx.Close()
+				repo.Close()
+				store.Close()
+			})
 		}
 	}()
 
@@ -336,43 +412,51 @@ func (s *Scheduler) maintenanceTask(task MaintenanceConfig) error {
 				time.Sleep(interval)
 			}
 
-			store, config, err := storage.Open(map[string]string{"location": maintenanceSubcommand.RepositoryLocation})
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening storage: %s", err)
-				continue
-			}
+			s.runJob("maintenance", "", maintenanceSubcommand.RepositoryLocation, task.Ping, func(run *jobRun) {
+				s.waitWindow("maintenance", maintenanceSubcommand.RepositoryLocation)
 
-			newCtx := appcontext.NewAppContextFrom(s.ctx)
+				store, config, err := s.openStore(maintenanceSubcommand.RepositoryLocation)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening storage: %s", err)
+					run.fail(1, err)
+					return
+				}
 
-			repo, err := repository.New(newCtx, store, config)
-			if err != nil {
-				s.ctx.GetLogger().Error("Error opening repository: %s", err)
-				store.Close()
-				continue
-			}
+				newCtx := appcontext.NewAppContextFrom(s.ctx)
 
-			retval, err := maintenanceSubcommand.Execute(newCtx, repo)
-			if err != nil || retval != 0 {
-				s.ctx.GetLogger().Error("Error executing maintenance: %s", err)
-			} else {
-				s.ctx.GetLogger().Info("maintenance of repository %s succeeded", maintenanceSubcommand.RepositoryLocation)
-			}
+				repo, err := repository.New(newCtx, store, config)
+				if err != nil {
+					s.ctx.GetLogger().Error("Error opening repository: %s", err)
+					run.fail(1, err)
+					store.Close()
+					return
+				}
 
-			if task.Retention != "" {
-				rmCtx := appcontext.NewAppContextFrom(newCtx)
-				rmSubcommand.OptBefore = time.Now().Add(-retention)
-				retval, err = rmSubcommand.Execute(rmCtx, repo)
+				retval, err := maintenanceSubcommand.Execute(newCtx, repo)
 				if err != nil || retval != 0 {
-					s.ctx.GetLogger().Error("Error removing obsolete backups: %s", err)
+					s.ctx.GetLogger().Error("Error executing maintenance: %s", err)
+					run.fail(retval, err)
 				} else {
-					s.ctx.GetLogger().Info("Retention purge succeeded")
+					s.ctx.GetLogger().Info("maintenance of repository %s succeeded", maintenanceSubcommand.RepositoryLocation)
 				}
-				rmCtx.Close()
-			}
 
-			newCtx.Close()
-			repo.Close()
-			store.Close()
+				if task.Retention != "" {
+					rmCtx := appcontext.NewAppContextFrom(newCtx)
+					rmSubcommand.OptBefore = time.Now().Add(-retention)
+					retval, err = rmSubcommand.Execute(rmCtx, repo)
+					if err != nil || retval != 0 {
+						s.ctx.GetLogger().Error("Error removing obsolete backups: %s", err)
+						run.fail(retval, err)
+					} else {
+						s.ctx.GetLogger().Info("Retention purge succeeded")
+					}
+					rmCtx.Close()
+				}
+
+				newCtx.Close()
+				repo.Close()
+				store.Close()
+			})
 		}
 	}()
 
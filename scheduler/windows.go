@@ -0,0 +1,330 @@
+package scheduler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/dustin/go-humanize"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// timeWindow is a daily time range, optionally restricted to some days of
+// the week.  A range whose end precedes its start wraps around midnight
+// and belongs to the day it starts on.
+type timeWindow struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+}
+
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	h, err := strconv.Atoi(hh)
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	d, ok := weekdays[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid day %q", s)
+	}
+	return d, nil
+}
+
+// parseTimeWindow parses "[DAYS ]HH:MM-HH:MM" where DAYS is a comma
+// separated list of days or ranges of days, e.g. "mon-fri 08:00-18:00" or
+// "sat,sun 00:00-24:00".
+func parseTimeWindow(s string) (timeWindow, error) {
+	var w timeWindow
+
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		for i := range w.days {
+			w.days[i] = true
+		}
+	case 2:
+		for _, spec := range strings.Split(fields[0], ",") {
+			first, last, isRange := strings.Cut(spec, "-")
+			from, err := parseWeekday(first)
+			if err != nil {
+				return w, err
+			}
+			to := from
+			if isRange {
+				if to, err = parseWeekday(last); err != nil {
+					return w, err
+				}
+			}
+			for d := from; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == to {
+					break
+				}
+			}
+		}
+		fields = fields[1:]
+	default:
+		return w, fmt.Errorf("invalid time window %q", s)
+	}
+
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", s)
+	}
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("invalid time window %q, empty range", s)
+	}
+	return w, nil
+}
+
+func (w timeWindow) contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[today] && minutes >= w.start && minutes < w.end
+	}
+
+	yesterday := (today + 6) % 7
+	return (w.days[today] && minutes >= w.start) || (w.days[yesterday] && minutes < w.end)
+}
+
+type bandwidthWindow struct {
+	window timeWindow
+	rate   int64 // bytes per second
+}
+
+func parseRate(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "/s")
+	rate, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	if rate == 0 {
+		return 0, fmt.Errorf("invalid rate %q: must not be zero", s)
+	}
+	return int64(rate), nil
+}
+
+// repositoryWindows holds the blackout and bandwidth windows of a
+// repository, shared by all the tasks targeting it.
+type repositoryWindows struct {
+	blackout  []timeWindow
+	bandwidth []bandwidthWindow
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRepositoryWindows(config WindowConfig) (*repositoryWindows, error) {
+	rw := &repositoryWindows{}
+	for _, spec := range config.Blackout {
+		w, err := parseTimeWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		rw.blackout = append(rw.blackout, w)
+	}
+	for _, bw := range config.Bandwidth {
+		w, err := parseTimeWindow(bw.Hours)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := parseRate(bw.Rate)
+		if err != nil {
+			return nil, err
+		}
+		rw.bandwidth = append(rw.bandwidth, bandwidthWindow{window: w, rate: rate})
+	}
+	return rw, nil
+}
+
+func (rw *repositoryWindows) inBlackout(t time.Time) bool {
+	for _, w := range rw.blackout {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// rate returns the bandwidth allowed at t, the first matching window wins
+// and 0 means unlimited.
+func (rw *repositoryWindows) rate(t time.Time) int64 {
+	for _, bw := range rw.bandwidth {
+		if bw.window.contains(t) {
+			return bw.rate
+		}
+	}
+	return 0
+}
+
+// wait blocks until n bytes may be transferred.  The lock is held while
+// sleeping so that concurrent tasks share the bandwidth rather than each
+// getting the full rate.
+func (rw *repositoryWindows) wait(n int) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	now := time.Now()
+	rate := rw.rate(now)
+	if rate == 0 {
+		rw.tokens = 0
+		rw.last = now
+		return
+	}
+
+	if !rw.last.IsZero() {
+		rw.tokens += now.Sub(rw.last).Seconds() * float64(rate)
+	}
+	// allow at most one second worth of burst
+	if rw.tokens > float64(rate) {
+		rw.tokens = float64(rate)
+	}
+	rw.last = now
+
+	rw.tokens -= float64(n)
+	if rw.tokens < 0 {
+		delay := time.Duration(-rw.tokens / float64(rate) * float64(time.Second))
+		time.Sleep(delay)
+		rw.tokens = 0
+		rw.last = time.Now()
+	}
+}
+
+const throttleChunkSize = 64 * 1024
+
+type throttledReader struct {
+	rd      io.Reader
+	windows *repositoryWindows
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := r.rd.Read(p)
+	if n > 0 {
+		r.windows.wait(n)
+	}
+	return n, err
+}
+
+// throttledStore applies the bandwidth windows of a repository to the
+// packfiles and states transferred to and from its store.
+type throttledStore struct {
+	storage.Store
+	windows *repositoryWindows
+}
+
+func (s *throttledStore) reader(rd io.Reader) io.Reader {
+	return &throttledReader{rd: rd, windows: s.windows}
+}
+
+func (s *throttledStore) PutState(mac objects.MAC, rd io.Reader) error {
+	return s.Store.PutState(mac, s.reader(rd))
+}
+
+func (s *throttledStore) GetState(mac objects.MAC) (io.Reader, error) {
+	rd, err := s.Store.GetState(mac)
+	if err != nil {
+		return nil, err
+	}
+	return s.reader(rd), nil
+}
+
+func (s *throttledStore) PutPackfile(mac objects.MAC, rd io.Reader) error {
+	return s.Store.PutPackfile(mac, s.reader(rd))
+}
+
+func (s *throttledStore) GetPackfile(mac objects.MAC) (io.Reader, error) {
+	rd, err := s.Store.GetPackfile(mac)
+	if err != nil {
+		return nil, err
+	}
+	return s.reader(rd), nil
+}
+
+func (s *throttledStore) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
+	rd, err := s.Store.GetPackfileBlob(mac, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return s.reader(rd), nil
+}
+
+// waitWindow blocks while the repository at location is in one of its
+// blackout windows.
+func (s *Scheduler) waitWindow(task string, location string) {
+	rw, ok := s.windows[location]
+	if !ok {
+		return
+	}
+
+	logged := false
+	for rw.inBlackout(time.Now()) {
+		if !logged {
+			s.ctx.GetLogger().Info("%s: repository %s is in a blackout window, postponing", task, location)
+			logged = true
+		}
+		select {
+		case <-time.After(time.Minute):
+		case <-s.ctx.GetContext().Done():
+			return
+		}
+	}
+}
+
+// openStore opens the store at location, throttled according to the
+// bandwidth windows configured for it.
+func (s *Scheduler) openStore(location string) (storage.Store, []byte, error) {
+	return s.openStoreConfig(map[string]string{"location": location})
+}
+
+// openStoreConfig is openStore for a store needing more than a location,
+// e.g. credentials.
+func (s *Scheduler) openStoreConfig(storeConfig map[string]string) (storage.Store, []byte, error) {
+	store, config, err := storage.Open(storeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rw, ok := s.windows[storeConfig["location"]]; ok && len(rw.bandwidth) != 0 {
+		store = &throttledStore{Store: store, windows: rw}
+	}
+	return store, config, nil
+}
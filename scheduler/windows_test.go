@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindow(t *testing.T) {
+	// 2025-01-06 is a Monday
+	at := func(day int, hh, mm int) time.Time {
+		return time.Date(2025, 1, 6+day, hh, mm, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{"08:00-18:00", at(0, 8, 0), true},
+		{"08:00-18:00", at(0, 18, 0), false},
+		{"mon-fri 08:00-18:00", at(4, 12, 0), true},
+		{"mon-fri 08:00-18:00", at(5, 12, 0), false},
+		{"sat,sun 00:00-24:00", at(6, 23, 59), true},
+		{"fri-mon 10:00-11:00", at(0, 10, 30), true},
+		{"fri-mon 10:00-11:00", at(1, 10, 30), false},
+		{"22:00-06:00", at(0, 23, 0), true},
+		{"22:00-06:00", at(0, 5, 0), true},
+		{"22:00-06:00", at(0, 12, 0), false},
+		{"fri 22:00-06:00", at(5, 5, 0), true},
+		{"fri 22:00-06:00", at(6, 5, 0), false},
+	}
+
+	for _, test := range tests {
+		w, err := parseTimeWindow(test.window)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.window, err)
+		}
+		if got := w.contains(test.t); got != test.want {
+			t.Errorf("%q contains %s: got %v, want %v", test.window, test.t.Format("Mon 15:04"), got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "08:00", "25:00-26:00", "08:00-08:00", "xyz 08:00-09:00", "mon 08:00-09:00 extra"} {
+		if _, err := parseTimeWindow(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestRepositoryWindows(t *testing.T) {
+	rw, err := newRepositoryWindows(WindowConfig{
+		Repository: "/tmp/repo",
+		Blackout:   []string{"12:00-13:00"},
+		Bandwidth: []BandwidthConfig{
+			{Hours: "08:00-18:00", Rate: "1MB/s"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	noon := time.Date(2025, 1, 6, 12, 30, 0, 0, time.UTC)
+	night := time.Date(2025, 1, 6, 23, 0, 0, 0, time.UTC)
+
+	if !rw.inBlackout(noon) || rw.inBlackout(night) {
+		t.Errorf("unexpected blackout evaluation")
+	}
+	if rate := rw.rate(noon); rate != 1000*1000 {
+		t.Errorf("unexpected rate during office hours: %d", rate)
+	}
+	if rate := rw.rate(night); rate != 0 {
+		t.Errorf("unexpected rate at night: %d", rate)
+	}
+
+	if _, err := newRepositoryWindows(WindowConfig{Bandwidth: []BandwidthConfig{{Hours: "08:00-18:00", Rate: "fast"}}}); err == nil {
+		t.Errorf("expected an error on an invalid rate")
+	}
+}
@@ -0,0 +1,73 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/PlakarKorp/plakar/identity"
+)
+
+var registry *identity.Registry
+
+// maxEnrollRequestSize bounds the body of the requests to the enrollment
+// endpoints, which are reachable without authentication.
+const maxEnrollRequestSize = 64 * 1024
+
+// enroll records the enrollment request of a client and returns its
+// status, along with its certificate once approved by an administrator.
+func enroll(w http.ResponseWriter, r *http.Request) {
+	var req identity.Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnrollRequestSize)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client, err := registry.Submit(&req)
+	if errors.Is(err, identity.ErrInvalidSignature) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, identity.ErrIdentifierInUse) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, identity.ErrTooManyPending) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(client); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// profile returns the profile of an enrolled client, which authenticates
+// by signing its request.
+func profile(w http.ResponseWriter, r *http.Request) {
+	var req identity.ProfileRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnrollRequestSize)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientProfile, err := registry.Profile(&req)
+	if errors.Is(err, identity.ErrClientNotFound) || errors.Is(err, identity.ErrInvalidSignature) ||
+		errors.Is(err, identity.ErrNotApproved) || errors.Is(err, identity.ErrStaleRequest) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if errors.Is(err, identity.ErrNoProfile) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(clientProfile); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -7,13 +7,25 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/PlakarKorp/plakar/identity"
 	"github.com/PlakarKorp/plakar/network"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/server/webhook"
 	"github.com/PlakarKorp/plakar/storage"
 )
 
 var store storage.Store
 var lNoDelete bool
+var lAllowConfig bool
+var watcher *snapshotWatcher
+
+// notifyStateChange lets the watcher, if any, look for snapshot changes
+// once a client has pushed or removed a state.
+func notifyStateChange() {
+	if watcher != nil {
+		go watcher.refresh()
+	}
+}
 
 func openRepository(w http.ResponseWriter, r *http.Request) {
 	var reqOpen network.ReqOpen
@@ -37,6 +49,28 @@ func openRepository(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func putConfig(w http.ResponseWriter, r *http.Request) {
+	if !lAllowConfig {
+		http.Error(w, fmt.Errorf("not allowed to overwrite configuration").Error(), http.StatusForbidden)
+		return
+	}
+
+	var reqPutConfig network.ReqPutConfig
+	if err := json.NewDecoder(r.Body).Decode(&reqPutConfig); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resPutConfig network.ResPutConfig
+	if err := store.PutConfig(reqPutConfig.Configuration); err != nil {
+		resPutConfig.Err = err.Error()
+	}
+	if err := json.NewEncoder(w).Encode(resPutConfig); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // states
 func getStates(w http.ResponseWriter, r *http.Request) {
 	var reqGetIndexes network.ReqGetStates
@@ -70,6 +104,8 @@ func putState(w http.ResponseWriter, r *http.Request) {
 	err := store.PutState(reqPutState.MAC, bytes.NewBuffer(data))
 	if err != nil {
 		resPutIndex.Err = err.Error()
+	} else {
+		notifyStateChange()
 	}
 	if err := json.NewEncoder(w).Encode(resPutIndex); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -118,6 +154,8 @@ func deleteState(w http.ResponseWriter, r *http.Request) {
 	err := store.DeleteState(reqDeleteState.MAC)
 	if err != nil {
 		resDeleteState.Err = err.Error()
+	} else {
+		notifyStateChange()
 	}
 	if err := json.NewEncoder(w).Encode(resDeleteState); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -319,11 +357,22 @@ func deleteLock(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Server(repo *repository.Repository, addr string, noDelete bool) error {
+func Server(repo *repository.Repository, addr string, noDelete bool, allowConfig bool, notifier *webhook.Notifier, verify bool, clients *identity.Registry) error {
 	lNoDelete = noDelete
+	lAllowConfig = allowConfig
 	store = repo.Store()
+	registry = clients
+
+	if notifier != nil {
+		w, err := newSnapshotWatcher(repo, notifier, verify)
+		if err != nil {
+			return err
+		}
+		watcher = w
+	}
 
 	http.HandleFunc("GET /", openRepository)
+	http.HandleFunc("PUT /", putConfig)
 
 	http.HandleFunc("GET /states", getStates)
 	http.HandleFunc("PUT /state", putState)
@@ -341,5 +390,10 @@ func Server(repo *repository.Repository, addr string, noDelete bool) error {
 	http.HandleFunc("GET /lock", getLock)
 	http.HandleFunc("DELETE /lock", deleteLock)
 
+	if registry != nil {
+		http.HandleFunc("POST /enroll", enroll)
+		http.HandleFunc("POST /profile", profile)
+	}
+
 	return http.ListenAndServe(addr, nil)
 }
@@ -0,0 +1,103 @@
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/server/webhook"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+// snapshotWatcher tracks the snapshots of the repository as states are
+// pushed or removed by clients, and fires webhooks on changes.
+type snapshotWatcher struct {
+	mu       sync.Mutex
+	repo     *repository.Repository
+	notifier *webhook.Notifier
+	verify   bool
+	known    map[objects.MAC]struct{}
+}
+
+func newSnapshotWatcher(repo *repository.Repository, notifier *webhook.Notifier, verify bool) (*snapshotWatcher, error) {
+	if err := repo.RebuildState(); err != nil {
+		return nil, err
+	}
+
+	known := make(map[objects.MAC]struct{})
+	for snapshotID := range repo.ListSnapshots() {
+		known[snapshotID] = struct{}{}
+	}
+
+	return &snapshotWatcher{
+		repo:     repo,
+		notifier: notifier,
+		verify:   verify,
+		known:    known,
+	}, nil
+}
+
+func (w *snapshotWatcher) payload(event string, snapshotID objects.MAC, message string) webhook.Payload {
+	return webhook.Payload{
+		Event:      event,
+		Repository: w.repo.Location(),
+		SnapshotID: fmt.Sprintf("%x", snapshotID),
+		Message:    message,
+	}
+}
+
+// refresh rebuilds the repository state and notifies the snapshots that
+// appeared or disappeared since the previous call.
+func (w *snapshotWatcher) refresh() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	logger := w.repo.Logger()
+	ctx := w.repo.AppContext().GetContext()
+
+	if err := w.repo.RebuildState(); err != nil {
+		logger.Error("webhook: could not rebuild state: %s", err)
+		return
+	}
+
+	current := make(map[objects.MAC]struct{})
+	for snapshotID := range w.repo.ListSnapshots() {
+		current[snapshotID] = struct{}{}
+	}
+
+	for snapshotID := range current {
+		if _, exists := w.known[snapshotID]; !exists {
+			w.notifier.Notify(ctx, w.payload(webhook.EventSnapshotCreated, snapshotID, ""))
+			if w.verify {
+				w.check(ctx, snapshotID)
+			}
+		}
+	}
+	for snapshotID := range w.known {
+		if _, exists := current[snapshotID]; !exists {
+			w.notifier.Notify(ctx, w.payload(webhook.EventSnapshotDeleted, snapshotID, ""))
+		}
+	}
+	w.known = current
+}
+
+func (w *snapshotWatcher) check(ctx context.Context, snapshotID objects.MAC) {
+	snap, err := snapshot.Load(w.repo, snapshotID)
+	if err != nil {
+		w.notifier.Notify(ctx, w.payload(webhook.EventCheckFailed, snapshotID, err.Error()))
+		return
+	}
+	defer snap.Close()
+
+	opts := &snapshot.CheckOptions{
+		MaxConcurrency: uint64(w.repo.AppContext().MaxConcurrency),
+		FastCheck:      true,
+	}
+	if ok, err := snap.Check(snap.Header.GetSource(0).Importer.Root(), opts); err != nil {
+		w.notifier.Notify(ctx, w.payload(webhook.EventCheckFailed, snapshotID, err.Error()))
+	} else if !ok {
+		w.notifier.Notify(ctx, w.payload(webhook.EventCheckFailed, snapshotID, "snapshot is corrupted"))
+	}
+}
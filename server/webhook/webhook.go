@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logging"
+)
+
+const (
+	EventSnapshotCreated = "snapshot.created"
+	EventSnapshotDeleted = "snapshot.deleted"
+	EventCheckFailed     = "check.failed"
+)
+
+// SignatureHeader holds the hex-encoded HMAC-SHA256 of the request body,
+// computed with the shared secret, so that receivers can authenticate the
+// payloads.
+const SignatureHeader = "X-Plakar-Signature"
+
+var ErrUnsigned = errors.New("webhook payloads would be sent unsigned, a secret is required")
+
+type Payload struct {
+	Event      string    `json:"event"`
+	Timestamp  time.Time `json:"timestamp"`
+	Repository string    `json:"repository"`
+	SnapshotID string    `json:"snapshot_id,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+type Options struct {
+	URLs   []string
+	Secret []byte
+	// AllowUnsigned lets payloads be sent without a signature when there
+	// is no secret, receivers then having no way to authenticate them.
+	AllowUnsigned bool
+	Retries       int
+	Backoff       time.Duration
+	Timeout       time.Duration
+}
+
+func NewDefaultOptions() *Options {
+	return &Options{
+		URLs:    []string{},
+		Retries: 5,
+		Backoff: time.Second,
+		Timeout: 10 * time.Second,
+	}
+}
+
+type Notifier struct {
+	opts   *Options
+	client *http.Client
+	logger *logging.Logger
+	wg     sync.WaitGroup
+}
+
+// Validate refuses options under which payloads would be sent unsigned
+// without it being explicitly allowed.
+func (o *Options) Validate() error {
+	if len(o.URLs) != 0 && len(o.Secret) == 0 && !o.AllowUnsigned {
+		return ErrUnsigned
+	}
+	return nil
+}
+
+func NewNotifier(logger *logging.Logger, opts *Options) *Notifier {
+	if opts == nil {
+		opts = NewDefaultOptions()
+	}
+	return &Notifier{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		logger: logger,
+	}
+}
+
+// Sign returns the signature of body for the given secret.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify delivers payload to all configured URLs in the background.
+func (n *Notifier) Notify(ctx context.Context, payload Payload) {
+	if payload.Timestamp.IsZero() {
+		payload.Timestamp = time.Now()
+	}
+
+	if err := n.opts.Validate(); err != nil {
+		n.logger.Error("webhook: not delivering %s event: %s", payload.Event, err)
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		n.logger.Error("webhook: could not encode payload: %s", err)
+		return
+	}
+
+	for _, url := range n.opts.URLs {
+		n.wg.Add(1)
+		go func(url string) {
+			defer n.wg.Done()
+			if err := n.deliver(ctx, url, body); err != nil {
+				n.logger.Error("webhook: %s: could not deliver %s event: %s", url, payload.Event, err)
+			}
+		}(url)
+	}
+}
+
+// Wait blocks until all pending deliveries are done.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(ctx context.Context, url string, body []byte) error {
+	backoff := n.opts.Backoff
+
+	var err error
+	for attempt := 0; attempt <= n.opts.Retries; attempt++ {
+		if attempt != 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if err = n.post(ctx, url, body); err == nil {
+			return nil
+		}
+		n.logger.Warn("webhook: %s: attempt %d failed: %s", url, attempt+1, err)
+	}
+	return err
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.opts.Secret) != 0 {
+		req.Header.Set(SignatureHeader, Sign(n.opts.Secret, body))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return nil
+}
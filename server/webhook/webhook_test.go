@@ -0,0 +1,117 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifySigned(t *testing.T) {
+	secret := []byte("secret")
+	received := make(chan Payload, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, Sign(secret, body), r.Header.Get(SignatureHeader))
+
+		var payload Payload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received <- payload
+	}))
+	defer srv.Close()
+
+	opts := NewDefaultOptions()
+	opts.URLs = []string{srv.URL}
+	opts.Secret = secret
+
+	notifier := NewNotifier(logging.NewLogger(bytes.NewBuffer(nil), bytes.NewBuffer(nil)), opts)
+	notifier.Notify(context.Background(), Payload{Event: EventSnapshotCreated, SnapshotID: "abcd"})
+	notifier.Wait()
+
+	payload := <-received
+	require.Equal(t, EventSnapshotCreated, payload.Event)
+	require.Equal(t, "abcd", payload.SnapshotID)
+	require.False(t, payload.Timestamp.IsZero())
+}
+
+func TestNotifyRetries(t *testing.T) {
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	opts := NewDefaultOptions()
+	opts.URLs = []string{srv.URL}
+	opts.Secret = []byte("secret")
+	opts.Backoff = time.Millisecond
+
+	notifier := NewNotifier(logging.NewLogger(bytes.NewBuffer(nil), bytes.NewBuffer(nil)), opts)
+	notifier.Notify(context.Background(), Payload{Event: EventSnapshotDeleted})
+	notifier.Wait()
+
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	opts := NewDefaultOptions()
+	opts.URLs = []string{srv.URL}
+	opts.Secret = []byte("secret")
+	opts.Retries = 2
+	opts.Backoff = time.Millisecond
+
+	notifier := NewNotifier(logging.NewLogger(bytes.NewBuffer(nil), bytes.NewBuffer(nil)), opts)
+	notifier.Notify(context.Background(), Payload{Event: EventCheckFailed})
+	notifier.Wait()
+
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+func TestNotifyUnsigned(t *testing.T) {
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		require.Empty(t, r.Header.Get(SignatureHeader))
+	}))
+	defer srv.Close()
+
+	opts := NewDefaultOptions()
+	opts.URLs = []string{srv.URL}
+	require.ErrorIs(t, opts.Validate(), ErrUnsigned)
+
+	// nothing is sent unsigned unless allowed
+	notifier := NewNotifier(logging.NewLogger(bytes.NewBuffer(nil), bytes.NewBuffer(nil)), opts)
+	notifier.Notify(context.Background(), Payload{Event: EventSnapshotCreated})
+	notifier.Wait()
+	require.Equal(t, int32(0), attempts.Load())
+
+	opts.AllowUnsigned = true
+	require.NoError(t, opts.Validate())
+	notifier.Notify(context.Background(), Payload{Event: EventSnapshotCreated})
+	notifier.Wait()
+	require.Equal(t, int32(1), attempts.Load())
+}
@@ -0,0 +1,122 @@
+package similarity
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+var ErrInvalidDelta = errors.New("invalid delta")
+
+const (
+	opInsert = 0
+	opCopy   = 1
+
+	blockSize = 16
+)
+
+func blockHash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// Diff encodes target as a sequence of copies from base and literal
+// insertions, in the fashion of xdelta.  The result is only meaningful to
+// Patch with the same base.
+func Diff(base, target []byte) []byte {
+	index := make(map[uint64]int, len(base)/blockSize)
+	for off := 0; off+blockSize <= len(base); off += blockSize {
+		h := blockHash(base[off : off+blockSize])
+		if _, exists := index[h]; !exists {
+			index[h] = off
+		}
+	}
+
+	out := binary.AppendUvarint(nil, uint64(len(target)))
+
+	literal := 0
+	flush := func(end int) {
+		if end > literal {
+			out = append(out, opInsert)
+			out = binary.AppendUvarint(out, uint64(end-literal))
+			out = append(out, target[literal:end]...)
+		}
+	}
+
+	for pos := 0; pos+blockSize <= len(target); {
+		off, ok := index[blockHash(target[pos:pos+blockSize])]
+		if !ok || string(base[off:off+blockSize]) != string(target[pos:pos+blockSize]) {
+			pos++
+			continue
+		}
+
+		// extend the match backward over the pending literal, then forward
+		start := pos
+		for start > literal && off > 0 && base[off-1] == target[start-1] {
+			start--
+			off--
+		}
+		end := pos + blockSize
+		for end < len(target) && off+(end-start) < len(base) && base[off+(end-start)] == target[end] {
+			end++
+		}
+
+		flush(start)
+		out = append(out, opCopy)
+		out = binary.AppendUvarint(out, uint64(off))
+		out = binary.AppendUvarint(out, uint64(end-start))
+
+		literal = end
+		pos = end
+	}
+	flush(len(target))
+
+	return out
+}
+
+// Patch rebuilds the target encoded by Diff from its base.
+func Patch(base, delta []byte) ([]byte, error) {
+	size, n := binary.Uvarint(delta)
+	if n <= 0 {
+		return nil, ErrInvalidDelta
+	}
+	delta = delta[n:]
+
+	// size is only a hint, don't trust it for the allocation
+	out := make([]byte, 0, min(size, uint64(len(base)+len(delta))))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		switch op {
+		case opInsert:
+			length, n := binary.Uvarint(delta)
+			if n <= 0 || length > uint64(len(delta)-n) {
+				return nil, ErrInvalidDelta
+			}
+			delta = delta[n:]
+			out = append(out, delta[:length]...)
+			delta = delta[length:]
+		case opCopy:
+			off, n := binary.Uvarint(delta)
+			if n <= 0 {
+				return nil, ErrInvalidDelta
+			}
+			delta = delta[n:]
+			length, n := binary.Uvarint(delta)
+			if n <= 0 || off > uint64(len(base)) || length > uint64(len(base))-off {
+				return nil, ErrInvalidDelta
+			}
+			delta = delta[n:]
+			out = append(out, base[off:off+length]...)
+		default:
+			return nil, ErrInvalidDelta
+		}
+	}
+
+	if uint64(len(out)) != size {
+		return nil, ErrInvalidDelta
+	}
+	return out, nil
+}
@@ -0,0 +1,74 @@
+// Package similarity implements the detection of similar chunks through
+// feature sketches, and the delta encoding of a chunk against a similar
+// one.
+package similarity
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+)
+
+const (
+	// Chunks smaller than MinSize are not worth delta encoding.
+	MinSize = 1024
+
+	numFeatures      = 12
+	featuresPerSuper = 4
+
+	// NumSuperFeatures is the number of super-features in a sketch, two
+	// chunks sharing any of them are likely to be similar.
+	NumSuperFeatures = numFeatures / featuresPerSuper
+)
+
+var (
+	gear        [256]uint64
+	multipliers [numFeatures]uint64
+	offsets     [numFeatures]uint64
+)
+
+func init() {
+	// The tables must be the same across runs and hosts, hence the fixed
+	// seed: sketches are compared with the ones recorded by earlier runs.
+	rnd := rand.New(rand.NewSource(0x706c616b6172))
+	for i := range gear {
+		gear[i] = rnd.Uint64()
+	}
+	for i := 0; i < numFeatures; i++ {
+		multipliers[i] = rnd.Uint64() | 1
+		offsets[i] = rnd.Uint64()
+	}
+}
+
+// Sketch summarizes the content of a chunk as super-features, each
+// grouping features which are the maxima of a linear transform of the
+// rolling hash over the chunk.  Shifting or editing a small part of the
+// content leaves most features untouched.
+type Sketch [NumSuperFeatures]uint64
+
+func NewSketch(data []byte) Sketch {
+	var features [numFeatures]uint64
+
+	var fp uint64
+	for _, b := range data {
+		// gear hash, bytes older than 64 positions have shifted out
+		fp = (fp << 1) + gear[b]
+		for i := 0; i < numFeatures; i++ {
+			if v := multipliers[i]*fp + offsets[i]; v > features[i] {
+				features[i] = v
+			}
+		}
+	}
+
+	var sketch Sketch
+	buf := make([]byte, 8*featuresPerSuper)
+	for i := range sketch {
+		for j := 0; j < featuresPerSuper; j++ {
+			binary.LittleEndian.PutUint64(buf[j*8:], features[i*featuresPerSuper+j])
+		}
+		h := fnv.New64a()
+		h.Write(buf)
+		sketch[i] = h.Sum64()
+	}
+	return sketch
+}
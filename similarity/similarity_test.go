@@ -0,0 +1,75 @@
+package similarity
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomBytes(seed int64, size int) []byte {
+	buf := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(buf)
+	return buf
+}
+
+func TestDiffPatch(t *testing.T) {
+	base := randomBytes(1, 64<<10)
+
+	// content shifted by an insertion and a local edit
+	target := append([]byte("inserted header line\n"), base...)
+	copy(target[30000:], []byte("an edit in the middle of the chunk"))
+	target = append(target, []byte("appended trailer")...)
+
+	delta := Diff(base, target)
+	require.Less(t, len(delta), len(target)/10)
+
+	patched, err := Patch(base, delta)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(target, patched))
+
+	// unrelated data round-trips as literals
+	other := randomBytes(2, 4096)
+	patched, err = Patch(base, Diff(base, other))
+	require.NoError(t, err)
+	require.Equal(t, other, patched)
+
+	patched, err = Patch(base, Diff(base, nil))
+	require.NoError(t, err)
+	require.Empty(t, patched)
+}
+
+func TestPatchInvalid(t *testing.T) {
+	base := randomBytes(1, 1024)
+	delta := Diff(base, base)
+
+	_, err := Patch(base[:512], delta)
+	require.ErrorIs(t, err, ErrInvalidDelta)
+
+	_, err = Patch(base, delta[:len(delta)-1])
+	require.ErrorIs(t, err, ErrInvalidDelta)
+
+	_, err = Patch(base, []byte{})
+	require.ErrorIs(t, err, ErrInvalidDelta)
+}
+
+func TestSketch(t *testing.T) {
+	base := randomBytes(1, 32<<10)
+	edited := append([]byte{}, base...)
+	copy(edited[1000:], []byte("small edit"))
+
+	shared := func(a, b Sketch) int {
+		n := 0
+		for i := range a {
+			if a[i] == b[i] {
+				n++
+			}
+		}
+		return n
+	}
+
+	require.Equal(t, NewSketch(base), NewSketch(base))
+	require.Greater(t, shared(NewSketch(base), NewSketch(edited)), 0)
+	require.Equal(t, 0, shared(NewSketch(base), NewSketch(randomBytes(3, 32<<10))))
+}
@@ -0,0 +1,274 @@
+package snapshot
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/PlakarKorp/plakar/btree"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/timestamping"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const ATTESTATION_VERSION = "1.0.0"
+
+// AttestationRepository holds what is needed to recompute the MACs of the
+// repository a snapshot belongs to, given its passphrase if encrypted.
+type AttestationRepository struct {
+	RepositoryID uuid.UUID                 `json:"repository_id"`
+	Hashing      string                    `json:"hashing"`
+	Encryption   *encryption.Configuration `json:"encryption,omitempty"`
+}
+
+// Attestation is a self-contained proof that a file was part of a snapshot:
+// every blob on the path from the snapshot header down to the file object,
+// each one referenced by MAC from the previous one.
+type Attestation struct {
+	Version    string                `json:"version"`
+	Path       string                `json:"path"`
+	Repository AttestationRepository `json:"repository"`
+	Header     []byte                `json:"header"`
+	Signature  []byte                `json:"signature,omitempty"`
+	Timestamp  []byte                `json:"timestamp,omitempty"`
+	VFSRoot    []byte                `json:"vfs_root"`
+	VFSNodes   [][]byte              `json:"vfs_nodes"`
+	Entry      []byte                `json:"entry"`
+	Object     []byte                `json:"object"`
+}
+
+type AttestationResult struct {
+	SnapshotID     objects.MAC
+	Path           string
+	Timestamp      time.Time
+	Identity       uuid.UUID
+	PublicKey      []byte
+	Signed         bool
+	Size           int64
+	Chunks         int
+	ContentMAC     objects.MAC
+	ContentChecked bool
+	Receipt        *timestamping.Receipt
+}
+
+// Attest builds the attestation of the regular file at pathname.
+func (snap *Snapshot) Attest(pathname string) (*Attestation, error) {
+	pathname = path.Clean("/" + pathname)
+
+	config := snap.repository.Configuration()
+	att := &Attestation{
+		Version: ATTESTATION_VERSION,
+		Path:    pathname,
+		Repository: AttestationRepository{
+			RepositoryID: config.RepositoryID,
+			Hashing:      config.Hashing.Algorithm,
+			Encryption:   config.Encryption,
+		},
+	}
+
+	var err error
+	if att.Header, err = snap.GetBlob(resources.RT_SNAPSHOT, snap.Header.Identifier); err != nil {
+		return nil, err
+	}
+	if snap.Header.Identity.Identifier != uuid.Nil {
+		if att.Signature, err = snap.GetBlob(resources.RT_SIGNATURE, snap.Header.Identifier); err != nil {
+			return nil, err
+		}
+	}
+	if snap.HasTimestamp() {
+		if att.Timestamp, err = snap.GetTimestamp(); err != nil {
+			return nil, err
+		}
+	}
+
+	if att.VFSRoot, err = snap.GetBlob(resources.RT_VFS_BTREE, snap.Header.GetSource(0).VFS.Root); err != nil {
+		return nil, err
+	}
+	var tree btree.BTree[string, objects.MAC, objects.MAC]
+	if err := msgpack.Unmarshal(att.VFSRoot, &tree); err != nil {
+		return nil, err
+	}
+
+	ptr := tree.Root
+	var entryMAC objects.MAC
+	for {
+		data, err := snap.GetBlob(resources.RT_VFS_NODE, ptr)
+		if err != nil {
+			return nil, err
+		}
+		att.VFSNodes = append(att.VFSNodes, data)
+
+		node, err := vfs.NodeFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		if node.IsLeaf() {
+			mac, found := node.Lookup(pathname, vfs.PathCmp)
+			if !found {
+				return nil, fs.ErrNotExist
+			}
+			entryMAC = mac
+			break
+		}
+		ptr = node.Child(pathname, vfs.PathCmp)
+	}
+
+	if att.Entry, err = snap.GetBlob(resources.RT_VFS_ENTRY, entryMAC); err != nil {
+		return nil, err
+	}
+	entry, err := vfs.EntryFromBytes(att.Entry)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.HasObject() {
+		return nil, fmt.Errorf("%s: not a regular file", pathname)
+	}
+
+	if att.Object, err = snap.GetBlob(resources.RT_OBJECT, entry.Object); err != nil {
+		return nil, err
+	}
+	return att, nil
+}
+
+func (att *Attestation) macHasher(secret []byte) (func() hash.Hash, error) {
+	if secret == nil {
+		// same derivation as unencrypted repositories
+		hasher := hashing.GetHasher(att.Repository.Hashing)
+		if hasher == nil {
+			return nil, fmt.Errorf("unsupported hashing algorithm %q", att.Repository.Hashing)
+		}
+		hasher.Write(att.Repository.RepositoryID[:])
+		secret = hasher.Sum(nil)
+	}
+	if hashing.GetMACHasher(att.Repository.Hashing, secret) == nil {
+		return nil, fmt.Errorf("unsupported hashing algorithm %q", att.Repository.Hashing)
+	}
+	return func() hash.Hash {
+		return hashing.GetMACHasher(att.Repository.Hashing, secret)
+	}, nil
+}
+
+// Verify checks the chain of MACs from the header down to the file object
+// and the signature and timestamp of the header, if any.  secret is the
+// key of the repository, nil if it is not encrypted.  If content is not
+// nil, it must match the attested file.
+func (att *Attestation) Verify(secret []byte, content io.Reader) (*AttestationResult, error) {
+	newHasher, err := att.macHasher(secret)
+	if err != nil {
+		return nil, err
+	}
+	computeMAC := func(data []byte) (mac objects.MAC) {
+		hasher := newHasher()
+		hasher.Write(data)
+		copy(mac[:], hasher.Sum(nil))
+		return
+	}
+
+	hdr, err := header.NewFromBytes(att.Header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	hdrMAC := computeMAC(att.Header)
+
+	result := &AttestationResult{
+		SnapshotID: hdr.Identifier,
+		Path:       att.Path,
+		Timestamp:  hdr.Timestamp,
+		Identity:   hdr.Identity.Identifier,
+	}
+
+	if hdr.Identity.Identifier != uuid.Nil {
+		if !ed25519.Verify(hdr.Identity.PublicKey, hdrMAC[:], att.Signature) {
+			return nil, fmt.Errorf("invalid header signature")
+		}
+		result.Signed = true
+		result.PublicKey = hdr.Identity.PublicKey
+	}
+
+	if att.Timestamp != nil {
+		digest := sha256.Sum256(hdrMAC[:])
+		if result.Receipt, err = timestamping.Verify(att.Timestamp, digest[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if computeMAC(att.VFSRoot) != hdr.GetSource(0).VFS.Root {
+		return nil, fmt.Errorf("VFS root does not match the header")
+	}
+	var tree btree.BTree[string, objects.MAC, objects.MAC]
+	if err := msgpack.Unmarshal(att.VFSRoot, &tree); err != nil {
+		return nil, err
+	}
+
+	ptr := tree.Root
+	var entryMAC objects.MAC
+	for i, data := range att.VFSNodes {
+		if computeMAC(data) != ptr {
+			return nil, fmt.Errorf("VFS node %d does not match its parent", i)
+		}
+		node, err := vfs.NodeFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		if node.IsLeaf() {
+			if i != len(att.VFSNodes)-1 {
+				return nil, fmt.Errorf("unexpected VFS nodes after leaf")
+			}
+			mac, found := node.Lookup(att.Path, vfs.PathCmp)
+			if !found {
+				return nil, fmt.Errorf("%s: not found in VFS leaf", att.Path)
+			}
+			entryMAC = mac
+			break
+		}
+		if i == len(att.VFSNodes)-1 {
+			return nil, fmt.Errorf("missing VFS leaf")
+		}
+		ptr = node.Child(att.Path, vfs.PathCmp)
+	}
+
+	if computeMAC(att.Entry) != entryMAC {
+		return nil, fmt.Errorf("VFS entry does not match its leaf")
+	}
+	entry, err := vfs.EntryFromBytes(att.Entry)
+	if err != nil {
+		return nil, err
+	}
+	if computeMAC(att.Object) != entry.Object {
+		return nil, fmt.Errorf("object does not match its VFS entry")
+	}
+	object, err := objects.NewObjectFromBytes(att.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Size = object.Size()
+	result.Chunks = len(object.Chunks)
+	result.ContentMAC = object.ContentMAC
+
+	if content != nil {
+		hasher := newHasher()
+		if _, err := io.Copy(hasher, content); err != nil {
+			return nil, err
+		}
+		var mac objects.MAC
+		copy(mac[:], hasher.Sum(nil))
+		if mac != object.ContentMAC {
+			return nil, fmt.Errorf("content does not match the attested file")
+		}
+		result.ContentChecked = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package snapshot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttest(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	pathname := snap.Header.GetSource(0).Importer.Directory + "/dummy.txt"
+
+	att, err := snap.Attest(pathname)
+	require.NoError(t, err)
+	require.Equal(t, pathname, att.Path)
+	require.NotEmpty(t, att.VFSNodes)
+
+	result, err := att.Verify(nil, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.Equal(t, snap.Header.Identifier, result.SnapshotID)
+	require.Equal(t, int64(5), result.Size)
+	require.True(t, result.ContentChecked)
+	require.False(t, result.Signed)
+
+	_, err = att.Verify(nil, strings.NewReader("hellO"))
+	require.Error(t, err)
+
+	att.Entry[len(att.Entry)-1] ^= 0xff
+	_, err = att.Verify(nil, nil)
+	require.Error(t, err)
+
+	_, err = snap.Attest(pathname + ".missing")
+	require.Error(t, err)
+}
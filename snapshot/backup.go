@@ -1,14 +1,12 @@
 package snapshot
 
 import (
-	"bytes"
-	"encoding/binary"
+	"bufio"
 	"fmt"
 	"io"
 	"math"
 	"mime"
 	"path"
-	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,11 +17,13 @@ import (
 	"github.com/PlakarKorp/plakar/classifier"
 	"github.com/PlakarKorp/plakar/events"
 	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/header"
 	"github.com/PlakarKorp/plakar/snapshot/importer"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/timestamping"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gobwas/glob"
 )
@@ -35,11 +35,33 @@ type BackupContext struct {
 	maxConcurrency chan bool
 	scanCache      *caching.ScanCache
 
-	erridx   *btree.BTree[string, int, []byte]
-	muerridx sync.Mutex
+	erridx         *btree.BTree[string, int, []byte]
+	errcounts      map[string]uint64
+	maxErrors      uint64
+	nErrors        uint64
+	nErrorsDropped uint64
+	muerridx       sync.Mutex
 
 	xattridx   *btree.BTree[string, int, []byte]
 	muxattridx sync.Mutex
+
+	// deletions reported by the importer, the values are unused
+	tombidx     *btree.BTree[string, int, objects.MAC]
+	nTombstones uint64
+	mutombidx   sync.Mutex
+
+	nFiles          atomic.Uint64
+	nChangedFiles   atomic.Uint64
+	nChangedSize    atomic.Uint64
+	nHiEntropyFiles atomic.Uint64
+	nScannedSize    atomic.Uint64
+	nCacheHits      atomic.Uint64
+	nCacheMisses    atomic.Uint64
+
+	rootIsFile atomic.Bool
+
+	fileTypes   header.FileTypes
+	mufileTypes sync.Mutex
 }
 
 type BackupOptions struct {
@@ -47,6 +69,39 @@ type BackupOptions struct {
 	Name           string
 	Tags           []string
 	Excludes       []glob.Glob
+	NoCache        bool
+	StrictCache    bool
+
+	// DeltaCompression stores chunks similar to previously stored ones
+	// as deltas against them.
+	DeltaCompression bool
+
+	// WholeFileThreshold is the size below which files are not chunked,
+	// it can't exceed the maximum chunk size of the repository.
+	WholeFileThreshold uint32
+
+	// MailboxChunking cuts the chunks of mbox files on message boundaries,
+	// so that appending a message does not change the previous chunks.
+	MailboxChunking bool
+
+	// MetadataOnly records the filesystem tree without storing file
+	// content, objects are only referenced when already in the repository.
+	MetadataOnly bool
+
+	// MaxErrors caps the number of entries in the error index, 0 means
+	// no limit.  Errors past the cap are still counted in the summaries.
+	MaxErrors uint64
+
+	// TextIndex builds a full-text index of the text files, read again
+	// once stored, which is kept alongside the snapshot.
+	TextIndex bool
+}
+
+// abort stops the backup, the first reason given being reported.
+func (bc *BackupContext) abort(reason error) {
+	if bc.aborted.CompareAndSwap(false, true) {
+		bc.abortedReason = reason
+	}
 }
 
 func (bc *BackupContext) recordEntry(entry *vfs.Entry) error {
@@ -71,9 +126,25 @@ func (bc *BackupContext) recordError(path string, err error) error {
 	}
 
 	bc.muerridx.Lock()
-	e = bc.erridx.Insert(path, serialized)
-	bc.muerridx.Unlock()
-	return e
+	defer bc.muerridx.Unlock()
+
+	bc.errcounts[parentPath(path)]++
+	if bc.maxErrors != 0 && bc.nErrors >= bc.maxErrors {
+		bc.nErrorsDropped++
+		return nil
+	}
+	if e = bc.erridx.Insert(path, serialized); e != nil {
+		return e
+	}
+	bc.nErrors++
+	return nil
+}
+
+func parentPath(pathname string) string {
+	if pathname == "/" {
+		return pathname
+	}
+	return path.Dir(pathname)
 }
 
 func (bc *BackupContext) recordXattr(record *importer.ScanRecord, objectMAC objects.MAC, size int64) error {
@@ -89,6 +160,20 @@ func (bc *BackupContext) recordXattr(record *importer.ScanRecord, objectMAC obje
 	return err
 }
 
+func (bc *BackupContext) recordTombstone(pathname string) error {
+	bc.mutombidx.Lock()
+	defer bc.mutombidx.Unlock()
+
+	if err := bc.tombidx.Insert(pathname, objects.MAC{}); err != nil {
+		if err == btree.ErrExists {
+			return nil
+		}
+		return err
+	}
+	bc.nTombstones++
+	return nil
+}
+
 func (snapshot *Snapshot) skipExcludedPathname(options *BackupOptions, record *importer.ScanResult) bool {
 	var pathname string
 	switch {
@@ -150,8 +235,7 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptio
 				case record.Error != nil:
 					record := record.Error
 					if record.Pathname == backupCtx.imp.Root() || len(record.Pathname) < len(backupCtx.imp.Root()) {
-						backupCtx.aborted.Store(true)
-						backupCtx.abortedReason = record.Err
+						backupCtx.abort(record.Err)
 						return
 					}
 					backupCtx.recordError(record.Pathname, record.Err)
@@ -159,6 +243,12 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptio
 
 				case record.Record != nil:
 					record := record.Record
+					if record.IsTombstone {
+						if err := backupCtx.recordTombstone(record.Pathname); err != nil {
+							backupCtx.recordError(record.Pathname, err)
+						}
+						return
+					}
 					snap.Event(events.PathEvent(snap.Header.Identifier, record.Pathname))
 
 					if strings.HasPrefix(record.Pathname, repoLocation+"/") {
@@ -174,9 +264,8 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptio
 							if record.FileInfo.Mode().IsRegular() {
 								atomic.AddUint64(&size, uint64(record.FileInfo.Size()))
 							}
-							// if snapshot root is a file, then reset to the parent directory
-							if snap.Header.GetSource(0).Importer.Directory == record.Pathname {
-								snap.Header.GetSource(0).Importer.Directory = filepath.Dir(record.Pathname)
+							if record.Pathname == backupCtx.imp.Root() {
+								backupCtx.rootIsFile.Store(true)
 							}
 						}
 					} else {
@@ -203,7 +292,7 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptio
 	return filesChannel, nil
 }
 
-func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) error {
+func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) (err error) {
 	snap.Event(events.StartEvent())
 	defer snap.Event(events.DoneEvent())
 
@@ -213,11 +302,51 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	}
 	defer snap.Unlock(done)
 
+	// until Commit() is attempted, nothing references what was written,
+	// which is discarded if the backup fails or is cancelled
+	committing := false
+	defer func() {
+		if err != nil && !committing {
+			snap.abort(err)
+		}
+	}()
+
 	vfsCache, err := snap.AppContext().GetCache().VFS(imp.Type(), imp.Origin())
 	if err != nil {
 		return err
 	}
 
+	// the cache is keyed by origin, make sure the root still lives on the
+	// same volume: a disk restored from an image keeps paths and inodes,
+	// but cached entries can no longer be trusted.
+	if vi, ok := imp.(importer.VolumeIdentifier); ok {
+		if volume, err := vi.VolumeID(); err != nil {
+			snap.Logger().Warn("VFS CACHE: Error identifying volume: %v", err)
+		} else if volume != "" {
+			cached, err := vfsCache.GetVolume(imp.Root())
+			if err != nil {
+				return err
+			}
+			if cached != volume {
+				if cached != "" {
+					snap.Logger().Info("VFS CACHE: volume of %s changed from %s to %s, invalidating cache", imp.Root(), cached, volume)
+				}
+				if err := vfsCache.ResetPath(imp.Root()); err != nil {
+					return err
+				}
+				if err := vfsCache.PutVolume(imp.Root(), volume); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// with NoCache, entries are still refreshed but never trusted
+	getCachedFilename := vfsCache.GetFilename
+	if options.NoCache {
+		getCachedFilename = func(string) ([]byte, error) { return nil, nil }
+	}
+
 	cf, err := classifier.NewClassifier(snap.AppContext())
 	if err != nil {
 		return err
@@ -226,7 +355,26 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 
 	snap.Header.GetSource(0).Importer.Origin = imp.Origin()
 	snap.Header.GetSource(0).Importer.Type = imp.Type()
-	snap.Header.Tags = append(snap.Header.Tags, options.Tags...)
+	for _, tag := range options.Tags {
+		snap.Header.AddTag(tag)
+	}
+	if tagger, ok := imp.(importer.Tagger); ok {
+		if tags, err := tagger.Tags(); err != nil {
+			snap.Logger().Warn("failed to describe the source: %v", err)
+		} else {
+			for _, tag := range tags {
+				snap.Header.AddTag(tag)
+			}
+		}
+	}
+
+	if timestamper, ok := imp.(importer.Timestamper); ok {
+		if timestamp, err := timestamper.Timestamp(); err != nil {
+			snap.Logger().Warn("failed to date the source: %v", err)
+		} else if !timestamp.IsZero() {
+			snap.Header.Timestamp = timestamp
+		}
+	}
 
 	if options.Name == "" {
 		snap.Header.Name = imp.Root() + " @ " + snap.Header.GetSource(0).Importer.Origin
@@ -247,6 +395,10 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	*/
 
 	snap.Header.GetSource(0).Importer.Directory = imp.Root()
+	snap.deltaCompression = options.DeltaCompression
+	snap.wholeFileThreshold = options.WholeFileThreshold
+	snap.mailboxChunking = options.MailboxChunking
+	snap.Header.MetadataOnly = options.MetadataOnly
 
 	maxConcurrency := options.MaxConcurrency
 	if maxConcurrency == 0 {
@@ -257,6 +409,9 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		imp:            imp,
 		maxConcurrency: make(chan bool, maxConcurrency),
 		scanCache:      snap.scanCache,
+		fileTypes:      header.NewFileTypes(),
+		errcounts:      make(map[string]uint64),
+		maxErrors:      options.MaxErrors,
 	}
 
 	errstore := caching.DBStore[string, []byte]{
@@ -277,6 +432,15 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		return err
 	}
 
+	tombstore := caching.DBStore[string, objects.MAC]{
+		Prefix: "__tombstone__",
+		Cache:  snap.scanCache,
+	}
+	backupCtx.tombidx, err = btree.New(&tombstore, strings.Compare, 50)
+	if err != nil {
+		return err
+	}
+
 	ctstore := caching.DBStore[string, objects.MAC]{
 		Prefix: "__contenttype__",
 		Cache:  snap.scanCache,
@@ -287,6 +451,11 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	}
 	var muctidx sync.Mutex
 
+	var textidx *TextIndex
+	if options.TextIndex {
+		textidx = NewTextIndex()
+	}
+
 	/* backup starts now */
 	beginTime := time.Now()
 
@@ -299,10 +468,20 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	/* scanner */
 	scannerWg := sync.WaitGroup{}
 	for _record := range filesChannel {
-		select {
-		case <-snap.AppContext().GetContext().Done():
-			return snap.AppContext().GetContext().Err()
-		default:
+		// once aborted, the channel is drained for the importer to stop
+		if backupCtx.aborted.Load() {
+			continue
+		}
+
+		// hold the scan while paused, in-flight workers drain meanwhile,
+		// and stop it if cancelled, e.g. on SIGTERM
+		if err := snap.AppContext().WaitIfPaused(); err != nil {
+			backupCtx.abort(err)
+			continue
+		}
+		if err := snap.AppContext().GetContext().Err(); err != nil {
+			backupCtx.abort(err)
+			continue
 		}
 
 		backupCtx.maxConcurrency <- true
@@ -323,7 +502,7 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 			var cachedFileEntryMAC objects.MAC
 
 			// Check if the file entry and underlying objects are already in the cache
-			if data, err := vfsCache.GetFilename(record.Pathname); err != nil {
+			if data, err := getCachedFilename(record.Pathname); err != nil {
 				snap.Logger().Warn("VFS CACHE: Error getting filename: %v", err)
 			} else if data != nil {
 				cachedFileEntry, err = vfs.EntryFromBytes(data)
@@ -331,7 +510,11 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 					snap.Logger().Warn("VFS CACHE: Error unmarshaling filename: %v", err)
 				} else {
 					cachedFileEntryMAC = snap.repository.ComputeMAC(data)
-					if cachedFileEntry.Stat().Equal(&record.FileInfo) {
+					unchanged := cachedFileEntry.Stat().Equal(&record.FileInfo)
+					if options.StrictCache {
+						unchanged = cachedFileEntry.Stat().EqualStrict(&record.FileInfo)
+					}
+					if unchanged {
 						fileEntry = cachedFileEntry
 						if fileEntry.FileInfo.Mode().IsRegular() {
 							data, err := vfsCache.GetObject(cachedFileEntry.Object)
@@ -351,9 +534,20 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 				}
 			}
 
+			// In metadata-only mode, content is never read: a cached object
+			// is kept only if the repository already holds it.
+			metadataOnly := options.MetadataOnly && !record.IsXattr
+			if metadataOnly && (object == nil || !snap.BlobExists(resources.RT_OBJECT, objectMAC)) {
+				object = nil
+				fileEntry = nil
+			}
+
 			// Chunkify the file if it is a regular file and we don't have a cached object
-			if record.FileInfo.Mode().IsRegular() {
-				if object == nil || !snap.BlobExists(resources.RT_OBJECT, objectMAC) {
+			if record.FileInfo.Mode().IsRegular() && !metadataOnly {
+				if object != nil && snap.BlobExists(resources.RT_OBJECT, objectMAC) {
+					backupCtx.nCacheHits.Add(1)
+				} else {
+					backupCtx.nCacheMisses.Add(1)
 					object, err = snap.chunkify(imp, cf, record)
 					if err != nil {
 						backupCtx.recordError(record.Pathname, err)
@@ -395,10 +589,23 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 				return
 			}
 
+			backupCtx.nFiles.Add(1)
+			if record.FileInfo.Mode().IsRegular() {
+				backupCtx.nScannedSize.Add(uint64(record.FileInfo.Size()))
+			}
+
 			var fileEntryMAC objects.MAC
 			if fileEntry != nil && snap.BlobExists(resources.RT_VFS_ENTRY, cachedFileEntryMAC) {
 				fileEntryMAC = cachedFileEntryMAC
 			} else {
+				backupCtx.nChangedFiles.Add(1)
+				if record.FileInfo.Mode().IsRegular() {
+					backupCtx.nChangedSize.Add(uint64(record.FileInfo.Size()))
+				}
+				if object != nil && object.Entropy >= 7.0 {
+					backupCtx.nHiEntropyFiles.Add(1)
+				}
+
 				fileEntry = vfs.NewEntry(path.Dir(record.Pathname), record)
 				if object != nil {
 					fileEntry.Object = objectMAC
@@ -422,11 +629,14 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 					return
 				}
 
-				// Store the newly generated FileEntry in the cache for future runs
-				err = vfsCache.PutFilename(record.Pathname, serialized)
-				if err != nil {
-					backupCtx.recordError(record.Pathname, err)
-					return
+				// Store the newly generated FileEntry in the cache for future runs,
+				// unless it lacks the content a full backup would need to reuse it.
+				if object != nil || !record.FileInfo.Mode().IsRegular() {
+					err = vfsCache.PutFilename(record.Pathname, serialized)
+					if err != nil {
+						backupCtx.recordError(record.Pathname, err)
+						return
+					}
 				}
 
 				fileSummary := &vfs.FileSummary{
@@ -455,6 +665,10 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 			}
 
 			if object != nil {
+				backupCtx.mufileTypes.Lock()
+				backupCtx.fileTypes.Record(object.ContentType, path.Ext(record.Pathname))
+				backupCtx.mufileTypes.Unlock()
+
 				parts := strings.SplitN(object.ContentType, ";", 2)
 				mime := parts[0]
 
@@ -471,6 +685,12 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 					backupCtx.recordError(record.Pathname, err)
 					return
 				}
+
+				if textidx != nil && record.FileInfo.Mode().IsRegular() && isText(object.ContentType) {
+					if err := snap.indexText(imp, textidx, record.Pathname); err != nil {
+						snap.Logger().Warn("%s: could not index text: %s", record.Pathname, err)
+					}
+				}
 			}
 
 			if err := backupCtx.recordEntry(fileEntry); err != nil {
@@ -482,6 +702,11 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		}(_record)
 	}
 	scannerWg.Wait()
+	scanTime := time.Now()
+
+	if backupCtx.aborted.Load() {
+		return backupCtx.abortedReason
+	}
 
 	errcsum, err := persistMACIndex(snap, backupCtx.erridx,
 		resources.RT_ERROR_BTREE, resources.RT_ERROR_NODE, resources.RT_ERROR_ENTRY)
@@ -575,23 +800,10 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 			dirEntry.Summary.UpdateBelow(childSummary)
 		}
 
-		erriter, err := backupCtx.erridx.ScanFrom(prefix)
-		if err != nil {
-			return err
-		}
-		for erriter.Next() {
-			path, _ := erriter.Current()
-			if !strings.HasPrefix(path, prefix) {
-				break
-			}
-			if strings.Index(path[len(prefix):], "/") != -1 {
-				break
-			}
-			dirEntry.Summary.Below.Errors++
-		}
-		if err := erriter.Err(); err != nil {
-			return err
-		}
+		// counted as they are recorded, the error index may be capped.
+		backupCtx.muerridx.Lock()
+		dirEntry.Summary.Directory.Errors += backupCtx.errcounts[dirPath]
+		backupCtx.muerridx.Unlock()
 
 		dirEntry.Summary.UpdateAverages()
 
@@ -634,6 +846,8 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		}
 	}
 
+	indexTime := time.Now()
+
 	rootcsum, err := persistMACIndex(snap, fileidx, resources.RT_VFS_BTREE,
 		resources.RT_VFS_NODE, resources.RT_VFS_ENTRY)
 	if err != nil {
@@ -653,14 +867,27 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		return err
 	}
 
-	if backupCtx.aborted.Load() {
-		return backupCtx.abortedReason
+	var tombmac objects.MAC
+	if backupCtx.nTombstones != 0 {
+		tombmac, err = persistIndex(snap, backupCtx.tombidx, resources.RT_BTREE_ROOT, resources.RT_BTREE_NODE, func(mac objects.MAC) (objects.MAC, error) {
+			return mac, nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
+	persistTime := time.Now()
+
 	snap.Header.GetSource(0).VFS = header.VFS{
-		Root:   rootcsum,
-		Xattrs: xattrcsum,
-		Errors: errcsum,
+		Root:           rootcsum,
+		Xattrs:         xattrcsum,
+		Errors:         errcsum,
+		ErrorsOverflow: backupCtx.nErrorsDropped,
+	}
+	if backupCtx.rootIsFile.Load() {
+		snap.Header.GetSource(0).Importer.Directory = path.Dir(imp.Root())
+		snap.Header.GetSource(0).Importer.File = path.Base(imp.Root())
 	}
 	snap.Header.Duration = time.Since(beginTime)
 	snap.Header.GetSource(0).Summary = *rootSummary
@@ -671,37 +898,66 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 			Value: ctmac,
 		},
 	}
+	if backupCtx.nTombstones != 0 {
+		snap.Header.GetSource(0).Indexes = append(snap.Header.GetSource(0).Indexes, header.Index{
+			Name:  "tombstones",
+			Type:  "btree",
+			Value: tombmac,
+		})
+	}
 
-	/*
-		for _, key := range snap.Metadata.ListKeys() {
-			objectType := strings.Split(key, ";")[0]
-			objectKind := strings.Split(key, "/")[0]
-			if objectType == "" {
-				objectType = "unknown"
-				objectKind = "unknown"
-			}
-			if _, exists := snap.Header.FileKind[objectKind]; !exists {
-				snap.Header.FileKind[objectKind] = 0
-			}
-			snap.Header.FileKind[objectKind] += uint64(len(snap.Metadata.ListValues(key)))
+	backupCtx.fileTypes.UpdatePercents()
+	snap.Header.GetSource(0).FileTypes = backupCtx.fileTypes
 
-			if _, exists := snap.Header.FileType[objectType]; !exists {
-				snap.Header.FileType[objectType] = 0
-			}
-			snap.Header.FileType[objectType] += uint64(len(snap.Metadata.ListValues(key)))
-		}
+	// blobs written by Commit() itself aren't accounted for.
+	snap.Header.GetSource(0).Stats = header.Stats{
+		ScannedSize:     backupCtx.nScannedSize.Load(),
+		TransferredSize: snap.transferred.Load(),
+		CacheHits:       backupCtx.nCacheHits.Load(),
+		CacheMisses:     backupCtx.nCacheMisses.Load(),
+	}
 
-		for key, value := range snap.Header.FileType {
-			snap.Header.FilePercentType[key] = math.Round((float64(value)/float64(snap.Header.FilesCount)*100)*100) / 100
-		}
-		for key, value := range snap.Header.FileKind {
-			snap.Header.FilePercentKind[key] = math.Round((float64(value)/float64(snap.Header.FilesCount)*100)*100) / 100
-		}
-		for key, value := range snap.Header.FileExtension {
-			snap.Header.FilePercentExtension[key] = math.Round((float64(value)/float64(snap.Header.FilesCount)*100)*100) / 100
+	backupCtx.muerridx.Lock()
+	nErrors := backupCtx.nErrors + backupCtx.nErrorsDropped
+	backupCtx.muerridx.Unlock()
+
+	err = snap.putProfile(&Profile{
+		Scan:            scanTime.Sub(beginTime),
+		Index:           indexTime.Sub(scanTime),
+		Persist:         persistTime.Sub(indexTime),
+		Files:           backupCtx.nFiles.Load(),
+		ChangedFiles:    backupCtx.nChangedFiles.Load(),
+		ScannedSize:     backupCtx.nScannedSize.Load(),
+		TransferredSize: snap.transferred.Load(),
+		CacheHits:       backupCtx.nCacheHits.Load(),
+		CacheMisses:     backupCtx.nCacheMisses.Load(),
+		Errors:          nErrors,
+		Concurrency:     maxConcurrency,
+	})
+	if err != nil {
+		return err
+	}
+
+	if textidx != nil {
+		if err := snap.putTextIndex(textidx); err != nil {
+			return err
 		}
-	*/
-	return snap.Commit()
+	}
+
+	committing = true
+	if err = snap.Commit(); err != nil {
+		return err
+	}
+
+	// a snapshot that didn't make it to the repository isn't worth
+	// comparing to the baseline of its source
+	deltaEvent := events.DeltaEvent(snap.Header.Identifier)
+	deltaEvent.Files = backupCtx.nFiles.Load()
+	deltaEvent.ChangedFiles = backupCtx.nChangedFiles.Load()
+	deltaEvent.ChangedSize = backupCtx.nChangedSize.Load()
+	deltaEvent.HiEntropyFiles = backupCtx.nHiEntropyFiles.Load()
+	snap.Event(deltaEvent)
+	return nil
 }
 
 func entropy(data []byte) (float64, [256]float64) {
@@ -727,6 +983,14 @@ func entropy(data []byte) (float64, [256]float64) {
 	return entropy, freq
 }
 
+// wholeFileSize returns the size below which files are not chunked: files
+// smaller than the minimum chunk size would yield a single chunk anyway.
+func (snap *Snapshot) wholeFileSize() int64 {
+	cfg := snap.repository.Configuration().Chunking
+	size := max(cfg.MinSize, min(snap.wholeFileThreshold, cfg.MaxSize))
+	return int64(size)
+}
+
 func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier, record *importer.ScanRecord) (*objects.Object, error) {
 	var rd io.ReadCloser
 	var err error
@@ -744,6 +1008,11 @@ func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier,
 
 	object := objects.NewObject()
 	object.ContentType = mime.TypeByExtension(path.Ext(record.Pathname))
+	if typer, ok := imp.(importer.ContentTyper); ok && !record.IsXattr {
+		if contentType := typer.ContentType(record.Pathname); contentType != "" {
+			object.ContentType = contentType
+		}
+	}
 
 	objectHasher := snap.repository.GetMACHasher()
 
@@ -757,6 +1026,11 @@ func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier,
 
 	// Helper function to process a chunk
 	processChunk := func(data []byte) error {
+		// don't hold a cancelled backup until large files are read
+		if err := snap.AppContext().GetContext().Err(); err != nil {
+			return err
+		}
+
 		var chunk_t32 objects.MAC
 		chunkHasher := snap.repository.GetMACHasher()
 
@@ -789,44 +1063,12 @@ func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier,
 		totalEntropy += chunk.Entropy * float64(len(data))
 		totalDataSize += uint64(len(data))
 
-		return snap.PutBlobIfNotExists(resources.RT_CHUNK, chunk.ContentMAC, data)
+		return snap.putChunk(chunk.ContentMAC, data)
 	}
 
-	if record.FileInfo.Size() == 0 {
-		// Produce an empty chunk for empty file
-		if err := processChunk([]byte{}); err != nil {
-			return nil, err
-		}
-	} else if record.FileInfo.Size() < int64(snap.repository.Configuration().Chunking.MinSize) {
-		// Small file case: read entire file into memory
-		buf, err := io.ReadAll(rd)
-		if err != nil {
-			return nil, err
-		}
-		if err := processChunk(buf); err != nil {
-			return nil, err
-		}
-	} else {
-		// Large file case: chunk file with chunker
-		chk, err := snap.repository.Chunker(rd)
-		if err != nil {
-			return nil, err
-		}
-		for {
-			cdcChunk, err := chk.Next()
-			if err != nil && err != io.EOF {
-				return nil, err
-			}
-			if cdcChunk == nil {
-				break
-			}
-			if err := processChunk(cdcChunk); err != nil {
-				return nil, err
-			}
-			if err == io.EOF {
-				break
-			}
-		}
+	mailbox := snap.mailboxChunking && !record.IsXattr
+	if err := snap.splitChunks(rd, record.FileInfo.Size(), mailbox, processChunk); err != nil {
+		return nil, err
 	}
 
 	if totalDataSize > 0 {
@@ -840,49 +1082,67 @@ func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier,
 	return object, nil
 }
 
-func (snap *Snapshot) PutPackfile(packer *Packer) error {
-
-	repo := snap.repository
-
-	serializedData, err := packer.Packfile.SerializeData()
-	if err != nil {
-		return fmt.Errorf("could not serialize pack file data %s", err.Error())
-	}
-	serializedIndex, err := packer.Packfile.SerializeIndex()
-	if err != nil {
-		return fmt.Errorf("could not serialize pack file index %s", err.Error())
-	}
-	serializedFooter, err := packer.Packfile.SerializeFooter()
-	if err != nil {
-		return fmt.Errorf("could not serialize pack file footer %s", err.Error())
+// splitChunks cuts the content of a file of the given size into the chunks
+// a backup stores and calls fn on each of them, in order.
+func (snap *Snapshot) splitChunks(rd io.Reader, size int64, mailbox bool, fn func([]byte) error) error {
+	var input io.Reader = rd
+	var mbox *bufio.Reader
+	if mailbox {
+		br := bufio.NewReaderSize(rd, 64*1024)
+		if isMbox(br) {
+			mbox = br
+		}
+		input = br
 	}
 
-	encryptedIndex, err := repo.EncodeBuffer(serializedIndex)
-	if err != nil {
-		return err
+	if size == 0 {
+		// Produce an empty chunk for empty file
+		return fn([]byte{})
+	} else if size < snap.wholeFileSize() {
+		// Small file case: read entire file into memory, it is stored
+		// and deduplicated as a single chunk keyed by the file MAC
+		buf, err := io.ReadAll(input)
+		if err != nil {
+			return err
+		}
+		return fn(buf)
+	} else if mbox != nil {
+		// Mailbox case: chunks end on message boundaries
+		cfg := snap.repository.Configuration().Chunking
+		return mboxChunks(mbox, int(cfg.MinSize), int(cfg.MaxSize), fn)
 	}
 
-	encryptedFooter, err := repo.EncodeBuffer(serializedFooter)
+	// Large file case: chunk file with chunker
+	chk, err := snap.repository.Chunker(io.NopCloser(input))
 	if err != nil {
 		return err
 	}
+	for {
+		cdcChunk, err := chk.Next()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if cdcChunk == nil {
+			break
+		}
+		if err := fn(cdcChunk); err != nil {
+			return err
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return nil
+}
 
-	serializedPackfile := append(serializedData, encryptedIndex...)
-	serializedPackfile = append(serializedPackfile, encryptedFooter...)
-
-	/* it is necessary to track the footer _encrypted_ length */
-	encryptedFooterLength := make([]byte, 4)
-	binary.LittleEndian.PutUint32(encryptedFooterLength, uint32(len(encryptedFooter)))
-	serializedPackfile = append(serializedPackfile, encryptedFooterLength...)
-
-	mac := snap.repository.ComputeMAC(serializedPackfile)
-
-	repo.Logger().Trace("snapshot", "%x: PutPackfile(%x, ...)", snap.Header.GetIndexShortID(), mac)
-	err = snap.repository.PutPackfile(mac, bytes.NewBuffer(serializedPackfile))
+func (snap *Snapshot) PutPackfile(packer *Packer) error {
+	mac, err := snap.repository.WritePackfile(packer.Packfile)
 	if err != nil {
-		return fmt.Errorf("Could not write pack file %s", err.Error())
+		return err
 	}
+	snap.Logger().Trace("snapshot", "%x: PutPackfile(%x, ...)", snap.Header.GetIndexShortID(), mac)
 
+	var journal []byte
 	for _, Type := range packer.Types() {
 		for blobMAC := range packer.Blobs[Type] {
 			for idx, blob := range packer.Packfile.Index {
@@ -901,6 +1161,9 @@ func (snap *Snapshot) PutPackfile(packer *Packer) error {
 					if err := snap.deltaState.PutDelta(delta); err != nil {
 						return err
 					}
+					if snap.syncJournal != nil {
+						journal = append(journal, delta.ToBytes()...)
+					}
 
 					break
 				}
@@ -912,12 +1175,16 @@ func (snap *Snapshot) PutPackfile(packer *Packer) error {
 		return err
 	}
 
+	if snap.syncJournal != nil {
+		if err := snap.syncJournal.PutPackfile(snap.syncJournalID, mac, journal); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (snap *Snapshot) Commit() error {
-	repo := snap.repository
-
 	serializedHdr, err := snap.Header.Serialize()
 	if err != nil {
 		return err
@@ -931,21 +1198,81 @@ func (snap *Snapshot) Commit() error {
 		}
 	}
 
+	if snap.TimestampAuthority != "" {
+		// a backup is still worth having without its proof of existence
+		token, err := timestamping.Request(snap.TimestampAuthority, snap.timestampDigest(serializedHdr))
+		if err != nil {
+			snap.Logger().Warn("could not timestamp snapshot %x: %s", snap.Header.GetIndexShortID(), err)
+		} else if err := snap.PutBlob(resources.RT_TIMESTAMP, snap.Header.Identifier, token); err != nil {
+			return err
+		}
+	}
+
 	if err := snap.PutBlob(resources.RT_SNAPSHOT, snap.Header.Identifier, serializedHdr); err != nil {
 		return err
 	}
 
-	close(snap.packerChan)
-	<-snap.packerChanDone
+	if err := snap.pushState(); err != nil {
+		return err
+	}
+
+	commit := repository.Commit{
+		SnapshotID: snap.Header.Identifier,
+		StateID:    snap.Header.Identifier,
+	}
+	for packfileMAC := range snap.deltaState.ListPackfiles() {
+		commit.Packfiles = append(commit.Packfiles, packfileMAC)
+	}
+	snap.repository.Committed(commit)
+
+	snap.Logger().Trace("snapshot", "%x: Commit()", snap.Header.GetIndexShortID())
+	return nil
+}
+
+// stopPacker waits for the blobs queued to be packed, or dropped if the
+// snapshot is aborting, and for the packer to exit.
+func (snap *Snapshot) stopPacker() {
+	snap.packerStop.Do(func() {
+		close(snap.packerChan)
+		<-snap.packerChanDone
+	})
+}
+
+// abort discards what a backup which failed or was cancelled wrote: the
+// blobs still queued are dropped and the packfiles already written, which
+// no state references, are deleted rather than left for maintenance to
+// find once their grace period is over.
+func (snap *Snapshot) abort(reason error) {
+	snap.aborting.Store(true)
+	snap.stopPacker()
+
+	discarded := 0
+	for packfileMAC := range snap.deltaState.ListPackfiles() {
+		if err := snap.repository.DeletePackfile(packfileMAC); err != nil {
+			snap.Logger().Warn("%x: could not delete packfile %x, left for maintenance: %s",
+				snap.Header.GetIndexShortID(), packfileMAC, err)
+			continue
+		}
+		discarded++
+	}
+	snap.Logger().Info("%x: backup aborted (%s), %d packfiles discarded",
+		snap.Header.GetIndexShortID(), reason, discarded)
+}
+
+// pushState waits for the pending blobs to be packed and pushes the delta
+// state making them visible, as long as the lease is still held.
+func (snap *Snapshot) pushState() error {
+	snap.stopPacker()
+
+	if err := snap.checkLease(); err != nil {
+		return err
+	}
 
 	stateDelta := snap.buildSerializedDeltaState()
-	err = repo.PutState(snap.Header.Identifier, stateDelta)
-	if err != nil {
+	if err := snap.repository.PutState(snap.Header.Identifier, stateDelta); err != nil {
 		snap.Logger().Warn("Failed to push the state to the repository %s", err)
 		return err
 	}
-
-	snap.Logger().Trace("snapshot", "%x: Commit()", snap.Header.GetIndexShortID())
 	return nil
 }
 
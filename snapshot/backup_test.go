@@ -0,0 +1,251 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/btree"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordErrorCap(t *testing.T) {
+	store := btree.InMemoryStore[string, []byte]{}
+	erridx, err := btree.New(&store, strings.Compare, 50)
+	require.NoError(t, err)
+
+	bc := &BackupContext{
+		erridx:    erridx,
+		errcounts: make(map[string]uint64),
+		maxErrors: 3,
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, bc.recordError(fmt.Sprintf("/dir/file%d", i), fmt.Errorf("failure")))
+	}
+	require.NoError(t, bc.recordError("/dir/sub/file", fmt.Errorf("failure")))
+
+	require.Equal(t, uint64(3), bc.nErrors)
+	require.Equal(t, uint64(3), bc.nErrorsDropped)
+
+	// every error is accounted for in its directory, recorded or not
+	require.Equal(t, uint64(5), bc.errcounts["/dir"])
+	require.Equal(t, uint64(1), bc.errcounts["/dir/sub"])
+
+	iter, err := erridx.ScanAll()
+	require.NoError(t, err)
+	recorded := 0
+	for iter.Next() {
+		recorded++
+	}
+	require.NoError(t, iter.Err())
+	require.Equal(t, 3, recorded)
+}
+
+func TestBackupSingleFile(t *testing.T) {
+	snap := generateSnapshotOf(t, nil, "dummy.txt")
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	imp := snap.Header.GetSource(0).Importer
+	require.Equal(t, "dummy.txt", imp.File)
+	require.Equal(t, path.Join(imp.Directory, "dummy.txt"), imp.Root())
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	entry, err := fs.GetEntry(imp.Root())
+	require.NoError(t, err)
+	require.True(t, entry.Stat().Mode().IsRegular())
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exp, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exp.Close()
+
+	opts := &RestoreOptions{MaxConcurrency: 1, Strip: imp.Directory}
+	require.NoError(t, snap.Restore(exp, exp.Root(), imp.Root(), opts))
+
+	files, err := os.ReadDir(tmpRestoreDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	contents, err := os.ReadFile(path.Join(tmpRestoreDir, "dummy.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+}
+
+func TestBackupCancelled(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	repo := snap.repository
+	require.NoError(t, repo.RebuildState())
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	snapshots, err := repo.GetSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": snap.Header.GetSource(0).Importer.Directory})
+	require.NoError(t, err)
+
+	parent := repo.AppContext().GetContext()
+	defer repo.AppContext().SetContext(parent)
+	ctx, cancel := context.WithCancel(parent)
+	cancel()
+	repo.AppContext().SetContext(ctx)
+
+	cancelled, err := New(repo)
+	require.NoError(t, err)
+	defer cancelled.Close()
+
+	err = cancelled.Backup(imp, &BackupOptions{Name: "cancelled", MaxConcurrency: 1})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// nothing was committed nor left behind
+	require.NoError(t, repo.RebuildState())
+	after, err := repo.GetSnapshots()
+	require.NoError(t, err)
+	require.ElementsMatch(t, snapshots, after)
+	after, err = repo.GetPackfiles()
+	require.NoError(t, err)
+	require.ElementsMatch(t, packfiles, after)
+}
+
+func TestBackupAbortDiscardsPackfiles(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	repo := snap.repository
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+
+	aborted, err := New(repo)
+	require.NoError(t, err)
+	defer aborted.Close()
+
+	data := []byte("written before the backup was aborted")
+	require.NoError(t, aborted.PutBlob(resources.RT_CHUNK, repo.ComputeMAC(data), data))
+
+	// the packer flushes what it holds when stopped, as on commit
+	aborted.stopPacker()
+	written, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.Len(t, written, len(packfiles)+1)
+
+	aborted.abort(context.Canceled)
+	after, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.ElementsMatch(t, packfiles, after)
+}
+
+func backupWith(t *testing.T, repo *repository.Repository, dir string, opts *BackupOptions) *Snapshot {
+	snap, err := New(repo)
+	require.NoError(t, err)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": dir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, opts))
+	require.NoError(t, repo.RebuildState())
+	return snap
+}
+
+func TestBackupWholeFile(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.repository
+
+	// large enough for content-defined chunking to split it
+	data := make([]byte, 3<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	dir := t.TempDir()
+	pathname := path.Join(dir, "random.bin")
+	require.NoError(t, os.WriteFile(pathname, data, 0644))
+
+	chunks := func(snap *Snapshot) []objects.Chunk {
+		fs, err := snap.Filesystem()
+		require.NoError(t, err)
+		entry, err := fs.GetEntry(pathname)
+		require.NoError(t, err)
+		require.NotNil(t, entry.ResolvedObject)
+		require.Equal(t, repo.ComputeMAC(data), entry.ResolvedObject.ContentMAC)
+		return entry.ResolvedObject.Chunks
+	}
+
+	chunked := backupWith(t, repo, dir, &BackupOptions{Name: "chunked", MaxConcurrency: 1, NoCache: true})
+	defer chunked.Close()
+	require.Greater(t, len(chunks(chunked)), 1)
+
+	// below the threshold, the file is a single chunk keyed by its MAC
+	whole := backupWith(t, repo, dir, &BackupOptions{Name: "whole", MaxConcurrency: 1, NoCache: true,
+		WholeFileThreshold: repo.Configuration().Chunking.MaxSize})
+	defer whole.Close()
+	wholeChunks := chunks(whole)
+	require.Len(t, wholeChunks, 1)
+	require.Equal(t, repo.ComputeMAC(data), wholeChunks[0].ContentMAC)
+	require.Equal(t, uint32(len(data)), wholeChunks[0].Length)
+
+	require.True(t, repo.BlobExists(resources.RT_CHUNK, repo.ComputeMAC(data)))
+	require.Equal(t, string(data), readFile(t, whole, pathname))
+}
+
+func TestBackupMetadataOnly(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.repository
+
+	dir := t.TempDir()
+	pathname := path.Join(dir, "inventory.txt")
+	content := []byte("listed in the inventory, never stored")
+	require.NoError(t, os.WriteFile(pathname, content, 0644))
+
+	entry := func(snap *Snapshot) *vfs.Entry {
+		fs, err := snap.Filesystem()
+		require.NoError(t, err)
+		entry, err := fs.GetEntry(pathname)
+		require.NoError(t, err)
+		return entry
+	}
+
+	inventory := backupWith(t, repo, dir, &BackupOptions{Name: "inventory", MaxConcurrency: 1, MetadataOnly: true})
+	defer inventory.Close()
+	require.True(t, inventory.Header.MetadataOnly)
+
+	// the file is listed with its metadata, but no content was stored
+	e := entry(inventory)
+	require.Equal(t, int64(len(content)), e.Size())
+	require.False(t, e.HasObject())
+	require.False(t, repo.BlobExists(resources.RT_CHUNK, repo.ComputeMAC(content)))
+
+	exp, err := exporter.NewExporter(map[string]string{"location": t.TempDir()})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.ErrorIs(t, inventory.Restore(exp, exp.Root(), dir, &RestoreOptions{MaxConcurrency: 1}), ErrMetadataOnly)
+
+	// once a full backup stored it, inventories reference the object
+	full := backupWith(t, repo, dir, &BackupOptions{Name: "full", MaxConcurrency: 1})
+	defer full.Close()
+	require.False(t, full.Header.MetadataOnly)
+	require.True(t, entry(full).HasObject())
+
+	again := backupWith(t, repo, dir, &BackupOptions{Name: "inventory", MaxConcurrency: 1, MetadataOnly: true})
+	defer again.Close()
+	require.True(t, again.Header.MetadataOnly)
+	require.Equal(t, entry(full).Object, entry(again).Object)
+}
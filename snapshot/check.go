@@ -3,12 +3,15 @@ package snapshot
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"path"
 	"sync"
+	"sync/atomic"
 
 	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 )
@@ -16,13 +19,50 @@ import (
 type CheckOptions struct {
 	MaxConcurrency uint64
 	FastCheck      bool
+
+	// Failure, when set, is called for each missing or corrupted blob
+	// found.  It may be called concurrently.
+	Failure func(*CheckFailure)
+}
+
+// CheckFailure describes a blob of a snapshot that failed verification,
+// precisely enough to locate it for remediation.  The MAC and packfile
+// are left empty when unknown, such as for a blob missing from the state.
+type CheckFailure struct {
+	Snapshot string `json:"snapshot"`
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	MAC      string `json:"mac,omitempty"`
+	Packfile string `json:"packfile,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (snap *Snapshot) checkFailure(opts *CheckOptions, pathname string, Type resources.Type, mac *objects.MAC, reason string) {
+	if opts.Failure == nil {
+		return
+	}
+
+	failure := &CheckFailure{
+		Snapshot: fmt.Sprintf("%x", snap.Header.Identifier),
+		Path:     pathname,
+		Type:     Type.String(),
+		Reason:   reason,
+	}
+	if mac != nil {
+		failure.MAC = fmt.Sprintf("%x", *mac)
+		if packfile, exists, err := snap.repository.GetPackfileForBlob(Type, *mac); err == nil && exists {
+			failure.Packfile = fmt.Sprintf("%x", packfile)
+		}
+	}
+	opts.Failure(failure)
 }
 
-func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opts *CheckOptions, concurrency chan bool, wg *sync.WaitGroup) (bool, error) {
+func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opts *CheckOptions, concurrency chan bool, wg *sync.WaitGroup, failed *atomic.Bool) (bool, error) {
 	snap.Event(events.PathEvent(snap.Header.Identifier, pathname))
 	file, err := fsc.GetEntry(pathname)
 	if err != nil {
 		snap.Event(events.DirectoryMissingEvent(snap.Header.Identifier, pathname))
+		snap.checkFailure(opts, pathname, resources.RT_VFS_ENTRY, nil, fmt.Sprintf("missing entry: %s", err))
 		return false, err
 	}
 
@@ -38,11 +78,12 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 					break
 				}
 				snap.Event(events.DirectoryCorruptedEvent(snap.Header.Identifier, pathname))
+				snap.checkFailure(opts, pathname, resources.RT_VFS_ENTRY, nil, fmt.Sprintf("corrupted directory: %s", err))
 				return false, err
 			}
 			for i := range entries {
 				ok, err := snapshotCheckPath(snap, fsc, path.Join(pathname, entries[i].Name()),
-					opts, concurrency, wg)
+					opts, concurrency, wg, failed)
 				if err != nil {
 					snap.Event(events.DirectoryCorruptedEvent(snap.Header.Identifier, pathname))
 					return ok, err
@@ -67,6 +108,8 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 		object, err := snap.LookupObject(_fileEntry.Object)
 		if err != nil {
 			snap.Event(events.ObjectMissingEvent(snap.Header.Identifier, _fileEntry.Object))
+			snap.checkFailure(opts, pathname, resources.RT_OBJECT, &_fileEntry.Object, fmt.Sprintf("missing object: %s", err))
+			failed.Store(true)
 			return
 		}
 
@@ -79,6 +122,7 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 				exists := snap.BlobExists(resources.RT_CHUNK, chunk.ContentMAC)
 				if !exists {
 					snap.Event(events.ChunkMissingEvent(snap.Header.Identifier, chunk.ContentMAC))
+					snap.checkFailure(opts, pathname, resources.RT_CHUNK, &chunk.ContentMAC, "missing chunk")
 					complete = false
 					break
 				}
@@ -87,12 +131,14 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 				exists := snap.BlobExists(resources.RT_CHUNK, chunk.ContentMAC)
 				if !exists {
 					snap.Event(events.ChunkMissingEvent(snap.Header.Identifier, chunk.ContentMAC))
+					snap.checkFailure(opts, pathname, resources.RT_CHUNK, &chunk.ContentMAC, "missing chunk")
 					complete = false
 					break
 				}
 				data, err := snap.GetBlob(resources.RT_CHUNK, chunk.ContentMAC)
 				if err != nil {
 					snap.Event(events.ChunkMissingEvent(snap.Header.Identifier, chunk.ContentMAC))
+					snap.checkFailure(opts, pathname, resources.RT_CHUNK, &chunk.ContentMAC, fmt.Sprintf("unreadable chunk: %s", err))
 					complete = false
 					break
 				}
@@ -103,6 +149,7 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 				mac := snap.repository.ComputeMAC(data)
 				if !bytes.Equal(mac[:], chunk.ContentMAC[:]) {
 					snap.Event(events.ChunkCorruptedEvent(snap.Header.Identifier, chunk.ContentMAC))
+					snap.checkFailure(opts, pathname, resources.RT_CHUNK, &chunk.ContentMAC, "corrupted chunk: MAC mismatch")
 					complete = false
 					break
 				}
@@ -110,6 +157,7 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 		}
 		if !complete {
 			snap.Event(events.ObjectCorruptedEvent(snap.Header.Identifier, object.ContentMAC))
+			failed.Store(true)
 		} else {
 			snap.Event(events.ObjectOKEvent(snap.Header.Identifier, object.ContentMAC))
 		}
@@ -118,6 +166,11 @@ func snapshotCheckPath(snap *Snapshot, fsc *vfs.Filesystem, pathname string, opt
 			if !bytes.Equal(hasher.Sum(nil), object.ContentMAC[:]) {
 				snap.Event(events.ObjectCorruptedEvent(snap.Header.Identifier, object.ContentMAC))
 				snap.Event(events.FileCorruptedEvent(snap.Header.Identifier, pathname))
+				// a failed chunk was already reported, and explains this one
+				if complete {
+					snap.checkFailure(opts, pathname, resources.RT_OBJECT, &_fileEntry.Object, "corrupted object: content MAC mismatch")
+				}
+				failed.Store(true)
 				return
 			}
 		}
@@ -132,6 +185,7 @@ func (snap *Snapshot) Check(pathname string, opts *CheckOptions) (bool, error) {
 
 	fs, err := snap.Filesystem()
 	if err != nil {
+		snap.checkFailure(opts, pathname, resources.RT_VFS_BTREE, &snap.Header.GetSource(0).VFS.Root, fmt.Sprintf("unreadable filesystem: %s", err))
 		return false, err
 	}
 
@@ -142,8 +196,16 @@ func (snap *Snapshot) Check(pathname string, opts *CheckOptions) (bool, error) {
 
 	maxConcurrencyChan := make(chan bool, maxConcurrency)
 	wg := sync.WaitGroup{}
-	defer wg.Wait()
-	defer close(maxConcurrencyChan)
 
-	return snapshotCheckPath(snap, fs, pathname, opts, maxConcurrencyChan, &wg)
+	// files are verified in the background, their failures only known
+	// once all of them completed
+	var failed atomic.Bool
+	ok, err := snapshotCheckPath(snap, fs, pathname, opts, maxConcurrencyChan, &wg, &failed)
+	wg.Wait()
+	close(maxConcurrencyChan)
+
+	if err != nil {
+		return ok, err
+	}
+	return ok && !failed.Load(), nil
 }
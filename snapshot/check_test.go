@@ -1,9 +1,12 @@
 package snapshot
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/resources"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
 	"github.com/stretchr/testify/require"
 )
@@ -33,3 +36,36 @@ func TestCheck(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, checked)
 }
+
+func TestCheckFailures(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	require.NoError(t, snap.repository.RebuildState())
+	filepath, chunkMAC := dropFileChunk(t, snap, "dummy.txt")
+
+	reloaded, err := Load(snap.repository, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer reloaded.Close()
+
+	var failures []*CheckFailure
+	var mu sync.Mutex
+	checked, err := reloaded.Check(filepath, &CheckOptions{
+		MaxConcurrency: 1,
+		Failure: func(failure *CheckFailure) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, failure)
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, checked)
+
+	require.Equal(t, []*CheckFailure{{
+		Snapshot: fmt.Sprintf("%x", snap.Header.Identifier),
+		Path:     filepath,
+		Type:     resources.RT_CHUNK.String(),
+		MAC:      fmt.Sprintf("%x", chunkMAC),
+		Reason:   "missing chunk",
+	}}, failures)
+}
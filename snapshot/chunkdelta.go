@@ -0,0 +1,101 @@
+package snapshot
+
+import (
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/similarity"
+	"github.com/PlakarKorp/plakar/versioning"
+)
+
+const CHUNK_DELTA_VERSION = "1.0.0"
+
+func init() {
+	versioning.Register(resources.RT_CHUNK_DELTA, versioning.FromString(CHUNK_DELTA_VERSION))
+}
+
+func (snap *Snapshot) chunkExists(mac objects.MAC) bool {
+	if snap.deltaState != nil && snap.deltaState.BlobExists(resources.RT_CHUNK_DELTA, mac) {
+		return true
+	}
+	return snap.BlobExists(resources.RT_CHUNK, mac)
+}
+
+// putChunk stores a new chunk, as a delta against a similar chunk
+// previously stored from this host when delta compression is enabled and
+// the delta is worth it.  Only full chunks serve as bases, so rebuilding a
+// chunk never takes more than one indirection.
+func (snap *Snapshot) putChunk(mac objects.MAC, data []byte) error {
+	if !snap.deltaCompression || len(data) < similarity.MinSize {
+		return snap.PutBlobIfNotExists(resources.RT_CHUNK, mac, data)
+	}
+
+	if snap.chunkExists(mac) {
+		return nil
+	}
+
+	sketches, err := snap.AppContext().GetCache().Repository(snap.repository.Configuration().RepositoryID)
+	if err != nil {
+		return err
+	}
+
+	sketch := similarity.NewSketch(data)
+	for _, feature := range sketch {
+		base, found, err := sketches.GetSketch(feature)
+		if err != nil {
+			return err
+		}
+		if !found || base == mac {
+			continue
+		}
+
+		// The base may have been collected since, or still be waiting in
+		// the packer: not finding it is not an error.
+		baseData, err := snap.GetBlob(resources.RT_CHUNK, base)
+		if err != nil {
+			continue
+		}
+
+		delta := similarity.Diff(baseData, data)
+		if len(base)+len(delta) >= len(data)/2 {
+			break
+		}
+
+		payload := make([]byte, 0, len(base)+len(delta))
+		payload = append(payload, base[:]...)
+		payload = append(payload, delta...)
+		return snap.PutBlob(resources.RT_CHUNK_DELTA, mac, payload)
+	}
+
+	if err := snap.PutBlob(resources.RT_CHUNK, mac, data); err != nil {
+		return err
+	}
+
+	for _, feature := range sketch {
+		if err := sketches.PutSketch(feature, mac); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkBlobs returns the blobs needed to rebuild a chunk.
+func (snap *Snapshot) chunkBlobs(mac objects.MAC) ([]BlobRef, error) {
+	_, exists, err := snap.repository.GetPackfileForBlob(resources.RT_CHUNK, mac)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return []BlobRef{{resources.RT_CHUNK, mac}}, nil
+	}
+
+	if _, err := getPackfileForBlobWithError(snap, resources.RT_CHUNK_DELTA, mac); err != nil {
+		return nil, err
+	}
+
+	base, _, err := snap.repository.GetChunkDeltaBase(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	return []BlobRef{{resources.RT_CHUNK_DELTA, mac}, {resources.RT_CHUNK, base}}, nil
+}
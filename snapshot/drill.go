@@ -0,0 +1,208 @@
+package snapshot
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+// DefaultDrillSample is the number of files a drill restores when given
+// neither a sample size nor critical paths.
+const DefaultDrillSample = 10
+
+type DrillOptions struct {
+	// Critical paths are always restored, the files below them for
+	// directories.
+	Critical []string
+	// Number of files picked at random among the other regular files.
+	Sample int
+}
+
+// DrillFile is the outcome of the restoration of a file during a drill.
+type DrillFile struct {
+	Path  string      `json:"path"`
+	Size  int64       `json:"size"`
+	MAC   objects.MAC `json:"mac"`
+	OK    bool        `json:"ok"`
+	Error string      `json:"error,omitempty"`
+}
+
+// DrillReport records a drill, proving the files listed could be restored
+// from the snapshot and matched the MACs computed at backup time.
+type DrillReport struct {
+	Snapshot objects.MAC   `json:"snapshot"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Restored int           `json:"restored"`
+	Failed   int           `json:"failed"`
+	Size     int64         `json:"size"`
+	Files    []DrillFile   `json:"files"`
+}
+
+// drillCandidates returns the regular files of the critical paths, and a
+// random sample of at most sample of the other ones.  Critical paths which
+// are not in the snapshot are returned with a nil entry.
+func drillCandidates(fs *vfs.Filesystem, critical []string, sample int) ([]string, map[string]*vfs.Entry, error) {
+	entries := make(map[string]*vfs.Entry)
+	var pathnames []string
+
+	add := func(entry *vfs.Entry) {
+		if _, ok := entries[entry.Path()]; !ok {
+			entries[entry.Path()] = entry
+			pathnames = append(pathnames, entry.Path())
+		}
+	}
+
+	for _, pathname := range critical {
+		pathname = path.Clean("/" + pathname)
+		entry, err := fs.GetEntry(pathname)
+		if err != nil {
+			if _, ok := entries[pathname]; !ok {
+				entries[pathname] = nil
+				pathnames = append(pathnames, pathname)
+			}
+			continue
+		}
+		if !entry.IsDir() {
+			if entry.Stat().Mode().IsRegular() {
+				add(entry)
+			}
+			continue
+		}
+		for entry, err := range fs.Files(pathname) {
+			if err != nil {
+				return nil, nil, err
+			}
+			if entry.Stat().Mode().IsRegular() {
+				add(entry)
+			}
+		}
+	}
+
+	if sample > 0 {
+		// reservoir sampling, the number of files is not known upfront
+		reservoir := make([]*vfs.Entry, 0, sample)
+		seen := 0
+		for entry, err := range fs.Files("/") {
+			if err != nil {
+				return nil, nil, err
+			}
+			if !entry.Stat().Mode().IsRegular() {
+				continue
+			}
+			if _, ok := entries[entry.Path()]; ok {
+				continue
+			}
+			seen++
+			if len(reservoir) < sample {
+				reservoir = append(reservoir, entry)
+			} else if i := rand.IntN(seen); i < sample {
+				reservoir[i] = entry
+			}
+		}
+		sort.Slice(reservoir, func(i, j int) bool {
+			return reservoir[i].Path() < reservoir[j].Path()
+		})
+		for _, entry := range reservoir {
+			add(entry)
+		}
+	}
+
+	return pathnames, entries, nil
+}
+
+func (snap *Snapshot) drillFile(exp exporter.Exporter, dest string, entry *vfs.Entry) error {
+	rd, err := snap.NewReader(entry.Path())
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	if err := exp.CreateDirectory(path.Dir(dest)); err != nil {
+		return err
+	}
+	if err := exp.StoreFile(dest, rd); err != nil {
+		return err
+	}
+	if entry.ResolvedObject == nil {
+		return nil
+	}
+
+	ok, err := verifyRestoredFile(snap, exp, dest, entry)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("restored content does not match its MAC")
+	}
+	return nil
+}
+
+// Drill restores the critical paths and a random sample of the files of
+// the snapshot into exp, reading each of them back to compare it to the
+// MAC recorded at backup time.  A file failing to restore doesn't stop the
+// drill, it is reported as failed.
+func (snap *Snapshot) Drill(exp exporter.Exporter, opts *DrillOptions) (*DrillReport, error) {
+	if _, ok := exp.(exporter.FileReader); !ok {
+		return nil, fmt.Errorf("exporter does not support restore verification")
+	}
+	if snap.Header.MetadataOnly {
+		return nil, ErrMetadataOnly
+	}
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	sample := opts.Sample
+	if sample == 0 && len(opts.Critical) == 0 {
+		sample = DefaultDrillSample
+	}
+
+	report := &DrillReport{
+		Snapshot: snap.Header.Identifier,
+		Started:  time.Now(),
+		Files:    []DrillFile{},
+	}
+
+	pathnames, entries, err := drillCandidates(fs, opts.Critical, sample)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pathname := range pathnames {
+		file := DrillFile{Path: pathname}
+
+		entry := entries[pathname]
+		if entry == nil {
+			err = fmt.Errorf("not found in snapshot")
+		} else {
+			file.Size = entry.Size()
+			if entry.ResolvedObject != nil {
+				file.MAC = entry.ResolvedObject.ContentMAC
+			}
+			err = snap.drillFile(exp, path.Join(exp.Root(), pathname), entry)
+		}
+
+		if err != nil {
+			snap.Logger().Warn("drill: %s: %s", pathname, err)
+			file.Error = err.Error()
+			report.Failed++
+		} else {
+			file.OK = true
+			report.Restored++
+			report.Size += file.Size
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	report.Duration = time.Since(report.Started)
+	return report, nil
+}
@@ -0,0 +1,57 @@
+package snapshot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrill(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	tmpDrillDir, err := os.MkdirTemp("", "tmp_drill")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDrillDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpDrillDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	dummy := path.Join(snap.Header.GetSource(0).Importer.Directory, "dummy.txt")
+
+	// without options, a sample of the files is restored
+	report, err := snap.Drill(exporterInstance, &DrillOptions{})
+	require.NoError(t, err)
+	require.Equal(t, snap.Header.Identifier, report.Snapshot)
+	require.Equal(t, 0, report.Failed)
+	require.NotZero(t, report.Restored)
+	require.Len(t, report.Files, report.Restored)
+
+	// critical paths missing from the snapshot fail the drill
+	report, err = snap.Drill(exporterInstance, &DrillOptions{
+		Critical: []string{dummy, "/nonexistent"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Restored)
+	require.Equal(t, 1, report.Failed)
+	require.Len(t, report.Files, 2)
+
+	require.Equal(t, dummy, report.Files[0].Path)
+	require.True(t, report.Files[0].OK)
+	require.Equal(t, int64(len("hello")), report.Files[0].Size)
+	require.Equal(t, "/nonexistent", report.Files[1].Path)
+	require.False(t, report.Files[1].OK)
+	require.NotEmpty(t, report.Files[1].Error)
+
+	contents, err := os.ReadFile(path.Join(exporterInstance.Root(), dummy))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+}
@@ -0,0 +1,159 @@
+package snapshot
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+type EntropyOptions struct {
+	// Directories with an average entropy above this value are reported.
+	Threshold float64
+	// Directories whose average entropy moved by more than this value
+	// since the previous snapshot are reported.
+	DeltaThreshold float64
+}
+
+func NewDefaultEntropyOptions() *EntropyOptions {
+	return &EntropyOptions{
+		Threshold:      7.0,
+		DeltaThreshold: 1.0,
+	}
+}
+
+type EntropyEntry struct {
+	Path            string  `json:"path"`
+	Files           uint64  `json:"files"`
+	AvgEntropy      float64 `json:"avg_entropy"`
+	MaxEntropy      float64 `json:"max_entropy"`
+	HiEntropy       uint64  `json:"hi_entropy"`
+	PrevAvgEntropy  float64 `json:"prev_avg_entropy"`
+	Delta           float64 `json:"delta"`
+	HasPrevious     bool    `json:"has_previous"`
+	AboveThreshold  bool    `json:"above_threshold"`
+	AboveDeltaLimit bool    `json:"above_delta_limit"`
+}
+
+// Previous returns the most recent snapshot of the same source taken before
+// this one, or nil if there is none.  Candidates are visited from the most
+// recently recorded one and only loaded until none of the remaining ones can
+// be more recent than the best match.
+func (snap *Snapshot) Previous() (*Snapshot, error) {
+	importer := snap.Header.GetSource(0).Importer
+
+	type candidate struct {
+		id       objects.MAC
+		recorded time.Time
+	}
+
+	var candidates []candidate
+	for snapshotID, recorded := range snap.repository.ListSnapshotTimestamps() {
+		if snapshotID == snap.Header.Identifier {
+			continue
+		}
+		candidates = append(candidates, candidate{id: snapshotID, recorded: recorded})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].recorded.After(candidates[j].recorded)
+	})
+
+	var previous *Snapshot
+	for _, c := range candidates {
+		// a snapshot is recorded after its header timestamp, so none
+		// of the remaining candidates can be more recent.
+		if previous != nil && c.recorded.Before(previous.Header.Timestamp) {
+			break
+		}
+
+		other, err := Load(snap.repository, c.id)
+		if err != nil {
+			if previous != nil {
+				previous.Close()
+			}
+			return nil, err
+		}
+
+		source := other.Header.GetSource(0).Importer
+		if source.Type != importer.Type || source.Origin != importer.Origin || source.Directory != importer.Directory ||
+			!other.Header.Timestamp.Before(snap.Header.Timestamp) ||
+			(previous != nil && !other.Header.Timestamp.After(previous.Header.Timestamp)) {
+			other.Close()
+			continue
+		}
+
+		if previous != nil {
+			previous.Close()
+		}
+		previous = other
+	}
+	return previous, nil
+}
+
+// Entropy walks the directories of the snapshot and reports those with an
+// abnormally high average entropy, or whose average entropy changed a lot
+// when compared to the same directory in prev.  prev may be nil.
+func (snap *Snapshot) Entropy(prev *Snapshot, opts *EntropyOptions) ([]EntropyEntry, error) {
+	if opts == nil {
+		opts = NewDefaultEntropyOptions()
+	}
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	var prevfs *vfs.Filesystem
+	if prev != nil {
+		prevfs, err = prev.Filesystem()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := make([]EntropyEntry, 0)
+	err = fs.WalkDir("/", func(path string, entry *vfs.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || entry.Summary == nil || entry.Summary.Directory.Files == 0 {
+			return nil
+		}
+
+		item := EntropyEntry{
+			Path:       path,
+			Files:      entry.Summary.Directory.Files,
+			AvgEntropy: entry.Summary.Directory.AvgEntropy,
+			MaxEntropy: entry.Summary.Directory.MaxEntropy,
+			HiEntropy:  entry.Summary.Directory.HiEntropy,
+		}
+		item.AboveThreshold = item.AvgEntropy >= opts.Threshold
+
+		if prevfs != nil {
+			if prevEntry, err := prevfs.GetEntry(path); err == nil && prevEntry.IsDir() && prevEntry.Summary != nil && prevEntry.Summary.Directory.Files != 0 {
+				item.HasPrevious = true
+				item.PrevAvgEntropy = prevEntry.Summary.Directory.AvgEntropy
+				item.Delta = item.AvgEntropy - item.PrevAvgEntropy
+				item.AboveDeltaLimit = math.Abs(item.Delta) >= opts.DeltaThreshold
+			}
+		}
+
+		if item.AboveThreshold || item.AboveDeltaLimit {
+			report = append(report, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		if math.Abs(report[i].Delta) != math.Abs(report[j].Delta) {
+			return math.Abs(report[i].Delta) > math.Abs(report[j].Delta)
+		}
+		return report[i].AvgEntropy > report[j].AvgEntropy
+	})
+	return report, nil
+}
@@ -0,0 +1,42 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrevious(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.repository
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	first := backupInto(t, repo, dir)
+	defer first.Close()
+	second := backupInto(t, repo, dir)
+	defer second.Close()
+	third := backupInto(t, repo, dir)
+	defer third.Close()
+	require.NoError(t, repo.RebuildState())
+
+	prev, err := third.Previous()
+	require.NoError(t, err)
+	require.NotNil(t, prev)
+	require.Equal(t, second.Header.Identifier, prev.Header.Identifier)
+	require.NoError(t, prev.Close())
+
+	prev, err = second.Previous()
+	require.NoError(t, err)
+	require.NotNil(t, prev)
+	require.Equal(t, first.Header.Identifier, prev.Header.Identifier)
+	require.NoError(t, prev.Close())
+
+	// the base snapshot is of another source
+	prev, err = first.Previous()
+	require.NoError(t, err)
+	require.Nil(t, prev)
+}
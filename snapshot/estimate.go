@@ -0,0 +1,204 @@
+package snapshot
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+// BackupEstimate predicts the work and the upload of a backup.  Sizes are
+// measured before compression and encryption, and exclude the metadata a
+// backup stores alongside the content.
+type BackupEstimate struct {
+	Files       uint64
+	Directories uint64
+	Size        uint64
+
+	// regular files the VFS cache vouches for, which are not read
+	CachedFiles uint64
+	CachedSize  uint64
+
+	// regular files which are read and chunked
+	ReadFiles uint64
+	ReadSize  uint64
+
+	// distinct chunks of the files read, and the ones of them the
+	// repository doesn't hold yet
+	Chunks    uint64
+	NewChunks uint64
+	NewSize   uint64
+
+	Errors   uint64
+	Duration time.Duration
+}
+
+// Estimate runs the scan and cache comparison of a backup with the given
+// options, then chunks the files the cache doesn't vouch for and looks
+// their chunks up in the repository state, to report what the backup would
+// upload.  Nothing is written to the repository nor to the VFS cache.
+func (snap *Snapshot) Estimate(imp importer.Importer, options *BackupOptions) (*BackupEstimate, error) {
+	vfsCache, err := snap.AppContext().GetCache().VFS(imp.Type(), imp.Origin())
+	if err != nil {
+		return nil, err
+	}
+
+	getCachedFilename := vfsCache.GetFilename
+	if options.NoCache {
+		getCachedFilename = func(string) ([]byte, error) { return nil, nil }
+	}
+
+	snap.wholeFileThreshold = options.WholeFileThreshold
+	snap.mailboxChunking = options.MailboxChunking
+
+	maxConcurrency := options.MaxConcurrency
+	if maxConcurrency == 0 {
+		maxConcurrency = uint64(snap.AppContext().MaxConcurrency)
+	}
+
+	scanner, err := imp.Scan()
+	if err != nil {
+		return nil, err
+	}
+
+	beginTime := time.Now()
+	estimate := &BackupEstimate{}
+	repoLocation := snap.repository.Location()
+
+	var mu sync.Mutex
+	seen := make(map[objects.MAC]struct{})
+
+	// cached returns true if the VFS cache holds an up to date entry for
+	// the file whose object the repository already has.
+	cached := func(record *importer.ScanRecord) bool {
+		data, err := getCachedFilename(record.Pathname)
+		if err != nil || data == nil {
+			return false
+		}
+		entry, err := vfs.EntryFromBytes(data)
+		if err != nil {
+			return false
+		}
+
+		unchanged := entry.Stat().Equal(&record.FileInfo)
+		if options.StrictCache {
+			unchanged = entry.Stat().EqualStrict(&record.FileInfo)
+		}
+		if !unchanged {
+			return false
+		}
+
+		data, err = vfsCache.GetObject(entry.Object)
+		if err != nil || data == nil {
+			return false
+		}
+		return snap.BlobExists(resources.RT_OBJECT, snap.repository.ComputeMAC(data))
+	}
+
+	estimateFile := func(record *importer.ScanRecord) error {
+		size := uint64(record.FileInfo.Size())
+		if cached(record) {
+			atomic.AddUint64(&estimate.CachedFiles, 1)
+			atomic.AddUint64(&estimate.CachedSize, size)
+			return nil
+		}
+		atomic.AddUint64(&estimate.ReadFiles, 1)
+		atomic.AddUint64(&estimate.ReadSize, size)
+
+		rd, err := imp.NewReader(record.Pathname)
+		if err != nil {
+			return err
+		}
+		defer rd.Close()
+
+		return snap.splitChunks(rd, record.FileInfo.Size(), snap.mailboxChunking, func(data []byte) error {
+			mac := snap.repository.ComputeMAC(data)
+
+			mu.Lock()
+			_, known := seen[mac]
+			seen[mac] = struct{}{}
+			mu.Unlock()
+			if known {
+				return nil
+			}
+
+			atomic.AddUint64(&estimate.Chunks, 1)
+			if !snap.chunkExists(mac) {
+				atomic.AddUint64(&estimate.NewChunks, 1)
+				atomic.AddUint64(&estimate.NewSize, uint64(len(data)))
+			}
+			return nil
+		})
+	}
+
+	wg := sync.WaitGroup{}
+	sem := make(chan bool, maxConcurrency)
+	for result := range scanner {
+		select {
+		case <-snap.AppContext().GetContext().Done():
+			wg.Wait()
+			return nil, snap.AppContext().GetContext().Err()
+		default:
+		}
+
+		if snap.skipExcludedPathname(options, result) {
+			continue
+		}
+
+		if result.Error != nil {
+			if result.Error.Pathname == imp.Root() || len(result.Error.Pathname) < len(imp.Root()) {
+				wg.Wait()
+				return nil, result.Error.Err
+			}
+			atomic.AddUint64(&estimate.Errors, 1)
+			continue
+		}
+
+		record := result.Record
+		if record == nil || record.IsTombstone || record.IsXattr {
+			continue
+		}
+		if strings.HasPrefix(record.Pathname, repoLocation+"/") {
+			continue
+		}
+
+		if record.FileInfo.Mode().IsDir() {
+			estimate.Directories++
+			continue
+		}
+
+		estimate.Files++
+		if !record.FileInfo.Mode().IsRegular() {
+			continue
+		}
+		estimate.Size += uint64(record.FileInfo.Size())
+
+		// content is never read in metadata-only mode
+		if options.MetadataOnly {
+			continue
+		}
+
+		sem <- true
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := estimateFile(record); err != nil {
+				snap.Logger().Warn("%s: %s", record.Pathname, err)
+				atomic.AddUint64(&estimate.Errors, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	estimate.Duration = time.Since(beginTime)
+	return estimate, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -19,6 +20,33 @@ type Exporter interface {
 	Close() error
 }
 
+// PlaceholderCreator is implemented by exporters able to materialize a file
+// of its final size ahead of its content, which lets browse-first restores
+// expose the complete tree before data is streamed in.
+type PlaceholderCreator interface {
+	CreatePlaceholder(pathname string, fileinfo *objects.FileInfo) error
+}
+
+// ExtendedAttributeStorer is implemented by exporters able to store a file
+// along with its extended attributes, which they may map to metadata of
+// their own.
+type ExtendedAttributeStorer interface {
+	StoreFileWithAttributes(pathname string, fp io.Reader, xattrs map[string][]byte) error
+}
+
+// FileReader is implemented by exporters able to read back what they
+// stored, which restores rely on to verify the written data.
+type FileReader interface {
+	ReadFile(pathname string) (io.ReadCloser, error)
+}
+
+// FileStater is implemented by exporters able to describe what they
+// stored, which delta restores rely on to skip up-to-date files.  A
+// missing file is reported with an error matching os.ErrNotExist.
+type FileStater interface {
+	StatFile(pathname string) (os.FileInfo, error)
+}
+
 var muBackends sync.Mutex
 var backends map[string]func(config map[string]string) (Exporter, error) = make(map[string]func(config map[string]string) (Exporter, error))
 
@@ -62,6 +90,8 @@ func NewExporter(config map[string]string) (Exporter, error) {
 			backendName = "s3"
 		} else if strings.HasPrefix(location, "fs://") {
 			backendName = "fs"
+		} else if strings.HasPrefix(location, "ftp://") || strings.HasPrefix(location, "ftps://") {
+			backendName = "ftp"
 		} else if strings.HasPrefix(location, "sftp://") {
 			backendName = "sftp"
 		} else {
@@ -55,6 +55,9 @@ func TestNewExporter(t *testing.T) {
 	Register("s3", func(config map[string]string) (Exporter, error) {
 		return MockedExporter{}, nil
 	})
+	Register("ftp", func(config map[string]string) (Exporter, error) {
+		return MockedExporter{}, nil
+	})
 
 	tests := []struct {
 		location        string
@@ -64,6 +67,8 @@ func TestNewExporter(t *testing.T) {
 		{location: "/", expectedError: "", expectedBackend: "fs"},
 		{location: "fs://some/path", expectedError: "", expectedBackend: "fs"},
 		{location: "s3://bucket/path", expectedError: "", expectedBackend: "s3"},
+		{location: "ftp://some/path", expectedError: "", expectedBackend: "ftp"},
+		{location: "ftps://some/path", expectedError: "", expectedBackend: "ftp"},
 		{location: "http://unsupported", expectedError: "unsupported importer protocol", expectedBackend: ""},
 	}
 
@@ -81,6 +81,27 @@ func (p *FSExporter) StoreFile(pathname string, fp io.Reader) error {
 	return nil
 }
 
+func (p *FSExporter) CreatePlaceholder(pathname string, fileinfo *objects.FileInfo) error {
+	f, err := os.OpenFile(pathname, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(fileinfo.Size()); err != nil {
+		return err
+	}
+	return os.Chtimes(pathname, fileinfo.ModTime(), fileinfo.ModTime())
+}
+
+func (p *FSExporter) ReadFile(pathname string) (io.ReadCloser, error) {
+	return os.Open(pathname)
+}
+
+func (p *FSExporter) StatFile(pathname string) (os.FileInfo, error) {
+	return os.Lstat(pathname)
+}
+
 func (p *FSExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
 	if err := os.Chmod(pathname, fileinfo.Mode()); err != nil {
 		return err
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
@@ -52,3 +53,27 @@ func TestExporter(t *testing.T) {
 	err = exporterInstance.SetPermissions(tmpExportDir+"/dummy.txt", &objects.FileInfo{Lmode: 0644})
 	require.NoError(t, err)
 }
+
+func TestExporterPlaceholder(t *testing.T) {
+	tmpExportDir, err := os.MkdirTemp("/tmp", "tmp_export*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpExportDir)
+	})
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpExportDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	pc, ok := exporterInstance.(exporter.PlaceholderCreator)
+	require.True(t, ok)
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = pc.CreatePlaceholder(tmpExportDir+"/dummy.txt", &objects.FileInfo{Lsize: 4096, LmodTime: mtime})
+	require.NoError(t, err)
+
+	st, err := os.Stat(tmpExportDir + "/dummy.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(4096), st.Size())
+	require.True(t, st.ModTime().Equal(mtime))
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/secsy/goftp"
+)
+
+// DEFAULT_RETRIES is how many times a transfer is attempted again when it
+// fails and couldn't be resumed, unless configured otherwise.
+const DEFAULT_RETRIES = 3
+
+type FTPExporter struct {
+	rootDir string
+	retries int
+	client  *goftp.Client
+}
+
+func init() {
+	exporter.Register("ftp", NewFTPExporter)
+}
+
+// ftpConfig returns the client configuration and address of the server
+// at location.  The ftps scheme defaults to implicit TLS, the tls option
+// selects between none, explicit and implicit.
+func ftpConfig(parsed *url.URL, config map[string]string) (goftp.Config, string, error) {
+	ftpconf := goftp.Config{
+		Timeout: 10 * time.Second,
+	}
+
+	if parsed.User != nil {
+		ftpconf.User = parsed.User.Username()
+		if password, ok := parsed.User.Password(); ok {
+			ftpconf.Password = password
+		}
+	}
+	if value, ok := config["username"]; ok {
+		ftpconf.User = value
+	}
+	if value, ok := config["password"]; ok {
+		ftpconf.Password = value
+	}
+
+	mode := "none"
+	if parsed.Scheme == "ftps" {
+		mode = "implicit"
+	}
+	if value, ok := config["tls"]; ok {
+		mode = value
+	}
+
+	insecure := false
+	if value, ok := config["tls_insecure_skip_verify"]; ok {
+		tmp, err := strconv.ParseBool(value)
+		if err != nil {
+			return ftpconf, "", fmt.Errorf("invalid tls_insecure_skip_verify value")
+		}
+		insecure = tmp
+	}
+
+	port := "21"
+	switch mode {
+	case "none":
+	case "explicit":
+		ftpconf.TLSMode = goftp.TLSExplicit
+	case "implicit":
+		ftpconf.TLSMode = goftp.TLSImplicit
+		port = "990"
+	default:
+		return ftpconf, "", fmt.Errorf("invalid tls value: %s", mode)
+	}
+	if mode != "none" {
+		ftpconf.TLSConfig = &tls.Config{
+			ServerName:         parsed.Hostname(),
+			InsecureSkipVerify: insecure,
+		}
+	}
+
+	host := parsed.Host
+	if parsed.Port() == "" {
+		host = parsed.Host + ":" + port
+	}
+	return ftpconf, host, nil
+}
+
+func NewFTPExporter(config map[string]string) (exporter.Exporter, error) {
+	location := config["location"]
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	ftpconf, host, err := ftpConfig(parsed, config)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := DEFAULT_RETRIES
+	if value, ok := config["retries"]; ok {
+		tmp, err := strconv.Atoi(value)
+		if err != nil || tmp < 0 {
+			return nil, fmt.Errorf("invalid retries value")
+		}
+		retries = tmp
+	}
+
+	client, err := goftp.DialConfig(ftpconf, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FTPExporter{
+		rootDir: path.Clean("/" + parsed.Path),
+		retries: retries,
+		client:  client,
+	}, nil
+}
+
+func (p *FTPExporter) Root() string {
+	return p.rootDir
+}
+
+func (p *FTPExporter) CreateDirectory(pathname string) error {
+	current := "/"
+	for _, atom := range strings.Split(path.Clean(pathname), "/") {
+		if atom == "" {
+			continue
+		}
+		current = path.Join(current, atom)
+		if info, err := p.client.Stat(current); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s: not a directory", current)
+			}
+			continue
+		}
+		if _, err := p.client.Mkdir(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreFile spools the file to a temporary file unless it can be sought,
+// which lets the client resume interrupted uploads when the server
+// supports it.  Uploads that couldn't be resumed are started over up to
+// the configured number of retries.
+func (p *FTPExporter) StoreFile(pathname string, fp io.Reader) error {
+	src, ok := fp.(io.ReadSeeker)
+	if !ok {
+		tmpfile, err := os.CreateTemp("", "plakar-ftp-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmpfile.Name())
+		defer tmpfile.Close()
+
+		if _, err := io.Copy(tmpfile, fp); err != nil {
+			return err
+		}
+		src = tmpfile
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if _, err = src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err = p.client.Store(pathname, src); err == nil {
+			break
+		}
+	}
+	return err
+}
+
+// SetPermissions is a no-op, FTP has no portable way of setting modes.
+func (p *FTPExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	return nil
+}
+
+func (p *FTPExporter) Close() error {
+	return p.client.Close()
+}
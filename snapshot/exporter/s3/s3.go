@@ -17,6 +17,7 @@
 package s3
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -26,13 +27,31 @@ import (
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/dustin/go-humanize"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+// Objects are uploaded in parts of DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY
+// of them at once, and uploads failing are attempted DEFAULT_RETRIES more
+// times unless configured otherwise.
+const (
+	DEFAULT_PART_SIZE   = 16 << 20
+	DEFAULT_CONCURRENCY = 4
+	DEFAULT_RETRIES     = 3
+
+	// S3 doesn't accept parts smaller than 5MiB, but for the last one
+	MIN_PART_SIZE = 5 << 20
 )
 
 type S3Exporter struct {
 	minioClient *minio.Client
 	rootDir     string
+
+	partSize    uint64
+	concurrency uint
+	retries     int
 }
 
 func init() {
@@ -74,6 +93,36 @@ func NewS3Exporter(config map[string]string) (exporter.Exporter, error) {
 		useSsl = tmp
 	}
 
+	partSize := uint64(DEFAULT_PART_SIZE)
+	if value, ok := config["part_size"]; ok {
+		tmp, err := humanize.ParseBytes(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid part_size value")
+		}
+		if tmp < MIN_PART_SIZE {
+			return nil, fmt.Errorf("part_size can't be smaller than %s", humanize.IBytes(MIN_PART_SIZE))
+		}
+		partSize = tmp
+	}
+
+	concurrency := uint(DEFAULT_CONCURRENCY)
+	if value, ok := config["concurrency"]; ok {
+		tmp, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || tmp == 0 {
+			return nil, fmt.Errorf("invalid concurrency value")
+		}
+		concurrency = uint(tmp)
+	}
+
+	retries := DEFAULT_RETRIES
+	if value, ok := config["retries"]; ok {
+		tmp, err := strconv.Atoi(value)
+		if err != nil || tmp < 0 {
+			return nil, fmt.Errorf("invalid retries value")
+		}
+		retries = tmp
+	}
+
 	parsed, err := url.Parse(location)
 	if err != nil {
 		return nil, err
@@ -94,6 +143,9 @@ func NewS3Exporter(config map[string]string) (exporter.Exporter, error) {
 	return &S3Exporter{
 		rootDir:     parsed.Path,
 		minioClient: conn,
+		partSize:    partSize,
+		concurrency: concurrency,
+		retries:     retries,
 	}, nil
 }
 
@@ -105,14 +157,71 @@ func (p *S3Exporter) CreateDirectory(pathname string) error {
 	return nil
 }
 
-func (p *S3Exporter) StoreFile(pathname string, fp io.Reader) error {
-	_, err := p.minioClient.PutObject(context.Background(),
-		strings.TrimPrefix(p.rootDir, "/"),
-		strings.TrimPrefix(pathname, p.rootDir+"/"),
-		fp, -1, minio.PutObjectOptions{})
+// putObject uploads an object, a single part being buffered first so that
+// small objects are sent at once and retried on failure.  Larger objects
+// are sent as a multipart upload of concurrently streamed parts, each part
+// being retried by the client itself.
+func (p *S3Exporter) putObject(pathname string, fp io.Reader, options minio.PutObjectOptions) error {
+	var head bytes.Buffer
+	if _, err := io.CopyN(&head, fp, int64(p.partSize)); err != nil && err != io.EOF {
+		return err
+	}
+
+	bucket := strings.TrimPrefix(p.rootDir, "/")
+	object := strings.TrimPrefix(pathname, p.rootDir+"/")
+
+	if uint64(head.Len()) < p.partSize {
+		var err error
+		for attempt := 0; attempt <= p.retries; attempt++ {
+			_, err = p.minioClient.PutObject(context.Background(), bucket, object,
+				bytes.NewReader(head.Bytes()), int64(head.Len()), options)
+			if err == nil {
+				break
+			}
+		}
+		return err
+	}
+
+	options.PartSize = p.partSize
+	options.NumThreads = p.concurrency
+	options.ConcurrentStreamParts = p.concurrency > 1
+	_, err := p.minioClient.PutObject(context.Background(), bucket, object,
+		io.MultiReader(&head, fp), -1, options)
 	return err
 }
 
+func (p *S3Exporter) StoreFile(pathname string, fp io.Reader) error {
+	return p.putObject(pathname, fp, minio.PutObjectOptions{})
+}
+
+// StoreFileWithAttributes stores a file along with the metadata recorded
+// by the s3 importer.  Version IDs and ACLs are only hints of the source
+// bucket and are not applied.
+func (p *S3Exporter) StoreFileWithAttributes(pathname string, fp io.Reader, xattrs map[string][]byte) error {
+	options := minio.PutObjectOptions{}
+	for name, value := range xattrs {
+		switch {
+		case name == "s3.content-type":
+			options.ContentType = string(value)
+		case name == "s3.storage-class":
+			options.StorageClass = string(value)
+		case name == "s3.tags":
+			objectTags, err := tags.ParseObjectTags(string(value))
+			if err != nil {
+				return err
+			}
+			options.UserTags = objectTags.ToMap()
+		case strings.HasPrefix(name, "s3.meta."):
+			if options.UserMetadata == nil {
+				options.UserMetadata = make(map[string]string)
+			}
+			options.UserMetadata[strings.TrimPrefix(name, "s3.meta.")] = string(value)
+		}
+	}
+
+	return p.putObject(pathname, fp, options)
+}
+
 func (p *S3Exporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
 	return nil
 }
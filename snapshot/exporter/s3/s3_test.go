@@ -1,8 +1,10 @@
 package s3
 
 import (
+	"bytes"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/objects"
@@ -51,3 +53,63 @@ func TestExporter(t *testing.T) {
 	err = exporterInstance.SetPermissions("bucket/subdir", &objects.FileInfo{Lmode: 0644})
 	require.NoError(t, err)
 }
+
+func TestExporterAttributes(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	ts := httptest.NewServer(faker.Server())
+	defer ts.Close()
+
+	tmpExportBucket := "s3://" + ts.Listener.Addr().String() + "/bucket"
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpExportBucket, "access_key": "", "secret_access_key": "", "use_tls": "false"})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	xs, ok := exporterInstance.(exporter.ExtendedAttributeStorer)
+	require.True(t, ok)
+
+	err = xs.StoreFileWithAttributes("/bucket/dummy.txt", strings.NewReader("test exporter s3"), map[string][]byte{
+		"s3.content-type": []byte("text/plain"),
+		"s3.meta.owner":   []byte("alice"),
+		"s3.version-id":   []byte("ignored"),
+	})
+	require.NoError(t, err)
+
+	object, err := backend.HeadObject("bucket", "dummy.txt")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", object.Metadata["Content-Type"])
+	require.Equal(t, "alice", object.Metadata["X-Amz-Meta-Owner"])
+}
+
+func TestExporterMultipart(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	ts := httptest.NewServer(faker.Server())
+	defer ts.Close()
+
+	tmpExportBucket := "s3://" + ts.Listener.Addr().String() + "/bucket"
+	config := map[string]string{"location": tmpExportBucket, "access_key": "", "secret_access_key": "", "use_tls": "false"}
+
+	config["part_size"] = "1MiB"
+	_, err := exporter.NewExporter(config)
+	require.EqualError(t, err, "part_size can't be smaller than 5.0 MiB")
+
+	config["part_size"] = "5MiB"
+	config["concurrency"] = "0"
+	_, err = exporter.NewExporter(config)
+	require.EqualError(t, err, "invalid concurrency value")
+
+	config["concurrency"] = "2"
+	exporterInstance, err := exporter.NewExporter(config)
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	data := bytes.Repeat([]byte("plakar"), 2<<20)
+	err = exporterInstance.StoreFile("/bucket/large.bin", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	object, err := backend.HeadObject("bucket", "large.bin")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), object.Size)
+}
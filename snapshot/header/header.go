@@ -1,8 +1,13 @@
 package header
 
 import (
+	"bytes"
 	"errors"
+	"maps"
+	"math"
+	"path"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -25,6 +30,18 @@ type Importer struct {
 	Type      string `msgpack:"type" json:"type"`
 	Origin    string `msgpack:"origin" json:"origin"`
 	Directory string `msgpack:"directory" json:"directory"`
+
+	// File is set when a single file was backed up, Directory is then
+	// the directory holding it.
+	File string `msgpack:"file,omitempty" json:"file,omitempty"`
+}
+
+// Root returns the path that was backed up, be it a directory or a file.
+func (i Importer) Root() string {
+	if i.File == "" {
+		return i.Directory
+	}
+	return path.Join(i.Directory, i.File)
 }
 
 type Identity struct {
@@ -57,23 +74,131 @@ type VFS struct {
 	Root   objects.MAC `msgpack:"root" json:"root"`
 	Xattrs objects.MAC `msgpack:"xattrs" json:"xattrs"`
 	Errors objects.MAC `msgpack:"errors" json:"errors"`
+
+	// ErrorsOverflow counts the errors left out of the error index
+	// once it reached its maximum size.
+	ErrorsOverflow uint64 `msgpack:"errors_overflow" json:"errors_overflow"`
+}
+
+// SortedMap is encoded with its keys in increasing order, the encoder only
+// sorts the keys of string maps and headers must serialize to the same
+// bytes every time.
+type SortedMap[T uint64 | float64 | string] map[string]T
+
+func (m SortedMap[T]) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if m == nil {
+		return enc.EncodeNil()
+	}
+	if err := enc.EncodeMapLen(len(m)); err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		if err := enc.EncodeString(key); err != nil {
+			return err
+		}
+		if err := enc.Encode(m[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type FileTypes struct {
+	Files uint64 `msgpack:"files" json:"files"`
+
+	Kind      SortedMap[uint64] `msgpack:"kind" json:"kind"`
+	Type      SortedMap[uint64] `msgpack:"type" json:"type"`
+	Extension SortedMap[uint64] `msgpack:"extension" json:"extension"`
+
+	PercentKind      SortedMap[float64] `msgpack:"percent_kind" json:"percent_kind"`
+	PercentType      SortedMap[float64] `msgpack:"percent_type" json:"percent_type"`
+	PercentExtension SortedMap[float64] `msgpack:"percent_extension" json:"percent_extension"`
+}
+
+func NewFileTypes() FileTypes {
+	return FileTypes{
+		Kind:             make(SortedMap[uint64]),
+		Type:             make(SortedMap[uint64]),
+		Extension:        make(SortedMap[uint64]),
+		PercentKind:      make(SortedMap[float64]),
+		PercentType:      make(SortedMap[float64]),
+		PercentExtension: make(SortedMap[float64]),
+	}
+}
+
+// Record accounts for a file given its detected content type and its
+// extension, which may both be empty.
+func (ft *FileTypes) Record(contentType string, extension string) {
+	objectType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	objectKind := strings.SplitN(objectType, "/", 2)[0]
+	if objectType == "" {
+		objectType = "unknown"
+		objectKind = "unknown"
+	}
+
+	extension = strings.ToLower(extension)
+	if extension == "" {
+		extension = "none"
+	}
+
+	ft.Files++
+	ft.Kind[objectKind]++
+	ft.Type[objectType]++
+	ft.Extension[extension]++
+}
+
+// UpdatePercents computes the share of each kind, type and extension,
+// rounded to two decimals.
+func (ft *FileTypes) UpdatePercents() {
+	if ft.Files == 0 {
+		return
+	}
+	percent := func(value uint64) float64 {
+		return math.Round((float64(value)/float64(ft.Files)*100)*100) / 100
+	}
+	for key, value := range ft.Kind {
+		ft.PercentKind[key] = percent(value)
+	}
+	for key, value := range ft.Type {
+		ft.PercentType[key] = percent(value)
+	}
+	for key, value := range ft.Extension {
+		ft.PercentExtension[key] = percent(value)
+	}
+}
+
+// Stats records how a source was backed up, for capacity planning.
+type Stats struct {
+	// ScannedSize is the size of the regular files read from the source,
+	// TransferredSize the size of the data written to the repository once
+	// deduplicated, compressed and encrypted.
+	ScannedSize     uint64 `msgpack:"scanned_size" json:"scanned_size"`
+	TransferredSize uint64 `msgpack:"transferred_size" json:"transferred_size"`
+
+	// CacheHits counts the regular files whose content was known from the
+	// VFS cache, CacheMisses those that had to be chunked.
+	CacheHits   uint64 `msgpack:"cache_hits" json:"cache_hits"`
+	CacheMisses uint64 `msgpack:"cache_misses" json:"cache_misses"`
 }
 
 type Source struct {
-	Importer Importer    `msgpack:"importer" json:"importer"`
-	Context  []KeyValue  `msgpack:"context" json:"context"`
-	VFS      VFS         `msgpack:"root" json:"root"`
-	Indexes  []Index     `msgpack:"indexes" json:"indexes"`
-	Summary  vfs.Summary `msgpack:"summary" json:"summary"`
+	Importer  Importer    `msgpack:"importer" json:"importer"`
+	Context   []KeyValue  `msgpack:"context" json:"context"`
+	VFS       VFS         `msgpack:"root" json:"root"`
+	Indexes   []Index     `msgpack:"indexes" json:"indexes"`
+	Summary   vfs.Summary `msgpack:"summary" json:"summary"`
+	FileTypes FileTypes   `msgpack:"file_types" json:"file_types"`
+	Stats     Stats       `msgpack:"stats" json:"stats"`
 }
 
 func NewSource() Source {
 	return Source{
-		Importer: Importer{},
-		Context:  []KeyValue{},
-		VFS:      VFS{},
-		Indexes:  []Index{},
-		Summary:  vfs.Summary{},
+		Importer:  Importer{},
+		Context:   []KeyValue{},
+		VFS:       VFS{},
+		Indexes:   []Index{},
+		Summary:   vfs.Summary{},
+		FileTypes: NewFileTypes(),
 	}
 }
 
@@ -88,9 +213,13 @@ type Header struct {
 	Environment     string             `msgpack:"environment" json:"environment"`
 	Perimeter       string             `msgpack:"perimeter" json:"perimeter"`
 	Job             string             `msgpack:"job" json:"job"`
+	Namespace       string             `msgpack:"namespace" json:"namespace"`
 	Replicas        uint32             `msgpack:"replicas" json:"replicas"`
 	Classifications []Classification   `msgpack:"classifications" json:"classifications"`
 	Tags            []string           `msgpack:"tags" json:"tags"`
+	TagValues       SortedMap[string]  `msgpack:"tag_values" json:"tag_values"`
+	MetadataOnly    bool               `msgpack:"metadata_only" json:"metadata_only"`
+	Synthetic       objects.MAC        `msgpack:"synthetic" json:"synthetic"`
 	Context         []KeyValue         `msgpack:"context" json:"context"`
 	Sources         []Source           `msgpack:"sources" json:"sources"`
 }
@@ -108,6 +237,7 @@ func NewHeader(name string, identifier objects.MAC) *Header {
 		Replicas:        1,
 		Classifications: []Classification{},
 		Tags:            []string{},
+		TagValues:       SortedMap[string]{},
 
 		Identity: Identity{},
 
@@ -124,12 +254,16 @@ func NewFromBytes(serialized []byte) (*Header, error) {
 	}
 }
 
+// Serialize encodes the header with its map keys sorted, so that the same
+// header always yields the same bytes as signatures are computed over them.
 func (h *Header) Serialize() ([]byte, error) {
-	if serialized, err := msgpack.Marshal(h); err != nil {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(h); err != nil {
 		return nil, err
-	} else {
-		return serialized, nil
 	}
+	return buf.Bytes(), nil
 }
 
 func (h *Header) SetContext(key, value string) {
@@ -169,6 +303,96 @@ func (h *Header) HasTag(tag string) bool {
 	return false
 }
 
+// AddTag appends tag to the list of tags, a key=value tag is also
+// recorded in TagValues.
+func (h *Header) AddTag(tag string) {
+	h.Tags = append(h.Tags, tag)
+	if key, value, found := strings.Cut(tag, "="); found && key != "" {
+		if h.TagValues == nil {
+			h.TagValues = make(SortedMap[string])
+		}
+		h.TagValues[key] = value
+	}
+}
+
+// TagValue returns the value of a key=value tag, falling back to the list
+// of tags for snapshots which predate TagValues.
+func (h *Header) TagValue(key string) (string, bool) {
+	if value, found := h.TagValues[key]; found {
+		return value, true
+	}
+	for _, t := range h.Tags {
+		if k, value, found := strings.Cut(t, "="); found && k == key {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+type tagTerm struct {
+	key     string
+	value   string
+	compare string
+}
+
+// TagFilter selects snapshots on their tags, all of its terms must match.
+type TagFilter []tagTerm
+
+// ParseTagFilter parses a comma-separated list of terms: "key=value" and
+// "key!=value" compare the value of a key=value tag, any other term
+// matches a tag or the tags below it in a "/" hierarchy, so that "site"
+// matches "site/paris".
+func ParseTagFilter(filter string) (TagFilter, error) {
+	terms := TagFilter{}
+	for _, term := range strings.Split(filter, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var t tagTerm
+		if key, value, found := strings.Cut(term, "!="); found {
+			t = tagTerm{key: key, value: value, compare: "!="}
+		} else if key, value, found := strings.Cut(term, "="); found {
+			t = tagTerm{key: key, value: value, compare: "="}
+		} else {
+			t = tagTerm{key: strings.TrimSuffix(term, "/")}
+		}
+		if t.key == "" {
+			return nil, errors.New("invalid tag filter: " + term)
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+func (f TagFilter) Match(h *Header) bool {
+	for _, term := range f {
+		switch term.compare {
+		case "=":
+			if value, found := h.TagValue(term.key); !found || value != term.value {
+				return false
+			}
+		case "!=":
+			if value, found := h.TagValue(term.key); found && value == term.value {
+				return false
+			}
+		default:
+			matched := false
+			for _, t := range h.Tags {
+				if t == term.key || strings.HasPrefix(t, term.key+"/") {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func ParseSortKeys(sortKeysStr string) ([]string, error) {
 	if sortKeysStr == "" {
 		return nil, nil
@@ -2,6 +2,7 @@ package header
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
@@ -225,3 +226,118 @@ func TestHeaderMethods(t *testing.T) {
 
 	require.Equal(t, NewSource(), *header.GetSource(0))
 }
+
+func TestTagFilter(t *testing.T) {
+	header := NewHeader("default", objects.MAC{})
+	header.AddTag("env=prod")
+	header.AddTag("app=web")
+	header.AddTag("site/paris/dc1")
+	require.Equal(t, SortedMap[string]{"env": "prod", "app": "web"}, header.TagValues)
+
+	// snapshots predating TagValues only have the flat list
+	legacy := NewHeader("legacy", objects.MAC{})
+	legacy.Tags = []string{"env=staging"}
+
+	tests := []struct {
+		filter string
+		header bool
+		legacy bool
+	}{
+		{"", true, true},
+		{"env=prod", true, false},
+		{"env=staging", false, true},
+		{"app!=test", true, true},
+		{"app!=web", false, true},
+		{"env=prod,app=web", true, false},
+		{"env=prod,app=api", false, false},
+		{"site", true, false},
+		{"site/paris", true, false},
+		{"site/par", false, false},
+		{"site/paris/dc1", true, false},
+	}
+	for _, test := range tests {
+		filter, err := ParseTagFilter(test.filter)
+		require.NoError(t, err)
+		require.Equal(t, test.header, filter.Match(header), test.filter)
+		require.Equal(t, test.legacy, filter.Match(legacy), test.filter)
+	}
+
+	_, err := ParseTagFilter("=prod")
+	require.Error(t, err)
+}
+
+func TestSerializeTagValues(t *testing.T) {
+	hdr := NewHeader("test", objects.MAC{0x01})
+	for i := 0; i < 16; i++ {
+		hdr.AddTag(fmt.Sprintf("key%d=value%d", i, i))
+	}
+
+	serialized, err := hdr.Serialize()
+	require.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		again, err := hdr.Serialize()
+		require.NoError(t, err)
+		require.Equal(t, serialized, again)
+	}
+
+	loaded, err := NewFromBytes(serialized)
+	require.NoError(t, err)
+	require.Equal(t, hdr.TagValues, loaded.TagValues)
+	again, err := loaded.Serialize()
+	require.NoError(t, err)
+	require.Equal(t, serialized, again)
+}
+
+func TestFileTypes(t *testing.T) {
+	ft := NewFileTypes()
+	ft.Record("text/plain; charset=utf-8", ".TXT")
+	ft.Record("text/html", ".html")
+	ft.Record("image/png", ".png")
+	ft.Record("", "")
+	ft.UpdatePercents()
+
+	require.Equal(t, uint64(4), ft.Files)
+	require.Equal(t, uint64(2), ft.Kind["text"])
+	require.Equal(t, uint64(1), ft.Type["text/plain"])
+	require.Equal(t, uint64(1), ft.Type["unknown"])
+	require.Equal(t, uint64(1), ft.Extension[".txt"])
+	require.Equal(t, uint64(1), ft.Extension["none"])
+	require.Equal(t, 50.0, ft.PercentKind["text"])
+	require.Equal(t, 25.0, ft.PercentExtension[".png"])
+}
+
+func TestSerializeDeterministic(t *testing.T) {
+	hdr := NewHeader("test", objects.MAC{0x01})
+	ft := &hdr.Sources[0].FileTypes
+	for i, ext := range []string{".txt", ".html", ".png", ".go", ".md", ".json", ".yaml", ".c"} {
+		for j := 0; j <= i; j++ {
+			ft.Record(fmt.Sprintf("type%d/subtype%d", i, j), ext)
+		}
+	}
+	ft.UpdatePercents()
+
+	serialized, err := hdr.Serialize()
+	require.NoError(t, err)
+
+	// maps are encoded in random order unless their keys are sorted
+	for i := 0; i < 32; i++ {
+		again, err := hdr.Serialize()
+		require.NoError(t, err)
+		require.Equal(t, serialized, again)
+	}
+
+	// verifying a signature re-serializes the header as loaded
+	loaded, err := NewFromBytes(serialized)
+	require.NoError(t, err)
+	again, err := loaded.Serialize()
+	require.NoError(t, err)
+	require.Equal(t, serialized, again)
+}
+
+func TestImporterRoot(t *testing.T) {
+	imp := Importer{Directory: "/etc"}
+	require.Equal(t, "/etc", imp.Root())
+
+	imp.File = "hosts"
+	require.Equal(t, "/etc/hosts", imp.Root())
+}
@@ -0,0 +1,121 @@
+package snapshot
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	"github.com/google/uuid"
+)
+
+// HeaderExport is the JSON form of a snapshot header, as exported for
+// tooling and archival.  A full export also carries the signature and the
+// proof of existence of the snapshot, so that it can be registered again,
+// still verifiable, into a repository whose states were lost.
+type HeaderExport struct {
+	Header    *header.Header `json:"header"`
+	Signature []byte         `json:"signature,omitempty"`
+	Timestamp []byte         `json:"timestamp,omitempty"`
+}
+
+// ExportHeader returns the header of the snapshot, along with its
+// signature and timestamp token if full is set.
+func (snap *Snapshot) ExportHeader(full bool) (*HeaderExport, error) {
+	export := &HeaderExport{Header: snap.Header}
+	if !full {
+		return export, nil
+	}
+
+	if snap.BlobExists(resources.RT_SIGNATURE, snap.Header.Identifier) {
+		signature, err := snap.GetBlob(resources.RT_SIGNATURE, snap.Header.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		export.Signature = signature
+	}
+
+	if snap.HasTimestamp() {
+		token, err := snap.GetTimestamp()
+		if err != nil {
+			return nil, err
+		}
+		export.Timestamp = token
+	}
+
+	return export, nil
+}
+
+// ImportHeader registers an exported header as a snapshot of repo.  The
+// filesystems it refers to must be present in the repository, for instance
+// once its packfiles were adopted, and a signature, if provided, must
+// match the header.
+func ImportHeader(repo *repository.Repository, export *HeaderExport) (objects.MAC, error) {
+	hdr := export.Header
+	if hdr == nil || hdr.Identifier == (objects.MAC{}) {
+		return objects.MAC{}, fmt.Errorf("no snapshot header to import")
+	}
+
+	if repo.BlobExists(resources.RT_SNAPSHOT, hdr.Identifier) {
+		return objects.MAC{}, fmt.Errorf("snapshot %x already exists", hdr.GetIndexShortID())
+	}
+
+	for i, source := range hdr.Sources {
+		if !repo.BlobExists(resources.RT_VFS_BTREE, source.VFS.Root) {
+			return objects.MAC{}, fmt.Errorf("filesystem %x of source %d is missing from the repository", source.VFS.Root[:4], i)
+		}
+	}
+
+	serializedHdr, err := hdr.Serialize()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+
+	if export.Signature != nil {
+		if hdr.Identity.Identifier == uuid.Nil {
+			return objects.MAC{}, fmt.Errorf("signature provided for an unsigned header")
+		}
+		serializedHdrMAC := repo.ComputeMAC(serializedHdr)
+		if !ed25519.Verify(hdr.Identity.PublicKey, serializedHdrMAC[:], export.Signature) {
+			return objects.MAC{}, errors.New("signature does not match the header")
+		}
+	}
+
+	// The blobs are pushed through a snapshot of our own so that the
+	// delta state registering them has its own identifier, as the state
+	// named after the original snapshot may still exist.
+	snap, err := New(repo)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	defer snap.Close()
+
+	done, err := snap.Lock()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	defer snap.Unlock(done)
+
+	if export.Signature != nil {
+		if err := snap.PutBlob(resources.RT_SIGNATURE, hdr.Identifier, export.Signature); err != nil {
+			return objects.MAC{}, err
+		}
+	}
+	if export.Timestamp != nil {
+		if err := snap.PutBlob(resources.RT_TIMESTAMP, hdr.Identifier, export.Timestamp); err != nil {
+			return objects.MAC{}, err
+		}
+	}
+	if err := snap.PutBlob(resources.RT_SNAPSHOT, hdr.Identifier, serializedHdr); err != nil {
+		return objects.MAC{}, err
+	}
+
+	if err := snap.pushState(); err != nil {
+		return objects.MAC{}, err
+	}
+
+	return hdr.Identifier, nil
+}
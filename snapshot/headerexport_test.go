@@ -0,0 +1,76 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportHeader(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	repo := snap.repository
+	require.NoError(t, repo.RebuildState())
+
+	// sign the header by hand, as if it was backed up by an enrolled client
+	kp, err := keypair.Generate()
+	require.NoError(t, err)
+	snap.Header.Identity.Identifier = uuid.New()
+	snap.Header.Identity.PublicKey = kp.PublicKey
+
+	export, err := snap.ExportHeader(true)
+	require.NoError(t, err)
+	serialized, err := snap.Header.Serialize()
+	require.NoError(t, err)
+	mac := repo.ComputeMAC(serialized)
+	export.Signature = kp.Sign(mac[:])
+
+	// the export survives a round trip through JSON
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	var decoded HeaderExport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	_, err = ImportHeader(repo, &decoded)
+	require.ErrorContains(t, err, "already exists")
+
+	// lose the header, as when the states recording it were lost
+	identifier := snap.Header.Identifier
+	packfile, exists, err := repo.GetPackfileForBlob(resources.RT_SNAPSHOT, identifier)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, repo.RemoveBlob(resources.RT_SNAPSHOT, identifier, packfile))
+	require.False(t, repo.BlobExists(resources.RT_SNAPSHOT, identifier))
+
+	tampered := *decoded.Header
+	tampered.Name = "tampered"
+	_, err = ImportHeader(repo, &HeaderExport{Header: &tampered, Signature: decoded.Signature})
+	require.ErrorContains(t, err, "signature does not match")
+
+	orphan := *decoded.Header
+	orphan.Sources = []header.Source{header.NewSource()}
+	orphan.Sources[0].VFS.Root = objects.MAC{1}
+	_, err = ImportHeader(repo, &HeaderExport{Header: &orphan})
+	require.ErrorContains(t, err, "missing from the repository")
+
+	snapshotID, err := ImportHeader(repo, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, identifier, snapshotID)
+
+	require.NoError(t, repo.RebuildState())
+	imported, err := Load(repo, snapshotID)
+	require.NoError(t, err)
+	defer imported.Close()
+	require.Equal(t, snap.Header.GetSource(0).VFS.Root, imported.Header.GetSource(0).VFS.Root)
+
+	verified, err := imported.Verify()
+	require.NoError(t, err)
+	require.True(t, verified)
+}
@@ -0,0 +1,367 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package dav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+const (
+	NS_DAV     = "DAV:"
+	NS_CALDAV  = "urn:ietf:params:xml:ns:caldav"
+	NS_CARDDAV = "urn:ietf:params:xml:ns:carddav"
+)
+
+// kind describes what a DAV importer collects: the resource type of its
+// collections and the extension of the vObject files it stores.
+type kind struct {
+	name      string
+	namespace string
+	resource  string
+	extension string
+}
+
+var (
+	calendars    = kind{name: "caldav", namespace: NS_CALDAV, resource: "calendar", extension: ".ics"}
+	addressBooks = kind{name: "carddav", namespace: NS_CARDDAV, resource: "addressbook", extension: ".vcf"}
+)
+
+// DAVImporter stores each event or contact of the calendars or address
+// books found at location as a vObject file, /<collection>/<item>.
+type DAVImporter struct {
+	kind     kind
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+
+	items sync.Map
+	ino   uint64
+}
+
+func init() {
+	importer.Register("caldav", NewCalDAVImporter)
+	importer.Register("carddav", NewCardDAVImporter)
+}
+
+func NewCalDAVImporter(config map[string]string) (importer.Importer, error) {
+	return newDAVImporter(calendars, config)
+}
+
+func NewCardDAVImporter(config map[string]string) (importer.Importer, error) {
+	return newDAVImporter(addressBooks, config)
+}
+
+func newDAVImporter(kind kind, config map[string]string) (importer.Importer, error) {
+	location := config["location"]
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed.Scheme {
+	case kind.name:
+		parsed.Scheme = "http"
+	case kind.name + "s":
+		parsed.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+	if !strings.HasSuffix(parsed.Path, "/") {
+		parsed.Path += "/"
+	}
+
+	username := parsed.User.Username()
+	password, _ := parsed.User.Password()
+	if value, ok := config["username"]; ok {
+		username = value
+	}
+	if value, ok := config["password"]; ok {
+		password = value
+	}
+	parsed.User = nil
+
+	return &DAVImporter{
+		kind:     kind,
+		base:     parsed,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   prop   `xml:"DAV: prop"`
+}
+
+type prop struct {
+	ResourceType  resourceType `xml:"DAV: resourcetype"`
+	ETag          string       `xml:"DAV: getetag"`
+	LastModified  string       `xml:"DAV: getlastmodified"`
+	ContentLength string       `xml:"DAV: getcontentlength"`
+}
+
+type resourceType struct {
+	Types []xml.Name `xml:",any"`
+}
+
+func (r resourceType) is(namespace, name string) bool {
+	for _, t := range r.Types {
+		if t.Space == namespace && t.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// found returns the properties the server found, merging the propstat
+// elements reporting a 200 status.
+func (r *response) found() prop {
+	ret := prop{}
+	for _, ps := range r.Propstats {
+		fields := strings.Fields(ps.Status)
+		if len(fields) < 2 || fields[1] != "200" {
+			continue
+		}
+		ret.ResourceType.Types = append(ret.ResourceType.Types, ps.Prop.ResourceType.Types...)
+		if ps.Prop.ETag != "" {
+			ret.ETag = ps.Prop.ETag
+		}
+		if ps.Prop.LastModified != "" {
+			ret.LastModified = ps.Prop.LastModified
+		}
+		if ps.Prop.ContentLength != "" {
+			ret.ContentLength = ps.Prop.ContentLength
+		}
+	}
+	return ret
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getetag/>
+    <d:getlastmodified/>
+    <d:getcontentlength/>
+  </d:prop>
+</d:propfind>`
+
+func (p *DAVImporter) do(req *http.Request) (*http.Response, error) {
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	return p.client.Do(req)
+}
+
+// propfind returns the responses of a PROPFIND request on u, with their
+// href resolved against it.
+func (p *DAVImporter) propfind(u *url.URL, depth string) (map[*url.URL]prop, error) {
+	req, err := http.NewRequest("PROPFIND", u.String(), bytes.NewBufferString(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("%s: %s", u.Path, resp.Status)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("%s: invalid multistatus response: %w", u.Path, err)
+	}
+
+	ret := make(map[*url.URL]prop, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := u.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		ret[href] = r.found()
+	}
+	return ret, nil
+}
+
+// collections returns the calendars or address books to archive: location
+// itself if it is one, or the ones right below it otherwise.
+func (p *DAVImporter) collections() ([]*url.URL, error) {
+	responses, err := p.propfind(p.base, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*url.URL{}
+	for href, prop := range responses {
+		if !prop.ResourceType.is(p.kind.namespace, p.kind.resource) {
+			continue
+		}
+		if strings.TrimSuffix(href.Path, "/") == strings.TrimSuffix(p.base.Path, "/") {
+			return []*url.URL{p.base}, nil
+		}
+		ret = append(ret, href)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
+
+// itemName returns the name under which the item at href is stored.
+func (p *DAVImporter) itemName(href *url.URL) string {
+	name := path.Base(href.Path)
+	if !strings.HasSuffix(strings.ToLower(name), p.kind.extension) {
+		name += p.kind.extension
+	}
+	return name
+}
+
+func (p *DAVImporter) newFileInfo(name string, size int64, mode os.FileMode, mtime time.Time) objects.FileInfo {
+	nlink := uint64(1)
+	if mode.IsDir() {
+		nlink = 0
+	}
+	return objects.NewFileInfo(name, size, mode, mtime, nlink, atomic.AddUint64(&p.ino, 1), 0, 0, 0)
+}
+
+func (p *DAVImporter) scanCollection(collection *url.URL, results chan<- *importer.ScanResult) {
+	dirname := path.Join("/", path.Base(collection.Path))
+
+	responses, err := p.propfind(collection, "1")
+	if err != nil {
+		results <- importer.NewScanError(dirname, err)
+		return
+	}
+
+	results <- importer.NewScanRecord(dirname, "", p.newFileInfo(path.Base(dirname), 0, 0700|os.ModeDir, time.Now()), nil)
+
+	for href, prop := range responses {
+		if prop.ResourceType.is(NS_DAV, "collection") {
+			continue
+		}
+
+		pathname := path.Join(dirname, p.itemName(href))
+
+		mtime := time.Now()
+		if lastModified, err := http.ParseTime(prop.LastModified); err == nil {
+			mtime = lastModified
+		}
+		size, err := strconv.ParseInt(prop.ContentLength, 10, 64)
+		if err != nil {
+			size = 0
+		}
+
+		p.items.Store(pathname, href.String())
+		results <- importer.NewScanRecord(pathname, "", p.newFileInfo(path.Base(pathname), size, 0600, mtime), nil)
+	}
+}
+
+func (p *DAVImporter) Scan() (<-chan *importer.ScanResult, error) {
+	collections, err := p.collections()
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, fmt.Errorf("%s: no %s collection found", p.base.Path, p.kind.resource)
+	}
+
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+		results <- importer.NewScanRecord("/", "", p.newFileInfo("/", 0, 0700|os.ModeDir, time.Now()), nil)
+		for _, collection := range collections {
+			p.scanCollection(collection, results)
+		}
+	}()
+	return results, nil
+}
+
+func (p *DAVImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	location, ok := p.items.Load(pathname)
+	if !ok {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, location.(string), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", pathname, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (p *DAVImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on %s", p.kind.name)
+}
+
+func (p *DAVImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on %s", p.kind.name)
+}
+
+func (p *DAVImporter) Close() error {
+	return nil
+}
+
+func (p *DAVImporter) Root() string {
+	return "/"
+}
+
+func (p *DAVImporter) Origin() string {
+	return p.base.Host
+}
+
+func (p *DAVImporter) Type() string {
+	return p.kind.name
+}
@@ -0,0 +1,114 @@
+package dav
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testEvent = "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func davResponse(href, resourcetype string) string {
+	return fmt.Sprintf(`<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype>%s</d:resourcetype><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified><d:getcontentlength>%d</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`,
+		href, resourcetype, len(testEvent))
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	listings := map[string][]string{
+		"/calendars/alice/": {
+			davResponse("/calendars/alice/", "<d:collection/>"),
+			davResponse("/calendars/alice/personal/", "<d:collection/><c:calendar/>"),
+			davResponse("/calendars/alice/work%20stuff/", "<d:collection/><c:calendar/>"),
+			davResponse("/calendars/alice/inbox/", "<d:collection/><c:schedule-inbox/>"),
+		},
+		"/calendars/alice/personal/": {
+			davResponse("/calendars/alice/personal/", "<d:collection/><c:calendar/>"),
+			davResponse("/calendars/alice/personal/1.ics", ""),
+			davResponse("/calendars/alice/personal/2", ""),
+		},
+		"/calendars/alice/work stuff/": {
+			davResponse("/calendars/alice/work%20stuff/", "<d:collection/><c:calendar/>"),
+			davResponse("/calendars/alice/work%20stuff/3.ics", ""),
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "alice" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "PROPFIND":
+			responses, ok := listings[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">%s</d:multistatus>`,
+				strings.Join(responses, ""))
+		case http.MethodGet:
+			fmt.Fprint(w, testEvent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func scanPaths(t *testing.T, config map[string]string) ([]string, *DAVImporter) {
+	imp, err := NewCalDAVImporter(config)
+	require.NoError(t, err)
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	paths := []string{}
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		paths = append(paths, record.Record.Pathname)
+	}
+	sort.Strings(paths)
+	return paths, imp.(*DAVImporter)
+}
+
+func TestCalDAVImporter(t *testing.T) {
+	ts := newTestServer(t)
+	location := strings.Replace(ts.URL, "http://", "caldav://alice:secret@", 1) + "/calendars/alice"
+
+	paths, imp := scanPaths(t, map[string]string{"location": location})
+	require.Equal(t, []string{"/", "/personal", "/personal/1.ics", "/personal/2.ics", "/work stuff", "/work stuff/3.ics"}, paths)
+	require.Equal(t, "caldav", imp.Type())
+
+	rd, err := imp.NewReader("/personal/2.ics")
+	require.NoError(t, err)
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, testEvent, string(data))
+}
+
+func TestCalDAVImporterCollection(t *testing.T) {
+	ts := newTestServer(t)
+	location := strings.Replace(ts.URL, "http://", "caldav://", 1) + "/calendars/alice/personal/"
+
+	paths, _ := scanPaths(t, map[string]string{"location": location, "username": "alice", "password": "secret"})
+	require.Equal(t, []string{"/", "/personal", "/personal/1.ics", "/personal/2.ics"}, paths)
+}
+
+func TestDAVImporterScheme(t *testing.T) {
+	_, err := NewCardDAVImporter(map[string]string{"location": "caldav://example.org/"})
+	require.Error(t, err)
+
+	imp, err := NewCardDAVImporter(map[string]string{"location": "carddavs://example.org/contacts"})
+	require.NoError(t, err)
+	require.Equal(t, "https", imp.(*DAVImporter).base.Scheme)
+	require.Equal(t, "/contacts/", imp.(*DAVImporter).base.Path)
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package foreign
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+type borg struct {
+	command    *command
+	repository string
+}
+
+// borg reports times in local time without a zone, newer versions
+// include it.
+type borgTime time.Time
+
+func (t *borgTime) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		parsed, err = time.ParseInLocation("2006-01-02T15:04:05.999999", str, time.Local)
+		if err != nil {
+			return err
+		}
+	}
+	*t = borgTime(parsed)
+	return nil
+}
+
+type borgArchive struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Start    borgTime `json:"start"`
+	Hostname string   `json:"hostname"`
+}
+
+// borg archives have no tags, their name is all there is.
+func (a *borgArchive) snapshot() Snapshot {
+	return Snapshot{
+		ID:       a.Name,
+		Name:     a.Name,
+		Time:     time.Time(a.Start),
+		Hostname: a.Hostname,
+	}
+}
+
+type borgArchives struct {
+	Archives []borgArchive `json:"archives"`
+}
+
+// borgItem is an entry of borg list --json-lines, pathnames being
+// relative to the root.
+type borgItem struct {
+	Type       string   `json:"type"`
+	Mode       string   `json:"mode"`
+	User       string   `json:"user"`
+	Group      string   `json:"group"`
+	UID        uint64   `json:"uid"`
+	GID        uint64   `json:"gid"`
+	Path       string   `json:"path"`
+	LinkTarget string   `json:"linktarget"`
+	ModTime    borgTime `json:"mtime"`
+	Size       int64    `json:"size"`
+}
+
+// parseBorgMode parses a mode as formatted by ls, e.g. drwxr-sr-x.
+func parseBorgMode(str string) (fs.FileMode, error) {
+	if len(str) != 10 {
+		return 0, fmt.Errorf("invalid mode %q", str)
+	}
+
+	var mode fs.FileMode
+	switch str[0] {
+	case '-':
+	case 'd':
+		mode |= fs.ModeDir
+	case 'l':
+		mode |= fs.ModeSymlink
+	case 'c':
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case 'b':
+		mode |= fs.ModeDevice
+	case 'p':
+		mode |= fs.ModeNamedPipe
+	case 's':
+		mode |= fs.ModeSocket
+	default:
+		return 0, fmt.Errorf("invalid mode %q", str)
+	}
+
+	for i, c := range str[1:] {
+		bit := fs.FileMode(1) << (8 - i)
+		switch c {
+		case '-':
+		case 'r', 'w', 'x':
+			mode |= bit
+		case 's':
+			mode |= bit
+			fallthrough
+		case 'S':
+			if i < 3 {
+				mode |= fs.ModeSetuid
+			} else {
+				mode |= fs.ModeSetgid
+			}
+		case 't':
+			mode |= bit
+			fallthrough
+		case 'T':
+			mode |= fs.ModeSticky
+		default:
+			return 0, fmt.Errorf("invalid mode %q", str)
+		}
+	}
+	return mode, nil
+}
+
+func (b *borg) archive(name string) string {
+	return b.repository + "::" + name
+}
+
+func (b *borg) snapshots() ([]Snapshot, error) {
+	out, err := b.command.output("list", "--json", b.repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var listing borgArchives
+	if err := json.Unmarshal(out, &listing); err != nil {
+		return nil, fmt.Errorf("borg list: %w", err)
+	}
+
+	snapshots := make([]Snapshot, 0, len(listing.Archives))
+	for _, a := range listing.Archives {
+		snapshots = append(snapshots, a.snapshot())
+	}
+	return snapshots, nil
+}
+
+func (b *borg) snapshot(id string) (*Snapshot, error) {
+	out, err := b.command.output("info", "--json", b.archive(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var listing borgArchives
+	if err := json.Unmarshal(out, &listing); err != nil {
+		return nil, fmt.Errorf("borg info: %w", err)
+	}
+	if len(listing.Archives) != 1 {
+		return nil, fmt.Errorf("borg archive %s not found", id)
+	}
+
+	snapshot := listing.Archives[0].snapshot()
+	return &snapshot, nil
+}
+
+func (b *borg) entries(id string, fn func(*entry) error) error {
+	rd, err := b.command.stream("list", "--json-lines", b.archive(id))
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var item borgItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return fmt.Errorf("borg list: %w", err)
+		}
+
+		mode, err := parseBorgMode(item.Mode)
+		if err != nil {
+			return fmt.Errorf("borg list: %s: %w", item.Path, err)
+		}
+
+		nlink := uint16(1)
+		target := ""
+		switch {
+		case mode.IsDir():
+			item.Size = 0
+			nlink = 0
+		case mode&fs.ModeSymlink != 0:
+			target = item.LinkTarget
+		}
+
+		pathname := path.Clean("/" + item.Path)
+		fileinfo := objects.NewFileInfo(path.Base(pathname), item.Size, mode, time.Time(item.ModTime), 0, 0, item.UID, item.GID, nlink)
+		fileinfo.Lusername = item.User
+		fileinfo.Lgroupname = item.Group
+
+		if err := fn(&entry{pathname: pathname, target: target, fileinfo: fileinfo}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (b *borg) reader(id string, pathname string) (io.ReadCloser, error) {
+	return b.command.stream("extract", "--stdout", b.archive(id), strings.TrimPrefix(pathname, "/"))
+}
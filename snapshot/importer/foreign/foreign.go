@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package foreign imports the snapshots of other backup tools, restic and
+// borg, by driving their command line tools: the listing of a snapshot
+// provides the metadata and files are streamed one at a time, so nothing
+// needs to be restored to disk first.
+package foreign
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// Snapshot describes a snapshot of a foreign repository.
+type Snapshot struct {
+	ID       string
+	Name     string
+	Time     time.Time
+	Hostname string
+	Tags     []string
+}
+
+// entry is a file of a foreign snapshot, its pathname being absolute.
+type entry struct {
+	pathname string
+	target   string
+	fileinfo objects.FileInfo
+}
+
+// tool is what differs between backup tools: how to describe their
+// snapshots, list the entries of one and read a file.
+type tool interface {
+	snapshots() ([]Snapshot, error)
+	snapshot(id string) (*Snapshot, error)
+	entries(id string, fn func(*entry) error) error
+	reader(id string, pathname string) (io.ReadCloser, error)
+}
+
+func init() {
+	importer.Register("restic", NewForeignImporter)
+	importer.Register("borg", NewForeignImporter)
+}
+
+// newTool returns the tool handling the location of config, a scheme
+// followed by the repository as the tool expects it, e.g. restic:///srv/restic
+// or borg://ssh://host/./repo.
+func newTool(config map[string]string) (string, string, tool, error) {
+	location := config["location"]
+	name, repository, found := strings.Cut(location, "://")
+	if !found || repository == "" {
+		return "", "", nil, fmt.Errorf("invalid location %s", location)
+	}
+
+	binary := name
+	if value, ok := config["binary"]; ok {
+		binary = value
+	}
+	command := &command{binary: binary, env: os.Environ()}
+
+	switch name {
+	case "restic":
+		if value, ok := config["password"]; ok {
+			command.env = append(command.env, "RESTIC_PASSWORD="+value)
+		}
+		return name, repository, &restic{command: command, repository: repository}, nil
+	case "borg":
+		if value, ok := config["password"]; ok {
+			command.env = append(command.env, "BORG_PASSPHRASE="+value)
+		}
+		return name, repository, &borg{command: command, repository: repository}, nil
+	default:
+		return "", "", nil, fmt.Errorf("unsupported scheme %s", name)
+	}
+}
+
+// List returns the snapshots of the foreign repository at the location of
+// config, oldest first.
+func List(config map[string]string) ([]Snapshot, error) {
+	_, _, tool, err := newTool(config)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := tool.snapshots()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// ForeignImporter imports a snapshot of a foreign repository, the latest
+// one unless the snapshot setting names it.
+type ForeignImporter struct {
+	name       string
+	repository string
+	tool       tool
+	snapshot   *Snapshot
+}
+
+func NewForeignImporter(config map[string]string) (importer.Importer, error) {
+	name, repository, tool, err := newTool(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot *Snapshot
+	if id := config["snapshot"]; id != "" {
+		snapshot, err = tool.snapshot(id)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		snapshots, err := List(config)
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) == 0 {
+			return nil, fmt.Errorf("no snapshot in %s repository %s", name, repository)
+		}
+		snapshot = &snapshots[len(snapshots)-1]
+	}
+
+	return &ForeignImporter{
+		name:       name,
+		repository: repository,
+		tool:       tool,
+		snapshot:   snapshot,
+	}, nil
+}
+
+func (p *ForeignImporter) Scan() (<-chan *importer.ScanResult, error) {
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+
+		// listings omit the parents of the paths that were backed up,
+		// e.g. /home when /home/user was, they are made up from the
+		// directory itself.
+		seen := make(map[string]struct{})
+		var emit func(pathname string, dir objects.FileInfo)
+		emit = func(pathname string, dir objects.FileInfo) {
+			if _, ok := seen[pathname]; ok {
+				return
+			}
+			if pathname != "/" {
+				emit(path.Dir(pathname), dir)
+			}
+			seen[pathname] = struct{}{}
+			results <- importer.NewScanRecord(pathname, "",
+				objects.NewFileInfo(path.Base(pathname), 0, 0755|os.ModeDir, dir.ModTime(), 0, 0, dir.Uid(), dir.Gid(), 0), nil)
+		}
+
+		err := p.tool.entries(p.snapshot.ID, func(e *entry) error {
+			if _, ok := seen[e.pathname]; ok {
+				return nil
+			}
+			if e.pathname != "/" {
+				emit(path.Dir(e.pathname), e.fileinfo)
+			}
+			seen[e.pathname] = struct{}{}
+			results <- importer.NewScanRecord(e.pathname, e.target, e.fileinfo, nil)
+			return nil
+		})
+		if err != nil {
+			results <- importer.NewScanError("/", err)
+		}
+	}()
+	return results, nil
+}
+
+func (p *ForeignImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	return p.tool.reader(p.snapshot.ID, pathname)
+}
+
+func (p *ForeignImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on %s", p.name)
+}
+
+func (p *ForeignImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on %s", p.name)
+}
+
+// Timestamp dates the snapshot after the foreign one.
+func (p *ForeignImporter) Timestamp() (time.Time, error) {
+	return p.snapshot.Time, nil
+}
+
+// Tags carries over the tags of the foreign snapshot, along with its
+// identifier so that converting it again can be avoided.
+func (p *ForeignImporter) Tags() ([]string, error) {
+	tags := append([]string{}, p.snapshot.Tags...)
+	tags = append(tags, p.name+".id="+p.snapshot.ID)
+	if p.snapshot.Hostname != "" {
+		tags = append(tags, p.name+".hostname="+p.snapshot.Hostname)
+	}
+	return tags, nil
+}
+
+func (p *ForeignImporter) Close() error {
+	return nil
+}
+
+func (p *ForeignImporter) Root() string {
+	return "/"
+}
+
+func (p *ForeignImporter) Origin() string {
+	return p.repository
+}
+
+func (p *ForeignImporter) Type() string {
+	return p.name
+}
+
+// command runs a backup tool with the environment it needs.
+type command struct {
+	binary string
+	env    []string
+}
+
+func (c *command) error(args []string, err error, stderr []byte) error {
+	if msg := strings.TrimSpace(string(stderr)); msg != "" {
+		return fmt.Errorf("%s %s: %s", c.binary, args[0], msg)
+	}
+	return fmt.Errorf("%s %s: %w", c.binary, args[0], err)
+}
+
+func (c *command) output(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.binary, args...)
+	cmd.Env = c.env
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, c.error(args, err, stderr.Bytes())
+	}
+	return out, nil
+}
+
+// stream returns the output of the command, its failure being reported
+// when the output is exhausted rather than passing for a truncated file.
+func (c *command) stream(args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command(c.binary, args...)
+	cmd.Env = c.env
+	rd := &commandReader{command: c, args: args, cmd: cmd}
+	cmd.Stderr = &rd.stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, c.error(args, err, nil)
+	}
+	rd.stdout = stdout
+	return rd, nil
+}
+
+type commandReader struct {
+	command *command
+	args    []string
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stderr  bytes.Buffer
+	done    bool
+}
+
+func (rd *commandReader) wait() error {
+	rd.done = true
+	if err := rd.cmd.Wait(); err != nil {
+		return rd.command.error(rd.args, err, rd.stderr.Bytes())
+	}
+	return nil
+}
+
+func (rd *commandReader) Read(p []byte) (int, error) {
+	n, err := rd.stdout.Read(p)
+	if err == io.EOF && !rd.done {
+		if err := rd.wait(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (rd *commandReader) Close() error {
+	if rd.done {
+		return nil
+	}
+	rd.cmd.Process.Kill()
+	rd.done = true
+	rd.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,141 @@
+package foreign
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTool writes a script standing for a backup tool, answering each
+// subcommand with a canned output.
+func fakeTool(t *testing.T, script string) string {
+	binary := filepath.Join(t.TempDir(), "tool")
+	err := os.WriteFile(binary, []byte("#!/bin/sh\n"+script), 0700)
+	require.NoError(t, err)
+	return binary
+}
+
+func scan(t *testing.T, imp importer.Importer) map[string]*importer.ScanRecord {
+	results, err := imp.Scan()
+	require.NoError(t, err)
+
+	records := make(map[string]*importer.ScanRecord)
+	for result := range results {
+		require.Nil(t, result.Error)
+		require.NotContains(t, records, result.Record.Pathname)
+		records[result.Record.Pathname] = result.Record
+	}
+	return records
+}
+
+func TestResticImporter(t *testing.T) {
+	binary := fakeTool(t, `
+case "$1" in
+snapshots)
+	echo '[{"id":"aaaa","time":"2024-01-01T10:00:00Z","hostname":"old","paths":["/home"]},
+	       {"id":"bbbb","time":"2024-02-01T10:00:00Z","hostname":"host","paths":["/home/user"],"tags":["daily"]}]'
+	;;
+ls)
+	echo '{"time":"2024-02-01T10:00:00Z","id":"bbbb","struct_type":"snapshot"}'
+	echo '{"name":"user","type":"dir","path":"/home/user","uid":1000,"gid":1000,"mode":2147484141,"mtime":"2024-01-31T10:00:00Z","struct_type":"node"}'
+	echo '{"name":"notes.txt","type":"file","path":"/home/user/notes.txt","uid":1000,"gid":1000,"size":6,"mode":420,"mtime":"2024-01-30T10:00:00Z","struct_type":"node"}'
+	;;
+dump)
+	[ "$5" = "/home/user/notes.txt" ] || { echo "no such file" >&2; exit 1; }
+	printf 'hello\n'
+	;;
+esac
+`)
+
+	imp, err := importer.NewImporter(map[string]string{"location": "restic:///srv/restic", "binary": binary})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	require.Equal(t, "restic", imp.Type())
+	require.Equal(t, "/srv/restic", imp.Origin())
+
+	timestamp, err := imp.(importer.Timestamper).Timestamp()
+	require.NoError(t, err)
+	require.True(t, timestamp.Equal(time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)))
+
+	tags, err := imp.(importer.Tagger).Tags()
+	require.NoError(t, err)
+	require.Equal(t, []string{"daily", "restic.id=bbbb", "restic.hostname=host"}, tags)
+
+	records := scan(t, imp)
+	require.Len(t, records, 4)
+	require.True(t, records["/"].FileInfo.IsDir())
+	require.True(t, records["/home"].FileInfo.IsDir())
+	require.True(t, records["/home/user"].FileInfo.IsDir())
+	require.Equal(t, int64(6), records["/home/user/notes.txt"].FileInfo.Size())
+	require.Equal(t, fs.FileMode(0644), records["/home/user/notes.txt"].FileInfo.Mode())
+
+	rd, err := imp.NewReader("/home/user/notes.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	require.Equal(t, "hello\n", string(data))
+
+	rd, err = imp.NewReader("/home/user/missing")
+	require.NoError(t, err)
+	_, err = io.ReadAll(rd)
+	require.ErrorContains(t, err, "no such file")
+	rd.Close()
+}
+
+func TestBorgImporter(t *testing.T) {
+	binary := fakeTool(t, `
+case "$1" in
+info)
+	[ "$3" = "/srv/borg::monday" ] || exit 2
+	echo '{"archives":[{"id":"cccc","name":"monday","start":"2024-03-04T10:00:00.000000","hostname":"host"}]}'
+	;;
+list)
+	echo '{"type":"d","mode":"drwxr-x---","user":"u","group":"g","uid":1000,"gid":1000,"path":"home/user","mtime":"2024-03-03T10:00:00.000000","size":0}'
+	echo '{"type":"l","mode":"lrwxrwxrwx","user":"u","group":"g","uid":1000,"gid":1000,"path":"home/user/link","linktarget":"notes.txt","mtime":"2024-03-03T10:00:00.000000","size":0}'
+	;;
+esac
+`)
+
+	imp, err := importer.NewImporter(map[string]string{"location": "borg:///srv/borg", "binary": binary, "snapshot": "monday"})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	timestamp, err := imp.(importer.Timestamper).Timestamp()
+	require.NoError(t, err)
+	require.True(t, timestamp.Equal(time.Date(2024, 3, 4, 10, 0, 0, 0, time.Local)))
+
+	records := scan(t, imp)
+	require.Len(t, records, 4)
+	require.Equal(t, fs.ModeDir|0750, records["/home/user"].FileInfo.Mode())
+	require.Equal(t, "u", records["/home/user"].FileInfo.Username())
+	require.Equal(t, "notes.txt", records["/home/user/link"].Target)
+
+	_, err = importer.NewImporter(map[string]string{"location": "borg:///srv/borg", "binary": binary, "snapshot": "tuesday"})
+	require.Error(t, err)
+}
+
+func TestParseBorgMode(t *testing.T) {
+	for str, expected := range map[string]fs.FileMode{
+		"-rw-r--r--": 0644,
+		"drwxrwxrwt": fs.ModeDir | fs.ModeSticky | 0777,
+		"-rwsr-Sr-x": fs.ModeSetuid | fs.ModeSetgid | 0745,
+		"crw-rw----": fs.ModeDevice | fs.ModeCharDevice | 0660,
+	} {
+		mode, err := parseBorgMode(str)
+		require.NoError(t, err)
+		require.Equal(t, expected, mode, str)
+	}
+
+	for _, str := range []string{"", "rw-r--r--", "?rw-r--r--", "-rw-r--r-z"} {
+		_, err := parseBorgMode(str)
+		require.Error(t, err, str)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package foreign
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+type restic struct {
+	command    *command
+	repository string
+}
+
+type resticSnapshot struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Paths    []string  `json:"paths"`
+	Tags     []string  `json:"tags"`
+}
+
+func (s *resticSnapshot) snapshot() Snapshot {
+	return Snapshot{
+		ID:       s.ID,
+		Name:     strings.Join(s.Paths, ", "),
+		Time:     s.Time,
+		Hostname: s.Hostname,
+		Tags:     s.Tags,
+	}
+}
+
+// resticNode is an entry of restic ls --json, the first line of which
+// describes the snapshot.  The target of symlinks is not part of it.
+type resticNode struct {
+	Type        string      `json:"type"`
+	MessageType string      `json:"message_type"`
+	StructType  string      `json:"struct_type"`
+	Name        string      `json:"name"`
+	Path        string      `json:"path"`
+	UID         uint64      `json:"uid"`
+	GID         uint64      `json:"gid"`
+	Size        int64       `json:"size"`
+	Mode        fs.FileMode `json:"mode"`
+	ModTime     time.Time   `json:"mtime"`
+	ChangeTime  time.Time   `json:"ctime"`
+	Inode       uint64      `json:"inode"`
+	LinkTarget  string      `json:"linktarget"`
+}
+
+func (r *restic) snapshots() ([]Snapshot, error) {
+	out, err := r.command.output("snapshots", "--json", "--repo", r.repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var listing []resticSnapshot
+	if err := json.Unmarshal(out, &listing); err != nil {
+		return nil, fmt.Errorf("restic snapshots: %w", err)
+	}
+
+	snapshots := make([]Snapshot, 0, len(listing))
+	for _, s := range listing {
+		snapshots = append(snapshots, s.snapshot())
+	}
+	return snapshots, nil
+}
+
+func (r *restic) snapshot(id string) (*Snapshot, error) {
+	out, err := r.command.output("snapshots", "--json", "--repo", r.repository, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var listing []resticSnapshot
+	if err := json.Unmarshal(out, &listing); err != nil {
+		return nil, fmt.Errorf("restic snapshots: %w", err)
+	}
+	if len(listing) != 1 {
+		return nil, fmt.Errorf("restic snapshot %s not found", id)
+	}
+
+	snapshot := listing[0].snapshot()
+	return &snapshot, nil
+}
+
+func (r *restic) entries(id string, fn func(*entry) error) error {
+	rd, err := r.command.stream("ls", "--json", "--repo", r.repository, id)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var node resticNode
+		if err := json.Unmarshal(scanner.Bytes(), &node); err != nil {
+			return fmt.Errorf("restic ls: %w", err)
+		}
+		if node.MessageType != "node" && node.StructType != "node" {
+			continue
+		}
+
+		nlink := uint16(1)
+		if node.Type == "dir" {
+			node.Size = 0
+			nlink = 0
+		}
+		fileinfo := objects.NewFileInfo(node.Name, node.Size, node.Mode, node.ModTime, 0, node.Inode, node.UID, node.GID, nlink)
+		fileinfo.LchangeTime = node.ChangeTime
+
+		err := fn(&entry{
+			pathname: path.Clean("/" + node.Path),
+			target:   node.LinkTarget,
+			fileinfo: fileinfo,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (r *restic) reader(id string, pathname string) (io.ReadCloser, error) {
+	return r.command.stream("dump", "--repo", r.repository, id, pathname)
+}
@@ -18,6 +18,7 @@ package fs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,13 +26,31 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/PlakarKorp/plakar/snapshot/importer"
 	"github.com/pkg/xattr"
 )
 
+// Symbolic link policies, as in find(1) -P, -H and -L: links are either
+// never followed, followed only when given as the root of the backup, or
+// always followed.
+const (
+	FOLLOW_NEVER     = "never"
+	FOLLOW_COMMANDED = "commanded"
+	FOLLOW_ALWAYS    = "always"
+)
+
+var ErrSymlinkCycle = errors.New("symbolic link cycle")
+
 type FSImporter struct {
-	rootDir string
+	rootDir        string
+	followSymlinks string
+
+	sqlite       string
+	sqliteDir    string
+	sqliteCopies map[string]*sqliteCopy
+	muSqlite     sync.Mutex
 }
 
 func init() {
@@ -51,8 +70,31 @@ func NewFSImporter(config map[string]string) (importer.Importer, error) {
 
 	location = path.Clean(location)
 
+	followSymlinks := FOLLOW_COMMANDED
+	if value, ok := config["follow_symlinks"]; ok {
+		switch value {
+		case FOLLOW_NEVER, FOLLOW_COMMANDED, FOLLOW_ALWAYS:
+			followSymlinks = value
+		default:
+			return nil, fmt.Errorf("invalid follow_symlinks value: %s", value)
+		}
+	}
+
+	sqlite := SQLITE_RAW
+	if value, ok := config["sqlite"]; ok {
+		switch value {
+		case SQLITE_RAW, SQLITE_CHECK, SQLITE_BACKUP:
+			sqlite = value
+		default:
+			return nil, fmt.Errorf("invalid sqlite value: %s", value)
+		}
+	}
+
 	return &FSImporter{
-		rootDir: location,
+		rootDir:        location,
+		followSymlinks: followSymlinks,
+		sqlite:         sqlite,
+		sqliteCopies:   make(map[string]*sqliteCopy),
 	}, nil
 }
 
@@ -69,10 +111,17 @@ func (p *FSImporter) Type() string {
 }
 
 func (p *FSImporter) Scan() (<-chan *importer.ScanResult, error) {
-	return walkDir_walker(p.rootDir, 256)
+	results, err := walkDir_walker(p.rootDir, p.followSymlinks, 256)
+	if err != nil || p.sqlite == SQLITE_RAW {
+		return results, err
+	}
+	return p.sqliteFilter(results), nil
 }
 
 func (p *FSImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if rd, err := p.sqliteReader(pathname); rd != nil || err != nil {
+		return rd, err
+	}
 	if pathname[0] == '/' && runtime.GOOS == "windows" {
 		pathname = pathname[1:]
 	}
@@ -100,7 +149,10 @@ func (p *FSImporter) GetExtendedAttributes(pathname string) ([]importer.Extended
 }
 
 func (p *FSImporter) Close() error {
-	return nil
+	if p.sqliteDir == "" {
+		return nil
+	}
+	return os.RemoveAll(p.sqliteDir)
 }
 
 func (p *FSImporter) Root() string {
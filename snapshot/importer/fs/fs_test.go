@@ -1,10 +1,14 @@
 package fs
 
 import (
+	"database/sql"
+	"errors"
+	"io"
 	"os"
 	"sort"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/snapshot/importer"
 	"github.com/stretchr/testify/require"
 )
 
@@ -68,3 +72,165 @@ func TestFSImporter(t *testing.T) {
 	err = importer.Close()
 	require.NoError(t, err)
 }
+
+func TestFSImporterVolumeID(t *testing.T) {
+	tmpImportDir, err := os.MkdirTemp("/tmp", "tmp_import*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpImportDir)
+	})
+
+	imp, err := NewFSImporter(map[string]string{"location": tmpImportDir})
+	require.NoError(t, err)
+
+	vi, ok := imp.(importer.VolumeIdentifier)
+	require.True(t, ok)
+
+	volume, err := vi.VolumeID()
+	require.NoError(t, err)
+
+	again, err := vi.VolumeID()
+	require.NoError(t, err)
+	require.Equal(t, volume, again)
+}
+
+func scanPaths(t *testing.T, location string, followSymlinks string) ([]string, []string) {
+	imp, err := NewFSImporter(map[string]string{"location": location, "follow_symlinks": followSymlinks})
+	require.NoError(t, err)
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	paths := []string{}
+	errors := []string{}
+	for record := range scanChan {
+		if record.Error != nil {
+			errors = append(errors, record.Error.Pathname)
+			continue
+		}
+		if record.Record.IsXattr {
+			continue
+		}
+		paths = append(paths, record.Record.Pathname)
+	}
+	sort.Strings(paths)
+	return paths, errors
+}
+
+func TestFSImporterFollowSymlinks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("/tmp", "tmp_import*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	require.NoError(t, os.Mkdir(tmpDir+"/data", 0755))
+	require.NoError(t, os.WriteFile(tmpDir+"/data/dummy.txt", []byte("test importer fs"), 0644))
+	require.NoError(t, os.Symlink("..", tmpDir+"/data/parent"))
+	require.NoError(t, os.Symlink(tmpDir+"/data", tmpDir+"/root"))
+
+	_, err = NewFSImporter(map[string]string{"location": tmpDir, "follow_symlinks": "sometimes"})
+	require.Error(t, err)
+
+	paths, errors := scanPaths(t, tmpDir+"/root", FOLLOW_NEVER)
+	require.Empty(t, errors)
+	require.Equal(t, []string{"/", "/tmp", tmpDir, tmpDir + "/root"}, paths)
+
+	paths, errors = scanPaths(t, tmpDir+"/root", FOLLOW_COMMANDED)
+	require.Empty(t, errors)
+	require.Equal(t, []string{"/", "/tmp", tmpDir, tmpDir + "/root", tmpDir + "/root/dummy.txt", tmpDir + "/root/parent"}, paths)
+
+	paths, errors = scanPaths(t, tmpDir, FOLLOW_ALWAYS)
+	require.Equal(t, []string{tmpDir + "/data/parent", tmpDir + "/root/parent"}, errors)
+	require.Equal(t, []string{"/", "/tmp", tmpDir,
+		tmpDir + "/data", tmpDir + "/data/dummy.txt", tmpDir + "/data/parent",
+		tmpDir + "/root", tmpDir + "/root/dummy.txt", tmpDir + "/root/parent"}, paths)
+}
+
+// hotDatabase creates a database in WAL mode whose changes are kept in
+// the write-ahead log by the returned connection.
+func hotDatabase(t *testing.T, pathname string) *sql.DB {
+	db, err := sql.Open("sqlite", pathname)
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	for _, query := range []string{
+		"PRAGMA journal_mode=WAL",
+		"PRAGMA wal_autocheckpoint=0",
+		"CREATE TABLE items (name TEXT)",
+		"INSERT INTO items VALUES ('a'), ('b'), ('c')",
+	} {
+		_, err := db.Exec(query)
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func TestFSImporterSQLite(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("/tmp", "tmp_import*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+	hotDatabase(t, tmpDir+"/app.db")
+	require.NoError(t, os.WriteFile(tmpDir+"/dummy.txt", []byte("test importer fs"), 0644))
+
+	_, err = NewFSImporter(map[string]string{"location": tmpDir, "sqlite": "dump"})
+	require.Error(t, err)
+
+	// databases in use are reported, but stored as is
+	imp, err := NewFSImporter(map[string]string{"location": tmpDir, "sqlite": SQLITE_CHECK})
+	require.NoError(t, err)
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+	paths := []string{}
+	for record := range scanChan {
+		if record.Error != nil {
+			require.Equal(t, tmpDir+"/app.db", record.Error.Pathname)
+			require.True(t, errors.Is(record.Error.Err, ErrSQLiteHot))
+			continue
+		}
+		paths = append(paths, record.Record.Pathname)
+	}
+	require.Contains(t, paths, tmpDir+"/app.db-wal")
+	require.NoError(t, imp.Close())
+
+	// databases are replaced by consistent copies, without their sidecars
+	imp, err = NewFSImporter(map[string]string{"location": tmpDir, "sqlite": SQLITE_BACKUP})
+	require.NoError(t, err)
+	scanChan, err = imp.Scan()
+	require.NoError(t, err)
+	paths = []string{}
+	var size int64
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		if record.Record.IsXattr {
+			continue
+		}
+		paths = append(paths, record.Record.Pathname)
+		if record.Record.Pathname == tmpDir+"/app.db" {
+			size = record.Record.FileInfo.Size()
+		}
+	}
+	sort.Strings(paths)
+	require.Equal(t, []string{"/", "/tmp", tmpDir, tmpDir + "/app.db", tmpDir + "/dummy.txt"}, paths)
+
+	rd, err := imp.NewReader(tmpDir + "/app.db")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rd)
+	rd.Close()
+	require.NoError(t, err)
+	require.Equal(t, size, int64(len(data)))
+
+	restored := t.TempDir() + "/app.db"
+	require.NoError(t, os.WriteFile(restored, data, 0600))
+	db, err := sql.Open("sqlite", restored)
+	require.NoError(t, err)
+	defer db.Close()
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM items").Scan(&count))
+	require.Equal(t, 3, count)
+
+	require.NoError(t, imp.Close())
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package fs
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite policies: databases are either stored as any other file, stored
+// as is but reported if they were in use, or replaced by a consistent copy.
+const (
+	SQLITE_RAW    = "raw"
+	SQLITE_CHECK  = "check"
+	SQLITE_BACKUP = "backup"
+)
+
+// SQLITE_WORKERS is the number of files inspected at once.
+const SQLITE_WORKERS = 16
+
+var ErrSQLiteHot = errors.New("sqlite database captured while in use")
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+var sqliteJournalMagic = []byte{0xd9, 0xd5, 0x05, 0xf9, 0x20, 0xa1, 0x63, 0xd7}
+
+// sqliteSidecars are the suffixes of the files SQLite keeps next to a
+// database, a consistent copy includes whatever they hold.
+var sqliteSidecars = []string{"-wal", "-shm", "-journal"}
+
+// sqliteCopy is a consistent copy of a database, made once however many
+// records refer to it.
+type sqliteCopy struct {
+	once    sync.Once
+	path    string
+	size    int64
+	modTime time.Time
+	err     error
+}
+
+func isSQLite(pathname string) bool {
+	fp, err := os.Open(pathname)
+	if err != nil {
+		return false
+	}
+	defer fp.Close()
+
+	magic := make([]byte, len(sqliteMagic))
+	if _, err := io.ReadFull(fp, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, sqliteMagic)
+}
+
+// sqliteHot returns why the database at pathname may not be consistent
+// on its own, or an empty string if nothing suggests it is in use.
+func sqliteHot(pathname string) string {
+	if fp, err := os.Open(pathname + "-journal"); err == nil {
+		magic := make([]byte, len(sqliteJournalMagic))
+		_, err := io.ReadFull(fp, magic)
+		fp.Close()
+		if err == nil && bytes.Equal(magic, sqliteJournalMagic) {
+			return "a rollback journal is pending"
+		}
+	}
+	// past its header, the log holds pages the database may lack
+	if info, err := os.Stat(pathname + "-wal"); err == nil && info.Size() > 32 {
+		return "the write-ahead log holds changes"
+	}
+	return ""
+}
+
+func (p *FSImporter) sqliteSpool() (string, error) {
+	p.muSqlite.Lock()
+	defer p.muSqlite.Unlock()
+
+	if p.sqliteDir == "" {
+		dir, err := os.MkdirTemp("", "plakar-sqlite-*")
+		if err != nil {
+			return "", err
+		}
+		p.sqliteDir = dir
+	}
+	return p.sqliteDir, nil
+}
+
+// sqliteBackup writes a consistent copy of the database at pathname to
+// dest, the way the backup API would: within a read transaction.
+func sqliteBackup(pathname string, dest string) error {
+	pathname = filepath.ToSlash(pathname)
+	if !strings.HasPrefix(pathname, "/") {
+		pathname = "/" + pathname
+	}
+	dsn := url.URL{Scheme: "file", Path: pathname, RawQuery: "mode=ro"}
+
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA busy_timeout = 10000"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("VACUUM INTO ?", dest); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+func (p *FSImporter) sqliteCopyOf(pathname string) *sqliteCopy {
+	p.muSqlite.Lock()
+	c, ok := p.sqliteCopies[pathname]
+	if !ok {
+		c = &sqliteCopy{}
+		p.sqliteCopies[pathname] = c
+	}
+	p.muSqlite.Unlock()
+
+	c.once.Do(func() {
+		dir, err := p.sqliteSpool()
+		if err != nil {
+			c.err = err
+			return
+		}
+		dest, err := os.CreateTemp(dir, "*.db")
+		if err != nil {
+			c.err = err
+			return
+		}
+		dest.Close()
+		os.Remove(dest.Name())
+
+		if c.err = sqliteBackup(pathname, dest.Name()); c.err != nil {
+			return
+		}
+		info, err := os.Stat(dest.Name())
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.path, c.size = dest.Name(), info.Size()
+
+		// changes may only have reached the write-ahead log, which the
+		// cache of the previous backup knows nothing about
+		if info, err := os.Stat(pathname); err == nil {
+			c.modTime = info.ModTime()
+		}
+		if info, err := os.Stat(pathname + "-wal"); err == nil && info.ModTime().After(c.modTime) {
+			c.modTime = info.ModTime()
+		}
+	})
+	return c
+}
+
+// sqliteReader returns a reader on the copy made of the database at
+// pathname, or nil if the database was stored as is.
+func (p *FSImporter) sqliteReader(pathname string) (io.ReadCloser, error) {
+	p.muSqlite.Lock()
+	c, ok := p.sqliteCopies[pathname]
+	p.muSqlite.Unlock()
+	if !ok || c.path == "" {
+		return nil, nil
+	}
+	return os.Open(c.path)
+}
+
+func (p *FSImporter) sqliteInspect(result *importer.ScanResult, results chan<- *importer.ScanResult) {
+	record := result.Record
+	if record == nil || record.IsXattr || !record.FileInfo.Mode().IsRegular() {
+		results <- result
+		return
+	}
+
+	if p.sqlite == SQLITE_BACKUP {
+		for _, suffix := range sqliteSidecars {
+			if db, found := strings.CutSuffix(record.Pathname, suffix); found && isSQLite(db) {
+				if p.sqliteCopyOf(db).path != "" {
+					return
+				}
+			}
+		}
+	}
+
+	if !isSQLite(record.Pathname) {
+		results <- result
+		return
+	}
+
+	var copyErr error
+	if p.sqlite == SQLITE_BACKUP {
+		c := p.sqliteCopyOf(record.Pathname)
+		if c.err == nil {
+			record.FileInfo.Lsize = c.size
+			record.FileInfo.LmodTime = c.modTime
+			results <- result
+			return
+		}
+		copyErr = c.err
+	}
+
+	results <- result
+	if reason := sqliteHot(record.Pathname); reason != "" {
+		if copyErr != nil {
+			results <- importer.NewScanError(record.Pathname, fmt.Errorf("%w: %s, consistent copy failed: %v", ErrSQLiteHot, reason, copyErr))
+		} else {
+			results <- importer.NewScanError(record.Pathname, fmt.Errorf("%w: %s", ErrSQLiteHot, reason))
+		}
+	}
+}
+
+// sqliteFilter inspects the regular files of a scan, reporting databases
+// that were in use or replacing them with consistent copies.
+func (p *FSImporter) sqliteFilter(input <-chan *importer.ScanResult) <-chan *importer.ScanResult {
+	results := make(chan *importer.ScanResult, 1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < SQLITE_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range input {
+				p.sqliteInspect(result, results)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
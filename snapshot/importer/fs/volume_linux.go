@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// VolumeID returns the UUID of the filesystem holding the root directory if
+// it can be found in /dev/disk/by-uuid, its filesystem ID otherwise.
+func (p *FSImporter) VolumeID() (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(p.rootDir, &st); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir("/dev/disk/by-uuid")
+	if err == nil {
+		for _, entry := range entries {
+			var dev syscall.Stat_t
+			if err := syscall.Stat(filepath.Join("/dev/disk/by-uuid", entry.Name()), &dev); err != nil {
+				continue
+			}
+			if dev.Mode&syscall.S_IFMT == syscall.S_IFBLK && dev.Rdev == st.Dev {
+				return "uuid:" + entry.Name(), nil
+			}
+		}
+	}
+
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(p.rootDir, &sfs); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("fsid:%08x%08x", uint32(sfs.Fsid.Val[0]), uint32(sfs.Fsid.Val[1])), nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+
+package fs
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// VolumeID returns the device number of the root directory.
+func (p *FSImporter) VolumeID() (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(p.rootDir, &st); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("dev:%x", uint64(st.Dev)), nil
+}
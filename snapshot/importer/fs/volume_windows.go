@@ -0,0 +1,6 @@
+package fs
+
+// VolumeID is not supported yet, the cache is only invalidated per file.
+func (p *FSImporter) VolumeID() (string, error) {
+	return "", nil
+}
@@ -40,12 +40,25 @@ type namecache struct {
 	mu sync.RWMutex
 }
 
+// walkJob is a path to be scanned, follow is set when it is a symbolic
+// link to be recorded as what it points to.
+type walkJob struct {
+	path   string
+	follow bool
+}
+
 // Worker pool to handle file scanning in parallel
-func walkDir_worker(jobs <-chan string, results chan<- *importer.ScanResult, wg *sync.WaitGroup, namecache *namecache) {
+func walkDir_worker(jobs <-chan walkJob, results chan<- *importer.ScanResult, wg *sync.WaitGroup, namecache *namecache) {
 	defer wg.Done()
 
-	for path := range jobs {
-		info, err := os.Lstat(path)
+	for job := range jobs {
+		path := job.path
+
+		stat := os.Lstat
+		if job.follow {
+			stat = os.Stat
+		}
+		info, err := stat(path)
 		if err != nil {
 			results <- importer.NewScanError(path, err)
 			continue
@@ -104,7 +117,7 @@ func walkDir_worker(jobs <-chan string, results chan<- *importer.ScanResult, wg
 	}
 }
 
-func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results chan<- *importer.ScanResult) {
+func walkDir_addPrefixDirectories(rootDir string, jobs chan<- walkJob, results chan<- *importer.ScanResult) {
 	atoms := strings.Split(rootDir, string(os.PathSeparator))
 
 	for i := 0; i < len(atoms)-1; i++ {
@@ -119,13 +132,80 @@ func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results ch
 			continue
 		}
 
-		jobs <- path
+		jobs <- walkJob{path: path, follow: true}
 	}
 }
 
-func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult, error) {
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// symlinkWalker walks a tree, following symbolic links to directories as
+// its policy requires.  When links are always followed, the directories
+// being walked are remembered so that a link to one of them is recorded
+// as a link rather than followed forever.
+type symlinkWalker struct {
+	policy    string
+	ancestors map[fileID]struct{}
+	jobs      chan<- walkJob
+	results   chan<- *importer.ScanResult
+}
+
+func (w *symlinkWalker) walk(path string, typ fs.FileMode, follow bool) {
+	followed := false
+	if typ&fs.ModeSymlink != 0 && follow {
+		info, err := os.Stat(path)
+		if err != nil {
+			// dangling link, record it as is
+			w.jobs <- walkJob{path: path}
+			return
+		}
+		if info.IsDir() && w.ancestors != nil {
+			if _, exists := w.ancestors[w.fileID(info)]; exists {
+				w.results <- importer.NewScanError(path, ErrSymlinkCycle)
+				w.jobs <- walkJob{path: path}
+				return
+			}
+		}
+		typ = info.Mode().Type()
+		followed = true
+	}
+
+	w.jobs <- walkJob{path: path, follow: followed}
+	if !typ.IsDir() {
+		return
+	}
+
+	if w.ancestors != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			w.results <- importer.NewScanError(path, err)
+			return
+		}
+		id := w.fileID(info)
+		w.ancestors[id] = struct{}{}
+		defer delete(w.ancestors, id)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		w.results <- importer.NewScanError(path, err)
+		return
+	}
+	for _, entry := range entries {
+		w.walk(filepath.Join(path, entry.Name()), entry.Type(), w.policy == FOLLOW_ALWAYS)
+	}
+}
+
+func (w *symlinkWalker) fileID(info fs.FileInfo) fileID {
+	fileinfo := objects.FileInfoFromStat(info)
+	return fileID{dev: fileinfo.Dev(), ino: fileinfo.Ino()}
+}
+
+func walkDir_walker(rootDir string, followSymlinks string, numWorkers int) (<-chan *importer.ScanResult, error) {
 	results := make(chan *importer.ScanResult, 1000) // Larger buffer for results
-	jobs := make(chan string, 1000)                  // Buffered channel to feed paths to workers
+	jobs := make(chan walkJob, 1000)                 // Buffered channel to feed paths to workers
 	namecache := &namecache{
 		uidToName: make(map[uint64]string),
 		gidToName: make(map[uint64]string),
@@ -148,34 +228,19 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult
 			results <- importer.NewScanError(rootDir, err)
 			return
 		}
-		if info.Mode()&os.ModeSymlink != 0 {
-			originFile, err := os.Readlink(rootDir)
-			if err != nil {
-				results <- importer.NewScanError(rootDir, err)
-				return
-			}
-
-			if !filepath.IsAbs(originFile) {
-				originFile = filepath.Join(filepath.Dir(rootDir), originFile)
-			}
-			jobs <- rootDir
-			rootDir = originFile
-		}
 
 		// Add prefix directories first
 		walkDir_addPrefixDirectories(rootDir, jobs, results)
 
-		err = filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				results <- importer.NewScanError(path, err)
-				return nil
-			}
-			jobs <- path
-			return nil
-		})
-		if err != nil {
-			results <- importer.NewScanError(rootDir, err)
+		walker := &symlinkWalker{
+			policy:  followSymlinks,
+			jobs:    jobs,
+			results: results,
+		}
+		if followSymlinks == FOLLOW_ALWAYS {
+			walker.ancestors = make(map[fileID]struct{})
 		}
+		walker.walk(rootDir, info.Mode().Type(), followSymlinks != FOLLOW_NEVER)
 	}()
 
 	// Close the results channel when all workers are done
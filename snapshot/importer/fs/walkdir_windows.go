@@ -44,10 +44,11 @@ func toUnixPath(pathname string) string {
 }
 
 // Worker pool to handle file scanning in parallel
-func walkDir_worker(jobs <-chan string, results chan<- *importer.ScanResult, wg *sync.WaitGroup) {
+func walkDir_worker(jobs <-chan walkJob, results chan<- *importer.ScanResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	for pathname := range jobs {
+	for job := range jobs {
+		pathname := job.path
 		unixPath := toUnixPath(pathname)
 
 		var fileinfo objects.FileInfo
@@ -56,7 +57,11 @@ func walkDir_worker(jobs <-chan string, results chan<- *importer.ScanResult, wg
 		if pathname == "/" {
 			fileinfo = objects.NewFileInfo("/", 0, os.ModeDir, time.Now(), 0, 0, 0, 0, 1)
 		} else {
-			info, err := os.Lstat(pathname)
+			stat := os.Lstat
+			if job.follow {
+				stat = os.Stat
+			}
+			info, err := stat(pathname)
 			if err != nil {
 				results <- importer.NewScanError(unixPath, err)
 				continue
@@ -95,10 +100,10 @@ func walkDir_worker(jobs <-chan string, results chan<- *importer.ScanResult, wg
 	}
 }
 
-func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results chan<- *importer.ScanResult) {
+func walkDir_addPrefixDirectories(rootDir string, jobs chan<- walkJob, results chan<- *importer.ScanResult) {
 	atoms := strings.Split(rootDir, string(os.PathSeparator))
 
-	jobs <- "/"
+	jobs <- walkJob{path: "/"}
 	for i := 0; i < len(atoms)-1; i++ {
 		pathname := strings.Join(atoms[0:i+1], string(os.PathSeparator))
 
@@ -107,13 +112,22 @@ func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results ch
 			continue
 		}
 
-		jobs <- pathname
+		jobs <- walkJob{path: pathname, follow: true}
 	}
 }
 
-func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult, error) {
+// walkJob is a path to be scanned, follow is set when it is a symbolic
+// link to be recorded as what it points to.
+type walkJob struct {
+	path   string
+	follow bool
+}
+
+// walkDir_walker only applies the symbolic link policy to the root, links
+// found below it are always recorded as links.
+func walkDir_walker(rootDir string, followSymlinks string, numWorkers int) (<-chan *importer.ScanResult, error) {
 	results := make(chan *importer.ScanResult, 1000) // Larger buffer for results
-	jobs := make(chan string, 1000)                  // Buffered channel to feed paths to workers
+	jobs := make(chan walkJob, 1000)                 // Buffered channel to feed paths to workers
 	var wg sync.WaitGroup
 
 	// Launch worker pool
@@ -131,7 +145,7 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult
 			results <- importer.NewScanError(rootDir, err)
 			return
 		}
-		if info.Mode()&os.ModeSymlink != 0 {
+		if info.Mode()&os.ModeSymlink != 0 && followSymlinks != FOLLOW_NEVER {
 			originFile, err := os.Readlink(rootDir)
 			if err != nil {
 				results <- importer.NewScanError(rootDir, err)
@@ -153,7 +167,7 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult
 				results <- importer.NewScanError(pathname, err)
 				return nil
 			}
-			jobs <- pathname
+			jobs <- walkJob{path: pathname}
 			return nil
 		})
 		if err != nil {
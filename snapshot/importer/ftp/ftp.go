@@ -17,12 +17,14 @@
 package ftp
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,9 +34,15 @@ import (
 	"github.com/secsy/goftp"
 )
 
+// DEFAULT_RETRIES is how many times a transfer is attempted again when it
+// fails and couldn't be resumed, unless configured otherwise.
+const DEFAULT_RETRIES = 3
+
 type FTPImporter struct {
 	host    string
 	rootDir string
+	config  goftp.Config
+	retries int
 	client  *goftp.Client
 }
 
@@ -42,12 +50,70 @@ func init() {
 	importer.Register("ftp", NewFTPImporter)
 }
 
-func connectToFTP(host, username, password string) (*goftp.Client, error) {
-	config := goftp.Config{
-		User:     username,
-		Password: password,
-		Timeout:  10 * time.Second,
+// ftpConfig returns the client configuration and address of the server
+// at location.  The ftps scheme defaults to implicit TLS, the tls option
+// selects between none, explicit and implicit.
+func ftpConfig(parsed *url.URL, config map[string]string) (goftp.Config, string, error) {
+	ftpconf := goftp.Config{
+		Timeout: 10 * time.Second,
+	}
+
+	if parsed.User != nil {
+		ftpconf.User = parsed.User.Username()
+		if password, ok := parsed.User.Password(); ok {
+			ftpconf.Password = password
+		}
+	}
+	if value, ok := config["username"]; ok {
+		ftpconf.User = value
+	}
+	if value, ok := config["password"]; ok {
+		ftpconf.Password = value
+	}
+
+	mode := "none"
+	if parsed.Scheme == "ftps" {
+		mode = "implicit"
+	}
+	if value, ok := config["tls"]; ok {
+		mode = value
+	}
+
+	insecure := false
+	if value, ok := config["tls_insecure_skip_verify"]; ok {
+		tmp, err := strconv.ParseBool(value)
+		if err != nil {
+			return ftpconf, "", fmt.Errorf("invalid tls_insecure_skip_verify value")
+		}
+		insecure = tmp
+	}
+
+	port := "21"
+	switch mode {
+	case "none":
+	case "explicit":
+		ftpconf.TLSMode = goftp.TLSExplicit
+	case "implicit":
+		ftpconf.TLSMode = goftp.TLSImplicit
+		port = "990"
+	default:
+		return ftpconf, "", fmt.Errorf("invalid tls value: %s", mode)
+	}
+	if mode != "none" {
+		ftpconf.TLSConfig = &tls.Config{
+			ServerName:         parsed.Hostname(),
+			InsecureSkipVerify: insecure,
+		}
+	}
+
+	host := parsed.Host
+	if parsed.Port() == "" {
+		host = parsed.Host + ":" + port
 	}
+	return ftpconf, host, nil
+}
+
+func connectToFTP(host string, config goftp.Config) (*goftp.Client, error) {
 	return goftp.DialConfig(config, host)
 }
 
@@ -60,17 +126,25 @@ func NewFTPImporter(config map[string]string) (importer.Importer, error) {
 		return nil, err
 	}
 
-	//if parsed.User != nil {
-	//	username = parsed.User.Username()
-	//	if tmppass, passexists := parsed.User.Password(); passexists {
-	//		password = tmppass
-	//	}
-	//}
+	ftpconf, host, err := ftpConfig(parsed, config)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := DEFAULT_RETRIES
+	if value, ok := config["retries"]; ok {
+		tmp, err := strconv.Atoi(value)
+		if err != nil || tmp < 0 {
+			return nil, fmt.Errorf("invalid retries value")
+		}
+		retries = tmp
+	}
 
 	return &FTPImporter{
-		host:    parsed.Host,
+		host:    host,
 		rootDir: parsed.Path,
-		//		client:  client,
+		config:  ftpconf,
+		retries: retries,
 	}, nil
 }
 
@@ -144,9 +218,8 @@ func (p *FTPImporter) walkDir(root string, results chan<- string, wg *sync.WaitG
 }
 
 func (p *FTPImporter) Scan() (<-chan *importer.ScanResult, error) {
-	client, err := connectToFTP(p.host, "", "")
+	client, err := connectToFTP(p.host, p.config)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 	p.client = client
@@ -176,19 +249,51 @@ func (p *FTPImporter) Scan() (<-chan *importer.ScanResult, error) {
 	return results, nil
 }
 
+// tmpfileReader removes the temporary file it reads from once closed.
+type tmpfileReader struct {
+	*os.File
+}
+
+func (t *tmpfileReader) Close() error {
+	defer os.Remove(t.Name())
+	return t.File.Close()
+}
+
+// NewReader retrieves the file to a temporary file.  The client resumes
+// interrupted transfers itself when the server supports it, transfers
+// that couldn't be resumed are started over up to the configured number
+// of retries.
 func (p *FTPImporter) NewReader(pathname string) (io.ReadCloser, error) {
 	tmpfile, err := os.CreateTemp("", "plakar-ftp-")
 	if err != nil {
 		return nil, err
 	}
+	rd := &tmpfileReader{tmpfile}
 
-	err = p.client.Retrieve(pathname, tmpfile)
+	for attempt := 0; ; attempt++ {
+		err = p.client.Retrieve(pathname, tmpfile)
+		if err == nil || attempt == p.retries {
+			break
+		}
+		if err := tmpfile.Truncate(0); err != nil {
+			rd.Close()
+			return nil, err
+		}
+		if _, err := tmpfile.Seek(0, io.SeekStart); err != nil {
+			rd.Close()
+			return nil, err
+		}
+	}
 	if err != nil {
+		rd.Close()
 		return nil, err
 	}
-	tmpfile.Seek(0, 0)
 
-	return tmpfile, nil
+	if _, err := tmpfile.Seek(0, io.SeekStart); err != nil {
+		rd.Close()
+		return nil, err
+	}
+	return rd, nil
 }
 
 func (p *FTPImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
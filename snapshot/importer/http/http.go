@@ -0,0 +1,389 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/gobwas/glob"
+	"golang.org/x/net/html"
+)
+
+// INDEX_FILE is the name under which the content of a URL ending with a
+// slash is stored, as a directory can't have content of its own.
+const INDEX_FILE = "index.html"
+
+// HTTPImporter archives the pages and files of a site, either listed by a
+// manifest or found by following the links of the pages below location.
+// URLs are stored under their path.
+type HTTPImporter struct {
+	base     *url.URL
+	rootDir  string
+	manifest string
+	includes []glob.Glob
+	client   *http.Client
+
+	urls sync.Map
+	ino  uint64
+}
+
+func init() {
+	importer.Register("http", NewHTTPImporter)
+}
+
+func NewHTTPImporter(config map[string]string) (importer.Importer, error) {
+	location := config["location"]
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+
+	includes := []glob.Glob{}
+	if value, ok := config["include"]; ok {
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			g, err := glob.Compile(pattern, '/')
+			if err != nil {
+				return nil, fmt.Errorf("invalid include pattern: %s", pattern)
+			}
+			includes = append(includes, g)
+		}
+	}
+
+	rootDir := parsed.Path
+	if !strings.HasSuffix(rootDir, "/") {
+		rootDir = path.Dir(rootDir)
+	}
+
+	return &HTTPImporter{
+		base:     parsed,
+		rootDir:  path.Clean(rootDir),
+		manifest: config["manifest"],
+		includes: includes,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// pathname returns where the content of u is stored.
+func pathname(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") || u.Path == "" {
+		p = path.Join(p, INDEX_FILE)
+	}
+	return p
+}
+
+// wanted tells if u belongs to the archive: it must be on the same site,
+// below the root directory and, if include rules are set, be stored under
+// a path matching one of them.  Pages that aren't wanted aren't crawled.
+func (p *HTTPImporter) wanted(u *url.URL) bool {
+	if u.Scheme != p.base.Scheme || u.Host != p.base.Host {
+		return false
+	}
+	upath := path.Clean("/" + u.Path)
+	if p.rootDir != "/" && upath != p.rootDir && !strings.HasPrefix(upath, p.rootDir+"/") {
+		return false
+	}
+	if len(p.includes) == 0 {
+		return true
+	}
+	for _, g := range p.includes {
+		if g.Match(pathname(u)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readManifest returns the URLs listed in the manifest, one per line,
+// relative to location unless absolute.  Empty lines and lines starting
+// with # are ignored.
+func (p *HTTPImporter) readManifest() ([]*url.URL, error) {
+	var rd io.ReadCloser
+	if strings.HasPrefix(p.manifest, "http://") || strings.HasPrefix(p.manifest, "https://") {
+		resp, err := p.client.Get(p.manifest)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %s", p.manifest, resp.Status)
+		}
+		rd = resp.Body
+	} else {
+		fp, err := os.Open(p.manifest)
+		if err != nil {
+			return nil, err
+		}
+		rd = fp
+	}
+	defer rd.Close()
+
+	urls := []*url.URL{}
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := p.base.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest entry %s: %w", line, err)
+		}
+		urls = append(urls, u)
+	}
+	return urls, scanner.Err()
+}
+
+// links returns the URLs referenced by an HTML document.
+func links(base *url.URL, rd io.Reader) []*url.URL {
+	ret := []*url.URL{}
+	tokenizer := html.NewTokenizer(rd)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ret
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			for _, attr := range token.Attr {
+				if attr.Key != "href" && attr.Key != "src" {
+					continue
+				}
+				u, err := base.Parse(attr.Val)
+				if err != nil {
+					continue
+				}
+				u.Fragment = ""
+				u.RawQuery = ""
+				ret = append(ret, u)
+			}
+		}
+	}
+}
+
+func (p *HTTPImporter) newFileInfo(name string, size int64, mode os.FileMode, mtime time.Time) objects.FileInfo {
+	nlink := uint64(1)
+	if mode.IsDir() {
+		nlink = 0
+	}
+	return objects.NewFileInfo(name, size, mode, mtime, nlink, atomic.AddUint64(&p.ino, 1), 0, 0, 0)
+}
+
+// crawler holds the state of a scan, files being kept until the end so
+// that a page whose path turns out to be a directory can be moved below
+// it.
+type crawler struct {
+	importer *HTTPImporter
+	crawl    bool
+	seen     map[string]struct{}
+	dirs     map[string]struct{}
+	files    map[string]*importer.ScanRecord
+	results  chan<- *importer.ScanResult
+}
+
+// fetch retrieves u, records it and returns the links it holds if it is
+// a page to be crawled.
+func (c *crawler) fetch(u *url.URL) []*url.URL {
+	resp, err := c.importer.client.Get(u.String())
+	if err != nil {
+		c.results <- importer.NewScanError(pathname(u), err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.results <- importer.NewScanError(pathname(u), fmt.Errorf("%s", resp.Status))
+		return nil
+	}
+
+	// a redirection is recorded under its target, if part of the archive
+	if final := resp.Request.URL; final.String() != u.String() {
+		if !c.importer.wanted(final) {
+			return nil
+		}
+		if _, exists := c.seen[pathname(final)]; exists {
+			return nil
+		}
+		c.seen[pathname(final)] = struct{}{}
+		u = final
+	}
+
+	mtime := time.Now()
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		mtime = lastModified
+	}
+	size := resp.ContentLength
+	if size < 0 {
+		size = 0
+	}
+
+	pathname := pathname(u)
+	c.importer.urls.Store(pathname, u.String())
+	c.files[pathname] = &importer.ScanRecord{
+		Pathname: pathname,
+		FileInfo: c.importer.newFileInfo(path.Base(pathname), size, 0644, mtime),
+	}
+	for dir := path.Dir(pathname); ; dir = path.Dir(dir) {
+		c.dirs[dir] = struct{}{}
+		if dir == "/" {
+			break
+		}
+	}
+
+	if !c.crawl || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	return links(u, resp.Body)
+}
+
+func (c *crawler) run(queue []*url.URL) {
+	for len(queue) != 0 {
+		u := queue[0]
+		queue = queue[1:]
+
+		if _, exists := c.seen[pathname(u)]; exists || !c.importer.wanted(u) {
+			continue
+		}
+		c.seen[pathname(u)] = struct{}{}
+
+		queue = append(queue, c.fetch(u)...)
+	}
+
+	pathnames := make([]string, 0, len(c.dirs)+len(c.files))
+	for dir := range c.dirs {
+		pathnames = append(pathnames, dir)
+	}
+	for pathname, record := range c.files {
+		if _, isDir := c.dirs[pathname]; !isDir {
+			pathnames = append(pathnames, pathname)
+			continue
+		}
+
+		index := path.Join(pathname, INDEX_FILE)
+		if _, exists := c.files[index]; exists {
+			c.results <- importer.NewScanError(pathname, fmt.Errorf("page conflicts with directory %s", pathname))
+			continue
+		}
+		location, _ := c.importer.urls.Load(pathname)
+		c.importer.urls.Store(index, location)
+		record.Pathname = index
+		record.FileInfo.Lname = INDEX_FILE
+		c.files[index] = record
+		pathnames = append(pathnames, index)
+	}
+	sort.Strings(pathnames)
+
+	for _, pathname := range pathnames {
+		if record, isFile := c.files[pathname]; isFile {
+			c.results <- importer.NewScanRecord(record.Pathname, "", record.FileInfo, nil)
+		} else {
+			fi := c.importer.newFileInfo(path.Base(pathname), 0, 0755|os.ModeDir, time.Now())
+			c.results <- importer.NewScanRecord(pathname, "", fi, nil)
+		}
+	}
+}
+
+func (p *HTTPImporter) Scan() (<-chan *importer.ScanResult, error) {
+	queue := []*url.URL{p.base}
+	crawl := true
+	if p.manifest != "" {
+		urls, err := p.readManifest()
+		if err != nil {
+			return nil, err
+		}
+		queue = urls
+		crawl = false
+	}
+
+	results := make(chan *importer.ScanResult, 1000)
+	c := &crawler{
+		importer: p,
+		crawl:    crawl,
+		seen:     make(map[string]struct{}),
+		dirs:     make(map[string]struct{}),
+		files:    make(map[string]*importer.ScanRecord),
+		results:  results,
+	}
+	go func() {
+		defer close(results)
+		c.run(queue)
+	}()
+	return results, nil
+}
+
+func (p *HTTPImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	location, ok := p.urls.Load(pathname)
+	if !ok {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+
+	resp, err := p.client.Get(location.(string))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (p *HTTPImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on HTTP")
+}
+
+func (p *HTTPImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on HTTP")
+}
+
+func (p *HTTPImporter) Close() error {
+	return nil
+}
+
+func (p *HTTPImporter) Root() string {
+	return p.rootDir
+}
+
+func (p *HTTPImporter) Origin() string {
+	return p.base.Host
+}
+
+func (p *HTTPImporter) Type() string {
+	return "http"
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSite(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><a href="/a.txt">a</a><a href="/docs">docs</a><a href="https://example.org/">out</a></html>`)
+	})
+	mux.HandleFunc("/a.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "file a")
+	})
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/docs/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/docs/":
+			fmt.Fprint(w, `<html><a href="page.html#top">page</a><img src="logo.png"></html>`)
+		case "/docs/page.html":
+			fmt.Fprint(w, `<html><a href="/">home</a></html>`)
+		case "/docs/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "png")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func scanPaths(t *testing.T, config map[string]string) ([]string, *HTTPImporter) {
+	imp, err := NewHTTPImporter(config)
+	require.NoError(t, err)
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	paths := []string{}
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		paths = append(paths, record.Record.Pathname)
+	}
+	sort.Strings(paths)
+	return paths, imp.(*HTTPImporter)
+}
+
+func TestHTTPImporterCrawl(t *testing.T) {
+	ts := newTestSite(t)
+
+	paths, imp := scanPaths(t, map[string]string{"location": ts.URL + "/"})
+	require.Equal(t, []string{"/", "/a.txt", "/docs", "/docs/index.html", "/docs/logo.png", "/docs/page.html", "/index.html"}, paths)
+	require.Equal(t, "/", imp.Root())
+	require.Equal(t, "http", imp.Type())
+
+	rd, err := imp.NewReader("/a.txt")
+	require.NoError(t, err)
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "file a", string(data))
+
+	paths, _ = scanPaths(t, map[string]string{"location": ts.URL + "/", "include": "/index.html,/docs/*.html,/docs/index.html"})
+	require.Equal(t, []string{"/", "/index.html"}, paths)
+
+	paths, _ = scanPaths(t, map[string]string{"location": ts.URL + "/docs/"})
+	require.Equal(t, []string{"/", "/docs", "/docs/index.html", "/docs/logo.png", "/docs/page.html"}, paths)
+}
+
+func TestHTTPImporterManifest(t *testing.T) {
+	ts := newTestSite(t)
+
+	manifest, err := os.CreateTemp("", "manifest")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(manifest.Name())
+	})
+	fmt.Fprintf(manifest, "# exported files\n/a.txt\n\n%s/docs/logo.png\n", ts.URL)
+	manifest.Close()
+
+	paths, _ := scanPaths(t, map[string]string{"location": ts.URL + "/", "manifest": manifest.Name()})
+	require.Equal(t, []string{"/", "/a.txt", "/docs", "/docs/logo.png"}, paths)
+}
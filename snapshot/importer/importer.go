@@ -23,6 +23,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/PlakarKorp/plakar/objects"
 )
@@ -46,6 +47,10 @@ type ScanRecord struct {
 	IsXattr            bool
 	XattrName          string
 	XattrType          objects.Attribute
+
+	// IsTombstone marks the deletion of Pathname, and of everything
+	// below it, since a previous state of the source.
+	IsTombstone bool
 }
 
 type ScanError struct {
@@ -64,6 +69,34 @@ type Importer interface {
 	Close() error
 }
 
+// VolumeIdentifier is implemented by importers able to identify the volume
+// they read from, such as a filesystem UUID, so that cached entries can be
+// discarded when the source is replaced by another one at the same origin.
+// An empty identifier means the volume could not be identified.
+type VolumeIdentifier interface {
+	VolumeID() (string, error)
+}
+
+// Timestamper is implemented by importers reading a point-in-time copy of
+// their source, such as a snapshot of another backup tool, so that the
+// snapshot is dated after it rather than after the backup.
+type Timestamper interface {
+	Timestamp() (time.Time, error)
+}
+
+// Tagger is implemented by importers able to describe their source, such
+// as the version of a server, as key=value tags added to the snapshot.
+type Tagger interface {
+	Tags() ([]string, error)
+}
+
+// ContentTyper is implemented by importers knowing the content type of
+// some of their files, such as streams named by the user, for which it
+// can't be guessed from the extension.  An empty type means unknown.
+type ContentTyper interface {
+	ContentType(pathname string) string
+}
+
 var muBackends sync.Mutex
 var backends map[string]func(config map[string]string) (Importer, error) = make(map[string]func(config map[string]string) (Importer, error))
 
@@ -101,15 +134,41 @@ func NewImporter(config map[string]string) (Importer, error) {
 	defer muBackends.Unlock()
 
 	var backendName string
-	if !strings.HasPrefix(location, "/") {
-		if strings.HasPrefix(location, "s3://") {
+	if location == "-" {
+		backendName = "stdin"
+	} else if !strings.HasPrefix(location, "/") {
+		if strings.HasPrefix(location, "stdin://") {
+			backendName = "stdin"
+		} else if strings.HasPrefix(location, "s3://") {
 			backendName = "s3"
 		} else if strings.HasPrefix(location, "fs://") {
 			backendName = "fs"
-		} else if strings.HasPrefix(location, "ftp://") {
+		} else if strings.HasPrefix(location, "ftp://") || strings.HasPrefix(location, "ftps://") {
 			backendName = "ftp"
 		} else if strings.HasPrefix(location, "sftp://") {
 			backendName = "sftp"
+		} else if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+			backendName = "http"
+		} else if strings.HasPrefix(location, "caldav://") || strings.HasPrefix(location, "caldavs://") {
+			backendName = "caldav"
+		} else if strings.HasPrefix(location, "carddav://") || strings.HasPrefix(location, "carddavs://") {
+			backendName = "carddav"
+		} else if strings.HasPrefix(location, "ldap://") || strings.HasPrefix(location, "ldaps://") {
+			backendName = "ldap"
+		} else if strings.HasPrefix(location, "etcd://") || strings.HasPrefix(location, "etcds://") {
+			backendName = "etcd"
+		} else if strings.HasPrefix(location, "consul://") || strings.HasPrefix(location, "consuls://") {
+			backendName = "consul"
+		} else if strings.HasPrefix(location, "redis://") || strings.HasPrefix(location, "rediss://") {
+			backendName = "redis"
+		} else if strings.HasPrefix(location, "postgres://") || strings.HasPrefix(location, "postgresql://") {
+			backendName = "postgres"
+		} else if strings.HasPrefix(location, "mongodb://") || strings.HasPrefix(location, "mongodb+srv://") {
+			backendName = "mongodb"
+		} else if strings.HasPrefix(location, "restic://") {
+			backendName = "restic"
+		} else if strings.HasPrefix(location, "borg://") {
+			backendName = "borg"
 		} else {
 			if strings.Contains(location, "://") {
 				return nil, fmt.Errorf("unsupported importer protocol")
@@ -154,6 +213,17 @@ func NewScanXattr(pathname, xattr string, kind objects.Attribute) *ScanResult {
 	}
 }
 
+// NewScanTombstone records that pathname was deleted from the source, for
+// importers producing partial snapshots meant to be replayed in sequence.
+func NewScanTombstone(pathname string) *ScanResult {
+	return &ScanResult{
+		Record: &ScanRecord{
+			Pathname:    pathname,
+			IsTombstone: true,
+		},
+	}
+}
+
 func NewScanError(pathname string, err error) *ScanResult {
 	return &ScanResult{
 		Error: &ScanError{
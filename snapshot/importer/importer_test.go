@@ -72,6 +72,27 @@ func TestNewImporter(t *testing.T) {
 	Register("ftp", func(config map[string]string) (Importer, error) {
 		return MockedImporter{}, nil
 	})
+	Register("http", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
+	Register("caldav", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
+	Register("carddav", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
+	Register("ldap", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
+	Register("etcd", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
+	Register("consul", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
+	Register("redis", func(config map[string]string) (Importer, error) {
+		return MockedImporter{}, nil
+	})
 
 	tests := []struct {
 		location        string
@@ -82,7 +103,15 @@ func TestNewImporter(t *testing.T) {
 		{location: "fs://some/path", expectedError: "", expectedBackend: "fs"},
 		{location: "s3://bucket/path", expectedError: "", expectedBackend: "s3"},
 		{location: "ftp://some/path", expectedError: "", expectedBackend: "ftp"},
-		{location: "http://unsupported", expectedError: "unsupported importer protocol", expectedBackend: ""},
+		{location: "ftps://some/path", expectedError: "", expectedBackend: "ftp"},
+		{location: "https://some/path", expectedError: "", expectedBackend: "http"},
+		{location: "caldavs://some/path", expectedError: "", expectedBackend: "caldav"},
+		{location: "carddav://some/path", expectedError: "", expectedBackend: "carddav"},
+		{location: "ldaps://some/path", expectedError: "", expectedBackend: "ldap"},
+		{location: "etcds://some/path", expectedError: "", expectedBackend: "etcd"},
+		{location: "consul://some/path", expectedError: "", expectedBackend: "consul"},
+		{location: "rediss://some:6380", expectedError: "", expectedBackend: "redis"},
+		{location: "gopher://unsupported", expectedError: "unsupported importer protocol", expectedBackend: ""},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package kv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/hashicorp/consul/api"
+)
+
+// consul speaks to the HTTP API of a consul agent.
+type consul struct {
+	config *api.Config
+}
+
+func init() {
+	importer.Register("consul", NewConsulImporter)
+}
+
+func NewConsulImporter(config map[string]string) (importer.Importer, error) {
+	p, base, tlsConfig, err := newKVImporter("consul", config)
+	if err != nil {
+		return nil, err
+	}
+	// consul keys have no leading slash
+	p.prefix = strings.TrimPrefix(p.prefix, "/")
+
+	clientConfig := &api.Config{
+		Address:    base.Host,
+		Scheme:     base.Scheme,
+		Token:      config["token"],
+		Datacenter: config["datacenter"],
+	}
+	if tlsConfig != nil {
+		clientConfig.TLSConfig.InsecureSkipVerify = tlsConfig.InsecureSkipVerify
+	}
+	p.store = &consul{config: clientConfig}
+	return p, nil
+}
+
+// query returns a client and the options of a request bound to ctx.
+func (c *consul) query(ctx context.Context) (*api.Client, *api.QueryOptions, error) {
+	client, err := api.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, (&api.QueryOptions{}).WithContext(ctx), nil
+}
+
+func (c *consul) keys(prefix string, fn func(key string, value []byte) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), KV_TIMEOUT)
+	defer cancel()
+
+	client, q, err := c.query(ctx)
+	if err != nil {
+		return err
+	}
+
+	// no key below the prefix yields an empty list
+	kvs, _, err := client.KV().List(prefix, q)
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		if err := fn(kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *consul) snapshot(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), KV_TIMEOUT)
+	defer cancel()
+
+	client, q, err := c.query(ctx)
+	if err != nil {
+		return err
+	}
+
+	rd, _, err := client.Snapshot().Save(q)
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	defer rd.Close()
+
+	_, err = io.Copy(w, rd)
+	return err
+}
+
+func (c *consul) snapshotName() string {
+	return "snapshot.tgz"
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// ETCD_PAGE_SIZE is the number of keys fetched per range request.
+const ETCD_PAGE_SIZE = 1000
+
+// etcd speaks to the v3 gRPC API of an etcd cluster.
+type etcd struct {
+	endpoint  string
+	tlsConfig *tls.Config
+	username  string
+	password  string
+}
+
+func init() {
+	importer.Register("etcd", NewEtcdImporter)
+}
+
+func NewEtcdImporter(config map[string]string) (importer.Importer, error) {
+	p, base, tlsConfig, err := newKVImporter("etcd", config)
+	if err != nil {
+		return nil, err
+	}
+	p.store = &etcd{
+		endpoint:  base.String(),
+		tlsConfig: tlsConfig,
+		username:  config["username"],
+		password:  config["password"],
+	}
+	return p, nil
+}
+
+// dial connects to the cluster, authenticating if credentials were
+// configured.
+func (e *etcd) dial() (*clientv3.Client, error) {
+	return clientv3.New(clientv3.Config{
+		Endpoints:   []string{e.endpoint},
+		TLS:         e.tlsConfig,
+		Username:    e.username,
+		Password:    e.password,
+		DialTimeout: 30 * time.Second,
+		Logger:      zap.NewNop(),
+	})
+}
+
+func (e *etcd) keys(prefix string, fn func(key string, value []byte) error) error {
+	client, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), KV_TIMEOUT)
+	defer cancel()
+
+	key := prefix
+	if key == "" {
+		key = "\x00"
+	}
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+	revision := int64(0)
+
+	for {
+		resp, err := client.Get(ctx, key,
+			clientv3.WithRange(rangeEnd),
+			clientv3.WithLimit(ETCD_PAGE_SIZE),
+			clientv3.WithRev(revision))
+		if err != nil {
+			return err
+		}
+
+		for _, kv := range resp.Kvs {
+			if err := fn(string(kv.Key), kv.Value); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+
+		// next page starts right after the last key, at the same revision
+		// so that the keys are a consistent view of the store
+		key = string(append(bytes.Clone(resp.Kvs[len(resp.Kvs)-1].Key), 0))
+		if revision == 0 {
+			revision = resp.Header.Revision
+		}
+	}
+}
+
+func (e *etcd) snapshot(w io.Writer) error {
+	client, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), KV_TIMEOUT)
+	defer cancel()
+
+	rd, err := client.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	defer rd.Close()
+
+	if _, err := io.Copy(w, rd); err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	return nil
+}
+
+func (e *etcd) snapshotName() string {
+	return "snapshot.db"
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package kv
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+const (
+	MODE_KEYS     = "keys"
+	MODE_SNAPSHOT = "snapshot"
+)
+
+// KV_TIMEOUT bounds the time spent listing the keys or streaming the
+// snapshot of a store.
+const KV_TIMEOUT = 10 * time.Minute
+
+// store is what differs between key-value stores: how to list the keys
+// below a prefix and how to stream a snapshot of the whole store.
+type store interface {
+	keys(prefix string, fn func(key string, value []byte) error) error
+	snapshot(w io.Writer) error
+	snapshotName() string
+}
+
+// KVImporter either stores each key below the prefix of its location as
+// a file, /<key>, or a single snapshot of the store.  Values are spooled
+// to a temporary file during the scan so their sizes are known upfront.
+type KVImporter struct {
+	name   string
+	store  store
+	host   string
+	prefix string
+	mode   string
+
+	spool   *os.File
+	entries map[string]*io.SectionReader
+	dirs    []string
+	errors  map[string]error
+}
+
+// newKVImporter parses the settings common to all stores, the location
+// scheme being name or name+"s" for TLS, in which case the returned TLS
+// configuration is not nil.
+func newKVImporter(name string, config map[string]string) (*KVImporter, *url.URL, *tls.Config, error) {
+	parsed, err := url.Parse(config["location"])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var tlsConfig *tls.Config
+	switch parsed.Scheme {
+	case name:
+		parsed.Scheme = "http"
+	case name + "s":
+		parsed.Scheme = "https"
+		tlsConfig = &tls.Config{}
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+
+	p := &KVImporter{
+		name:    name,
+		host:    parsed.Host,
+		prefix:  parsed.Path,
+		mode:    MODE_KEYS,
+		entries: make(map[string]*io.SectionReader),
+		errors:  make(map[string]error),
+	}
+	if p.prefix == "/" {
+		p.prefix = ""
+	}
+
+	if value, ok := config["mode"]; ok {
+		if value != MODE_KEYS && value != MODE_SNAPSHOT {
+			return nil, nil, nil, fmt.Errorf("invalid mode value %q", value)
+		}
+		p.mode = value
+	}
+
+	if value, ok := config["tls_insecure_skip_verify"]; ok {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid tls_insecure_skip_verify value")
+		}
+		if tlsConfig != nil {
+			tlsConfig.InsecureSkipVerify = insecure
+		}
+	}
+
+	parsed.Path = ""
+	parsed.User = nil
+	return p, parsed, tlsConfig, nil
+}
+
+// keyPath returns the pathname a key is stored at, or an empty string if
+// it can't be represented as one, e.g. "a//b" or "a/../b".
+func keyPath(key string) string {
+	pathname := "/" + strings.TrimLeft(key, "/")
+	if pathname == "/" || path.Clean(pathname) != pathname {
+		return ""
+	}
+	return pathname
+}
+
+func (p *KVImporter) spoolKeys(fp *os.File) error {
+	offset := int64(0)
+	dirs := make(map[string]struct{})
+
+	err := p.store.keys(p.prefix, func(key string, value []byte) error {
+		// folders, as created by the consul UI, hold no data
+		if strings.HasSuffix(key, "/") && len(value) == 0 {
+			if pathname := keyPath(strings.TrimRight(key, "/")); pathname != "" {
+				dirs[pathname] = struct{}{}
+			}
+			return nil
+		}
+
+		pathname := keyPath(key)
+		if pathname == "" {
+			p.errors["/"+key] = fmt.Errorf("key %q can't be stored as a file, use mode %s", key, MODE_SNAPSHOT)
+			return nil
+		}
+
+		if _, err := fp.Write(value); err != nil {
+			return err
+		}
+		p.entries[pathname] = io.NewSectionReader(fp, offset, int64(len(value)))
+		offset += int64(len(value))
+
+		for dir := path.Dir(pathname); dir != "/"; dir = path.Dir(dir) {
+			dirs[dir] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for dir := range dirs {
+		// a key can't be both a file and the parent of other keys
+		if _, exists := p.entries[dir]; exists {
+			delete(p.entries, dir)
+			p.errors[dir] = fmt.Errorf("key %q is also a prefix of other keys, use mode %s", strings.TrimPrefix(dir, "/"), MODE_SNAPSHOT)
+		}
+		p.dirs = append(p.dirs, dir)
+	}
+	sort.Strings(p.dirs)
+	return nil
+}
+
+func (p *KVImporter) spoolSnapshot(fp *os.File) error {
+	if err := p.store.snapshot(fp); err != nil {
+		return err
+	}
+	offset, err := fp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	p.entries["/"+p.store.snapshotName()] = io.NewSectionReader(fp, 0, offset)
+	return nil
+}
+
+func (p *KVImporter) Scan() (<-chan *importer.ScanResult, error) {
+	fp, err := os.CreateTemp("", "plakar-"+p.name+"-*")
+	if err != nil {
+		return nil, err
+	}
+	p.spool = fp
+
+	if p.mode == MODE_SNAPSHOT {
+		err = p.spoolSnapshot(fp)
+	} else {
+		err = p.spoolKeys(fp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pathnames := make([]string, 0, len(p.entries))
+	for pathname := range p.entries {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+
+		now := time.Now()
+		ino := uint64(0)
+		newFileInfo := func(name string, size int64, mode os.FileMode) objects.FileInfo {
+			ino++
+			nlink := uint64(1)
+			if mode.IsDir() {
+				nlink = 0
+			}
+			return objects.NewFileInfo(name, size, mode, now, nlink, ino, 0, 0, 0)
+		}
+
+		results <- importer.NewScanRecord("/", "", newFileInfo("/", 0, 0700|os.ModeDir), nil)
+		for _, dir := range p.dirs {
+			results <- importer.NewScanRecord(dir, "", newFileInfo(path.Base(dir), 0, 0700|os.ModeDir), nil)
+		}
+		for _, pathname := range pathnames {
+			results <- importer.NewScanRecord(pathname, "", newFileInfo(path.Base(pathname), p.entries[pathname].Size(), 0600), nil)
+		}
+		for pathname, err := range p.errors {
+			results <- importer.NewScanError(pathname, err)
+		}
+	}()
+	return results, nil
+}
+
+func (p *KVImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	entry, ok := p.entries[pathname]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(entry, 0, entry.Size())), nil
+}
+
+func (p *KVImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on %s", p.name)
+}
+
+func (p *KVImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on %s", p.name)
+}
+
+func (p *KVImporter) Close() error {
+	if p.spool == nil {
+		return nil
+	}
+	p.spool.Close()
+	return os.Remove(p.spool.Name())
+}
+
+func (p *KVImporter) Root() string {
+	return "/"
+}
+
+func (p *KVImporter) Origin() string {
+	return p.host
+}
+
+func (p *KVImporter) Type() string {
+	return p.name
+}
@@ -0,0 +1,244 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// scan returns the pathnames and errors of a scan, and the content of
+// the files.
+func scan(t *testing.T, imp importer.Importer) ([]string, []string, map[string]string) {
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	paths := []string{}
+	errors := []string{}
+	contents := make(map[string]string)
+	for record := range scanChan {
+		if record.Error != nil {
+			errors = append(errors, record.Error.Pathname)
+			continue
+		}
+		paths = append(paths, record.Record.Pathname)
+		if !record.Record.FileInfo.IsDir() {
+			rd, err := imp.NewReader(record.Record.Pathname)
+			require.NoError(t, err)
+			data, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			rd.Close()
+			require.Equal(t, record.Record.FileInfo.Size(), int64(len(data)))
+			contents[record.Record.Pathname] = string(data)
+		}
+	}
+	sort.Strings(paths)
+	sort.Strings(errors)
+	return paths, errors, contents
+}
+
+func TestKeyPath(t *testing.T) {
+	require.Equal(t, "/registry/pods/a", keyPath("/registry/pods/a"))
+	require.Equal(t, "/config/app", keyPath("config/app"))
+	require.Equal(t, "", keyPath("a//b"))
+	require.Equal(t, "", keyPath("a/../b"))
+	require.Equal(t, "", keyPath("a/"))
+	require.Equal(t, "", keyPath("/"))
+}
+
+// etcdServer implements the parts of the etcd v3 API the importer uses,
+// two keys per range response.
+type etcdServer struct {
+	etcdserverpb.UnimplementedKVServer
+	etcdserverpb.UnimplementedMaintenanceServer
+	etcdserverpb.UnimplementedAuthServer
+
+	t      *testing.T
+	keys   []string
+	values map[string]string
+}
+
+func (s *etcdServer) Authenticate(ctx context.Context, req *etcdserverpb.AuthenticateRequest) (*etcdserverpb.AuthenticateResponse, error) {
+	if req.Name != "root" || req.Password != "secret" {
+		return nil, status.Error(codes.InvalidArgument, "authentication failed")
+	}
+	return &etcdserverpb.AuthenticateResponse{Header: &etcdserverpb.ResponseHeader{}, Token: "tok"}, nil
+}
+
+func (s *etcdServer) Range(ctx context.Context, req *etcdserverpb.RangeRequest) (*etcdserverpb.RangeResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tokens := md.Get("token"); len(tokens) != 1 || tokens[0] != "tok" {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	// every page is read at the revision of the first one
+	if string(req.Key) != "/app" {
+		require.Equal(s.t, int64(42), req.Revision)
+	}
+
+	page := &etcdserverpb.RangeResponse{Header: &etcdserverpb.ResponseHeader{Revision: 42}}
+	for _, key := range s.keys {
+		if key < string(req.Key) || key >= string(req.RangeEnd) {
+			continue
+		}
+		if len(page.Kvs) == 2 {
+			page.More = true
+			break
+		}
+		page.Kvs = append(page.Kvs, &mvccpb.KeyValue{Key: []byte(key), Value: []byte(s.values[key])})
+	}
+	return page, nil
+}
+
+func (s *etcdServer) Snapshot(req *etcdserverpb.SnapshotRequest, srv etcdserverpb.Maintenance_SnapshotServer) error {
+	for _, chunk := range []string{"snap", "shot"} {
+		if err := srv.Send(&etcdserverpb.SnapshotResponse{Header: &etcdserverpb.ResponseHeader{}, Blob: []byte(chunk)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newEtcdServer returns the address of a server holding a few keys.
+func newEtcdServer(t *testing.T) string {
+	s := &etcdServer{
+		t:    t,
+		keys: []string{"/app/db/host", "/app/db/port", "/app/name", "/app/name/x"},
+		values: map[string]string{
+			"/app/db/host": "db.example.org",
+			"/app/db/port": "5432",
+			"/app/name":    "shadowed",
+			"/app/name/x":  "x",
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	etcdserverpb.RegisterKVServer(server, s)
+	etcdserverpb.RegisterMaintenanceServer(server, s)
+	etcdserverpb.RegisterAuthServer(server, s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestEtcdImporter(t *testing.T) {
+	location := "etcd://" + newEtcdServer(t) + "/app"
+
+	imp, err := NewEtcdImporter(map[string]string{
+		"location": location,
+		"username": "root",
+		"password": "secret",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+	require.Equal(t, "etcd", imp.Type())
+
+	paths, errors, contents := scan(t, imp)
+	require.Equal(t, []string{"/", "/app", "/app/db", "/app/db/host", "/app/db/port", "/app/name", "/app/name/x"}, paths)
+	require.Equal(t, []string{"/app/name"}, errors)
+	require.Equal(t, "db.example.org", contents["/app/db/host"])
+	require.Equal(t, "5432", contents["/app/db/port"])
+	require.Equal(t, "x", contents["/app/name/x"])
+}
+
+func TestEtcdImporterSnapshot(t *testing.T) {
+	imp, err := NewEtcdImporter(map[string]string{
+		"location": "etcd://" + newEtcdServer(t),
+		"mode":     "snapshot",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	paths, errors, contents := scan(t, imp)
+	require.Equal(t, []string{"/", "/snapshot.db"}, paths)
+	require.Len(t, errors, 0)
+	require.Equal(t, "snapshot", contents["/snapshot.db"])
+}
+
+func TestConsulImporter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-Consul-Index", "1")
+		w.Header().Set("X-Consul-LastContact", "0")
+		w.Header().Set("X-Consul-KnownLeader", "true")
+		switch r.URL.Path {
+		case "/v1/kv/config":
+			require.True(t, r.URL.Query().Has("recurse"))
+			require.Equal(t, "dc2", r.URL.Query().Get("dc"))
+			fmt.Fprint(w, `[
+				{"Key":"config/","Value":null},
+				{"Key":"config/app/","Value":null},
+				{"Key":"config/app/debug","Value":"dHJ1ZQ=="},
+				{"Key":"config/empty/","Value":null},
+				{"Key":"config//odd","Value":"eA=="}
+			]`)
+		case "/v1/snapshot":
+			w.Write(bytes.Repeat([]byte{0x1f, 0x8b}, 10))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	location := strings.Replace(ts.URL, "http://", "consul://", 1) + "/config"
+	imp, err := NewConsulImporter(map[string]string{
+		"location":   location,
+		"token":      "secret",
+		"datacenter": "dc2",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+	require.Equal(t, "consul", imp.Type())
+
+	paths, errors, contents := scan(t, imp)
+	require.Equal(t, []string{"/", "/config", "/config/app", "/config/app/debug", "/config/empty"}, paths)
+	require.Equal(t, []string{"/config//odd"}, errors)
+	require.Equal(t, "true", contents["/config/app/debug"])
+
+	imp, err = NewConsulImporter(map[string]string{
+		"location": location,
+		"token":    "secret",
+		"mode":     "snapshot",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	paths, _, contents = scan(t, imp)
+	require.Equal(t, []string{"/", "/snapshot.tgz"}, paths)
+	require.Len(t, contents["/snapshot.tgz"], 20)
+}
+
+func TestNewKVImporterConfig(t *testing.T) {
+	_, err := NewEtcdImporter(map[string]string{"location": "etcd://host:2379", "mode": "dump"})
+	require.Error(t, err)
+
+	_, err = NewConsulImporter(map[string]string{"location": "etcd://host:2379"})
+	require.Error(t, err)
+
+	imp, err := NewConsulImporter(map[string]string{"location": "consuls://host:8501/"})
+	require.NoError(t, err)
+	require.Equal(t, "host:8501", imp.Origin())
+	require.Equal(t, "", imp.(*KVImporter).prefix)
+}
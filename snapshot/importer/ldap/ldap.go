@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	DEFAULT_FILTER    = "(objectClass=*)"
+	DEFAULT_PAGE_SIZE = 500
+)
+
+// ldapTimeout bounds every exchange with the server.
+const ldapTimeout = 2 * time.Minute
+
+// LDAPImporter exports the subtree below the base DN of its location as
+// a single LDIF file, /<base DN>.ldif, entries sorted so that the file
+// only changes when the directory does.
+type LDAPImporter struct {
+	scheme   string
+	host     string
+	insecure bool
+	baseDN   string
+	bindDN   string
+	password string
+
+	filter     string
+	attributes []string
+	excluded   map[string]struct{}
+	pageSize   uint32
+
+	filename string
+	export   string
+	size     int64
+}
+
+func init() {
+	importer.Register("ldap", NewLDAPImporter)
+}
+
+func NewLDAPImporter(config map[string]string) (importer.Importer, error) {
+	location := config["location"]
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &LDAPImporter{
+		baseDN:   strings.TrimPrefix(parsed.Path, "/"),
+		excluded: make(map[string]struct{}),
+		pageSize: DEFAULT_PAGE_SIZE,
+	}
+
+	port := "389"
+	switch parsed.Scheme {
+	case "ldap":
+	case "ldaps":
+		port = "636"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+	p.scheme = parsed.Scheme
+	p.host = parsed.Host
+	if parsed.Port() == "" {
+		p.host = net.JoinHostPort(parsed.Hostname(), port)
+	}
+
+	p.bindDN = config["bind_dn"]
+	p.password = config["password"]
+
+	p.filter = DEFAULT_FILTER
+	if value, ok := config["filter"]; ok {
+		p.filter = value
+	}
+	if _, err := goldap.CompileFilter(p.filter); err != nil {
+		return nil, err
+	}
+
+	if value, ok := config["attributes"]; ok {
+		for _, attribute := range strings.Split(value, ",") {
+			if attribute = strings.TrimSpace(attribute); attribute != "" {
+				p.attributes = append(p.attributes, attribute)
+			}
+		}
+	}
+	if value, ok := config["exclude_attributes"]; ok {
+		for _, attribute := range strings.Split(value, ",") {
+			if attribute = strings.TrimSpace(attribute); attribute != "" {
+				p.excluded[strings.ToLower(attribute)] = struct{}{}
+			}
+		}
+	}
+
+	if value, ok := config["page_size"]; ok {
+		pageSize, err := strconv.ParseUint(value, 10, 31)
+		if err != nil || pageSize == 0 {
+			return nil, fmt.Errorf("invalid page_size value")
+		}
+		p.pageSize = uint32(pageSize)
+	}
+	if value, ok := config["tls_insecure_skip_verify"]; ok {
+		if p.insecure, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid tls_insecure_skip_verify value")
+		}
+	}
+
+	name := strings.ReplaceAll(p.baseDN, "/", "_")
+	if name == "" {
+		name = "directory"
+	}
+	p.filename = "/" + name + ".ldif"
+
+	return p, nil
+}
+
+func (p *LDAPImporter) dial() (*goldap.Conn, error) {
+	host, _, _ := net.SplitHostPort(p.host)
+	conn, err := goldap.DialURL(p.scheme+"://"+p.host,
+		goldap.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}),
+		goldap.DialWithTLSConfig(&tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: p.insecure,
+		}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	return conn, nil
+}
+
+// exportLDIF runs the search and writes the sorted entries to a
+// temporary file.
+func (p *LDAPImporter) exportLDIF() error {
+	conn, err := p.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if p.bindDN != "" {
+		if err := conn.Bind(p.bindDN, p.password); err != nil {
+			return fmt.Errorf("bind failed: %w", err)
+		}
+	}
+
+	// referrals to other servers are not followed
+	request := goldap.NewSearchRequest(p.baseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		0, 0, false, p.filter, p.attributes, nil)
+	result, err := conn.SearchWithPaging(request, p.pageSize)
+	if err != nil {
+		return fmt.Errorf("search failed: %w", err)
+	}
+
+	records := make(map[string]string)
+	for _, e := range result.Entries {
+		records[dnSortKey(e.DN)] = ldifRecord(e, p.excluded)
+	}
+
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fp, err := os.CreateTemp("", "plakar-ldap-*.ldif")
+	if err != nil {
+		return err
+	}
+	p.export = fp.Name()
+
+	wr := bufio.NewWriter(fp)
+	wr.WriteString("version: 1\n\n")
+	for _, key := range keys {
+		wr.WriteString(records[key])
+	}
+	if err := wr.Flush(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(p.export)
+	if err != nil {
+		return err
+	}
+	p.size = fi.Size()
+	return nil
+}
+
+func (p *LDAPImporter) Scan() (<-chan *importer.ScanResult, error) {
+	if err := p.exportLDIF(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := make(chan *importer.ScanResult, 2)
+	results <- importer.NewScanRecord("/", "", objects.NewFileInfo("/", 0, 0700|os.ModeDir, now, 0, 1, 0, 0, 0), nil)
+	results <- importer.NewScanRecord(p.filename, "", objects.NewFileInfo(p.filename[1:], p.size, 0600, now, 1, 2, 0, 0, 0), nil)
+	close(results)
+	return results, nil
+}
+
+func (p *LDAPImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if pathname != p.filename || p.export == "" {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return os.Open(p.export)
+}
+
+func (p *LDAPImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on ldap")
+}
+
+func (p *LDAPImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on ldap")
+}
+
+func (p *LDAPImporter) Close() error {
+	if p.export != "" {
+		return os.Remove(p.export)
+	}
+	return nil
+}
+
+func (p *LDAPImporter) Root() string {
+	return "/"
+}
+
+func (p *LDAPImporter) Origin() string {
+	return p.host
+}
+
+func (p *LDAPImporter) Type() string {
+	return "ldap"
+}
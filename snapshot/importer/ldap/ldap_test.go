@@ -0,0 +1,235 @@
+package ldap
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLDAPImporterFilter(t *testing.T) {
+	for _, filter := range []string{"(&(objectClass=person)(!(uid=svc-*))(cn>=m))", "(mail=*)", `(cn=a\2ab)`} {
+		_, err := NewLDAPImporter(map[string]string{"location": "ldap://host/dc=example", "filter": filter})
+		require.NoError(t, err, filter)
+	}
+
+	for _, filter := range []string{"", "cn=a", "(cn=a", `(cn=\2)`} {
+		_, err := NewLDAPImporter(map[string]string{"location": "ldap://host/dc=example", "filter": filter})
+		require.Error(t, err, filter)
+	}
+}
+
+func TestLDIFRecord(t *testing.T) {
+	e := goldap.NewEntry("uid=alice,ou=people,dc=example,dc=org", nil)
+	e.Attributes = []*goldap.EntryAttribute{
+		goldap.NewEntryAttribute("uid", []string{"alice"}),
+		goldap.NewEntryAttribute("objectClass", []string{"person", "inetOrgPerson"}),
+		goldap.NewEntryAttribute("cn", []string{"Alice Émilie"}),
+		goldap.NewEntryAttribute("userPassword", []string{"{SSHA}secret"}),
+		goldap.NewEntryAttribute("description", []string{strings.Repeat("d", 100)}),
+	}
+
+	record := ldifRecord(e, map[string]struct{}{"userpassword": {}})
+	require.Equal(t, "dn: uid=alice,ou=people,dc=example,dc=org\n"+
+		"objectClass: inetOrgPerson\n"+
+		"objectClass: person\n"+
+		"cn:: QWxpY2Ugw4ltaWxpZQ==\n"+
+		"description: "+strings.Repeat("d", 63)+"\n "+strings.Repeat("d", 37)+"\n"+
+		"uid: alice\n"+
+		"\n", record)
+
+	require.True(t, ldifSafe("plain value"))
+	require.False(t, ldifSafe(" leading space"))
+	require.False(t, ldifSafe(":colon"))
+	require.False(t, ldifSafe("multi\nline"))
+}
+
+func TestDNSortKey(t *testing.T) {
+	dns := []string{
+		"uid=bob,ou=people,dc=example,dc=org",
+		"dc=example,dc=org",
+		"ou=people,dc=example,dc=org",
+		`cn=a\,b,dc=example,dc=org`,
+	}
+	require.Less(t, dnSortKey(dns[1]), dnSortKey(dns[2]))
+	require.Less(t, dnSortKey(dns[2]), dnSortKey(dns[0]))
+	require.Equal(t, []string{`cn=a\,b`, "dc=example", "dc=org"}, splitDN(dns[3]))
+}
+
+func ldapResult(tag ber.Tag, code int64) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return p
+}
+
+func ldapEntry(dn string, attributes ...string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for i := 0; i < len(attributes); i += 2 {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attributes[i], "Name"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attributes[i+1], "Value"))
+		attr.AppendChild(values)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+func pagingControl(cookie string) *ber.Packet {
+	return (&goldap.ControlPaging{Cookie: []byte(cookie)}).Encode()
+}
+
+// pagingCookie returns the cookie of the paging control of a request.
+func pagingCookie(msg *ber.Packet) string {
+	for _, control := range msg.Children[2].Children {
+		if control.Children[0].Value.(string) != goldap.ControlTypePaging {
+			continue
+		}
+		value := control.Children[len(control.Children)-1]
+		decoded, err := ber.DecodePacketErr(value.Data.Bytes())
+		if err != nil || len(decoded.Children) != 2 {
+			return ""
+		}
+		return decoded.Children[1].Data.String()
+	}
+	return ""
+}
+
+// serveLDAP answers a bind and a search paged in two pages.
+func serveLDAP(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	write := func(id int64, op *ber.Packet, controls ...*ber.Packet) {
+		msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+		msg.AppendChild(op)
+		if len(controls) != 0 {
+			ctrls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+			for _, control := range controls {
+				ctrls.AppendChild(control)
+			}
+			msg.AppendChild(ctrls)
+		}
+		conn.Write(msg.Bytes())
+	}
+
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id := msg.Children[0].Value.(int64)
+		op := msg.Children[1]
+
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			code := int64(goldap.LDAPResultSuccess)
+			if op.Children[1].Value.(string) != "cn=admin,dc=example,dc=org" || op.Children[2].Data.String() != "secret" {
+				code = goldap.LDAPResultInvalidCredentials
+			}
+			write(id, ldapResult(goldap.ApplicationBindResponse, code))
+
+		case goldap.ApplicationSearchRequest:
+			if pagingCookie(msg) == "" {
+				write(id, ldapEntry("ou=people,dc=example,dc=org", "objectClass", "organizationalUnit", "ou", "people"))
+				write(id, ldapEntry("uid=alice,ou=people,dc=example,dc=org", "objectClass", "person", "uid", "alice", "userPassword", "x"))
+				write(id, ldapResult(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess), pagingControl("page2"))
+			} else {
+				write(id, ldapEntry("dc=example,dc=org", "objectClass", "domain", "dc", "example"))
+				write(id, ldapResult(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess), pagingControl(""))
+			}
+
+		case goldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func newTestServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveLDAP(t, conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestLDAPImporter(t *testing.T) {
+	addr := newTestServer(t)
+
+	imp, err := NewLDAPImporter(map[string]string{
+		"location":           "ldap://" + addr + "/dc=example,dc=org",
+		"bind_dn":            "cn=admin,dc=example,dc=org",
+		"password":           "secret",
+		"exclude_attributes": "userPassword",
+		"page_size":          "2",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	require.Equal(t, "ldap", imp.Type())
+	require.Equal(t, addr, imp.Origin())
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+	paths := []string{}
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		paths = append(paths, record.Record.Pathname)
+	}
+	require.Equal(t, []string{"/", "/dc=example,dc=org.ldif"}, paths)
+
+	rd, err := imp.NewReader("/dc=example,dc=org.ldif")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	rd.Close()
+
+	require.Equal(t, "version: 1\n\n"+
+		"dn: dc=example,dc=org\nobjectClass: domain\ndc: example\n\n"+
+		"dn: ou=people,dc=example,dc=org\nobjectClass: organizationalUnit\nou: people\n\n"+
+		"dn: uid=alice,ou=people,dc=example,dc=org\nobjectClass: person\nuid: alice\n\n", string(data))
+}
+
+func TestLDAPImporterBindFailure(t *testing.T) {
+	addr := newTestServer(t)
+
+	imp, err := NewLDAPImporter(map[string]string{
+		"location": "ldap://" + addr + "/dc=example,dc=org",
+		"bind_dn":  "cn=admin,dc=example,dc=org",
+		"password": "wrong",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	_, err = imp.Scan()
+	require.ErrorContains(t, err, "bind failed")
+}
+
+func TestNewLDAPImporterConfig(t *testing.T) {
+	_, err := NewLDAPImporter(map[string]string{"location": "ldap://host/dc=example", "page_size": "zero"})
+	require.EqualError(t, err, "invalid page_size value")
+
+	_, err = NewLDAPImporter(map[string]string{"location": "ldap://host/dc=example", "filter": "(cn=a"})
+	require.Error(t, err)
+
+	imp, err := NewLDAPImporter(map[string]string{"location": "ldaps://host/dc=example"})
+	require.NoError(t, err)
+	require.Equal(t, "host:636", imp.Origin())
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ldap
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// LDIF_LINE_LENGTH is the length past which LDIF lines are folded.
+const LDIF_LINE_LENGTH = 76
+
+// ldifSafe tells if value can be written as is, RFC 2849 SAFE-STRING.
+func ldifSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+	if value[0] == ' ' || value[0] == ':' || value[0] == '<' || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// ldifLine formats an attribute line, folded at LDIF_LINE_LENGTH.
+func ldifLine(sb *strings.Builder, name string, value string) {
+	line := name + ": " + value
+	if !ldifSafe(value) {
+		line = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	for len(line) > LDIF_LINE_LENGTH {
+		// don't split UTF-8 sequences, which only appear in names
+		cut := LDIF_LINE_LENGTH
+		for cut > 1 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		sb.WriteString(line[:cut])
+		sb.WriteString("\n ")
+		line = line[cut:]
+	}
+	sb.WriteString(line)
+	sb.WriteString("\n")
+}
+
+// ldifRecord formats an entry with its attributes sorted by name and
+// their values sorted, so that unchanged entries always produce the same
+// record.  Excluded attributes are left out.
+func ldifRecord(e *goldap.Entry, excluded map[string]struct{}) string {
+	values := make(map[string][]string, len(e.Attributes))
+	names := make([]string, 0, len(e.Attributes))
+	for _, attribute := range e.Attributes {
+		if _, skip := excluded[strings.ToLower(attribute.Name)]; skip {
+			continue
+		}
+		if _, exists := values[attribute.Name]; !exists {
+			names = append(names, attribute.Name)
+		}
+		values[attribute.Name] = append(values[attribute.Name], attribute.Values...)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// objectClass first, as is customary
+		if isObjectClass(names[i]) != isObjectClass(names[j]) {
+			return isObjectClass(names[i])
+		}
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	var sb strings.Builder
+	ldifLine(&sb, "dn", e.DN)
+	for _, name := range names {
+		sort.Strings(values[name])
+		for _, value := range values[name] {
+			ldifLine(&sb, name, value)
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func isObjectClass(name string) bool {
+	return strings.EqualFold(name, "objectClass")
+}
+
+// splitDN splits a DN in its RDNs, honouring escaped commas.
+func splitDN(dn string) []string {
+	rdns := []string{}
+	start := 0
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',':
+			rdns = append(rdns, strings.TrimSpace(dn[start:i]))
+			start = i + 1
+		}
+	}
+	return append(rdns, strings.TrimSpace(dn[start:]))
+}
+
+// dnSortKey orders entries so that parents come before their children,
+// which is the order an LDIF file must have to be imported back.
+func dnSortKey(dn string) string {
+	rdns := splitDN(strings.ToLower(dn))
+	for i, j := 0, len(rdns)-1; i < j; i, j = i+1, j-1 {
+		rdns[i], rdns[j] = rdns[j], rdns[i]
+	}
+	return strings.Join(rdns, "\x00")
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package mongodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// describeScript lists the databases and collections of the server, with
+// the metadata mongorestore expects next to each dump, as a single JSON
+// document.
+const describeScript = `
+const conn = connect(%q);
+const admin = conn.getSiblingDB("admin");
+const only = %q;
+const out = {version: admin.version(), databases: {}};
+for (const d of admin.adminCommand({listDatabases: 1, nameOnly: true}).databases) {
+	if (only !== "" ? d.name !== only : ["local", "config"].includes(d.name)) {
+		continue;
+	}
+	const database = conn.getSiblingDB(d.name);
+	const collections = {};
+	for (const c of database.getCollectionInfos({type: "collection"})) {
+		collections[c.name] = EJSON.stringify({
+			collectionName: c.name,
+			type: "collection",
+			options: c.options,
+			indexes: database.getCollection(c.name).getIndexes(),
+			uuid: c.info && c.info.uuid ? c.info.uuid.toString("hex") : "",
+		}, {relaxed: false});
+	}
+	out.databases[d.name] = collections;
+}
+print(JSON.stringify(out));
+`
+
+// MongoImporter stores each collection of a server as a BSON dump made by
+// mongodump, /<database>/<collection>.bson, next to its options and
+// indexes, /<database>/<collection>.metadata.json, the layout expected by
+// mongorestore.  The local and config databases are left out, and only
+// the database of the location is dumped if it names one but admin.
+//
+// Collections are dumped one after the other and are not consistent with
+// each other.  The dumps are spooled to a temporary file during the scan
+// so their sizes are known upfront.
+type MongoImporter struct {
+	location *url.URL
+	host     string
+	database string
+	bindir   string
+
+	// credentials holds the connection string for the tools, in a file
+	// so that the password doesn't show in their arguments
+	credentials string
+	server      *server
+
+	spool   *os.File
+	offset  int64
+	entries map[string]*io.SectionReader
+	dirs    map[string]struct{}
+	errors  map[string]error
+}
+
+// server is the description of the server returned by describeScript,
+// collections mapping to their metadata.
+type server struct {
+	Version   string                       `json:"version"`
+	Databases map[string]map[string]string `json:"databases"`
+}
+
+func init() {
+	importer.Register("mongodb", NewMongoImporter)
+}
+
+func NewMongoImporter(config map[string]string) (importer.Importer, error) {
+	parsed, err := url.Parse(config["location"])
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "mongodb" && parsed.Scheme != "mongodb+srv" {
+		return nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+
+	p := &MongoImporter{
+		host:     parsed.Host,
+		database: strings.Trim(parsed.Path, "/"),
+		entries:  make(map[string]*io.SectionReader),
+		dirs:     make(map[string]struct{}),
+		errors:   make(map[string]error),
+	}
+
+	username, password := "", ""
+	if parsed.User != nil {
+		username = parsed.User.Username()
+		password, _ = parsed.User.Password()
+	}
+	if value, ok := config["username"]; ok {
+		username = value
+	}
+	if value, ok := config["password"]; ok {
+		password = value
+	}
+	if username != "" {
+		parsed.User = url.UserPassword(username, password)
+	}
+
+	// the database of the location is where users authenticate unless
+	// told otherwise, it must be kept once the path is dropped
+	query := parsed.Query()
+	if p.database != "" && query.Get("authSource") == "" && username != "" {
+		query.Set("authSource", p.database)
+	}
+	parsed.RawQuery = query.Encode()
+	parsed.Path = "/"
+	p.location = parsed
+
+	// admin is where administrators authenticate, naming it doesn't
+	// restrict the backup to it
+	if p.database == "admin" {
+		p.database = ""
+	}
+
+	if value, ok := config["bindir"]; ok {
+		p.bindir = value
+	}
+
+	return p, nil
+}
+
+func (p *MongoImporter) command(name string, args ...string) *exec.Cmd {
+	if p.bindir != "" {
+		name = filepath.Join(p.bindir, name)
+	}
+	return exec.Command(name, args...)
+}
+
+// run runs a tool, its output being written to w, and reports its error
+// output if it fails.
+func (p *MongoImporter) run(w io.Writer, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := p.command(name, args...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// writeSecret writes data to a temporary file only readable by us.
+func writeSecret(pattern string, data string) (string, error) {
+	fp, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	if err := fp.Chmod(0600); err != nil {
+		os.Remove(fp.Name())
+		return "", err
+	}
+	if _, err := fp.WriteString(data); err != nil {
+		os.Remove(fp.Name())
+		return "", err
+	}
+	return fp.Name(), nil
+}
+
+// describe lists the collections of the server, once.
+func (p *MongoImporter) describe() (*server, error) {
+	if p.server != nil {
+		return p.server, nil
+	}
+
+	script, err := writeSecret("plakar-mongodb-*.js", fmt.Sprintf(describeScript, p.location.String(), p.database))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(script)
+
+	var stdout bytes.Buffer
+	if err := p.run(&stdout, "mongosh", "--nodb", "--quiet", "--file", script); err != nil {
+		return nil, err
+	}
+
+	var srv server
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &srv); err != nil {
+		return nil, fmt.Errorf("mongosh: unexpected server description: %w", err)
+	}
+	if p.database != "" {
+		if _, ok := srv.Databases[p.database]; !ok {
+			return nil, fmt.Errorf("database %s not found", p.database)
+		}
+	}
+	p.server = &srv
+	return p.server, nil
+}
+
+// Tags describes the server the dumps were taken from.
+func (p *MongoImporter) Tags() ([]string, error) {
+	srv, err := p.describe()
+	if err != nil {
+		return nil, err
+	}
+	return []string{"mongodb_version=" + srv.Version}, nil
+}
+
+// validName reports whether a database or collection name can be used
+// as a path component.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// spoolFile runs dump, its output being stored as pathname.
+func (p *MongoImporter) spoolFile(pathname string, dump func(w io.Writer) error) error {
+	if err := dump(p.spool); err != nil {
+		// drop the partial output, the next dump overwrites it
+		if _, serr := p.spool.Seek(p.offset, io.SeekStart); serr != nil {
+			return serr
+		}
+		if terr := p.spool.Truncate(p.offset); terr != nil {
+			return terr
+		}
+		p.errors[pathname] = err
+		return nil
+	}
+
+	offset, err := p.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	p.entries[pathname] = io.NewSectionReader(p.spool, p.offset, offset-p.offset)
+	p.offset = offset
+	for dir := path.Dir(pathname); dir != "/"; dir = path.Dir(dir) {
+		p.dirs[dir] = struct{}{}
+	}
+	return nil
+}
+
+func (p *MongoImporter) Scan() (<-chan *importer.ScanResult, error) {
+	srv, err := p.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := writeSecret("plakar-mongodb-*.yaml", fmt.Sprintf("uri: %q\n", p.location.String()))
+	if err != nil {
+		return nil, err
+	}
+	p.credentials = credentials
+
+	fp, err := os.CreateTemp("", "plakar-mongodb-*")
+	if err != nil {
+		return nil, err
+	}
+	p.spool = fp
+
+	databases := make([]string, 0, len(srv.Databases))
+	for database := range srv.Databases {
+		databases = append(databases, database)
+	}
+	sort.Strings(databases)
+
+	for _, database := range databases {
+		collections := make([]string, 0, len(srv.Databases[database]))
+		for collection := range srv.Databases[database] {
+			collections = append(collections, collection)
+		}
+		sort.Strings(collections)
+
+		for _, collection := range collections {
+			prefix := "/" + database + "/" + collection
+			if !validName(database) || !validName(collection) {
+				p.errors[prefix+".bson"] = fmt.Errorf("collection %s.%s can't be stored as a file", database, collection)
+				continue
+			}
+
+			err := p.spoolFile(prefix+".bson", func(w io.Writer) error {
+				return p.run(w, "mongodump", "--config="+p.credentials, "--quiet",
+					"--db="+database, "--collection="+collection, "--out=-")
+			})
+			if err != nil {
+				return nil, err
+			}
+			if _, failed := p.errors[prefix+".bson"]; failed {
+				continue
+			}
+
+			metadata := srv.Databases[database][collection]
+			err = p.spoolFile(prefix+".metadata.json", func(w io.Writer) error {
+				_, err := io.WriteString(w, metadata)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pathnames := make([]string, 0, len(p.entries))
+	for pathname := range p.entries {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+
+		now := time.Now()
+		ino := uint64(0)
+		newFileInfo := func(name string, size int64, mode os.FileMode) objects.FileInfo {
+			ino++
+			nlink := uint64(1)
+			if mode.IsDir() {
+				nlink = 0
+			}
+			return objects.NewFileInfo(name, size, mode, now, nlink, ino, 0, 0, 0)
+		}
+
+		results <- importer.NewScanRecord("/", "", newFileInfo("/", 0, 0700|os.ModeDir), nil)
+		for _, dir := range dirs {
+			results <- importer.NewScanRecord(dir, "", newFileInfo(path.Base(dir), 0, 0700|os.ModeDir), nil)
+		}
+		for _, pathname := range pathnames {
+			results <- importer.NewScanRecord(pathname, "", newFileInfo(path.Base(pathname), p.entries[pathname].Size(), 0600), nil)
+		}
+		for pathname, err := range p.errors {
+			results <- importer.NewScanError(pathname, err)
+		}
+	}()
+	return results, nil
+}
+
+func (p *MongoImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	entry, ok := p.entries[pathname]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(entry, 0, entry.Size())), nil
+}
+
+func (p *MongoImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on mongodb")
+}
+
+func (p *MongoImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on mongodb")
+}
+
+func (p *MongoImporter) Close() error {
+	if p.credentials != "" {
+		os.Remove(p.credentials)
+		p.credentials = ""
+	}
+	if p.spool == nil {
+		return nil
+	}
+	p.spool.Close()
+	return os.Remove(p.spool.Name())
+}
+
+func (p *MongoImporter) Root() string {
+	return "/"
+}
+
+func (p *MongoImporter) Origin() string {
+	return p.host
+}
+
+func (p *MongoImporter) Type() string {
+	return "mongodb"
+}
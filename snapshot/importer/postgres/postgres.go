@@ -0,0 +1,462 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+const (
+	MODE_DATABASE = "database"
+	MODE_TABLE    = "table"
+
+	FORMAT_PLAIN  = "plain"
+	FORMAT_CUSTOM = "custom"
+
+	MAINTENANCE_DATABASE = "postgres"
+)
+
+// PostgresImporter stores the output of pg_dump for each database of a
+// server, or for the database of its location.
+//
+// In database mode, the default, each database is dumped as a single
+// file, /<database>.sql.  In table mode, the schema of each database is
+// dumped as /<database>/schema.sql and the data of each table as
+// /<database>/<schema>/<table>.sql, all from a snapshot exported by a
+// transaction held open during the scan, so that the tables of a
+// database are consistent with each other.  The dumps are spooled to a
+// temporary file during the scan so their sizes are known upfront.
+type PostgresImporter struct {
+	location  *url.URL
+	password  string
+	databases []string
+	mode      string
+	format    string
+	globals   bool
+	bindir    string
+
+	spool   *os.File
+	offset  int64
+	entries map[string]*io.SectionReader
+	dirs    map[string]struct{}
+	errors  map[string]error
+}
+
+func init() {
+	importer.Register("postgres", NewPostgresImporter)
+}
+
+func NewPostgresImporter(config map[string]string) (importer.Importer, error) {
+	parsed, err := url.Parse(config["location"])
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "postgres" && parsed.Scheme != "postgresql" {
+		return nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+
+	p := &PostgresImporter{
+		mode:    MODE_DATABASE,
+		format:  FORMAT_PLAIN,
+		entries: make(map[string]*io.SectionReader),
+		dirs:    make(map[string]struct{}),
+		errors:  make(map[string]error),
+	}
+
+	// the password is handed to the tools through the environment, so
+	// that it doesn't show in their arguments
+	if parsed.User != nil {
+		p.password, _ = parsed.User.Password()
+		parsed.User = url.User(parsed.User.Username())
+	}
+	if value, ok := config["username"]; ok {
+		parsed.User = url.User(value)
+	}
+	if value, ok := config["password"]; ok {
+		p.password = value
+	}
+
+	if database := strings.Trim(parsed.Path, "/"); database != "" {
+		p.databases = []string{database}
+	}
+	parsed.Path = ""
+	p.location = parsed
+
+	if value, ok := config["mode"]; ok {
+		if value != MODE_DATABASE && value != MODE_TABLE {
+			return nil, fmt.Errorf("invalid mode value %q", value)
+		}
+		p.mode = value
+	}
+	if value, ok := config["format"]; ok {
+		if value != FORMAT_PLAIN && value != FORMAT_CUSTOM {
+			return nil, fmt.Errorf("invalid format value %q", value)
+		}
+		p.format = value
+	}
+	if value, ok := config["globals"]; ok {
+		globals, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid globals value")
+		}
+		p.globals = globals
+	}
+	if value, ok := config["bindir"]; ok {
+		p.bindir = value
+	}
+
+	return p, nil
+}
+
+// dsn returns the connection string of a database of the server.
+func (p *PostgresImporter) dsn(database string) string {
+	location := *p.location
+	location.Path = "/" + database
+	return location.String()
+}
+
+func (p *PostgresImporter) command(name string, args ...string) *exec.Cmd {
+	if p.bindir != "" {
+		name = filepath.Join(p.bindir, name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Env = os.Environ()
+	if p.password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+p.password)
+	}
+	return cmd
+}
+
+// run runs a tool, its output being written to w, and reports its error
+// output if it fails.
+func (p *PostgresImporter) run(w io.Writer, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := p.command(name, args...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// query returns the rows of a query, one value per line.
+func (p *PostgresImporter) query(database string, query string) ([]string, error) {
+	var stdout bytes.Buffer
+	err := p.run(&stdout, "psql", "-X", "-A", "-t", "-q", "-v", "ON_ERROR_STOP=1", "--dbname="+p.dsn(database), "-c", query)
+	if err != nil {
+		return nil, err
+	}
+	output := strings.TrimRight(stdout.String(), "\n")
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+// Tags describes the server the dumps were taken from.
+func (p *PostgresImporter) Tags() ([]string, error) {
+	database := MAINTENANCE_DATABASE
+	if len(p.databases) != 0 {
+		database = p.databases[0]
+	}
+	rows, err := p.query(database, "SHOW server_version; SHOW server_version_num; SELECT CASE WHEN pg_is_in_recovery() THEN 'standby' ELSE 'primary' END")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 3 || strings.TrimSpace(rows[0]) == "" {
+		return nil, fmt.Errorf("unexpected server description %q", rows)
+	}
+	return []string{
+		"postgres_version=" + strings.Fields(rows[0])[0],
+		"postgres_version_num=" + rows[1],
+		"postgres_role=" + rows[2],
+	}, nil
+}
+
+// validName reports whether a database, schema or table name can be
+// used as a path component.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// spoolFile runs dump, its output being stored as pathname.
+func (p *PostgresImporter) spoolFile(pathname string, dump func(w io.Writer) error) error {
+	if err := dump(p.spool); err != nil {
+		// drop the partial output, the next dump overwrites it
+		if _, serr := p.spool.Seek(p.offset, io.SeekStart); serr != nil {
+			return serr
+		}
+		if terr := p.spool.Truncate(p.offset); terr != nil {
+			return terr
+		}
+		p.errors[pathname] = err
+		return nil
+	}
+
+	offset, err := p.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	p.entries[pathname] = io.NewSectionReader(p.spool, p.offset, offset-p.offset)
+	p.offset = offset
+	for dir := path.Dir(pathname); dir != "/"; dir = path.Dir(dir) {
+		p.dirs[dir] = struct{}{}
+	}
+	return nil
+}
+
+func (p *PostgresImporter) dumpArgs(database string, args ...string) []string {
+	args = append(args, "--no-password", "--dbname="+p.dsn(database))
+	if p.format == FORMAT_CUSTOM {
+		// uncompressed so that unchanged data deduplicates across runs
+		args = append(args, "--format=custom", "--compress=0")
+	}
+	return args
+}
+
+func (p *PostgresImporter) extension() string {
+	if p.format == FORMAT_CUSTOM {
+		return ".dump"
+	}
+	return ".sql"
+}
+
+func (p *PostgresImporter) spoolDatabase(database string) error {
+	return p.spoolFile("/"+database+p.extension(), func(w io.Writer) error {
+		return p.run(w, "pg_dump", p.dumpArgs(database)...)
+	})
+}
+
+// quoteIdent quotes a name for a pg_dump pattern, so that it matches the
+// name exactly.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// spoolTables dumps the schema and each table of a database from the
+// same snapshot, exported by a transaction held open meanwhile.
+func (p *PostgresImporter) spoolTables(database string) error {
+	cmd := p.command("psql", "-X", "-A", "-t", "-q", "-v", "ON_ERROR_STOP=1", "--dbname="+p.dsn(database))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("psql: %w", err)
+	}
+	defer func() {
+		stdin.Close()
+		cmd.Wait()
+	}()
+
+	fmt.Fprintln(stdin, "BEGIN TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY;")
+	fmt.Fprintln(stdin, "SELECT pg_export_snapshot();")
+	fmt.Fprintln(stdin, "SELECT coalesce(jsonb_agg(jsonb_build_array(schemaname, tablename) ORDER BY schemaname, tablename), '[]'::jsonb) FROM pg_tables WHERE schemaname NOT IN ('pg_catalog', 'information_schema');")
+
+	rd := bufio.NewReader(stdout)
+	readLine := func() (string, error) {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("psql: %s", msg)
+			}
+			return "", fmt.Errorf("psql: %w", err)
+		}
+		return strings.TrimRight(line, "\n"), nil
+	}
+
+	snapshotID, err := readLine()
+	if err != nil {
+		return err
+	}
+	line, err := readLine()
+	if err != nil {
+		return err
+	}
+	var tables [][2]string
+	if err := json.Unmarshal([]byte(line), &tables); err != nil {
+		return fmt.Errorf("psql: unexpected table list: %w", err)
+	}
+
+	prefix := "/" + database
+	err = p.spoolFile(prefix+"/schema"+p.extension(), func(w io.Writer) error {
+		return p.run(w, "pg_dump", p.dumpArgs(database, "--snapshot="+snapshotID, "--schema-only")...)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		pathname := prefix + "/" + table[0] + "/" + table[1] + p.extension()
+		if !validName(table[0]) || !validName(table[1]) {
+			p.errors[pathname] = fmt.Errorf("table %s.%s can't be stored as a file, use mode %s", table[0], table[1], MODE_DATABASE)
+			continue
+		}
+		pattern := quoteIdent(table[0]) + "." + quoteIdent(table[1])
+		err := p.spoolFile(pathname, func(w io.Writer) error {
+			return p.run(w, "pg_dump", p.dumpArgs(database, "--snapshot="+snapshotID, "--data-only", "--table="+pattern)...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(stdin, "COMMIT;")
+	return nil
+}
+
+func (p *PostgresImporter) Scan() (<-chan *importer.ScanResult, error) {
+	if len(p.databases) == 0 {
+		databases, err := p.query(MAINTENANCE_DATABASE, "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname")
+		if err != nil {
+			return nil, err
+		}
+		p.databases = databases
+	}
+
+	fp, err := os.CreateTemp("", "plakar-postgres-*")
+	if err != nil {
+		return nil, err
+	}
+	p.spool = fp
+
+	if p.globals {
+		err := p.spoolFile("/globals.sql", func(w io.Writer) error {
+			return p.run(w, "pg_dumpall", "--globals-only", "--no-password", "--dbname="+p.dsn(MAINTENANCE_DATABASE))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, database := range p.databases {
+		if !validName(database) {
+			p.errors["/"+database] = fmt.Errorf("database %q can't be stored as a file", database)
+			continue
+		}
+		if p.mode == MODE_TABLE {
+			err = p.spoolTables(database)
+		} else {
+			err = p.spoolDatabase(database)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pathnames := make([]string, 0, len(p.entries))
+	for pathname := range p.entries {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+
+		now := time.Now()
+		ino := uint64(0)
+		newFileInfo := func(name string, size int64, mode os.FileMode) objects.FileInfo {
+			ino++
+			nlink := uint64(1)
+			if mode.IsDir() {
+				nlink = 0
+			}
+			return objects.NewFileInfo(name, size, mode, now, nlink, ino, 0, 0, 0)
+		}
+
+		results <- importer.NewScanRecord("/", "", newFileInfo("/", 0, 0700|os.ModeDir), nil)
+		for _, dir := range dirs {
+			results <- importer.NewScanRecord(dir, "", newFileInfo(path.Base(dir), 0, 0700|os.ModeDir), nil)
+		}
+		for _, pathname := range pathnames {
+			results <- importer.NewScanRecord(pathname, "", newFileInfo(path.Base(pathname), p.entries[pathname].Size(), 0600), nil)
+		}
+		for pathname, err := range p.errors {
+			results <- importer.NewScanError(pathname, err)
+		}
+	}()
+	return results, nil
+}
+
+func (p *PostgresImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	entry, ok := p.entries[pathname]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(entry, 0, entry.Size())), nil
+}
+
+func (p *PostgresImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on postgres")
+}
+
+func (p *PostgresImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on postgres")
+}
+
+func (p *PostgresImporter) Close() error {
+	if p.spool == nil {
+		return nil
+	}
+	p.spool.Close()
+	return os.Remove(p.spool.Name())
+}
+
+func (p *PostgresImporter) Root() string {
+	return "/"
+}
+
+func (p *PostgresImporter) Origin() string {
+	return p.location.Host
+}
+
+func (p *PostgresImporter) Type() string {
+	return "postgres"
+}
@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	MODE_REPLICATION = "replication"
+	MODE_BGSAVE      = "bgsave"
+
+	DEFAULT_PORT = "6379"
+	RDB_NAME     = "dump.rdb"
+)
+
+// BGSAVE_POLL_INTERVAL is how often the server is polled for the end of
+// a background save.
+var BGSAVE_POLL_INTERVAL = time.Second
+
+// RedisImporter stores a point-in-time RDB dump of a server as /dump.rdb.
+//
+// In replication mode, the default, it registers as a replica and reads
+// the dump the server produces for a full resynchronization, which works
+// remotely but requires the permissions of a replica.  In bgsave mode it
+// triggers a BGSAVE and reads the resulting file, which requires running
+// on the host of the server.
+type RedisImporter struct {
+	host      string
+	username  string
+	password  string
+	mode      string
+	tlsConfig *tls.Config
+
+	// rdb holds the dump, a spooled replication stream or the file
+	// written by the server
+	rdb  *os.File
+	size int64
+	temp bool
+}
+
+func init() {
+	importer.Register("redis", NewRedisImporter)
+}
+
+func NewRedisImporter(config map[string]string) (importer.Importer, error) {
+	parsed, err := url.Parse(config["location"])
+	if err != nil {
+		return nil, err
+	}
+
+	p := &RedisImporter{
+		host: parsed.Host,
+		mode: MODE_REPLICATION,
+	}
+
+	switch parsed.Scheme {
+	case "redis":
+	case "rediss":
+		p.tlsConfig = &tls.Config{}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s", parsed.Scheme)
+	}
+	if parsed.Port() == "" {
+		p.host = net.JoinHostPort(parsed.Hostname(), DEFAULT_PORT)
+	}
+	if p.tlsConfig != nil {
+		p.tlsConfig.ServerName = parsed.Hostname()
+		if value, ok := config["tls_insecure_skip_verify"]; ok {
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tls_insecure_skip_verify value")
+			}
+			p.tlsConfig.InsecureSkipVerify = insecure
+		}
+	}
+
+	if parsed.User != nil {
+		p.username = parsed.User.Username()
+		p.password, _ = parsed.User.Password()
+	}
+	if value, ok := config["username"]; ok {
+		p.username = value
+	}
+	if value, ok := config["password"]; ok {
+		p.password = value
+	}
+
+	if value, ok := config["mode"]; ok {
+		if value != MODE_REPLICATION && value != MODE_BGSAVE {
+			return nil, fmt.Errorf("invalid mode value %q", value)
+		}
+		p.mode = value
+	}
+
+	return p, nil
+}
+
+func (p *RedisImporter) options() *redis.Options {
+	return &redis.Options{
+		Addr:      p.host,
+		Username:  p.username,
+		Password:  p.password,
+		TLSConfig: p.tlsConfig,
+
+		// the replication handshake is only specified over RESP2
+		Protocol:        2,
+		DisableIdentity: true,
+		DialTimeout:     10 * time.Second,
+		MaxRetries:      -1,
+		PoolSize:        1,
+	}
+}
+
+// connect returns a client once it is authenticated, all of its commands
+// going through the same connection.
+func connect(opts *redis.Options) (*redis.Client, error) {
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		var serverError redis.Error
+		if errors.As(err, &serverError) {
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+// Tags describes the server the dump was taken from.
+func (p *RedisImporter) Tags() ([]string, error) {
+	client, err := connect(p.options())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	info, err := client.InfoMap(context.Background(), "default").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, field := range []struct{ tag, section, key string }{
+		{"redis_version", "Server", "redis_version"},
+		{"redis_mode", "Server", "redis_mode"},
+		{"redis_role", "Replication", "role"},
+	} {
+		if value := info[field.section][field.key]; value != "" {
+			tags = append(tags, field.tag+"="+value)
+		}
+	}
+	return tags, nil
+}
+
+// replicaLink hands the connection to the client one line at a time, so
+// that it never buffers past the reply to PSYNC: the dump that follows
+// isn't a RESP reply and is read from rd instead.
+type replicaLink struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+func (l *replicaLink) Read(b []byte) (int, error) {
+	if l.rd.Buffered() == 0 {
+		if _, err := l.rd.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+	data, _ := l.rd.Peek(l.rd.Buffered())
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i+1]
+	}
+	return l.rd.Discard(copy(b, data))
+}
+
+func (l *replicaLink) readLine() (string, error) {
+	line, err := l.rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// replicate spools the dump sent by the server to a new replica.
+func (p *RedisImporter) replicate() error {
+	var link *replicaLink
+
+	opts := p.options()
+	dial := redis.NewDialer(opts)
+	opts.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		link = &replicaLink{Conn: c, rd: bufio.NewReader(c)}
+		return link, nil
+	}
+
+	client, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	reply, err := client.Do(context.Background(), "PSYNC", "?", "-1").Text()
+	if err != nil {
+		return fmt.Errorf("replication failed: %w", err)
+	}
+	if !strings.HasPrefix(reply, "FULLRESYNC ") {
+		return fmt.Errorf("replication failed: unexpected reply %q", reply)
+	}
+
+	// the client is done with the connection, the dump may take longer
+	// than its read timeout to be ready
+	if err := link.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	// the server sends newlines to keep the link alive until the dump
+	// is ready, then its size as a bulk string header
+	var header string
+	for header == "" {
+		if header, err = link.readLine(); err != nil {
+			return fmt.Errorf("replication failed: %w", err)
+		}
+	}
+	if strings.HasPrefix(header, "-") {
+		return fmt.Errorf("replication failed: %s", header[1:])
+	}
+	if !strings.HasPrefix(header, "$") || strings.HasPrefix(header, "$EOF:") {
+		return fmt.Errorf("replication failed: unexpected header %q", header)
+	}
+	size, err := strconv.ParseInt(header[1:], 10, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("replication failed: invalid dump size %q", header[1:])
+	}
+
+	fp, err := os.CreateTemp("", "plakar-redis-*")
+	if err != nil {
+		return err
+	}
+	p.rdb, p.size, p.temp = fp, size, true
+
+	if _, err := io.CopyN(fp, link.rd, size); err != nil {
+		return fmt.Errorf("replication failed: %w", err)
+	}
+	return nil
+}
+
+// waitBgsave waits for the background save in progress, if any, and
+// returns the status of the last one.
+func waitBgsave(client *redis.Client) (string, error) {
+	for {
+		info, err := client.InfoMap(context.Background(), "persistence").Result()
+		if err != nil {
+			return "", err
+		}
+		if info["Persistence"]["rdb_bgsave_in_progress"] != "1" {
+			return info["Persistence"]["rdb_last_bgsave_status"], nil
+		}
+		time.Sleep(BGSAVE_POLL_INTERVAL)
+	}
+}
+
+// configGet returns the value of a configuration parameter.
+func configGet(client *redis.Client, parameter string) (string, error) {
+	values, err := client.ConfigGet(context.Background(), parameter).Result()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[parameter]
+	if !ok {
+		return "", fmt.Errorf("CONFIG GET %s: no such parameter", parameter)
+	}
+	return value, nil
+}
+
+// bgsave triggers a background save and opens the file it produced.
+func (p *RedisImporter) bgsave() error {
+	client, err := connect(p.options())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	dir, err := configGet(client, "dir")
+	if err != nil {
+		return err
+	}
+	dbfilename, err := configGet(client, "dbfilename")
+	if err != nil {
+		return err
+	}
+
+	// a save started before us may not hold the latest writes
+	if _, err := waitBgsave(client); err != nil {
+		return err
+	}
+	if err := client.BgSave(context.Background()).Err(); err != nil {
+		return fmt.Errorf("BGSAVE failed: %w", err)
+	}
+	status, err := waitBgsave(client)
+	if err != nil {
+		return err
+	}
+	if status != "ok" {
+		return fmt.Errorf("BGSAVE failed: status %s", status)
+	}
+
+	// the server renames a complete dump over the previous one, the
+	// file opened here is not affected by later saves
+	fp, err := os.Open(filepath.Join(dir, dbfilename))
+	if err != nil {
+		return fmt.Errorf("%w, use mode %s to back up a remote server", err, MODE_REPLICATION)
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	p.rdb, p.size = fp, info.Size()
+	return nil
+}
+
+func (p *RedisImporter) Scan() (<-chan *importer.ScanResult, error) {
+	var err error
+	if p.mode == MODE_BGSAVE {
+		err = p.bgsave()
+	} else {
+		err = p.replicate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan *importer.ScanResult, 2)
+	now := time.Now()
+	results <- importer.NewScanRecord("/", "", objects.NewFileInfo("/", 0, 0700|os.ModeDir, now, 0, 1, 0, 0, 0), nil)
+	results <- importer.NewScanRecord("/"+RDB_NAME, "", objects.NewFileInfo(RDB_NAME, p.size, 0600, now, 1, 2, 0, 0, 0), nil)
+	close(results)
+	return results, nil
+}
+
+func (p *RedisImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if pathname != "/"+RDB_NAME || p.rdb == nil {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(p.rdb, 0, p.size)), nil
+}
+
+func (p *RedisImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on redis")
+}
+
+func (p *RedisImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on redis")
+}
+
+func (p *RedisImporter) Close() error {
+	if p.rdb == nil {
+		return nil
+	}
+	err := p.rdb.Close()
+	if p.temp {
+		err = errors.Join(err, os.Remove(p.rdb.Name()))
+	}
+	return err
+}
+
+func (p *RedisImporter) Root() string {
+	return "/"
+}
+
+func (p *RedisImporter) Origin() string {
+	return p.host
+}
+
+func (p *RedisImporter) Type() string {
+	return "redis"
+}
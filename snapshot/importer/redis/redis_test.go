@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/redcon"
+)
+
+// session is the state of a connection to the fake server.
+type session struct {
+	authenticated bool
+	saving        int
+}
+
+// fakeServer answers the commands used by the importer, dir being where
+// BGSAVE writes the dump.
+func fakeServer(t *testing.T, dir string, rdb string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	accept := func(c redcon.Conn) bool {
+		c.SetContext(&session{})
+		return true
+	}
+	go redcon.Serve(ln, func(c redcon.Conn, cmd redcon.Command) {
+		serve(c, cmd, dir, rdb)
+	}, accept, nil)
+	return ln.Addr().String()
+}
+
+func serve(c redcon.Conn, cmd redcon.Command, dir string, rdb string) {
+	s := c.Context().(*session)
+	args := []string{}
+	for _, arg := range cmd.Args {
+		args = append(args, string(arg))
+	}
+	name := strings.ToUpper(args[0])
+
+	if name != "AUTH" && !s.authenticated {
+		c.WriteError("NOAUTH Authentication required.")
+		return
+	}
+
+	switch name {
+	case "AUTH":
+		s.authenticated = len(args) == 3 && args[1] == "backup" && args[2] == "secret"
+		if !s.authenticated {
+			c.WriteError("WRONGPASS invalid username-password pair")
+			return
+		}
+		c.WriteString("OK")
+	case "PING":
+		c.WriteString("PONG")
+	case "INFO":
+		if len(args) == 2 && args[1] == "persistence" {
+			c.WriteBulkString(fmt.Sprintf("# Persistence\r\nrdb_bgsave_in_progress:%d\r\nrdb_last_bgsave_status:ok\r\n", min(s.saving, 1)))
+			if s.saving > 0 {
+				s.saving--
+				if s.saving == 0 {
+					os.WriteFile(filepath.Join(dir, "dump.rdb"), []byte(rdb), 0600)
+				}
+			}
+			return
+		}
+		c.WriteBulkString("# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n\r\n# Replication\r\nrole:master\r\n")
+	case "CONFIG":
+		value := dir
+		if args[2] == "dbfilename" {
+			value = "dump.rdb"
+		}
+		c.WriteArray(2)
+		c.WriteBulkString(args[2])
+		c.WriteBulkString(value)
+	case "BGSAVE":
+		s.saving = 2
+		c.WriteString("Background saving started")
+	case "PSYNC":
+		c.WriteRaw([]byte("+FULLRESYNC 8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb 0\r\n\n\n"))
+		c.WriteRaw([]byte(fmt.Sprintf("$%d\r\n%s", len(rdb), rdb)))
+		// the replication stream goes on after the dump
+		c.WriteRaw([]byte("*1\r\n$4\r\nPING\r\n"))
+	default:
+		c.WriteError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+func readDump(t *testing.T, p *RedisImporter) string {
+	scanChan, err := p.Scan()
+	require.NoError(t, err)
+
+	paths := []string{}
+	var size int64
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		paths = append(paths, record.Record.Pathname)
+		size = record.Record.FileInfo.Size()
+	}
+	require.Equal(t, []string{"/", "/dump.rdb"}, paths)
+
+	rd, err := p.NewReader("/dump.rdb")
+	require.NoError(t, err)
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, size, int64(len(data)))
+	return string(data)
+}
+
+func TestReplicaLinkRead(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		io.WriteString(server, "+FULLRESYNC id 0\r\n\n$3\r\nrdb")
+		server.Close()
+	}()
+
+	// the client is handed a line at a time, the rest stays buffered
+	link := &replicaLink{Conn: client, rd: bufio.NewReader(client)}
+	buf := make([]byte, 64)
+	n, err := link.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "+FULLRESYNC id 0\r\n", string(buf[:n]))
+
+	line, err := link.readLine()
+	require.NoError(t, err)
+	require.Equal(t, "", line)
+	line, err = link.readLine()
+	require.NoError(t, err)
+	require.Equal(t, "$3", line)
+	data, err := io.ReadAll(link.rd)
+	require.NoError(t, err)
+	require.Equal(t, "rdb", string(data))
+}
+
+func TestRedisImporterReplication(t *testing.T) {
+	addr := fakeServer(t, t.TempDir(), "REDIS0011\xfarandom")
+
+	imp, err := NewRedisImporter(map[string]string{
+		"location": "redis://backup:secret@" + addr,
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+	require.Equal(t, "redis", imp.Type())
+	require.Equal(t, addr, imp.Origin())
+
+	p := imp.(*RedisImporter)
+	tags, err := p.Tags()
+	require.NoError(t, err)
+	require.Equal(t, []string{"redis_version=7.2.4", "redis_mode=standalone", "redis_role=master"}, tags)
+
+	require.Equal(t, "REDIS0011\xfarandom", readDump(t, p))
+
+	spool := p.rdb.Name()
+	require.NoError(t, imp.Close())
+	_, err = os.Stat(spool)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRedisImporterBgsave(t *testing.T) {
+	BGSAVE_POLL_INTERVAL = time.Millisecond
+	dir := t.TempDir()
+	addr := fakeServer(t, dir, "REDIS0011saved")
+
+	imp, err := NewRedisImporter(map[string]string{
+		"location": "redis://" + addr,
+		"username": "backup",
+		"password": "secret",
+		"mode":     "bgsave",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	require.Equal(t, "REDIS0011saved", readDump(t, imp.(*RedisImporter)))
+
+	// the dump is left in place
+	require.NoError(t, imp.Close())
+	_, err = os.Stat(filepath.Join(dir, "dump.rdb"))
+	require.NoError(t, err)
+}
+
+func TestRedisImporterAuthFailure(t *testing.T) {
+	addr := fakeServer(t, t.TempDir(), "")
+
+	imp, err := NewRedisImporter(map[string]string{
+		"location": "redis://backup:wrong@" + addr,
+	})
+	require.NoError(t, err)
+	_, err = imp.Scan()
+	require.ErrorContains(t, err, "authentication failed")
+}
+
+func TestNewRedisImporterConfig(t *testing.T) {
+	_, err := NewRedisImporter(map[string]string{"location": "redis://host", "mode": "dump"})
+	require.Error(t, err)
+
+	_, err = NewRedisImporter(map[string]string{"location": "memcached://host"})
+	require.Error(t, err)
+
+	imp, err := NewRedisImporter(map[string]string{"location": "rediss://host"})
+	require.NoError(t, err)
+	require.Equal(t, "host:6379", imp.Origin())
+	require.NotNil(t, imp.(*RedisImporter).tlsConfig)
+}
@@ -17,14 +17,18 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,12 +39,36 @@ import (
 	"github.com/PlakarKorp/plakar/snapshot/importer"
 )
 
+// Extended attributes recording the S3 metadata of objects, the user
+// metadata being recorded under XATTR_USER_METADATA followed by its key.
+const (
+	XATTR_VERSION_ID    = "s3.version-id"
+	XATTR_CONTENT_TYPE  = "s3.content-type"
+	XATTR_STORAGE_CLASS = "s3.storage-class"
+	XATTR_TAGS          = "s3.tags"
+	XATTR_ACL           = "s3.acl"
+	XATTR_USER_METADATA = "s3.meta."
+)
+
+// DEFAULT_RETRIES is how many times an interrupted read is resumed unless
+// configured otherwise.
+const DEFAULT_RETRIES = 3
+
 type S3Importer struct {
 	minioClient *minio.Client
 	bucket      string
 	host        string
 	scanDir     string
 
+	// versions pins reads to the version of objects seen during the
+	// scan, metadata records their S3 metadata as extended attributes.
+	versions bool
+	metadata bool
+	retries  int
+
+	objectVersions sync.Map
+	objectXattrs   sync.Map
+
 	ino uint64
 }
 
@@ -84,6 +112,33 @@ func NewS3Importer(config map[string]string) (importer.Importer, error) {
 		useSsl = tmp
 	}
 
+	versions := false
+	if value, ok := config["versions"]; ok {
+		tmp, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid versions value")
+		}
+		versions = tmp
+	}
+
+	metadata := false
+	if value, ok := config["metadata"]; ok {
+		tmp, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata value")
+		}
+		metadata = tmp
+	}
+
+	retries := DEFAULT_RETRIES
+	if value, ok := config["retries"]; ok {
+		tmp, err := strconv.Atoi(value)
+		if err != nil || tmp < 0 {
+			return nil, fmt.Errorf("invalid retries value")
+		}
+		retries = tmp
+	}
+
 	parsed, err := url.Parse(location)
 	if err != nil {
 		return nil, err
@@ -103,16 +158,69 @@ func NewS3Importer(config map[string]string) (importer.Importer, error) {
 		scanDir:     scanDir,
 		minioClient: conn,
 		host:        parsed.Host,
+		versions:    versions,
+		metadata:    metadata,
+		retries:     retries,
 	}, nil
 }
 
+// objectMetadata returns the S3 metadata of an object as extended
+// attributes.  Tags and ACL are not supported by every S3 implementation
+// and are only recorded when they can be retrieved.
+func (p *S3Importer) objectMetadata(object minio.ObjectInfo) (map[string][]byte, error) {
+	info, err := p.minioClient.StatObject(context.Background(), p.bucket, object.Key,
+		minio.StatObjectOptions{VersionID: object.VersionID})
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	if info.VersionID != "" {
+		xattrs[XATTR_VERSION_ID] = []byte(info.VersionID)
+	}
+	if info.ContentType != "" {
+		xattrs[XATTR_CONTENT_TYPE] = []byte(info.ContentType)
+	}
+	if info.StorageClass != "" {
+		xattrs[XATTR_STORAGE_CLASS] = []byte(info.StorageClass)
+	}
+	for key, value := range info.UserMetadata {
+		xattrs[XATTR_USER_METADATA+strings.ToLower(key)] = []byte(value)
+	}
+
+	tags, err := p.minioClient.GetObjectTagging(context.Background(), p.bucket, object.Key,
+		minio.GetObjectTaggingOptions{VersionID: object.VersionID})
+	if err == nil && len(tags.ToMap()) != 0 {
+		xattrs[XATTR_TAGS] = []byte(tags.String())
+	}
+
+	acl, err := p.minioClient.GetObjectACL(context.Background(), p.bucket, object.Key)
+	if err == nil && len(acl.Grant) != 0 {
+		if data, err := json.Marshal(acl.Grant); err == nil {
+			xattrs[XATTR_ACL] = data
+		}
+	}
+	return xattrs, nil
+}
+
 func (p *S3Importer) scanRecursive(prefix string, result chan *importer.ScanResult) {
-	for object := range p.minioClient.ListObjects(context.Background(), p.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: false}) {
+	options := minio.ListObjectsOptions{Prefix: prefix, Recursive: false, WithVersions: p.versions}
+	for object := range p.minioClient.ListObjects(context.Background(), p.bucket, options) {
+		if object.Err != nil {
+			result <- importer.NewScanError("/"+prefix, object.Err)
+			continue
+		}
+
 		objectPath := "/" + object.Key
 		if !strings.HasPrefix(objectPath, p.scanDir) && !strings.HasPrefix(p.scanDir, objectPath) {
 			continue
 		}
 
+		// only the current version of an object is part of the tree
+		if p.versions && !strings.HasSuffix(object.Key, "/") && (!object.IsLatest || object.IsDeleteMarker) {
+			continue
+		}
+
 		if strings.HasSuffix(object.Key, "/") {
 			p.scanRecursive(object.Key, result)
 		} else {
@@ -127,7 +235,29 @@ func (p *S3Importer) scanRecursive(prefix string, result chan *importer.ScanResu
 				0,
 				0,
 			)
-			result <- importer.NewScanRecord("/"+object.Key, "", fi, nil)
+
+			if p.versions && object.VersionID != "" {
+				p.objectVersions.Store(objectPath, object.VersionID)
+			}
+
+			var names []string
+			if p.metadata {
+				xattrs, err := p.objectMetadata(object)
+				if err != nil {
+					result <- importer.NewScanError(objectPath, err)
+					continue
+				}
+				p.objectXattrs.Store(objectPath, xattrs)
+				for name := range xattrs {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+			}
+
+			result <- importer.NewScanRecord(objectPath, "", fi, names)
+			for _, name := range names {
+				result <- importer.NewScanXattr(objectPath, name, objects.AttributeExtended)
+			}
 		}
 	}
 
@@ -168,22 +298,107 @@ func (p *S3Importer) NewReader(pathname string) (io.ReadCloser, error) {
 	if strings.HasSuffix(pathname, "/") {
 		return nil, fmt.Errorf("cannot read directory")
 	}
+
+	options := minio.GetObjectOptions{}
+	if versionID, ok := p.objectVersions.Load("/" + strings.TrimPrefix(pathname, "/")); ok {
+		options.VersionID = versionID.(string)
+	}
 	pathname = strings.TrimPrefix(pathname, "/")
 
-	obj, err := p.minioClient.GetObject(context.Background(), p.bucket, pathname,
-		minio.GetObjectOptions{})
+	obj, err := p.minioClient.GetObject(context.Background(), p.bucket, pathname, options)
 	if err != nil {
 		return nil, err
 	}
-	return obj, nil
+	return &resumableReader{
+		importer: p,
+		object:   pathname,
+		options:  options,
+		rd:       obj,
+		retries:  p.retries,
+	}, nil
+}
+
+// resumableReader reads an object, resuming from where it stopped when
+// the read is interrupted, as long as the object is left unchanged.
+type resumableReader struct {
+	importer *S3Importer
+	object   string
+	options  minio.GetObjectOptions
+	rd       *minio.Object
+	offset   int64
+	retries  int
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	r.offset += int64(n)
+	if err == nil || err == io.EOF || r.retries == 0 {
+		return n, err
+	}
+
+	options := r.options
+	if r.offset != 0 {
+		info, staterr := r.rd.Stat()
+		if staterr != nil {
+			return n, err
+		}
+		if options.VersionID == "" {
+			options.SetMatchETag(info.ETag)
+		}
+		if rangeerr := options.SetRange(r.offset, 0); rangeerr != nil {
+			return n, err
+		}
+	}
+
+	obj, openerr := r.importer.minioClient.GetObject(context.Background(), r.importer.bucket, r.object, options)
+	if openerr != nil {
+		return n, err
+	}
+	r.rd.Close()
+	r.rd = obj
+	r.retries--
+
+	if n != 0 {
+		return n, nil
+	}
+	return r.Read(p)
+}
+
+func (r *resumableReader) Close() error {
+	return r.rd.Close()
 }
 
 func (p *S3Importer) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
-	return nil, fmt.Errorf("extended attributes are not supported on S3")
+	if !p.metadata {
+		return nil, fmt.Errorf("extended attributes are not supported on S3")
+	}
+
+	xattrs, ok := p.objectXattrs.Load(pathname)
+	if !ok {
+		return nil, fmt.Errorf("no extended attributes for %s", pathname)
+	}
+	value, ok := xattrs.(map[string][]byte)[attribute]
+	if !ok {
+		return nil, fmt.Errorf("no extended attribute %s for %s", attribute, pathname)
+	}
+	return io.NopCloser(bytes.NewReader(value)), nil
 }
 
 func (p *S3Importer) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
-	return nil, fmt.Errorf("extended attributes are not supported on S3")
+	if !p.metadata {
+		return nil, fmt.Errorf("extended attributes are not supported on S3")
+	}
+
+	attrs := make([]importer.ExtendedAttributes, 0)
+	if xattrs, ok := p.objectXattrs.Load(pathname); ok {
+		for name, value := range xattrs.(map[string][]byte) {
+			attrs = append(attrs, importer.ExtendedAttributes{Name: name, Value: value})
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Name < attrs[j].Name
+	})
+	return attrs, nil
 }
 
 func (p *S3Importer) Close() error {
@@ -1,10 +1,14 @@
 package s3
 
 import (
+	"bytes"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
@@ -78,3 +82,60 @@ func TestS3Importer(t *testing.T) {
 	err = importer.Close()
 	require.NoError(t, err)
 }
+
+func TestS3ImporterMetadata(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	ts := httptest.NewServer(faker.Server())
+	defer ts.Close()
+
+	backend.CreateBucket("bucket")
+	content := []byte("test importer s3")
+	_, err := backend.PutObject("bucket", "dummy.txt", map[string]string{
+		"Content-Type":     "text/plain",
+		"Last-Modified":    time.Now().UTC().Format(http.TimeFormat),
+		"X-Amz-Meta-Owner": "alice",
+	}, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	imp, err := NewS3Importer(map[string]string{
+		"location":          "s3://" + ts.Listener.Addr().String() + "/bucket",
+		"access_key":        "",
+		"secret_access_key": "",
+		"use_tls":           "false",
+		"metadata":          "true",
+	})
+	require.NoError(t, err)
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	xattrs := []string{}
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		if record.Record.IsXattr {
+			require.Equal(t, "/dummy.txt", record.Record.Pathname)
+			xattrs = append(xattrs, record.Record.XattrName)
+		}
+	}
+	require.Contains(t, xattrs, XATTR_CONTENT_TYPE)
+	require.Contains(t, xattrs, XATTR_USER_METADATA+"owner")
+
+	rd, err := imp.NewExtendedAttributeReader("/dummy.txt", XATTR_USER_METADATA+"owner")
+	require.NoError(t, err)
+	value, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "alice", string(value))
+
+	attributes, err := imp.GetExtendedAttributes("/dummy.txt")
+	require.NoError(t, err)
+	require.Equal(t, len(xattrs), len(attributes))
+
+	_, err = NewS3Importer(map[string]string{
+		"location":          "s3://" + ts.Listener.Addr().String() + "/bucket",
+		"access_key":        "",
+		"secret_access_key": "",
+		"versions":          "maybe",
+	})
+	require.EqualError(t, err, "invalid versions value")
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package stdin
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// DEFAULT_NAME is the name of the file a stream is stored as when the
+// location, "-", does not provide one.
+const DEFAULT_NAME = "stdin"
+
+// StdinImporter stores the data read from its standard input as a single
+// file, /<name>, where name comes from a stdin://name location.  The
+// stream is spooled to a temporary file during the scan so its size is
+// known upfront.
+type StdinImporter struct {
+	input       io.Reader
+	pathname    string
+	contentType string
+
+	spool *os.File
+	size  int64
+}
+
+func init() {
+	importer.Register("stdin", NewStdinImporter)
+}
+
+func NewStdinImporter(config map[string]string) (importer.Importer, error) {
+	location := config["location"]
+
+	name := DEFAULT_NAME
+	if location != "-" {
+		if !strings.HasPrefix(location, "stdin://") {
+			return nil, fmt.Errorf("unsupported location %s", location)
+		}
+		if value := strings.TrimPrefix(location, "stdin://"); value != "" {
+			name = value
+		}
+	}
+
+	pathname := "/" + strings.TrimLeft(name, "/")
+	if path.Clean(pathname) != pathname {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+
+	contentType := config["content_type"]
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("invalid content_type value %q: %w", contentType, err)
+		}
+	}
+
+	return &StdinImporter{
+		input:       os.Stdin,
+		pathname:    pathname,
+		contentType: contentType,
+	}, nil
+}
+
+func (p *StdinImporter) Scan() (<-chan *importer.ScanResult, error) {
+	fp, err := os.CreateTemp("", "plakar-stdin-*")
+	if err != nil {
+		return nil, err
+	}
+	p.spool = fp
+
+	p.size, err = io.Copy(fp, p.input)
+	if err != nil {
+		return nil, fmt.Errorf("reading standard input: %w", err)
+	}
+
+	results := make(chan *importer.ScanResult, 16)
+	go func() {
+		defer close(results)
+
+		now := time.Now()
+		ino := uint64(0)
+		newFileInfo := func(name string, size int64, mode os.FileMode) objects.FileInfo {
+			ino++
+			nlink := uint64(1)
+			if mode.IsDir() {
+				nlink = 0
+			}
+			return objects.NewFileInfo(name, size, mode, now, nlink, ino, 0, 0, 0)
+		}
+
+		// the parents of a nested name, e.g. stdin://db/dump.sql
+		var dirs []string
+		for dir := path.Dir(p.pathname); dir != "/"; dir = path.Dir(dir) {
+			dirs = append([]string{dir}, dirs...)
+		}
+
+		results <- importer.NewScanRecord("/", "", newFileInfo("/", 0, 0700|os.ModeDir), nil)
+		for _, dir := range dirs {
+			results <- importer.NewScanRecord(dir, "", newFileInfo(path.Base(dir), 0, 0700|os.ModeDir), nil)
+		}
+		results <- importer.NewScanRecord(p.pathname, "", newFileInfo(path.Base(p.pathname), p.size, 0600), nil)
+	}()
+	return results, nil
+}
+
+func (p *StdinImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if pathname != p.pathname || p.spool == nil {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(p.spool, 0, p.size)), nil
+}
+
+// ContentType returns the content type provided for the stream, if any,
+// as it can't be guessed from a name such as "stdin".
+func (p *StdinImporter) ContentType(pathname string) string {
+	if pathname != p.pathname {
+		return ""
+	}
+	return p.contentType
+}
+
+func (p *StdinImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on stdin")
+}
+
+func (p *StdinImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on stdin")
+}
+
+func (p *StdinImporter) Close() error {
+	if p.spool == nil {
+		return nil
+	}
+	p.spool.Close()
+	return os.Remove(p.spool.Name())
+}
+
+func (p *StdinImporter) Root() string {
+	return "/"
+}
+
+func (p *StdinImporter) Origin() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return hostname
+}
+
+func (p *StdinImporter) Type() string {
+	return "stdin"
+}
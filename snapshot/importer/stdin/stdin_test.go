@@ -0,0 +1,88 @@
+package stdin
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scan(t *testing.T, p *StdinImporter) map[string]string {
+	scanChan, err := p.Scan()
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for record := range scanChan {
+		require.Nil(t, record.Error)
+		if record.Record.FileInfo.IsDir() {
+			files[record.Record.Pathname] = ""
+			continue
+		}
+		rd, err := p.NewReader(record.Record.Pathname)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		require.Equal(t, record.Record.FileInfo.Size(), int64(len(data)))
+		files[record.Record.Pathname] = string(data)
+	}
+	return files
+}
+
+func TestStdinImporter(t *testing.T) {
+	imp, err := NewStdinImporter(map[string]string{"location": "-"})
+	require.NoError(t, err)
+	defer imp.Close()
+	require.Equal(t, "stdin", imp.Type())
+	require.Equal(t, "/", imp.Root())
+
+	p := imp.(*StdinImporter)
+	p.input = strings.NewReader("-- dump\n")
+	require.Equal(t, map[string]string{
+		"/":      "",
+		"/stdin": "-- dump\n",
+	}, scan(t, p))
+	require.Equal(t, "", p.ContentType("/stdin"))
+
+	spool := p.spool.Name()
+	require.NoError(t, imp.Close())
+	_, err = os.Stat(spool)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestStdinImporterName(t *testing.T) {
+	imp, err := NewStdinImporter(map[string]string{
+		"location":     "stdin://db/app.sql",
+		"content_type": "application/sql",
+	})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	p := imp.(*StdinImporter)
+	p.input = strings.NewReader("")
+	require.Equal(t, map[string]string{
+		"/":           "",
+		"/db":         "",
+		"/db/app.sql": "",
+	}, scan(t, p))
+	require.Equal(t, "application/sql", p.ContentType("/db/app.sql"))
+	require.Equal(t, "", p.ContentType("/db"))
+
+	_, err = p.NewReader("/db/other.sql")
+	require.Error(t, err)
+}
+
+func TestNewStdinImporterConfig(t *testing.T) {
+	_, err := NewStdinImporter(map[string]string{"location": "fs:///tmp"})
+	require.Error(t, err)
+
+	_, err = NewStdinImporter(map[string]string{"location": "stdin://../etc/passwd"})
+	require.Error(t, err)
+
+	_, err = NewStdinImporter(map[string]string{"location": "stdin://a//b"})
+	require.Error(t, err)
+
+	_, err = NewStdinImporter(map[string]string{"location": "-", "content_type": "not a type"})
+	require.Error(t, err)
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sysstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// DIRECTORY is the directory, below the root of the backup, holding the
+// system state captured.
+const DIRECTORY = ".plakar-system-state"
+
+// Module captures a piece of the state of the operating system, such as
+// the packages installed, as the output of a command.
+type Module struct {
+	Name string
+
+	// Filename is the virtual file the output is stored as, relative to
+	// DIRECTORY.
+	Filename string
+
+	// GOOS lists the systems the module applies to.
+	GOOS []string
+
+	Command []string
+
+	// Empty lists the exit statuses meaning there is nothing to capture,
+	// such as crontab -l for a user without a crontab.
+	Empty []int
+}
+
+var Modules = []Module{
+	{
+		Name:     "dpkg",
+		Filename: "packages/dpkg-selections.txt",
+		GOOS:     []string{"linux"},
+		Command:  []string{"dpkg", "--get-selections"},
+	},
+	{
+		Name:     "rpm",
+		Filename: "packages/rpm.txt",
+		GOOS:     []string{"linux"},
+		Command:  []string{"rpm", "-qa"},
+	},
+	{
+		Name:     "brew",
+		Filename: "packages/Brewfile",
+		GOOS:     []string{"darwin", "linux"},
+		Command:  []string{"brew", "bundle", "dump", "--file=-"},
+	},
+	{
+		Name:     "choco",
+		Filename: "packages/choco.txt",
+		GOOS:     []string{"windows"},
+		Command:  []string{"choco", "list", "--limit-output"},
+	},
+	{
+		Name:     "crontab",
+		Filename: "cron/crontab.txt",
+		GOOS:     []string{"linux", "darwin", "freebsd", "openbsd", "netbsd"},
+		Command:  []string{"crontab", "-l"},
+		Empty:    []int{1},
+	},
+	{
+		Name:     "systemd",
+		Filename: "systemd/enabled-units.txt",
+		GOOS:     []string{"linux"},
+		Command:  []string{"systemctl", "list-unit-files", "--state=enabled", "--no-legend", "--no-pager"},
+	},
+}
+
+func (m *Module) supported() bool {
+	return slices.Contains(m.GOOS, runtime.GOOS)
+}
+
+func (m *Module) available() bool {
+	if !m.supported() {
+		return false
+	}
+	_, err := exec.LookPath(m.Command[0])
+	return err == nil
+}
+
+// errEmpty reports that a module had nothing to capture.
+var errEmpty = errors.New("nothing to capture")
+
+func (m *Module) capture() ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(m.Command[0], m.Command[1:]...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if slices.Contains(m.Empty, exitErr.ExitCode()) {
+				return nil, errEmpty
+			}
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %s", strings.Join(m.Command, " "), msg)
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", strings.Join(m.Command, " "), err)
+	}
+	return output, nil
+}
+
+// ParseModules returns the modules named in a comma-separated list, "all"
+// selecting the ones supported by the system whose command is installed.
+func ParseModules(list string) ([]Module, error) {
+	var modules []Module
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			for _, module := range Modules {
+				if module.available() && !slices.ContainsFunc(modules, func(m Module) bool { return m.Name == module.Name }) {
+					modules = append(modules, module)
+				}
+			}
+			continue
+		}
+
+		idx := slices.IndexFunc(Modules, func(m Module) bool { return m.Name == name })
+		if idx == -1 {
+			return nil, fmt.Errorf("unknown system state module: %s", name)
+		}
+		module := Modules[idx]
+		if !module.supported() {
+			return nil, fmt.Errorf("system state module %s is not supported on %s", name, runtime.GOOS)
+		}
+		if !slices.ContainsFunc(modules, func(m Module) bool { return m.Name == name }) {
+			modules = append(modules, module)
+		}
+	}
+	return modules, nil
+}
+
+// Importer adds the system state captured by modules to the files of the
+// importer it wraps, as virtual files below DIRECTORY in its root.  The
+// state is captured once the wrapped importer is done scanning.
+type Importer struct {
+	importer.Importer
+
+	modules []Module
+	files   map[string][]byte
+}
+
+func NewImporter(imp importer.Importer, modules []Module) *Importer {
+	return &Importer{
+		Importer: imp,
+		modules:  modules,
+		files:    make(map[string][]byte),
+	}
+}
+
+func (s *Importer) Scan() (<-chan *importer.ScanResult, error) {
+	scanner, err := s.Importer.Scan()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan *importer.ScanResult, 16)
+	go func() {
+		defer close(results)
+
+		for result := range scanner {
+			results <- result
+		}
+		s.capture(results)
+	}()
+	return results, nil
+}
+
+func (s *Importer) capture(results chan<- *importer.ScanResult) {
+	now := time.Now()
+	directory := path.Join(s.Importer.Root(), DIRECTORY)
+
+	var failures []*importer.ScanResult
+	for _, module := range s.modules {
+		pathname := path.Join(directory, module.Filename)
+		data, err := module.capture()
+		if errors.Is(err, errEmpty) {
+			continue
+		} else if err != nil {
+			failures = append(failures, importer.NewScanError(pathname, err))
+			continue
+		}
+		s.files[pathname] = data
+	}
+
+	// the directories holding the files, parents first
+	dirs := map[string]struct{}{}
+	for pathname := range s.files {
+		for dir := path.Dir(pathname); dir != s.Importer.Root() && dir != "/" && dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = struct{}{}
+		}
+	}
+	sortedDirs := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sortedDirs = append(sortedDirs, dir)
+	}
+	sort.Strings(sortedDirs)
+	for _, dir := range sortedDirs {
+		fileinfo := objects.NewFileInfo(path.Base(dir), 0, os.ModeDir|0700, now, 0, 0, 0, 0, 1)
+		results <- importer.NewScanRecord(dir, "", fileinfo, nil)
+	}
+
+	pathnames := make([]string, 0, len(s.files))
+	for pathname := range s.files {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+	for _, pathname := range pathnames {
+		fileinfo := objects.NewFileInfo(path.Base(pathname), int64(len(s.files[pathname])), 0600, now, 0, 0, 0, 0, 1)
+		results <- importer.NewScanRecord(pathname, "", fileinfo, nil)
+	}
+
+	for _, failure := range failures {
+		results <- failure
+	}
+}
+
+func (s *Importer) NewReader(pathname string) (io.ReadCloser, error) {
+	if data, ok := s.files[pathname]; ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return s.Importer.NewReader(pathname)
+}
+
+// The optional interfaces of the wrapped importer are forwarded, doing
+// nothing if it doesn't implement them.
+
+func (s *Importer) VolumeID() (string, error) {
+	if vi, ok := s.Importer.(importer.VolumeIdentifier); ok {
+		return vi.VolumeID()
+	}
+	return "", nil
+}
+
+func (s *Importer) Timestamp() (time.Time, error) {
+	if timestamper, ok := s.Importer.(importer.Timestamper); ok {
+		return timestamper.Timestamp()
+	}
+	return time.Time{}, nil
+}
+
+func (s *Importer) Tags() ([]string, error) {
+	if tagger, ok := s.Importer.(importer.Tagger); ok {
+		return tagger.Tags()
+	}
+	return nil, nil
+}
+
+func (s *Importer) ContentType(pathname string) string {
+	if _, ok := s.files[pathname]; ok {
+		return "text/plain; charset=utf-8"
+	}
+	if typer, ok := s.Importer.(importer.ContentTyper); ok {
+		return typer.ContentType(pathname)
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package sysstate
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/stretchr/testify/require"
+)
+
+func scan(t *testing.T, imp importer.Importer) (map[string]string, []string) {
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	var failures []string
+	for result := range scanChan {
+		if result.Error != nil {
+			failures = append(failures, result.Error.Pathname)
+			continue
+		}
+		record := result.Record
+		if record.FileInfo.IsDir() {
+			files[record.Pathname] = ""
+			continue
+		}
+		rd, err := imp.NewReader(record.Pathname)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		rd.Close()
+		require.Equal(t, record.FileInfo.Size(), int64(len(data)))
+		files[record.Pathname] = string(data)
+	}
+	return files, failures
+}
+
+func TestImporter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modules run through sh")
+	}
+
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644))
+
+	modules := []Module{
+		{Name: "packages", Filename: "packages/list.txt", Command: []string{"sh", "-c", "echo vim install"}},
+		{Name: "empty", Filename: "cron/crontab.txt", Command: []string{"sh", "-c", "exit 1"}, Empty: []int{1}},
+		{Name: "failing", Filename: "systemd/enabled-units.txt", Command: []string{"sh", "-c", "echo denied >&2; exit 2"}},
+	}
+
+	fsImporter, err := importer.NewImporter(map[string]string{"location": "fs://" + tmpDir})
+	require.NoError(t, err)
+	imp := NewImporter(fsImporter, modules)
+	defer imp.Close()
+
+	root := imp.Root()
+	files, failures := scan(t, imp)
+	require.Equal(t, "content", files[filepath.ToSlash(filepath.Join(root, "file.txt"))])
+	require.Equal(t, "vim install\n", files[root+"/"+DIRECTORY+"/packages/list.txt"])
+	require.Contains(t, files, root+"/"+DIRECTORY)
+	require.Contains(t, files, root+"/"+DIRECTORY+"/packages")
+
+	// nothing is stored for a module with nothing to capture
+	require.NotContains(t, files, root+"/"+DIRECTORY+"/cron")
+	require.Equal(t, []string{root + "/" + DIRECTORY + "/systemd/enabled-units.txt"}, failures)
+
+	require.Equal(t, "text/plain; charset=utf-8", imp.ContentType(root+"/"+DIRECTORY+"/packages/list.txt"))
+}
+
+func TestParseModules(t *testing.T) {
+	_, err := ParseModules("nosuchmodule")
+	require.Error(t, err)
+
+	modules, err := ParseModules("all")
+	require.NoError(t, err)
+	for _, module := range modules {
+		require.True(t, module.available(), module.Name)
+	}
+
+	for _, module := range Modules {
+		modules, err := ParseModules(module.Name + "," + module.Name)
+		if module.supported() {
+			require.NoError(t, err)
+			require.Len(t, modules, 1)
+		} else {
+			require.Error(t, err)
+		}
+	}
+}
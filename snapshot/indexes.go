@@ -19,8 +19,8 @@ func (snap *Snapshot) getidx(name, kind string) (objects.MAC, bool) {
 	return objects.MAC{}, false
 }
 
-func (snap *Snapshot) ContentTypeIdx() (*btree.BTree[string, objects.MAC, objects.MAC], error) {
-	mac, found := snap.getidx("content-type", "btree")
+func (snap *Snapshot) loadidx(name string) (*btree.BTree[string, objects.MAC, objects.MAC], error) {
+	mac, found := snap.getidx(name, "btree")
 	if !found {
 		return nil, nil
 	}
@@ -37,3 +37,13 @@ func (snap *Snapshot) ContentTypeIdx() (*btree.BTree[string, objects.MAC, object
 	}
 	return btree.Deserialize(bytes.NewReader(d), &store, strings.Compare)
 }
+
+func (snap *Snapshot) ContentTypeIdx() (*btree.BTree[string, objects.MAC, objects.MAC], error) {
+	return snap.loadidx("content-type")
+}
+
+// TombstoneIdx returns the pathnames the importer reported as deleted,
+// or nil if there were none.
+func (snap *Snapshot) TombstoneIdx() (*btree.BTree[string, objects.MAC, objects.MAC], error) {
+	return snap.loadidx("tombstones")
+}
@@ -0,0 +1,71 @@
+package snapshot
+
+import (
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+// Materialize creates a synthetic snapshot holding the same tree as snap,
+// with every blob it relies on copied into packfiles of its own.  The
+// synthetic snapshot no longer depends on the packfiles of the backups that
+// preceded it, which makes it suitable for long-term archival or export.
+func (snap *Snapshot) Materialize() (objects.MAC, error) {
+	blobs, err := snap.ListBlobs()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+
+	dst, err := New(snap.repository)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	defer dst.Close()
+
+	done, err := dst.Lock()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	defer dst.Unlock(done)
+
+	// keep the original snapshot info, but it is signed by whoever
+	// materializes it, if anyone.
+	hdr := *snap.Header
+	hdr.Identifier = dst.Header.Identifier
+	hdr.Identity = dst.Header.Identity
+	hdr.Synthetic = snap.Header.Identifier
+	dst.Header = &hdr
+
+	seen := make(map[BlobRef]struct{})
+	for blob, err := range blobs {
+		if err != nil {
+			return objects.MAC{}, err
+		}
+
+		// These are keyed by the snapshot identifier and are written
+		// anew when committing, the profile describes the original run.
+		switch blob.Type {
+		case resources.RT_SNAPSHOT, resources.RT_SIGNATURE, resources.RT_TIMESTAMP, resources.RT_PROFILE, resources.RT_TEXT_INDEX:
+			continue
+		}
+
+		if _, ok := seen[blob]; ok {
+			continue
+		}
+		seen[blob] = struct{}{}
+
+		data, err := snap.GetBlob(blob.Type, blob.MAC)
+		if err != nil {
+			return objects.MAC{}, err
+		}
+
+		if err := dst.PutBlob(blob.Type, blob.MAC, data); err != nil {
+			return objects.MAC{}, err
+		}
+	}
+
+	if err := dst.Commit(); err != nil {
+		return objects.MAC{}, err
+	}
+
+	return dst.Header.Identifier, nil
+}
@@ -0,0 +1,64 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// mboxSeparator starts each message of an mbox file, lines of a message
+// starting the same way are quoted by the writer.
+var mboxSeparator = []byte("From ")
+
+// isMbox tells whether the content of rd looks like an mbox file.
+func isMbox(rd *bufio.Reader) bool {
+	magic, err := rd.Peek(len(mboxSeparator))
+	return err == nil && bytes.Equal(magic, mboxSeparator)
+}
+
+// mboxChunks splits an mbox file into chunks that end on message
+// boundaries, grouping messages until a chunk holds at least minSize
+// bytes.  Messages appended to the file leave the chunks of the previous
+// ones untouched but the last, and a rewritten message only affects the
+// chunks up to the next boundaries.  Chunks are cut at maxSize bytes when
+// a message does not fit.
+func mboxChunks(rd *bufio.Reader, minSize int, maxSize int, fn func([]byte) error) error {
+	chunk := make([]byte, 0, minSize)
+	lineStart := true
+
+	for {
+		line, err := rd.ReadSlice('\n')
+		if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+
+		if lineStart && len(chunk) >= minSize && bytes.HasPrefix(line, mboxSeparator) {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = make([]byte, 0, minSize)
+		}
+		lineStart = len(line) > 0 && line[len(line)-1] == '\n'
+
+		for len(chunk)+len(line) >= maxSize {
+			n := maxSize - len(chunk)
+			chunk = append(chunk, line[:n]...)
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = make([]byte, 0, minSize)
+			line = line[n:]
+		}
+		chunk = append(chunk, line...)
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if len(chunk) > 0 {
+		return fn(chunk)
+	}
+	return nil
+}
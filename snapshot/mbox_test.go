@@ -0,0 +1,58 @@
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mboxMessage(i int, size int) string {
+	body := strings.Repeat(fmt.Sprintf("line %d of the message\n", i), size/24+1)
+	return fmt.Sprintf("From sender%d@example.org Mon Jan  1 00:00:00 2026\nSubject: %d\n\n%s>From quoted\n\n", i, i, body)
+}
+
+func splitMbox(t *testing.T, mbox string, minSize int, maxSize int) []string {
+	chunks := []string{}
+	err := mboxChunks(bufio.NewReaderSize(strings.NewReader(mbox), 16), minSize, maxSize, func(data []byte) error {
+		chunks = append(chunks, string(data))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, mbox, strings.Join(chunks, ""))
+	return chunks
+}
+
+func TestIsMbox(t *testing.T) {
+	require.True(t, isMbox(bufio.NewReader(strings.NewReader(mboxMessage(0, 10)))))
+	require.False(t, isMbox(bufio.NewReader(strings.NewReader("Subject: not an mbox\n"))))
+	require.False(t, isMbox(bufio.NewReader(strings.NewReader("From"))))
+}
+
+func TestMboxChunks(t *testing.T) {
+	mbox := ""
+	for i := 0; i < 20; i++ {
+		mbox += mboxMessage(i, 300)
+	}
+	chunks := splitMbox(t, mbox, 1000, 4000)
+	for _, chunk := range chunks {
+		require.True(t, strings.HasPrefix(chunk, "From "))
+		require.LessOrEqual(t, len(chunk), 4000)
+	}
+	for _, chunk := range chunks[:len(chunks)-1] {
+		require.GreaterOrEqual(t, len(chunk), 1000)
+	}
+
+	// appending a message only changes the last chunk
+	appended := splitMbox(t, mbox+mboxMessage(20, 300), 1000, 4000)
+	require.Equal(t, chunks[:len(chunks)-1], appended[:len(chunks)-1])
+
+	// a message larger than the maximum is cut
+	chunks = splitMbox(t, mboxMessage(0, 10000), 1000, 4000)
+	require.Greater(t, len(chunks), 2)
+	for _, chunk := range chunks {
+		require.LessOrEqual(t, len(chunk), 4000)
+	}
+}
@@ -0,0 +1,571 @@
+package snapshot
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/btree"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/iterator"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+type MergeOptions struct {
+	Name string
+	Tags []string
+
+	// Sequence replays the snapshots in order instead of keeping the
+	// most recently modified entries: each snapshot overrides the ones
+	// before it, and its tombstones mask their entries.
+	Sequence bool
+}
+
+// mergeSource walks the tree of one of the merged snapshots.
+type mergeSource struct {
+	snap *Snapshot
+	fs   *vfs.Filesystem
+	iter iterator.Iterator[string, objects.MAC]
+	path string
+	mac  objects.MAC
+	done bool
+}
+
+func (src *mergeSource) next() error {
+	if src.iter.Next() {
+		src.path, src.mac = src.iter.Current()
+		return nil
+	}
+	src.done = true
+	return src.iter.Err()
+}
+
+type merger struct {
+	dst      *Snapshot
+	sources  []*mergeSource
+	sequence bool
+
+	// index of the last snapshot deleting each pathname
+	tombstones map[string]int
+
+	idx   *btree.BTree[string, int, objects.MAC]
+	ctidx *btree.BTree[string, int, objects.MAC]
+
+	// directories are written last, once their summary is known
+	dirs map[string]*vfs.Entry
+
+	// source of the entries having extended attributes
+	owners map[string]int
+
+	errcounts map[string]uint64
+	fileTypes header.FileTypes
+}
+
+func keepMAC(mac objects.MAC) (objects.MAC, error) {
+	return mac, nil
+}
+
+// commonDir returns the deepest directory holding both a and b.
+func commonDir(a, b string) string {
+	for a != b {
+		if len(a) > len(b) {
+			a = path.Dir(a)
+		} else {
+			b = path.Dir(b)
+		}
+	}
+	return a
+}
+
+// loadTombstones records the deletions of the merged snapshots.
+func (m *merger) loadTombstones() error {
+	for i, src := range m.sources {
+		tree, err := src.snap.TombstoneIdx()
+		if err != nil {
+			return err
+		}
+		if tree == nil {
+			continue
+		}
+		iter, err := tree.ScanAll()
+		if err != nil {
+			return err
+		}
+		for iter.Next() {
+			pathname, _ := iter.Current()
+			m.tombstones[pathname] = i
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// masked returns true if pathname, or one of its parents, was deleted by
+// a snapshot coming after the i-th one.
+func (m *merger) masked(pathname string, i int) bool {
+	if len(m.tombstones) == 0 {
+		return false
+	}
+	for {
+		if deleted, ok := m.tombstones[pathname]; ok && deleted > i {
+			return true
+		}
+		if pathname == "/" {
+			return false
+		}
+		pathname = path.Dir(pathname)
+	}
+}
+
+// pick returns the entry to keep among those found at the same pathname
+// in several snapshots: the most recently modified, the one of the last
+// snapshot on ties.  When replaying a sequence, it is the one of the last
+// snapshot not masked by a tombstone, if any.
+func (m *merger) pick(candidates []int) (*vfs.Entry, objects.MAC, int, error) {
+	if m.sequence {
+		for j := len(candidates) - 1; j >= 0; j-- {
+			src := m.sources[candidates[j]]
+			if m.masked(src.path, candidates[j]) {
+				continue
+			}
+			entry, err := src.fs.ResolveEntry(src.mac)
+			if err != nil {
+				return nil, objects.MAC{}, -1, err
+			}
+			return entry, src.mac, candidates[j], nil
+		}
+		return nil, objects.MAC{}, -1, nil
+	}
+
+	var winner *vfs.Entry
+	var winnerMAC objects.MAC
+	owner := -1
+
+	for _, i := range candidates {
+		src := m.sources[i]
+		if winner != nil && src.mac == winnerMAC {
+			owner = i
+			continue
+		}
+		entry, err := src.fs.ResolveEntry(src.mac)
+		if err != nil {
+			return nil, objects.MAC{}, -1, err
+		}
+		if winner == nil || !entry.FileInfo.ModTime().Before(winner.FileInfo.ModTime()) {
+			winner, winnerMAC, owner = entry, src.mac, i
+		}
+	}
+	return winner, winnerMAC, owner, nil
+}
+
+func (m *merger) mergeEntry(pathname string, candidates []int) error {
+	parent := path.Dir(pathname)
+	if pathname != "/" {
+		// the parent was replaced by a file in a more recent snapshot
+		if _, ok := m.dirs[parent]; !ok {
+			return nil
+		}
+	}
+
+	entry, entryMAC, owner, err := m.pick(candidates)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	if entry.IsDir() {
+		entry.Summary = &vfs.Summary{}
+		m.dirs[pathname] = entry
+		return nil
+	}
+	if pathname == "/" {
+		return fmt.Errorf("root of snapshot %x is not a directory", m.sources[owner].snap.Header.GetIndexShortID())
+	}
+
+	if err := m.idx.Insert(pathname, entryMAC); err != nil {
+		return err
+	}
+
+	fileSummary := &vfs.FileSummary{
+		Size:    uint64(entry.Size()),
+		Mode:    entry.FileInfo.Mode(),
+		ModTime: entry.FileInfo.ModTime().Unix(),
+	}
+	if object := entry.ResolvedObject; object != nil {
+		fileSummary.Objects++
+		fileSummary.Chunks += uint64(len(object.Chunks))
+		fileSummary.ContentType = object.ContentType
+		fileSummary.Entropy = object.Entropy
+
+		m.fileTypes.Record(object.ContentType, path.Ext(pathname))
+
+		mime := strings.SplitN(object.ContentType, ";", 2)[0]
+		if err := m.ctidx.Insert(fmt.Sprintf("/%s%s", mime, pathname), entryMAC); err != nil {
+			return err
+		}
+	}
+
+	dirEntry := m.dirs[parent]
+	dirEntry.Summary.Directory.Children++
+	dirEntry.Summary.UpdateWithFileSummary(fileSummary)
+
+	if len(entry.ExtendedAttributes) != 0 || len(entry.AlternateDataStreams) != 0 {
+		m.owners[pathname] = owner
+	}
+	return nil
+}
+
+// mergeErrors keeps the errors of the directories that made it into the
+// merged tree, the last snapshot wins when several recorded one.
+func (m *merger) mergeErrors() (*btree.BTree[string, int, objects.MAC], error) {
+	store := caching.DBStore[string, objects.MAC]{
+		Prefix: "__merge_error__",
+		Cache:  m.dst.scanCache,
+	}
+	errors, err := btree.New(&store, strings.Compare, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, src := range m.sources {
+		_, errtree, _ := src.fs.BTrees()
+		iter, err := errtree.ScanAll()
+		if err != nil {
+			return nil, err
+		}
+		for iter.Next() {
+			pathname, mac := iter.Current()
+			if _, ok := m.dirs[parentPath(pathname)]; !ok || m.masked(pathname, i) {
+				continue
+			}
+			if _, found, err := errors.Find(pathname); err != nil {
+				return nil, err
+			} else if !found {
+				m.errcounts[parentPath(pathname)]++
+			}
+			if err := errors.Update(pathname, mac); err != nil {
+				return nil, err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return errors, nil
+}
+
+// mergeXattrs keeps the extended attributes of the entries they belong to.
+func (m *merger) mergeXattrs() (*btree.BTree[string, int, objects.MAC], error) {
+	store := caching.DBStore[string, objects.MAC]{
+		Prefix: "__merge_xattr__",
+		Cache:  m.dst.scanCache,
+	}
+	xattrs, err := btree.New(&store, strings.Compare, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, src := range m.sources {
+		_, _, xattrtree := src.fs.BTrees()
+		iter, err := xattrtree.ScanAll()
+		if err != nil {
+			return nil, err
+		}
+		for iter.Next() {
+			key, mac := iter.Current()
+			xattr, err := src.fs.ResolveXattr(mac)
+			if err != nil {
+				return nil, err
+			}
+			if owner, ok := m.owners[xattr.Path]; !ok || owner != i {
+				continue
+			}
+			if err := xattrs.Insert(key, mac); err != nil && err != btree.ErrExists {
+				return nil, err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return xattrs, nil
+}
+
+// mergeTombstones keeps the deletions that nothing was recreated at, so
+// that the merged snapshot can itself be replayed over older ones.  It
+// returns nil if there are none.
+func (m *merger) mergeTombstones() (*btree.BTree[string, int, objects.MAC], error) {
+	tombstones, err := btree.New(&btree.InMemoryStore[string, objects.MAC]{}, strings.Compare, 50)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for pathname := range m.tombstones {
+		if _, ok := m.dirs[pathname]; ok {
+			continue
+		}
+		if _, found, err := m.idx.Find(pathname); err != nil {
+			return nil, err
+		} else if found {
+			continue
+		}
+		if err := tombstones.Insert(pathname, objects.MAC{}); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	return tombstones, nil
+}
+
+// persistDirectories writes the directories, deepest first, so that each
+// one accounts for the summaries of its subdirectories.
+func (m *merger) persistDirectories() (*vfs.Summary, error) {
+	dirPaths := make([]string, 0, len(m.dirs))
+	for dirPath := range m.dirs {
+		dirPaths = append(dirPaths, dirPath)
+	}
+	sort.Slice(dirPaths, func(i, j int) bool {
+		return vfs.PathCmp(dirPaths[i], dirPaths[j]) > 0
+	})
+
+	for _, dirPath := range dirPaths {
+		dirEntry := m.dirs[dirPath]
+		dirEntry.Summary.Directory.Errors += m.errcounts[dirPath]
+		dirEntry.Summary.UpdateAverages()
+
+		serialized, err := dirEntry.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		mac := m.dst.repository.ComputeMAC(serialized)
+		if err := m.dst.PutBlobIfNotExists(resources.RT_VFS_ENTRY, mac, serialized); err != nil {
+			return nil, err
+		}
+		if err := m.idx.Insert(dirPath, mac); err != nil {
+			return nil, err
+		}
+
+		if dirPath != "/" {
+			parent := m.dirs[path.Dir(dirPath)]
+			parent.Summary.Directory.Children++
+			parent.Summary.UpdateBelow(dirEntry.Summary)
+		}
+	}
+
+	root, ok := m.dirs["/"]
+	if !ok {
+		return nil, fmt.Errorf("merged tree has no root")
+	}
+	return root.Summary, nil
+}
+
+// Merge creates a snapshot whose tree is the union of the trees of
+// snapshots.  When a pathname exists in several of them, the entry with
+// the most recent modification time is kept, the one of the last snapshot
+// on ties.  File entries, objects and chunks are shared with the merged
+// snapshots, no data is copied: only directories are written anew.
+//
+// With options.Sequence, the snapshots are replayed in order as partial
+// states of the same source: the entry of the last snapshot is kept, and
+// the pathnames a snapshot holds tombstones for are removed along with
+// everything below them, unless a later snapshot recreates them.
+func Merge(repo *repository.Repository, snapshots []*Snapshot, options *MergeOptions) (objects.MAC, error) {
+	if len(snapshots) < 2 {
+		return objects.MAC{}, fmt.Errorf("at least two snapshots are required")
+	}
+	beginTime := time.Now()
+
+	dst, err := New(repo)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	defer dst.Close()
+
+	done, err := dst.Lock()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	defer dst.Unlock(done)
+
+	m := &merger{
+		dst:        dst,
+		sequence:   options.Sequence,
+		tombstones: make(map[string]int),
+		dirs:       make(map[string]*vfs.Entry),
+		owners:     make(map[string]int),
+		errcounts:  make(map[string]uint64),
+		fileTypes:  header.NewFileTypes(),
+	}
+
+	store := caching.DBStore[string, objects.MAC]{
+		Prefix: "__merge_path__",
+		Cache:  dst.scanCache,
+	}
+	if m.idx, err = btree.New(&store, vfs.PathCmp, 50); err != nil {
+		return objects.MAC{}, err
+	}
+	if m.ctidx, err = btree.New(&btree.InMemoryStore[string, objects.MAC]{}, strings.Compare, 50); err != nil {
+		return objects.MAC{}, err
+	}
+
+	for _, snap := range snapshots {
+		fs, err := snap.Filesystem()
+		if err != nil {
+			return objects.MAC{}, err
+		}
+		tree, _, _ := fs.BTrees()
+		iter, err := tree.ScanAll()
+		if err != nil {
+			return objects.MAC{}, err
+		}
+		src := &mergeSource{snap: snap, fs: fs, iter: iter}
+		if err := src.next(); err != nil {
+			return objects.MAC{}, err
+		}
+		m.sources = append(m.sources, src)
+	}
+	if m.sequence {
+		if err := m.loadTombstones(); err != nil {
+			return objects.MAC{}, err
+		}
+	}
+
+	// the trees are sorted the same way, walk them side by side
+	for {
+		select {
+		case <-dst.AppContext().GetContext().Done():
+			return objects.MAC{}, dst.AppContext().GetContext().Err()
+		default:
+		}
+
+		current, found := "", false
+		for _, src := range m.sources {
+			if !src.done && (!found || vfs.PathCmp(src.path, current) < 0) {
+				current, found = src.path, true
+			}
+		}
+		if !found {
+			break
+		}
+
+		candidates := []int{}
+		for i, src := range m.sources {
+			if !src.done && src.path == current {
+				candidates = append(candidates, i)
+			}
+		}
+		if err := m.mergeEntry(current, candidates); err != nil {
+			return objects.MAC{}, err
+		}
+		for _, i := range candidates {
+			if err := m.sources[i].next(); err != nil {
+				return objects.MAC{}, err
+			}
+		}
+	}
+
+	errors, err := m.mergeErrors()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	xattrs, err := m.mergeXattrs()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	rootSummary, err := m.persistDirectories()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+
+	rootmac, err := persistIndex(dst, m.idx, resources.RT_VFS_BTREE, resources.RT_VFS_NODE, keepMAC)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	errmac, err := persistIndex(dst, errors, resources.RT_ERROR_BTREE, resources.RT_ERROR_NODE, keepMAC)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	xattrmac, err := persistIndex(dst, xattrs, resources.RT_XATTR_BTREE, resources.RT_XATTR_NODE, keepMAC)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	ctmac, err := persistIndex(dst, m.ctidx, resources.RT_BTREE_ROOT, resources.RT_BTREE_NODE, keepMAC)
+	if err != nil {
+		return objects.MAC{}, err
+	}
+	tombstones, err := m.mergeTombstones()
+	if err != nil {
+		return objects.MAC{}, err
+	}
+
+	// the merged snapshot is described like the last one
+	last := snapshots[len(snapshots)-1].Header
+	dst.Header.Category = last.Category
+	dst.Header.Environment = last.Environment
+	dst.Header.Perimeter = last.Perimeter
+	dst.Header.Job = last.Job
+
+	merged := make([]string, 0, len(snapshots))
+	source := dst.Header.GetSource(0)
+	source.Importer = last.GetSource(0).Importer
+	source.Importer.File = ""
+	source.Importer.Directory = snapshots[0].Header.GetSource(0).Importer.Root()
+	for _, snap := range snapshots {
+		source.Importer.Directory = commonDir(source.Importer.Directory, snap.Header.GetSource(0).Importer.Root())
+		source.VFS.ErrorsOverflow += snap.Header.GetSource(0).VFS.ErrorsOverflow
+		merged = append(merged, fmt.Sprintf("%x", snap.Header.GetIndexShortID()))
+	}
+	dst.Header.SetContext("MergedFrom", strings.Join(merged, ","))
+
+	dst.Header.Name = options.Name
+	if dst.Header.Name == "" {
+		dst.Header.Name = "merge of " + strings.Join(merged, ", ")
+	}
+	for _, tag := range options.Tags {
+		dst.Header.AddTag(tag)
+	}
+
+	source.VFS.Root = rootmac
+	source.VFS.Errors = errmac
+	source.VFS.Xattrs = xattrmac
+	source.Summary = *rootSummary
+	source.Indexes = []header.Index{
+		{
+			Name:  "content-type",
+			Type:  "btree",
+			Value: ctmac,
+		},
+	}
+	if tombstones != nil {
+		tombmac, err := persistIndex(dst, tombstones, resources.RT_BTREE_ROOT, resources.RT_BTREE_NODE, keepMAC)
+		if err != nil {
+			return objects.MAC{}, err
+		}
+		source.Indexes = append(source.Indexes, header.Index{
+			Name:  "tombstones",
+			Type:  "btree",
+			Value: tombmac,
+		})
+	}
+	m.fileTypes.UpdatePercents()
+	source.FileTypes = m.fileTypes
+	dst.Header.Duration = time.Since(beginTime)
+
+	if err := dst.Commit(); err != nil {
+		return objects.MAC{}, err
+	}
+	return dst.Header.Identifier, nil
+}
@@ -0,0 +1,164 @@
+package snapshot
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/stretchr/testify/require"
+)
+
+// tombstoneImporter reports deletions after the entries of an importer.
+type tombstoneImporter struct {
+	importer.Importer
+	tombstones []string
+}
+
+func (imp *tombstoneImporter) Scan() (<-chan *importer.ScanResult, error) {
+	scanner, err := imp.Importer.Scan()
+	if err != nil {
+		return nil, err
+	}
+	results := make(chan *importer.ScanResult)
+	go func() {
+		defer close(results)
+		for result := range scanner {
+			results <- result
+		}
+		for _, pathname := range imp.tombstones {
+			results <- importer.NewScanTombstone(pathname)
+		}
+	}()
+	return results, nil
+}
+
+// backupInto backs up dir as a new snapshot of repo, reporting the
+// deletion of tombstones.
+func backupInto(t *testing.T, repo *repository.Repository, dir string, tombstones ...string) *Snapshot {
+	snap, err := New(repo)
+	require.NoError(t, err)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": dir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(&tombstoneImporter{imp, tombstones}, &BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	return snap
+}
+
+func readFile(t *testing.T, snap *Snapshot, pathname string) string {
+	fsc, err := snap.Filesystem()
+	require.NoError(t, err)
+	fp, err := fsc.Open(pathname)
+	require.NoError(t, err)
+	defer fp.Close()
+	data, err := io.ReadAll(fp)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestMergeUnion(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.repository
+
+	dir := t.TempDir()
+	now := time.Now()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("newer"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "shared.txt"), now, now))
+	first := backupInto(t, repo, dir)
+	defer first.Close()
+
+	// the second snapshot loses a.txt, gains b.txt and holds an older
+	// version of shared.txt
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("older"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "shared.txt"), now.Add(-time.Hour), now.Add(-time.Hour)))
+	second := backupInto(t, repo, dir)
+	defer second.Close()
+
+	require.NoError(t, repo.RebuildState())
+
+	_, err := Merge(repo, []*Snapshot{first}, &MergeOptions{})
+	require.Error(t, err)
+
+	mergedID, err := Merge(repo, []*Snapshot{first, second}, &MergeOptions{Tags: []string{"merged"}})
+	require.NoError(t, err)
+	require.NoError(t, repo.RebuildState())
+
+	merged, err := Load(repo, mergedID)
+	require.NoError(t, err)
+	defer merged.Close()
+
+	require.Equal(t, []string{"merged"}, merged.Header.Tags)
+	require.Equal(t, "a", readFile(t, merged, filepath.Join(dir, "a.txt")))
+	require.Equal(t, "b", readFile(t, merged, filepath.Join(dir, "b.txt")))
+	require.Equal(t, "newer", readFile(t, merged, filepath.Join(dir, "shared.txt")))
+
+	summary := merged.Header.GetSource(0).Summary
+	require.Equal(t, uint64(3), summary.Below.Files+summary.Directory.Files)
+}
+
+func TestMergeSequence(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.repository
+
+	dir := t.TempDir()
+	now := time.Now()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "x.txt"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("first"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "shared.txt"), now, now))
+	first := backupInto(t, repo, dir)
+	defer first.Close()
+
+	// the second snapshot deletes a.txt and sub, and replaces shared.txt
+	// with an older file that still wins as it comes last
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "sub")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("second"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "shared.txt"), now.Add(-time.Hour), now.Add(-time.Hour)))
+	second := backupInto(t, repo, dir,
+		filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub"), filepath.Join(dir, "gone.txt"))
+	defer second.Close()
+
+	require.NoError(t, repo.RebuildState())
+
+	mergedID, err := Merge(repo, []*Snapshot{first, second}, &MergeOptions{Sequence: true})
+	require.NoError(t, err)
+	require.NoError(t, repo.RebuildState())
+
+	merged, err := Load(repo, mergedID)
+	require.NoError(t, err)
+	defer merged.Close()
+
+	require.Equal(t, "b", readFile(t, merged, filepath.Join(dir, "b.txt")))
+	require.Equal(t, "second", readFile(t, merged, filepath.Join(dir, "shared.txt")))
+
+	fsc, err := merged.Filesystem()
+	require.NoError(t, err)
+	for _, pathname := range []string{"a.txt", "sub", "sub/x.txt"} {
+		_, err := fsc.GetEntry(filepath.Join(dir, pathname))
+		require.Error(t, err, pathname)
+	}
+
+	// the deletions are carried over to the merged snapshot
+	tombstones, err := merged.TombstoneIdx()
+	require.NoError(t, err)
+	require.NotNil(t, tombstones)
+	for _, pathname := range []string{"a.txt", "sub", "gone.txt"} {
+		_, found, err := tombstones.Find(filepath.Join(dir, pathname))
+		require.NoError(t, err)
+		require.True(t, found, pathname)
+	}
+}
@@ -68,6 +68,11 @@ func packerJob(snap *Snapshot) {
 			var packer *Packer
 
 			for msg := range snap.packerChan {
+				// an aborted backup only drains the queue
+				if snap.aborting.Load() {
+					continue
+				}
+
 				if packer == nil {
 					packer = NewPacker(snap.Repository().GetMACHasher())
 				}
@@ -88,7 +93,7 @@ func packerJob(snap *Snapshot) {
 				}
 			}
 
-			if packer != nil {
+			if packer != nil && !snap.aborting.Load() {
 				err := snap.PutPackfile(packer)
 				if err != nil {
 					return err
@@ -120,6 +125,7 @@ func (snap *Snapshot) PutBlob(Type resources.Type, mac [32]byte, data []byte) er
 		return err
 	}
 
+	snap.transferred.Add(uint64(len(encoded)))
 	snap.packerChan <- &PackerMsg{Type: Type, Version: versioning.GetCurrentVersion(Type), Timestamp: time.Now(), MAC: mac, Data: encoded}
 	return nil
 }
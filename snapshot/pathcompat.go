@@ -0,0 +1,256 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+var ErrIncompatiblePaths = errors.New("paths are incompatible with the restore target")
+
+// PathCompat describes the naming limits of a restore target, so that
+// problematic paths are detected before anything is restored.  Lengths are
+// expressed in UTF-16 code units, as Windows and FAT count them.
+type PathCompat struct {
+	Name string
+
+	MaxPath     int
+	MaxName     int
+	MaxFileSize int64
+
+	// Forbidden lists the characters that can't appear in a name, on top
+	// of control characters.
+	Forbidden string
+
+	// TrailingForbidden lists the characters a name can't end with.
+	TrailingForbidden string
+
+	// ReservedNames can't be used as a name, whatever the case and
+	// whatever the extension.
+	ReservedNames []string
+
+	CaseInsensitive bool
+}
+
+var windowsReservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+var pathCompats = map[string]*PathCompat{
+	"windows": {
+		Name:              "windows",
+		MaxPath:           259,
+		MaxName:           255,
+		Forbidden:         `<>:"\|?*`,
+		TrailingForbidden: ". ",
+		ReservedNames:     windowsReservedNames,
+		CaseInsensitive:   true,
+	},
+	"fat": {
+		Name:              "fat",
+		MaxPath:           259,
+		MaxName:           255,
+		MaxFileSize:       1<<32 - 1,
+		Forbidden:         `<>:"\|?*`,
+		TrailingForbidden: ". ",
+		ReservedNames:     windowsReservedNames,
+		CaseInsensitive:   true,
+	},
+}
+
+// GetPathCompat returns the limits of a known restore target.
+func GetPathCompat(name string) (*PathCompat, error) {
+	if pc, ok := pathCompats[strings.ToLower(name)]; ok {
+		return pc, nil
+	}
+	return nil, fmt.Errorf("unknown path compatibility target: %s", name)
+}
+
+// PathCompatNames returns the names of the known restore targets.
+func PathCompatNames() []string {
+	names := make([]string, 0, len(pathCompats))
+	for name := range pathCompats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type PathIssue struct {
+	Pathname string
+	Reason   string
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func (pc *PathCompat) forbidden(r rune) bool {
+	return r < 0x20 || strings.ContainsRune(pc.Forbidden, r)
+}
+
+func (pc *PathCompat) reserved(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	for _, reserved := range pc.ReservedNames {
+		if strings.EqualFold(stem, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkName returns why name can't be used on the target, or an empty
+// string if it can.
+func (pc *PathCompat) checkName(name string) string {
+	if strings.IndexFunc(name, pc.forbidden) != -1 {
+		return "name contains forbidden characters"
+	}
+	if name != strings.TrimRight(name, pc.TrailingForbidden) {
+		return fmt.Sprintf("name ends with one of %q", pc.TrailingForbidden)
+	}
+	if pc.reserved(name) {
+		return "name is reserved"
+	}
+	if pc.MaxName != 0 && utf16Len(name) > pc.MaxName {
+		return fmt.Sprintf("name is longer than %d characters", pc.MaxName)
+	}
+	return ""
+}
+
+// mangleName returns a name usable on the target.  It is deterministic,
+// so that every pass of a restore maps a name to the same destination,
+// and leaves valid names untouched.
+func (pc *PathCompat) mangleName(name string) string {
+	if pc.checkName(name) == "" {
+		return name
+	}
+
+	mangled := strings.Map(func(r rune) rune {
+		if pc.forbidden(r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	mangled = strings.TrimRight(mangled, pc.TrailingForbidden)
+	if mangled == "" {
+		mangled = "_"
+	}
+
+	if pc.reserved(mangled) {
+		stem, ext, found := strings.Cut(mangled, ".")
+		mangled = stem + "_"
+		if found {
+			mangled += "." + ext
+		}
+	}
+
+	if pc.MaxName != 0 && utf16Len(mangled) > pc.MaxName {
+		// keep the extension and tell truncated names apart
+		hasher := fnv.New32a()
+		hasher.Write([]byte(name))
+		suffix := fmt.Sprintf("~%08x", hasher.Sum32())
+
+		ext := path.Ext(mangled)
+		if utf16Len(ext) > pc.MaxName/2 {
+			ext = ""
+		}
+		stem := []rune(strings.TrimSuffix(mangled, ext))
+		for len(stem) != 0 && utf16Len(string(stem))+len(suffix)+utf16Len(ext) > pc.MaxName {
+			stem = stem[:len(stem)-1]
+		}
+		mangled = string(stem) + suffix + ext
+	}
+	return mangled
+}
+
+func (pc *PathCompat) manglePath(pathname string) string {
+	components := strings.Split(pathname, "/")
+	for i, component := range components {
+		if component != "" {
+			components[i] = pc.mangleName(component)
+		}
+	}
+	return strings.Join(components, "/")
+}
+
+// restoreDestination returns where pathname is restored below target,
+// renamed to suit the target if requested.
+func restoreDestination(target string, pathname string, opts *RestoreOptions) string {
+	relpath := strings.TrimPrefix(pathname, opts.Strip)
+	if opts.PathCompat != nil && opts.Mangle {
+		relpath = opts.PathCompat.manglePath(relpath)
+	}
+	return path.Join(target, relpath)
+}
+
+// checkPathCompat walks the tree to be restored and reports every path
+// the target can't hold, along with the paths that will be renamed.
+func checkPathCompat(fsc *vfs.Filesystem, target string, pathname string, opts *RestoreOptions) ([]PathIssue, []PathIssue, error) {
+	pc := opts.PathCompat
+	issues := make([]PathIssue, 0)
+	renames := make([]PathIssue, 0)
+	seen := make(map[string]string)
+
+	err := fsc.WalkDir(pathname, func(entrypath string, entry *vfs.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relpath := strings.TrimPrefix(entrypath, opts.Strip)
+		dest := restoreDestination(target, entrypath, opts)
+
+		if opts.Mangle {
+			if mangled := pc.manglePath(relpath); mangled != relpath {
+				renames = append(renames, PathIssue{Pathname: entrypath, Reason: "renamed to " + dest})
+			}
+		} else {
+			for _, component := range strings.Split(relpath, "/") {
+				if component == "" {
+					continue
+				}
+				if reason := pc.checkName(component); reason != "" {
+					issues = append(issues, PathIssue{Pathname: entrypath, Reason: reason})
+					break
+				}
+			}
+		}
+
+		if pc.MaxPath != 0 && utf16Len(dest) > pc.MaxPath {
+			issues = append(issues, PathIssue{Pathname: entrypath,
+				Reason: fmt.Sprintf("destination is longer than %d characters", pc.MaxPath)})
+		}
+
+		if pc.MaxFileSize != 0 && entry.Stat().Mode().IsRegular() && entry.Size() > pc.MaxFileSize {
+			issues = append(issues, PathIssue{Pathname: entrypath,
+				Reason: fmt.Sprintf("file is larger than %d bytes", pc.MaxFileSize)})
+		}
+
+		if pc.CaseInsensitive {
+			key := strings.ToLower(dest)
+			if other, exists := seen[key]; exists && other != entrypath {
+				issues = append(issues, PathIssue{Pathname: entrypath,
+					Reason: "destination collides with " + other})
+			} else {
+				seen[key] = entrypath
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return issues, renames, nil
+}
@@ -0,0 +1,45 @@
+package snapshot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathCompatCheckName(t *testing.T) {
+	pc, err := GetPathCompat("windows")
+	require.NoError(t, err)
+
+	require.Empty(t, pc.checkName("report.txt"))
+	require.NotEmpty(t, pc.checkName("a:b"))
+	require.NotEmpty(t, pc.checkName("trailing."))
+	require.NotEmpty(t, pc.checkName("trailing "))
+	require.NotEmpty(t, pc.checkName("con"))
+	require.NotEmpty(t, pc.checkName("NUL.txt"))
+	require.Empty(t, pc.checkName("console"))
+	require.NotEmpty(t, pc.checkName(strings.Repeat("a", 256)))
+
+	_, err = GetPathCompat("amiga")
+	require.Error(t, err)
+}
+
+func TestPathCompatMangleName(t *testing.T) {
+	pc, err := GetPathCompat("windows")
+	require.NoError(t, err)
+
+	require.Equal(t, "report.txt", pc.mangleName("report.txt"))
+	require.Equal(t, "a_b", pc.mangleName("a:b"))
+	require.Equal(t, "trailing", pc.mangleName("trailing. "))
+	require.Equal(t, "_", pc.mangleName("..."))
+	require.Equal(t, "CON_.txt", pc.mangleName("CON.txt"))
+
+	long := strings.Repeat("a", 300) + ".txt"
+	mangled := pc.mangleName(long)
+	require.Empty(t, pc.checkName(mangled))
+	require.True(t, strings.HasSuffix(mangled, ".txt"))
+	require.Equal(t, mangled, pc.mangleName(long))
+	require.NotEqual(t, mangled, pc.mangleName(strings.Repeat("a", 301)+".txt"))
+
+	require.Equal(t, "/dir/CON_/a_b", pc.manglePath("/dir./CON/a?b"))
+}
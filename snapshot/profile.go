@@ -0,0 +1,85 @@
+package snapshot
+
+import (
+	"time"
+
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const PROFILE_VERSION = "1.0.0"
+
+func init() {
+	versioning.Register(resources.RT_PROFILE, versioning.FromString(PROFILE_VERSION))
+}
+
+// Profile records how long a backup spent in each of its phases, so that
+// gradual slowdowns can be spotted across runs.  It is stored alongside
+// the snapshot, keyed by its identifier.
+type Profile struct {
+	// Scan is the time spent reading the source and storing the files,
+	// Index building the directory summaries, Persist writing the VFS
+	// and indexes.
+	Scan    time.Duration `msgpack:"scan" json:"scan"`
+	Index   time.Duration `msgpack:"index" json:"index"`
+	Persist time.Duration `msgpack:"persist" json:"persist"`
+
+	Files           uint64 `msgpack:"files" json:"files"`
+	ChangedFiles    uint64 `msgpack:"changed_files" json:"changed_files"`
+	ScannedSize     uint64 `msgpack:"scanned_size" json:"scanned_size"`
+	TransferredSize uint64 `msgpack:"transferred_size" json:"transferred_size"`
+	CacheHits       uint64 `msgpack:"cache_hits" json:"cache_hits"`
+	CacheMisses     uint64 `msgpack:"cache_misses" json:"cache_misses"`
+	Errors          uint64 `msgpack:"errors" json:"errors"`
+	Concurrency     uint64 `msgpack:"concurrency" json:"concurrency"`
+}
+
+// Duration returns the time spent in all phases.
+func (p *Profile) Duration() time.Duration {
+	return p.Scan + p.Index + p.Persist
+}
+
+// Throughput returns the number of bytes scanned per second.
+func (p *Profile) Throughput() float64 {
+	if p.Duration() <= 0 {
+		return 0
+	}
+	return float64(p.ScannedSize) / p.Duration().Seconds()
+}
+
+// HitRatio returns the share of regular files whose content was known
+// from the cache, between 0 and 1.
+func (p *Profile) HitRatio() float64 {
+	if p.CacheHits+p.CacheMisses == 0 {
+		return 0
+	}
+	return float64(p.CacheHits) / float64(p.CacheHits+p.CacheMisses)
+}
+
+func (snap *Snapshot) putProfile(profile *Profile) error {
+	data, err := msgpack.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return snap.PutBlob(resources.RT_PROFILE, snap.Header.Identifier, data)
+}
+
+func (snap *Snapshot) HasProfile() bool {
+	return snap.BlobExists(resources.RT_PROFILE, snap.Header.Identifier)
+}
+
+// GetProfile returns the profile of the backup run which produced the
+// snapshot, snapshots predating profiles have none.
+func (snap *Snapshot) GetProfile() (*Profile, error) {
+	data, err := snap.GetBlob(resources.RT_PROFILE, snap.Header.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if err := msgpack.Unmarshal(data, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
@@ -0,0 +1,28 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	snap2, err := Load(snap.repository, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer snap2.Close()
+
+	require.True(t, snap2.HasProfile())
+	profile, err := snap2.GetProfile()
+	require.NoError(t, err)
+
+	require.Equal(t, profile.Scan+profile.Index+profile.Persist, profile.Duration())
+	require.NotZero(t, profile.Files)
+	require.Equal(t, uint64(1), profile.Concurrency)
+	require.Zero(t, profile.Errors)
+}
@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+// CachePackfiles records in the maintenance cache the packfiles each
+// snapshot of the repository relies on.  Only the snapshots not cached yet
+// are resolved, and the ones deleted since are forgotten, so that the
+// cache counts the references to every packfile.
+func CachePackfiles(repo *repository.Repository, cache *caching.MaintenanceCache) error {
+	for snapshotID := range repo.ListSnapshots() {
+		ok, err := cache.HasSnapshot(snapshotID)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			continue
+		}
+
+		snap, err := Load(repo, snapshotID)
+		if err != nil {
+			return err
+		}
+
+		err = cacheSnapshotPackfiles(snap, cache)
+		snap.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// While ListSnapshots doesn't return deleted snapshots, we still need to
+	// go over them to remove previously added one to our local cache.
+	for snapshotID := range repo.ListDeletedSnapShots() {
+		ok, err := cache.HasSnapshot(snapshotID)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		cache.DeleletePackfiles(snapshotID)
+		cache.DeleteSnapshot(snapshotID)
+	}
+
+	return nil
+}
+
+func cacheSnapshotPackfiles(snap *Snapshot, cache *caching.MaintenanceCache) error {
+	iter, err := snap.ListPackfiles()
+	if err != nil {
+		return err
+	}
+
+	for packfile, err := range iter {
+		if err != nil {
+			return err
+		}
+
+		if err := cache.PutPackfile(snap.Header.Identifier, packfile); err != nil {
+			return err
+		}
+	}
+
+	return cache.PutSnapshot(snap.Header.Identifier, nil)
+}
+
+// UnreferencedPackfiles returns the packfiles the given snapshots rely on
+// that no other snapshot in the maintenance cache relies on.
+func UnreferencedPackfiles(cache *caching.MaintenanceCache, snapshotIDs []objects.MAC) []objects.MAC {
+	removed := make(map[objects.MAC]struct{}, len(snapshotIDs))
+	for _, snapshotID := range snapshotIDs {
+		removed[snapshotID] = struct{}{}
+	}
+
+	seen := make(map[objects.MAC]struct{})
+	unreferenced := []objects.MAC{}
+	for _, snapshotID := range snapshotIDs {
+		for packfileMAC := range cache.GetPackfiles(snapshotID) {
+			if _, ok := seen[packfileMAC]; ok {
+				continue
+			}
+			seen[packfileMAC] = struct{}{}
+
+			referenced := false
+			for other := range cache.GetSnapshots(packfileMAC) {
+				if _, ok := removed[other]; !ok {
+					referenced = true
+					break
+				}
+			}
+			if !referenced {
+				unreferenced = append(unreferenced, packfileMAC)
+			}
+		}
+	}
+
+	return unreferenced
+}
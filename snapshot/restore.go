@@ -1,13 +1,17 @@
 package snapshot
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 )
@@ -15,23 +19,104 @@ import (
 type RestoreOptions struct {
 	MaxConcurrency uint64
 	Strip          string
+
+	// BrowseFirst materializes the directory tree and empty files of
+	// their final size before any content is restored.
+	BrowseFirst bool
+
+	// Verify reads every restored file back and compares its MAC to the
+	// one recorded in the snapshot.
+	Verify bool
+
+	// PathCompat, if set, has the tree checked against the naming limits
+	// of the target before anything is restored.  Unless Mangle is set,
+	// any problematic path aborts the restore.
+	PathCompat *PathCompat
+	Mangle     bool
+
+	// MetadataSidecar writes the ownership, modes and attributes of the
+	// restored entries to a sidecar file at the root of the restore, so
+	// that they can be applied later on, with privileges.
+	MetadataSidecar bool
+
+	// Delta only writes the files that are missing from the destination
+	// or differ from the snapshot, the others are left untouched.
+	Delta bool
+
+	// BestEffort, BEST_EFFORT_ZERO or BEST_EFFORT_TRUNCATE, restores what
+	// can be read from a damaged repository instead of failing, the files
+	// that are incomplete being listed in the INCOMPLETE_MANIFEST file at
+	// the root of the restore.
+	BestEffort string
 }
 
 type restoreContext struct {
 	hardlinks      map[string]string
 	hardlinksMutex sync.Mutex
 	maxConcurrency chan bool
+
+	verified   atomic.Uint64
+	mismatches atomic.Uint64
+
+	created atomic.Uint64
+	updated atomic.Uint64
+	skipped atomic.Uint64
+
+	metadata   *metadataSidecar
+	incomplete *incompleteManifest
+}
+
+func verifyRestoredFile(snap *Snapshot, exp exporter.Exporter, dest string, entry *vfs.Entry) (bool, error) {
+	rd, err := exp.(exporter.FileReader).ReadFile(dest)
+	if err != nil {
+		return false, err
+	}
+	defer rd.Close()
+
+	hasher := snap.repository.GetMACHasher()
+	if _, err := io.Copy(hasher, rd); err != nil {
+		return false, err
+	}
+
+	return objects.MAC(hasher.Sum(nil)) == entry.ResolvedObject.ContentMAC, nil
+}
+
+// upToDate reports whether dest exists and whether it holds the content
+// of entry: a regular file of the same size and modification time is
+// trusted, otherwise its MAC is compared to the one of the snapshot.
+func upToDate(snap *Snapshot, exp exporter.Exporter, dest string, entry *vfs.Entry) (bool, bool, error) {
+	fileinfo, err := exp.(exporter.FileStater).StatFile(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	if !fileinfo.Mode().IsRegular() || fileinfo.Size() != entry.Size() {
+		return true, false, nil
+	}
+	if fileinfo.ModTime().Equal(entry.Stat().ModTime()) {
+		return true, true, nil
+	}
+	if entry.ResolvedObject == nil {
+		return true, entry.Size() == 0, nil
+	}
+	current, err := verifyRestoredFile(snap, exp, dest, entry)
+	return true, current, err
 }
 
 func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Exporter, target string, base string, pathname string, opts *RestoreOptions, restoreContext *restoreContext, wg *sync.WaitGroup) error {
 	snap.Event(events.PathEvent(snap.Header.Identifier, pathname))
+	dest := restoreDestination(target, pathname, opts)
 	entry, err := fsc.GetEntry(pathname)
 	if err != nil {
 		snap.Event(events.DirectoryMissingEvent(snap.Header.Identifier, pathname))
+		if restoreContext.incomplete != nil {
+			return restoreContext.incomplete.record(target, dest, &IncompleteFile{Reason: err.Error()})
+		}
 		return err
 	}
 
-	dest := path.Join(target, strings.TrimPrefix(pathname, opts.Strip))
 	if entry.IsDir() {
 		snap.Event(events.DirectoryEvent(snap.Header.Identifier, pathname))
 
@@ -47,6 +132,10 @@ func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Expor
 
 		iter, err := entry.Getdents(fsc)
 		if err != nil {
+			if restoreContext.incomplete != nil {
+				snap.Event(events.DirectoryCorruptedEvent(snap.Header.Identifier, pathname))
+				return restoreContext.incomplete.record(target, dest, &IncompleteFile{Reason: err.Error()})
+			}
 			return err
 		}
 
@@ -63,6 +152,12 @@ func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Expor
 			return err
 		} else {
 			if pathname != "/" {
+				if restoreContext.metadata != nil {
+					if err := restoreContext.metadata.record(fsc, target, dest, entry); err != nil {
+						snap.Event(events.DirectoryErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+						return err
+					}
+				}
 				if err := exp.SetPermissions(dest, entry.Stat()); err != nil {
 					snap.Event(events.DirectoryErrorEvent(snap.Header.Identifier, pathname, err.Error()))
 					return err
@@ -85,6 +180,30 @@ func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Expor
 		defer wg.Done()
 		defer func() { <-restoreContext.maxConcurrency }()
 
+		if opts.Delta {
+			exists, current, err := upToDate(snap, exp, dest, entry)
+			if err != nil {
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+				return
+			}
+			if current {
+				restoreContext.skipped.Add(1)
+				if restoreContext.metadata != nil {
+					if err := restoreContext.metadata.record(fsc, target, dest, entry); err != nil {
+						snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+						return
+					}
+				}
+				snap.Event(events.FileOKEvent(snap.Header.Identifier, pathname, entry.Size()))
+				return
+			}
+			if exists {
+				restoreContext.updated.Add(1)
+			} else {
+				restoreContext.created.Add(1)
+			}
+		}
+
 		if entry.Stat().Nlink() > 1 {
 			key := fmt.Sprintf("%d:%d", entry.Stat().Dev(), entry.Stat().Ino())
 			restoreContext.hardlinksMutex.Lock()
@@ -100,10 +219,17 @@ func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Expor
 			}
 		}
 
-		rd, err := snap.NewReader(pathname)
-		if err != nil {
-			snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
-			return
+		var rd io.ReadCloser
+		var partial *bestEffortReader
+		if restoreContext.incomplete != nil && entry.ResolvedObject != nil {
+			partial = newBestEffortReader(snap, entry.ResolvedObject, opts.BestEffort)
+			rd = partial
+		} else {
+			var err error
+			if rd, err = snap.NewReader(pathname); err != nil {
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+				return
+			}
 		}
 		defer rd.Close()
 
@@ -111,10 +237,55 @@ func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Expor
 			snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
 		}
 
-		if err := exp.StoreFile(dest, rd); err != nil {
+		if xs, ok := exp.(exporter.ExtendedAttributeStorer); ok && len(entry.ExtendedAttributes) != 0 {
+			xattrs, err := entryXattrs(fsc, entry)
+			if err != nil {
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+				return
+			}
+			if err := xs.StoreFileWithAttributes(dest, rd, xattrs); err != nil {
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+				return
+			}
+		} else if err := exp.StoreFile(dest, rd); err != nil {
 			snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
-		} else if err := exp.SetPermissions(dest, entry.Stat()); err != nil {
+			return
+		}
+
+		incomplete := partial != nil && len(partial.gaps) != 0
+		if incomplete {
+			err := restoreContext.incomplete.record(target, dest, &IncompleteFile{
+				Size:      entry.Size(),
+				Restored:  partial.restored,
+				Truncated: partial.truncated,
+				Gaps:      partial.gaps,
+			})
+			if err != nil {
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+			}
+		}
+
+		if restoreContext.metadata != nil {
+			if err := restoreContext.metadata.record(fsc, target, dest, entry); err != nil {
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+			}
+		}
+
+		if err := exp.SetPermissions(dest, entry.Stat()); err != nil {
 			snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+		} else if incomplete {
+			snap.Event(events.FileCorruptedEvent(snap.Header.Identifier, pathname))
+		} else if opts.Verify && entry.ResolvedObject != nil {
+			restoreContext.verified.Add(1)
+			if ok, err := verifyRestoredFile(snap, exp, dest, entry); err != nil {
+				restoreContext.mismatches.Add(1)
+				snap.Event(events.FileErrorEvent(snap.Header.Identifier, pathname, err.Error()))
+			} else if !ok {
+				restoreContext.mismatches.Add(1)
+				snap.Event(events.FileCorruptedEvent(snap.Header.Identifier, pathname))
+			} else {
+				snap.Event(events.FileOKEvent(snap.Header.Identifier, pathname, entry.Size()))
+			}
 		} else {
 			snap.Event(events.FileOKEvent(snap.Header.Identifier, pathname, entry.Size()))
 		}
@@ -123,15 +294,82 @@ func snapshotRestorePath(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Expor
 	return nil
 }
 
+func snapshotRestoreStructure(snap *Snapshot, fsc *vfs.Filesystem, exp exporter.Exporter, target string, pathname string, opts *RestoreOptions) error {
+	entry, err := fsc.GetEntry(pathname)
+	if err != nil {
+		return err
+	}
+
+	dest := restoreDestination(target, pathname, opts)
+	if !entry.IsDir() {
+		// hardlinks are created by the content pass, a placeholder
+		// would be in the way.
+		if !entry.Stat().Mode().IsRegular() || entry.Stat().Nlink() > 1 {
+			return nil
+		}
+		pc, ok := exp.(exporter.PlaceholderCreator)
+		if !ok {
+			return nil
+		}
+		if err := exp.CreateDirectory(path.Dir(dest)); err != nil {
+			return err
+		}
+		return pc.CreatePlaceholder(dest, entry.Stat())
+	}
+
+	if pathname != "/" {
+		if err := exp.CreateDirectory(dest); err != nil {
+			return err
+		}
+	}
+
+	iter, err := entry.Getdents(fsc)
+	if err != nil {
+		return err
+	}
+	for child := range iter {
+		err := snapshotRestoreStructure(snap, fsc, exp, target, path.Join(pathname, child.Stat().Name()), opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (snap *Snapshot) Restore(exp exporter.Exporter, base string, pathname string, opts *RestoreOptions) error {
 	snap.Event(events.StartEvent())
 	defer snap.Event(events.DoneEvent())
 
+	if snap.Header.MetadataOnly {
+		return ErrMetadataOnly
+	}
+
 	fs, err := snap.Filesystem()
 	if err != nil {
 		return err
 	}
 
+	if opts.Verify {
+		if _, ok := exp.(exporter.FileReader); !ok {
+			return fmt.Errorf("exporter does not support restore verification")
+		}
+	}
+	if opts.Delta {
+		_, canStat := exp.(exporter.FileStater)
+		_, canRead := exp.(exporter.FileReader)
+		if !canStat || !canRead {
+			return fmt.Errorf("exporter does not support delta restores")
+		}
+		if opts.BrowseFirst {
+			return fmt.Errorf("delta restores can't materialize the structure first")
+		}
+	}
+	switch opts.BestEffort {
+	case "", BEST_EFFORT_ZERO, BEST_EFFORT_TRUNCATE:
+	default:
+		return fmt.Errorf("invalid best-effort mode: %s", opts.BestEffort)
+	}
+
 	maxConcurrency := opts.MaxConcurrency
 	if maxConcurrency == 0 {
 		maxConcurrency = uint64(snap.AppContext().MaxConcurrency)
@@ -149,8 +387,86 @@ func (snap *Snapshot) Restore(exp exporter.Exporter, base string, pathname strin
 		base = base + "/"
 	}
 
+	if opts.PathCompat != nil {
+		issues, renames, err := checkPathCompat(fs, base, pathname, opts)
+		if err != nil {
+			return err
+		}
+		for _, rename := range renames {
+			snap.Logger().Info("restore: %s: %s", rename.Pathname, rename.Reason)
+		}
+		for _, issue := range issues {
+			snap.Logger().Warn("restore: %s: %s", issue.Pathname, issue.Reason)
+		}
+		if len(issues) != 0 {
+			return fmt.Errorf("%w (%s): %d problematic paths", ErrIncompatiblePaths, opts.PathCompat.Name, len(issues))
+		}
+	}
+
+	if opts.BrowseFirst {
+		if err := snapshotRestoreStructure(snap, fs, exp, base, pathname, opts); err != nil {
+			return err
+		}
+		snap.Logger().Info("restore: structure of %s materialized, restoring contents", pathname)
+	}
+
+	if opts.MetadataSidecar {
+		if restoreContext.metadata, err = newMetadataSidecar(); err != nil {
+			return err
+		}
+	}
+	if opts.BestEffort != "" {
+		if restoreContext.incomplete, err = newIncompleteManifest(); err != nil {
+			if restoreContext.metadata != nil {
+				restoreContext.metadata.discard()
+			}
+			return err
+		}
+	}
+
 	wg := sync.WaitGroup{}
-	defer wg.Wait()
+	err = snapshotRestorePath(snap, fs, exp, base, pathname, pathname, opts, restoreContext, &wg)
+	wg.Wait()
+	if err != nil {
+		if restoreContext.metadata != nil {
+			restoreContext.metadata.discard()
+		}
+		if restoreContext.incomplete != nil {
+			restoreContext.incomplete.discard()
+		}
+		return err
+	}
 
-	return snapshotRestorePath(snap, fs, exp, base, pathname, pathname, opts, restoreContext, &wg)
+	var incomplete int
+	if restoreContext.incomplete != nil {
+		incomplete = restoreContext.incomplete.count
+		if err := restoreContext.incomplete.store(exp, base); err != nil {
+			return err
+		}
+	}
+
+	if restoreContext.metadata != nil {
+		if err := restoreContext.metadata.store(exp, base); err != nil {
+			return err
+		}
+		snap.Logger().Info("restore: metadata of restored entries written to %s", path.Join(base, METADATA_SIDECAR))
+	}
+
+	if opts.Delta {
+		snap.Logger().Info("restore: %d files created, %d updated, %d skipped",
+			restoreContext.created.Load(), restoreContext.updated.Load(), restoreContext.skipped.Load())
+	}
+
+	if opts.Verify {
+		verified, mismatches := restoreContext.verified.Load(), restoreContext.mismatches.Load()
+		snap.Logger().Info("restore: verified %d files, %d mismatches", verified, mismatches)
+		if mismatches != 0 {
+			return fmt.Errorf("verification failed for %d of %d restored files", mismatches, verified)
+		}
+	}
+
+	if incomplete != 0 {
+		return fmt.Errorf("%w: %d entries could not be fully restored, see %s", ErrIncompleteRestore, incomplete, path.Join(base, INCOMPLETE_MANIFEST))
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package snapshot
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -57,3 +58,218 @@ func TestRestore(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "hello", string(contents))
 }
+
+func TestRestoreBrowseFirst(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	opts := &RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+		BrowseFirst:    true,
+	}
+
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), snap.Header.GetSource(0).Importer.Directory, opts)
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(fmt.Sprintf("%s/dummy.txt", exporterInstance.Root()))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+}
+
+func TestRestoreVerify(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	opts := &RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+		Verify:         true,
+	}
+
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), snap.Header.GetSource(0).Importer.Directory, opts)
+	require.NoError(t, err)
+}
+
+func TestRestoreMetadataSidecar(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	opts := &RestoreOptions{
+		MaxConcurrency:  1,
+		Strip:           snap.Header.GetSource(0).Importer.Directory,
+		MetadataSidecar: true,
+	}
+
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), snap.Header.GetSource(0).Importer.Directory, opts)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(fmt.Sprintf("%s/%s", exporterInstance.Root(), METADATA_SIDECAR))
+	require.NoError(t, err)
+
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var md RestoreMetadata
+		require.NoError(t, json.Unmarshal([]byte(line), &md))
+		if md.Path == "dummy.txt" {
+			found = true
+			require.Equal(t, uint64(os.Getuid()), md.Uid)
+			require.Len(t, md.Mode, 4)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestRestoreDelta(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.repository.RebuildState()
+	require.NoError(t, err)
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	opts := &RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+		Delta:          true,
+	}
+	restore := func() string {
+		err := snap.Restore(exporterInstance, exporterInstance.Root(), snap.Header.GetSource(0).Importer.Directory, opts)
+		require.NoError(t, err)
+		contents, err := os.ReadFile(fmt.Sprintf("%s/dummy.txt", exporterInstance.Root()))
+		require.NoError(t, err)
+		return string(contents)
+	}
+
+	// missing files are created
+	require.Equal(t, "hello", restore())
+
+	// a file of the same size but different content is rewritten
+	dest := fmt.Sprintf("%s/dummy.txt", exporterInstance.Root())
+	require.NoError(t, os.WriteFile(dest, []byte("jello"), 0644))
+	require.Equal(t, "hello", restore())
+
+	// a file of the same size and modification time is trusted
+	fsc, err := snap.Filesystem()
+	require.NoError(t, err)
+	entry, err := fsc.GetEntry(snap.Header.GetSource(0).Importer.Directory + "/dummy.txt")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dest, []byte("jello"), 0644))
+	require.NoError(t, os.Chtimes(dest, entry.Stat().ModTime(), entry.Stat().ModTime()))
+	require.Equal(t, "jello", restore())
+
+	// files that aren't part of the snapshot are left alone
+	extra := fmt.Sprintf("%s/extra.txt", exporterInstance.Root())
+	require.NoError(t, os.WriteFile(extra, []byte("extra"), 0644))
+	restore()
+	_, err = os.Stat(extra)
+	require.NoError(t, err)
+
+	opts.BrowseFirst = true
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), snap.Header.GetSource(0).Importer.Directory, opts)
+	require.Error(t, err)
+}
+
+func TestRestoreBestEffort(t *testing.T) {
+	for _, mode := range []string{BEST_EFFORT_ZERO, BEST_EFFORT_TRUNCATE} {
+		t.Run(mode, func(t *testing.T) {
+			snap := generateSnapshot(t, nil)
+			defer snap.Close()
+
+			require.NoError(t, snap.repository.RebuildState())
+			_, chunkMAC := dropFileChunk(t, snap, "dummy.txt")
+
+			reloaded, err := Load(snap.repository, snap.Header.Identifier)
+			require.NoError(t, err)
+			defer reloaded.Close()
+
+			tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				os.RemoveAll(tmpRestoreDir)
+			})
+			exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+			require.NoError(t, err)
+			defer exporterInstance.Close()
+
+			directory := snap.Header.GetSource(0).Importer.Directory
+			opts := &RestoreOptions{
+				MaxConcurrency: 1,
+				Strip:          directory,
+				BestEffort:     mode,
+			}
+			err = reloaded.Restore(exporterInstance, exporterInstance.Root(), directory, opts)
+			require.ErrorIs(t, err, ErrIncompleteRestore)
+
+			contents, err := os.ReadFile(fmt.Sprintf("%s/dummy.txt", exporterInstance.Root()))
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(fmt.Sprintf("%s/%s", exporterInstance.Root(), INCOMPLETE_MANIFEST))
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			require.Len(t, lines, 1)
+
+			var file IncompleteFile
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &file))
+			require.Equal(t, "dummy.txt", file.Path)
+			require.Equal(t, int64(5), file.Size)
+			require.Equal(t, int64(0), file.Restored)
+			require.Len(t, file.Gaps, 1)
+			require.Equal(t, int64(0), file.Gaps[0].Offset)
+			require.Equal(t, int64(5), file.Gaps[0].Length)
+			require.Contains(t, file.Gaps[0].Reason, fmt.Sprintf("%x", chunkMAC))
+
+			if mode == BEST_EFFORT_ZERO {
+				require.False(t, file.Truncated)
+				require.Equal(t, make([]byte, 5), contents)
+			} else {
+				require.True(t, file.Truncated)
+				require.Empty(t, contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+// METADATA_SIDECAR is the file, at the root of a restore, where the
+// metadata of restored entries is written for later application.
+const METADATA_SIDECAR = ".plakar-metadata"
+
+// RestoreMetadata holds what a restore may not be able to apply, such as
+// ownership when not running as root or attributes foreign to the target
+// system.  One is written per line, in JSON, to the metadata sidecar, with
+// a path relative to the restore root.
+type RestoreMetadata struct {
+	Path    string    `json:"path"`
+	Mode    string    `json:"mode"`
+	Uid     uint64    `json:"uid"`
+	Gid     uint64    `json:"gid"`
+	User    string    `json:"user,omitempty"`
+	Group   string    `json:"group,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+
+	Xattrs             map[string][]byte `json:"xattrs,omitempty"`
+	SecurityDescriptor []byte            `json:"security_descriptor,omitempty"`
+	FileAttributes     uint32            `json:"file_attributes,omitempty"`
+}
+
+// unixMode returns the mode bits as chmod(1) expects them.
+func unixMode(mode fs.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// entryXattrs returns the extended attributes of entry with their values.
+func entryXattrs(fsc *vfs.Filesystem, entry *vfs.Entry) (map[string][]byte, error) {
+	xattrs := make(map[string][]byte, len(entry.ExtendedAttributes))
+	for _, name := range entry.ExtendedAttributes {
+		rd, err := entry.Xattr(fsc, name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := io.ReadAll(rd)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+type metadataSidecar struct {
+	mu      sync.Mutex
+	fp      *os.File
+	encoder *json.Encoder
+}
+
+func newMetadataSidecar() (*metadataSidecar, error) {
+	fp, err := os.CreateTemp("", "plakar-metadata-")
+	if err != nil {
+		return nil, err
+	}
+	return &metadataSidecar{fp: fp, encoder: json.NewEncoder(fp)}, nil
+}
+
+func (ms *metadataSidecar) record(fsc *vfs.Filesystem, base string, dest string, entry *vfs.Entry) error {
+	relpath := strings.TrimPrefix(dest, base)
+	if relpath == "" || dest+"/" == base {
+		relpath = "."
+	}
+
+	fileinfo := entry.Stat()
+	md := RestoreMetadata{
+		Path:               relpath,
+		Mode:               fmt.Sprintf("%04o", unixMode(fileinfo.Mode())),
+		Uid:                fileinfo.Uid(),
+		Gid:                fileinfo.Gid(),
+		User:               fileinfo.Username(),
+		Group:              fileinfo.Groupname(),
+		ModTime:            fileinfo.ModTime(),
+		SecurityDescriptor: entry.SecurityDescriptor,
+		FileAttributes:     entry.FileAttributes,
+	}
+
+	if len(entry.ExtendedAttributes) != 0 {
+		xattrs, err := entryXattrs(fsc, entry)
+		if err != nil {
+			return err
+		}
+		md.Xattrs = xattrs
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.encoder.Encode(md)
+}
+
+// store writes the sidecar at the root of the restore and discards the
+// temporary file it was accumulated in.
+func (ms *metadataSidecar) store(exp exporter.Exporter, base string) error {
+	defer os.Remove(ms.fp.Name())
+	defer ms.fp.Close()
+
+	if _, err := ms.fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return exp.StoreFile(path.Join(base, METADATA_SIDECAR), ms.fp)
+}
+
+func (ms *metadataSidecar) discard() {
+	ms.fp.Close()
+	os.Remove(ms.fp.Name())
+}
@@ -0,0 +1,176 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+)
+
+// INCOMPLETE_MANIFEST is the file, at the root of a best-effort restore,
+// listing the files that could not be fully restored.
+const INCOMPLETE_MANIFEST = ".plakar-incomplete"
+
+const (
+	// BEST_EFFORT_ZERO fills the unreadable chunks of a file with zeroes,
+	// so that it keeps its size and the offsets of the data around them.
+	BEST_EFFORT_ZERO = "zero"
+
+	// BEST_EFFORT_TRUNCATE stops a file at its first unreadable chunk.
+	BEST_EFFORT_TRUNCATE = "truncate"
+)
+
+// ErrIncompleteRestore is returned by best-effort restores once done, if
+// some entries could not be fully restored.
+var ErrIncompleteRestore = errors.New("incomplete restore")
+
+// RestoreGap is a range of a file whose content could not be read.
+type RestoreGap struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Reason string `json:"reason"`
+}
+
+// IncompleteFile describes an entry a best-effort restore could not fully
+// recover.  One is written per line, in JSON, to the incomplete manifest,
+// with a path relative to the restore root.  Restored is the number of
+// bytes recovered from the snapshot, which is zero for entries that could
+// not be restored at all, as told by Reason.
+type IncompleteFile struct {
+	Path      string       `json:"path"`
+	Size      int64        `json:"size"`
+	Restored  int64        `json:"restored"`
+	Truncated bool         `json:"truncated,omitempty"`
+	Gaps      []RestoreGap `json:"gaps,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+}
+
+// bestEffortReader reads the chunks of an object, verifying each one, and
+// replaces those that can't be read with zeroes or ends the file there.
+type bestEffortReader struct {
+	snap     *Snapshot
+	chunks   []objects.Chunk
+	truncate bool
+
+	next   int
+	buffer []byte
+	offset int64
+
+	restored  int64
+	truncated bool
+	gaps      []RestoreGap
+}
+
+func newBestEffortReader(snap *Snapshot, object *objects.Object, mode string) *bestEffortReader {
+	return &bestEffortReader{
+		snap:     snap,
+		chunks:   object.Chunks,
+		truncate: mode == BEST_EFFORT_TRUNCATE,
+	}
+}
+
+func (br *bestEffortReader) readChunk(chunk objects.Chunk) ([]byte, error) {
+	data, err := br.snap.GetBlob(resources.RT_CHUNK, chunk.ContentMAC)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %x: %w", chunk.ContentMAC, err)
+	}
+	if uint32(len(data)) != chunk.Length {
+		return nil, fmt.Errorf("chunk %x has length %d, expected %d", chunk.ContentMAC, len(data), chunk.Length)
+	}
+	if br.snap.repository.ComputeMAC(data) != chunk.ContentMAC {
+		return nil, fmt.Errorf("chunk %x is corrupted", chunk.ContentMAC)
+	}
+	return data, nil
+}
+
+func (br *bestEffortReader) Read(p []byte) (int, error) {
+	for len(br.buffer) == 0 {
+		if br.truncated || br.next == len(br.chunks) {
+			return 0, io.EOF
+		}
+
+		chunk := br.chunks[br.next]
+		br.next++
+
+		data, err := br.readChunk(chunk)
+		if err != nil {
+			br.gaps = append(br.gaps, RestoreGap{
+				Offset: br.offset,
+				Length: int64(chunk.Length),
+				Reason: err.Error(),
+			})
+			if br.truncate {
+				br.truncated = true
+				return 0, io.EOF
+			}
+			data = make([]byte, chunk.Length)
+		} else {
+			br.restored += int64(len(data))
+		}
+		br.offset += int64(chunk.Length)
+		br.buffer = data
+	}
+
+	n := copy(p, br.buffer)
+	br.buffer = br.buffer[n:]
+	return n, nil
+}
+
+func (br *bestEffortReader) Close() error {
+	return nil
+}
+
+type incompleteManifest struct {
+	mu      sync.Mutex
+	count   int
+	fp      *os.File
+	encoder *json.Encoder
+}
+
+func newIncompleteManifest() (*incompleteManifest, error) {
+	fp, err := os.CreateTemp("", "plakar-incomplete-")
+	if err != nil {
+		return nil, err
+	}
+	return &incompleteManifest{fp: fp, encoder: json.NewEncoder(fp)}, nil
+}
+
+func (im *incompleteManifest) record(base string, dest string, file *IncompleteFile) error {
+	file.Path = strings.TrimPrefix(dest, base)
+	if file.Path == "" || dest+"/" == base {
+		file.Path = "."
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.count++
+	return im.encoder.Encode(file)
+}
+
+// store writes the manifest at the root of the restore, if any file was
+// incomplete, and discards the temporary file it was accumulated in.
+func (im *incompleteManifest) store(exp exporter.Exporter, base string) error {
+	defer os.Remove(im.fp.Name())
+	defer im.fp.Close()
+
+	if im.count == 0 {
+		return nil
+	}
+	if _, err := im.fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return exp.StoreFile(path.Join(base, INCOMPLETE_MANIFEST), im.fp)
+}
+
+func (im *incompleteManifest) discard() {
+	im.fp.Close()
+	os.Remove(im.fp.Name())
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -26,7 +29,9 @@ import (
 )
 
 var (
-	ErrNotFound = errors.New("snapshot not found")
+	ErrNotFound     = errors.New("snapshot not found")
+	ErrLeaseExpired = errors.New("repository lease expired, maintenance may have collected data this snapshot relies on")
+	ErrMetadataOnly = errors.New("snapshot is metadata-only and holds no file content")
 )
 
 type Snapshot struct {
@@ -35,14 +40,43 @@ type Snapshot struct {
 
 	deltaState *state.LocalState
 
+	// syncJournal, when set, records the packfiles written by this
+	// snapshot so an interrupted Synchronize() can resume.
+	syncJournal   *caching.SyncCache
+	syncJournalID objects.MAC
+
 	filesystem *vfs.Filesystem
 
 	SkipDirs []string
 
+	// TimestampAuthority is the URL of an RFC3161 timestamping authority
+	// the header is submitted to on Commit().
+	TimestampAuthority string
+
 	Header *header.Header
 
 	packerChan     chan interface{}
 	packerChanDone chan bool
+	packerStop     sync.Once
+
+	// aborting makes the packer drop the blobs still queued.
+	aborting atomic.Bool
+
+	// leaseEpoch is set once Lock() installed our lease, leaseRefreshed
+	// holds the UnixNano time it was last written to the repository.
+	leaseEpoch     time.Time
+	leaseRefreshed atomic.Int64
+
+	// deltaCompression stores new chunks as deltas against similar ones.
+	deltaCompression bool
+
+	wholeFileThreshold uint32
+
+	// mailboxChunking cuts mbox files on message boundaries.
+	mailboxChunking bool
+
+	// transferred accounts for the encoded size of the blobs written.
+	transferred atomic.Uint64
 }
 
 func New(repo *repository.Repository) (*Snapshot, error) {
@@ -217,24 +251,50 @@ func getPackfileForBlobWithError(snap *Snapshot, res resources.Type, mac objects
 	}
 }
 
-func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
+// BlobRef designates a blob the snapshot relies on.
+type BlobRef struct {
+	Type resources.Type
+	MAC  objects.MAC
+}
+
+// ListBlobs walks the snapshot and yields every blob it relies on, a blob
+// may be yielded more than once.
+func (snap *Snapshot) ListBlobs() (iter.Seq2[BlobRef, error], error) {
 	pvfs, err := snap.Filesystem()
 	if err != nil {
 		return nil, err
 	}
 
-	return func(yield func(objects.MAC, error) bool) {
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_SNAPSHOT, snap.Header.Identifier)) {
+	return func(yield func(BlobRef, error) bool) {
+		if !yield(BlobRef{resources.RT_SNAPSHOT, snap.Header.Identifier}, nil) {
 			return
 		}
 
 		if snap.Header.Identity.Identifier != uuid.Nil {
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_SIGNATURE, snap.Header.Identifier)) {
+			if !yield(BlobRef{resources.RT_SIGNATURE, snap.Header.Identifier}, nil) {
 				return
 			}
 		}
 
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_VFS_BTREE, snap.Header.Sources[0].VFS.Root)) {
+		if snap.HasTimestamp() {
+			if !yield(BlobRef{resources.RT_TIMESTAMP, snap.Header.Identifier}, nil) {
+				return
+			}
+		}
+
+		if snap.HasProfile() {
+			if !yield(BlobRef{resources.RT_PROFILE, snap.Header.Identifier}, nil) {
+				return
+			}
+		}
+
+		if snap.HasTextIndex() {
+			if !yield(BlobRef{resources.RT_TEXT_INDEX, snap.Header.Identifier}, nil) {
+				return
+			}
+		}
+
+		if !yield(BlobRef{resources.RT_VFS_BTREE, snap.Header.Sources[0].VFS.Root}, nil) {
 			return
 		}
 
@@ -242,30 +302,39 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 		fsIter := pvfs.IterNodes()
 		for fsIter.Next() {
 			macNode, node := fsIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_VFS_NODE, macNode)) {
+			if !yield(BlobRef{resources.RT_VFS_NODE, macNode}, nil) {
 				return
 			}
 
 			for _, entry := range node.Values {
-				if !yield(getPackfileForBlobWithError(snap, resources.RT_VFS_ENTRY, entry)) {
+				if !yield(BlobRef{resources.RT_VFS_ENTRY, entry}, nil) {
 					return
 				}
 
 				vfsEntry, err := pvfs.ResolveEntry(entry)
 				if err != nil {
-					if !yield(objects.MAC{}, fmt.Errorf("Failed to resolve entry %x", entry)) {
+					if !yield(BlobRef{}, fmt.Errorf("Failed to resolve entry %x", entry)) {
 						return
 					}
+					continue
 				}
 
 				if vfsEntry.HasObject() {
-					if !yield(getPackfileForBlobWithError(snap, resources.RT_OBJECT, vfsEntry.Object)) {
+					if !yield(BlobRef{resources.RT_OBJECT, vfsEntry.Object}, nil) {
 						return
 					}
 
 					for _, chunk := range vfsEntry.ResolvedObject.Chunks {
-						if !yield(getPackfileForBlobWithError(snap, resources.RT_CHUNK, chunk.ContentMAC)) {
-							return
+						blobs, err := snap.chunkBlobs(chunk.ContentMAC)
+						if err != nil {
+							if !yield(BlobRef{}, fmt.Errorf("Could not find packfile for chunk %x: %s", chunk.ContentMAC, err)) {
+								return
+							}
+						}
+						for _, blob := range blobs {
+							if !yield(blob, nil) {
+								return
+							}
 						}
 					}
 
@@ -275,72 +344,108 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 
 		}
 
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_ERROR_BTREE, snap.Header.Sources[0].VFS.Errors)) {
+		if !yield(BlobRef{resources.RT_ERROR_BTREE, snap.Header.Sources[0].VFS.Errors}, nil) {
 			return
 		}
 		errIter := pvfs.IterErrorNodes()
 		for errIter.Next() {
 			macNode, node := errIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_ERROR_NODE, macNode)) {
+			if !yield(BlobRef{resources.RT_ERROR_NODE, macNode}, nil) {
 				return
 			}
 
 			for _, error := range node.Values {
-				if !yield(getPackfileForBlobWithError(snap, resources.RT_ERROR_ENTRY, error)) {
+				if !yield(BlobRef{resources.RT_ERROR_ENTRY, error}, nil) {
 					return
 				}
 			}
 		}
 
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_XATTR_BTREE, snap.Header.Sources[0].VFS.Xattrs)) {
+		if !yield(BlobRef{resources.RT_XATTR_BTREE, snap.Header.Sources[0].VFS.Xattrs}, nil) {
 			return
 		}
 		xattrIter := pvfs.XattrNodes()
 		for xattrIter.Next() {
 			mac, node := xattrIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_XATTR_NODE, mac)) {
+			if !yield(BlobRef{resources.RT_XATTR_NODE, mac}, nil) {
 				return
 			}
 
 			for _, error := range node.Values {
-				if !yield(getPackfileForBlobWithError(snap, resources.RT_XATTR_ENTRY, error)) {
+				if !yield(BlobRef{resources.RT_XATTR_ENTRY, error}, nil) {
 					return
 				}
 			}
 		}
 
 		// Lastly going over the indexes.
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_BTREE_ROOT, snap.Header.GetSource(0).Indexes[0].Value)) {
-			return
-		}
-		rd, err := snap.Repository().GetBlob(resources.RT_BTREE_ROOT, snap.Header.GetSource(0).Indexes[0].Value)
-		if err != nil {
-			if !yield(objects.MAC{}, fmt.Errorf("Failed to load Index root entry %s", err)) {
+		for _, index := range snap.Header.GetSource(0).Indexes {
+			if index.Type != "btree" {
+				continue
+			}
+			if !yield(BlobRef{resources.RT_BTREE_ROOT, index.Value}, nil) {
 				return
 			}
-		}
+			rd, err := snap.Repository().GetBlob(resources.RT_BTREE_ROOT, index.Value)
+			if err != nil {
+				if !yield(BlobRef{}, fmt.Errorf("Failed to load Index root entry %s", err)) {
+					return
+				}
+				continue
+			}
 
-		store := repository.NewRepositoryStore[string, objects.MAC](snap.Repository(), resources.RT_BTREE_NODE)
-		tree, err := btree.Deserialize(rd, store, strings.Compare)
-		if err != nil {
-			if !yield(objects.MAC{}, fmt.Errorf("Failed to deserialize root entry %s", err)) {
-				return
+			store := repository.NewRepositoryStore[string, objects.MAC](snap.Repository(), resources.RT_BTREE_NODE)
+			tree, err := btree.Deserialize(rd, store, strings.Compare)
+			if err != nil {
+				if !yield(BlobRef{}, fmt.Errorf("Failed to deserialize root entry %s", err)) {
+					return
+				}
+				continue
+			}
+
+			indexIter := tree.IterDFS()
+			for indexIter.Next() {
+				mac, _ := indexIter.Current()
+				if !yield(BlobRef{resources.RT_BTREE_NODE, mac}, nil) {
+					return
+				}
 			}
 		}
 
-		indexIter := tree.IterDFS()
-		for indexIter.Next() {
-			mac, _ := indexIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_BTREE_NODE, mac)) {
+	}, nil
+}
+
+func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
+	// A materialized snapshot only relies on the packfiles written for it,
+	// even though the blobs they hold may also be found elsewhere.
+	if snap.Header.Synthetic != (objects.MAC{}) {
+		return snap.repository.ListStatePackfiles(snap.Header.Identifier), nil
+	}
+
+	blobs, err := snap.ListBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(objects.MAC, error) bool) {
+		for blob, err := range blobs {
+			if err != nil {
+				if !yield(objects.MAC{}, err) {
+					return
+				}
+				continue
+			}
+			if !yield(getPackfileForBlobWithError(snap, blob.Type, blob.MAC)) {
 				return
 			}
 		}
-
 	}, nil
 }
 
 func (snap *Snapshot) Lock() (chan bool, error) {
 	lock := repository.NewSharedLock(snap.AppContext().Hostname)
+	snap.leaseEpoch = lock.Epoch
+	snap.leaseRefreshed.Store(lock.Timestamp.UnixNano())
 
 	buffer := &bytes.Buffer{}
 	err := lock.SerializeToStream(buffer)
@@ -404,7 +509,14 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 				snap.repository.DeleteLock(snap.Header.Identifier)
 				return
 			case <-time.After(repository.LOCK_REFRESH_RATE):
+				// Once our lease went stale, maintenance may have kicked it
+				// out: writing it again would hide that from checkLease().
+				if snap.leaseExpired() {
+					continue
+				}
+
 				lock := repository.NewSharedLock(snap.AppContext().Hostname)
+				lock.Epoch = snap.leaseEpoch
 
 				buffer := &bytes.Buffer{}
 
@@ -412,7 +524,9 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 				// correctly, and if they happen we will be ripped by the
 				// watchdog anyway.
 				lock.SerializeToStream(buffer)
-				snap.repository.PutLock(snap.Header.Identifier, buffer)
+				if snap.repository.PutLock(snap.Header.Identifier, buffer) == nil {
+					snap.leaseRefreshed.Store(lock.Timestamp.UnixNano())
+				}
 			}
 		}
 	}()
@@ -420,8 +534,62 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 	return lockDone, nil
 }
 
+func (snap *Snapshot) leaseExpired() bool {
+	return time.Since(time.Unix(0, snap.leaseRefreshed.Load())) >= repository.LOCK_TTL
+}
+
+// checkLease is called before pushing the state that makes the snapshot
+// visible.  Maintenance only runs when no live lease exists, so as long as
+// our lease was refreshed in time and is still in place, nothing we wrote
+// or deduplicated against since our epoch can have been collected.
+func (snap *Snapshot) checkLease() error {
+	if snap.leaseEpoch.IsZero() {
+		return nil
+	}
+
+	if snap.leaseExpired() {
+		return ErrLeaseExpired
+	}
+
+	locksID, err := snap.repository.GetLocks()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, lockID := range locksID {
+		version, rd, err := snap.repository.GetLock(lockID)
+		if err != nil {
+			// released since listed, ours is then reported as missing
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		lock, err := repository.NewLockFromStream(version, rd)
+		if err != nil {
+			return err
+		}
+
+		if lockID == snap.Header.Identifier {
+			found = !lock.Exclusive && lock.Epoch.Equal(snap.leaseEpoch)
+		} else if lock.Exclusive && !lock.IsStale() {
+			return ErrLeaseExpired
+		}
+	}
+
+	if !found {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
 func (snap *Snapshot) Unlock(ping chan bool) {
 	close(ping)
+	// the lock is also removed by the refresh goroutine, but an exclusive
+	// lock taken right after, e.g. by rm, must not find it still there.
+	snap.repository.DeleteLock(snap.Header.Identifier)
 }
 
 func (snap *Snapshot) Logger() *logging.Logger {
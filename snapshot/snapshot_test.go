@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/PlakarKorp/plakar/encryption/keypair"
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
@@ -24,6 +27,12 @@ import (
 )
 
 func generateSnapshot(t *testing.T, keyPair *keypair.KeyPair) *Snapshot {
+	return generateSnapshotOf(t, keyPair, "")
+}
+
+// generateSnapshotOf backs up pathname, relative to the directory holding
+// the test files, or that directory itself if pathname is empty.
+func generateSnapshotOf(t *testing.T, keyPair *keypair.KeyPair, pathname string) *Snapshot {
 	// init temporary directories
 	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
 	require.NoError(t, err)
@@ -83,13 +92,42 @@ func generateSnapshot(t *testing.T, keyPair *keypair.KeyPair) *Snapshot {
 	require.NoError(t, err)
 	require.NotNil(t, snap)
 
-	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	imp, err := fs.NewFSImporter(map[string]string{"location": path.Join(tmpBackupDir, pathname)})
 	require.NoError(t, err)
 	snap.Backup(imp, &BackupOptions{Name: "test_backup", MaxConcurrency: 1})
 
 	return snap
 }
 
+// dropFileChunk removes the first chunk of the file whose path contains
+// name from the state, as if its packfile had been lost, and returns the
+// path of the file and the MAC of the chunk.
+func dropFileChunk(t *testing.T, snap *Snapshot, name string) (string, objects.MAC) {
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	var filepath string
+	for pathname, err := range fs.Pathnames() {
+		require.NoError(t, err)
+		if strings.Contains(pathname, name) {
+			filepath = pathname
+		}
+	}
+	require.NotEmpty(t, filepath)
+
+	entry, err := fs.GetEntry(filepath)
+	require.NoError(t, err)
+	require.NotNil(t, entry.ResolvedObject)
+	require.NotEmpty(t, entry.ResolvedObject.Chunks)
+
+	chunkMAC := entry.ResolvedObject.Chunks[0].ContentMAC
+	packfileMAC, exists, err := snap.repository.GetPackfileForBlob(resources.RT_CHUNK, chunkMAC)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, snap.repository.RemoveBlob(resources.RT_CHUNK, chunkMAC, packfileMAC))
+	return filepath, chunkMAC
+}
+
 func TestSnapshot(t *testing.T) {
 	snap := generateSnapshot(t, nil)
 	defer snap.Close()
@@ -128,3 +166,75 @@ func TestSnapshot(t *testing.T) {
 
 	require.NotEqual(t, snap.Header.Identifier, snap4.Header.Identifier)
 }
+
+func TestSnapshotLease(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+
+	// the backup of base releases its own lease asynchronously
+	snap, err := New(base.repository)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	done, err := snap.Lock()
+	require.NoError(t, err)
+	defer snap.Unlock(done)
+
+	require.NoError(t, snap.checkLease())
+
+	// a lease that went stale may have been kicked out by maintenance
+	refreshed := snap.leaseRefreshed.Load()
+	snap.leaseRefreshed.Store(time.Now().Add(-repository.LOCK_TTL).UnixNano())
+	require.ErrorIs(t, snap.checkLease(), ErrLeaseExpired)
+	snap.leaseRefreshed.Store(refreshed)
+
+	require.NoError(t, snap.repository.DeleteLock(snap.Header.Identifier))
+	require.ErrorIs(t, snap.checkLease(), ErrLeaseExpired)
+}
+
+func TestSnapshotMaterialize(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	require.NoError(t, snap.repository.RebuildState())
+
+	original := make(map[objects.MAC]struct{})
+	packfiles, err := snap.ListPackfiles()
+	require.NoError(t, err)
+	for packfile, err := range packfiles {
+		require.NoError(t, err)
+		original[packfile] = struct{}{}
+	}
+
+	syntheticID, err := snap.Materialize()
+	require.NoError(t, err)
+	require.NotEqual(t, snap.Header.Identifier, syntheticID)
+
+	require.NoError(t, snap.repository.RebuildState())
+
+	synthetic, err := Load(snap.repository, syntheticID)
+	require.NoError(t, err)
+	defer synthetic.Close()
+
+	require.Equal(t, snap.Header.Identifier, synthetic.Header.Synthetic)
+	require.Equal(t, snap.Header.GetSource(0).VFS.Root, synthetic.Header.GetSource(0).VFS.Root)
+
+	// the synthetic snapshot only relies on packfiles of its own
+	packfiles, err = synthetic.ListPackfiles()
+	require.NoError(t, err)
+	count := 0
+	for packfile, err := range packfiles {
+		require.NoError(t, err)
+		require.NotContains(t, original, packfile)
+		count++
+	}
+	require.NotZero(t, count)
+
+	blobs, err := synthetic.ListBlobs()
+	require.NoError(t, err)
+	for blob, err := range blobs {
+		require.NoError(t, err)
+		_, err := synthetic.GetBlob(blob.Type, blob.MAC)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,140 @@
+package snapshot
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultSuggestMinSize is the size below which an exclude rule is not
+// worth suggesting.
+const DefaultSuggestMinSize = 10 << 20
+
+// ExcludeSuggestion is an exclude pattern which would have left out of a
+// snapshot data that is usually not worth backing up.
+type ExcludeSuggestion struct {
+	Pattern string
+	Reason  string
+	Paths   uint64
+	Size    uint64
+}
+
+// directoryRules are the directories, matched by their trailing path
+// components, holding data that is derived, downloaded or rewritten
+// wholesale and thus churns through the repository.
+var directoryRules = []struct {
+	name   string
+	reason string
+}{
+	{"node_modules", "JavaScript dependencies, reinstalled by the package manager"},
+	{"__pycache__", "Python bytecode, regenerated on import"},
+	{".venv", "Python virtual environment, recreated from requirements"},
+	{".tox", "Python test environments"},
+	{".gradle", "Gradle caches and build outputs"},
+	{".cache", "per-user caches"},
+	{"Library/Caches", "macOS application caches"},
+	{".git/objects", "git objects, rewritten when the repository is repacked"},
+}
+
+// mediaExtensions are the large media and disk image formats, which are
+// usually backed up separately if at all.
+var mediaExtensions = map[string]string{
+	".iso":   "disk images",
+	".img":   "disk images",
+	".dmg":   "disk images",
+	".vmdk":  "virtual machine disks",
+	".vdi":   "virtual machine disks",
+	".qcow2": "virtual machine disks",
+	".mp4":   "videos",
+	".mkv":   "videos",
+	".mov":   "videos",
+	".avi":   "videos",
+}
+
+// directoryPattern excludes a directory and everything below it.
+func directoryPattern(name string) string {
+	return fmt.Sprintf("{*/%s,*/%s/*}", name, name)
+}
+
+// SuggestExcludes walks the snapshot below pathname and returns the exclude
+// rules which would have saved at least minSize bytes, the largest savings
+// first.  Sizes are taken from the summaries computed at backup time, no
+// file content is read.
+func (snap *Snapshot) SuggestExcludes(pathname string, minSize uint64) ([]ExcludeSuggestion, error) {
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	byPattern := make(map[string]*ExcludeSuggestion)
+	suggest := func(pattern, reason string, size uint64) {
+		s, ok := byPattern[pattern]
+		if !ok {
+			s = &ExcludeSuggestion{Pattern: pattern, Reason: reason}
+			byPattern[pattern] = s
+		}
+		s.Paths++
+		s.Size += size
+	}
+
+	// entries below a matched directory are already accounted for, and
+	// parents are always walked before their children.
+	matched := make(map[string]struct{})
+	below := func(pathname string) bool {
+		for dir := path.Dir(pathname); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			if _, ok := matched[dir]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for entry, err := range fs.Files(pathname) {
+		if err != nil {
+			return nil, err
+		}
+
+		entryPath := entry.Path()
+		if below(entryPath) {
+			continue
+		}
+
+		if entry.IsDir() {
+			if entry.Summary == nil {
+				continue
+			}
+			for _, rule := range directoryRules {
+				if strings.HasSuffix(entryPath, "/"+rule.name) {
+					suggest(directoryPattern(rule.name), rule.reason, entry.Summary.Directory.Size+entry.Summary.Below.Size)
+					matched[entryPath] = struct{}{}
+					break
+				}
+			}
+			continue
+		}
+
+		if !entry.Stat().Mode().IsRegular() {
+			continue
+		}
+		// patterns are case sensitive, so keep the case of the extension
+		ext := path.Ext(entryPath)
+		if reason, ok := mediaExtensions[strings.ToLower(ext)]; ok {
+			suggest("*"+ext, reason, uint64(entry.Stat().Size()))
+		}
+	}
+
+	suggestions := make([]ExcludeSuggestion, 0, len(byPattern))
+	for _, s := range byPattern {
+		if s.Size >= minSize {
+			suggestions = append(suggestions, *s)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Size != suggestions[j].Size {
+			return suggestions[i].Size > suggestions[j].Size
+		}
+		return suggestions[i].Pattern < suggestions[j].Pattern
+	})
+	return suggestions, nil
+}
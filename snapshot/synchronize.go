@@ -5,14 +5,49 @@ import (
 	"strings"
 
 	"github.com/PlakarKorp/plakar/btree"
+	"github.com/PlakarKorp/plakar/caching"
 	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/header"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/google/uuid"
 )
 
-func persistObject(src, dst *Snapshot, object *objects.Object) (objects.MAC, error) {
+// journaledObject returns the destination MAC of an object that a previous,
+// interrupted, synchronization already transferred, provided that the object
+// and all of its chunks are still reachable in the destination.
+func journaledObject(dst *Snapshot, srcObjectMAC objects.MAC) (objects.MAC, bool) {
+	data, err := dst.syncJournal.GetObject(dst.syncJournalID, srcObjectMAC)
+	if err != nil || data == nil {
+		return objects.MAC{}, false
+	}
+
+	mac := dst.Repository().ComputeMAC(data)
+	if !dst.BlobExists(resources.RT_OBJECT, mac) {
+		return objects.MAC{}, false
+	}
+
+	object, err := objects.NewObjectFromBytes(data)
+	if err != nil {
+		return objects.MAC{}, false
+	}
+	for _, chunk := range object.Chunks {
+		if !dst.BlobExists(resources.RT_CHUNK, chunk.ContentMAC) {
+			return objects.MAC{}, false
+		}
+	}
+
+	return mac, true
+}
+
+func persistObject(src, dst *Snapshot, srcObjectMAC objects.MAC, object *objects.Object) (objects.MAC, error) {
+	if dst.syncJournal != nil {
+		if mac, ok := journaledObject(dst, srcObjectMAC); ok {
+			return mac, nil
+		}
+	}
+
 	hasher := dst.Repository().GetMACHasher()
 	newObject := *object
 	newObject.Chunks = make([]objects.Chunk, 0, len(object.Chunks))
@@ -56,6 +91,12 @@ func persistObject(src, dst *Snapshot, object *objects.Object) (objects.MAC, err
 		}
 	}
 
+	if dst.syncJournal != nil {
+		if err := dst.syncJournal.PutObject(dst.syncJournalID, srcObjectMAC, serializedObject); err != nil {
+			return objects.MAC{}, err
+		}
+	}
+
 	return mac, nil
 }
 
@@ -67,7 +108,7 @@ func persistVFS(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem, ctidx *btree.B
 		}
 
 		if entry.HasObject() {
-			entry.Object, err = persistObject(src, dst, entry.ResolvedObject)
+			entry.Object, err = persistObject(src, dst, entry.Object, entry.ResolvedObject)
 			if err != nil {
 				return objects.MAC{}, nil
 			}
@@ -121,7 +162,7 @@ func persistXattrs(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem) func(object
 			return objects.MAC{}, err
 		}
 
-		xattr.Object, err = persistObject(src, dst, xattr.ResolvedObject)
+		xattr.Object, err = persistObject(src, dst, xattr.Object, xattr.ResolvedObject)
 		serialized, err := xattr.ToBytes()
 		if err != nil {
 			return objects.MAC{}, err
@@ -138,7 +179,62 @@ func persistXattrs(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem) func(object
 	}
 }
 
-func (src *Snapshot) Synchronize(dst *Snapshot) error {
+// resumeSynchronize replays the packfiles a previous, interrupted,
+// synchronization of the same snapshot wrote to the destination, so that
+// the blobs they hold are considered present and are not sent again.
+func resumeSynchronize(dst *Snapshot, journal *caching.SyncCache) error {
+	var present map[objects.MAC]struct{}
+
+	resumed := 0
+	for packfileMAC, data := range journal.GetPackfiles(dst.syncJournalID) {
+		if present == nil {
+			packfiles, err := dst.Repository().Store().GetPackfiles()
+			if err != nil {
+				return err
+			}
+			present = make(map[objects.MAC]struct{}, len(packfiles))
+			for _, mac := range packfiles {
+				present[mac] = struct{}{}
+			}
+		}
+
+		if _, ok := present[packfileMAC]; !ok {
+			continue
+		}
+
+		for len(data) >= state.DeltaEntrySerializedSize {
+			delta, err := state.DeltaEntryFromBytes(data[:state.DeltaEntrySerializedSize])
+			if err != nil {
+				return err
+			}
+			if err := dst.deltaState.PutDelta(delta); err != nil {
+				return err
+			}
+			data = data[state.DeltaEntrySerializedSize:]
+		}
+
+		if err := dst.deltaState.PutPackfile(dst.Header.Identifier, packfileMAC); err != nil {
+			return err
+		}
+		resumed++
+	}
+
+	if resumed != 0 {
+		dst.Logger().Info("synchronize: resuming %x, %d packfiles already transferred",
+			dst.syncJournalID[:4], resumed)
+	}
+	return nil
+}
+
+// Synchronize copies src into dst. If journal is not nil, progress is
+// recorded there and a previously interrupted transfer of the same
+// snapshot is resumed from it.
+func (src *Snapshot) Synchronize(dst *Snapshot, journal *caching.SyncCache) error {
+	if journal != nil {
+		dst.syncJournal = journal
+		dst.syncJournalID = src.Header.Identifier
+	}
+
 	if src.Header.Identity.Identifier != uuid.Nil {
 		data, err := src.GetBlob(resources.RT_SIGNATURE, src.Header.Identifier)
 		if err != nil {
@@ -155,6 +251,12 @@ func (src *Snapshot) Synchronize(dst *Snapshot) error {
 		}
 	}
 
+	if journal != nil {
+		if err := resumeSynchronize(dst, journal); err != nil {
+			return err
+		}
+	}
+
 	fs, err := src.Filesystem()
 	if err != nil {
 		return err
@@ -193,5 +295,23 @@ func (src *Snapshot) Synchronize(dst *Snapshot) error {
 		},
 	}
 
+	tombidx, err := src.TombstoneIdx()
+	if err != nil {
+		return err
+	}
+	if tombidx != nil {
+		tombsum, err := persistIndex(dst, tombidx, resources.RT_BTREE_ROOT, resources.RT_BTREE_NODE, func(mac objects.MAC) (objects.MAC, error) {
+			return mac, nil
+		})
+		if err != nil {
+			return err
+		}
+		dst.Header.GetSource(0).Indexes = append(dst.Header.GetSource(0).Indexes, header.Index{
+			Name:  "tombstones",
+			Type:  "btree",
+			Value: tombsum,
+		})
+	}
+
 	return nil
 }
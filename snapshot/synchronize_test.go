@@ -0,0 +1,109 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/stretchr/testify/require"
+)
+
+// synchronizeInto copies the snapshot snapshotID of src into a new, not yet
+// committed, snapshot of dst the way the sync subcommand does.
+func synchronizeInto(t *testing.T, src *repository.Repository, snapshotID objects.MAC, dst *repository.Repository, journal *caching.SyncCache) *Snapshot {
+	srcSnapshot, err := Load(src, snapshotID)
+	require.NoError(t, err)
+	defer srcSnapshot.Close()
+
+	dstSnapshot, err := New(dst)
+	require.NoError(t, err)
+	dstSnapshot.Header = srcSnapshot.Header
+
+	require.NoError(t, srcSnapshot.Synchronize(dstSnapshot, journal))
+	return dstSnapshot
+}
+
+func TestSynchronizeResume(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	srcRepo := base.repository
+
+	dir := t.TempDir()
+	contents := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		pathname := filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+		contents[pathname] = strings.Repeat(fmt.Sprintf("content of file %d\n", i), 64)
+		require.NoError(t, os.WriteFile(pathname, []byte(contents[pathname]), 0644))
+	}
+	src := backupInto(t, srcRepo, dir)
+	defer src.Close()
+	require.NoError(t, srcRepo.RebuildState())
+
+	other := generateSnapshot(t, nil)
+	defer other.Close()
+	dstRepo := other.repository
+
+	journal, err := srcRepo.AppContext().GetCache().Sync(srcRepo.Configuration().RepositoryID,
+		dstRepo.Configuration().RepositoryID)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	before, err := dstRepo.GetPackfiles()
+	require.NoError(t, err)
+
+	// the transfer is interrupted once its packfiles are written, before
+	// the snapshot is committed
+	interrupted := synchronizeInto(t, srcRepo, src.Header.Identifier, dstRepo, journal)
+	interrupted.stopPacker()
+	interrupted.Close()
+
+	transferred, err := dstRepo.GetPackfiles()
+	require.NoError(t, err)
+	require.Greater(t, len(transferred), len(before))
+
+	journaled := 0
+	for range journal.GetPackfiles(src.Header.Identifier) {
+		journaled++
+	}
+	require.Equal(t, len(transferred)-len(before), journaled)
+
+	// resuming replays the journaled packfiles, nothing is sent again
+	resumed := synchronizeInto(t, srcRepo, src.Header.Identifier, dstRepo, journal)
+	defer resumed.Close()
+	replayed := make(map[objects.MAC]struct{})
+	for packfileMAC := range resumed.deltaState.ListPackfiles() {
+		replayed[packfileMAC] = struct{}{}
+	}
+	require.Len(t, replayed, journaled)
+	require.NoError(t, resumed.Commit())
+	require.NoError(t, journal.DeleteSnapshot(src.Header.Identifier))
+
+	// only the header of the snapshot was written on commit
+	after, err := dstRepo.GetPackfiles()
+	require.NoError(t, err)
+	require.Len(t, after, len(transferred)+1)
+
+	for range journal.GetPackfiles(src.Header.Identifier) {
+		t.Fatal("journal not cleared")
+	}
+
+	require.NoError(t, dstRepo.RebuildState())
+	synced, err := Load(dstRepo, src.Header.Identifier)
+	require.NoError(t, err)
+	defer synced.Close()
+
+	// the resumed snapshot is the one an uninterrupted transfer produces
+	uninterrupted := synchronizeInto(t, srcRepo, src.Header.Identifier, dstRepo, nil)
+	defer uninterrupted.Close()
+	require.Equal(t, uninterrupted.Header.GetSource(0).VFS, synced.Header.GetSource(0).VFS)
+	require.Equal(t, uninterrupted.Header.GetSource(0).Indexes, synced.Header.GetSource(0).Indexes)
+
+	for pathname, content := range contents {
+		require.Equal(t, content, readFile(t, synced, pathname))
+	}
+}
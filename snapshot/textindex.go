@@ -0,0 +1,236 @@
+package snapshot
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const TEXT_INDEX_VERSION = "1.0.0"
+
+func init() {
+	versioning.Register(resources.RT_TEXT_INDEX, versioning.FromString(TEXT_INDEX_VERSION))
+}
+
+const (
+	// TextIndexMaxSize is the amount of text read from each file, the
+	// rest of larger files is not indexed.
+	TextIndexMaxSize = 1 << 20
+
+	minTermLength = 2
+	maxTermLength = 64
+)
+
+// textTypes are the content types, besides text/*, holding text worth
+// indexing.
+var textTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-javascript",
+	"application/x-sh",
+	"application/x-yaml",
+	"application/yaml",
+	"application/toml",
+	"application/sql",
+	"application/x-sql",
+	"application/x-ndjson",
+	"application/x-subrip",
+	"image/svg+xml",
+}
+
+// isText reports whether the text of a file of the given content type, as
+// detected at backup time, can be indexed.
+func isText(contentType string) bool {
+	mime, _, _ := strings.Cut(contentType, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+
+	switch {
+	case strings.HasPrefix(mime, "text/"):
+		return true
+	case strings.HasSuffix(mime, "+json"), strings.HasSuffix(mime, "+xml"):
+		return true
+	}
+	return slices.Contains(textTypes, mime)
+}
+
+// Terms splits text into the lowercased words indexed, ignoring those too
+// short or too long to be searched for.  A NUL byte marks binary content,
+// for which no term is returned.
+func Terms(rd io.Reader) ([]string, error) {
+	br := bufio.NewReader(rd)
+
+	seen := make(map[string]struct{})
+	var terms []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() >= minTermLength && word.Len() <= maxTermLength {
+			term := word.String()
+			if _, ok := seen[term]; !ok {
+				seen[term] = struct{}{}
+				terms = append(terms, term)
+			}
+		}
+		word.Reset()
+	}
+
+	for {
+		r, _, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if r == 0 {
+			return nil, nil
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word.WriteRune(unicode.ToLower(r))
+		} else {
+			flush()
+		}
+	}
+	flush()
+	return terms, nil
+}
+
+// TextIndex maps the words found in the text files of a snapshot to the
+// files holding them.  It is stored alongside the snapshot, keyed by its
+// identifier, when the backup is asked to build it.
+type TextIndex struct {
+	Paths []string `msgpack:"paths"`
+
+	// Terms holds, for each word, the sorted indexes in Paths of the
+	// files it appears in.
+	Terms map[string][]uint32 `msgpack:"terms"`
+
+	mu sync.Mutex
+}
+
+func NewTextIndex() *TextIndex {
+	return &TextIndex{
+		Terms: make(map[string][]uint32),
+	}
+}
+
+// Add records the terms found in a file.
+func (idx *TextIndex) Add(pathname string, terms []string) {
+	if len(terms) == 0 {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// files are numbered as they are added, keeping the lists sorted
+	id := uint32(len(idx.Paths))
+	idx.Paths = append(idx.Paths, pathname)
+	for _, term := range terms {
+		idx.Terms[term] = append(idx.Terms[term], id)
+	}
+}
+
+// Search returns the files holding all the words of query, sorted.
+func (idx *TextIndex) Search(query string) ([]string, error) {
+	terms, err := Terms(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// start with the rarest term, there can't be more matches
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.Terms[terms[i]]) < len(idx.Terms[terms[j]])
+	})
+
+	matches := idx.Terms[terms[0]]
+	for _, term := range terms[1:] {
+		if len(matches) == 0 {
+			break
+		}
+		matches = intersect(matches, idx.Terms[term])
+	}
+
+	paths := make([]string, 0, len(matches))
+	for _, id := range matches {
+		if int(id) < len(idx.Paths) {
+			paths = append(paths, idx.Paths[id])
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func intersect(a, b []uint32) []uint32 {
+	var result []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// indexText adds the words of a text file to idx, reading it from the
+// importer as the VFS cache may have spared reading it for the backup.
+func (snap *Snapshot) indexText(imp importer.Importer, idx *TextIndex, pathname string) error {
+	rd, err := imp.NewReader(pathname)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	terms, err := Terms(io.LimitReader(rd, TextIndexMaxSize))
+	if err != nil {
+		return err
+	}
+	idx.Add(pathname, terms)
+	return nil
+}
+
+func (snap *Snapshot) putTextIndex(idx *TextIndex) error {
+	idx.mu.Lock()
+	data, err := msgpack.Marshal(idx)
+	idx.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return snap.PutBlob(resources.RT_TEXT_INDEX, snap.Header.Identifier, data)
+}
+
+func (snap *Snapshot) HasTextIndex() bool {
+	return snap.BlobExists(resources.RT_TEXT_INDEX, snap.Header.Identifier)
+}
+
+// GetTextIndex returns the full-text index of the snapshot, only built
+// for the backups asked to.
+func (snap *Snapshot) GetTextIndex() (*TextIndex, error) {
+	data, err := snap.GetBlob(resources.RT_TEXT_INDEX, snap.Header.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := NewTextIndex()
+	if err := msgpack.Unmarshal(data, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerms(t *testing.T) {
+	terms, err := Terms(strings.NewReader("Hello, World! hello a 42 Ünïcode"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "world", "42", "ünïcode"}, terms)
+
+	terms, err = Terms(strings.NewReader("binary\x00content"))
+	require.NoError(t, err)
+	require.Empty(t, terms)
+}
+
+func TestTextIndexSearch(t *testing.T) {
+	idx := NewTextIndex()
+	idx.Add("/a.txt", []string{"quarterly", "report", "draft"})
+	idx.Add("/b.txt", []string{"quarterly", "report"})
+	idx.Add("/c.txt", []string{"draft"})
+
+	for query, expected := range map[string][]string{
+		"report":           {"/a.txt", "/b.txt"},
+		"Quarterly DRAFT":  {"/a.txt"},
+		"draft":            {"/a.txt", "/c.txt"},
+		"missing":          {},
+		"report, missing":  {},
+		"quarterly report": {"/a.txt", "/b.txt"},
+	} {
+		paths, err := idx.Search(query)
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, paths, query)
+	}
+
+	paths, err := idx.Search("!")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+}
+
+func TestBackupTextIndex(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+	require.False(t, snap.HasTextIndex())
+
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("Meeting notes about the invoice"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "config.json"), []byte(`{"invoice": true}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "blob.bin"), []byte("invoice\x00\x01\x02"), 0644))
+
+	snap2, err := New(snap.repository)
+	require.NoError(t, err)
+	defer snap2.Close()
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpDir})
+	require.NoError(t, err)
+	require.NoError(t, snap2.Backup(imp, &BackupOptions{Name: "test_backup", MaxConcurrency: 1, TextIndex: true}))
+	require.NoError(t, snap.repository.RebuildState())
+
+	loaded, err := Load(snap.repository, snap2.Header.Identifier)
+	require.NoError(t, err)
+	defer loaded.Close()
+
+	require.True(t, loaded.HasTextIndex())
+	idx, err := loaded.GetTextIndex()
+	require.NoError(t, err)
+
+	root := imp.Root()
+	paths, err := idx.Search("invoice")
+	require.NoError(t, err)
+	require.Equal(t, []string{root + "/config.json", root + "/notes.txt"}, paths)
+
+	paths, err = idx.Search("meeting invoice")
+	require.NoError(t, err)
+	require.Equal(t, []string{root + "/notes.txt"}, paths)
+
+	found := false
+	blobs, err := loaded.ListBlobs()
+	require.NoError(t, err)
+	for blob, err := range blobs {
+		require.NoError(t, err)
+		if blob.MAC == loaded.Header.Identifier && blob.Type == resources.RT_TEXT_INDEX {
+			found = true
+		}
+	}
+	require.True(t, found)
+}
@@ -0,0 +1,51 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/timestamping"
+	"github.com/PlakarKorp/plakar/versioning"
+)
+
+const TIMESTAMP_VERSION = "1.0.0"
+
+func init() {
+	versioning.Register(resources.RT_TIMESTAMP, versioning.FromString(TIMESTAMP_VERSION))
+}
+
+// timestampDigest returns the digest submitted to the timestamping
+// authority: the SHA-256 of the MAC of the serialized header.
+func (snap *Snapshot) timestampDigest(serializedHdr []byte) []byte {
+	mac := snap.repository.ComputeMAC(serializedHdr)
+	digest := sha256.Sum256(mac[:])
+	return digest[:]
+}
+
+func (snap *Snapshot) HasTimestamp() bool {
+	return snap.BlobExists(resources.RT_TIMESTAMP, snap.Header.Identifier)
+}
+
+// GetTimestamp returns the RFC3161 timestamp token of the snapshot, which
+// can be verified by third parties against the header MAC.
+func (snap *Snapshot) GetTimestamp() ([]byte, error) {
+	return snap.GetBlob(resources.RT_TIMESTAMP, snap.Header.Identifier)
+}
+
+// VerifyTimestamp checks that the timestamp token of the snapshot matches
+// its header, proving it existed unmodified at the receipt date.
+func (snap *Snapshot) VerifyTimestamp() (*timestamping.Receipt, error) {
+	token, err := snap.GetTimestamp()
+	if err != nil {
+		return nil, err
+	}
+
+	// the header as stored is what was timestamped, serializing the one
+	// loaded again need not yield the same bytes
+	serializedHdr, err := snap.GetBlob(resources.RT_SNAPSHOT, snap.Header.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return timestamping.Verify(token, snap.timestampDigest(serializedHdr))
+}
@@ -144,7 +144,7 @@ func (fsc *Filesystem) lookup(entrypath string) (*Entry, error) {
 }
 
 func (fsc *Filesystem) ResolveEntry(csum objects.MAC) (*Entry, error) {
-	rd, err := fsc.repo.GetBlob(resources.RT_VFS_ENTRY, csum)
+	rd, err := fsc.repo.GetCachedBlob(resources.RT_VFS_ENTRY, csum)
 	if err != nil {
 		return nil, err
 	}
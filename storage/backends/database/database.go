@@ -145,6 +145,19 @@ func (s *Store) Create(config []byte) error {
 	return nil
 }
 
+func (s *Store) PutConfig(config []byte) error {
+	statement, err := s.conn.Prepare(`UPDATE configuration SET value = ?`)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	s.wrMutex.Lock()
+	_, err = statement.Exec(config)
+	s.wrMutex.Unlock()
+	return err
+}
+
 func (s *Store) Open() ([]byte, error) {
 	err := s.connect(s.location)
 	if err != nil {
@@ -299,6 +312,18 @@ func (s *Store) GetPackfile(mac objects.MAC) (io.Reader, error) {
 	return bytes.NewReader(data), nil
 }
 
+func (s *Store) GetPackfileSize(mac objects.MAC) (uint64, error) {
+	var size uint64
+	err := s.conn.QueryRow(`SELECT length(data) FROM packfiles WHERE mac=?`, mac[:]).Scan(&size)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = repository.ErrPackfileNotFound
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
 func (s *Store) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
 	var data []byte
 	err := s.conn.QueryRow(`SELECT substr(data, ?, ?) FROM packfiles WHERE mac=?`, offset+1, length, mac[:]).Scan(&data)
@@ -104,6 +104,14 @@ func (buckets *Buckets) Get(mac objects.MAC) (io.Reader, error) {
 	return ClosingReader(fp)
 }
 
+func (buckets *Buckets) Size(mac objects.MAC) (uint64, error) {
+	info, err := os.Stat(buckets.Path(mac))
+	if err != nil {
+		return 0, err
+	}
+	return uint64(info.Size()), nil
+}
+
 func (buckets *Buckets) GetBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
 	fp, err := os.Open(buckets.Path(mac))
 	if err != nil {
@@ -104,6 +104,10 @@ func (s *Store) Create(config []byte) error {
 	return WriteToFileAtomic(s.Path("CONFIG"), bytes.NewReader(config))
 }
 
+func (s *Store) PutConfig(config []byte) error {
+	return WriteToFileAtomic(s.Path("CONFIG"), bytes.NewReader(config))
+}
+
 func (s *Store) Open() ([]byte, error) {
 
 	s.packfiles = NewBuckets(s.Path("packfiles"))
@@ -139,6 +143,17 @@ func (s *Store) GetPackfile(mac objects.MAC) (io.Reader, error) {
 	return fp, nil
 }
 
+func (s *Store) GetPackfileSize(mac objects.MAC) (uint64, error) {
+	size, err := s.packfiles.Size(mac)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = repository.ErrPackfileNotFound
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
 func (s *Store) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
 	res, err := s.packfiles.GetBlob(mac, offset, length)
 	if err != nil {
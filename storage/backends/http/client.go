@@ -85,6 +85,24 @@ func (s *Store) Open() ([]byte, error) {
 	return resOpen.Configuration, nil
 }
 
+func (s *Store) PutConfig(config []byte) error {
+	r, err := s.sendRequest("PUT", "/", network.ReqPutConfig{
+		Configuration: config,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resPutConfig network.ResPutConfig
+	if err := json.NewDecoder(r.Body).Decode(&resPutConfig); err != nil {
+		return err
+	}
+	if resPutConfig.Err != "" {
+		return fmt.Errorf("%s", resPutConfig.Err)
+	}
+	return nil
+}
+
 func (s *Store) Close() error {
 	return nil
 }
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package rclone stores a repository on any remote supported by rclone,
+// by running the rclone command for each operation.
+package rclone
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// Exit codes of rclone for a missing directory or file.
+const (
+	exitDirNotFound  = 3
+	exitFileNotFound = 4
+)
+
+type Store struct {
+	location string
+	binary   string
+	config   string
+}
+
+func init() {
+	storage.Register("rclone", NewStore)
+}
+
+func NewStore(storeConfig map[string]string) (storage.Store, error) {
+	binary := storeConfig["rclone"]
+	if binary == "" {
+		binary = "rclone"
+	}
+
+	return &Store{
+		location: storeConfig["location"],
+		binary:   binary,
+		config:   storeConfig["rclone_config"],
+	}, nil
+}
+
+func (s *Store) Location() string {
+	return s.location
+}
+
+// Path returns the rclone path, remote:path, of a file of the repository.
+func (s *Store) Path(args ...string) string {
+	root := strings.TrimPrefix(s.Location(), "rclone://")
+	if len(args) == 0 {
+		return root
+	}
+
+	remote, dir, ok := strings.Cut(root, ":")
+	if !ok {
+		return path.Join(root, path.Join(args...))
+	}
+	return remote + ":" + path.Join(dir, path.Join(args...))
+}
+
+// run executes an rclone command, feeding it stdin if not nil, and
+// returns its output.  Missing files and directories are reported as
+// fs.ErrNotExist.
+func (s *Store) run(stdin io.Reader, args ...string) ([]byte, error) {
+	if s.config != "" {
+		args = append([]string{"--config", s.config}, args...)
+	}
+
+	cmd := exec.Command(s.binary, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			switch exitErr.ExitCode() {
+			case exitDirNotFound, exitFileNotFound:
+				return nil, fmt.Errorf("rclone: %s: %w", msg, fs.ErrNotExist)
+			}
+		}
+		return nil, fmt.Errorf("rclone: %s", msg)
+	}
+	return out, nil
+}
+
+func (s *Store) put(pathname string, rd io.Reader) error {
+	_, err := s.run(rd, "rcat", pathname)
+	return err
+}
+
+func (s *Store) get(pathname string) (io.Reader, error) {
+	data, err := s.run(nil, "cat", pathname)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (s *Store) delete(pathname string) error {
+	_, err := s.run(nil, "deletefile", pathname)
+	return err
+}
+
+// list returns the MACs named by the files below dir, looking in the
+// bucket subdirectories if recursive.
+func (s *Store) list(dir string, recursive bool) ([]objects.MAC, error) {
+	args := []string{"lsf", "--files-only"}
+	if recursive {
+		args = append(args, "--recursive")
+	}
+
+	out, err := s.run(nil, append(args, dir)...)
+	if err != nil {
+		// remotes without directories don't have them until a file is put
+		if errors.Is(err, fs.ErrNotExist) {
+			return []objects.MAC{}, nil
+		}
+		return nil, err
+	}
+
+	ret := make([]objects.MAC, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		t, err := hex.DecodeString(path.Base(scanner.Text()))
+		if err != nil || len(t) != 32 {
+			continue
+		}
+		ret = append(ret, objects.MAC(t))
+	}
+	return ret, scanner.Err()
+}
+
+func bucketPath(mac objects.MAC) string {
+	return path.Join(fmt.Sprintf("%02x", mac[0]), hex.EncodeToString(mac[:]))
+}
+
+func (s *Store) Create(config []byte) error {
+	out, err := s.run(nil, "lsf", s.Path())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(bytes.TrimSpace(out)) > 0 {
+		return fmt.Errorf("%s is not empty", s.Location())
+	}
+
+	for _, dir := range []string{"packfiles", "states", "locks"} {
+		if _, err := s.run(nil, "mkdir", s.Path(dir)); err != nil {
+			return err
+		}
+	}
+
+	return s.put(s.Path("CONFIG"), bytes.NewReader(config))
+}
+
+func (s *Store) PutConfig(config []byte) error {
+	return s.put(s.Path("CONFIG"), bytes.NewReader(config))
+}
+
+func (s *Store) Open() ([]byte, error) {
+	if _, err := exec.LookPath(s.binary); err != nil {
+		return nil, err
+	}
+	return s.run(nil, "cat", s.Path("CONFIG"))
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+/* Packfiles */
+func (s *Store) GetPackfiles() ([]objects.MAC, error) {
+	return s.list(s.Path("packfiles"), true)
+}
+
+func (s *Store) PutPackfile(mac objects.MAC, rd io.Reader) error {
+	return s.put(s.Path("packfiles", bucketPath(mac)), rd)
+}
+
+func (s *Store) GetPackfile(mac objects.MAC) (io.Reader, error) {
+	rd, err := s.get(s.Path("packfiles", bucketPath(mac)))
+	if errors.Is(err, fs.ErrNotExist) {
+		err = repository.ErrPackfileNotFound
+	}
+	return rd, err
+}
+
+func (s *Store) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
+	data, err := s.run(nil, "cat",
+		"--offset", strconv.FormatUint(offset, 10),
+		"--count", strconv.FormatUint(uint64(length), 10),
+		s.Path("packfiles", bucketPath(mac)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = repository.ErrPackfileNotFound
+		}
+		return nil, err
+	}
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("short read")
+	}
+	return bytes.NewBuffer(data), nil
+}
+
+func (s *Store) DeletePackfile(mac objects.MAC) error {
+	return s.delete(s.Path("packfiles", bucketPath(mac)))
+}
+
+/* States */
+func (s *Store) GetStates() ([]objects.MAC, error) {
+	return s.list(s.Path("states"), true)
+}
+
+func (s *Store) PutState(mac objects.MAC, rd io.Reader) error {
+	return s.put(s.Path("states", bucketPath(mac)), rd)
+}
+
+func (s *Store) GetState(mac objects.MAC) (io.Reader, error) {
+	return s.get(s.Path("states", bucketPath(mac)))
+}
+
+func (s *Store) DeleteState(mac objects.MAC) error {
+	return s.delete(s.Path("states", bucketPath(mac)))
+}
+
+/* Locks */
+func (s *Store) GetLocks() ([]objects.MAC, error) {
+	return s.list(s.Path("locks"), false)
+}
+
+func (s *Store) PutLock(lockID objects.MAC, rd io.Reader) error {
+	return s.put(s.Path("locks", hex.EncodeToString(lockID[:])), rd)
+}
+
+func (s *Store) GetLock(lockID objects.MAC) (io.Reader, error) {
+	return s.get(s.Path("locks", hex.EncodeToString(lockID[:])))
+}
+
+func (s *Store) DeleteLock(lockID objects.MAC) error {
+	return s.delete(s.Path("locks", hex.EncodeToString(lockID[:])))
+}
@@ -0,0 +1,134 @@
+package rclone
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRclone implements the rclone commands used by the backend on a
+// local directory standing for the "test:" remote.
+const fakeRclone = `#!/bin/sh
+[ "$1" = "--config" ] && shift 2
+cmd=$1; shift
+offset=0; count=
+while [ $# -gt 1 ]; do
+	case $1 in
+	--offset) offset=$2; shift 2;;
+	--count) count=$2; shift 2;;
+	*) flags="$flags $1"; shift;;
+	esac
+done
+p="$ROOT/${1#test:}"
+case $cmd in
+mkdir) mkdir -p "$p";;
+rcat) mkdir -p "$(dirname "$p")" && cat > "$p";;
+cat)
+	[ -f "$p" ] || { echo "object not found" >&2; exit 3; }
+	if [ -n "$count" ]; then
+		dd if="$p" bs=1 skip="$offset" count="$count" 2>/dev/null
+	else
+		cat "$p"
+	fi;;
+deletefile) rm "$p" || exit 4;;
+lsf)
+	[ -d "$p" ] || { echo "directory not found" >&2; exit 3; }
+	(cd "$p" && find . -type f | sed 's|^\./||');;
+*) echo "unknown command $cmd" >&2; exit 1;;
+esac
+`
+
+func TestRcloneBackend(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake rclone is a shell script")
+	}
+
+	tmp := t.TempDir()
+	binary := filepath.Join(tmp, "rclone")
+	require.NoError(t, os.WriteFile(binary, []byte(fakeRclone), 0700))
+	root := filepath.Join(tmp, "remote")
+	t.Setenv("ROOT", root)
+
+	repo, err := NewStore(map[string]string{"location": "rclone://test:plakar", "rclone": binary})
+	require.NoError(t, err)
+	require.Equal(t, "rclone://test:plakar", repo.Location())
+	require.Equal(t, "test:plakar/states/10/abcd", repo.(*Store).Path("states", "10/abcd"))
+
+	config := storage.NewConfiguration()
+	serializedConfig, err := config.ToBytes()
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(serializedConfig))
+	require.ErrorContains(t, repo.Create(serializedConfig), "not empty")
+
+	data, err := repo.Open()
+	require.NoError(t, err)
+	require.Equal(t, serializedConfig, data)
+
+	// states
+	mac1 := objects.MAC{0x10, 0x20}
+	mac2 := objects.MAC{0x30, 0x40}
+	require.NoError(t, repo.PutState(mac1, bytes.NewReader([]byte("test1"))))
+	require.NoError(t, repo.PutState(mac2, bytes.NewReader([]byte("test2"))))
+
+	states, err := repo.GetStates()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []objects.MAC{mac1, mac2}, states)
+
+	rd, err := repo.GetState(mac2)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "test2", string(buf))
+
+	require.NoError(t, repo.DeleteState(mac1))
+	states, err = repo.GetStates()
+	require.NoError(t, err)
+	require.Equal(t, []objects.MAC{mac2}, states)
+
+	// packfiles
+	mac3 := objects.MAC{0x50, 0x60}
+	mac4 := objects.MAC{0x60, 0x70}
+	require.NoError(t, repo.PutPackfile(mac3, bytes.NewReader([]byte("test3"))))
+	require.NoError(t, repo.PutPackfile(mac4, bytes.NewReader([]byte("test4"))))
+
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []objects.MAC{mac3, mac4}, packfiles)
+
+	rd, err = repo.GetPackfileBlob(mac4, 1, 3)
+	require.NoError(t, err)
+	buf, err = io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "est", string(buf))
+
+	require.NoError(t, repo.DeletePackfile(mac3))
+	_, err = repo.GetPackfile(mac3)
+	require.ErrorIs(t, err, repository.ErrPackfileNotFound)
+
+	rd, err = repo.GetPackfile(mac4)
+	require.NoError(t, err)
+	buf, err = io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "test4", string(buf))
+
+	// locks
+	lock := objects.MAC{0x80}
+	require.NoError(t, repo.PutLock(lock, bytes.NewReader([]byte("lock"))))
+	locks, err := repo.GetLocks()
+	require.NoError(t, err)
+	require.Equal(t, []objects.MAC{lock}, locks)
+	require.NoError(t, repo.DeleteLock(lock))
+	locks, err = repo.GetLocks()
+	require.NoError(t, err)
+	require.Empty(t, locks)
+
+	require.NoError(t, repo.Close())
+}
@@ -141,6 +141,11 @@ func (s *Store) Create(config []byte) error {
 	return nil
 }
 
+func (s *Store) PutConfig(config []byte) error {
+	_, err := s.minioClient.PutObject(context.Background(), s.bucketName, "CONFIG", bytes.NewReader(config), int64(len(config)), minio.PutObjectOptions{})
+	return err
+}
+
 func (s *Store) Open() ([]byte, error) {
 	parsed, err := url.Parse(s.location)
 	if err != nil {
@@ -18,8 +18,10 @@ package sftp
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"path"
 	"sync"
 
@@ -60,19 +62,24 @@ func (buckets *Buckets) Create() error {
 	return g.Wait()
 }
 
+// List returns the objects of all buckets, temporary files of uploads in
+// progress are ignored.  A bucket that can't be read fails the listing
+// rather than hiding the objects it holds.
 func (buckets *Buckets) List() ([]objects.MAC, error) {
 	ret := make([]objects.MAC, 0)
 	var mu sync.Mutex
 
-	wg := sync.WaitGroup{}
+	var g errgroup.Group
+	g.SetLimit(16)
 	for i := 0; i < 256; i++ {
 		path := path.Join(buckets.path, fmt.Sprintf("%02x", i))
-		wg.Add(1)
-		go func(path string) {
-			defer wg.Done()
+		g.Go(func() error {
 			entries, err := buckets.client.ReadDir(path)
 			if err != nil {
-				return
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
 			}
 			for _, entry := range entries {
 				if entry.Name() == "." || entry.Name() == ".." {
@@ -95,9 +102,12 @@ func (buckets *Buckets) List() ([]objects.MAC, error) {
 				ret = append(ret, t32)
 				mu.Unlock()
 			}
-		}(path)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
-	wg.Wait()
 	return ret, nil
 }
 
@@ -41,19 +41,35 @@ import (
 )
 
 type Store struct {
-	location  string
-	packfiles Buckets
-	states    Buckets
-	client    *sftp.Client
+	location   string
+	identity   string
+	knownHosts string
+	packfiles  Buckets
+	states     Buckets
+	conn       *ssh.Client
+	client     *sftp.Client
 }
 
 func init() {
 	storage.Register("sftp", NewStore)
 }
 
-func defaultSigners() ([]ssh.Signer, error) {
+func defaultSigners(identity string) ([]ssh.Signer, error) {
 	var signers []ssh.Signer
 
+	// An explicit identity is the only key offered.
+	if identity != "" {
+		data, err := os.ReadFile(identity)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", identity, err)
+		}
+		return append(signers, signer), nil
+	}
+
 	// Try the SSH agent first.
 	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
 		conn, err := net.Dial("unix", sock)
@@ -96,7 +112,9 @@ func defaultSigners() ([]ssh.Signer, error) {
 
 func NewStore(storeConfig map[string]string) (storage.Store, error) {
 	return &Store{
-		location: storeConfig["location"],
+		location:   storeConfig["location"],
+		identity:   storeConfig["identity"],
+		knownHosts: storeConfig["known_hosts"],
 	}, nil
 }
 
@@ -123,40 +141,42 @@ func (s *Store) Path(args ...string) string {
 	return path.Join(args...)
 }
 
-func connect(location string) (*sftp.Client, error) {
-	parsed, err := url.Parse(location)
+func (s *Store) connect() error {
+	parsed, err := url.Parse(s.location)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var sshHost string
+	sshHost := parsed.Host
 	if parsed.Port() == "" {
-		sshHost = parsed.Host + ":22"
-	} else {
-		sshHost = parsed.Host
+		sshHost = net.JoinHostPort(parsed.Hostname(), "22")
 	}
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %v", err)
+
+	knownHostsPath := s.knownHosts
+	if knownHostsPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %v", err)
+		}
+		knownHostsPath = path.Join(homeDir, ".ssh", "known_hosts")
 	}
-	knownHostsPath := path.Join(homeDir, ".ssh", "known_hosts")
 
 	// Create the HostKeyCallback from the known_hosts file.
 	hostKeyCallback, err := knownhosts.New(knownHostsPath)
 	if err != nil {
-		return nil, fmt.Errorf("could not create hostkeycallback function: %v", err)
+		return fmt.Errorf("could not create hostkeycallback function: %v", err)
 	}
 
-	signers, err := defaultSigners()
+	signers, err := defaultSigners(s.identity)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	username := parsed.User.Username()
 	if username == "" {
 		u, err := user.Current()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		username = u.Username
 	}
@@ -169,24 +189,24 @@ func connect(location string) (*sftp.Client, error) {
 		HostKeyCallback: hostKeyCallback,
 	}
 
-	client, err := ssh.Dial("tcp", sshHost, config)
+	conn, err := ssh.Dial("tcp", sshHost, config)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	sftpClient, err := sftp.NewClient(client)
+	client, err := sftp.NewClient(conn)
 	if err != nil {
-		client.Close()
-		return nil, err
+		conn.Close()
+		return err
 	}
-	return sftpClient, nil
+	s.conn, s.client = conn, client
+	return nil
 }
 
 func (s *Store) Create(config []byte) error {
-	client, err := connect(s.location)
-	if err != nil {
+	if err := s.connect(); err != nil {
 		return err
 	}
-	s.client = client
+	client := s.client
 
 	dirfp, err := client.ReadDir(s.Path())
 	if err != nil {
@@ -224,12 +244,15 @@ func (s *Store) Create(config []byte) error {
 	return WriteToFileAtomic(client, s.Path("CONFIG"), bytes.NewReader(config))
 }
 
+func (s *Store) PutConfig(config []byte) error {
+	return WriteToFileAtomic(s.client, s.Path("CONFIG"), bytes.NewReader(config))
+}
+
 func (s *Store) Open() ([]byte, error) {
-	client, err := connect(s.location)
-	if err != nil {
+	if err := s.connect(); err != nil {
 		return nil, err
 	}
-	s.client = client
+	client := s.client
 
 	rd, err := client.Open(s.Path("CONFIG"))
 	if err != nil {
@@ -285,7 +308,15 @@ func (s *Store) PutPackfile(mac objects.MAC, rd io.Reader) error {
 }
 
 func (s *Store) Close() error {
-	return nil
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	s.client, s.conn = nil, nil
+	return err
 }
 
 /* Indexes */
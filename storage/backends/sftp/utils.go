@@ -18,8 +18,12 @@ package sftp
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/pkg/sftp"
@@ -87,9 +91,18 @@ func WriteToFileAtomic(sftpClient *sftp.Client, filename string, rd io.Reader) e
 	return WriteToFileAtomicTempDir(sftpClient, filename, rd, filepath.Dir(filename))
 }
 
+// WriteToFileAtomicTempDir uploads to a temporary file of tmpdir, named
+// so that concurrent uploads of the same file don't collide, and renames
+// it in place once complete.  The rename replaces an existing file when
+// the server supports the posix-rename extension.
 func WriteToFileAtomicTempDir(sftpClient *sftp.Client, filename string, rd io.Reader, tmpdir string) error {
-	tmp := fmt.Sprintf("%s.tmp", filename)
-	f, err := sftpClient.Create(tmp)
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return err
+	}
+	tmp := path.Join(tmpdir, "tmp."+hex.EncodeToString(suffix[:]))
+
+	f, err := sftpClient.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
 	if err != nil {
 		return err
 	}
@@ -105,7 +118,11 @@ func WriteToFileAtomicTempDir(sftpClient *sftp.Client, filename string, rd io.Re
 		return err
 	}
 
-	err = sftpClient.Rename(f.Name(), filename)
+	if _, ok := sftpClient.HasExtension("posix-rename@openssh.com"); ok {
+		err = sftpClient.PosixRename(f.Name(), filename)
+	} else {
+		err = sftpClient.Rename(f.Name(), filename)
+	}
 	if err != nil {
 		sftpClient.Remove(f.Name())
 		return err
@@ -18,6 +18,7 @@ package storage
 
 import (
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -41,12 +42,30 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 )
 
-const VERSION string = "1.0.0"
+// VERSION is the newest configuration version understood, the one written
+// for repositories whose key is wrapped under the passphrase.
+const VERSION string = "1.1.0"
+
+// VERSION_UNWRAPPED is written for the other repositories, which releases
+// predating wrapped keys can still open.
+const VERSION_UNWRAPPED string = "1.0.0"
+
+var ErrUnsupportedVersion = errors.New("unsupported repository version")
 
 func init() {
 	versioning.Register(resources.RT_CONFIG, versioning.FromString(VERSION))
 }
 
+// CheckVersion refuses the configurations of another major version, or of a
+// newer minor version whose additions would be silently ignored.
+func CheckVersion(version versioning.Version) error {
+	current := versioning.FromString(VERSION)
+	if version.Major() != current.Major() || version.Minor() > current.Minor() {
+		return fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+	}
+	return nil
+}
+
 type Configuration struct {
 	Version      versioning.Version `msgpack:"-"`
 	Timestamp    time.Time
@@ -57,11 +76,15 @@ type Configuration struct {
 	Hashing     hashing.Configuration
 	Compression *compression.Configuration
 	Encryption  *encryption.Configuration
+
+	// default retention of the snapshots of scheduled backups which do
+	// not set their own, zero to keep them forever
+	Retention time.Duration `msgpack:",omitempty"`
 }
 
 func NewConfiguration() *Configuration {
 	return &Configuration{
-		Version:      versioning.FromString(VERSION),
+		Version:      versioning.FromString(VERSION_UNWRAPPED),
 		Timestamp:    time.Now(),
 		RepositoryID: uuid.Must(uuid.NewRandom()),
 
@@ -104,9 +127,19 @@ func (c *Configuration) ToBytes() ([]byte, error) {
 	return msgpack.Marshal(c)
 }
 
+// FormatVersion returns the version the configuration is to be written
+// with, the oldest one able to represent it.
+func (c *Configuration) FormatVersion() versioning.Version {
+	if c.Encryption != nil && c.Encryption.KDFParams.WrappedKey != nil {
+		return versioning.FromString(VERSION)
+	}
+	return versioning.FromString(VERSION_UNWRAPPED)
+}
+
 type Store interface {
 	Create(config []byte) error
 	Open() ([]byte, error)
+	PutConfig(config []byte) error
 	Location() string
 
 	GetStates() ([]objects.MAC, error)
@@ -128,6 +161,12 @@ type Store interface {
 	Close() error
 }
 
+// PackfileSizer is implemented by the stores able to tell the size of a
+// packfile without fetching it, so that its index can be read alone.
+type PackfileSizer interface {
+	GetPackfileSize(mac objects.MAC) (uint64, error)
+}
+
 var muBackends sync.Mutex
 var backends = make(map[string]func(map[string]string) (Store, error))
 
@@ -186,6 +225,8 @@ func New(storeConfig map[string]string) (Store, error) {
 			backendName = "fs"
 		} else if strings.HasPrefix(location, "sftp://") {
 			backendName = "sftp"
+		} else if strings.HasPrefix(location, "rclone://") {
+			backendName = "rclone"
 		} else if strings.Contains(location, "://") {
 			return nil, fmt.Errorf("unsupported plakar protocol")
 		}
@@ -1,6 +1,7 @@
 package storage_test
 
 import (
+	"errors"
 	"os"
 	"runtime"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/storage"
 	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
 )
 
 func TestNewStore(t *testing.T) {
@@ -164,3 +166,33 @@ func TestNew(t *testing.T) {
 		}
 	})
 }
+
+func TestCheckVersion(t *testing.T) {
+	for _, version := range []string{storage.VERSION, storage.VERSION_UNWRAPPED, "1.1.7"} {
+		if err := storage.CheckVersion(versioning.FromString(version)); err != nil {
+			t.Errorf("expected version %s to be supported, got %v", version, err)
+		}
+	}
+	for _, version := range []string{"1.2.0", "2.0.0", "0.9.0"} {
+		if err := storage.CheckVersion(versioning.FromString(version)); !errors.Is(err, storage.ErrUnsupportedVersion) {
+			t.Errorf("expected version %s to be unsupported, got %v", version, err)
+		}
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	config := storage.NewConfiguration()
+	if config.FormatVersion() != versioning.FromString(storage.VERSION_UNWRAPPED) {
+		t.Errorf("expected version %s without a wrapped key, got %s", storage.VERSION_UNWRAPPED, config.FormatVersion())
+	}
+
+	config.Encryption.KDFParams.WrappedKey = []byte("wrapped")
+	if config.FormatVersion() != versioning.FromString(storage.VERSION) {
+		t.Errorf("expected version %s with a wrapped key, got %s", storage.VERSION, config.FormatVersion())
+	}
+
+	config.Encryption = nil
+	if config.FormatVersion() != versioning.FromString(storage.VERSION_UNWRAPPED) {
+		t.Errorf("expected version %s without encryption, got %s", storage.VERSION_UNWRAPPED, config.FormatVersion())
+	}
+}
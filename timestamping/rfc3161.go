@@ -0,0 +1,345 @@
+// Package timestamping requests and verifies RFC3161 timestamp tokens,
+// proving that a digest existed at a given date.
+package timestamping
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+const (
+	statusGranted         = 0
+	statusGrantedWithMods = 1
+	contentTypeQuery      = "application/timestamp-query"
+	maxResponseSize       = 1024 * 1024
+	defaultTimeout        = 30 * time.Second
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// Receipt describes a verified timestamp token.
+type Receipt struct {
+	Time         time.Time
+	SerialNumber *big.Int
+	Policy       string
+	Signer       *x509.Certificate
+	// Trusted is true if the signer certificate chains up to the system
+	// roots and is allowed to issue timestamps.
+	Trusted bool
+
+	nonce *big.Int
+}
+
+// Request asks the timestamping authority at url to timestamp digest, a
+// SHA-256 hash, and returns the DER-encoded timestamp token.
+func Request(url string, digest []byte) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("invalid digest length %d", len(digest))
+	}
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: defaultTimeout}
+	resp, err := client.Post(url, contentTypeQuery, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamping authority returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var tsResp timeStampResp
+	if _, err := asn1.Unmarshal(data, &tsResp); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response: %w", err)
+	}
+	if tsResp.Status.Status != statusGranted && tsResp.Status.Status != statusGrantedWithMods {
+		return nil, fmt.Errorf("timestamp request rejected with status %d %v", tsResp.Status.Status, tsResp.Status.StatusString)
+	}
+
+	token := tsResp.TimeStampToken.FullBytes
+	receipt, err := Verify(token, digest)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.nonce == nil || receipt.nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("timestamp token nonce mismatch")
+	}
+	return token, nil
+}
+
+// Verify checks that token is a timestamp token for digest, correctly
+// signed by one of the certificates it embeds.
+func Verify(token []byte, digest []byte) (*Receipt, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("invalid timestamp token: not a signed data")
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("invalid timestamp token: not a TSTInfo")
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token info: %w", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, fmt.Errorf("timestamp token does not match digest")
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp token certificates: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("invalid timestamp token: expected one signer, got %d", len(sd.SignerInfos))
+	}
+
+	signer, err := verifySigner(&sd.SignerInfos[0], sd.EncapContentInfo.EContent, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &Receipt{
+		Time:         info.GenTime,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy.String(),
+		Signer:       signer,
+		nonce:        info.Nonce,
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+	_, err = signer.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	receipt.Trusted = err == nil
+
+	return receipt, nil
+}
+
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %s", oid)
+}
+
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) x509.SignatureAlgorithm {
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA384:
+			return x509.SHA384WithRSA
+		case crypto.SHA512:
+			return x509.SHA512WithRSA
+		}
+		return x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512
+		}
+		return x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// verifySigner checks the signed attributes of si against content and their
+// signature against the certificates, returning the signer certificate.
+func verifySigner(si *signerInfo, content []byte, certs []*x509.Certificate) (*x509.Certificate, error) {
+	hash, err := hashForOID(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return nil, fmt.Errorf("invalid timestamp token: no signed attributes")
+	}
+
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+	rest := si.SignedAttrs.Bytes
+	for len(rest) > 0 {
+		var attr attribute
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signed attributes: %w", err)
+		}
+		if len(attr.Values) != 1 {
+			continue
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &contentType); err != nil {
+				return nil, err
+			}
+		case attr.Type.Equal(oidMessageDigest):
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &messageDigest); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !contentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("invalid timestamp token: content type mismatch")
+	}
+
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), messageDigest) {
+		return nil, fmt.Errorf("invalid timestamp token: message digest mismatch")
+	}
+
+	// the signature covers the DER encoding of the attributes as a SET,
+	// not as the implicitly tagged field they are stored in.
+	signed := make([]byte, len(si.SignedAttrs.FullBytes))
+	copy(signed, si.SignedAttrs.FullBytes)
+	signed[0] = 0x31
+
+	for _, cert := range certs {
+		if err := cert.CheckSignature(signatureAlgorithm(cert, hash), signed, si.Signature); err == nil {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid timestamp token: signature verification failed")
+}
@@ -0,0 +1,141 @@
+package timestamping
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func marshal(t *testing.T, v interface{}) []byte {
+	data, err := asn1.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
+
+// newTestAuthority returns a timestamping authority signing tokens with a
+// self-signed certificate.
+func newTestAuthority(t *testing.T, genTime time.Time) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test tsa"},
+		NotBefore:    genTime.Add(-time.Hour),
+		NotAfter:     genTime.Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var req timeStampReq
+		_, err = asn1.Unmarshal(body, &req)
+		require.NoError(t, err)
+
+		eContent := marshal(t, tstInfo{
+			Version:        1,
+			Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(42),
+			GenTime:        genTime,
+			Nonce:          req.Nonce,
+		})
+
+		contentDigest := sha256.Sum256(eContent)
+		attrs := append(
+			marshal(t, attribute{
+				Type:   oidContentType,
+				Values: []asn1.RawValue{{FullBytes: marshal(t, oidTSTInfo)}},
+			}),
+			marshal(t, attribute{
+				Type:   oidMessageDigest,
+				Values: []asn1.RawValue{{FullBytes: marshal(t, contentDigest[:])}},
+			})...,
+		)
+		signedAttrs := marshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+		signedDigest := sha256.Sum256(signedAttrs)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, signedDigest[:])
+		require.NoError(t, err)
+
+		sd := marshal(t, signedData{
+			Version:          3,
+			DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+			EncapContentInfo: encapsulatedContentInfo{
+				EContentType: oidTSTInfo,
+				EContent:     eContent,
+			},
+			Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+			SignerInfos: []signerInfo{{
+				Version:            1,
+				SID:                asn1.RawValue{FullBytes: marshal(t, cert.SerialNumber)},
+				DigestAlgorithm:    sha256Algorithm,
+				SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+				SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+				Signature:          signature,
+			}},
+		})
+
+		// asn1.Marshal ignores the explicit tag of raw values
+		token := marshal(t, struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue
+		}{
+			ContentType: oidSignedData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+		})
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(marshal(t, timeStampResp{
+			Status:         pkiStatusInfo{Status: statusGranted},
+			TimeStampToken: asn1.RawValue{FullBytes: token},
+		}))
+	}))
+}
+
+func TestRequestVerify(t *testing.T) {
+	genTime := time.Now().UTC().Truncate(time.Second)
+	srv := newTestAuthority(t, genTime)
+	defer srv.Close()
+
+	digest := sha256.Sum256([]byte("snapshot header"))
+
+	token, err := Request(srv.URL, digest[:])
+	require.NoError(t, err)
+
+	receipt, err := Verify(token, digest[:])
+	require.NoError(t, err)
+	require.True(t, genTime.Equal(receipt.Time))
+	require.Equal(t, int64(42), receipt.SerialNumber.Int64())
+	require.Equal(t, "1.2.3.4", receipt.Policy)
+	require.Equal(t, "test tsa", receipt.Signer.Subject.CommonName)
+	require.False(t, receipt.Trusted)
+
+	other := sha256.Sum256([]byte("another header"))
+	_, err = Verify(token, other[:])
+	require.Error(t, err)
+
+	tampered := append([]byte{}, token...)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = Verify(tampered, digest[:])
+	require.Error(t, err)
+}
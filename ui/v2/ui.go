@@ -37,6 +37,8 @@ type UiOptions struct {
 	NoSpawn        bool
 	Cors           bool
 	Token          string
+	Namespaces     api.NamespacePolicy
+	Paths          api.PathPolicy
 }
 
 //go:embed frontend/*
@@ -44,6 +46,8 @@ var content embed.FS
 
 func Ui(repo *repository.Repository, addr string, opts *UiOptions) error {
 	server := http.NewServeMux()
+	api.SetNamespacePolicy(opts.Namespaces)
+	api.SetPathPolicy(opts.Paths)
 	api.SetupRoutes(server, repo, opts.Token)
 
 	// Serve files from the ./frontend directory